@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"github.com/docker-slim/docker-slim/internal/app/master/kubernetes"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Target is a running pod container on the node
+type Target struct {
+	Namespace   string
+	Pod         string
+	Container   string
+	Image       string
+	ImageID     string
+	ContainerID string
+	Pid         int
+}
+
+// FindTargets returns the running pod containers on the node for the pods selected by the label selector
+// (the containers that are not managed by CRI-O or containerd are skipped)
+func FindTargets(k8sClient *kubernetes.Client, criClient *CRIClient, selector, nodeName string) ([]*Target, error) {
+	pods, err := k8sClient.ListNodePods(selector, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []*Target
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Running == nil {
+				continue
+			}
+
+			containerID := RuntimeContainerID(status.ContainerID)
+			if containerID == "" {
+				log.Debugf("agent: skipping %v/%v (unsupported runtime - %v)", pod.Metadata.Name, status.Name, status.ContainerID)
+				continue
+			}
+
+			pid, err := criClient.ContainerPid(containerID)
+			if err != nil {
+				log.Warnf("agent: skipping %v/%v - %v", pod.Metadata.Name, status.Name, err)
+				continue
+			}
+
+			targets = append(targets, &Target{
+				Namespace:   pod.Metadata.Namespace,
+				Pod:         pod.Metadata.Name,
+				Container:   status.Name,
+				Image:       status.Image,
+				ImageID:     status.ImageID,
+				ContainerID: containerID,
+				Pid:         pid,
+			})
+		}
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const crictlBin = "crictl"
+
+// ErrNoCrictl is returned when crictl is not installed
+var ErrNoCrictl = errors.New("crictl not found")
+
+// the container ID prefixes in the pod container statuses
+var runtimeIDPrefixes = []string{"cri-o://", "containerd://"}
+
+// CRIClient runs crictl commands (the CRI-O and containerd runtimes on the node)
+type CRIClient struct {
+	endpoint   string
+	crictlPath string
+}
+
+type criInspectResult struct {
+	Info struct {
+		Pid int `json:"pid"`
+	} `json:"info"`
+}
+
+// NewCRIClient creates a new crictl client
+// (crictl uses its own configuration or auto-detects the runtime if the endpoint is not set)
+func NewCRIClient(endpoint string) (*CRIClient, error) {
+	crictlPath, err := exec.LookPath(crictlBin)
+	if err != nil {
+		return nil, ErrNoCrictl
+	}
+
+	return &CRIClient{
+		endpoint:   endpoint,
+		crictlPath: crictlPath,
+	}, nil
+}
+
+// RuntimeContainerID returns the CRI container ID from the pod container status ID
+// (it returns an empty string if the container is not managed by CRI-O or containerd)
+func RuntimeContainerID(statusID string) string {
+	for _, prefix := range runtimeIDPrefixes {
+		if strings.HasPrefix(statusID, prefix) {
+			return strings.TrimPrefix(statusID, prefix)
+		}
+	}
+
+	return ""
+}
+
+// ContainerPid returns the host PID of the container init process
+func (c *CRIClient) ContainerPid(containerID string) (int, error) {
+	var args []string
+	if c.endpoint != "" {
+		args = append(args, "--runtime-endpoint", c.endpoint)
+	}
+
+	args = append(args, "inspect", "--output", "json", containerID)
+	log.Debugf("agent: crictl %v", strings.Join(args, " "))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(c.crictlPath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return 0, fmt.Errorf("crictl inspect: %v", message)
+		}
+
+		return 0, fmt.Errorf("crictl inspect: %v", err)
+	}
+
+	var result criInspectResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return 0, err
+	}
+
+	if result.Info.Pid == 0 {
+		return 0, fmt.Errorf("no PID for container %v (crictl inspect)", containerID)
+	}
+
+	return result.Info.Pid, nil
+}
@@ -0,0 +1,11 @@
+package agent
+
+import (
+	"github.com/docker-slim/docker-slim/internal/app/sensor/monitors/fanotify"
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// monitorFiles starts the FANOTIFY monitor for the container root file system mount
+func monitorFiles(rootPath string, stopChan chan struct{}) (<-chan *report.FanMonitorReport, error) {
+	return fanotify.Run(rootPath, stopChan, 0, execRedactPattern, nil)
+}
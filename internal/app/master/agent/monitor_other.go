@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+import (
+	"errors"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// ErrNotSupported is returned when the agent runs on a system without FANOTIFY
+var ErrNotSupported = errors.New("the node agent runs only on Linux")
+
+func monitorFiles(rootPath string, stopChan chan struct{}) (<-chan *report.FanMonitorReport, error) {
+	return nil, ErrNotSupported
+}
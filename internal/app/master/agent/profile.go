@@ -0,0 +1,323 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/ipc/command"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	procFsPidRoot  = "/proc/%d/root"
+	procFsPid      = "/proc/%d"
+	filesDirName   = "files"
+	checkInterval  = time.Second
+	maxLinkTargets = 40
+)
+
+type linkInfo struct {
+	path    string
+	linkRef string
+	target  string
+	mode    os.FileMode
+}
+
+var errTooManyLinks = errors.New("too many levels of symbolic links")
+
+var execRedactPattern = regexp.MustCompile(command.DefaultExecRedactPattern)
+
+// the pseudo file systems are not a part of the image
+var ignoredDirs = map[string]bool{"/proc": true, "/sys": true, "/dev": true}
+
+// Profile monitors the file activity in the running container and saves the monitoring artifacts
+// (the container root file system mount is monitored with FANOTIFY from the node, so the sensor
+// doesn't need to run in the container and the container doesn't need to restart)
+func Profile(target *Target, duration time.Duration, location string) (*report.ContainerReport, error) {
+	rootPath := fmt.Sprintf(procFsPidRoot, target.Pid)
+	stopChan := make(chan struct{})
+	reportChan, err := monitorFiles(rootPath, stopChan)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: %v (the agent needs CAP_SYS_ADMIN and the host PID namespace)", err)
+	}
+
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		if !fsutils.Exists(fmt.Sprintf(procFsPid, target.Pid)) {
+			log.Infof("agent: container %v exited before the end of the monitoring period", target.ContainerID)
+			break
+		}
+
+		time.Sleep(checkInterval)
+	}
+
+	close(stopChan)
+	fanReport := <-reportChan
+	normalizeFanReport(fanReport, rootPath, target.Pid)
+
+	creport := &report.ContainerReport{
+		SchemaVersion: report.SchemaVersion,
+		Monitors: report.MonitorReports{
+			Fan: fanReport,
+		},
+	}
+
+	creport.Image.Files, err = saveArtifacts(rootPath, fanReport, location)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(creport.Image.Files) == 0 {
+		return nil, errors.New("no file activity in the container")
+	}
+
+	if err := report.SaveContainerReport(filepath.Join(location, report.DefaultContainerReportFileName), creport); err != nil {
+		return nil, err
+	}
+
+	return creport, nil
+}
+
+// normalizeFanReport makes the file paths relative to the container root file system
+// (the paths can have the container root prefix if the agent doesn't run in the host mount namespace)
+// and uses the container init process as the main process
+func normalizeFanReport(fanReport *report.FanMonitorReport, rootPath string, pid int) {
+	rootPrefix, err := os.Readlink(rootPath)
+	if err == nil && rootPrefix != "/" {
+		for pidKey, files := range fanReport.ProcessFiles {
+			normalized := map[string]*report.FileInfo{}
+			for fpath, info := range files {
+				if strings.HasPrefix(fpath, rootPrefix+"/") {
+					fpath = strings.TrimPrefix(fpath, rootPrefix)
+					info.Name = fpath
+				}
+
+				normalized[fpath] = info
+			}
+
+			fanReport.ProcessFiles[pidKey] = normalized
+		}
+	}
+
+	if pinfo, ok := fanReport.Processes[strconv.Itoa(pid)]; ok {
+		fanReport.MainProcess = pinfo
+	}
+}
+
+// saveArtifacts copies the accessed files and the symlinks to them from the container to the artifacts 'files' directory
+func saveArtifacts(rootPath string, fanReport *report.FanMonitorReport, location string) ([]*report.ArtifactProps, error) {
+	filesLocation := filepath.Join(location, filesDirName)
+	if err := os.MkdirAll(filesLocation, 0777); err != nil {
+		return nil, err
+	}
+
+	artifacts := map[string]*report.ArtifactProps{}
+	keptDirs := map[string]bool{}
+	for pidKey, files := range fanReport.ProcessFiles {
+		processName := fmt.Sprintf("pid %s", pidKey)
+		if pinfo, ok := fanReport.Processes[pidKey]; ok && pinfo != nil && pinfo.Path != "" {
+			processName = pinfo.Path
+		}
+
+		for fpath, finfo := range files {
+			props, ok := artifacts[fpath]
+			if !ok {
+				info, err := os.Lstat(filepath.Join(rootPath, fpath))
+				if err != nil || !info.Mode().IsRegular() {
+					continue
+				}
+
+				if err := fsutils.CopyRegularFile(filepath.Join(rootPath, fpath), filepath.Join(filesLocation, fpath), true); err != nil {
+					log.Warnf("agent: error copying %v - %v", fpath, err)
+					continue
+				}
+
+				props = &report.ArtifactProps{
+					FileType: report.FileArtifactType,
+					FilePath: fpath,
+					Mode:     info.Mode(),
+					ModeText: info.Mode().String(),
+					FileSize: info.Size(),
+					Flags:    map[string]bool{},
+				}
+
+				artifacts[fpath] = props
+				for dir := filepath.Dir(fpath); dir != "/"; dir = filepath.Dir(dir) {
+					keptDirs[dir] = true
+				}
+			}
+
+			if finfo.ReadCount > 0 {
+				props.Flags["R"] = true
+			}
+
+			if finfo.WriteCount > 0 {
+				props.Flags["W"] = true
+			}
+
+			if finfo.ExeCount > 0 {
+				props.Flags["X"] = true
+			}
+
+			props.AddReason(report.KeepReasonObserved, fmt.Sprintf("accessed by %s", processName))
+		}
+	}
+
+	//the trailing slash is needed to walk the container root (the proc root link is a symlink)
+	var links []*linkInfo
+	err := filepath.Walk(rootPath+"/", func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			//just ignore the error and keep going
+			return nil
+		}
+
+		fpath := filepath.Clean(strings.TrimPrefix(fullPath, rootPath))
+		if ignoredDirs[fpath] {
+			return filepath.SkipDir
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		target, err := resolvePath(rootPath, fpath)
+		if err != nil {
+			return nil
+		}
+
+		linkRef, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil
+		}
+
+		links = append(links, &linkInfo{path: fpath, linkRef: linkRef, target: target, mode: info.Mode()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//the symlinks to the kept symlinks (or to their directories) are also kept
+	for added := true; added; {
+		added = false
+		for _, link := range links {
+			if artifacts[link.path] != nil || (artifacts[link.target] == nil && !keptDirs[link.target]) {
+				continue
+			}
+
+			linkPath := filepath.Join(filesLocation, link.path)
+			if err := os.MkdirAll(filepath.Dir(linkPath), 0777); err != nil {
+				return nil, err
+			}
+
+			if err := os.Symlink(relativeLinkRef(link.path, link.linkRef), linkPath); err != nil {
+				log.Warnf("agent: error creating symlink %v - %v", link.path, err)
+				continue
+			}
+
+			props := &report.ArtifactProps{
+				FileType: report.SymlinkArtifactType,
+				FilePath: link.path,
+				Mode:     link.mode,
+				ModeText: link.mode.String(),
+				LinkRef:  link.linkRef,
+			}
+
+			props.AddReason(report.KeepReasonLink, fmt.Sprintf("symlink to %s", link.linkRef))
+			artifacts[link.path] = props
+			for dir := filepath.Dir(link.path); dir != "/"; dir = filepath.Dir(dir) {
+				keptDirs[dir] = true
+			}
+
+			added = true
+		}
+	}
+
+	var names []string
+	for name := range artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var files []*report.ArtifactProps
+	for _, name := range names {
+		files = append(files, artifacts[name])
+	}
+
+	return files, nil
+}
+
+// relativeLinkRef returns the symlink target relative to the symlink directory
+// (the absolute targets are relative to the container root, so the saved symlinks
+// point to the saved files and the profile server accepts them)
+func relativeLinkRef(linkPath, linkRef string) string {
+	target := linkRef
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(linkPath), target)
+	}
+
+	relRef, err := filepath.Rel(filepath.Dir(linkPath), filepath.Clean(target))
+	if err != nil {
+		return linkRef
+	}
+
+	return relRef
+}
+
+// resolvePath resolves the symlinks in the container path
+// (the absolute symlink targets are relative to the container root, not to the node root)
+func resolvePath(rootPath, fpath string) (string, error) {
+	resolved := "/"
+	remaining := strings.Split(fpath, "/")
+	for links := 0; len(remaining) > 0; {
+		name := remaining[0]
+		remaining = remaining[1:]
+
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(filepath.Join(rootPath, next))
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxLinkTargets {
+			return "", errTooManyLinks
+		}
+
+		linkRef, err := os.Readlink(filepath.Join(rootPath, next))
+		if err != nil {
+			return "", err
+		}
+
+		if filepath.IsAbs(linkRef) {
+			resolved = "/"
+		}
+
+		remaining = append(strings.Split(linkRef, "/"), remaining...)
+	}
+
+	return resolved, nil
+}
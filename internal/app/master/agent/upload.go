@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/server"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/netutils"
+)
+
+type uploadError struct {
+	Error string `json:"error"`
+}
+
+// Upload sends the profile artifacts to the docker-slim 'serve' API
+// and returns the build job the server created for the profile
+// (the artifacts are sent as a gzipped tar archive)
+func Upload(serverURL, token string, target *Target, nodeName string, buildArgs []string, location string) (*server.Job, error) {
+	query := url.Values{}
+	query.Set(server.ProfileParamImage, target.Image)
+	query.Set(server.ProfileParamNode, nodeName)
+	query.Set(server.ProfileParamPod, target.Namespace+"/"+target.Pod)
+	query.Set(server.ProfileParamContainer, target.Container)
+	for _, arg := range buildArgs {
+		query.Add(server.ProfileParamBuildArg, arg)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(writer)
+		err := fsutils.WriteArchive(location, zw)
+		if err == nil {
+			err = zw.Close()
+		}
+
+		writer.CloseWithError(err)
+	}()
+	defer reader.Close()
+
+	endpoint := strings.TrimSuffix(serverURL, "/") + server.ProfilesPath + "?" + query.Encode()
+	req, err := http.NewRequest(http.MethodPost, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/gzip")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, netutils.ProxyError(err, endpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		var errResp uploadError
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("server error (%v): %v", resp.StatusCode, errResp.Error)
+		}
+
+		return nil, fmt.Errorf("server error (%v)", resp.StatusCode)
+	}
+
+	var job server.Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,162 @@
+package artifacts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const filesDirName = "files"
+
+// MergeResult contains the artifact merge stats
+type MergeResult struct {
+	ReportCount  int
+	FileCount    int
+	CopiedCount  int
+	SyscallCount int
+}
+
+// Merge adds the artifacts from other monitoring runs (artifact directories or container reports)
+// to the artifacts in the target location. The merged container report includes the activity
+// from all runs and the files kept in any run are added to the target 'files' directory.
+func Merge(artifactLocation string, sources []string) (*MergeResult, error) {
+	return MergeFiltered(artifactLocation, sources, nil)
+}
+
+// MergeFiltered merges the artifacts like Merge, but it adds only the source files selected by the filter
+// (the directories in the source 'files' directories are always added; a nil filter selects all files)
+func MergeFiltered(artifactLocation string, sources []string, filter func(filePath string) bool) (*MergeResult, error) {
+	result := &MergeResult{}
+
+	if err := os.MkdirAll(artifactLocation, 0777); err != nil {
+		return nil, err
+	}
+
+	creportPath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+	var merged *report.ContainerReport
+	if fsutils.Exists(creportPath) {
+		creport, err := report.LoadContainerReport(creportPath)
+		if err != nil {
+			return nil, err
+		}
+
+		merged = creport
+		result.ReportCount++
+	}
+
+	filesLocation := filepath.Join(artifactLocation, filesDirName)
+	for _, source := range sources {
+		if fsutils.IsDir(source) && fsutils.IsSealed(source) {
+			//the encrypted artifacts (see the state key) are decrypted to a temporary directory
+			openedSource, closeSource, err := fsutils.OpenArtifacts(source)
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting the artifacts in %v - %v", source, err)
+			}
+			defer closeSource()
+
+			source = openedSource
+		}
+
+		sourceReportPath, sourceFilesLocation := sourceLocations(source)
+		if sourceReportPath == creportPath {
+			continue
+		}
+
+		creport, err := report.LoadContainerReport(sourceReportPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading container report from %v - %v", source, err)
+		}
+
+		if filter != nil {
+			var files []*report.ArtifactProps
+			for _, file := range creport.Image.Files {
+				if file != nil &&
+					(filter(file.FilePath) || fsutils.IsDir(filepath.Join(sourceFilesLocation, file.FilePath))) {
+					files = append(files, file)
+				}
+			}
+
+			creport.Image.Files = files
+		}
+
+		merged = report.MergeContainerReports(merged, creport)
+		result.ReportCount++
+
+		if fsutils.IsDir(sourceFilesLocation) {
+			copied, err := copyMissingFiles(sourceFilesLocation, filesLocation, filter)
+			if err != nil {
+				return nil, err
+			}
+
+			result.CopiedCount += copied
+		} else {
+			log.Warnf("artifacts.Merge: no files in %v (only the container report is merged)", source)
+		}
+	}
+
+	if merged == nil {
+		return nil, fmt.Errorf("no container reports to merge")
+	}
+
+	result.FileCount = len(merged.Image.Files)
+	if merged.Monitors.Pt != nil {
+		result.SyscallCount = len(merged.Monitors.Pt.SyscallStats)
+	}
+	if err := report.SaveContainerReport(creportPath, merged); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// sourceLocations returns the container report and the 'files' directory locations for an artifact source
+func sourceLocations(source string) (string, string) {
+	if fsutils.IsDir(source) {
+		return filepath.Join(source, report.DefaultContainerReportFileName), filepath.Join(source, filesDirName)
+	}
+
+	return source, filepath.Join(filepath.Dir(source), filesDirName)
+}
+
+func copyMissingFiles(src, dst string, filter func(filePath string) bool) (int, error) {
+	var copied int
+	err := filepath.Walk(src, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, fullPath)
+		if err != nil {
+			return err
+		}
+
+		dstPath := filepath.Join(dst, relPath)
+		if _, err := os.Lstat(dstPath); err == nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(dstPath, info.Mode().Perm())
+		}
+
+		if filter != nil && !filter("/"+filepath.ToSlash(relPath)) {
+			return nil
+		}
+
+		//the artifact files are not modified after they are saved, so they are linked when it's possible
+		if err := fsutils.LinkOrCopyFile(fullPath, dstPath, true); err != nil {
+			log.Warnf("artifacts.Merge: error copying %v - %v", fullPath, err)
+			return nil
+		}
+
+		copied++
+		return nil
+	})
+
+	return copied, err
+}
@@ -0,0 +1,253 @@
+package artifacts
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	envScanChunkSize = 1024 * 1024
+	maxEnvFilesShown = 3
+)
+
+// the variables the loader, libc, the language runtimes and the shells read
+// (the apps don't reference them in their own files)
+var systemEnvVars = map[string]struct{}{
+	"PATH":            {},
+	"HOME":            {},
+	"HOSTNAME":        {},
+	"USER":            {},
+	"SHELL":           {},
+	"PWD":             {},
+	"SHLVL":           {},
+	"TERM":            {},
+	"TZ":              {},
+	"TMPDIR":          {},
+	"LANG":            {},
+	"LANGUAGE":        {},
+	"LD_LIBRARY_PATH": {},
+	"LD_PRELOAD":      {},
+	"SSL_CERT_FILE":   {},
+	"SSL_CERT_DIR":    {},
+}
+
+var systemEnvVarPrefixes = []string{"LC_"}
+
+// ENV instructions with these name parts probably include secrets
+var secretEnvNameParts = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "API_KEY", "APIKEY", "ACCESS_KEY", "PRIVATE_KEY"}
+
+// IsSecretEnvName returns true if the environment variable name looks like a secret name
+func IsSecretEnvName(name string) bool {
+	upperName := strings.ToUpper(name)
+	for _, namePart := range secretEnvNameParts {
+		if strings.Contains(upperName, namePart) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnvUsage checks which of the image environment variables the target app used and saves the results
+// in the container report. getenv is not a system call, so the sensor can't see it: a variable is used
+// if its name is referenced by any of the files the app accessed or loaded (the executables, the libraries,
+// the scripts and the config files, e.g., '${DB_HOST}' in a config template or 'DB_HOST' in a binary).
+func EnvUsage(artifactLocation string, env []string) ([]report.EnvVarUsage, error) {
+	creportPath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+	creport, err := report.LoadContainerReport(creportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []report.EnvVarUsage
+	var names [][]byte
+	seen := map[string]bool{}
+	for _, envVar := range env {
+		name := strings.SplitN(envVar, "=", 2)[0]
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		info := report.EnvVarUsage{
+			Name:   name,
+			Status: report.EnvVarUnused,
+			Secret: IsSecretEnvName(name),
+		}
+
+		if isSystemEnvVar(name) {
+			info.Status = report.EnvVarSystem
+		} else {
+			names = append(names, []byte(name))
+		}
+
+		usage = append(usage, info)
+	}
+
+	refs := map[string][]string{}
+	if len(names) > 0 {
+		filesLocation := filepath.Join(artifactLocation, filesDirName)
+		for _, file := range creport.Image.Files {
+			if file == nil || !isAccessedFile(file) {
+				continue
+			}
+
+			found, err := scanEnvRefs(filepath.Join(filesLocation, file.FilePath), names)
+			if err != nil {
+				log.Debugf("artifacts.EnvUsage: error scanning %v - %v", file.FilePath, err)
+				continue
+			}
+
+			for _, name := range found {
+				if len(refs[name]) < maxEnvFilesShown {
+					refs[name] = append(refs[name], file.FilePath)
+				}
+			}
+		}
+	}
+
+	for idx := range usage {
+		if files, ok := refs[usage[idx].Name]; ok {
+			usage[idx].Status = report.EnvVarUsed
+			usage[idx].Files = files
+		}
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Name < usage[j].Name
+	})
+
+	creport.Image.EnvVars = usage
+	if err := report.SaveContainerReport(creportPath, creport); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+func isSystemEnvVar(name string) bool {
+	if _, ok := systemEnvVars[name]; ok {
+		return true
+	}
+
+	for _, prefix := range systemEnvVarPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAccessedFile returns true if the target app accessed or loaded the file
+// (the files kept only because of the include paths or the links are not checked;
+// the reports without the keep reasons are from the older sensors, so all their files are checked)
+func isAccessedFile(file *report.ArtifactProps) bool {
+	if len(file.Reasons) == 0 {
+		return true
+	}
+
+	for _, reason := range file.Reasons {
+		if reason.Type == report.KeepReasonObserved || reason.Type == report.KeepReasonLibrary {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanEnvRefs returns the variable names referenced in the file
+// (the file is read in chunks, so the large binaries are not loaded in memory)
+func scanEnvRefs(filePath string, names [][]byte) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, err
+	}
+
+	maxNameLen := 0
+	for _, name := range names {
+		if len(name) > maxNameLen {
+			maxNameLen = len(name)
+		}
+	}
+
+	var found []string
+	pending := names
+	//the chunks overlap, so the names split between two chunks are found (with their boundary bytes)
+	overlap := maxNameLen + 1
+	buf := make([]byte, envScanChunkSize+overlap)
+	carry := 0
+	for first := true; len(pending) > 0; first = false {
+		n, err := io.ReadFull(file, buf[carry:])
+		data := buf[:carry+n]
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+
+		var left [][]byte
+		for _, name := range pending {
+			if hasNameRef(data, name, first, last) {
+				found = append(found, string(name))
+			} else {
+				left = append(left, name)
+			}
+		}
+		pending = left
+
+		if last {
+			break
+		}
+
+		if err != nil {
+			return found, err
+		}
+
+		carry = overlap
+		if carry > len(data) {
+			carry = len(data)
+		}
+		copy(buf, data[len(data)-carry:])
+	}
+
+	return found, nil
+}
+
+// hasNameRef returns true if the data has the name as a whole identifier
+// (e.g., 'DB_HOST' doesn't match 'MY_DB_HOST' or 'DB_HOSTS').
+// The matches at the chunk edges are checked with the next chunk (the overlap has their boundary bytes).
+func hasNameRef(data, name []byte, first, last bool) bool {
+	for offset := 0; offset < len(data); {
+		idx := bytes.Index(data[offset:], name)
+		if idx == -1 {
+			return false
+		}
+
+		start := offset + idx
+		end := start + len(name)
+		startOk := (start == 0 && first) || (start > 0 && !isIdentByte(data[start-1]))
+		endOk := (end == len(data) && last) || (end < len(data) && !isIdentByte(data[end]))
+		if startOk && endOk {
+			return true
+		}
+
+		offset = start + 1
+	}
+
+	return false
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
@@ -0,0 +1,101 @@
+package artifacts
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerimage"
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// Removed files listing artifact names
+const (
+	RemovedFilesName     = "removed-files.tsv"
+	RemovedFilesGzipName = "removed-files.tsv.gz"
+)
+
+const removedFilesHeader = "path\tsize\tlayer_index\tlayer_id"
+
+// RemovedFilesResult contains the removed files listing stats
+type RemovedFilesResult struct {
+	Name  string
+	Count int
+	Size  int64
+}
+
+// SaveRemovedFiles saves the listing of the files in the original image that are not kept
+// in the minified image (one tab-separated line per file: path, size and the layer the file comes from)
+func SaveRemovedFiles(inventory *dockerimage.Inventory, artifactLocation string, doGzip bool) (*RemovedFilesResult, error) {
+	creportPath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+	creport, err := report.LoadContainerReport(creportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keptFiles := map[string]struct{}{}
+	for _, info := range creport.Image.Files {
+		keptFiles[info.FilePath] = struct{}{}
+	}
+
+	var removed []*dockerimage.FileInfo
+	for filePath, info := range inventory.Files {
+		if _, ok := keptFiles[filePath]; !ok {
+			removed = append(removed, info)
+		}
+	}
+
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Path < removed[j].Path
+	})
+
+	result := &RemovedFilesResult{
+		Name:  RemovedFilesName,
+		Count: len(removed),
+	}
+
+	if doGzip {
+		result.Name = RemovedFilesGzipName
+	}
+
+	//remove the listing from the previous runs (it might use the other format)
+	for _, name := range []string{RemovedFilesName, RemovedFilesGzipName} {
+		os.Remove(filepath.Join(artifactLocation, name))
+	}
+
+	file, err := os.Create(filepath.Join(artifactLocation, result.Name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var out io.Writer = file
+	var gzw *gzip.Writer
+	if doGzip {
+		gzw = gzip.NewWriter(file)
+		out = gzw
+	}
+
+	bw := bufio.NewWriter(out)
+	fmt.Fprintln(bw, removedFilesHeader)
+	for _, info := range removed {
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%s\n", info.Path, info.Size, info.LayerIndex, info.LayerID)
+		result.Size += info.Size
+	}
+
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	if gzw != nil {
+		if err := gzw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, file.Close()
+}
@@ -0,0 +1,25 @@
+package artifacts
+
+import (
+	"path/filepath"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerimage"
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// DirSizes creates the per-top-level-directory size breakdown (original vs kept files)
+// and saves it in the container report
+func DirSizes(inventory *dockerimage.Inventory, artifactLocation string) ([]report.DirSizeInfo, error) {
+	creportPath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+	creport, err := report.LoadContainerReport(creportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	creport.Image.DirSizes = report.DirSizes(inventory.FileSizes(), creport.Image.Files)
+	if err := report.SaveContainerReport(creportPath, creport); err != nil {
+		return nil, err
+	}
+
+	return creport.Image.DirSizes, nil
+}
@@ -0,0 +1,113 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+)
+
+// StoreIndexFileName is the artifact store index file name
+const StoreIndexFileName = "store.json"
+
+// StoreRun is a monitoring run added to the artifact store
+type StoreRun struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	// NewFileCount is the number of the kept files the run added to the store
+	NewFileCount int `json:"new_file_count"`
+}
+
+// StoreIndex describes the artifacts in the artifact store
+// (the store accumulates the artifacts from the monitoring runs of one image)
+type StoreIndex struct {
+	ImageID   string     `json:"image_id"`
+	Image     string     `json:"image,omitempty"`
+	FileCount int        `json:"file_count"`
+	Runs      []StoreRun `json:"runs"`
+}
+
+// LoadStoreIndex loads the artifact store index (it returns nil if the store is empty)
+func LoadStoreIndex(storeLocation string) (*StoreIndex, error) {
+	data, err := ioutil.ReadFile(filepath.Join(storeLocation, StoreIndexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var index StoreIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+
+	return &index, nil
+}
+
+func (s *StoreIndex) save(storeLocation string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(storeLocation, StoreIndexFileName), data, 0644)
+}
+
+// CheckStore returns an error if the artifact store has the artifacts for another image
+// (the kept files from the other image artifacts would break the minified image)
+func CheckStore(storeLocation, imageID string) (*StoreIndex, error) {
+	index, err := LoadStoreIndex(storeLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	if index != nil && index.ImageID != imageID {
+		return nil, fmt.Errorf("the artifact store %v has the artifacts for another image (%v)", storeLocation, index.ImageID)
+	}
+
+	return index, nil
+}
+
+// AppendToStore adds the artifacts from a monitoring run (an artifact directory or a container report)
+// to the artifact store and returns the updated store index (the run name describes the run in the index).
+// The store has the superset of the kept files and the merged container report from all runs,
+// so it's also an artifact directory for 'build --from-report'.
+func AppendToStore(storeLocation, imageID, imageRef, source, runName string) (*StoreIndex, error) {
+	index, err := CheckStore(storeLocation, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if index == nil {
+		if fsutils.Exists(filepath.Join(storeLocation, filesDirName)) {
+			return nil, fmt.Errorf("%v is not an artifact store (it has the artifacts without the store index)", storeLocation)
+		}
+
+		index = &StoreIndex{ImageID: imageID}
+	}
+
+	result, err := Merge(storeLocation, []string{source})
+	if err != nil {
+		return nil, err
+	}
+
+	index.Image = imageRef
+	index.Runs = append(index.Runs, StoreRun{
+		Time:         time.Now().UTC(),
+		Source:       runName,
+		NewFileCount: result.FileCount - index.FileCount,
+	})
+	index.FileCount = result.FileCount
+
+	if err := index.save(storeLocation); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
@@ -0,0 +1,274 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/registry"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Event types
+const (
+	EventCommand   = "command"
+	EventImage     = "image"
+	EventContainer = "container"
+	EventRegistry  = "registry"
+)
+
+// Event actions
+const (
+	ActionStart   = "start"
+	ActionDone    = "done"
+	ActionInspect = "inspect"
+	ActionList    = "list"
+	ActionPull    = "pull"
+	ActionBuild   = "build"
+	ActionImport  = "import"
+	ActionCreate  = "create"
+	ActionRemove  = "remove"
+)
+
+// Container runtimes (the runtime that performed the operation)
+const (
+	RuntimeDocker     = runtime.Docker
+	RuntimeContainerd = runtime.Containerd
+	RuntimeKubernetes = "kubernetes"
+)
+
+const redactedValue = "<redacted>"
+
+// the flags with the values that are not recorded (the credentials and the environment variables)
+var sensitiveFlagPat = regexp.MustCompile(`(?i)(token|passw|secret|header|auth|cred|^env$)`)
+
+// Record is an audit log record (one JSON object per line).
+// The records for one command run have the same run ID.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RunID     string    `json:"run_id"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Event     string    `json:"event"`
+	Action    string    `json:"action"`
+	Args      []string  `json:"args,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Runtime   string    `json:"runtime,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Registry  string    `json:"registry,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type auditLog struct {
+	lock     sync.Mutex
+	file     *os.File
+	runID    string
+	user     string
+	host     string
+	doneOnce sync.Once
+}
+
+var current *auditLog
+
+// Open opens the audit log (the records are appended to the file) and records the command start.
+// The command done record is written by Close or when the application is terminated with an exit code.
+func Open(path string, args []string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	current = &auditLog{
+		file:  file,
+		runID: newRunID(),
+		user:  userName(),
+	}
+
+	current.host, _ = os.Hostname()
+	errutils.OnExit(Close)
+
+	write(&Record{
+		Event:  EventCommand,
+		Action: ActionStart,
+		Args:   redactArgs(args),
+	})
+
+	return nil
+}
+
+// Close records the command done event with the exit code and closes the audit log
+func Close(exitCode int) {
+	if current == nil {
+		return
+	}
+
+	current.doneOnce.Do(func() {
+		write(&Record{
+			Event:    EventCommand,
+			Action:   ActionDone,
+			ExitCode: &exitCode,
+		})
+
+		current.lock.Lock()
+		defer current.lock.Unlock()
+		current.file.Close()
+		current.file = nil
+	})
+}
+
+// Image records an image operation (the registry is recorded for the pulled images)
+func Image(runtimeName, action, image string, err error) {
+	record := &Record{
+		Event:   EventImage,
+		Action:  action,
+		Runtime: runtimeName,
+		Image:   image,
+	}
+
+	if action == ActionPull {
+		record.Registry = registryHost(image)
+	}
+
+	write(withError(record, err))
+}
+
+// Container records a container operation (the pods in the Kubernetes mode)
+func Container(runtimeName, action, container, image string, err error) {
+	write(withError(&Record{
+		Event:     EventContainer,
+		Action:    action,
+		Runtime:   runtimeName,
+		Container: container,
+		Image:     image,
+	}, err))
+}
+
+// Registry records a registry API operation (without the Docker engine)
+func Registry(action, image string, err error) {
+	write(withError(&Record{
+		Event:    EventRegistry,
+		Action:   action,
+		Image:    image,
+		Registry: registryHost(image),
+	}, err))
+}
+
+func withError(record *Record, err error) *Record {
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return record
+}
+
+// write appends the record to the audit log (the audit log errors are logged, they don't stop the operations)
+func write(record *Record) {
+	if current == nil {
+		return
+	}
+
+	current.lock.Lock()
+	defer current.lock.Unlock()
+
+	if current.file == nil {
+		return
+	}
+
+	record.Time = time.Now().UTC()
+	record.RunID = current.runID
+	record.User = current.user
+	record.Host = current.host
+	record.PID = os.Getpid()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("audit: error encoding the record - %v", err)
+		return
+	}
+
+	//one write for each record, so the records from the concurrent runs are not interleaved
+	if _, err := current.file.Write(append(data, '\n')); err != nil {
+		log.Errorf("audit: error writing the record - %v", err)
+	}
+}
+
+func newRunID() string {
+	data := make([]byte, 8)
+	if _, err := rand.Read(data); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+
+	return hex.EncodeToString(data)
+}
+
+// userName returns the user running the command (the user that ran sudo if it's available)
+func userName() string {
+	name := "unknown"
+	if info, err := user.Current(); err == nil {
+		name = info.Username
+	}
+
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" && sudoUser != name {
+		name = sudoUser + " (as " + name + ")"
+	}
+
+	return name
+}
+
+func registryHost(image string) string {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return ""
+	}
+
+	return ref.Host
+}
+
+// redactArgs returns the command line arguments without the values of the sensitive flags
+func redactArgs(args []string) []string {
+	var redacted []string
+	redactNext := false
+	for _, arg := range args {
+		if redactNext {
+			redactNext = false
+			if !strings.HasPrefix(arg, "-") {
+				redacted = append(redacted, redactedValue)
+				continue
+			}
+		}
+
+		if strings.HasPrefix(arg, "-") {
+			name := strings.TrimLeft(arg, "-")
+			value := ""
+			hasValue := false
+			if idx := strings.Index(name, "="); idx != -1 {
+				name, value, hasValue = name[:idx], name[idx+1:], true
+			}
+
+			if sensitiveFlagPat.MatchString(name) {
+				if hasValue {
+					if value != "" {
+						arg = arg[:len(arg)-len(value)] + redactedValue
+					}
+				} else {
+					redactNext = true
+				}
+			}
+		}
+
+		redacted = append(redacted, arg)
+	}
+
+	return redacted
+}
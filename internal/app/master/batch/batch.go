@@ -0,0 +1,109 @@
+package batch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnterminatedQuote is returned when a quoted option value is not terminated
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// Image is one image in the batch image list
+type Image struct {
+	Name string
+	Args []string
+}
+
+// ParseList loads the batch image list: one image per line with the optional 'build' command options
+// for the image (e.g., 'my/app:latest --http-probe --tag my/app:slim'). The empty lines
+// and the lines starting with '#' are ignored.
+func ParseList(location string) ([]Image, error) {
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var images []Image
+	lineNum := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields, err := SplitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", location, lineNum, err)
+		}
+
+		if strings.HasPrefix(fields[0], "-") {
+			return nil, fmt.Errorf("%s:%d: the line must start with the image name", location, lineNum)
+		}
+
+		images = append(images, Image{
+			Name: fields[0],
+			Args: fields[1:],
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// SplitArgs splits the command options the way a shell does
+// (the single and double quotes group the words and the backslash escapes the next character)
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	escaped := false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, ErrUnterminatedQuote
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
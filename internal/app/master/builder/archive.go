@@ -0,0 +1,300 @@
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	archiveManifestName = "manifest.json"
+	layerFilePattern    = "docker-slim-layer-"
+	layerHistoryPat     = "COPY %s / # docker-slim"
+)
+
+type archiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+type imageRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type imageHistory struct {
+	Created    time.Time `json:"created"`
+	CreatedBy  string    `json:"created_by"`
+	EmptyLayer bool      `json:"empty_layer,omitempty"`
+}
+
+type imageContainerConfig struct {
+	Env          []string                 `json:"Env,omitempty"`
+	Entrypoint   []string                 `json:"Entrypoint,omitempty"`
+	Cmd          []string                 `json:"Cmd,omitempty"`
+	WorkingDir   string                   `json:"WorkingDir,omitempty"`
+	ExposedPorts map[docker.Port]struct{} `json:"ExposedPorts,omitempty"`
+}
+
+type imageConfig struct {
+	Architecture string               `json:"architecture"`
+	OS           string               `json:"os"`
+	Created      time.Time            `json:"created"`
+	Config       imageContainerConfig `json:"config"`
+	RootFS       imageRootFS          `json:"rootfs"`
+	History      []imageHistory       `json:"history"`
+}
+
+// importImage creates the image archive with the same image config and files
+// the generated Dockerfile has and imports it using the ImportClient
+// (the archive stream is closed when the stop channel is closed)
+func (b *ImageBuilder) importImage(stop <-chan struct{}) error {
+	if b.BaseImage != outputBaseImages[OutputBaseScratch] {
+		return fmt.Errorf("the output base image is not supported when the image is imported - %v", b.BaseImage)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(b.WriteArchive(writer))
+	}()
+	defer reader.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			reader.CloseWithError(ErrBuildTimeout)
+		case <-done:
+		}
+	}()
+
+	err := b.ImportClient.ImportImage(reader)
+	audit.Image(b.ImportClient.Name(), audit.ActionImport, b.BuildOptions.Name, err)
+	return err
+}
+
+// WriteArchive writes the image archive ('docker save' format)
+// (the files from each layer directory in the artifact location are in a compressed layer owned by root)
+func (b *ImageBuilder) WriteArchive(output io.Writer) error {
+	if b.LayerDirs == nil {
+		dirs, err := b.layerDirs()
+		if err != nil {
+			return err
+		}
+
+		b.LayerDirs = dirs
+	}
+
+	created := time.Now().UTC()
+	config := imageConfig{
+		Architecture: b.Architecture,
+		OS:           "linux",
+		Created:      created,
+		Config: imageContainerConfig{
+			Entrypoint:   b.Entrypoint,
+			Cmd:          b.Cmd,
+			WorkingDir:   b.WorkingDir,
+			ExposedPorts: b.ExposedPorts,
+		},
+		RootFS: imageRootFS{
+			Type:    "layers",
+			DiffIDs: []string{},
+		},
+	}
+
+	for _, envInfo := range b.Env {
+		if strings.Contains(envInfo, "=") {
+			config.Config.Env = append(config.Config.Env, envInfo)
+		}
+	}
+
+	archive := tar.NewWriter(output)
+	manifest := archiveManifest{
+		RepoTags: []string{b.RepoName},
+	}
+
+	for _, layerDir := range b.LayerDirs {
+		layerName, diffID, err := writeArchiveLayer(archive, filepath.Join(b.BuildOptions.ContextDir, layerDir))
+		if err != nil {
+			return err
+		}
+
+		manifest.Layers = append(manifest.Layers, layerName)
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+		config.History = append(config.History, imageHistory{
+			Created:   created,
+			CreatedBy: fmt.Sprintf(layerHistoryPat, layerDir),
+		})
+	}
+
+	configData, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	configDigest := sha256.Sum256(configData)
+	manifest.Config = hex.EncodeToString(configDigest[:]) + ".json"
+	if err := writeArchiveData(archive, manifest.Config, configData); err != nil {
+		return err
+	}
+
+	manifestData, err := json.Marshal([]archiveManifest{manifest})
+	if err != nil {
+		return err
+	}
+
+	if err := writeArchiveData(archive, archiveManifestName, manifestData); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// writeArchiveLayer adds the layer with the files from the directory to the image archive
+// and returns the layer name and its diff ID
+func writeArchiveLayer(archive *tar.Writer, filesDir string) (string, string, error) {
+	layerFile, err := ioutil.TempFile("", layerFilePattern)
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(layerFile.Name())
+	defer layerFile.Close()
+
+	diffID, err := writeLayer(filesDir, layerFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	layerName := fmt.Sprintf("%s/layer.tar", strings.TrimPrefix(diffID, "sha256:"))
+	if err := writeArchiveFile(archive, layerName, layerFile); err != nil {
+		return "", "", err
+	}
+
+	return layerName, diffID, nil
+}
+
+// writeLayer saves the compressed layer tar and returns the layer diff ID (the uncompressed tar digest)
+func writeLayer(filesDir string, output io.WriteSeeker) (string, error) {
+	diffHash := sha256.New()
+	zw := gzip.NewWriter(output)
+	tw := tar.NewWriter(io.MultiWriter(zw, diffHash))
+
+	err := filepath.Walk(filesDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(filesDir, fullPath)
+		if err != nil || name == "." {
+			return err
+		}
+
+		var linkTarget string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if linkTarget, err = os.Readlink(fullPath); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, linkTarget)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	if _, err := output.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	diffID := "sha256:" + hex.EncodeToString(diffHash.Sum(nil))
+	log.Debugf("builder.writeLayer: layer diff ID => %v", diffID)
+	return diffID, nil
+}
+
+func writeArchiveFile(archive *tar.Writer, name string, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	if err := archive.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(archive, file)
+	return err
+}
+
+func writeArchiveData(archive *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+
+	if err := archive.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := archive.Write(data)
+	return err
+}
@@ -3,16 +3,48 @@ package builder
 import (
 	//"os"
 	"bytes"
+	"errors"
 	"path/filepath"
+	"time"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerfile"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
 	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
 
-	//log "github.com/Sirupsen/logrus"
+	log "github.com/Sirupsen/logrus"
 	"github.com/cloudimmunity/go-dockerclientx"
 )
 
+// Output base names (the other output base values are image references)
+const (
+	OutputBaseScratch    = "scratch"
+	OutputBaseBusybox    = "busybox"
+	OutputBaseDistroless = "distroless"
+)
+
+// the images for the output base names
+var outputBaseImages = map[string]string{
+	OutputBaseScratch:    "scratch",
+	OutputBaseBusybox:    "busybox:stable",
+	OutputBaseDistroless: "gcr.io/distroless/static-debian12",
+}
+
+// OutputBaseImage returns the image reference for the output base
+// (the empty output base is the scratch base)
+func OutputBaseImage(outputBase string) string {
+	if outputBase == "" {
+		return outputBaseImages[OutputBaseScratch]
+	}
+
+	if imageRef, ok := outputBaseImages[outputBase]; ok {
+		return imageRef
+	}
+
+	return outputBase
+}
+
 // ImageBuilder creates new container images
 type ImageBuilder struct {
 	ShowBuildLogs bool
@@ -26,12 +58,29 @@ type ImageBuilder struct {
 	Volumes       map[string]struct{}
 	OnBuild       []string
 	User          string
+	Architecture  string
 	HasData       bool
 	BuildOptions  docker.BuildImageOptions
 	APIClient     *docker.Client
 	BuildLog      bytes.Buffer
+	//the image is imported instead of being built with Docker if ImportClient is set
+	ImportClient runtime.ImageClient
+	//the build fails if the image is not built in time (no limit if it's not set)
+	Timeout time.Duration
+	//the image the kept artifacts are added to ('scratch' for the minimal images)
+	BaseImage string
+	//the kept files are split into multiple layers if Layers is set (one layer otherwise)
+	Layers *LayerSet
+	//the directories with the files for each layer (relative to the artifact location)
+	LayerDirs []string
 }
 
+// ErrBuildTimeout is returned when the image is not built in time
+var ErrBuildTimeout = errors.New("timeout building the minified image")
+
+// how long the stopped build has to finish before its partial image is checked
+const buildStopTimeout = 30 * time.Second
+
 // NewImageBuilder creates a new ImageBuilder instances
 func NewImageBuilder(client *docker.Client,
 	imageRepoName string,
@@ -39,7 +88,8 @@ func NewImageBuilder(client *docker.Client,
 	artifactLocation string,
 	showBuildLogs bool,
 	imageOverrides map[string]bool,
-	overrides *config.ContainerOverrides) (*ImageBuilder, error) {
+	overrides *config.ContainerOverrides,
+	outputBase string) (*ImageBuilder, error) {
 	builder := &ImageBuilder{
 		ShowBuildLogs: showBuildLogs,
 		RepoName:      imageRepoName,
@@ -52,6 +102,8 @@ func NewImageBuilder(client *docker.Client,
 		Volumes:       imageInfo.Config.Volumes,
 		OnBuild:       imageInfo.Config.OnBuild,
 		User:          imageInfo.Config.User,
+		Architecture:  imageInfo.Architecture,
+		BaseImage:     OutputBaseImage(outputBase),
 		BuildOptions: docker.BuildImageOptions{
 			Name:           imageRepoName,
 			RmTmpContainer: true,
@@ -77,16 +129,105 @@ func (b *ImageBuilder) Build() error {
 		return err
 	}
 
-	return b.APIClient.BuildImage(b.BuildOptions)
+	if b.Timeout <= 0 {
+		return b.build(nil)
+	}
+
+	//the image ID is saved to find the partial image the stopped build might still tag
+	imageClient := b.imageClient()
+	var prevImageID string
+	if imageInfo, err := imageClient.InspectImage(b.BuildOptions.Name); err == nil {
+		prevImageID = imageInfo.ID
+	}
+
+	stop := make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- b.build(stop)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(b.Timeout):
+	}
+
+	close(stop)
+	select {
+	case <-errChan:
+		b.removePartialImage(imageClient, prevImageID)
+	case <-time.After(buildStopTimeout):
+		log.Warnf("builder.Build: the image build is not stopped (the partial image might be created - %v)", b.BuildOptions.Name)
+	}
+
+	return ErrBuildTimeout
+}
+
+// build builds or imports the image (the build is stopped when the stop channel is closed)
+func (b *ImageBuilder) build(stop <-chan struct{}) error {
+	if b.ImportClient != nil {
+		return b.importImage(stop)
+	}
+
+	client := b.APIClient
+	if stop != nil {
+		var release func()
+		client, release = stoppableClient(b.APIClient, stop)
+		defer release()
+	}
+
+	err := client.BuildImage(b.BuildOptions)
+	select {
+	case <-stop:
+		//the closed build connection can look like the end of the build output
+		if err == nil {
+			err = ErrBuildTimeout
+		}
+	default:
+	}
+
+	audit.Image(audit.RuntimeDocker, audit.ActionBuild, b.BuildOptions.Name, err)
+	return err
+}
+
+func (b *ImageBuilder) imageClient() runtime.ImageClient {
+	if b.ImportClient != nil {
+		return b.ImportClient
+	}
+
+	return runtime.NewDockerImageClient(b.APIClient)
+}
+
+// removePartialImage removes the image the stopped build created
+// (the image reference is kept if it still points to the image it had before the build)
+func (b *ImageBuilder) removePartialImage(imageClient runtime.ImageClient, prevImageID string) {
+	imageInfo, err := imageClient.InspectImage(b.BuildOptions.Name)
+	if err != nil || imageInfo.ID == prevImageID {
+		return
+	}
+
+	err = imageClient.RemoveImage(b.BuildOptions.Name)
+	audit.Image(imageClient.Name(), audit.ActionRemove, b.BuildOptions.Name, err)
+	if err != nil {
+		log.Warnf("builder.Build: error removing the partial image (%v) - %v", b.BuildOptions.Name, err)
+	}
 }
 
 // GenerateDockerfile creates a Dockerfile file
+// (the layer directories are prepared for the layer mode first)
 func (b *ImageBuilder) GenerateDockerfile() error {
+	dirs, err := b.layerDirs()
+	if err != nil {
+		return err
+	}
+
+	b.LayerDirs = dirs
 	return dockerfile.GenerateFromInfo(b.BuildOptions.ContextDir,
+		b.BaseImage,
 		b.WorkingDir,
 		b.Env,
 		b.ExposedPorts,
 		b.Entrypoint,
 		b.Cmd,
-		b.HasData)
+		b.LayerDirs)
 }
@@ -0,0 +1,321 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerimage"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Layer modes (how the kept files are split into the minified image layers)
+const (
+	// LayersFlatten puts all kept files in one layer
+	LayersFlatten = "flatten"
+	// LayersSplit puts the libraries, the config files and the rest of the files in their own layers
+	LayersSplit = "split"
+	// LayersOriginal puts the kept files from each original image layer in their own layer
+	LayersOriginal = "original"
+	// LayersDepsApp puts the runtime dependencies in the bottom layer and the application files in the top layer
+	LayersDepsApp = "deps-app"
+)
+
+const (
+	layersDirName    = "layers"
+	dockerIgnoreName = ".dockerignore"
+	otherLayerName   = "other"
+)
+
+// LayerModes are the supported layer modes
+var LayerModes = []string{LayersFlatten, LayersSplit, LayersOriginal, LayersDepsApp}
+
+// the language package manager directories (the files in them are the app dependencies)
+var dependencyDirNames = map[string]struct{}{
+	"node_modules":  {},
+	"site-packages": {},
+	"dist-packages": {},
+	"vendor":        {},
+	"gems":          {},
+	".m2":           {},
+	".gradle":       {},
+}
+
+// LayerGroup is a minified image layer with the files in its paths
+// (the group without the paths has the files the other groups don't have)
+type LayerGroup struct {
+	Name  string
+	Paths []string
+}
+
+// the split mode layers (the layers that change less often are at the bottom)
+var splitGroups = []LayerGroup{
+	{
+		Name:  "libraries",
+		Paths: []string{"/lib", "/lib32", "/lib64", "/libx32", "/usr/lib", "/usr/lib32", "/usr/lib64", "/usr/local/lib"},
+	},
+	{
+		Name:  "config",
+		Paths: []string{"/etc"},
+	},
+	{
+		Name: "app",
+	},
+}
+
+// LayerSet assigns the kept files to the minified image layers (the bottom layer is first)
+type LayerSet struct {
+	Mode   string
+	Groups []LayerGroup
+	//returns the layer index for the file (the modes without the path groups)
+	assign func(filePath string) int
+}
+
+// IsLayerMode returns true if the layer mode is supported
+func IsLayerMode(mode string) bool {
+	for _, name := range LayerModes {
+		if name == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewLayerSet creates the layer set for the layer mode (it returns nil for the flatten mode).
+// The original mode needs the image inventory (the kept files that are not in the inventory,
+// e.g., the files the target app created, are in the top layer). The deps-app mode uses the app path rules
+// and the OS packages of the kept files (file path => package name, see DepsAppLayer).
+func NewLayerSet(mode string,
+	inventory *dockerimage.Inventory,
+	appPaths []string,
+	packages map[string]string) (*LayerSet, error) {
+	switch mode {
+	case "", LayersFlatten:
+		return nil, nil
+	case LayersSplit:
+		return &LayerSet{
+			Mode:   mode,
+			Groups: splitGroups,
+		}, nil
+	case LayersOriginal:
+		if inventory == nil {
+			return nil, fmt.Errorf("no image inventory for the %s layer mode", mode)
+		}
+
+		set := &LayerSet{
+			Mode: mode,
+		}
+
+		for idx := range inventory.Layers {
+			set.Groups = append(set.Groups, LayerGroup{Name: fmt.Sprintf("layer-%d", idx)})
+		}
+
+		set.Groups = append(set.Groups, LayerGroup{Name: otherLayerName})
+		set.assign = func(filePath string) int {
+			if info, ok := inventory.Files[filePath]; ok {
+				return info.LayerIndex
+			}
+
+			return len(set.Groups) - 1
+		}
+
+		return set, nil
+	case LayersDepsApp:
+		return &LayerSet{
+			Mode:   mode,
+			Groups: []LayerGroup{{Name: "dependencies"}, {Name: "app"}},
+			assign: func(filePath string) int {
+				if DepsAppLayer(filePath, appPaths, packages) {
+					return 1
+				}
+
+				return 0
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown layer mode - %s", mode)
+}
+
+// Layer returns the layer index for the file (the file path is the path in the image)
+func (s *LayerSet) Layer(filePath string) int {
+	if s.assign != nil {
+		return s.assign(filePath)
+	}
+
+	catchAll := len(s.Groups) - 1
+	for idx, group := range s.Groups {
+		if len(group.Paths) == 0 {
+			catchAll = idx
+			continue
+		}
+
+		for _, groupPath := range group.Paths {
+			if filePath == groupPath || strings.HasPrefix(filePath, groupPath+"/") {
+				return idx
+			}
+		}
+	}
+
+	return catchAll
+}
+
+// DepsAppLayer returns true if the file is an application file (it goes to the top layer in the deps-app mode).
+// The files the OS packages installed and the files in the language package manager directories
+// (e.g., 'node_modules' or 'site-packages') are the dependencies. The other files are the application files
+// if they match the app path rules (all other files are the application files without the rules).
+// The app path rules are the paths (with their subdirectories) or the path patterns (e.g., '/app/*.py').
+func DepsAppLayer(filePath string, appPaths []string, packages map[string]string) bool {
+	if _, ok := packages[filePath]; ok {
+		return false
+	}
+
+	for _, name := range strings.Split(filePath, "/") {
+		if _, ok := dependencyDirNames[name]; ok {
+			return false
+		}
+	}
+
+	if len(appPaths) == 0 {
+		return true
+	}
+
+	for _, appPath := range appPaths {
+		appPath = strings.TrimSuffix(appPath, "/")
+		if filePath == appPath || strings.HasPrefix(filePath, appPath+"/") {
+			return true
+		}
+
+		if matched, err := path.Match(appPath, filePath); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stageLayers creates the layer directories in the artifact location and returns their names
+// (relative to the artifact location, the bottom layer is first). The files are hard linked from the files directory
+// and the directories are created with the same permissions, so the directories in the upper layers
+// don't change the directory permissions from the lower layers. The empty layers are skipped.
+func (b *ImageBuilder) stageLayers() ([]string, error) {
+	contextDir := b.BuildOptions.ContextDir
+	filesDir := filepath.Join(contextDir, "files")
+	layersDir := filepath.Join(contextDir, layersDirName)
+	if err := os.RemoveAll(layersDir); err != nil {
+		return nil, err
+	}
+
+	layerDir := func(idx int) string {
+		return filepath.Join(layersDirName, fmt.Sprintf("%02d-%s", idx, b.Layers.Groups[idx].Name))
+	}
+
+	used := map[int]bool{}
+	err := filepath.Walk(filesDir, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(filesDir, fullPath)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		if info.IsDir() {
+			//the directories are created with their files (only the empty directories are created here)
+			if entries, err := ioutil.ReadDir(fullPath); err != nil || len(entries) > 0 {
+				return err
+			}
+		}
+
+		idx := b.Layers.Layer("/" + filepath.ToSlash(relPath))
+		dstRoot := filepath.Join(contextDir, layerDir(idx))
+		used[idx] = true
+		if info.IsDir() {
+			return mirrorDirs(filesDir, dstRoot, relPath)
+		}
+
+		if err := mirrorDirs(filesDir, dstRoot, filepath.Dir(relPath)); err != nil {
+			return err
+		}
+
+		return fsutils.LinkOrCopyFile(fullPath, filepath.Join(dstRoot, relPath), false)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for idx := range b.Layers.Groups {
+		if used[idx] {
+			dirs = append(dirs, layerDir(idx))
+		}
+	}
+
+	log.Debugf("builder.stageLayers: layers => %+v", dirs)
+	return dirs, nil
+}
+
+// mirrorDirs creates the directory (with its parent directories) in the destination root
+// with the permissions the source directories have
+func mirrorDirs(srcRoot, dstRoot, relDir string) error {
+	if relDir == "." || relDir == "" {
+		return os.MkdirAll(dstRoot, 0755)
+	}
+
+	dstDir := filepath.Join(dstRoot, relDir)
+	if _, err := os.Lstat(dstDir); err == nil {
+		return nil
+	}
+
+	if err := mirrorDirs(srcRoot, dstRoot, filepath.Dir(relDir)); err != nil {
+		return err
+	}
+
+	srcInfo, err := os.Stat(filepath.Join(srcRoot, relDir))
+	if err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(dstDir, 0700); err != nil {
+		return err
+	}
+
+	//the mode is set after the directory is created (the new directory mode is masked by umask)
+	return os.Chmod(dstDir, srcInfo.Mode()&(os.ModePerm|os.ModeSticky|os.ModeSetgid|os.ModeSetuid))
+}
+
+// layerDirs prepares the build context for the layer mode and returns the directories
+// with the files for each minified image layer (relative to the artifact location)
+func (b *ImageBuilder) layerDirs() ([]string, error) {
+	contextDir := b.BuildOptions.ContextDir
+	ignorePath := filepath.Join(contextDir, dockerIgnoreName)
+	if !b.HasData {
+		return nil, nil
+	}
+
+	if b.Layers == nil {
+		//the layer directories from the previous builds are not needed
+		os.RemoveAll(filepath.Join(contextDir, layersDirName))
+		os.Remove(ignorePath)
+		return []string{"files"}, nil
+	}
+
+	dirs, err := b.stageLayers()
+	if err != nil {
+		return nil, err
+	}
+
+	//the files directory is not sent with the build context (the layer directories have the same files)
+	if err := ioutil.WriteFile(ignorePath, []byte("files\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	return dirs, nil
+}
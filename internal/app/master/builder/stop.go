@@ -0,0 +1,126 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+var errClientStopped = errors.New("the Docker API client is stopped")
+
+// stoppableClient returns a copy of the Docker API client that closes its connections when the stop channel is closed
+// (the Docker API client calls don't take contexts and Docker stops the builds when their connections are closed).
+// The returned function releases the client after its calls are done.
+func stoppableClient(client *docker.Client, stop <-chan struct{}) (*docker.Client, func()) {
+	var lock sync.Mutex
+	var fds []int
+	var stopped bool
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stoppable := *client
+	if client.HTTPClient != nil {
+		httpClient := *client.HTTPClient
+		httpClient.Transport = &stoppableTransport{
+			base: httpClient.Transport,
+			ctx:  ctx,
+		}
+
+		stoppable.HTTPClient = &httpClient
+	}
+
+	//the unix socket connections are created with the client dialer
+	//(the duplicated descriptors keep the sockets open, so they are not reused until the client is released)
+	var dialer net.Dialer
+	if client.Dialer != nil {
+		dialer = *client.Dialer
+	}
+
+	control := dialer.Control
+	dialer.Control = func(network, address string, conn syscall.RawConn) error {
+		if control != nil {
+			if err := control(network, address, conn); err != nil {
+				return err
+			}
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if stopped {
+			return errClientStopped
+		}
+
+		var dupErr error
+		err := conn.Control(func(fd uintptr) {
+			var dup int
+			if dup, dupErr = syscall.Dup(int(fd)); dupErr == nil {
+				fds = append(fds, dup)
+			}
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return dupErr
+	}
+
+	stoppable.Dialer = &dialer
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+			return
+		}
+
+		cancel()
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		stopped = true
+		for _, fd := range fds {
+			syscall.Shutdown(fd, syscall.SHUT_RDWR)
+		}
+	}()
+
+	release := func() {
+		close(done)
+		cancel()
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		stopped = true
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+
+		fds = nil
+	}
+
+	return &stoppable, release
+}
+
+// stoppableTransport adds the stop context to the requests
+type stoppableTransport struct {
+	base http.RoundTripper
+	ctx  context.Context
+}
+
+func (t *stoppableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
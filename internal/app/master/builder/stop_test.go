@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// buildHandler streams the build output until the client closes the connection
+type buildHandler struct {
+	closed chan struct{}
+}
+
+func (h *buildHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, `{"stream":"Step 1/2 : FROM scratch\n"}`)
+	w.(http.Flusher).Flush()
+
+	<-r.Context().Done()
+	close(h.closed)
+}
+
+func TestStoppableClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dslim-builder-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		network string
+		address string
+	}{
+		{
+			name:    "unix socket",
+			network: "unix",
+			address: filepath.Join(dir, "docker.sock"),
+		},
+		{
+			name:    "tcp",
+			network: "tcp",
+			address: "127.0.0.1:0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener, err := net.Listen(test.network, test.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler := &buildHandler{closed: make(chan struct{})}
+			server := &http.Server{Handler: handler}
+			go server.Serve(listener)
+			defer server.Close()
+
+			endpoint := "unix://" + test.address
+			if test.network == "tcp" {
+				endpoint = "tcp://" + listener.Addr().String()
+			}
+
+			client, err := docker.NewClient(endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client.SkipServerVersionCheck = true
+
+			stop := make(chan struct{})
+			stoppable, release := stoppableClient(client, stop)
+			defer release()
+
+			var output bytes.Buffer
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- stoppable.BuildImage(docker.BuildImageOptions{
+					Name:         "app.slim",
+					InputStream:  bytes.NewReader(nil),
+					OutputStream: &output,
+				})
+			}()
+
+			select {
+			case err := <-errChan:
+				t.Fatalf("the build is done before it's stopped (%v)", err)
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			close(stop)
+			select {
+			case <-errChan:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the build is not stopped")
+			}
+
+			select {
+			case <-handler.closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the build connection is not closed")
+			}
+
+			if _, err := stoppable.Dialer.Dial("unix", filepath.Join(dir, "missing.sock")); err != errClientStopped {
+				if opErr, ok := err.(*net.OpError); !ok || opErr.Err != errClientStopped {
+					t.Fatalf("expected the stopped client error, got %v", err)
+				}
+			}
+		})
+	}
+}
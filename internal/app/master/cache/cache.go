@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Cache entry names
+const (
+	EntryInventory  = "inventory"
+	EntryDockerfile = "dockerfile"
+	EntryLayers     = "layers"
+)
+
+const cacheDirName = "cache"
+
+// Cache is the image analysis cache in the image state directory.
+// The image state directories are keyed by the image ID (the image config content digest),
+// so the cached results are valid as long as the image state exists.
+// A nil cache is a disabled cache (nothing is loaded or saved).
+type Cache struct {
+	location string
+}
+
+// New creates the analysis cache for the image state directory
+func New(localVolumePath string) *Cache {
+	return &Cache{location: filepath.Join(localVolumePath, cacheDirName)}
+}
+
+// Load loads the cached entry (it returns false if the entry is not cached)
+func (c *Cache) Load(name string, data interface{}) bool {
+	if c == nil {
+		return false
+	}
+
+	raw, err := ioutil.ReadFile(c.entryPath(name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Debugf("cache.Load(%v): %v", name, err)
+		}
+
+		return false
+	}
+
+	if err := json.Unmarshal(raw, data); err != nil {
+		log.Debugf("cache.Load(%v): bad cache entry - %v", name, err)
+		return false
+	}
+
+	return true
+}
+
+// Save saves the cache entry (the cache errors are not fatal, the results are just not cached)
+func (c *Cache) Save(name string, data interface{}) {
+	if c == nil {
+		return
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Debugf("cache.Save(%v): %v", name, err)
+		return
+	}
+
+	if err := os.MkdirAll(c.location, 0777); err != nil {
+		log.Debugf("cache.Save(%v): %v", name, err)
+		return
+	}
+
+	//the entry is renamed, so the interrupted runs don't leave partial entries
+	tmpPath := c.entryPath(name) + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, raw, 0644); err != nil {
+		log.Debugf("cache.Save(%v): %v", name, err)
+		return
+	}
+
+	if err := os.Rename(tmpPath, c.entryPath(name)); err != nil {
+		log.Debugf("cache.Save(%v): %v", name, err)
+	}
+}
+
+func (c *Cache) entryPath(name string) string {
+	return filepath.Join(c.location, name+".json")
+}
@@ -2,17 +2,53 @@ package app
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/batch"
+	"github.com/docker-slim/docker-slim/internal/app/master/builder"
 	"github.com/docker-slim/docker-slim/internal/app/master/commands"
+	"github.com/docker-slim/docker-slim/internal/app/master/completion"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/containerd"
+	"github.com/docker-slim/docker-slim/internal/app/master/debug"
+	"github.com/docker-slim/docker-slim/internal/app/master/findings"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/ipc"
+	"github.com/docker-slim/docker-slim/internal/app/master/kubernetes"
+	"github.com/docker-slim/docker-slim/internal/app/master/lambda"
+	"github.com/docker-slim/docker-slim/internal/app/master/preset"
+	"github.com/docker-slim/docker-slim/internal/app/master/project"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/k8s"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/internal/app/master/server"
+	"github.com/docker-slim/docker-slim/internal/app/master/state"
+	"github.com/docker-slim/docker-slim/internal/app/master/update"
+	"github.com/docker-slim/docker-slim/internal/app/master/upload"
+	"github.com/docker-slim/docker-slim/pkg/distro"
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
+	"github.com/docker-slim/docker-slim/pkg/ipc/command"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/logutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/netutils"
 	"github.com/docker-slim/docker-slim/pkg/version"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/cloudimmunity/system"
 	"github.com/codegangsta/cli"
+	"github.com/dustin/go-humanize"
 )
 
 // DockerSlim app CLI constants
@@ -23,29 +59,90 @@ const (
 
 // DockerSlim app command names
 const (
-	CmdVersion = "version"
-	CmdInfo    = "info"
-	CmdBuild   = "build"
-	CmdProfile = "profile"
+	CmdVersion    = "version"
+	CmdInfo       = "info"
+	CmdBuild      = "build"
+	CmdProfile    = "profile"
+	CmdSchema     = "schema"
+	CmdReport     = "report"
+	CmdServe      = "serve"
+	CmdBatch      = "batch"
+	CmdWatch      = "watch"
+	CmdAgent      = "agent"
+	CmdUpdate     = "update"
+	CmdDebug      = "debug"
+	CmdRun        = "run"
+	CmdMerge      = "merge"
+	CmdState      = "state"
+	CmdRegistry   = "registry"
+	CmdDoctor     = "doctor"
+	CmdCompletion = "completion"
+	CmdStats      = "stats"
+)
+
+// DockerSlim 'report' subcommand names
+const (
+	CmdReportDiff  = "diff"
+	CmdReportMerge = "merge"
+)
+
+// DockerSlim 'state' subcommand names
+const (
+	CmdStateList   = "ls"
+	CmdStateRemove = "rm"
+	CmdStatePrune  = "prune"
+)
+
+// DockerSlim 'registry' subcommand names
+const (
+	CmdRegistryTags     = "tags"
+	CmdRegistryInspect  = "inspect"
+	CmdRegistryManifest = "manifest"
+	CmdRegistryConfig   = "config"
 )
 
 // DockerSlim app flag names
 const (
 	FlagDebug              = "debug"
 	FlagCommandReport      = "report"
+	FlagReportFormat       = "report-format"
+	FlagReportUpload       = "report-upload"
+	FlagConsoleFormat      = "console-format"
 	FlagVerbose            = "verbose"
+	FlagVerbosity          = "verbosity"
+	FlagQuiet              = "quiet"
 	FlagLogLevel           = "log-level"
 	FlagLog                = "log"
+	FlagLogFile            = "log-file"
 	FlagLogFormat          = "log-format"
 	FlagUseTLS             = "tls"
 	FlagVerifyTLS          = "tls-verify"
 	FlagTLSCertPath        = "tls-cert-path"
+	FlagTLSCACert          = "tls-ca-cert"
+	FlagTLSCert            = "tls-cert"
+	FlagTLSKey             = "tls-key"
+	FlagTLSInsecureReg     = "tls-insecure-registry"
+	FlagHTTPProxy          = "http-proxy"
+	FlagHTTPSProxy         = "https-proxy"
+	FlagNoProxy            = "no-proxy"
 	FlagHost               = "host"
+	FlagContext            = "context"
+	FlagPodman             = "podman"
 	FlagStatePath          = "state-path"
+	FlagStateKeyFile       = "state-key-file"
+	FlagAuditLog           = "audit-log"
+	FlagMetricsPushGateway = "metrics-push-gateway"
+	FlagMetricsAddr        = "metrics-addr"
+	FlagMetricsLinger      = "metrics-linger"
+	FlagOtelEndpoint       = "otel-endpoint"
+	FlagOtelHeaders        = "otel-headers"
+	FlagTelemetry          = "telemetry"
+	FlagTelemetryEndpoint  = "telemetry-endpoint"
 	FlagHttpProbeSpec      = "http-probe, p"
 	FlagHttpProbe          = "http-probe"
 	FlagHttpProbeCmd       = "http-probe-cmd"
 	FlagHttpProbeCmdFile   = "http-probe-cmd-file"
+	FlagHttpProbeHost      = "http-probe-host"
 	FlagShowContainerLogs  = "show-clogs"
 	FlagShowBuildLogs      = "show-blogs"
 	FlagEntrypoint         = "entrypoint"
@@ -64,11 +161,117 @@ const (
 	FlagEtcHostsMap        = "etc-hosts-map"
 	FlagContainerDns       = "container-dns"
 	FlagContainerDnsSearch = "container-dns-search"
+	FlagContainerName      = "container-name"
+	FlagContainerLabel     = "container-label"
+	FlagTargetRestarts     = "target-restarts"
+	FlagSeccompBaseline    = "seccomp-baseline"
+	FlagSeccompMergeMode   = "seccomp-merge-mode"
+	FlagSeccompAnnotate    = "seccomp-annotate"
+	FlagVerifyProfiles     = "verify-profiles"
+	FlagRemovedFilesGzip   = "removed-files-gzip"
+	FlagUseArtifacts       = "use-artifacts"
+	FlagFromReport         = "from-report"
+	FlagReview             = "review"
+	FlagTargetKubernetes   = "target-kubernetes"
+	FlagKubernetesNS       = "kubernetes-namespace"
+	FlagKubernetesContext  = "kubernetes-context"
+	FlagKubeconfig         = "kubeconfig"
+	FlagKubernetesHelper   = "kubernetes-helper-image"
+	FlagRuntime            = "runtime"
+	FlagContainerdAddress  = "containerd-address"
+	FlagContainerdNS       = "containerd-namespace"
+	FlagContainerdCNI      = "containerd-cni"
+	FlagK8sPatch           = "k8s-patch"
+	FlagK8sWorkload        = "k8s-workload"
+	FlagK8sContainer       = "k8s-container"
+	FlagK8sBase            = "k8s-base"
+	FlagJSON               = "json"
+	FlagOutput             = "output"
+	FlagListen             = "listen"
+	FlagMaxJobs            = "max-jobs"
+	FlagMaxParallel        = "max-parallel"
+	FlagAnalysisCache      = "analysis-cache"
+	FlagCacheArtifacts     = "cache-artifacts"
+	FlagIncremental        = "incremental"
+	FlagAPIToken           = "api-token"
+	FlagBuildFlags         = "build-flags"
+	FlagInterval           = "interval"
+	FlagPull               = "pull"
+	FlagOnce               = "once"
+	FlagChannel            = "channel"
+	FlagCheck              = "check"
+	FlagForce              = "force"
+	FlagCheckUpdate        = "check-update"
+	FlagCheckUpdateTimeout = "check-update-timeout"
+	FlagDebugImage         = "debug-image"
+	FlagArtifacts          = "artifacts"
+	FlagDetach             = "detach"
+	FlagRemove             = "rm"
+	FlagAll                = "all"
+	FlagOlderThan          = "older-than"
+	FlagMaxSize            = "max-size"
+	FlagDryRun             = "dry-run"
+	FlagRegistryUser       = "registry-user"
+	FlagRegistryPassword   = "registry-password"
+	FlagInsecureRegistry   = "insecure-registry"
+	FlagPlatform           = "platform"
+	FlagSelector           = "selector"
+	FlagNode               = "node"
+	FlagDuration           = "duration"
+	FlagRuntimeEndpoint    = "runtime-endpoint"
+	FlagServer             = "server"
+	FlagLambda             = "lambda"
+	FlagLambdaEvent        = "lambda-event"
+	FlagLambdaRIE          = "lambda-rie"
+	FlagSwarmService       = "target-swarm-service"
+	FlagSwarmDuration      = "swarm-duration"
+	FlagProjectConfig      = "config"
+	FlagPreset             = "preset"
+	FlagTimeoutStart       = "timeout-container-start"
+	FlagTimeoutReady       = "timeout-app-ready"
+	FlagTimeoutMonitor     = "timeout-monitor"
+	FlagTimeoutSensorDone  = "timeout-sensor-done"
+	FlagTimeoutCopy        = "timeout-artifact-copy"
+	FlagTimeoutBuild       = "timeout-image-build"
+	FlagArtifactsTransfer  = "artifacts-transfer"
+	FlagCompressArtifacts  = "compress-artifacts"
+	FlagSensorSampleRate   = "sensor-ptrace-sample-rate"
+	FlagSensorQueueSize    = "sensor-event-queue-size"
+	FlagSensorNice         = "sensor-nice"
+	FlagIPCTransport       = "ipc-transport"
+	FlagSensorDelivery     = "sensor-delivery"
+	FlagAutoExpose         = "auto-expose"
+	FlagExecRedact         = "exec-redact"
+	FlagDep                = "dep"
+	FlagExecFile           = "exec-file"
+	FlagHostExecBefore     = "host-exec-before-monitor"
+	FlagHostExecAfter      = "host-exec-after-monitor"
+	FlagMinReduction       = "min-reduction"
+	FlagFailOn             = "fail-on"
+	FlagVerifyImage        = "verify-image"
+	FlagIncludeDistro      = "include-distro"
+	FlagIncludeTzdata      = "include-tzdata"
+	FlagIncludeLocales     = "include-locales"
+	FlagOutputBase         = "output-base"
+	FlagLayers             = "layers"
+	FlagAppPath            = "app-path"
+	FlagInstrument         = "instrument"
+	FlagArtifactStore      = "artifact-store"
+	FlagSidecar            = "sidecar"
+	FlagSensorPort         = "sensor-port"
 )
 
+const defaultBatchReport = "slim.batch.report.json"
+
 var app *cli.App
 
 func init() {
+	//-v is one of the verbosity level shortcuts
+	cli.VersionFlag = cli.BoolFlag{
+		Name:  "version",
+		Usage: "print the version",
+	}
+
 	app = cli.NewApp()
 	app.Version = version.Current()
 	app.Name = AppName
@@ -80,102 +283,291 @@ func init() {
 
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
-			Name:  FlagCommandReport,
-			Usage: "command report location",
+			Name:   FlagCommandReport,
+			Usage:  "command report location",
+			EnvVar: "DSLIM_REPORT",
+		},
+		cli.StringFlag{
+			Name:   FlagReportFormat,
+			Value:  report.FormatJSON,
+			Usage:  "set the command report format ('json' (default), 'html' or 'yaml')",
+			EnvVar: "DSLIM_REPORT_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   FlagReportUpload,
+			Usage:  "upload the reports and the generated profiles (s3://bucket/prefix or http(s)://host/path)",
+			EnvVar: "DSLIM_REPORT_UPLOAD",
+		},
+		cli.StringFlag{
+			Name:   FlagConsoleFormat,
+			Value:  console.FormatText,
+			Usage:  "set the console output format ('text' (default) or 'json' (line-delimited JSON events))",
+			EnvVar: "DSLIM_CONSOLE_FORMAT",
+		},
+		cli.BoolFlag{
+			Name:   FlagDebug,
+			Usage:  "enable debug logs",
+			EnvVar: "DSLIM_DEBUG",
 		},
 		cli.BoolFlag{
-			Name:  FlagDebug,
-			Usage: "enable debug logs",
+			Name:   FlagVerbose,
+			Usage:  "enable info logs",
+			EnvVar: "DSLIM_VERBOSE",
+		},
+		cli.IntFlag{
+			Name:   FlagVerbosity,
+			Usage:  "set the verbosity level (1: info logs, 2: debug logs, 3: debug mode) (shortcuts: -v, -vv, -vvv)",
+			EnvVar: "DSLIM_VERBOSITY",
 		},
 		cli.BoolFlag{
-			Name:  FlagVerbose,
-			Usage: "enable info logs",
+			Name:   FlagQuiet,
+			Usage:  "print only the errors and the final results (e.g., the minified image name)",
+			EnvVar: "DSLIM_QUIET",
 		},
 		cli.StringFlag{
-			Name:  FlagLogLevel,
-			Value: "warn",
-			Usage: "set the logging level ('debug', 'info', 'warn' (default), 'error', 'fatal', 'panic')",
+			Name:   FlagLogLevel,
+			Value:  "warn",
+			Usage:  "set the logging level ('debug', 'info', 'warn' (default), 'error', 'fatal', 'panic')",
+			EnvVar: "DSLIM_LOG_LEVEL",
 		},
 		cli.StringFlag{
-			Name:  FlagLog,
-			Usage: "log file to store logs",
+			Name:   fmt.Sprintf("%s, %s", FlagLogFile, FlagLog),
+			Usage:  "log file to store logs (the sensor logs are saved in the artifacts directory)",
+			EnvVar: "DSLIM_LOG_FILE",
 		},
 		cli.StringFlag{
-			Name:  FlagLogFormat,
-			Value: "text",
-			Usage: "set the format used by logs ('text' (default), or 'json')",
+			Name:   FlagLogFormat,
+			Value:  logutils.FormatText,
+			Usage:  "set the format used by logs ('text' (default), or 'json') (used by the sensor too)",
+			EnvVar: "DSLIM_LOG_FORMAT",
 		},
 		cli.BoolTFlag{
-			Name:  FlagUseTLS,
-			Usage: "use TLS",
+			Name:   FlagUseTLS,
+			Usage:  "use TLS",
+			EnvVar: "DSLIM_TLS",
 		},
 		cli.BoolTFlag{
-			Name:  FlagVerifyTLS,
-			Usage: "verify TLS",
+			Name:   FlagVerifyTLS,
+			Usage:  "verify TLS",
+			EnvVar: "DSLIM_TLS_VERIFY",
+		},
+		cli.StringFlag{
+			Name:   FlagTLSCertPath,
+			Value:  "",
+			Usage:  "path to TLS cert files",
+			EnvVar: "DSLIM_TLS_CERT_PATH",
+		},
+		cli.StringFlag{
+			Name:   FlagTLSCACert,
+			Value:  "",
+			Usage:  "CA bundle (PEM) to verify the Docker host and the registries (replaces ca.pem in the TLS cert path)",
+			EnvVar: "DSLIM_TLS_CA_CERT",
+		},
+		cli.StringFlag{
+			Name:   FlagTLSCert,
+			Value:  "",
+			Usage:  "TLS client certificate (PEM) for the Docker host and the registries (replaces cert.pem in the TLS cert path)",
+			EnvVar: "DSLIM_TLS_CERT",
+		},
+		cli.StringFlag{
+			Name:   FlagTLSKey,
+			Value:  "",
+			Usage:  "TLS client key (PEM) for the TLS client certificate (replaces key.pem in the TLS cert path)",
+			EnvVar: "DSLIM_TLS_KEY",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagTLSInsecureReg,
+			Value:  &cli.StringSlice{},
+			Usage:  "registry host (with the port if it's not the default port) accessed without the TLS certificate verification",
+			EnvVar: "DSLIM_TLS_INSECURE_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   FlagHTTPProxy,
+			Value:  "",
+			Usage:  "proxy URL for the HTTP requests (the registries, update checks, report uploads and HTTP probes; HTTP_PROXY by default)",
+			EnvVar: "DSLIM_HTTP_PROXY",
 		},
 		cli.StringFlag{
-			Name:  FlagTLSCertPath,
-			Value: "",
-			Usage: "path to TLS cert files",
+			Name:   FlagHTTPSProxy,
+			Value:  "",
+			Usage:  "proxy URL for the HTTPS requests (HTTPS_PROXY by default)",
+			EnvVar: "DSLIM_HTTPS_PROXY",
 		},
 		cli.StringFlag{
-			Name:  FlagHost,
-			Value: "",
-			Usage: "Docker host address",
+			Name:   FlagNoProxy,
+			Value:  "",
+			Usage:  "comma separated hosts, domains and networks accessed without the proxy (NO_PROXY by default)",
+			EnvVar: "DSLIM_NO_PROXY",
 		},
 		cli.StringFlag{
-			Name:  FlagStatePath,
-			Value: "",
-			Usage: "DockerSlim state base path",
+			Name:   FlagHost,
+			Value:  "",
+			Usage:  "Docker host address",
+			EnvVar: "DSLIM_HOST",
+		},
+		cli.StringFlag{
+			Name:   FlagContext,
+			Value:  "",
+			Usage:  "Docker CLI context (used if the Docker host is not set, DOCKER_CONTEXT or the current Docker CLI context by default)",
+			EnvVar: "DSLIM_CONTEXT",
+		},
+		cli.BoolFlag{
+			Name:   FlagPodman,
+			Usage:  "use the Podman API socket (the rootful or the rootless socket for the current user if the Docker host is not set)",
+			EnvVar: "DSLIM_PODMAN",
+		},
+		cli.StringFlag{
+			Name:   FlagStatePath,
+			Value:  "",
+			Usage:  "DockerSlim state base path (the user data directory by default: $XDG_DATA_HOME/docker-slim or ~/.local/share/docker-slim on Linux and ~/Library/Application Support/docker-slim on macOS)",
+			EnvVar: "DSLIM_STATE_PATH",
+		},
+		cli.StringFlag{
+			Name:   FlagStateKeyFile,
+			Value:  "",
+			Usage:  "file with the passphrase to encrypt the saved artifacts (the passphrase can also be set with DSLIM_STATE_KEY)",
+			EnvVar: "DSLIM_STATE_KEY_FILE",
+		},
+		cli.StringFlag{
+			Name:   FlagAuditLog,
+			Value:  "",
+			Usage:  "append the audit records (the command, the images, containers and registries it touched) to the file (JSON lines)",
+			EnvVar: "DSLIM_AUDIT_LOG",
+		},
+		cli.StringFlag{
+			Name:   FlagMetricsPushGateway,
+			Value:  "",
+			Usage:  "push the run metrics to a Prometheus Pushgateway (URL)",
+			EnvVar: "DSLIM_METRICS_PUSH_GATEWAY",
+		},
+		cli.StringFlag{
+			Name:   FlagMetricsAddr,
+			Value:  "",
+			Usage:  "serve the run metrics on the /metrics endpoint (address, e.g., ':9191')",
+			EnvVar: "DSLIM_METRICS_ADDR",
+		},
+		cli.IntFlag{
+			Name:   FlagMetricsLinger,
+			Value:  30,
+			Usage:  "number of seconds to keep the /metrics endpoint up when the command is done",
+			EnvVar: "DSLIM_METRICS_LINGER",
+		},
+		cli.StringFlag{
+			Name:   FlagOtelEndpoint,
+			Value:  "",
+			Usage:  "export the run phase traces to an OpenTelemetry collector (OTLP/HTTP endpoint URL)",
+			EnvVar: "DSLIM_OTEL_ENDPOINT,OTEL_EXPORTER_OTLP_ENDPOINT",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagOtelHeaders,
+			Value:  &cli.StringSlice{},
+			Usage:  "HTTP header (name=value) to send to the OpenTelemetry collector",
+			EnvVar: "DSLIM_OTEL_HEADERS,OTEL_EXPORTER_OTLP_HEADERS",
+		},
+		cli.BoolFlag{
+			Name:   FlagTelemetry,
+			Usage:  "enable the anonymous usage telemetry (opt-in: the command, duration, result and size reduction of the build and profile runs)",
+			EnvVar: "DSLIM_TELEMETRY",
+		},
+		cli.StringFlag{
+			Name:   FlagTelemetryEndpoint,
+			Value:  "",
+			Usage:  "send the anonymous usage telemetry records to the endpoint (URL, the records are only saved in the state path if it's not set)",
+			EnvVar: "DSLIM_TELEMETRY_ENDPOINT",
 		},
 	}
 
 	app.Before = func(ctx *cli.Context) error {
-		if ctx.GlobalBool(FlagDebug) {
+		//the proxies are set before anything else can send a request
+		if err := netutils.SetProxy(ctx.GlobalString(FlagHTTPProxy),
+			ctx.GlobalString(FlagHTTPSProxy),
+			ctx.GlobalString(FlagNoProxy)); err != nil {
+			log.Fatal(err)
+		}
+
+		verbosity := ctx.GlobalInt(FlagVerbosity)
+		doQuiet := ctx.GlobalBool(FlagQuiet)
+		if doQuiet && (verbosity > 0 || ctx.GlobalBool(FlagVerbose) || ctx.GlobalBool(FlagDebug)) {
+			log.Fatal("the quiet mode can't be used with the verbose or debug modes")
+		}
+
+		console.SetQuiet(doQuiet)
+
+		switch {
+		case doQuiet:
+			log.SetLevel(log.ErrorLevel)
+		case ctx.GlobalBool(FlagDebug) || verbosity >= 2:
 			log.SetLevel(log.DebugLevel)
-		} else {
-			if ctx.GlobalBool(FlagVerbose) {
-				log.SetLevel(log.InfoLevel)
-			} else {
-				logLevel := log.WarnLevel
-				logLevelName := ctx.GlobalString(FlagLogLevel)
-				switch logLevelName {
-				case "debug":
-					logLevel = log.DebugLevel
-				case "info":
-					logLevel = log.InfoLevel
-				case "warn":
-					logLevel = log.WarnLevel
-				case "error":
-					logLevel = log.ErrorLevel
-				case "fatal":
-					logLevel = log.FatalLevel
-				case "panic":
-					logLevel = log.PanicLevel
-				default:
-					log.Fatalf("unknown log-level %q", logLevelName)
-				}
-
-				log.SetLevel(logLevel)
+		case ctx.GlobalBool(FlagVerbose) || verbosity == 1:
+			log.SetLevel(log.InfoLevel)
+		default:
+			logLevel := log.WarnLevel
+			logLevelName := ctx.GlobalString(FlagLogLevel)
+			switch logLevelName {
+			case "debug":
+				logLevel = log.DebugLevel
+			case "info":
+				logLevel = log.InfoLevel
+			case "warn":
+				logLevel = log.WarnLevel
+			case "error":
+				logLevel = log.ErrorLevel
+			case "fatal":
+				logLevel = log.FatalLevel
+			case "panic":
+				logLevel = log.PanicLevel
+			default:
+				log.Fatalf("unknown log-level %q", logLevelName)
 			}
+
+			log.SetLevel(logLevel)
 		}
 
-		if path := ctx.GlobalString(FlagLog); path != "" {
-			f, err := os.Create(path)
-			if err != nil {
+		logFormat := ctx.GlobalString(FlagLogFormat)
+		if err := logutils.SetFormat(logFormat); err != nil {
+			log.Fatalf("unknown log-format %q", logFormat)
+		}
+
+		if path := ctx.GlobalString(FlagLogFile); path != "" {
+			if err := logutils.SetOutputFile(path, false); err != nil {
 				return err
 			}
-			log.SetOutput(f)
 		}
 
-		logFormat := ctx.GlobalString(FlagLogFormat)
-		switch logFormat {
-		case "text":
-			log.SetFormatter(&log.TextFormatter{DisableColors: true})
-		case "json":
-			log.SetFormatter(new(log.JSONFormatter))
+		reportFormat := ctx.GlobalString(FlagReportFormat)
+		switch reportFormat {
+		case report.FormatJSON, report.FormatHTML, report.FormatYAML:
 		default:
-			log.Fatalf("unknown log-format %q", logFormat)
+			log.Fatalf("unknown report-format %q", reportFormat)
+		}
+
+		consoleFormat := ctx.GlobalString(FlagConsoleFormat)
+		if !console.IsValidFormat(consoleFormat) {
+			log.Fatalf("unknown console-format %q", consoleFormat)
+		}
+
+		stateKey := os.Getenv("DSLIM_STATE_KEY")
+		if keyFile := ctx.GlobalString(FlagStateKeyFile); keyFile != "" {
+			data, err := ioutil.ReadFile(keyFile)
+			if err != nil {
+				log.Fatalf("can't read the state key file %q - %v", keyFile, err)
+			}
+
+			stateKey = string(data)
+		}
+
+		fsutils.SetStateKey(strings.TrimSpace(stateKey))
+
+		if auditLog := ctx.GlobalString(FlagAuditLog); auditLog != "" {
+			if err := audit.Open(auditLog, os.Args); err != nil {
+				log.Fatalf("can't open the audit log %q - %v", auditLog, err)
+			}
+		}
+
+		if reportUpload := ctx.GlobalString(FlagReportUpload); reportUpload != "" {
+			if _, err := upload.New(reportUpload); err != nil {
+				log.Fatalf("invalid report-upload target %q - %v", reportUpload, err)
+			}
 		}
 
 		log.Debugf("sysinfo => %#v", system.GetSystemInfo())
@@ -203,6 +595,34 @@ func init() {
 		EnvVar: "DSLIM_HTTP_PROBE_CMD_FILE",
 	}
 
+	doHTTPProbeHostFlag := cli.StringFlag{
+		Name:   FlagHttpProbeHost,
+		Value:  "",
+		Usage:  "Host header and TLS server name (SNI) for the HTTP probes without their own host (for the name-based virtual hosts)",
+		EnvVar: "DSLIM_HTTP_PROBE_HOST",
+	}
+
+	doExecFileFlag := cli.StringFlag{
+		Name:   FlagExecFile,
+		Value:  "",
+		Usage:  "Test script to run against the published ports of the target container (a non-zero exit code fails the run)",
+		EnvVar: "DSLIM_EXEC_FILE",
+	}
+
+	doHostExecBeforeMonitorFlag := cli.StringFlag{
+		Name:   FlagHostExecBefore,
+		Value:  "",
+		Usage:  "Host command to run after the target container starts and before the probes run (a non-zero exit code fails the run)",
+		EnvVar: "DSLIM_HOST_EXEC_BEFORE_MONITOR",
+	}
+
+	doHostExecAfterMonitorFlag := cli.StringFlag{
+		Name:   FlagHostExecAfter,
+		Value:  "",
+		Usage:  "Host command to run after the monitoring ends and before the target container is stopped (a non-zero exit code fails the run)",
+		EnvVar: "DSLIM_HOST_EXEC_AFTER_MONITOR",
+	}
+
 	doShowContainerLogsFlag := cli.BoolFlag{
 		Name:   FlagShowContainerLogs,
 		Usage:  "Show container logs",
@@ -250,6 +670,13 @@ func init() {
 		EnvVar: "DSLIM_TARGET_LINK",
 	}
 
+	doDepFlag := cli.StringSliceFlag{
+		Name:   FlagDep,
+		Value:  &cli.StringSlice{},
+		Usage:  "Start a dependency container before the target container: image=postgres:13,alias=db,env=KEY=VALUE,ready=tcp:5432|exec:<command> (removed after monitoring)",
+		EnvVar: "DSLIM_DEP",
+	}
+
 	doUseEtcHostsMapFlag := cli.StringSliceFlag{
 		Name:   FlagEtcHostsMap,
 		Value:  &cli.StringSlice{},
@@ -278,6 +705,20 @@ func init() {
 		EnvVar: "DSLIM_TARGET_HOSTNAME",
 	}
 
+	doUseContainerNameFlag := cli.StringFlag{
+		Name:   FlagContainerName,
+		Value:  "",
+		Usage:  "Use a custom name for the temporary container analyzing image",
+		EnvVar: "DSLIM_CONTAINER_NAME",
+	}
+
+	doUseContainerLabelFlag := cli.StringSliceFlag{
+		Name:   FlagContainerLabel,
+		Value:  &cli.StringSlice{},
+		Usage:  "Add a label (key=value) to the temporary container analyzing image",
+		EnvVar: "DSLIM_CONTAINER_LABEL",
+	}
+
 	doUseNetworkFlag := cli.StringFlag{
 		Name:   FlagNetwork,
 		Value:  "",
@@ -292,6 +733,60 @@ func init() {
 		EnvVar: "DSLIM_TARGET_EXPOSE",
 	}
 
+	doAutoExposeFlag := cli.BoolTFlag{
+		Name:   FlagAutoExpose,
+		Usage:  "Use the ports the target app listened on for the minified image EXPOSE instructions (use --auto-expose=false to keep the original image EXPOSE instructions)",
+		EnvVar: "DSLIM_AUTO_EXPOSE",
+	}
+
+	doMaxSizeFlag := cli.StringFlag{
+		Name:   FlagMaxSize,
+		Value:  "",
+		Usage:  "Fail the build if the minified image is bigger than the maximum size (e.g., 50MB)",
+		EnvVar: "DSLIM_MAX_SIZE",
+	}
+
+	doMinReductionFlag := cli.StringFlag{
+		Name:   FlagMinReduction,
+		Value:  "",
+		Usage:  "Fail the build if the minified image size reduction is below the minimum (e.g., 60%)",
+		EnvVar: "DSLIM_MIN_REDUCTION",
+	}
+
+	doOutputBaseFlag := cli.StringFlag{
+		Name:   FlagOutputBase,
+		Value:  builder.OutputBaseScratch,
+		Usage:  "Select the base image for the minified image: scratch | busybox | distroless or an image reference",
+		EnvVar: "DSLIM_OUTPUT_BASE",
+	}
+
+	doLayersFlag := cli.StringFlag{
+		Name:   FlagLayers,
+		Value:  builder.LayersFlatten,
+		Usage:  "Select how the kept files are split into the minified image layers: flatten | split | original | deps-app",
+		EnvVar: "DSLIM_LAYERS",
+	}
+
+	doAppPathFlag := cli.StringSliceFlag{
+		Name:   FlagAppPath,
+		Value:  &cli.StringSlice{},
+		Usage:  "Application path or path pattern for the top layer with --layers deps-app (e.g., /app)",
+		EnvVar: "DSLIM_APP_PATH",
+	}
+
+	doInstrumentFlag := cli.BoolFlag{
+		Name:   FlagInstrument,
+		Usage:  "Build the instrumented image (the target image with the sensor that saves the artifacts for --from-report) instead of the minified image",
+		EnvVar: "DSLIM_INSTRUMENT",
+	}
+
+	doFailOnFlag := cli.StringSliceFlag{
+		Name:   FlagFailOn,
+		Value:  &cli.StringSlice{},
+		Usage:  "Fail if there are findings for the selected analyzers or rules (e.g., secrets,root-user,latest-base)",
+		EnvVar: "DSLIM_FAIL_ON",
+	}
+
 	doExcludeMountsFlag := cli.BoolTFlag{
 		Name:   FlagExludeMounts,
 		Usage:  "Exclude mounted volumes from image",
@@ -312,6 +807,25 @@ func init() {
 		EnvVar: "DSLIM_INCLUDE_PATH",
 	}
 
+	doIncludeDistroFlag := cli.BoolTFlag{
+		Name:   FlagIncludeDistro,
+		Usage:  "Keep the name resolution and the user lookup files from the include ruleset for the detected base distro (use --include-distro=false to disable)",
+		EnvVar: "DSLIM_INCLUDE_DISTRO",
+	}
+
+	doIncludeTzdataFlag := cli.BoolFlag{
+		Name:   FlagIncludeTzdata,
+		Usage:  "Keep the time zone database (/usr/share/zoneinfo) and the local time zone config",
+		EnvVar: "DSLIM_INCLUDE_TZDATA",
+	}
+
+	doIncludeLocalesFlag := cli.StringSliceFlag{
+		Name:   FlagIncludeLocales,
+		Value:  &cli.StringSlice{},
+		Usage:  "Keep the locale data for the locales (e.g., en_US,de_DE)",
+		EnvVar: "DSLIM_INCLUDE_LOCALES",
+	}
+
 	doUseMountFlag := cli.StringSliceFlag{
 		Name:   FlagMount,
 		Value:  &cli.StringSlice{},
@@ -322,25 +836,290 @@ func init() {
 	doConfinueAfterFlag := cli.StringFlag{
 		Name:   FlagContinueAfter,
 		Value:  "enter",
-		Usage:  "Select continue mode: enter | signal | probe | timeout or numberInSeconds",
+		Usage:  "Select continue mode: enter | signal | probe | exec | timeout or numberInSeconds",
 		EnvVar: "DSLIM_CONTINUE_AFTER",
 	}
 
+	doPresetFlag := cli.StringFlag{
+		Name:   FlagPreset,
+		Value:  "",
+		Usage:  fmt.Sprintf("Use the include paths, the HTTP probe and the continue-after defaults for a common stack (%s)", strings.Join(preset.Names(), ", ")),
+		EnvVar: "DSLIM_PRESET",
+	}
+
+	doTimeoutStartFlag := cli.DurationFlag{
+		Name:   FlagTimeoutStart,
+		Usage:  "Timeout for the target container and the sensor to start (the sensor start command is retried until it expires)",
+		EnvVar: "DSLIM_TIMEOUT_CONTAINER_START",
+	}
+
+	doTimeoutReadyFlag := cli.DurationFlag{
+		Name:   FlagTimeoutReady,
+		Usage:  "Timeout for the target app to accept connections before the HTTP probe starts (the probe waits a few seconds by default)",
+		EnvVar: "DSLIM_TIMEOUT_APP_READY",
+	}
+
+	doTimeoutMonitorFlag := cli.DurationFlag{
+		Name:   FlagTimeoutMonitor,
+		Usage:  "Maximum monitoring period (the monitoring ends even if the continue-after condition is not met)",
+		EnvVar: "DSLIM_TIMEOUT_MONITOR",
+	}
+
+	doTimeoutSensorDoneFlag := cli.DurationFlag{
+		Name:   FlagTimeoutSensorDone,
+		Value:  ipc.DefaultEvtTimeout,
+		Usage:  "Timeout for the sensor to finish its work after the monitoring ends",
+		EnvVar: "DSLIM_TIMEOUT_SENSOR_DONE",
+	}
+
+	doTimeoutCopyFlag := cli.DurationFlag{
+		Name:   FlagTimeoutCopy,
+		Usage:  "Timeout for copying the artifacts from the container (with the Docker API transfer) or the pod",
+		EnvVar: "DSLIM_TIMEOUT_ARTIFACT_COPY",
+	}
+
+	doArtifactsTransferFlag := cli.StringFlag{
+		Name:   FlagArtifactsTransfer,
+		Value:  container.ArtifactsTransferAuto,
+		Usage:  "Select how the sensor and the artifacts are transferred to and from the target container: auto | mount | api (auto uses the Docker API only for the remote Docker hosts)",
+		EnvVar: "DSLIM_ARTIFACTS_TRANSFER",
+	}
+
+	doCompressArtifactsFlag := cli.BoolTFlag{
+		Name:   FlagCompressArtifacts,
+		Usage:  "Compress the artifacts copied from the container or the pod and verify their checksum (use --compress-artifacts=false to disable)",
+		EnvVar: "DSLIM_COMPRESS_ARTIFACTS",
+	}
+
+	doSensorSampleRateFlag := cli.IntFlag{
+		Name:   FlagSensorSampleRate,
+		Value:  1,
+		Usage:  "Record only one of each N calls of the same system call in the ptrace monitor (the other calls are only counted; the socket and the tracked file calls are always recorded)",
+		EnvVar: "DSLIM_SENSOR_PTRACE_SAMPLE_RATE",
+	}
+
+	doSensorQueueSizeFlag := cli.IntFlag{
+		Name:   FlagSensorQueueSize,
+		Value:  0,
+		Usage:  "Size of the sensor monitor event queues (0 uses the default sizes)",
+		EnvVar: "DSLIM_SENSOR_EVENT_QUEUE_SIZE",
+	}
+
+	doSensorNiceFlag := cli.IntFlag{
+		Name:   FlagSensorNice,
+		Value:  0,
+		Usage:  "Niceness (0-19) for the sensor threads once the target app is started (the target app is not affected)",
+		EnvVar: "DSLIM_SENSOR_NICE",
+	}
+
+	doIPCTransportFlag := cli.StringFlag{
+		Name:   FlagIPCTransport,
+		Value:  container.IPCTransportAuto,
+		Usage:  "Select how docker-slim connects to the sensor: auto | tcp | exec (auto tunnels the sensor connections with 'docker exec' if the published sensor ports are not reachable)",
+		EnvVar: "DSLIM_IPC_TRANSPORT",
+	}
+
+	doSensorDeliveryFlag := cli.StringFlag{
+		Name:   FlagSensorDelivery,
+		Value:  container.SensorDeliveryAuto,
+		Usage:  "Select how the sensor gets into the target container: auto | volume | image (volume and image don't need the sensor binary on the Docker host)",
+		EnvVar: "DSLIM_SENSOR_DELIVERY",
+	}
+
+	doExecRedactFlag := cli.StringFlag{
+		Name:   FlagExecRedact,
+		Value:  command.DefaultExecRedactPattern,
+		Usage:  "Regular expression for the executed command arguments to redact in the reports",
+		EnvVar: "DSLIM_EXEC_REDACT",
+	}
+
+	doTargetRestartsFlag := cli.IntFlag{
+		Name:   FlagTargetRestarts,
+		Value:  0,
+		Usage:  "Number of times to restart the target app during monitoring",
+		EnvVar: "DSLIM_TARGET_RESTARTS",
+	}
+
+	doSeccompBaselineFlag := cli.StringFlag{
+		Name:   FlagSeccompBaseline,
+		Value:  "",
+		Usage:  "Merge the generated seccomp profile with a baseline profile: docker-default | profileFilePath",
+		EnvVar: "DSLIM_SECCOMP_BASELINE",
+	}
+
+	doSeccompMergeModeFlag := cli.StringFlag{
+		Name:   FlagSeccompMergeMode,
+		Value:  "union",
+		Usage:  "Select the seccomp baseline merge mode: union | intersection",
+		EnvVar: "DSLIM_SECCOMP_MERGE_MODE",
+	}
+
+	doSeccompAnnotateFlag := cli.BoolFlag{
+		Name:   FlagSeccompAnnotate,
+		Usage:  "Generate an annotated seccomp profile explaining why each system call is allowed",
+		EnvVar: "DSLIM_SECCOMP_ANNOTATE",
+	}
+
+	doAnalysisCacheFlag := cli.BoolTFlag{
+		Name:   FlagAnalysisCache,
+		Usage:  "Cache the image analysis results (the image file inventory and the reverse engineered Dockerfile) in the image state (use --analysis-cache=false to disable)",
+		EnvVar: "DSLIM_ANALYSIS_CACHE",
+	}
+
+	doRemovedFilesGzipFlag := cli.BoolFlag{
+		Name:   FlagRemovedFilesGzip,
+		Usage:  "Compress the listing of the files removed from the minified image (gzip)",
+		EnvVar: "DSLIM_REMOVED_FILES_GZIP",
+	}
+
+	doUseArtifactsFlag := cli.StringSliceFlag{
+		Name:   FlagUseArtifacts,
+		Value:  &cli.StringSlice{},
+		Usage:  "Merge the artifacts from other monitoring runs (artifacts directory or container report)",
+		EnvVar: "DSLIM_USE_ARTIFACTS",
+	}
+
+	doArtifactStoreFlag := cli.StringFlag{
+		Name:   FlagArtifactStore,
+		Value:  "",
+		Usage:  "Accumulate the artifacts from the monitoring runs in the artifact store directory and build the minified image from all runs",
+		EnvVar: "DSLIM_ARTIFACT_STORE",
+	}
+
+	doSidecarFlag := cli.StringSliceFlag{
+		Name:   FlagSidecar,
+		Value:  &cli.StringSlice{},
+		Usage:  "Sidecar image to monitor and minify with the target (the sidecar container shares the target container network namespace) [zero or more]",
+		EnvVar: "DSLIM_SIDECAR",
+	}
+
+	doSensorPortFlag := cli.IntFlag{
+		Name:   FlagSensorPort,
+		Value:  0,
+		Usage:  "Sensor IPC command port in the target container (the event port is the next one; for the targets sharing a network namespace with other monitored containers)",
+		EnvVar: "DSLIM_SENSOR_PORT",
+	}
+
+	doTargetKubernetesFlag := cli.BoolFlag{
+		Name:   FlagTargetKubernetes,
+		Usage:  "Run the target container in a Kubernetes pod (using kubectl)",
+		EnvVar: "DSLIM_TARGET_KUBERNETES",
+	}
+
+	doKubernetesNSFlag := cli.StringFlag{
+		Name:   FlagKubernetesNS,
+		Value:  "",
+		Usage:  "Kubernetes namespace for the target pod (the current kubectl namespace is used by default)",
+		EnvVar: "DSLIM_KUBERNETES_NAMESPACE",
+	}
+
+	doKubernetesContextFlag := cli.StringFlag{
+		Name:   FlagKubernetesContext,
+		Value:  "",
+		Usage:  "kubectl context for the target pod",
+		EnvVar: "DSLIM_KUBERNETES_CONTEXT",
+	}
+
+	doKubeconfigFlag := cli.StringFlag{
+		Name:   FlagKubeconfig,
+		Value:  "",
+		Usage:  "kubectl config file for the target pod",
+		EnvVar: "DSLIM_KUBECONFIG",
+	}
+
+	doKubernetesHelperFlag := cli.StringFlag{
+		Name:   FlagKubernetesHelper,
+		Value:  kubernetes.DefaultHelperImage,
+		Usage:  "Image for the target pod helper containers (needs sh, tar and sleep)",
+		EnvVar: "DSLIM_KUBERNETES_HELPER_IMAGE",
+	}
+
+	doRuntimeFlag := cli.StringFlag{
+		Name:   FlagRuntime,
+		Value:  runtime.Docker,
+		Usage:  "Container runtime for the target image and container (docker or containerd)",
+		EnvVar: "DSLIM_RUNTIME",
+	}
+
+	doContainerdAddressFlag := cli.StringFlag{
+		Name:   FlagContainerdAddress,
+		Value:  containerd.DefaultAddress,
+		Usage:  "containerd socket address",
+		EnvVar: "DSLIM_CONTAINERD_ADDRESS",
+	}
+
+	doContainerdNSFlag := cli.StringFlag{
+		Name:   FlagContainerdNS,
+		Value:  containerd.DefaultNamespace,
+		Usage:  "containerd namespace for the target image and container",
+		EnvVar: "DSLIM_CONTAINERD_NAMESPACE",
+	}
+
+	doContainerdCNIFlag := cli.BoolFlag{
+		Name:   FlagContainerdCNI,
+		Usage:  "Connect the containerd target container to the CNI network (it has only the loopback interface otherwise)",
+		EnvVar: "DSLIM_CONTAINERD_CNI",
+	}
+
+	registryFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   FlagRegistryUser,
+			Value:  "",
+			Usage:  "registry user name (the Docker config credentials are used by default)",
+			EnvVar: "DSLIM_REGISTRY_USER",
+		},
+		cli.StringFlag{
+			Name:   FlagRegistryPassword,
+			Value:  "",
+			Usage:  "registry password or token",
+			EnvVar: "DSLIM_REGISTRY_PASSWORD",
+		},
+		cli.BoolFlag{
+			Name:   FlagInsecureRegistry,
+			Usage:  "use plain HTTP to access the registry",
+			EnvVar: "DSLIM_INSECURE_REGISTRY",
+		},
+	}
+
+	registryPlatformFlag := cli.StringFlag{
+		Name:   FlagPlatform,
+		Value:  "linux/amd64",
+		Usage:  "image platform for the multi-platform images (os/arch[/variant])",
+		EnvVar: "DSLIM_PLATFORM",
+	}
+
 	app.Commands = []cli.Command{
 		{
 			Name:    CmdVersion,
 			Aliases: []string{"v"},
-			Usage:   "Shows docker-slim and docker version information",
+			Usage:   "Shows docker-slim, sensor and docker version information",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:   FlagCheckUpdate,
+					Usage:  "check if there's a newer docker-slim release",
+					EnvVar: "DSLIM_CHECK_UPDATE",
+				},
+				cli.DurationFlag{
+					Name:   FlagCheckUpdateTimeout,
+					Value:  5 * time.Second,
+					Usage:  "release check timeout",
+					EnvVar: "DSLIM_CHECK_UPDATE_TIMEOUT",
+				},
+			},
 			Action: func(ctx *cli.Context) error {
 				clientConfig := getDockerClientConfig(ctx)
-				commands.OnVersion(clientConfig)
+				commands.OnVersion(clientConfig, ctx.Bool(FlagCheckUpdate), ctx.Duration(FlagCheckUpdateTimeout))
 				return nil
 			},
 		},
 		{
-			Name:    CmdInfo,
-			Aliases: []string{"i"},
-			Usage:   "Collects fat image information and reverse engineers its Dockerfile",
+			Name:      CmdInfo,
+			Aliases:   []string{"i"},
+			Usage:     "Collects fat image information and reverse engineers its Dockerfile",
+			ArgsUsage: "<IMAGE>",
+			Flags: []cli.Flag{
+				doAnalysisCacheFlag,
+			},
 			Action: func(ctx *cli.Context) error {
 				if len(ctx.Args()) < 1 {
 					fmt.Printf("[info] missing image ID/name...\n\n")
@@ -355,21 +1134,30 @@ func init() {
 
 				commands.OnInfo(
 					ctx.GlobalString(FlagCommandReport),
-					ctx.GlobalBool(FlagDebug),
+					ctx.GlobalString(FlagReportFormat),
+					ctx.GlobalString(FlagConsoleFormat),
+					isDebug(ctx),
 					statePath,
 					clientConfig,
-					imageRef)
+					imageRef,
+					ctx.BoolT(FlagAnalysisCache))
 				return nil
 			},
 		},
 		{
-			Name:    CmdBuild,
-			Aliases: []string{"b"},
-			Usage:   "Collects fat image information and builds a slim image from it",
+			Name:      CmdBuild,
+			Aliases:   []string{"b"},
+			Usage:     "Collects fat image information and builds a slim image from it",
+			ArgsUsage: "<IMAGE>",
 			Flags: []cli.Flag{
 				doHTTPProbeFlag,
 				doHTTPProbeCmdFlag,
 				doHTTPProbeCmdFileFlag,
+				doHTTPProbeHostFlag,
+				doExecFileFlag,
+				doHostExecBeforeMonitorFlag,
+				doHostExecAfterMonitorFlag,
+				doFailOnFlag,
 				doShowContainerLogsFlag,
 				doShowBuildLogsFlag,
 				cli.BoolFlag{
@@ -383,6 +1171,21 @@ func init() {
 					Usage:  "Custom tag for the generated image",
 					EnvVar: "DSLIM_TARGET_TAG",
 				},
+				cli.BoolFlag{
+					Name:   FlagVerifyProfiles,
+					Usage:  "Run the minified image with the generated security profiles and fail if anything is blocked",
+					EnvVar: "DSLIM_VERIFY_PROFILES",
+				},
+				cli.BoolFlag{
+					Name:   FlagVerifyImage,
+					Usage:  "Run the minified image and re-run the HTTP probe and the test script against it (fail if they don't work)",
+					EnvVar: "DSLIM_VERIFY_IMAGE",
+				},
+				cli.DurationFlag{
+					Name:   FlagTimeoutBuild,
+					Usage:  "Timeout for building the minified image",
+					EnvVar: "DSLIM_TIMEOUT_IMAGE_BUILD",
+				},
 				cli.StringFlag{
 					Name:   "image-overrides",
 					Value:  "",
@@ -394,46 +1197,192 @@ func init() {
 				doUseWorkdirFlag,
 				doUseEnvFlag,
 				doUseLinkFlag,
+				doDepFlag,
 				doUseEtcHostsMapFlag,
 				doUseContainerDnsFlag,
 				doUseContainerDnsSearchFlag,
+				doUseContainerNameFlag,
+				doUseContainerLabelFlag,
 				doUseNetworkFlag,
 				doUseHostnameFlag,
 				doUseExposeFlag,
+				doAutoExposeFlag,
+				doMaxSizeFlag,
+				doMinReductionFlag,
+				doOutputBaseFlag,
+				doLayersFlag,
+				doAppPathFlag,
+				doInstrumentFlag,
 				doExcludeMountsFlag,
 				doExcludePathFlag,
 				doIncludePathFlag,
+				doIncludeDistroFlag,
+				doIncludeTzdataFlag,
+				doIncludeLocalesFlag,
 				doUseMountFlag,
 				doConfinueAfterFlag,
-			},
-			Action: func(ctx *cli.Context) error {
-				if len(ctx.Args()) < 1 {
-					fmt.Printf("[build] missing image ID/name...\n\n")
-					cli.ShowCommandHelp(ctx, CmdBuild)
-					return nil
-				}
-
-				statePath := ctx.GlobalString(FlagStatePath)
-
-				imageRef := ctx.Args().First()
-				clientConfig := getDockerClientConfig(ctx)
-				doRmFileArtifacts := ctx.Bool("remove-file-artifacts")
-
-				doHTTPProbe := ctx.Bool(FlagHttpProbe)
-
-				httpProbeCmds, err := getHTTPProbes(ctx)
-				if err != nil {
-					fmt.Printf("[build] invalid HTTP probes: %v\n", err)
-					return err
-				}
-
-				if doHTTPProbe {
-					//add default probe cmd if the "http-probe" flag is explicitly set
-					httpProbeCmds = append(httpProbeCmds,
-						config.HTTPProbeCmd{Protocol: "http", Method: "GET", Resource: "/"})
-				}
-
-				if len(httpProbeCmds) > 0 {
+				doPresetFlag,
+				doTargetRestartsFlag,
+				doTimeoutStartFlag,
+				doTimeoutReadyFlag,
+				doTimeoutMonitorFlag,
+				doTimeoutSensorDoneFlag,
+				doTimeoutCopyFlag,
+				doArtifactsTransferFlag,
+				doCompressArtifactsFlag,
+				doSensorSampleRateFlag,
+				doSensorQueueSizeFlag,
+				doSensorNiceFlag,
+				doIPCTransportFlag,
+				doSensorDeliveryFlag,
+				doExecRedactFlag,
+				doSeccompBaselineFlag,
+				doSeccompMergeModeFlag,
+				doSeccompAnnotateFlag,
+				doUseArtifactsFlag,
+				doArtifactStoreFlag,
+				doSidecarFlag,
+				doSensorPortFlag,
+				doRemovedFilesGzipFlag,
+				doAnalysisCacheFlag,
+				doTargetKubernetesFlag,
+				doKubernetesNSFlag,
+				doKubernetesContextFlag,
+				doKubeconfigFlag,
+				doKubernetesHelperFlag,
+				doRuntimeFlag,
+				doContainerdAddressFlag,
+				doContainerdNSFlag,
+				doContainerdCNIFlag,
+				cli.StringFlag{
+					Name:   FlagProjectConfig,
+					Value:  "",
+					Usage:  "Project config file with the target image and the build flag values (slim.yaml in the current directory by default, 'none' to ignore it)",
+					EnvVar: "DSLIM_CONFIG",
+				},
+				cli.BoolFlag{
+					Name:   FlagCacheArtifacts,
+					Usage:  "Reuse the artifacts from the last monitoring run for the same image (the image state) instead of running the target container",
+					EnvVar: "DSLIM_CACHE_ARTIFACTS",
+				},
+				cli.BoolFlag{
+					Name:   FlagIncremental,
+					Usage:  "Reuse the artifacts from the image state of a minified image with the same bottom layers for the unchanged layers (the monitoring is skipped if the app can't observe the changed layers)",
+					EnvVar: "DSLIM_INCREMENTAL",
+				},
+				cli.BoolFlag{
+					Name:   FlagDryRun,
+					Usage:  "Inspect the image and show what the build would do without creating any containers or images",
+					EnvVar: "DSLIM_DRY_RUN",
+				},
+				cli.StringFlag{
+					Name:   FlagFromReport,
+					Value:  "",
+					Usage:  "Build the minified image from saved monitoring artifacts without running the target container (artifacts directory or container report)",
+					EnvVar: "DSLIM_FROM_REPORT",
+				},
+				cli.StringFlag{
+					Name:   FlagSwarmService,
+					Value:  "",
+					Usage:  "Monitor a running task of the Docker Swarm service on the local node instead of running the target container",
+					EnvVar: "DSLIM_TARGET_SWARM_SERVICE",
+				},
+				cli.DurationFlag{
+					Name:   FlagSwarmDuration,
+					Value:  5 * time.Minute,
+					Usage:  "Monitoring period for the Swarm service task",
+					EnvVar: "DSLIM_SWARM_DURATION",
+				},
+				cli.BoolFlag{
+					Name:   FlagLambda,
+					Usage:  "AWS Lambda container image mode (invoke the function with the Runtime Interface Emulator and keep the runtime)",
+					EnvVar: "DSLIM_LAMBDA",
+				},
+				cli.StringSliceFlag{
+					Name:   FlagLambdaEvent,
+					Value:  &cli.StringSlice{},
+					Usage:  "Sample event file for the Lambda function invocations (an empty JSON object is used by default)",
+					EnvVar: "DSLIM_LAMBDA_EVENT",
+				},
+				cli.StringFlag{
+					Name:   FlagLambdaRIE,
+					Value:  "",
+					Usage:  "Local Runtime Interface Emulator binary to mount for the Lambda images that are not based on an AWS base image",
+					EnvVar: "DSLIM_LAMBDA_RIE",
+				},
+				cli.BoolFlag{
+					Name:   FlagReview,
+					Usage:  "Review and adjust the kept files interactively before building the minified image",
+					EnvVar: "DSLIM_REVIEW",
+				},
+				cli.BoolFlag{
+					Name:   FlagK8sPatch,
+					Usage:  "Generate the kustomize and Helm patches to deploy the minified image",
+					EnvVar: "DSLIM_K8S_PATCH",
+				},
+				cli.StringFlag{
+					Name:   FlagK8sWorkload,
+					Value:  "",
+					Usage:  "Kubernetes workload for the generated patches (kind/name, deployment/IMAGE_NAME by default)",
+					EnvVar: "DSLIM_K8S_WORKLOAD",
+				},
+				cli.StringFlag{
+					Name:   FlagK8sContainer,
+					Value:  "",
+					Usage:  "Workload container name for the generated patches (IMAGE_NAME by default)",
+					EnvVar: "DSLIM_K8S_CONTAINER",
+				},
+				cli.StringFlag{
+					Name:   FlagK8sBase,
+					Value:  k8s.DefaultKustomizeBase,
+					Usage:  "kustomize base with the original manifests (used in the generated kustomization)",
+					EnvVar: "DSLIM_K8S_BASE",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				projectConfig, err := applyProjectConfig(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid project config: %v\n", err)
+					return err
+				}
+
+				stackPreset, err := applyPreset(ctx, projectConfig)
+				if err != nil {
+					fmt.Printf("[build] invalid preset: %v\n", err)
+					return err
+				}
+
+				imageRef := ctx.Args().First()
+				if imageRef == "" && projectConfig != nil {
+					imageRef = projectConfig.Image
+				}
+
+				if imageRef == "" {
+					fmt.Printf("[build] missing image ID/name...\n\n")
+					cli.ShowCommandHelp(ctx, CmdBuild)
+					return nil
+				}
+
+				statePath := ctx.GlobalString(FlagStatePath)
+
+				clientConfig := getDockerClientConfig(ctx)
+				doRmFileArtifacts := ctx.Bool("remove-file-artifacts")
+
+				doHTTPProbe := ctx.Bool(FlagHttpProbe)
+
+				httpProbeCmds, err := getHTTPProbes(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid HTTP probes: %v\n", err)
+					return err
+				}
+
+				if doHTTPProbe {
+					//add default probe cmd if the "http-probe" flag is explicitly set
+					httpProbeCmds = append(httpProbeCmds,
+						config.HTTPProbeCmd{Protocol: "http", Method: "GET", Resource: "/", Host: ctx.String(FlagHttpProbeHost)})
+				}
+
+				if len(httpProbeCmds) > 0 {
 					doHTTPProbe = true
 				}
 
@@ -448,6 +1397,12 @@ func init() {
 					return err
 				}
 
+				containerLabels, err := parseContainerLabels(ctx.StringSlice(FlagContainerLabel))
+				if err != nil {
+					fmt.Printf("[build] invalid container labels: %v\n", err)
+					return err
+				}
+
 				volumeMounts, err := parseVolumeMounts(ctx.StringSlice(FlagMount))
 				if err != nil {
 					fmt.Printf("[build] invalid volume mounts: %v\n", err)
@@ -464,6 +1419,15 @@ func init() {
 					}
 				}
 
+				if stackPreset != nil {
+					//the excluded paths override the preset include paths
+					for _, ipath := range stackPreset.IncludePaths {
+						if !excludePaths[ipath] {
+							includePaths[ipath] = true
+						}
+					}
+				}
+
 				confinueAfter, err := getContinueAfter(ctx)
 				if err != nil {
 					fmt.Printf("[build] invalid continue-after mode: %v\n", err)
@@ -477,57 +1441,341 @@ func init() {
 					}
 				}
 
-				commands.OnBuild(
-					ctx.GlobalString(FlagCommandReport),
-					ctx.GlobalBool(FlagDebug),
-					statePath,
-					clientConfig,
-					imageRef,
-					doTag,
-					doHTTPProbe,
-					httpProbeCmds,
-					doRmFileArtifacts,
-					doShowContainerLogs,
-					doShowBuildLogs,
-					parseImageOverrides(doImageOverrides),
-					overrides,
-					ctx.StringSlice(FlagLink),
-					ctx.StringSlice(FlagEtcHostsMap),
-					ctx.StringSlice(FlagContainerDns),
-					ctx.StringSlice(FlagContainerDnsSearch),
-					volumeMounts,
-					excludePaths,
-					includePaths,
-					confinueAfter)
+				targetRestarts := ctx.Int(FlagTargetRestarts)
+				if targetRestarts < 0 {
+					return cli.NewExitError(fmt.Sprintf("[build] invalid target restart count: %v", targetRestarts),
+						errutils.ExitCodeError)
+				}
+
+				seccompMerge, err := getSeccompMerge(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid seccomp baseline options: %v\n", err)
+					return err
+				}
+
+				swarmConfig := getSwarmConfig(ctx)
+				if swarmConfig != nil {
+					if ctx.String(FlagFromReport) != "" || ctx.String(FlagRuntime) != runtime.Docker || ctx.Bool(FlagTargetKubernetes) || ctx.Bool(FlagLambda) {
+						fmt.Printf("[build] --%v can't be used with --%v, --%v, --%v or --%v\n",
+							FlagSwarmService, FlagFromReport, FlagRuntime, FlagTargetKubernetes, FlagLambda)
+						return nil
+					}
+
+					if swarmConfig.Duration <= 0 {
+						fmt.Printf("[build] invalid Swarm task monitoring period: %v\n", swarmConfig.Duration)
+						return nil
+					}
+				}
+
+				lambdaConfig := getLambdaConfig(ctx)
+				if lambdaConfig != nil {
+					lambdaProbeCmds, err := lambda.ProbeCmds(lambdaConfig.EventFiles)
+					if err != nil {
+						fmt.Printf("[build] invalid Lambda event: %v\n", err)
+						return err
+					}
+
+					//the function is invoked with the HTTP probe
+					httpProbeCmds = append(httpProbeCmds, lambdaProbeCmds...)
+					doHTTPProbe = true
+					if !isFlagSet(ctx, projectConfig, FlagContinueAfter) {
+						confinueAfter.Mode = "probe"
+					}
+				}
+
+				containerdConfig, err := getContainerdConfig(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid runtime options: %v\n", err)
+					return err
+				}
+
+				timeouts, err := getTimeouts(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid timeouts: %v\n", err)
+					return err
+				}
+
+				artifactsTransfer, err := getArtifactsTransfer(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid artifacts transfer mode: %v\n", err)
+					return err
+				}
+
+				sensorThrottle, err := getSensorThrottle(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid sensor options: %v\n", err)
+					return err
+				}
+
+				ipcTransport, err := getIPCTransport(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid IPC transport mode: %v\n", err)
+					return err
+				}
+
+				sensorDelivery, err := getSensorDelivery(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid sensor delivery mode: %v\n", err)
+					return err
+				}
+
+				execRedactPattern, err := getExecRedactPattern(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid exec redaction pattern: %v\n", err)
+					return err
+				}
+
+				dependencies, err := getDependencies(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid dependency containers: %v\n", err)
+					return err
+				}
+
+				execFile, err := getExecFile(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid test script: %v\n", err)
+					return err
+				}
+
+				if execFile == "" && confinueAfter.Mode == "exec" {
+					fmt.Printf("[build] --%v exec requires --%v\n", FlagContinueAfter, FlagExecFile)
+					return nil
+				}
+
+				sizeBudget, err := getSizeBudget(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid size budget: %v\n", err)
+					return err
+				}
+
+				failOn, err := getFailOn(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid fail-on gates: %v\n", err)
+					return err
+				}
+
+				includeLocales, err := getIncludeLocales(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid locales: %v\n", err)
+					return err
+				}
+
+				if execFile != "" {
+					if ctx.String(FlagFromReport) != "" || swarmConfig != nil {
+						fmt.Printf("[build] --%v can't be used with --%v or --%v\n", FlagExecFile, FlagFromReport, FlagSwarmService)
+						return nil
+					}
+
+					if !isFlagSet(ctx, projectConfig, FlagContinueAfter) {
+						confinueAfter.Mode = "exec"
+					}
+				}
+
+				if containerdConfig != nil && (ctx.Bool(FlagReview) || ctx.Bool(FlagVerifyProfiles) || ctx.Bool(FlagVerifyImage)) {
+					fmt.Printf("[build] --%v, --%v and --%v are not supported with the containerd runtime\n",
+						FlagReview, FlagVerifyProfiles, FlagVerifyImage)
+					return nil
+				}
+
+				outputBase := strings.TrimSpace(ctx.String(FlagOutputBase))
+				if strings.ContainsAny(outputBase, " \t") {
+					fmt.Printf("[build] invalid output base image: %v\n", outputBase)
+					return nil
+				}
+
+				if containerdConfig != nil && builder.OutputBaseImage(outputBase) != builder.OutputBaseScratch {
+					fmt.Printf("[build] only the scratch --%v is supported with the containerd runtime\n", FlagOutputBase)
+					return nil
+				}
+
+				if !builder.IsLayerMode(ctx.String(FlagLayers)) {
+					fmt.Printf("[build] unknown layer mode: %v (use %v)\n", ctx.String(FlagLayers), strings.Join(builder.LayerModes, " | "))
+					return nil
+				}
+
+				appPaths, err := getAppPaths(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid app paths: %v\n", err)
+					return err
+				}
+
+				if len(appPaths) > 0 && ctx.String(FlagLayers) != builder.LayersDepsApp {
+					fmt.Printf("[build] --%v is used only with --%v %v\n", FlagAppPath, FlagLayers, builder.LayersDepsApp)
+					return nil
+				}
+
+				if ctx.Bool(FlagInstrument) {
+					if ctx.Bool(FlagDryRun) || ctx.String(FlagFromReport) != "" || swarmConfig != nil || ctx.Bool(FlagIncremental) ||
+						containerdConfig != nil || ctx.Bool(FlagTargetKubernetes) || lambdaConfig != nil {
+						fmt.Printf("[build] --%v can't be used with --%v, --%v, --%v, --%v, --%v, --%v or --%v\n",
+							FlagInstrument, FlagDryRun, FlagFromReport, FlagSwarmService, FlagIncremental, FlagRuntime, FlagTargetKubernetes, FlagLambda)
+						return nil
+					}
+				}
+
+				sensorPort := ctx.Int(FlagSensorPort)
+				if sensorPort < 0 || sensorPort > 65534 {
+					fmt.Printf("[build] invalid sensor port: %v\n", sensorPort)
+					return nil
+				}
+
+				sidecars, err := getSidecars(ctx)
+				if err != nil {
+					fmt.Printf("[build] invalid sidecars: %v\n", err)
+					return nil
+				}
+
+				if sidecars != nil {
+					if ctx.String(FlagFromReport) != "" || ctx.Bool(FlagInstrument) || ctx.Bool(FlagCacheArtifacts) || ctx.Bool(FlagIncremental) ||
+						swarmConfig != nil || containerdConfig != nil || ctx.Bool(FlagTargetKubernetes) || lambdaConfig != nil {
+						fmt.Printf("[build] --%v can't be used with --%v, --%v, --%v, --%v, --%v, --%v, --%v or --%v\n",
+							FlagSidecar, FlagFromReport, FlagInstrument, FlagCacheArtifacts, FlagIncremental, FlagSwarmService, FlagRuntime, FlagTargetKubernetes, FlagLambda)
+						return nil
+					}
+				}
+
+				commands.OnBuild(&commands.BuildOptions{
+					CmdReportLocation: ctx.GlobalString(FlagCommandReport),
+					CmdReportFormat:   ctx.GlobalString(FlagReportFormat),
+					CmdReportUpload:   ctx.GlobalString(FlagReportUpload),
+					ConsoleFormat:     ctx.GlobalString(FlagConsoleFormat),
+					Debug:             isDebug(ctx),
+					StatePath:         statePath,
+					ClientConfig:      clientConfig,
+					MetricsConfig:     getMetricsConfig(ctx),
+					TracingConfig:     getTracingConfig(ctx),
+					ImageRef:          imageRef,
+					CustomImageTag:    doTag,
+					HTTPProbe:         doHTTPProbe,
+					HTTPProbeCmds:     httpProbeCmds,
+					RmFileArtifacts:   doRmFileArtifacts,
+					ShowContainerLogs: doShowContainerLogs,
+					ShowBuildLogs:     doShowBuildLogs,
+					ImageOverrides:    parseImageOverrides(doImageOverrides),
+					Overrides:         overrides,
+					Links:             ctx.StringSlice(FlagLink),
+					EtcHostsMaps:      ctx.StringSlice(FlagEtcHostsMap),
+					DNSServers:        ctx.StringSlice(FlagContainerDns),
+					DNSSearchDomains:  ctx.StringSlice(FlagContainerDnsSearch),
+					ContainerName:     ctx.String(FlagContainerName),
+					ContainerLabels:   containerLabels,
+					VolumeMounts:      volumeMounts,
+					ExcludePaths:      excludePaths,
+					IncludePaths:      includePaths,
+					ContinueAfter:     confinueAfter,
+					TargetRestarts:    targetRestarts,
+					UseArtifacts:      ctx.StringSlice(FlagUseArtifacts),
+					FromReport:        ctx.String(FlagFromReport),
+					Review:            ctx.Bool(FlagReview),
+					SeccompMerge:      seccompMerge,
+					AnnotateSeccomp:   ctx.Bool(FlagSeccompAnnotate),
+					VerifyProfiles:    ctx.Bool(FlagVerifyProfiles),
+					GzipRemovedFiles:  ctx.Bool(FlagRemovedFilesGzip),
+					DryRun:            ctx.Bool(FlagDryRun),
+					AnalysisCache:     ctx.BoolT(FlagAnalysisCache),
+					CacheArtifacts:    ctx.Bool(FlagCacheArtifacts),
+					Incremental:       ctx.Bool(FlagIncremental),
+					KubernetesConfig:  getKubernetesConfig(ctx),
+					K8sPatch:          getK8sPatchConfig(ctx),
+					ContainerdConfig:  containerdConfig,
+					LambdaConfig:      lambdaConfig,
+					SwarmConfig:       swarmConfig,
+					Timeouts:          timeouts,
+					ArtifactsTransfer: artifactsTransfer,
+					CompressArtifacts: ctx.BoolT(FlagCompressArtifacts),
+					SensorThrottle:    sensorThrottle,
+					IPCTransport:      ipcTransport,
+					SensorDelivery:    sensorDelivery,
+					AutoExpose:        ctx.BoolT(FlagAutoExpose),
+					ExecRedactPattern: execRedactPattern,
+					Dependencies:      dependencies,
+					ExecFile:          execFile,
+					SizeBudget:        sizeBudget,
+					FailOn:            failOn,
+					VerifyImage:       ctx.Bool(FlagVerifyImage),
+					IncludeDistro:     ctx.BoolT(FlagIncludeDistro),
+					IncludeTzdata:     ctx.Bool(FlagIncludeTzdata),
+					IncludeLocales:    includeLocales,
+					OutputBase:        outputBase,
+					LayerMode:         ctx.String(FlagLayers),
+					AppPaths:          appPaths,
+					Instrument:        ctx.Bool(FlagInstrument),
+					ArtifactStore:     ctx.String(FlagArtifactStore),
+					SensorPort:        sensorPort,
+					Sidecars:          sidecars,
+					Hooks:             getMonitorHooks(ctx),
+				})
 
 				return nil
 			},
 		},
 		{
-			Name:    CmdProfile,
-			Aliases: []string{"p"},
-			Usage:   "Collects fat image information and generates a fat container report",
+			Name:      CmdProfile,
+			Aliases:   []string{"p"},
+			Usage:     "Collects fat image information and generates a fat container report",
+			ArgsUsage: "<IMAGE>",
 			Flags: []cli.Flag{
 				doHTTPProbeFlag,
 				doHTTPProbeCmdFlag,
 				doHTTPProbeCmdFileFlag,
+				doHTTPProbeHostFlag,
+				doExecFileFlag,
+				doHostExecBeforeMonitorFlag,
+				doHostExecAfterMonitorFlag,
+				doFailOnFlag,
 				doShowContainerLogsFlag,
 				doUseEntrypointFlag,
 				doUseCmdFlag,
 				doUseWorkdirFlag,
 				doUseEnvFlag,
 				doUseLinkFlag,
+				doDepFlag,
 				doUseEtcHostsMapFlag,
 				doUseContainerDnsFlag,
 				doUseContainerDnsSearchFlag,
+				doUseContainerNameFlag,
+				doUseContainerLabelFlag,
 				doUseNetworkFlag,
 				doUseHostnameFlag,
 				doUseExposeFlag,
 				doExcludeMountsFlag,
 				doExcludePathFlag,
 				doIncludePathFlag,
+				doIncludeDistroFlag,
+				doIncludeTzdataFlag,
+				doIncludeLocalesFlag,
 				doUseMountFlag,
 				doConfinueAfterFlag,
+				doPresetFlag,
+				doTargetRestartsFlag,
+				doTimeoutStartFlag,
+				doTimeoutReadyFlag,
+				doTimeoutMonitorFlag,
+				doTimeoutSensorDoneFlag,
+				doTimeoutCopyFlag,
+				doArtifactsTransferFlag,
+				doCompressArtifactsFlag,
+				doSensorSampleRateFlag,
+				doSensorQueueSizeFlag,
+				doSensorNiceFlag,
+				doIPCTransportFlag,
+				doSensorDeliveryFlag,
+				doExecRedactFlag,
+				doSeccompBaselineFlag,
+				doSeccompMergeModeFlag,
+				doSeccompAnnotateFlag,
+				doUseArtifactsFlag,
+				doRemovedFilesGzipFlag,
+				doAnalysisCacheFlag,
+				doTargetKubernetesFlag,
+				doKubernetesNSFlag,
+				doKubernetesContextFlag,
+				doKubeconfigFlag,
+				doKubernetesHelperFlag,
+				doRuntimeFlag,
+				doContainerdAddressFlag,
+				doContainerdNSFlag,
+				doContainerdCNIFlag,
 			},
 			Action: func(ctx *cli.Context) error {
 				if len(ctx.Args()) < 1 {
@@ -536,6 +1784,12 @@ func init() {
 					return nil
 				}
 
+				stackPreset, err := applyPreset(ctx, nil)
+				if err != nil {
+					fmt.Printf("[profile] invalid preset: %v\n", err)
+					return err
+				}
+
 				statePath := ctx.GlobalString(FlagStatePath)
 
 				imageRef := ctx.Args().First()
@@ -551,7 +1805,7 @@ func init() {
 				if doHTTPProbe {
 					//add default probe cmd if the "http-probe" flag is explicitly set
 					httpProbeCmds = append(httpProbeCmds,
-						config.HTTPProbeCmd{Protocol: "http", Method: "GET", Resource: "/"})
+						config.HTTPProbeCmd{Protocol: "http", Method: "GET", Resource: "/", Host: ctx.String(FlagHttpProbeHost)})
 				}
 
 				if len(httpProbeCmds) > 0 {
@@ -565,6 +1819,12 @@ func init() {
 					return err
 				}
 
+				containerLabels, err := parseContainerLabels(ctx.StringSlice(FlagContainerLabel))
+				if err != nil {
+					fmt.Printf("[profile] invalid container labels: %v\n", err)
+					return err
+				}
+
 				volumeMounts, err := parseVolumeMounts(ctx.StringSlice(FlagMount))
 				if err != nil {
 					fmt.Printf("[profile] invalid volume mounts: %v\n", err)
@@ -581,6 +1841,15 @@ func init() {
 					}
 				}
 
+				if stackPreset != nil {
+					//the excluded paths override the preset include paths
+					for _, ipath := range stackPreset.IncludePaths {
+						if !excludePaths[ipath] {
+							includePaths[ipath] = true
+						}
+					}
+				}
+
 				confinueAfter, err := getContinueAfter(ctx)
 				if err != nil {
 					fmt.Printf("[profile] invalid continue-after mode: %v\n", err)
@@ -594,56 +1863,1204 @@ func init() {
 					}
 				}
 
-				commands.OnProfile(
-					ctx.GlobalString(FlagCommandReport),
-					ctx.GlobalBool(FlagDebug),
-					statePath,
-					clientConfig,
-					imageRef,
-					doHTTPProbe,
-					httpProbeCmds,
-					doShowContainerLogs,
-					overrides,
-					ctx.StringSlice(FlagLink),
-					ctx.StringSlice(FlagEtcHostsMap),
-					ctx.StringSlice(FlagContainerDns),
-					ctx.StringSlice(FlagContainerDnsSearch),
-					volumeMounts,
-					excludePaths,
-					includePaths,
-					confinueAfter)
+				targetRestarts := ctx.Int(FlagTargetRestarts)
+				if targetRestarts < 0 {
+					return cli.NewExitError(fmt.Sprintf("[profile] invalid target restart count: %v", targetRestarts),
+						errutils.ExitCodeError)
+				}
 
-				return nil
-			},
-		},
-	}
-}
+				seccompMerge, err := getSeccompMerge(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid seccomp baseline options: %v\n", err)
+					return err
+				}
 
-func getContinueAfter(ctx *cli.Context) (*config.ContinueAfter, error) {
-	info := &config.ContinueAfter{
-		Mode: "enter",
-	}
+				containerdConfig, err := getContainerdConfig(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid runtime options: %v\n", err)
+					return err
+				}
 
-	doConfinueAfter := ctx.String(FlagContinueAfter)
-	switch doConfinueAfter {
-	case "enter":
-		info.Mode = "enter"
-	case "signal":
-		info.Mode = "signal"
-		info.ContinueChan = appContinueChan
-	case "probe":
-		info.Mode = "probe"
-	case "timeout":
+				timeouts, err := getTimeouts(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid timeouts: %v\n", err)
+					return err
+				}
+
+				artifactsTransfer, err := getArtifactsTransfer(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid artifacts transfer mode: %v\n", err)
+					return err
+				}
+
+				sensorThrottle, err := getSensorThrottle(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid sensor options: %v\n", err)
+					return err
+				}
+
+				ipcTransport, err := getIPCTransport(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid IPC transport mode: %v\n", err)
+					return err
+				}
+
+				sensorDelivery, err := getSensorDelivery(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid sensor delivery mode: %v\n", err)
+					return err
+				}
+
+				execRedactPattern, err := getExecRedactPattern(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid exec redaction pattern: %v\n", err)
+					return err
+				}
+
+				dependencies, err := getDependencies(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid dependency containers: %v\n", err)
+					return err
+				}
+
+				execFile, err := getExecFile(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid test script: %v\n", err)
+					return err
+				}
+
+				if execFile == "" && confinueAfter.Mode == "exec" {
+					fmt.Printf("[profile] --%v exec requires --%v\n", FlagContinueAfter, FlagExecFile)
+					return nil
+				}
+
+				if execFile != "" && !isFlagSet(ctx, nil, FlagContinueAfter) {
+					confinueAfter.Mode = "exec"
+				}
+
+				failOn, err := getFailOn(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid fail-on gates: %v\n", err)
+					return err
+				}
+
+				includeLocales, err := getIncludeLocales(ctx)
+				if err != nil {
+					fmt.Printf("[profile] invalid locales: %v\n", err)
+					return err
+				}
+
+				commands.OnProfile(
+					ctx.GlobalString(FlagCommandReport),
+					ctx.GlobalString(FlagReportFormat),
+					ctx.GlobalString(FlagReportUpload),
+					ctx.GlobalString(FlagConsoleFormat),
+					isDebug(ctx),
+					statePath,
+					clientConfig,
+					getMetricsConfig(ctx),
+					getTracingConfig(ctx),
+					imageRef,
+					doHTTPProbe,
+					httpProbeCmds,
+					doShowContainerLogs,
+					overrides,
+					ctx.StringSlice(FlagLink),
+					ctx.StringSlice(FlagEtcHostsMap),
+					ctx.StringSlice(FlagContainerDns),
+					ctx.StringSlice(FlagContainerDnsSearch),
+					ctx.String(FlagContainerName),
+					containerLabels,
+					volumeMounts,
+					excludePaths,
+					includePaths,
+					confinueAfter,
+					targetRestarts,
+					ctx.StringSlice(FlagUseArtifacts),
+					seccompMerge,
+					ctx.Bool(FlagSeccompAnnotate),
+					ctx.Bool(FlagRemovedFilesGzip),
+					ctx.BoolT(FlagAnalysisCache),
+					getKubernetesConfig(ctx),
+					containerdConfig,
+					timeouts,
+					artifactsTransfer,
+					ctx.BoolT(FlagCompressArtifacts),
+					sensorThrottle,
+					ipcTransport,
+					sensorDelivery,
+					execRedactPattern,
+					dependencies,
+					execFile,
+					failOn,
+					ctx.BoolT(FlagIncludeDistro),
+					ctx.Bool(FlagIncludeTzdata),
+					includeLocales,
+					getMonitorHooks(ctx))
+
+				return nil
+			},
+		},
+		{
+			Name:      CmdCompletion,
+			Usage:     "Prints the shell completion script for the commands, the flags and the local image names",
+			ArgsUsage: "<bash | zsh | fish | powershell>",
+			Action: func(ctx *cli.Context) error {
+				commands.OnCompletion(ctx.Args().First(), getCompletionSpec(ctx.App))
+				return nil
+			},
+		},
+		{
+			Name:  CmdStats,
+			Usage: "Shows the local usage statistics collected with the opt-in anonymous telemetry (--telemetry)",
+			Action: func(ctx *cli.Context) error {
+				commands.OnStats(ctx.GlobalString(FlagConsoleFormat), ctx.GlobalString(FlagStatePath))
+				return nil
+			},
+		},
+		{
+			Name:      CmdSchema,
+			Usage:     "Prints the JSON Schema for the docker-slim reports (or the list of report schemas)",
+			ArgsUsage: "[build | profile | info | batch | container]",
+			Action: func(ctx *cli.Context) error {
+				commands.OnSchema(ctx.Args().First())
+				return nil
+			},
+		},
+		{
+			Name:  CmdServe,
+			Usage: "Runs the build, profile and info commands as jobs submitted with an HTTP/JSON API",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagListen,
+					Value:  "127.0.0.1:7070",
+					Usage:  "API server address",
+					EnvVar: "DSLIM_SERVE_LISTEN",
+				},
+				cli.IntFlag{
+					Name:   FlagMaxJobs,
+					Value:  1,
+					Usage:  "maximum number of jobs running at the same time",
+					EnvVar: "DSLIM_SERVE_MAX_JOBS",
+				},
+				cli.StringFlag{
+					Name:   FlagAPIToken,
+					Usage:  "require the API clients to use this bearer token",
+					EnvVar: "DSLIM_SERVE_API_TOKEN",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				serverConfig := &config.Server{
+					ListenAddr: ctx.String(FlagListen),
+					MaxJobs:    ctx.Int(FlagMaxJobs),
+					Token:      ctx.String(FlagAPIToken),
+					GlobalArgs: getJobGlobalArgs(ctx),
+				}
+
+				if serverConfig.Token == "" && !server.IsLoopbackAddr(serverConfig.ListenAddr) {
+					fmt.Printf("[serve] --%v is required to listen on %v (use a loopback address without a token)\n",
+						FlagAPIToken, serverConfig.ListenAddr)
+					return server.ErrNoToken
+				}
+
+				commands.OnServe(ctx.GlobalString(FlagConsoleFormat), ctx.GlobalString(FlagStatePath), serverConfig)
+				return nil
+			},
+		},
+		{
+			Name:      CmdBatch,
+			Usage:     "Builds the minified images for a list of images and saves a summary report",
+			ArgsUsage: "<IMAGE_LIST_FILE>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagBuildFlags,
+					Usage:  "build command options for all images (the options in the image list are added after them)",
+					EnvVar: "DSLIM_BATCH_BUILD_FLAGS",
+				},
+				cli.IntFlag{
+					Name:   FlagMaxParallel,
+					Value:  1,
+					Usage:  "maximum number of images built at the same time",
+					EnvVar: "DSLIM_BATCH_MAX_PARALLEL",
+				},
+				//deprecated (the old --max-parallel name)
+				cli.IntFlag{
+					Name:   FlagMaxJobs,
+					Value:  1,
+					Usage:  "deprecated, use --max-parallel",
+					EnvVar: "DSLIM_BATCH_MAX_JOBS",
+					Hidden: true,
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					fmt.Printf("[batch] missing image list file...\n\n")
+					cli.ShowCommandHelp(ctx, CmdBatch)
+					return nil
+				}
+
+				buildArgs, err := batch.SplitArgs(ctx.String(FlagBuildFlags))
+				if err == nil {
+					//the build flags are used for the jobs
+					err = server.CheckJobArgs(buildArgs)
+				}
+
+				if err != nil {
+					fmt.Printf("[batch] invalid build flags: %v\n", err)
+					return err
+				}
+
+				maxParallel := ctx.Int(FlagMaxParallel)
+				if ctx.IsSet(FlagMaxJobs) {
+					fmt.Printf("[batch] --%s is deprecated, use --%s\n", FlagMaxJobs, FlagMaxParallel)
+					if !ctx.IsSet(FlagMaxParallel) {
+						maxParallel = ctx.Int(FlagMaxJobs)
+					}
+				}
+
+				if maxParallel < 1 {
+					fmt.Printf("[batch] invalid --%s value: %v (must be 1 or more)\n", FlagMaxParallel, maxParallel)
+					return fmt.Errorf("invalid --%s value", FlagMaxParallel)
+				}
+
+				//the summary report is the main batch result
+				cmdReportLocation := ctx.GlobalString(FlagCommandReport)
+				if cmdReportLocation == "" {
+					cmdReportLocation = defaultBatchReport
+				}
+
+				commands.OnBatch(
+					cmdReportLocation,
+					ctx.GlobalString(FlagReportFormat),
+					ctx.GlobalString(FlagConsoleFormat),
+					ctx.GlobalString(FlagStatePath),
+					ctx.Args().First(),
+					buildArgs,
+					maxParallel,
+					getJobGlobalArgs(ctx))
+				return nil
+			},
+		},
+		{
+			Name:      CmdWatch,
+			Usage:     "Rebuilds the minified image when the fat image changes",
+			ArgsUsage: "<IMAGE>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagBuildFlags,
+					Usage:  "build command options (saved for the next watch runs for the image)",
+					EnvVar: "DSLIM_WATCH_BUILD_FLAGS",
+				},
+				cli.DurationFlag{
+					Name:   FlagInterval,
+					Value:  5 * time.Minute,
+					Usage:  "image check interval",
+					EnvVar: "DSLIM_WATCH_INTERVAL",
+				},
+				cli.BoolTFlag{
+					Name:   FlagPull,
+					Usage:  "pull the image before each check (disable for the local images)",
+					EnvVar: "DSLIM_WATCH_PULL",
+				},
+				cli.BoolFlag{
+					Name:   FlagOnce,
+					Usage:  "check the image once and exit",
+					EnvVar: "DSLIM_WATCH_ONCE",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					fmt.Printf("[watch] missing image ID/name...\n\n")
+					cli.ShowCommandHelp(ctx, CmdWatch)
+					return nil
+				}
+
+				imageRef := ctx.Args().First()
+				if strings.Contains(imageRef, "@") {
+					fmt.Printf("[watch] image digest references never change (use a tag): %v\n", imageRef)
+					return nil
+				}
+
+				watchConfig := &config.Watch{
+					Interval:   ctx.Duration(FlagInterval),
+					DoPull:     ctx.BoolT(FlagPull),
+					RunOnce:    ctx.Bool(FlagOnce),
+					GlobalArgs: getJobGlobalArgs(ctx),
+				}
+
+				if watchConfig.Interval <= 0 {
+					fmt.Printf("[watch] invalid check interval: %v\n", watchConfig.Interval)
+					return nil
+				}
+
+				if ctx.IsSet(FlagBuildFlags) {
+					buildArgs, err := batch.SplitArgs(ctx.String(FlagBuildFlags))
+					if err == nil {
+						//the build flags are used for the jobs
+						err = server.CheckJobArgs(buildArgs)
+					}
+
+					if err != nil {
+						fmt.Printf("[watch] invalid build flags: %v\n", err)
+						return err
+					}
+
+					watchConfig.BuildArgs = append([]string{}, buildArgs...)
+				}
+
+				clientConfig := getDockerClientConfig(ctx)
+
+				commands.OnWatch(
+					ctx.GlobalString(FlagConsoleFormat),
+					isDebug(ctx),
+					ctx.GlobalString(FlagStatePath),
+					clientConfig,
+					watchConfig,
+					imageRef)
+				return nil
+			},
+		},
+		{
+			Name:  CmdAgent,
+			Usage: "Profiles the selected pod containers on a Kubernetes node and sends the profiles to a docker-slim server",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagSelector,
+					Usage:  "pod label selector for the profiled containers (e.g., app=web)",
+					EnvVar: "DSLIM_AGENT_SELECTOR",
+				},
+				cli.StringFlag{
+					Name:   FlagNode,
+					Usage:  "Kubernetes node name (NODE_NAME or the host name by default)",
+					EnvVar: "NODE_NAME",
+				},
+				cli.DurationFlag{
+					Name:   FlagDuration,
+					Value:  10 * time.Minute,
+					Usage:  "monitoring period for each container",
+					EnvVar: "DSLIM_AGENT_DURATION",
+				},
+				cli.DurationFlag{
+					Name:   FlagInterval,
+					Value:  time.Minute,
+					Usage:  "check interval for the new pod containers",
+					EnvVar: "DSLIM_AGENT_INTERVAL",
+				},
+				cli.BoolFlag{
+					Name:   FlagOnce,
+					Usage:  "profile the running containers once and exit",
+					EnvVar: "DSLIM_AGENT_ONCE",
+				},
+				cli.StringFlag{
+					Name:   FlagRuntimeEndpoint,
+					Usage:  "CRI runtime endpoint for crictl (e.g., unix:///var/run/crio/crio.sock)",
+					EnvVar: "DSLIM_AGENT_RUNTIME_ENDPOINT",
+				},
+				cli.StringFlag{
+					Name:   FlagServer,
+					Usage:  "docker-slim server URL (the 'serve' command API)",
+					EnvVar: "DSLIM_AGENT_SERVER",
+				},
+				cli.StringFlag{
+					Name:   FlagAPIToken,
+					Usage:  "docker-slim server API token",
+					EnvVar: "DSLIM_AGENT_API_TOKEN",
+				},
+				cli.StringFlag{
+					Name:   FlagBuildFlags,
+					Usage:  "build command options for the server build jobs",
+					EnvVar: "DSLIM_AGENT_BUILD_FLAGS",
+				},
+				doKubernetesNSFlag,
+				doKubernetesContextFlag,
+				doKubeconfigFlag,
+			},
+			Action: func(ctx *cli.Context) error {
+				agentConfig := &config.Agent{
+					NodeName:        ctx.String(FlagNode),
+					Selector:        ctx.String(FlagSelector),
+					Duration:        ctx.Duration(FlagDuration),
+					Interval:        ctx.Duration(FlagInterval),
+					RunOnce:         ctx.Bool(FlagOnce),
+					RuntimeEndpoint: ctx.String(FlagRuntimeEndpoint),
+					ServerURL:       ctx.String(FlagServer),
+					ServerToken:     ctx.String(FlagAPIToken),
+				}
+
+				if agentConfig.ServerURL == "" {
+					fmt.Printf("[agent] missing docker-slim server URL...\n\n")
+					cli.ShowCommandHelp(ctx, CmdAgent)
+					return nil
+				}
+
+				if agentConfig.Selector == "" {
+					fmt.Printf("[agent] missing pod label selector...\n\n")
+					cli.ShowCommandHelp(ctx, CmdAgent)
+					return nil
+				}
+
+				if agentConfig.Duration <= 0 || agentConfig.Interval <= 0 {
+					fmt.Printf("[agent] invalid monitoring period or check interval\n")
+					return nil
+				}
+
+				if agentConfig.NodeName == "" {
+					agentConfig.NodeName, _ = os.Hostname()
+				}
+
+				buildArgs, err := batch.SplitArgs(ctx.String(FlagBuildFlags))
+				if err == nil {
+					//the build flags are used for the jobs
+					err = server.CheckJobArgs(buildArgs)
+				}
+
+				if err != nil {
+					fmt.Printf("[agent] invalid build flags: %v\n", err)
+					return err
+				}
+
+				agentConfig.BuildArgs = buildArgs
+
+				kubernetesConfig := &config.Kubernetes{
+					Namespace:  ctx.String(FlagKubernetesNS),
+					Context:    ctx.String(FlagKubernetesContext),
+					Kubeconfig: ctx.String(FlagKubeconfig),
+				}
+
+				commands.OnAgent(ctx.GlobalString(FlagConsoleFormat), kubernetesConfig, agentConfig)
+				return nil
+			},
+		},
+		{
+			Name:  CmdUpdate,
+			Usage: "Updates docker-slim (and its sensor) to the latest release",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagChannel,
+					Value:  update.ChannelStable,
+					Usage:  "release channel ('stable' or 'prerelease')",
+					EnvVar: "DSLIM_UPDATE_CHANNEL",
+				},
+				cli.BoolFlag{
+					Name:   FlagCheck,
+					Usage:  "only check if there's a newer release",
+					EnvVar: "DSLIM_UPDATE_CHECK",
+				},
+				cli.BoolFlag{
+					Name:   FlagForce,
+					Usage:  "install the latest release even if it's not newer",
+					EnvVar: "DSLIM_UPDATE_FORCE",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				commands.OnUpdate(
+					ctx.GlobalString(FlagConsoleFormat),
+					ctx.String(FlagChannel),
+					ctx.Bool(FlagCheck),
+					ctx.Bool(FlagForce))
+				return nil
+			},
+		},
+		{
+			Name:      CmdDebug,
+			Usage:     "Attaches a debugging side-car container to a running (minified) container",
+			ArgsUsage: "<CONTAINER> [COMMAND [ARG...]]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagDebugImage,
+					Value:  debug.DefaultImage,
+					Usage:  "debugging side-car image",
+					EnvVar: "DSLIM_DEBUG_IMAGE",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					fmt.Printf("[debug] missing container ID/name...\n\n")
+					cli.ShowCommandHelp(ctx, CmdDebug)
+					return nil
+				}
+
+				clientConfig := getDockerClientConfig(ctx)
+
+				commands.OnDebug(
+					ctx.GlobalString(FlagConsoleFormat),
+					isDebug(ctx),
+					clientConfig,
+					ctx.Args().First(),
+					ctx.String(FlagDebugImage),
+					ctx.Args().Tail())
+				return nil
+			},
+		},
+		{
+			Name:      CmdRun,
+			Usage:     "Runs a minified image with its generated security profiles, capabilities and port mappings",
+			ArgsUsage: "<IMAGE> [COMMAND [ARG...]]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagArtifacts,
+					Usage:  "artifacts directory with the generated security profiles (by default the artifacts from the image build are used)",
+					EnvVar: "DSLIM_RUN_ARTIFACTS",
+				},
+				cli.StringFlag{
+					Name:   FlagContainerName,
+					Usage:  "container name",
+					EnvVar: "DSLIM_RUN_CONTAINER_NAME",
+				},
+				cli.BoolFlag{
+					Name:   FlagDetach,
+					Usage:  "run the container in the background",
+					EnvVar: "DSLIM_RUN_DETACH",
+				},
+				cli.BoolFlag{
+					Name:   FlagRemove,
+					Usage:  "remove the container when it exits",
+					EnvVar: "DSLIM_RUN_RM",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					fmt.Printf("[run] missing image ID/name...\n\n")
+					cli.ShowCommandHelp(ctx, CmdRun)
+					return nil
+				}
+
+				if ctx.Bool(FlagDetach) && ctx.Bool(FlagRemove) {
+					fmt.Printf("[run] the --%s and --%s options can't be used together\n", FlagDetach, FlagRemove)
+					return nil
+				}
+
+				clientConfig := getDockerClientConfig(ctx)
+
+				commands.OnRun(
+					ctx.GlobalString(FlagConsoleFormat),
+					isDebug(ctx),
+					ctx.GlobalString(FlagStatePath),
+					clientConfig,
+					ctx.Args().First(),
+					ctx.String(FlagArtifacts),
+					ctx.String(FlagContainerName),
+					ctx.Bool(FlagDetach),
+					ctx.Bool(FlagRemove),
+					ctx.Args().Tail())
+				return nil
+			},
+		},
+		{
+			Name:      CmdMerge,
+			Usage:     "Merges the artifacts from multiple monitoring runs into one artifacts directory (for the build --use-artifacts option)",
+			ArgsUsage: "<ARTIFACTS_DIR_OR_CONTAINER_REPORT> ...",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   FlagOutput,
+					Usage:  "merged artifacts directory",
+					EnvVar: "DSLIM_MERGE_OUTPUT",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				output := ctx.String(FlagOutput)
+				if len(ctx.Args()) < 1 || output == "" {
+					fmt.Printf("[merge] missing artifact locations or output directory...\n\n")
+					cli.ShowCommandHelp(ctx, CmdMerge)
+					return nil
+				}
+
+				commands.OnMerge(CmdMerge, ctx.GlobalString(FlagConsoleFormat), output, ctx.Args())
+				return nil
+			},
+		},
+		{
+			Name:  CmdDoctor,
+			Usage: "Checks the environment (Docker, kernel features, state path and sensor) and suggests fixes",
+			Action: func(ctx *cli.Context) error {
+				commands.OnDoctor(ctx.GlobalString(FlagConsoleFormat),
+					ctx.GlobalString(FlagStatePath),
+					getDockerClientConfig(ctx))
+				return nil
+			},
+		},
+		{
+			Name:  CmdRegistry,
+			Usage: "Inspects the images in a remote registry without pulling them",
+			Subcommands: []cli.Command{
+				{
+					Name:      CmdRegistryTags,
+					Usage:     "Lists the repository tags",
+					ArgsUsage: "<REPOSITORY>",
+					Flags:     registryFlags,
+					Action: func(ctx *cli.Context) error {
+						if len(ctx.Args()) < 1 {
+							fmt.Printf("[registry tags] missing repository name...\n\n")
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnRegistryTags(ctx.GlobalString(FlagConsoleFormat), getRegistryClientConfig(ctx), ctx.Args().First())
+						return nil
+					},
+				},
+				{
+					Name:      CmdRegistryInspect,
+					Usage:     "Shows the image digest, config, layers and compressed size",
+					ArgsUsage: "<IMAGE>",
+					Flags:     append(registryFlags, registryPlatformFlag),
+					Action: func(ctx *cli.Context) error {
+						if len(ctx.Args()) < 1 {
+							fmt.Printf("[registry inspect] missing image name...\n\n")
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnRegistryInspect(ctx.GlobalString(FlagConsoleFormat), getRegistryClientConfig(ctx), ctx.Args().First())
+						return nil
+					},
+				},
+				{
+					Name:      CmdRegistryManifest,
+					Usage:     "Prints the image manifest",
+					ArgsUsage: "<IMAGE>",
+					Flags:     append(registryFlags, registryPlatformFlag),
+					Action: func(ctx *cli.Context) error {
+						if len(ctx.Args()) < 1 {
+							fmt.Printf("[registry manifest] missing image name...\n\n")
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnRegistryManifest(getRegistryClientConfig(ctx), ctx.Args().First())
+						return nil
+					},
+				},
+				{
+					Name:      CmdRegistryConfig,
+					Usage:     "Prints the image config",
+					ArgsUsage: "<IMAGE>",
+					Flags:     append(registryFlags, registryPlatformFlag),
+					Action: func(ctx *cli.Context) error {
+						if len(ctx.Args()) < 1 {
+							fmt.Printf("[registry config] missing image name...\n\n")
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnRegistryConfig(getRegistryClientConfig(ctx), ctx.Args().First())
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  CmdState,
+			Usage: "Manages the saved image state (artifacts) in the state path",
+			Subcommands: []cli.Command{
+				{
+					Name:  CmdStateList,
+					Usage: "Lists the saved image state with its size and last modification time",
+					Action: func(ctx *cli.Context) error {
+						commands.OnStateList(ctx.GlobalString(FlagConsoleFormat), ctx.GlobalString(FlagStatePath))
+						return nil
+					},
+				},
+				{
+					Name:      CmdStateRemove,
+					Usage:     "Removes the saved state for the images",
+					ArgsUsage: "<IMAGE_ID> ...",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:   FlagAll,
+							Usage:  "remove the saved state for all images",
+							EnvVar: "DSLIM_STATE_ALL",
+						},
+					},
+					Action: func(ctx *cli.Context) error {
+						doAll := ctx.Bool(FlagAll)
+						if len(ctx.Args()) < 1 && !doAll {
+							fmt.Printf("[state rm] missing image IDs...\n\n")
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnStateRemove(ctx.GlobalString(FlagConsoleFormat),
+							ctx.GlobalString(FlagStatePath),
+							ctx.Args(),
+							doAll)
+						return nil
+					},
+				},
+				{
+					Name:  CmdStatePrune,
+					Usage: "Removes the saved image state not used for some time or above the total size limit (the oldest first)",
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:   FlagOlderThan,
+							Usage:  "remove the image state not modified for the given time (e.g., 168h)",
+							EnvVar: "DSLIM_STATE_OLDER_THAN",
+						},
+						cli.StringFlag{
+							Name:   FlagMaxSize,
+							Value:  "",
+							Usage:  "remove the oldest image state until the total size is below the limit (e.g., 10GB)",
+							EnvVar: "DSLIM_STATE_MAX_SIZE",
+						},
+						cli.BoolFlag{
+							Name:   FlagDryRun,
+							Usage:  "only show the image state that would be removed",
+							EnvVar: "DSLIM_STATE_DRY_RUN",
+						},
+					},
+					Action: func(ctx *cli.Context) error {
+						policy := state.Policy{MaxAge: ctx.Duration(FlagOlderThan)}
+						if maxSize := ctx.String(FlagMaxSize); maxSize != "" {
+							size, err := humanize.ParseBytes(maxSize)
+							if err != nil {
+								fmt.Printf("[state prune] invalid max size: %v\n", err)
+								return err
+							}
+
+							policy.MaxSize = int64(size)
+						}
+
+						if policy.MaxAge <= 0 && policy.MaxSize <= 0 {
+							fmt.Printf("[state prune] missing prune policy (--%v or --%v)...\n\n", FlagOlderThan, FlagMaxSize)
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnStatePrune(ctx.GlobalString(FlagConsoleFormat),
+							ctx.GlobalString(FlagStatePath),
+							policy,
+							ctx.Bool(FlagDryRun))
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  CmdReport,
+			Usage: "Works with the saved command and container reports",
+			Subcommands: []cli.Command{
+				{
+					Name:      CmdReportDiff,
+					Usage:     "Shows what changed between two command reports (or container reports)",
+					ArgsUsage: "<OLD_REPORT> <NEW_REPORT>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:   FlagJSON,
+							Usage:  "print the differences in the JSON format",
+							EnvVar: "DSLIM_REPORT_DIFF_JSON",
+						},
+					},
+					Action: func(ctx *cli.Context) error {
+						if len(ctx.Args()) < 2 {
+							fmt.Printf("[report diff] missing report locations...\n\n")
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnReportDiff(ctx.Args().Get(0), ctx.Args().Get(1), ctx.Bool(FlagJSON))
+						return nil
+					},
+				},
+				{
+					Name:      CmdReportMerge,
+					Usage:     "Merges the artifacts from multiple monitoring runs into one artifacts directory",
+					ArgsUsage: "<ARTIFACTS_DIR_OR_CONTAINER_REPORT> ...",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:   FlagOutput,
+							Usage:  "merged artifacts directory",
+							EnvVar: "DSLIM_REPORT_MERGE_OUTPUT",
+						},
+					},
+					Action: func(ctx *cli.Context) error {
+						output := ctx.String(FlagOutput)
+						if len(ctx.Args()) < 1 || output == "" {
+							fmt.Printf("[report merge] missing artifact locations or output directory...\n\n")
+							cli.ShowSubcommandHelp(ctx)
+							return nil
+						}
+
+						commands.OnMerge("report.merge", ctx.GlobalString(FlagConsoleFormat), output, ctx.Args())
+						return nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func getContinueAfter(ctx *cli.Context) (*config.ContinueAfter, error) {
+	info := &config.ContinueAfter{
+		Mode: "enter",
+	}
+
+	doConfinueAfter := ctx.String(FlagContinueAfter)
+	switch doConfinueAfter {
+	case "enter":
+		info.Mode = "enter"
+	case "signal":
+		info.Mode = "signal"
+		info.ContinueChan = appContinueChan
+	case "probe":
+		info.Mode = "probe"
+	case "exec":
+		info.Mode = "exec"
+	case "timeout":
 		info.Mode = "timeout"
 		info.Timeout = 60
 	default:
-		if waitTime, err := strconv.Atoi(doConfinueAfter); err == nil && waitTime > 0 {
-			info.Mode = "timeout"
-			info.Timeout = time.Duration(waitTime)
+		if waitTime, err := strconv.Atoi(doConfinueAfter); err == nil && waitTime > 0 {
+			info.Mode = "timeout"
+			info.Timeout = time.Duration(waitTime)
+		}
+	}
+
+	return info, nil
+}
+
+// applyProjectConfig loads the project config file and sets the command flags that are not set
+// on the command line or with their environment variables (so the CLI flags override the file values).
+// It returns nil if there's no project config file.
+func applyProjectConfig(ctx *cli.Context) (*project.Config, error) {
+	location := ctx.String(FlagProjectConfig)
+	if location == project.NoFile {
+		return nil, nil
+	}
+
+	if location == "" {
+		if _, err := os.Stat(project.DefaultFileName); err != nil {
+			return nil, nil
+		}
+
+		location = project.DefaultFileName
+	}
+
+	projectConfig, err := project.Load(location)
+	if err != nil {
+		return nil, err
+	}
+
+	flagNames := map[string]bool{}
+	for _, flag := range ctx.Command.Flags {
+		name := strings.TrimSpace(strings.Split(flag.GetName(), ",")[0])
+		_, isSlice := flag.(cli.StringSliceFlag)
+		flagNames[name] = isSlice
+	}
+
+	for _, key := range projectConfig.Keys {
+		if key == project.KeyImage {
+			continue
+		}
+
+		isSlice, ok := flagNames[key]
+		if !ok || key == FlagProjectConfig {
+			return nil, fmt.Errorf("%s: unknown key - %s", location, key)
+		}
+
+		//the project config file comes with the repository, so it can't run the host commands
+		if key == FlagHostExecBefore || key == FlagHostExecAfter {
+			return nil, fmt.Errorf("%s: '%s' can't be set in the project config file (use the command line option)", location, key)
+		}
+
+		values := projectConfig.Values[key]
+		if !isSlice && len(values) != 1 {
+			return nil, fmt.Errorf("%s: '%s' must have one value", location, key)
+		}
+
+		if ctx.IsSet(key) {
+			log.Debugf("project config: '%s' is overridden by the command line", key)
+			continue
+		}
+
+		for _, value := range values {
+			if err := ctx.Set(key, value); err != nil {
+				return nil, fmt.Errorf("%s: invalid '%s' value - %v", location, key, err)
+			}
+		}
+	}
+
+	log.Debugf("project config: loaded %s", location)
+	return projectConfig, nil
+}
+
+// applyPreset sets the preset defaults for the flags that are not set (on the command line,
+// with their environment variables or in the project config file).
+// It returns nil if the preset is not selected.
+func applyPreset(ctx *cli.Context, projectConfig *project.Config) (*preset.Preset, error) {
+	name := ctx.String(FlagPreset)
+	if name == "" {
+		return nil, nil
+	}
+
+	stackPreset, err := preset.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	//the user defined probes replace the default preset probe
+	if stackPreset.HTTPProbe &&
+		!isFlagSet(ctx, projectConfig, FlagHttpProbe) &&
+		!isFlagSet(ctx, projectConfig, FlagHttpProbeCmd) &&
+		!isFlagSet(ctx, projectConfig, FlagHttpProbeCmdFile) {
+		if err := ctx.Set(FlagHttpProbe, "true"); err != nil {
+			return nil, err
+		}
+	}
+
+	if stackPreset.ContinueAfter != "" && !isFlagSet(ctx, projectConfig, FlagContinueAfter) {
+		if err := ctx.Set(FlagContinueAfter, stackPreset.ContinueAfter); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debugf("preset: using %s", stackPreset.Name)
+	return stackPreset, nil
+}
+
+// isFlagSet returns true if the flag is set on the command line, with its environment variable
+// or in the project config file
+func isFlagSet(ctx *cli.Context, projectConfig *project.Config, name string) bool {
+	return ctx.IsSet(name) || projectConfig.Has(name)
+}
+
+func getTimeouts(ctx *cli.Context) (*config.Timeouts, error) {
+	timeouts := &config.Timeouts{
+		ContainerStart: ctx.Duration(FlagTimeoutStart),
+		AppReady:       ctx.Duration(FlagTimeoutReady),
+		Monitor:        ctx.Duration(FlagTimeoutMonitor),
+		SensorDone:     ctx.Duration(FlagTimeoutSensorDone),
+		ArtifactCopy:   ctx.Duration(FlagTimeoutCopy),
+		ImageBuild:     ctx.Duration(FlagTimeoutBuild),
+	}
+
+	for name, value := range map[string]time.Duration{
+		FlagTimeoutStart:      timeouts.ContainerStart,
+		FlagTimeoutReady:      timeouts.AppReady,
+		FlagTimeoutMonitor:    timeouts.Monitor,
+		FlagTimeoutSensorDone: timeouts.SensorDone,
+		FlagTimeoutCopy:       timeouts.ArtifactCopy,
+		FlagTimeoutBuild:      timeouts.ImageBuild,
+	} {
+		if value < 0 {
+			return nil, fmt.Errorf("negative --%s value - %v", name, value)
+		}
+	}
+
+	return timeouts, nil
+}
+
+func getArtifactsTransfer(ctx *cli.Context) (string, error) {
+	mode := ctx.String(FlagArtifactsTransfer)
+	switch mode {
+	case container.ArtifactsTransferAuto, container.ArtifactsTransferMount, container.ArtifactsTransferAPI:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode - %v", mode)
+	}
+}
+
+func getIPCTransport(ctx *cli.Context) (string, error) {
+	mode := ctx.String(FlagIPCTransport)
+	switch mode {
+	case container.IPCTransportAuto, container.IPCTransportTCP, container.IPCTransportExec:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode - %v", mode)
+	}
+}
+
+func getSensorDelivery(ctx *cli.Context) (string, error) {
+	mode := ctx.String(FlagSensorDelivery)
+	switch mode {
+	case container.SensorDeliveryAuto, container.SensorDeliveryVolume, container.SensorDeliveryImage:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode - %v", mode)
+	}
+}
+
+// getDependencies returns the dependency containers (they are supported only with the Docker containers)
+func getDependencies(ctx *cli.Context) ([]config.Dependency, error) {
+	deps, err := parseDependencies(ctx.StringSlice(FlagDep))
+	if err != nil || len(deps) == 0 {
+		return nil, err
+	}
+
+	if ctx.Bool(FlagTargetKubernetes) || ctx.String(FlagRuntime) != runtime.Docker {
+		return nil, fmt.Errorf("--%v is supported only with the Docker runtime", FlagDep)
+	}
+
+	return deps, nil
+}
+
+func getFailOn(ctx *cli.Context) ([]string, error) {
+	var gates []string
+	for _, value := range ctx.StringSlice(FlagFailOn) {
+		for _, gate := range strings.Split(value, ",") {
+			gate = strings.TrimSpace(gate)
+			if gate == "" {
+				continue
+			}
+
+			if !findings.IsGate(gate) {
+				return nil, fmt.Errorf("unknown analyzer or rule - %v", gate)
+			}
+
+			gates = append(gates, gate)
 		}
 	}
 
-	return info, nil
+	return gates, nil
+}
+
+func getAppPaths(ctx *cli.Context) ([]string, error) {
+	var appPaths []string
+	for _, appPath := range ctx.StringSlice(FlagAppPath) {
+		if !strings.HasPrefix(appPath, "/") {
+			return nil, fmt.Errorf("not an absolute path - %v", appPath)
+		}
+
+		if _, err := path.Match(appPath, appPath); err != nil {
+			return nil, fmt.Errorf("bad path pattern - %v", appPath)
+		}
+
+		appPaths = append(appPaths, appPath)
+	}
+
+	return appPaths, nil
+}
+
+func getIncludeLocales(ctx *cli.Context) ([]string, error) {
+	var locales []string
+	for _, value := range ctx.StringSlice(FlagIncludeLocales) {
+		for _, locale := range strings.Split(value, ",") {
+			locale = strings.TrimSpace(locale)
+			if locale == "" {
+				continue
+			}
+
+			if distro.LocaleName(locale) == "" {
+				return nil, fmt.Errorf("bad locale name - %v", locale)
+			}
+
+			locales = append(locales, locale)
+		}
+	}
+
+	return locales, nil
+}
+
+func getSizeBudget(ctx *cli.Context) (*config.SizeBudget, error) {
+	maxSize := ctx.String(FlagMaxSize)
+	minReduction := ctx.String(FlagMinReduction)
+	if maxSize == "" && minReduction == "" {
+		return nil, nil
+	}
+
+	budget := &config.SizeBudget{}
+	if maxSize != "" {
+		size, err := humanize.ParseBytes(maxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return nil, fmt.Errorf("--%s must be more than 0", FlagMaxSize)
+		}
+
+		budget.MaxSize = int64(size)
+	}
+
+	if minReduction != "" {
+		reduction, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(minReduction, "%")), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if reduction <= 0 || reduction >= 100 {
+			return nil, fmt.Errorf("--%s must be between 0%% and 100%% - %v", FlagMinReduction, minReduction)
+		}
+
+		budget.MinReduction = reduction
+	}
+
+	return budget, nil
+}
+
+func getExecFile(ctx *cli.Context) (string, error) {
+	execFile := ctx.String(FlagExecFile)
+	if execFile == "" {
+		return "", nil
+	}
+
+	info, err := os.Stat(execFile)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return "", fmt.Errorf("not an executable file - %v", execFile)
+	}
+
+	return filepath.Abs(execFile)
+}
+
+func getExecRedactPattern(ctx *cli.Context) (string, error) {
+	pattern := ctx.String(FlagExecRedact)
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", err
+	}
+
+	return pattern, nil
+}
+
+func getSensorThrottle(ctx *cli.Context) (*config.SensorThrottle, error) {
+	throttle := &config.SensorThrottle{
+		PtraceSampleRate: ctx.Int(FlagSensorSampleRate),
+		EventQueueSize:   ctx.Int(FlagSensorQueueSize),
+		Nice:             ctx.Int(FlagSensorNice),
+	}
+
+	if throttle.PtraceSampleRate < 1 {
+		return nil, fmt.Errorf("--%s must be 1 or more - %v", FlagSensorSampleRate, throttle.PtraceSampleRate)
+	}
+
+	if throttle.EventQueueSize < 0 {
+		return nil, fmt.Errorf("negative --%s value - %v", FlagSensorQueueSize, throttle.EventQueueSize)
+	}
+
+	//the sensor can't raise its priority without CAP_SYS_NICE
+	if throttle.Nice < 0 || throttle.Nice > 19 {
+		return nil, fmt.Errorf("--%s must be between 0 and 19 - %v", FlagSensorNice, throttle.Nice)
+	}
+
+	return throttle, nil
+}
+
+func getSeccompMerge(ctx *cli.Context) (*config.SeccompMerge, error) {
+	merge := &config.SeccompMerge{
+		Baseline: ctx.String(FlagSeccompBaseline),
+		Mode:     ctx.String(FlagSeccompMergeMode),
+	}
+
+	if !seccomp.IsMergeMode(merge.Mode) {
+		return nil, fmt.Errorf("unknown merge mode - %v", merge.Mode)
+	}
+
+	if merge.Baseline != "" && merge.Baseline != seccomp.DockerDefaultBaseline {
+		fullPath, err := filepath.Abs(merge.Baseline)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(fullPath); err != nil {
+			return nil, err
+		}
+
+		merge.Baseline = fullPath
+	}
+
+	return merge, nil
 }
 
 func getContainerOverrides(ctx *cli.Context) (*config.ContainerOverrides, error) {
@@ -701,16 +3118,31 @@ func getHTTPProbes(ctx *cli.Context) ([]config.HTTPProbeCmd, error) {
 		httpProbeCmds = append(httpProbeCmds, moreHTTPProbeCmds...)
 	}
 
+	//the default host is for the probe commands without their own host
+	if host := ctx.String(FlagHttpProbeHost); host != "" {
+		for idx := range httpProbeCmds {
+			if httpProbeCmds[idx].Host == "" {
+				httpProbeCmds[idx].Host = host
+			}
+		}
+	}
+
 	return httpProbeCmds, nil
 }
 
 func getDockerClientConfig(ctx *cli.Context) *config.DockerClient {
 	config := &config.DockerClient{
-		UseTLS:      ctx.GlobalBool(FlagUseTLS),
-		VerifyTLS:   ctx.GlobalBool(FlagVerifyTLS),
-		TLSCertPath: ctx.GlobalString(FlagTLSCertPath),
-		Host:        ctx.GlobalString(FlagHost),
-		Env:         map[string]string{},
+		UseTLS:             ctx.GlobalBool(FlagUseTLS),
+		VerifyTLS:          ctx.GlobalBool(FlagVerifyTLS),
+		TLSCertPath:        ctx.GlobalString(FlagTLSCertPath),
+		TLSCACert:          ctx.GlobalString(FlagTLSCACert),
+		TLSCert:            ctx.GlobalString(FlagTLSCert),
+		TLSKey:             ctx.GlobalString(FlagTLSKey),
+		InsecureRegistries: ctx.GlobalStringSlice(FlagTLSInsecureReg),
+		Host:               ctx.GlobalString(FlagHost),
+		Context:            ctx.GlobalString(FlagContext),
+		UsePodman:          ctx.GlobalBool(FlagPodman),
+		Env:                map[string]string{},
 	}
 
 	getEnv := func(name string) {
@@ -726,8 +3158,314 @@ func getDockerClientConfig(ctx *cli.Context) *config.DockerClient {
 	return config
 }
 
+func getRegistryClientConfig(ctx *cli.Context) *config.RegistryClient {
+	return &config.RegistryClient{
+		Username: ctx.String(FlagRegistryUser),
+		Password: ctx.String(FlagRegistryPassword),
+		Insecure: ctx.Bool(FlagInsecureRegistry),
+		Platform: ctx.String(FlagPlatform),
+		TLS:      getDockerClientConfig(ctx),
+	}
+}
+
+// getKubernetesConfig returns nil if the target container is not running in Kubernetes
+func getKubernetesConfig(ctx *cli.Context) *config.Kubernetes {
+	if !ctx.Bool(FlagTargetKubernetes) {
+		return nil
+	}
+
+	return &config.Kubernetes{
+		Namespace:   ctx.String(FlagKubernetesNS),
+		Context:     ctx.String(FlagKubernetesContext),
+		Kubeconfig:  ctx.String(FlagKubeconfig),
+		HelperImage: ctx.String(FlagKubernetesHelper),
+	}
+}
+
+// getSwarmConfig returns nil if the target is not a running Swarm service task
+func getSwarmConfig(ctx *cli.Context) *config.Swarm {
+	if ctx.String(FlagSwarmService) == "" {
+		return nil
+	}
+
+	return &config.Swarm{
+		Service:  ctx.String(FlagSwarmService),
+		Duration: ctx.Duration(FlagSwarmDuration),
+	}
+}
+
+// getLambdaConfig returns nil if the AWS Lambda container image mode is not enabled
+func getLambdaConfig(ctx *cli.Context) *config.Lambda {
+	if !ctx.Bool(FlagLambda) {
+		return nil
+	}
+
+	return &config.Lambda{
+		EventFiles: ctx.StringSlice(FlagLambdaEvent),
+		RIEPath:    ctx.String(FlagLambdaRIE),
+	}
+}
+
+// getContainerdConfig returns nil if the target image and container are managed by Docker
+func getContainerdConfig(ctx *cli.Context) (*config.Containerd, error) {
+	switch ctx.String(FlagRuntime) {
+	case runtime.Docker:
+		return nil, nil
+	case runtime.Containerd:
+	default:
+		return nil, fmt.Errorf("unknown runtime - %v", ctx.String(FlagRuntime))
+	}
+
+	if ctx.Bool(FlagTargetKubernetes) {
+		return nil, fmt.Errorf("--%v is not supported with the containerd runtime", FlagTargetKubernetes)
+	}
+
+	return &config.Containerd{
+		Address:   ctx.String(FlagContainerdAddress),
+		Namespace: ctx.String(FlagContainerdNS),
+		CNI:       ctx.Bool(FlagContainerdCNI),
+	}, nil
+}
+
+// getK8sPatchConfig returns nil if the Kubernetes manifest patches are not generated
+func getK8sPatchConfig(ctx *cli.Context) *config.K8sPatch {
+	if !ctx.Bool(FlagK8sPatch) {
+		return nil
+	}
+
+	return &config.K8sPatch{
+		Workload:  ctx.String(FlagK8sWorkload),
+		Container: ctx.String(FlagK8sContainer),
+		Base:      ctx.String(FlagK8sBase),
+	}
+}
+
+func getMetricsConfig(ctx *cli.Context) *config.Metrics {
+	metricsConfig := &config.Metrics{
+		PushGateway: ctx.GlobalString(FlagMetricsPushGateway),
+		ListenAddr:  ctx.GlobalString(FlagMetricsAddr),
+		Linger:      time.Duration(ctx.GlobalInt(FlagMetricsLinger)) * time.Second,
+	}
+
+	//the telemetry is opt-in (the endpoint alone doesn't enable it)
+	if ctx.GlobalBool(FlagTelemetry) {
+		metricsConfig.Telemetry = &config.Telemetry{
+			Endpoint:  ctx.GlobalString(FlagTelemetryEndpoint),
+			StatePath: ctx.GlobalString(FlagStatePath),
+		}
+	}
+
+	return metricsConfig
+}
+
+func getTracingConfig(ctx *cli.Context) *config.Tracing {
+	tracingConfig := &config.Tracing{
+		Endpoint: ctx.GlobalString(FlagOtelEndpoint),
+		Headers:  map[string]string{},
+	}
+
+	for _, header := range ctx.GlobalStringSlice(FlagOtelHeaders) {
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) != 2 {
+			log.Warnf("ignoring malformed OpenTelemetry header - %v", header)
+			continue
+		}
+
+		tracingConfig.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return tracingConfig
+}
+
+// getCompletionSpec returns the commands and the flags for the shell completion scripts
+// (the commands with an image argument complete the local image names)
+func getCompletionSpec(app *cli.App) *completion.Spec {
+	return &completion.Spec{
+		Program:  AppName,
+		Flags:    getCompletionFlags(app.Flags),
+		Commands: getCompletionCommands(app.Commands),
+	}
+}
+
+func getCompletionCommands(cmds []cli.Command) []*completion.Command {
+	var all []*completion.Command
+	for _, cmd := range cmds {
+		if cmd.Hidden {
+			continue
+		}
+
+		all = append(all, &completion.Command{
+			Name:        cmd.Name,
+			Aliases:     cmd.Aliases,
+			Usage:       cmd.Usage,
+			Flags:       getCompletionFlags(cmd.Flags),
+			ImageArg:    strings.HasPrefix(cmd.ArgsUsage, "<IMAGE>"),
+			Subcommands: getCompletionCommands(cmd.Subcommands),
+		})
+	}
+
+	return all
+}
+
+func getCompletionFlags(flags []cli.Flag) []string {
+	var names []string
+	for _, flag := range flags {
+		for _, name := range strings.Split(flag.GetName(), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// getJobGlobalArgs returns the global flags the 'serve', 'batch' and 'watch' modes pass to the job commands
+// (the Docker connection, state, logging, upload, metrics push and tracing flags)
+func getMonitorHooks(ctx *cli.Context) *config.MonitorHooks {
+	return &config.MonitorHooks{
+		BeforeMonitor: strings.TrimSpace(ctx.String(FlagHostExecBefore)),
+		AfterMonitor:  strings.TrimSpace(ctx.String(FlagHostExecAfter)),
+	}
+}
+
+// getSidecars returns the sidecar images (the sidecar builds get the same global options)
+func getSidecars(ctx *cli.Context) (*config.Sidecars, error) {
+	var images []string
+	for _, image := range ctx.StringSlice(FlagSidecar) {
+		if image = strings.TrimSpace(image); image != "" {
+			images = append(images, image)
+		}
+	}
+
+	if len(images) == 0 {
+		return nil, nil
+	}
+
+	//the target container sensor and each sidecar sensor need their own IPC ports
+	if len(images) >= channel.MaxSensors {
+		return nil, fmt.Errorf("too many sidecars (max %v)", channel.MaxSensors-1)
+	}
+
+	//the build option environment variables are for the target build
+	buildEnvVars := map[string]bool{}
+	for _, flag := range ctx.Command.Flags {
+		if field := reflect.ValueOf(flag).FieldByName("EnvVar"); field.IsValid() && field.Kind() == reflect.String {
+			for _, name := range strings.Split(field.String(), ",") {
+				buildEnvVars[strings.TrimSpace(name)] = true
+			}
+		}
+	}
+
+	var env []string
+	for _, item := range os.Environ() {
+		if !buildEnvVars[strings.SplitN(item, "=", 2)[0]] {
+			env = append(env, item)
+		}
+	}
+
+	return &config.Sidecars{
+		Images:     images,
+		GlobalArgs: getJobGlobalArgs(ctx),
+		Env:        env,
+	}, nil
+}
+
+func getJobGlobalArgs(ctx *cli.Context) []string {
+	var args []string
+	for _, name := range []string{
+		FlagHost,
+		FlagContext,
+		FlagTLSCertPath,
+		FlagTLSCACert,
+		FlagTLSCert,
+		FlagTLSKey,
+		FlagStatePath,
+		FlagStateKeyFile,
+		FlagAuditLog,
+		FlagLogLevel,
+		FlagLogFormat,
+		FlagReportUpload,
+		FlagMetricsPushGateway,
+		FlagOtelEndpoint,
+		FlagTelemetryEndpoint,
+	} {
+		if value := ctx.GlobalString(name); value != "" {
+			args = append(args, fmt.Sprintf("--%s=%s", name, value))
+		}
+	}
+
+	for _, name := range []string{FlagUseTLS, FlagVerifyTLS, FlagPodman, FlagTelemetry} {
+		args = append(args, fmt.Sprintf("--%s=%v", name, ctx.GlobalBool(name)))
+	}
+
+	for _, header := range ctx.GlobalStringSlice(FlagOtelHeaders) {
+		args = append(args, fmt.Sprintf("--%s=%s", FlagOtelHeaders, header))
+	}
+
+	for _, host := range ctx.GlobalStringSlice(FlagTLSInsecureReg) {
+		args = append(args, fmt.Sprintf("--%s=%s", FlagTLSInsecureReg, host))
+	}
+
+	if verbosity := ctx.GlobalInt(FlagVerbosity); verbosity > 0 {
+		args = append(args, fmt.Sprintf("--%s=%d", FlagVerbosity, verbosity))
+	}
+
+	return args
+}
+
+// isDebug returns true if the debug mode is enabled (with --debug or with the highest verbosity level)
+func isDebug(ctx *cli.Context) bool {
+	return ctx.GlobalBool(FlagDebug) || ctx.GlobalInt(FlagVerbosity) >= 3
+}
+
+// expandVerbosityFlags replaces the -v, -vv and -vvv shortcuts with the global --verbosity flag
+// (so the shortcuts work before and after the command name)
+func expandVerbosityFlags(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+
+	verbosity := 0
+	expanded := []string{args[0]}
+	for idx := 1; idx < len(args); idx++ {
+		arg := args[idx]
+		if arg == "--" {
+			expanded = append(expanded, args[idx:]...)
+			break
+		}
+
+		if len(arg) > 1 && len(arg) <= 4 && strings.Trim(arg[1:], "v") == "" && arg[0] == '-' {
+			verbosity = len(arg) - 1
+			continue
+		}
+
+		expanded = append(expanded, arg)
+	}
+
+	if verbosity == 0 {
+		return expanded
+	}
+
+	return append([]string{expanded[0], fmt.Sprintf("--%s=%d", FlagVerbosity, verbosity)}, expanded[1:]...)
+}
+
 func runCli() {
-	if err := app.Run(os.Args); err != nil {
+	args := os.Args
+	if isPluginMetadataCmd(args) {
+		printPluginMetadata()
+		return
+	}
+
+	if isPluginRun() {
+		app.Name = "docker " + PluginName
+		app.HelpName = app.Name
+		args = pluginArgs(args)
+	}
+
+	if err := app.Run(expandVerbosityFlags(args)); err != nil {
 		log.Fatal(err)
 	}
+
+	audit.Close(errutils.ExitCodeOk)
 }
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/agent"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/kubernetes"
+	"github.com/docker-slim/docker-slim/internal/app/master/server"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const agentTmpDirPattern = "docker-slim-agent-"
+
+type agentResult struct {
+	target *agent.Target
+	files  int
+	job    *server.Job
+	err    error
+}
+
+// OnAgent implements the 'agent' docker-slim command
+func OnAgent(consoleFormat string, kubernetesConfig *config.Kubernetes, agentConfig *config.Agent) {
+	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "agent"})
+
+	printer := console.New("agent", consoleFormat)
+	printer.State("started")
+
+	k8sClient, err := kubernetes.New(kubernetesConfig)
+	errutils.FailOn(err)
+
+	criClient, err := agent.NewCRIClient(agentConfig.RuntimeEndpoint)
+	errutils.FailOn(err)
+
+	printer.Info("params",
+		"node", agentConfig.NodeName,
+		"selector", agentConfig.Selector,
+		"duration", agentConfig.Duration,
+		"server", agentConfig.ServerURL,
+		"build.flags", strings.Join(agentConfig.BuildArgs, " "))
+
+	//the containers are profiled only once (the failed profiles are retried on the next check)
+	profiled := map[string]bool{}
+	for {
+		targets, err := agent.FindTargets(k8sClient, criClient, agentConfig.Selector, agentConfig.NodeName)
+		if err != nil {
+			printer.Info("targets.error", "error", err)
+		}
+
+		resultChan := make(chan *agentResult)
+		var count int
+		for _, target := range targets {
+			if profiled[target.ContainerID] {
+				continue
+			}
+
+			printer.Info("target",
+				"pod", target.Namespace+"/"+target.Pod,
+				"container", target.Container,
+				"image", target.Image,
+				"pid", target.Pid)
+
+			count++
+			go func(target *agent.Target) {
+				resultChan <- profileTarget(target, agentConfig)
+			}(target)
+		}
+
+		for idx := 0; idx < count; idx++ {
+			result := <-resultChan
+			if result.err != nil {
+				printer.Info("profile.error",
+					"pod", result.target.Namespace+"/"+result.target.Pod,
+					"container", result.target.Container,
+					"error", result.err)
+				continue
+			}
+
+			profiled[result.target.ContainerID] = true
+			printer.Info("profile",
+				"pod", result.target.Namespace+"/"+result.target.Pod,
+				"container", result.target.Container,
+				"files", result.files,
+				"job", result.job.ID)
+		}
+
+		if agentConfig.RunOnce {
+			break
+		}
+
+		logger.Debugf("next pod container check in %v", agentConfig.Interval)
+		time.Sleep(agentConfig.Interval)
+	}
+
+	printer.State("done")
+}
+
+// profileTarget monitors the container and sends the profile artifacts to the docker-slim server
+// (the local artifacts are removed after they are sent)
+func profileTarget(target *agent.Target, agentConfig *config.Agent) *agentResult {
+	result := &agentResult{target: target}
+
+	location, err := ioutil.TempDir("", agentTmpDirPattern)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer os.RemoveAll(location)
+
+	creport, err := agent.Profile(target, agentConfig.Duration, location)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	result.files = len(creport.Image.Files)
+	result.job, result.err = agent.Upload(agentConfig.ServerURL,
+		agentConfig.ServerToken,
+		target,
+		agentConfig.NodeName,
+		agentConfig.BuildArgs,
+		location)
+	return result
+}
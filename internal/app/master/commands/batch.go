@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"github.com/docker-slim/docker-slim/internal/app/master/batch"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/server"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	"github.com/dustin/go-humanize"
+)
+
+// OnBatch implements the 'batch' docker-slim command
+func OnBatch(
+	cmdReportLocation string,
+	cmdReportFormat string,
+	consoleFormat string,
+	statePath string,
+	listLocation string,
+	buildArgs []string,
+	maxParallel int,
+	globalArgs []string) {
+	cmdReport := report.NewBatchCommand(cmdReportLocation, cmdReportFormat)
+	cmdReport.State = report.CmdStateStarted
+
+	printer := console.New(string(report.CmdTypeBatch), consoleFormat)
+	printer.State("started")
+
+	images, err := batch.ParseList(listLocation)
+	errutils.FailOn(err)
+
+	printer.Info("params",
+		"list", listLocation,
+		"images", len(images),
+		"max.parallel", maxParallel)
+
+	runner, err := server.NewJobRunner(statePath, globalArgs)
+	errutils.FailOn(err)
+
+	runner.Start(maxParallel)
+
+	var jobIDs []string
+	for _, image := range images {
+		args := append(append([]string{}, buildArgs...), image.Args...)
+		job, err := runner.Queue(&server.JobRequest{
+			Command: server.CommandBuild,
+			Image:   image.Name,
+			Args:    args,
+		})
+		errutils.FailOn(err)
+
+		printer.Info("batch.image.queued", "image", image.Name, "job", job.ID)
+		jobIDs = append(jobIDs, job.ID)
+	}
+
+	runner.Wait()
+	printer.State("completed")
+
+	for idx, id := range jobIDs {
+		job := runner.Job(id)
+		result := report.BatchImageResult{
+			Image:    images[idx].Name,
+			Args:     images[idx].Args,
+			JobID:    job.ID,
+			State:    job.State,
+			ExitCode: job.ExitCode,
+			Error:    job.Error,
+		}
+
+		if info, err := report.LoadCommandReport(runner.ReportPath(job.ID)); err == nil {
+			if buildReport, ok := info.(*report.BuildCommand); ok {
+				result.ReportLocation = runner.ReportPath(job.ID)
+				result.OriginalImageSize = buildReport.OriginalImageSize
+				result.OriginalImageSizeHuman = buildReport.OriginalImageSizeHuman
+				result.MinifiedImage = buildReport.MinifiedImage
+				result.MinifiedImageSize = buildReport.MinifiedImageSize
+				result.MinifiedImageSizeHuman = buildReport.MinifiedImageSizeHuman
+				result.MinifiedBy = buildReport.MinifiedBy
+			}
+		}
+
+		cmdReport.ImageCount++
+		if job.State == server.JobStateDone {
+			cmdReport.DoneCount++
+			cmdReport.OriginalImageSize += result.OriginalImageSize
+			cmdReport.MinifiedImageSize += result.MinifiedImageSize
+		} else {
+			cmdReport.FailedCount++
+		}
+
+		cmdReport.Images = append(cmdReport.Images, result)
+
+		printer.Info("batch.image",
+			"image", result.Image,
+			"state", result.State,
+			"exit.code", result.ExitCode,
+			"minified.image", result.MinifiedImage,
+			"size.original", result.OriginalImageSizeHuman,
+			"size.minified", result.MinifiedImageSizeHuman,
+			"job", result.JobID)
+	}
+
+	if cmdReport.OriginalImageSize > cmdReport.MinifiedImageSize {
+		cmdReport.SavedSize = cmdReport.OriginalImageSize - cmdReport.MinifiedImageSize
+	}
+
+	cmdReport.OriginalImageSizeHuman = humanize.Bytes(uint64(cmdReport.OriginalImageSize))
+	cmdReport.MinifiedImageSizeHuman = humanize.Bytes(uint64(cmdReport.MinifiedImageSize))
+	cmdReport.SavedSizeHuman = humanize.Bytes(uint64(cmdReport.SavedSize))
+
+	printer.Info("results",
+		"images", cmdReport.ImageCount,
+		"done", cmdReport.DoneCount,
+		"failed", cmdReport.FailedCount,
+		"size.original", cmdReport.OriginalImageSizeHuman,
+		"size.minified", cmdReport.MinifiedImageSizeHuman,
+		"size.saved", cmdReport.SavedSizeHuman)
+
+	printer.State("done")
+	cmdReport.State = report.CmdStateDone
+	cmdReport.Save()
+
+	if cmdReport.FailedCount > 0 {
+		errutils.Exit(errutils.ExitCodeError)
+	}
+}
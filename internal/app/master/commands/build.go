@@ -1,212 +1,725 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/agent"
+	"github.com/docker-slim/docker-slim/internal/app/master/artifacts"
 	"github.com/docker-slim/docker-slim/internal/app/master/builder"
+	"github.com/docker-slim/docker-slim/internal/app/master/cache"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/containerd"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerimage"
+	"github.com/docker-slim/docker-slim/internal/app/master/findings"
+	"github.com/docker-slim/docker-slim/internal/app/master/incremental"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/exec"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/http"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/lambda"
+	"github.com/docker-slim/docker-slim/internal/app/master/metrics"
+	"github.com/docker-slim/docker-slim/internal/app/master/review"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/dockerrun"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/k8s"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/internal/app/master/swarm"
+	"github.com/docker-slim/docker-slim/internal/app/master/tracing"
+	"github.com/docker-slim/docker-slim/internal/app/master/verifier"
 	"github.com/docker-slim/docker-slim/internal/app/master/version"
+	"github.com/docker-slim/docker-slim/pkg/distro"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
 	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
 	v "github.com/docker-slim/docker-slim/pkg/version"
 
 	log "github.com/Sirupsen/logrus"
+	docker "github.com/cloudimmunity/go-dockerclientx"
 	"github.com/dustin/go-humanize"
 )
 
+// BuildOptions are the build command options
+type BuildOptions struct {
+	CmdReportLocation string
+	CmdReportFormat   string
+	CmdReportUpload   string
+	ConsoleFormat     string
+	Debug             bool
+	StatePath         string
+	ClientConfig      *config.DockerClient
+	MetricsConfig     *config.Metrics
+	TracingConfig     *config.Tracing
+	ImageRef          string
+	CustomImageTag    string
+	HTTPProbe         bool
+	HTTPProbeCmds     []config.HTTPProbeCmd
+	RmFileArtifacts   bool
+	ShowContainerLogs bool
+	ShowBuildLogs     bool
+	ImageOverrides    map[string]bool
+	Overrides         *config.ContainerOverrides
+	Links             []string
+	EtcHostsMaps      []string
+	DNSServers        []string
+	DNSSearchDomains  []string
+	ContainerName     string
+	ContainerLabels   map[string]string
+	VolumeMounts      map[string]config.VolumeMount
+	ExcludePaths      map[string]bool
+	IncludePaths      map[string]bool
+	ContinueAfter     *config.ContinueAfter
+	TargetRestarts    int
+	UseArtifacts      []string
+	FromReport        string
+	Review            bool
+	SeccompMerge      *config.SeccompMerge
+	AnnotateSeccomp   bool
+	VerifyProfiles    bool
+	GzipRemovedFiles  bool
+	DryRun            bool
+	AnalysisCache     bool
+	CacheArtifacts    bool
+	Incremental       bool
+	KubernetesConfig  *config.Kubernetes
+	K8sPatch          *config.K8sPatch
+	ContainerdConfig  *config.Containerd
+	LambdaConfig      *config.Lambda
+	SwarmConfig       *config.Swarm
+	Timeouts          *config.Timeouts
+	ArtifactsTransfer string
+	CompressArtifacts bool
+	SensorThrottle    *config.SensorThrottle
+	IPCTransport      string
+	SensorDelivery    string
+	AutoExpose        bool
+	ExecRedactPattern string
+	Dependencies      []config.Dependency
+	ExecFile          string
+	SizeBudget        *config.SizeBudget
+	FailOn            []string
+	VerifyImage       bool
+	IncludeDistro     bool
+	IncludeTzdata     bool
+	IncludeLocales    []string
+	OutputBase        string
+	LayerMode         string
+	AppPaths          []string
+	Instrument        bool
+	ArtifactStore     string
+	SensorPort        int
+	Sidecars          *config.Sidecars
+	Hooks             *config.MonitorHooks
+}
+
 // OnBuild implements the 'build' docker-slim command
-func OnBuild(
-	cmdReportLocation string,
-	doDebug bool,
-	statePath string,
-	clientConfig *config.DockerClient,
-	imageRef string,
-	customImageTag string,
-	doHTTPProbe bool,
-	httpProbeCmds []config.HTTPProbeCmd,
-	doRmFileArtifacts bool,
-	doShowContainerLogs bool,
-	doShowBuildLogs bool,
-	imageOverrides map[string]bool,
-	overrides *config.ContainerOverrides,
-	links []string,
-	etcHostsMaps []string,
-	dnsServers []string,
-	dnsSearchDomains []string,
-	volumeMounts map[string]config.VolumeMount,
-	excludePaths map[string]bool,
-	includePaths map[string]bool,
-	continueAfter *config.ContinueAfter) {
+func OnBuild(opts *BuildOptions) {
 	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "build"})
 
-	cmdReport := report.NewBuildCommand(cmdReportLocation)
+	cmdReport := report.NewBuildCommand(opts.CmdReportLocation, opts.CmdReportFormat)
 	cmdReport.State = report.CmdStateStarted
-	cmdReport.OriginalImage = imageRef
+	cmdReport.OriginalImage = opts.ImageRef
 
-	fmt.Println("docker-slim[build]: state=started")
-	fmt.Printf("docker-slim[build]: info=params target=%v continue.mode=%v\n", imageRef, continueAfter.Mode)
+	printer := console.New(string(report.CmdTypeBuild), opts.ConsoleFormat)
+	runMetrics := metrics.NewRun(string(report.CmdTypeBuild), opts.ImageRef, opts.MetricsConfig, printer)
+	runTracer := tracing.NewTracer(string(report.CmdTypeBuild), opts.ImageRef, opts.TracingConfig)
+
+	printer.State("started")
+	if runTracer.Enabled() {
+		printer.Info("tracing", "trace.id", runTracer.TraceID())
+	}
+	printer.Info("params", "target", opts.ImageRef, "continue.mode", opts.ContinueAfter.Mode)
 
 	logger.Infof("image=%v http-probe=%v remove-file-artifacts=%v image-overrides=%+v entrypoint=%+v (%v) cmd=%+v (%v) workdir='%v' env=%+v expose=%+v",
-		imageRef, doHTTPProbe, doRmFileArtifacts,
-		imageOverrides,
-		overrides.Entrypoint, overrides.ClearEntrypoint, overrides.Cmd, overrides.ClearCmd,
-		overrides.Workdir, overrides.Env, overrides.ExposedPorts)
+		opts.ImageRef, opts.HTTPProbe, opts.RmFileArtifacts,
+		opts.ImageOverrides,
+		opts.Overrides.Entrypoint, opts.Overrides.ClearEntrypoint, opts.Overrides.Cmd, opts.Overrides.ClearCmd,
+		opts.Overrides.Workdir, opts.Overrides.Env, opts.Overrides.ExposedPorts)
 
-	client := dockerclient.New(clientConfig)
+	client, closeClient := dockerclient.New(opts.ClientConfig)
+	defer closeClient()
+	var ctrClient *containerd.Client
+	if opts.ContainerdConfig != nil {
+		ctrClient = connectContainerd(opts.ContainerdConfig)
+	} else {
+		err := client.Ping()
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 
-	if doDebug {
-		version.Print(client)
+		if opts.Debug {
+			version.Print(client)
+		}
 	}
 
-	imageInspector, err := image.NewInspector(client, imageRef)
+	imageInspector, err := image.NewInspector(client, opts.ImageRef)
 	errutils.FailOn(err)
 
+	if ctrClient != nil {
+		useContainerdImages(printer, ctrClient, imageInspector)
+	}
+
 	if imageInspector.NoImage() {
-		fmt.Println("docker-slim[build]: target image not found -", imageRef)
-		fmt.Println("docker-slim[build]: state=exited")
-		return
+		printer.Info("target.image.error", "status", "not.found", "image", opts.ImageRef)
+		printer.State("exited")
+		runTracer.Finish(report.CmdStateExited)
+		runMetrics.Finish(report.CmdStateExited)
+		errutils.Exit(errutils.ExitCodeImageNotFound)
 	}
 
-	fmt.Println("docker-slim[build]: state=inspecting.image")
+	printer.State("inspecting.image")
+	runMetrics.Phase("inspecting.image")
+	runTracer.Phase("inspecting.image")
 
 	logger.Info("inspecting 'fat' image metadata...")
 	err = imageInspector.Inspect()
 	errutils.FailOn(err)
 
-	localVolumePath, artifactLocation := fsutils.PrepareStateDirs(statePath, imageInspector.ImageInfo.ID)
+	if opts.ArtifactStore != "" {
+		//the store must have the artifacts for the same image (checked before the target container is started)
+		_, err := artifacts.CheckStore(opts.ArtifactStore, imageInspector.ImageInfo.ID)
+		errutils.FailOn(err)
+	}
+
+	if opts.SwarmConfig != nil && !opts.DryRun {
+		//the running service task is monitored and the minified image is built from its artifacts
+		swarmLocation := profileSwarmTask(printer, client, imageInspector.ImageInfo.ID, opts.SwarmConfig)
+		opts.FromReport = swarmLocation
+		defer os.RemoveAll(swarmLocation)
+
+		//the failure functions exit without running the deferred calls
+		errutils.OnExit(func(int) {
+			os.RemoveAll(swarmLocation)
+		})
+	}
+
+	localVolumePath, artifactLocation := fsutils.StateDirs(opts.StatePath, imageInspector.ImageInfo.ID)
+	if !opts.DryRun {
+		unlockState := lockStateDir(printer, localVolumePath)
+		defer unlockState()
+
+		sealState := unsealStateDir(printer, artifactLocation)
+		defer sealState()
+	}
+
+	if opts.CacheArtifacts && opts.FromReport == "" &&
+		fsutils.Exists(filepath.Join(artifactLocation, report.DefaultContainerReportFileName)) {
+		//the image didn't change (the image state is keyed by the image ID),
+		//so the artifacts from the last monitoring run for the image are reused
+		printer.Info("cache", "artifacts", artifactLocation)
+		opts.FromReport = artifactLocation
+	}
+
+	if !opts.DryRun && !opts.Instrument && (opts.FromReport == "" || !isArtifactLocation(opts.FromReport, artifactLocation)) {
+		//the saved artifacts in the image state location are reused as-is (they are not removed)
+		localVolumePath, artifactLocation = fsutils.PrepareStateDirs(opts.StatePath, imageInspector.ImageInfo.ID)
+	}
 	imageInspector.ArtifactLocation = artifactLocation
+	if opts.AnalysisCache {
+		imageInspector.AnalysisCache = cache.New(localVolumePath)
+	}
 
-	fmt.Printf("docker-slim[build]: info=image id=%v size.bytes=%v size.human=%v\n",
-		imageInspector.ImageInfo.ID,
-		imageInspector.ImageInfo.VirtualSize,
-		humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
+	printer.Info("image",
+		"id", imageInspector.ImageInfo.ID,
+		"size.bytes", imageInspector.ImageInfo.VirtualSize,
+		"size.human", humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
 
-	logger.Info("processing 'fat' image info...")
-	err = imageInspector.ProcessCollectedData()
-	errutils.FailOn(err)
+	if !opts.DryRun && !opts.Instrument {
+		logger.Info("processing 'fat' image info...")
+		err = imageInspector.ProcessCollectedData()
+		errutils.FailOn(err)
+	}
 
-	fmt.Println("docker-slim[build]: state=inspecting.container")
-
-	containerInspector, err := container.NewInspector(client,
-		imageInspector,
-		localVolumePath,
-		overrides,
-		links,
-		etcHostsMaps,
-		dnsServers,
-		dnsSearchDomains,
-		doShowContainerLogs,
-		volumeMounts,
-		excludePaths,
-		includePaths,
-		doDebug)
-	errutils.FailOn(err)
+	var imageInventory *dockerimage.Inventory
+	var incrementalBase *incremental.Base
+	var artifactFilter func(filePath string) bool
+	if opts.Incremental && opts.FromReport == "" && !opts.DryRun {
+		imageInventory, incrementalBase = findIncrementalBase(printer, opts.StatePath, imageInspector)
+		if incrementalBase != nil {
+			artifactFilter = incrementalBase.Unchanged(imageInventory)
+			if incrementalBase.SkipMonitoring {
+				//the app can't observe the changed layers, so the base artifacts are enough
+				opts.FromReport = incrementalBase.ArtifactLocation
+			}
+		}
+	}
 
-	logger.Info("starting instrumented 'fat' container...")
-	err = containerInspector.RunContainer()
+	if opts.LambdaConfig != nil && opts.FromReport == "" {
+		prepareLambdaTarget(printer, imageInspector.ImageInfo, opts.LambdaConfig, opts.Overrides, opts.VolumeMounts, opts.ExcludePaths, opts.IncludePaths)
+	}
+
+	containerInspector, err := container.NewInspector(client, imageInspector, &container.InspectorOptions{
+		LocalVolumePath:   localVolumePath,
+		Overrides:         opts.Overrides,
+		Links:             opts.Links,
+		EtcHostsMaps:      opts.EtcHostsMaps,
+		DNSServers:        opts.DNSServers,
+		DNSSearchDomains:  opts.DNSSearchDomains,
+		ContainerName:     opts.ContainerName,
+		ContainerLabels:   opts.ContainerLabels,
+		ShowContainerLogs: opts.ShowContainerLogs,
+		VolumeMounts:      opts.VolumeMounts,
+		ExcludePaths:      opts.ExcludePaths,
+		IncludePaths:      opts.IncludePaths,
+		SeccompMerge:      opts.SeccompMerge,
+		AnnotateSeccomp:   opts.AnnotateSeccomp,
+		Debug:             opts.Debug,
+		Kubernetes:        opts.KubernetesConfig,
+		ContainerClient:   containerClient(ctrClient),
+		Timeouts:          opts.Timeouts,
+		ArtifactsTransfer: opts.ArtifactsTransfer,
+		CompressArtifacts: opts.CompressArtifacts,
+		SensorThrottle:    opts.SensorThrottle,
+		IPCTransport:      opts.IPCTransport,
+		SensorDelivery:    opts.SensorDelivery,
+		StatePath:         opts.StatePath,
+		ExecRedactPattern: opts.ExecRedactPattern,
+		Dependencies:      opts.Dependencies,
+		IncludeDistro:     opts.IncludeDistro,
+		IncludeTzdata:     opts.IncludeTzdata,
+		IncludeLocales:    opts.IncludeLocales,
+		SensorPort:        opts.SensorPort,
+	})
 	errutils.FailOn(err)
 
-	logger.Info("watching container monitor...")
+	if opts.Instrument {
+		//the image with the sensor is built instead of the minified image (the monitoring happens where it runs)
+		if opts.CustomImageTag == "" {
+			opts.CustomImageTag = imageInspector.InstrumentedImageRepo
+		}
 
-	if "probe" == continueAfter.Mode {
-		doHTTPProbe = true
-	}
+		printer.State("building", "message", "building instrumented image")
+		runMetrics.Phase("building")
+		runTracer.Phase("building")
 
-	if doHTTPProbe {
-		probe, err := http.NewCustomProbe(containerInspector, httpProbeCmds, true, "docker-slim[build]:")
+		err = containerInspector.BuildInstrumentedImage(opts.CustomImageTag)
 		errutils.FailOn(err)
-		probe.Start()
-		continueAfter.ContinueChan = probe.DoneChan()
-	}
-
-	switch continueAfter.Mode {
-	case "enter":
-		fmt.Println("docker-slim[build]: info=prompt message='press <enter> when you are done using the container'")
-		creader := bufio.NewReader(os.Stdin)
-		_, _, _ = creader.ReadLine()
-	case "signal":
-		fmt.Println("docker-slim[build]: info=prompt message='send SIGUSR1 when you are done using the container'")
-		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[build]: info=event message='got SIGUSR1'")
-	case "timeout":
-		fmt.Printf("docker-slim[build]: info=prompt message='waiting for the target container (%v seconds)'\n", int(continueAfter.Timeout))
-		<-time.After(time.Second * continueAfter.Timeout)
-		fmt.Printf("docker-slim[build]: info=event message='done waiting for the target container'")
-	case "probe":
-		fmt.Println("docker-slim[build]: info=prompt message='waiting for the HTTP probe to finish'")
-		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[build]: info=event message='HTTP probe is done'")
-	default:
-		errutils.Fail("unknown continue-after mode")
-	}
-
-	containerInspector.FinishMonitoring()
-
-	logger.Info("shutting down 'fat' container...")
-	err = containerInspector.ShutdownContainer()
-	errutils.WarnOn(err)
 
-	fmt.Println("docker-slim[build]: state=processing")
+		cmdReport.InstrumentedImage = opts.CustomImageTag
+		printer.Info("results",
+			"instrumented.image", opts.CustomImageTag,
+			"artifacts", container.SensorArtifactsPath,
+			"message", fmt.Sprintf("run it with the %v directory in a volume and build with --from-report using the saved artifacts", container.SensorArtifactsPath))
+
+		printer.State("done")
+		cmdReport.State = report.CmdStateDone
+		cmdReport.Save()
+		printer.Result(cmdReport.InstrumentedImage)
+		runTracer.Finish(cmdReport.State)
+		runMetrics.Finish(cmdReport.State)
+		return
+	}
+
+	if opts.DryRun {
+		//nothing is created: no state directories, no containers and no images
+		if opts.CustomImageTag == "" {
+			opts.CustomImageTag = imageInspector.SlimImageRepo
+		}
+
+		printBuildPlan(printer,
+			containerInspector,
+			opts.CustomImageTag,
+			artifactLocation,
+			opts.HTTPProbe,
+			opts.HTTPProbeCmds,
+			opts.ExecFile,
+			opts.ContinueAfter,
+			opts.TargetRestarts,
+			opts.UseArtifacts,
+			opts.FromReport,
+			opts.SwarmConfig,
+			opts.SizeBudget,
+			builder.OutputBaseImage(opts.OutputBase),
+			opts.LayerMode)
 
-	if !containerInspector.HasCollectedData() {
-		imageInspector.ShowFatImageDockerInstructions()
-		fmt.Printf("docker-slim[build]: info=results status='no data collected (no minified image generated). (version: %v)'\n",
-			v.Current())
-		fmt.Println("docker-slim[build]: state=exited")
+		printer.State("done")
+		runTracer.Finish(report.CmdStateCompleted)
+		runMetrics.Finish(report.CmdStateCompleted)
 		return
 	}
 
+	var probe *http.CustomProbe
+	if opts.FromReport != "" {
+		//offline build: no container and no sensor, the image is built from the saved monitoring artifacts
+		printer.State("processing")
+		runMetrics.Phase("processing")
+		runTracer.Phase("processing")
+
+		logger.Info("loading saved monitoring artifacts...")
+		loadResult, err := artifacts.MergeFiltered(artifactLocation, []string{opts.FromReport}, artifactFilter)
+		if err != nil {
+			printer.Info("artifacts.error", "source", opts.FromReport, "message", err.Error())
+			printer.State("exited")
+			runTracer.Finish(report.CmdStateExited)
+			runMetrics.Finish(report.CmdStateExited)
+			errutils.Exit(errutils.ExitCodeNoData)
+		}
+
+		printer.Info("artifacts.loaded",
+			"source", opts.FromReport,
+			"files", loadResult.FileCount,
+			"copied", loadResult.CopiedCount)
+	} else {
+		printer.State("inspecting.container")
+		runMetrics.Phase("inspecting.container")
+		runTracer.Phase("inspecting.container")
+
+		logger.Info("starting instrumented 'fat' container...")
+		err = containerInspector.RunContainer()
+		failOnContainerError(err)
+
+		cmdReport.ContainerName = containerInspector.ContainerName
+		printer.Info("container",
+			"name", containerInspector.ContainerName,
+			"id", containerInspector.ContainerID)
+
+		showSensorEvents(printer, containerInspector)
+
+		sidecarRuns := startSidecars(printer, opts.Sidecars, containerInspector.ContainerID, artifactLocation)
+
+		if hookReport := runHook(printer, containerInspector, opts.Hooks, exec.HookBeforeMonitor, artifactLocation); hookReport != nil {
+			cmdReport.Hooks = append(cmdReport.Hooks, *hookReport)
+			if !hookReport.Passed {
+				//no probes if the target environment is not ready (the monitoring results would be incomplete)
+				stopSidecars(sidecarRuns)
+				errutils.WarnOn(containerInspector.FinishMonitoring())
+				cmdReport.Sidecars = waitForSidecars(printer, sidecarRuns)
+				errutils.WarnOn(containerInspector.ShutdownContainer())
+
+				printer.Info("hook",
+					"stage", hookReport.Stage,
+					"status", "failed",
+					"exit.code", hookReport.ExitCode,
+					"message", hookReport.Error)
+				printer.State("error", "message", "before-monitor hook failed")
+				cmdReport.State = report.CmdStateError
+				cmdReport.Error = "before-monitor hook failed"
+				cmdReport.Save()
+				runTracer.Finish(report.CmdStateError)
+				runMetrics.Finish(report.CmdStateError)
+				errutils.FailCode("before-monitor hook failed", errutils.ExitCodeHookFailure)
+			}
+		}
+
+		logger.Info("watching container monitor...")
+		runMetrics.Phase("monitoring")
+		runTracer.Phase("monitoring")
+
+		if "probe" == opts.ContinueAfter.Mode {
+			opts.HTTPProbe = true
+		}
+
+		if opts.HTTPProbe {
+			probe, err = http.NewCustomProbe(containerInspector, opts.HTTPProbeCmds, true, printer)
+			errutils.FailOnCode(err, errutils.ExitCodeProbeFailure)
+			probe.Start()
+			opts.ContinueAfter.ContinueChan = probe.DoneChan()
+		}
+
+		var testProbe *exec.TestProbe
+		if opts.ExecFile != "" {
+			testProbe, err = exec.NewTestProbe(containerInspector, opts.ExecFile, true, printer)
+			errutils.FailOnCode(err, errutils.ExitCodeTestFailure)
+			testProbe.Start()
+			if "exec" == opts.ContinueAfter.Mode {
+				opts.ContinueAfter.ContinueChan = testProbe.DoneChan()
+			}
+		}
+
+		deadline := monitorDeadline(opts.Timeouts.Monitor)
+		isMonitoring := waitForContinue(printer, opts.ContinueAfter, deadline)
+
+		if isMonitoring && opts.TargetRestarts > 0 {
+			isMonitoring, err = containerInspector.RestartTargets(opts.TargetRestarts, deadline, func(idx int) <-chan struct{} {
+				printer.Progress("target.restart", idx+1, opts.TargetRestarts)
+				if !opts.HTTPProbe {
+					return nil
+				}
+
+				probe, err := http.NewCustomProbe(containerInspector, opts.HTTPProbeCmds, true, printer)
+				errutils.FailOnCode(err, errutils.ExitCodeProbeFailure)
+				probe.Start()
+				return probe.DoneChan()
+			})
+			failOnContainerError(err)
+
+			if !isMonitoring {
+				printer.Info("event", "message", "the maximum monitoring period is over")
+			}
+		}
+
+		if testProbe != nil {
+			//the test script is not done if the monitoring ended first (it's a failed run)
+			testProbe.Stop()
+			<-testProbe.DoneChan()
+			cmdReport.ExecProbe = testProbe.Report()
+		}
+
+		stopSidecars(sidecarRuns)
+		monitorErr := containerInspector.FinishMonitoring()
+		errutils.WarnOn(monitorErr)
+
+		if len(sidecarRuns) > 0 {
+			cmdReport.Sidecars = waitForSidecars(printer, sidecarRuns)
+		}
+
+		//the target container is still running (the hook can collect more data from it)
+		if hookReport := runHook(printer, containerInspector, opts.Hooks, exec.HookAfterMonitor, artifactLocation); hookReport != nil {
+			cmdReport.Hooks = append(cmdReport.Hooks, *hookReport)
+		}
+
+		if probe != nil {
+			//the probe results are available only if the probe is done
+			select {
+			case <-probe.DoneChan():
+				cmdReport.HTTPProbe = probe.Report()
+				runMetrics.SetProbeResults(cmdReport.HTTPProbe.OkCount, cmdReport.HTTPProbe.ErrorCount)
+			default:
+			}
+		}
+
+		logger.Info("shutting down 'fat' container...")
+		err = containerInspector.ShutdownContainer()
+		errutils.WarnOn(err)
+
+		if cmdReport.ExecProbe != nil && !cmdReport.ExecProbe.Passed {
+			//no minified image if the tests failed (the app behavior wasn't fully exercised)
+			printer.Info("exec.probe",
+				"status", "failed",
+				"exit.code", cmdReport.ExecProbe.ExitCode,
+				"message", cmdReport.ExecProbe.Error)
+			printer.State("error", "message", "test script failed")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "test script failed"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+			errutils.FailCode("test script failed", errutils.ExitCodeTestFailure)
+		}
+
+		if hookReport := failedHook(cmdReport.Hooks); hookReport != nil {
+			printer.Info("hook",
+				"stage", hookReport.Stage,
+				"status", "failed",
+				"exit.code", hookReport.ExitCode,
+				"message", hookReport.Error)
+			printer.State("error", "message", "after-monitor hook failed")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "after-monitor hook failed"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+			errutils.FailCode("after-monitor hook failed", errutils.ExitCodeHookFailure)
+		}
+
+		printer.State("processing")
+		runMetrics.Phase("processing")
+		runTracer.Phase("processing")
+
+		if !containerInspector.HasCollectedData() {
+			imageInspector.ShowFatImageDockerInstructions(printer)
+			printer.Info("results",
+				"status", fmt.Sprintf("no data collected (no minified image generated). (version: %v)", v.Current()))
+			printer.State("exited")
+			runTracer.Finish(report.CmdStateExited)
+			runMetrics.Finish(report.CmdStateExited)
+
+			if monitorErr == container.ErrMonitorTimeout {
+				errutils.Exit(errutils.ExitCodeMonitorTimeout)
+			}
+
+			errutils.Exit(errutils.ExitCodeNoData)
+		}
+
+		printSensorStats(printer, artifactLocation)
+	}
+
+	if incrementalBase != nil && !incrementalBase.SkipMonitoring {
+		logger.Info("merging the base image artifacts for the unchanged layers...")
+		mergeResult, err := artifacts.MergeFiltered(artifactLocation, []string{incrementalBase.ArtifactLocation}, artifactFilter)
+		errutils.FailOn(err)
+
+		printer.Info("incremental.merged",
+			"base.image", incrementalBase.ImageID,
+			"files", mergeResult.FileCount,
+			"copied", mergeResult.CopiedCount)
+	}
+
+	if opts.ArtifactStore != "" {
+		logger.Info("accumulating the artifacts in the artifact store...")
+		runName := "target container"
+		switch {
+		case opts.SwarmConfig != nil:
+			runName = fmt.Sprintf("swarm service %v", opts.SwarmConfig.Service)
+		case opts.FromReport != "":
+			runName = opts.FromReport
+			if absPath, err := filepath.Abs(opts.FromReport); err == nil {
+				runName = absPath
+			}
+		}
+
+		//the reused artifacts are already in the store (the cached artifacts or the store itself)
+		isReused := opts.FromReport != "" && (isArtifactLocation(opts.FromReport, artifactLocation) || isArtifactLocation(opts.FromReport, opts.ArtifactStore))
+		useArtifactStore(printer, opts.ArtifactStore, imageInspector, artifactLocation, runName, isReused)
+	}
+
+	if len(opts.UseArtifacts) > 0 {
+		logger.Info("merging artifacts from other monitoring runs...")
+		mergeResult, err := artifacts.Merge(artifactLocation, opts.UseArtifacts)
+		errutils.FailOn(err)
+
+		printer.Info("artifacts.merged",
+			"reports", mergeResult.ReportCount,
+			"files", mergeResult.FileCount,
+			"copied", mergeResult.CopiedCount)
+	}
+
 	logger.Info("processing instrumented 'fat' container info...")
 	err = containerInspector.ProcessCollectedData()
 	errutils.FailOn(err)
 
-	if customImageTag == "" {
-		customImageTag = imageInspector.SlimImageRepo
+	if len(opts.FailOn) > 0 {
+		cmdReport.PolicyViolations = findingViolations(printer, containerInspector.Findings, opts.FailOn)
+		if len(cmdReport.PolicyViolations) > 0 {
+			//the findings are in the SARIF report in the artifacts directory
+			printer.State("error", "message", "policy violations found")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "policy violations found"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+			errutils.FailCode("policy violations found", errutils.ExitCodePolicyFailure)
+		}
+	}
+
+	logger.Info("creating the size breakdown...")
+	if imageInventory == nil {
+		imageInventory, err = loadImageInventory(imageInspector)
+		errutils.WarnOn(err)
+	}
+
+	if imageInventory != nil {
+		//the layer record is used to find the base image state for the incremental builds
+		incremental.NewLayers(imageInspector.ImageInfo, imageInventory).Save(localVolumePath)
+	}
+
+	if opts.CustomImageTag == "" {
+		opts.CustomImageTag = imageInspector.SlimImageRepo
+	}
+
+	var packages map[string]string
+	if opts.LayerMode == builder.LayersDepsApp {
+		packages = keptPackages(artifactLocation)
+	}
+
+	layerSet, err := builder.NewLayerSet(opts.LayerMode, imageInventory, opts.AppPaths, packages)
+	if err != nil {
+		//the original layers are not known without the image inventory
+		printer.Info("layers", "message", fmt.Sprintf("%v - using one layer", err))
+	}
+
+	if opts.Review {
+		if imageInventory != nil {
+			reviewArtifacts(printer, client, imageInspector, imageInventory, artifactLocation, opts.CustomImageTag, opts.ShowBuildLogs, opts.ImageOverrides, opts.Overrides, opts.OutputBase)
+		} else {
+			printer.Info("review", "message", "skipping the review (no image inventory)")
+		}
+	}
+
+	if imageInventory != nil {
+		cmdReport.DirSizes, err = artifacts.DirSizes(imageInventory, artifactLocation)
+		errutils.WarnOn(err)
+
+		removedFiles, err := artifacts.SaveRemovedFiles(imageInventory, artifactLocation, opts.GzipRemovedFiles)
+		errutils.WarnOn(err)
+		if err == nil {
+			cmdReport.RemovedFilesName = removedFiles.Name
+			cmdReport.RemovedFilesCount = removedFiles.Count
+			printer.Info("results",
+				"removed.files", removedFiles.Count,
+				"removed.size", humanize.Bytes(uint64(removedFiles.Size)),
+				"artifacts.removed.files", removedFiles.Name)
+		}
+	}
+
+	if opts.CmdReportFormat == report.FormatYAML {
+		err = report.SaveContainerReportYAML(artifactLocation)
+		errutils.WarnOn(err)
 	}
 
-	fmt.Println("docker-slim[build]: state=building message='building minified image'")
+	cmdReport.Capabilities = containerInspector.Capabilities
+	printer.Info("results",
+		"capabilities", strings.Join(cmdReport.Capabilities, ","))
+	printer.Info("results",
+		"capabilities.docker", strings.Join(capabilities.DockerRunOptions(cmdReport.Capabilities), " "))
+	printer.Info("results",
+		"capabilities.k8s", fmt.Sprintf("capabilities: {drop: [ALL], add: [%v]}", strings.Join(cmdReport.Capabilities, ", ")))
+
+	for _, info := range cmdReport.DirSizes {
+		printer.Info("size.breakdown",
+			"dir", info.Dir,
+			"original", humanize.Bytes(uint64(info.OriginalSize)),
+			"kept", humanize.Bytes(uint64(info.KeptSize)),
+			"dropped", humanize.Bytes(uint64(info.DroppedSize)),
+			"dropped.files", info.DroppedFileCount)
+	}
+
+	printer.State("building", "message", "building minified image")
+	runMetrics.Phase("building")
+	runTracer.Phase("building")
 
 	builder, err := builder.NewImageBuilder(client,
-		customImageTag,
+		opts.CustomImageTag,
 		imageInspector.ImageInfo,
 		artifactLocation,
-		doShowBuildLogs,
-		imageOverrides,
-		overrides)
+		opts.ShowBuildLogs,
+		opts.ImageOverrides,
+		opts.Overrides,
+		opts.OutputBase)
 	errutils.FailOn(err)
 
 	if !builder.HasData {
 		logger.Info("WARNING - no data artifacts")
 	}
 
+	//the Lambda images don't listen on their own ports (the RIE port is only used for the probes)
+	autoExpose(printer, builder, artifactLocation, cmdReport, opts.AutoExpose && opts.LambdaConfig == nil)
+
+	if ctrClient != nil {
+		builder.ImportClient = ctrClient
+	}
+
+	builder.Timeout = opts.Timeouts.ImageBuild
+	builder.Layers = layerSet
 	err = builder.Build()
 
-	if doShowBuildLogs {
-		fmt.Println("docker-slim[build]: build logs ====================")
-		fmt.Println("%s", builder.BuildLog.String())
-		fmt.Println("docker-slim[build]: end of build logs =============")
+	if opts.ShowBuildLogs {
+		printer.Block("build logs", builder.BuildLog.String())
 	}
 
 	errutils.FailOn(err)
 
-	fmt.Println("docker-slim[build]: state=completed")
+	printer.State("completed")
 	cmdReport.State = report.CmdStateCompleted
 
 	/////////////////////////////
 	newImageInspector, err := image.NewInspector(client, builder.RepoName)
 	errutils.FailOn(err)
 
+	if ctrClient != nil {
+		newImageInspector.ImageClient = ctrClient
+	}
+
 	if newImageInspector.NoImage() {
-		fmt.Printf("docker-slim[build]: info=results message='minified image not found - %s'\n", builder.RepoName)
-		fmt.Println("docker-slim[build]: state=exited")
+		printer.Info("results", "message", fmt.Sprintf("minified image not found - %s", builder.RepoName))
+		printer.State("exited")
+		runTracer.Finish(report.CmdStateExited)
+		runMetrics.Finish(report.CmdStateExited)
 		return
 	}
 
@@ -219,13 +732,18 @@ func OnBuild(
 		cmdReport.OriginalImageSizeHuman = humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize))
 		cmdReport.MinifiedImageSize = newImageInspector.ImageInfo.VirtualSize
 		cmdReport.MinifiedImageSizeHuman = humanize.Bytes(uint64(newImageInspector.ImageInfo.VirtualSize))
+		cmdReport.ReductionPercent = report.ReductionPercent(cmdReport.OriginalImageSize, cmdReport.MinifiedImageSize)
+
+		printer.Info("results",
+			"status", fmt.Sprintf("MINIFIED BY %.2fX [%v (%v) => %v (%v)]",
+				cmdReport.MinifiedBy,
+				cmdReport.OriginalImageSize,
+				cmdReport.OriginalImageSizeHuman,
+				cmdReport.MinifiedImageSize,
+				cmdReport.MinifiedImageSizeHuman))
+		printer.Info("results", "reduction.percent", fmt.Sprintf("%.2f", cmdReport.ReductionPercent))
 
-		fmt.Printf("docker-slim[build]: info=results status='MINIFIED BY %.2fX [%v (%v) => %v (%v)]'\n",
-			cmdReport.MinifiedBy,
-			cmdReport.OriginalImageSize,
-			cmdReport.OriginalImageSizeHuman,
-			cmdReport.MinifiedImageSize,
-			cmdReport.MinifiedImageSizeHuman)
+		runMetrics.SetImageSizes(cmdReport.OriginalImageSize, cmdReport.MinifiedImageSize, cmdReport.MinifiedBy)
 	} else {
 		cmdReport.State = report.CmdStateError
 		cmdReport.Error = err.Error()
@@ -233,32 +751,740 @@ func OnBuild(
 
 	cmdReport.MinifiedImage = builder.RepoName
 	cmdReport.MinifiedImageHasData = builder.HasData
+	cmdReport.OutputBase = builder.BaseImage
+	if layerSet != nil {
+		for _, layerDir := range builder.LayerDirs {
+			cmdReport.MinifiedImageLayers = append(cmdReport.MinifiedImageLayers, filepath.Base(layerDir))
+		}
+
+		printer.Info("results",
+			"layers.mode", layerSet.Mode,
+			"layers", strings.Join(cmdReport.MinifiedImageLayers, ","))
+	}
 	cmdReport.ArtifactLocation = imageInspector.ArtifactLocation
 	cmdReport.ContainerReportName = report.DefaultContainerReportFileName
 	cmdReport.SeccompProfileName = imageInspector.SeccompProfileName
+	if opts.AnnotateSeccomp && imageInspector.SeccompProfileName != "" {
+		cmdReport.SeccompAnnotatedName = seccomp.AnnotatedProfileName(imageInspector.SeccompProfileName)
+	}
 	cmdReport.AppArmorProfileName = imageInspector.AppArmorProfileName
+	cmdReport.OCISpecName = imageInspector.OCISpecName
+	cmdReport.K8sSecurityContextName = imageInspector.K8sSecurityContextName
+	cmdReport.FindingsReportName = imageInspector.FindingsReportName
+	cmdReport.FindingsCount = containerInspector.FindingsCount
 
-	fmt.Printf("docker-slim[build]: info=results  image.name=%v image.size='%v' data=%v\n",
-		cmdReport.MinifiedImage,
-		cmdReport.MinifiedImageSizeHuman,
-		cmdReport.MinifiedImageHasData)
+	logger.Info("generating 'docker run' and compose snippets...")
+	err = dockerrun.GenSnippets(artifactLocation,
+		imageInspector.DockerRunScriptName,
+		imageInspector.ComposeSnippetName,
+		builder.RepoName,
+		imageInspector.SeccompProfileName,
+		imageInspector.AppArmorProfileName,
+		imageInspector.ImageInfo.Config.User,
+		containerInspector.Capabilities,
+		containerInspector.ExposedPorts())
+	if err == nil {
+		cmdReport.DockerRunScriptName = imageInspector.DockerRunScriptName
+		cmdReport.ComposeSnippetName = imageInspector.ComposeSnippetName
 
-	fmt.Printf("docker-slim[build]: info=results  artifacts.location='%v'\n", cmdReport.ArtifactLocation)
-	fmt.Printf("docker-slim[build]: info=results  artifacts.report=%v\n", cmdReport.ContainerReportName)
-	fmt.Printf("docker-slim[build]: info=results  artifacts.dockerfile.original=Dockerfile.fat\n")
-	fmt.Printf("docker-slim[build]: info=results  artifacts.dockerfile.new=Dockerfile\n")
-	fmt.Printf("docker-slim[build]: info=results  artifacts.seccomp=%v\n", cmdReport.SeccompProfileName)
-	fmt.Printf("docker-slim[build]: info=results  artifacts.apparmor=%v\n", cmdReport.AppArmorProfileName)
+		if newImageInspector.ImageInfo != nil {
+			err = dockerrun.SaveImageLink(opts.StatePath, newImageInspector.ImageInfo.ID, artifactLocation)
+			errutils.WarnOn(err)
+		}
+	} else {
+		errutils.WarnOn(err)
+	}
+
+	if opts.K8sPatch != nil {
+		logger.Info("generating Kubernetes manifest patches...")
+		err = k8s.GenPatches(artifactLocation,
+			opts.K8sPatch,
+			opts.ImageRef,
+			builder.RepoName,
+			imageInspector.SeccompProfileName,
+			imageInspector.ImageInfo.Config.User,
+			containerInspector.Capabilities)
+		if err == nil {
+			cmdReport.K8sPatchDirName = k8s.PatchDirName
+		} else {
+			errutils.WarnOn(err)
+		}
+	}
+
+	printer.Info("results",
+		"image.name", cmdReport.MinifiedImage,
+		"image.size", cmdReport.MinifiedImageSizeHuman,
+		"data", cmdReport.MinifiedImageHasData)
+
+	printer.Info("results", "artifacts.location", cmdReport.ArtifactLocation)
+	printer.Info("results", "artifacts.report", cmdReport.ContainerReportName)
+	printer.Info("results", "artifacts.dockerfile.original", "Dockerfile.fat")
+	printer.Info("results", "artifacts.dockerfile.new", "Dockerfile")
+	if cmdReport.SeccompProfileName != "" {
+		printer.Info("results", "artifacts.seccomp", cmdReport.SeccompProfileName)
+	}
+	if cmdReport.SeccompAnnotatedName != "" {
+		printer.Info("results", "artifacts.seccomp.annotated", cmdReport.SeccompAnnotatedName)
+	}
+	printer.Info("results", "artifacts.apparmor", cmdReport.AppArmorProfileName)
+	printer.Info("results", "artifacts.oci", cmdReport.OCISpecName)
+	printer.Info("results", "artifacts.k8s.security.context", cmdReport.K8sSecurityContextName)
+	if cmdReport.K8sPatchDirName != "" {
+		printer.Info("results", "artifacts.k8s.patches", cmdReport.K8sPatchDirName)
+	}
+	if cmdReport.DockerRunScriptName != "" {
+		printer.Info("results", "artifacts.docker.run", cmdReport.DockerRunScriptName)
+		printer.Info("results", "artifacts.compose", cmdReport.ComposeSnippetName)
+	}
+	printer.Info("results",
+		"artifacts.findings", cmdReport.FindingsReportName,
+		"findings", cmdReport.FindingsCount)
+	cmdReport.UnusedEnvVars = printEnvUsage(printer, containerInspector.EnvVars)
+	cmdReport.ExecutedBinaries = printExecs(printer, artifactLocation)
+	cmdReport.Distro = printDistro(printer, artifactLocation)
 
 	/////////////////////////////
 
-	if doRmFileArtifacts {
+	if opts.VerifyProfiles {
+		printer.State("verifying.profiles")
+		runMetrics.Phase("verifying.profiles")
+		runTracer.Phase("verifying.profiles")
+
+		var seccompProfilePath string
+		if imageInspector.SeccompProfileName != "" {
+			seccompProfilePath = filepath.Join(artifactLocation, imageInspector.SeccompProfileName)
+		}
+
+		profileVerifier, err := verifier.New(client,
+			builder.RepoName,
+			seccompProfilePath,
+			imageInspector.AppArmorProfileName,
+			opts.Overrides.Network)
+		errutils.FailOn(err)
+
+		logger.Info("starting minified container with the generated profiles...")
+		err = profileVerifier.Start()
+		errutils.FailOn(err)
+
+		var verifyProbe *http.CustomProbe
+		if opts.HTTPProbe {
+			verifyProbe, err = http.NewEndpointProbe(profileVerifier.DockerHostIP,
+				profileVerifier.Ports(),
+				opts.HTTPProbeCmds,
+				true,
+				printer)
+			errutils.FailOn(err)
+			verifyProbe.Start()
+			<-verifyProbe.DoneChan()
+		} else {
+			<-time.After(time.Second * verifyWait)
+		}
+
+		result, err := profileVerifier.Finish()
+		errutils.FailOn(err)
+
+		if verifyProbe != nil && probe != nil {
+			for _, cmd := range verifyProbe.FailedCmds(probe) {
+				result.Errors = append(result.Errors,
+					fmt.Sprintf("HTTP probe failed - %v %v", cmd.Method, cmd.Resource))
+				result.ProbeFailed = true
+			}
+		}
+
+		if len(result.Errors) > 0 {
+			for _, msg := range result.Errors {
+				printer.Info("verify.error", "message", msg)
+			}
+
+			printer.State("error", "message", "profile verification failed")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "profile verification failed"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+
+			exitCode := errutils.ExitCodeVerifyFailure
+			if result.ProbeFailed {
+				exitCode = errutils.ExitCodeProbeFailure
+			}
+
+			errutils.FailCode("profile verification failed", exitCode)
+		}
+
+		printer.Info("verify", "status", "profiles verified")
+	}
+
+	if opts.VerifyImage {
+		printer.State("verifying.image")
+		runMetrics.Phase("verifying.image")
+		runTracer.Phase("verifying.image")
+
+		imageVerifier, err := verifier.New(client, builder.RepoName, "", "", opts.Overrides.Network)
+		errutils.FailOn(err)
+
+		logger.Info("starting minified container...")
+		err = imageVerifier.Start()
+		errutils.FailOn(err)
+
+		verifyReport := verifyImage(printer, imageVerifier, probe, opts.HTTPProbe, opts.HTTPProbeCmds, opts.ExecFile, opts.Timeouts)
+
+		result, err := imageVerifier.Finish()
+		errutils.FailOn(err)
+
+		verifyReport.Running = result.Running
+		verifyReport.ExitCode = result.ExitCode
+		verifyReport.Errors = append(result.Errors, verifyReport.Errors...)
+		verifyReport.Passed = len(verifyReport.Errors) == 0
+		cmdReport.ImageVerification = verifyReport
+
+		if !verifyReport.Passed {
+			for _, msg := range verifyReport.Errors {
+				printer.Info("verify.error", "message", msg)
+			}
+
+			printer.State("error", "message", "minified image verification failed")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "minified image verification failed"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+			errutils.FailCode("minified image verification failed", errutils.ExitCodeVerifyFailure)
+		}
+
+		printer.Info("verify", "status", "minified image verified")
+	}
+
+	if opts.SizeBudget != nil {
+		cmdReport.SizeBudgetErrors = checkSizeBudget(opts.SizeBudget, cmdReport)
+		if len(cmdReport.SizeBudgetErrors) > 0 {
+			for _, msg := range cmdReport.SizeBudgetErrors {
+				printer.Info("size.budget.error", "message", msg)
+			}
+
+			//the minified image is kept, so you can check what's in it
+			printer.State("error", "message", "minified image size budget exceeded")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "minified image size budget exceeded"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+			errutils.FailCode("minified image size budget exceeded", errutils.ExitCodeSizeBudget)
+		}
+
+		printer.Info("size.budget", "status", "ok")
+	}
+
+	if sidecarErrs := sidecarErrors(cmdReport.Sidecars); len(sidecarErrs) > 0 {
+		for _, msg := range sidecarErrs {
+			printer.Info("sidecar.error", "message", msg)
+		}
+
+		//the target minified image is kept (only the sidecar images are missing)
+		printer.State("error", "message", "sidecar build failed")
+		cmdReport.State = report.CmdStateError
+		cmdReport.Error = "sidecar build failed"
+		cmdReport.Save()
+		runTracer.Finish(report.CmdStateError)
+		runMetrics.Finish(report.CmdStateError)
+		errutils.FailCode("sidecar build failed", errutils.ExitCodeError)
+	}
+
+	printer.State("done")
+	cmdReport.State = report.CmdStateDone
+	cmdReport.Save()
+	printer.Result(cmdReport.MinifiedImage)
+
+	if opts.CmdReportUpload != "" {
+		uploadResults(printer, opts.CmdReportUpload, opts.CmdReportLocation, imageInspector)
+	}
+
+	if opts.RmFileArtifacts {
 		logger.Info("removing temporary artifacts...")
 		err = fsutils.Remove(artifactLocation) //TODO: remove only the "files" subdirectory
 		errutils.WarnOn(err)
 	}
+	runTracer.Finish(cmdReport.State)
+	runMetrics.Finish(cmdReport.State)
+}
 
-	fmt.Println("docker-slim[build]: state=done")
-	cmdReport.State = report.CmdStateDone
-	cmdReport.Save()
+// verifyImage runs the probes against the minified container (the HTTP probe calls that worked
+// with the target container and the test script must work with the minified container)
+func verifyImage(printer *console.Printer,
+	imageVerifier *verifier.Verifier,
+	probe *http.CustomProbe,
+	doHTTPProbe bool,
+	httpProbeCmds []config.HTTPProbeCmd,
+	execFile string,
+	timeouts *config.Timeouts) *report.ImageVerifyReport {
+	verifyReport := &report.ImageVerifyReport{}
+	if doHTTPProbe {
+		verifyProbe, err := http.NewEndpointProbe(imageVerifier.DockerHostIP,
+			imageVerifier.Ports(),
+			httpProbeCmds,
+			true,
+			printer)
+		errutils.FailOn(err)
+		verifyProbe.ReadyTimeout = timeouts.AppReady
+		verifyProbe.Start()
+		<-verifyProbe.DoneChan()
+
+		verifyReport.HTTPProbe = verifyProbe.Report()
+		if probe != nil {
+			for _, cmd := range verifyProbe.FailedCmds(probe) {
+				verifyReport.Errors = append(verifyReport.Errors,
+					fmt.Sprintf("HTTP probe failed - %v %v", cmd.Method, cmd.Resource))
+			}
+		} else if verifyReport.HTTPProbe.OkCount == 0 {
+			//no reference probe results in the offline builds
+			verifyReport.Errors = append(verifyReport.Errors, "HTTP probe failed - no successful calls")
+		}
+	}
+
+	if execFile != "" {
+		testProbe, err := exec.NewEndpointTestProbe(imageVerifier.DockerHostIP,
+			imageVerifier.PortMap(),
+			execFile,
+			true,
+			printer)
+		errutils.FailOn(err)
+		testProbe.ReadyTimeout = timeouts.AppReady
+		testProbe.Start()
+
+		select {
+		case <-testProbe.DoneChan():
+		case <-monitorDeadline(timeouts.Monitor):
+			testProbe.Stop()
+			<-testProbe.DoneChan()
+		}
+
+		verifyReport.ExecProbe = testProbe.Report()
+		if !verifyReport.ExecProbe.Passed {
+			verifyReport.Errors = append(verifyReport.Errors,
+				fmt.Sprintf("test script failed (exit code: %v)", verifyReport.ExecProbe.ExitCode))
+		}
+	}
+
+	if !doHTTPProbe && execFile == "" {
+		<-time.After(time.Second * verifyWait)
+	}
+
+	return verifyReport
+}
+
+// findingViolations shows the findings selected by the --fail-on gates and returns their descriptions
+func findingViolations(printer *console.Printer, findingList []*findings.Finding, failOn []string) []string {
+	var violations []string
+	for _, finding := range findings.Violations(findingList, failOn) {
+		location := finding.Path
+		if finding.Line > 0 {
+			location = fmt.Sprintf("%s:%d", finding.Path, finding.Line)
+		}
+
+		printer.Info("policy.violation",
+			"rule", finding.RuleID,
+			"location", location,
+			"message", finding.Message)
+		violations = append(violations, fmt.Sprintf("%s: %s (%s)", finding.RuleID, finding.Message, location))
+	}
+
+	return violations
+}
+
+// checkSizeBudget returns the size budget violations for the minified image
+func checkSizeBudget(budget *config.SizeBudget, cmdReport *report.BuildCommand) []string {
+	if cmdReport.MinifiedImageSize <= 0 {
+		//the minified image wasn't inspected, so its size is unknown
+		return []string{"unknown minified image size"}
+	}
+
+	var errors []string
+	if budget.MaxSize > 0 && cmdReport.MinifiedImageSize > budget.MaxSize {
+		errors = append(errors, fmt.Sprintf("minified image size %v is above the maximum size %v",
+			humanize.Bytes(uint64(cmdReport.MinifiedImageSize)),
+			humanize.Bytes(uint64(budget.MaxSize))))
+	}
+
+	if budget.MinReduction > 0 && cmdReport.ReductionPercent < budget.MinReduction {
+		errors = append(errors, fmt.Sprintf("size reduction %.2f%% is below the minimum reduction %.2f%%",
+			cmdReport.ReductionPercent,
+			budget.MinReduction))
+	}
+
+	return errors
+}
+
+// autoExpose reports the ports the target app listened on and uses them for the minified image EXPOSE instructions
+// (the original image ports are kept if the sensor didn't see any listening ports)
+func autoExpose(printer *console.Printer,
+	imageBuilder *builder.ImageBuilder,
+	artifactLocation string,
+	cmdReport *report.BuildCommand,
+	doAutoExpose bool) {
+	creport, err := report.LoadContainerReport(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		log.Debugf("autoExpose: error loading the container report - %v", err)
+		return
+	}
+
+	if creport.Monitors.Net == nil || len(creport.Monitors.Net.ListeningPorts) == 0 {
+		if doAutoExpose {
+			printer.Info("results", "message", "no listening ports detected (keeping the original image EXPOSE instructions)")
+		}
+
+		return
+	}
+
+	exposedPorts := map[docker.Port]struct{}{}
+	for _, port := range creport.Monitors.Net.ListeningPorts {
+		if _, ok := exposedPorts[docker.Port(port.String())]; ok {
+			continue
+		}
+
+		exposedPorts[docker.Port(port.String())] = struct{}{}
+		cmdReport.ListeningPorts = append(cmdReport.ListeningPorts, port.String())
+	}
+
+	printer.Info("results", "listening.ports", strings.Join(cmdReport.ListeningPorts, ","))
+
+	if !doAutoExpose {
+		return
+	}
+
+	for port := range imageBuilder.ExposedPorts {
+		if _, ok := exposedPorts[port]; !ok {
+			cmdReport.DroppedExposedPorts = append(cmdReport.DroppedExposedPorts, string(port))
+		}
+	}
+
+	if len(cmdReport.DroppedExposedPorts) > 0 {
+		sort.Strings(cmdReport.DroppedExposedPorts)
+		printer.Info("results", "expose.dropped", strings.Join(cmdReport.DroppedExposedPorts, ","))
+	}
+
+	imageBuilder.ExposedPorts = exposedPorts
+}
+
+// printEnvUsage prints the image environment variables the target app didn't use
+// and returns their names (the secret-like variables are also printed separately)
+func printEnvUsage(printer *console.Printer, envVars []report.EnvVarUsage) []string {
+	var unused, unusedSecrets []string
+	for _, envVar := range envVars {
+		if envVar.Status != report.EnvVarUnused {
+			continue
+		}
+
+		unused = append(unused, envVar.Name)
+		if envVar.Secret {
+			unusedSecrets = append(unusedSecrets, envVar.Name)
+		}
+	}
+
+	if len(unused) > 0 {
+		printer.Info("results", "env.unused", strings.Join(unused, ","))
+	}
+
+	if len(unusedSecrets) > 0 {
+		printer.Info("results", "env.unused.secrets", strings.Join(unusedSecrets, ","))
+	}
+
+	return unused
+}
+
+// printExecs prints the binaries the target app executed while it was monitored
+// and returns their paths (the executed commands are in the container report)
+func printExecs(printer *console.Printer, artifactLocation string) []string {
+	creport, err := report.LoadContainerReport(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		log.Debugf("printExecs: error loading the container report - %v", err)
+		return nil
+	}
+
+	if creport.Monitors.Fan == nil || len(creport.Monitors.Fan.Execs) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var binaries []string
+	for _, exec := range creport.Monitors.Fan.Execs {
+		if !seen[exec.Path] {
+			seen[exec.Path] = true
+			binaries = append(binaries, exec.Path)
+		}
+	}
+
+	sort.Strings(binaries)
+	printer.Info("results",
+		"execs", len(creport.Monitors.Fan.Execs),
+		"executed.binaries", strings.Join(binaries, ","))
+
+	return binaries
+}
+
+// keptPackages returns the OS package names for the kept files (the file paths are the keys)
+func keptPackages(artifactLocation string) map[string]string {
+	creport, err := report.LoadContainerReport(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		log.Debugf("keptPackages: error loading the container report - %v", err)
+		return nil
+	}
+
+	packages := map[string]string{}
+	for _, file := range creport.Image.Files {
+		if file != nil && file.Package != "" {
+			packages[file.FilePath] = file.Package
+		}
+	}
+
+	return packages
+}
+
+// printDistro prints the base distro the sensor detected in the target container
+// (with the C library warnings) and returns it (the distro is in the container report)
+func printDistro(printer *console.Printer, artifactLocation string) *distro.Info {
+	creport, err := report.LoadContainerReport(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		log.Debugf("printDistro: error loading the container report - %v", err)
+		return nil
+	}
+
+	for _, warning := range creport.Image.LibcWarnings {
+		printer.Info("image.libc.warning", "message", warning)
+	}
+
+	info := creport.Image.Distro
+	if info == nil {
+		return nil
+	}
+
+	printer.Info("image.distro",
+		"id", info.ID,
+		"version", info.Version,
+		"family", info.Family,
+		"libc", info.Libc)
+
+	return info
+}
+
+// reviewArtifacts runs the interactive review of the kept files before the minified image is built
+// (the review builds use the same image tag as the final minified image)
+func reviewArtifacts(printer *console.Printer,
+	client *docker.Client,
+	imageInspector *image.Inspector,
+	imageInventory *dockerimage.Inventory,
+	artifactLocation string,
+	customImageTag string,
+	doShowBuildLogs bool,
+	imageOverrides map[string]bool,
+	overrides *config.ContainerOverrides,
+	outputBase string) {
+	printer.State("review", "message", "reviewing the minified image files")
+
+	assemble := func() (int64, error) {
+		imageBuilder, err := builder.NewImageBuilder(client,
+			customImageTag,
+			imageInspector.ImageInfo,
+			artifactLocation,
+			doShowBuildLogs,
+			imageOverrides,
+			overrides,
+			outputBase)
+		if err != nil {
+			return 0, err
+		}
+
+		err = imageBuilder.Build()
+		if doShowBuildLogs {
+			printer.Block("build logs", imageBuilder.BuildLog.String())
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		imageInfo, err := client.InspectImage(imageBuilder.RepoName)
+		if err != nil {
+			return 0, err
+		}
+
+		return imageInfo.VirtualSize, nil
+	}
+
+	session, err := review.New(client, imageInspector.ImageInfo.ID, artifactLocation, imageInventory, assemble)
+	errutils.FailOn(err)
+
+	err = session.Run(os.Stdin, os.Stdout)
+	if err == review.ErrAborted {
+		printer.Info("review", "message", "review aborted (the minified image is not built)")
+		printer.State("exited")
+		errutils.Exit(errutils.ExitCodeError)
+	}
+
+	errutils.FailOn(err)
+	printer.State("review.done")
+}
+
+// isArtifactLocation returns true if the saved artifacts (an artifacts directory or a container report)
+// are in the artifact location
+func isArtifactLocation(source, artifactLocation string) bool {
+	sourcePath, err := filepath.Abs(source)
+	if err != nil {
+		return false
+	}
+
+	if !fsutils.IsDir(sourcePath) {
+		sourcePath = filepath.Dir(sourcePath)
+	}
+
+	location, err := filepath.Abs(artifactLocation)
+	if err != nil {
+		return false
+	}
+
+	return sourcePath == location
+}
+
+// useArtifactStore adds the monitoring run artifacts to the artifact store and merges the accumulated artifacts
+// from all runs in the store to the artifact location (the minified image has the files used in any of the runs)
+func useArtifactStore(printer *console.Printer,
+	storeLocation string,
+	imageInspector *image.Inspector,
+	artifactLocation string,
+	runName string,
+	isReused bool) {
+	if !isReused {
+		index, err := artifacts.AppendToStore(storeLocation, imageInspector.ImageInfo.ID, imageInspector.ImageRef, artifactLocation, runName)
+		errutils.FailOn(err)
+
+		printer.Info("artifact.store",
+			"location", storeLocation,
+			"runs", len(index.Runs),
+			"files", index.FileCount,
+			"new.files", index.Runs[len(index.Runs)-1].NewFileCount)
+	}
+
+	index, err := artifacts.LoadStoreIndex(storeLocation)
+	errutils.FailOn(err)
+	if index == nil {
+		printer.Info("artifact.store", "location", storeLocation, "message", "the artifact store is empty")
+		return
+	}
+
+	mergeResult, err := artifacts.Merge(artifactLocation, []string{storeLocation})
+	errutils.FailOn(err)
+
+	printer.Info("artifact.store.merged",
+		"runs", len(index.Runs),
+		"files", mergeResult.FileCount,
+		"copied", mergeResult.CopiedCount)
+}
+
+// findIncrementalBase returns the image file inventory and the base image state for the incremental build
+// (the base is nil if there's no image state with the same bottom layers)
+func findIncrementalBase(printer *console.Printer, statePath string, imageInspector *image.Inspector) (*dockerimage.Inventory, *incremental.Base) {
+	imageInventory, err := loadImageInventory(imageInspector)
+	if err != nil {
+		errutils.WarnOn(err)
+		printer.Info("incremental", "message", "no image inventory (full build)")
+		return nil, nil
+	}
+
+	base, err := incremental.FindBase(statePath, imageInspector.ImageInfo, imageInventory)
+	errutils.WarnOn(err)
+	if base == nil {
+		printer.Info("incremental", "message", "no image state with the same bottom layers (full build)")
+		return imageInventory, nil
+	}
+
+	printer.Info("incremental",
+		"base.image", base.ImageID,
+		"shared.layers", base.SharedLayers,
+		"layers", base.Layers,
+		"same.config", base.SameConfig,
+		"monitoring", !base.SkipMonitoring)
+	return imageInventory, base
+}
+
+// loadImageInventory returns the image file inventory
+// (the inventory is cached in the image state if the analysis cache is enabled)
+func loadImageInventory(imageInspector *image.Inspector) (*dockerimage.Inventory, error) {
+	var inventory dockerimage.Inventory
+	if imageInspector.AnalysisCache.Load(cache.EntryInventory, &inventory) {
+		return &inventory, nil
+	}
+
+	imageInventory, err := dockerimage.LoadInventory(imageInspector.ImageClient, imageInspector.ImageInfo.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	imageInspector.AnalysisCache.Save(cache.EntryInventory, imageInventory)
+	return imageInventory, nil
+}
+
+// prepareLambdaTarget configures the target container to run the Lambda function with the Runtime Interface Emulator
+// and keeps the runtime files the function invocations don't always use
+func prepareLambdaTarget(
+	printer *console.Printer,
+	imageInfo *docker.Image,
+	lambdaConfig *config.Lambda,
+	overrides *config.ContainerOverrides,
+	volumeMounts map[string]config.VolumeMount,
+	excludePaths map[string]bool,
+	includePaths map[string]bool) {
+	isBaseImage := lambda.IsBaseImage(imageInfo)
+	if lambdaConfig.RIEPath != "" {
+		mount, err := lambda.MountRIE(imageInfo, lambdaConfig.RIEPath, overrides)
+		errutils.FailOn(err)
+
+		volumeMounts[mount.Source] = *mount
+		excludePaths[filepath.Dir(lambda.RIEMountPath)] = true
+	} else if !isBaseImage {
+		printer.Info("lambda.warning",
+			"message", "the image is not based on an AWS Lambda base image (use --lambda-rie to mount the Runtime Interface Emulator)")
+	}
+
+	if overrides.ExposedPorts == nil {
+		overrides.ExposedPorts = map[docker.Port]struct{}{}
+	}
+	overrides.ExposedPorts[docker.Port(lambda.RIEPort)] = struct{}{}
+
+	for _, kpath := range lambda.KeepPaths(imageInfo) {
+		if !excludePaths[kpath] {
+			includePaths[kpath] = true
+		}
+	}
+
+	printer.Info("lambda",
+		"base.image", isBaseImage,
+		"rie.mounted", lambdaConfig.RIEPath != "",
+		"events", len(lambdaConfig.EventFiles))
+}
+
+// profileSwarmTask monitors a running task of the Swarm service on the local node
+// and returns the location of the saved monitoring artifacts
+func profileSwarmTask(printer *console.Printer, client *docker.Client, imageID string, swarmConfig *config.Swarm) string {
+	task, err := swarm.FindTask(client, swarmConfig.Service)
+	errutils.FailOn(err)
+
+	if task.ImageID != imageID {
+		errutils.Fail(fmt.Sprintf("the %v task runs a different image (%v)", task.Name, task.ImageID))
+	}
+
+	printer.Info("swarm.task",
+		"service", swarmConfig.Service,
+		"task", task.Name,
+		"container", task.ContainerID,
+		"duration", swarmConfig.Duration)
+
+	location, err := ioutil.TempDir("", swarmTmpDirPattern)
+	errutils.FailOn(err)
+
+	creport, err := agent.Profile(task.Target, swarmConfig.Duration, location)
+	if err != nil {
+		os.RemoveAll(location)
+		errutils.FailOnCode(err, errutils.ExitCodeNoData)
+	}
+
+	printer.Info("swarm.profile", "task", task.Name, "files", len(creport.Image.Files))
+	return location
 }
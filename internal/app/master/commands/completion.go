@@ -0,0 +1,14 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/completion"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+)
+
+// OnCompletion implements the 'completion' docker-slim command
+func OnCompletion(shell string, spec *completion.Spec) {
+	err := completion.Generate(os.Stdout, shell, spec)
+	errutils.FailOn(err)
+}
@@ -0,0 +1,9 @@
+package commands
+
+// how long to run the minified container (in seconds) verifying the generated profiles
+// (used when there's no HTTP probe to exercise the minified container)
+const verifyWait = 10
+
+// the temporary artifacts directory name pattern for the Swarm service task profiles
+// (the artifacts are removed after the minified image is built)
+const swarmTmpDirPattern = "docker-slim-swarm-"
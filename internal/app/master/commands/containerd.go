@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/containerd"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// connectContainerd creates the containerd client
+// (terminates the application if containerd is not available)
+func connectContainerd(containerdConfig *config.Containerd) *containerd.Client {
+	client, err := containerd.New(containerdConfig)
+	errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+
+	err = client.Ping()
+	errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+
+	return client
+}
+
+// containerClient returns the container runtime client for the target container
+// (nil for the Docker containers)
+func containerClient(client *containerd.Client) runtime.ContainerClient {
+	if client == nil {
+		return nil
+	}
+
+	return client
+}
+
+// useContainerdImages switches the image inspector to the containerd images
+// and pulls the target image if it's not in the containerd namespace yet
+func useContainerdImages(printer *console.Printer, client *containerd.Client, imageInspector *image.Inspector) {
+	imageInspector.ImageClient = client
+	if !imageInspector.NoImage() {
+		return
+	}
+
+	printer.Info("target.image", "status", "pulling", "image", client.ImageRef(imageInspector.ImageRef))
+	if err := client.PullImage(imageInspector.ImageRef, nil); err != nil {
+		log.Infof("error pulling the target image => %v", err)
+	}
+}
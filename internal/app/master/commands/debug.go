@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/debug"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/version"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+)
+
+// OnDebug implements the 'debug' docker-slim command
+func OnDebug(
+	consoleFormat string,
+	doDebug bool,
+	clientConfig *config.DockerClient,
+	target string,
+	debugImage string,
+	debugCmd []string) {
+	printer := console.New("debug", consoleFormat)
+	printer.State("started")
+
+	client, closeClient := dockerclient.New(clientConfig)
+	defer closeClient()
+	err := client.Ping()
+	errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+
+	if doDebug {
+		version.Print(client)
+	}
+
+	sideCar, err := debug.New(client, target, debugImage, debugCmd)
+	if err == debug.ErrTargetNotRunning {
+		printer.Info("target.container.error", "status", "not.running", "container", target)
+		printer.State("exited")
+		errutils.Exit(errutils.ExitCodeError)
+	}
+	errutils.FailOn(err)
+
+	err = sideCar.PullImage()
+	errutils.FailOn(err)
+
+	printer.Info("params",
+		"target", target,
+		"image", sideCar.ImageRef,
+		"target.fs", "/proc/1/root")
+
+	exitCode, err := sideCar.Run()
+	errutils.FailOn(err)
+
+	printer.Info("results", "exit.code", exitCode)
+	printer.State("done")
+}
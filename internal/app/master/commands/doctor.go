@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/doctor"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+)
+
+// OnDoctor implements the 'doctor' docker-slim command
+func OnDoctor(consoleFormat, statePath string, clientConfig *config.DockerClient) {
+	printer := console.New("doctor", consoleFormat)
+	printer.State("started")
+
+	client, closeClient := dockerclient.New(clientConfig)
+	defer closeClient()
+	checks, dockerArch := doctor.Docker(client)
+
+	if isLocalDocker(clientConfig) {
+		checks = append(checks, doctor.Kernel()...)
+	} else {
+		checks = append(checks, &doctor.Check{
+			Name:    "kernel",
+			Status:  doctor.StatusUnknown,
+			Message: "remote Docker host (the kernel features are not checked)",
+		})
+	}
+
+	checks = append(checks, doctor.StatePath(statePath))
+	checks = append(checks, doctor.Sensor(dockerArch, statePath)...)
+
+	counts := map[string]int{}
+	for _, check := range checks {
+		counts[check.Status]++
+
+		params := []interface{}{"name", check.Name, "status", check.Status}
+		if check.Message != "" {
+			params = append(params, "message", check.Message)
+		}
+
+		if check.Fix != "" {
+			params = append(params, "fix", check.Fix)
+		}
+
+		printer.Info("check", params...)
+	}
+
+	printer.Info("results",
+		"ok", counts[doctor.StatusOk],
+		"warnings", counts[doctor.StatusWarning],
+		"errors", counts[doctor.StatusError],
+		"unknown", counts[doctor.StatusUnknown])
+
+	if doctor.Failed(checks) {
+		printer.State("exited")
+		errutils.Exit(errutils.ExitCodeError)
+	}
+
+	printer.State("done")
+}
+
+// isLocalDocker returns true if the Docker host is on the local machine (the local Unix socket)
+func isLocalDocker(clientConfig *config.DockerClient) bool {
+	host := clientConfig.Host
+	if host == "" {
+		host = clientConfig.Env["DOCKER_HOST"]
+	}
+
+	return host == "" || strings.HasPrefix(host, "unix://")
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+)
+
+// printBuildPlan shows what the 'build' command would do in the dry-run mode
+// (the target container configuration, the sensor parameters, the probes and the output image)
+func printBuildPlan(
+	printer *console.Printer,
+	containerInspector *container.Inspector,
+	outputImage string,
+	artifactLocation string,
+	doHTTPProbe bool,
+	httpProbeCmds []config.HTTPProbeCmd,
+	execFile string,
+	continueAfter *config.ContinueAfter,
+	targetRestarts int,
+	useArtifacts []string,
+	fromReport string,
+	swarmConfig *config.Swarm,
+	sizeBudget *config.SizeBudget,
+	outputBase string,
+	layerMode string) {
+	printer.Info("plan",
+		"output.image", outputImage,
+		"output.base", outputBase,
+		"layers", layerMode,
+		"artifacts.location", artifactLocation)
+
+	if sizeBudget != nil {
+		printer.Info("plan.size.budget",
+			"max.size", sizeBudget.MaxSize,
+			"min.reduction", sizeBudget.MinReduction)
+	}
+
+	for _, location := range useArtifacts {
+		printer.Info("plan.artifacts", "merge", location)
+	}
+
+	switch {
+	case swarmConfig != nil:
+		printer.Info("plan.source",
+			"swarm.service", swarmConfig.Service,
+			"duration", swarmConfig.Duration)
+		return
+	case fromReport != "":
+		//no container in the offline mode
+		printer.Info("plan.source", "from.report", fromReport)
+		return
+	}
+
+	plan, err := containerInspector.Plan()
+	errutils.FailOn(err)
+
+	printer.Info("plan.container",
+		"name", plan.Name,
+		"runtime", plan.Runtime,
+		"sensor", plan.SensorPath,
+		"sensor.args", strings.Join(plan.SensorArgs, " "))
+
+	for _, dep := range containerInspector.Dependencies {
+		printer.Info("plan.dependency",
+			"image", dep.Image,
+			"alias", dep.Alias,
+			"ready", dep.Ready)
+	}
+
+	if plan.StartMonitor != nil {
+		printer.Info("plan.monitor",
+			"app", plan.StartMonitor.AppName,
+			"app.args", strings.Join(plan.StartMonitor.AppArgs, " "),
+			"includes", strings.Join(sortedPaths(plan.StartMonitor.Includes), ","),
+			"excludes", strings.Join(sortedPaths(plan.StartMonitor.Excludes), ","))
+	}
+
+	if plan.Options != nil {
+		data, err := json.MarshalIndent(plan.Options, "", "  ")
+		errutils.FailOn(err)
+
+		printer.Block("container config", string(data))
+	}
+
+	if "probe" == continueAfter.Mode {
+		doHTTPProbe = true
+	}
+
+	if doHTTPProbe {
+		for _, cmd := range httpProbeCmds {
+			port := "all"
+			if cmd.Port != 0 {
+				port = strconv.Itoa(cmd.Port)
+			}
+
+			printer.Info("plan.probe",
+				"protocol", cmd.Protocol,
+				"method", cmd.Method,
+				"resource", cmd.Resource,
+				"port", port)
+		}
+	}
+
+	if execFile != "" {
+		printer.Info("plan.exec.probe", "file", execFile)
+	}
+
+	printer.Info("plan.continue",
+		"mode", continueAfter.Mode,
+		"target.restarts", targetRestarts)
+}
+
+func sortedPaths(paths []string) []string {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+	return sorted
+}
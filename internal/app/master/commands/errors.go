@@ -0,0 +1,16 @@
+package commands
+
+import (
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+)
+
+// failOnContainerError terminates the application if there's an error
+// (the sensor errors have their own exit code)
+func failOnContainerError(err error) {
+	if _, ok := err.(*container.SensorError); ok {
+		errutils.FailOnCode(err, errutils.ExitCodeSensorError)
+	}
+
+	errutils.FailOn(err)
+}
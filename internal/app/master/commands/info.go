@@ -1,9 +1,9 @@
 package commands
 
 import (
-	"fmt"
-
+	"github.com/docker-slim/docker-slim/internal/app/master/cache"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
 	"github.com/docker-slim/docker-slim/internal/app/master/version"
@@ -18,20 +18,27 @@ import (
 // OnInfo implements the 'info' docker-slim command
 func OnInfo(
 	cmdReportLocation string,
+	cmdReportFormat string,
+	consoleFormat string,
 	doDebug bool,
 	statePath string,
 	clientConfig *config.DockerClient,
-	imageRef string) {
+	imageRef string,
+	doAnalysisCache bool) {
 	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "info"})
 
-	cmdReport := report.NewInfoCommand(cmdReportLocation)
+	cmdReport := report.NewInfoCommand(cmdReportLocation, cmdReportFormat)
 	cmdReport.State = report.CmdStateStarted
 	cmdReport.OriginalImage = imageRef
 
-	fmt.Println("docker-slim[info]: state=started")
-	fmt.Printf("docker-slim[info]: info=params target=%v\n", imageRef)
+	printer := console.New(string(report.CmdTypeInfo), consoleFormat)
+	printer.State("started")
+	printer.Info("params", "target", imageRef)
 
-	client := dockerclient.New(clientConfig)
+	client, closeClient := dockerclient.New(clientConfig)
+	defer closeClient()
+	err := client.Ping()
+	errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 
 	if doDebug {
 		version.Print(client)
@@ -41,31 +48,41 @@ func OnInfo(
 	errutils.FailOn(err)
 
 	if imageInspector.NoImage() {
-		fmt.Println("docker-slim[info]: target image not found -", imageRef)
-		fmt.Println("docker-slim[info]: state=exited")
-		return
+		printer.Info("target.image.error", "status", "not.found", "image", imageRef)
+		printer.State("exited")
+		errutils.Exit(errutils.ExitCodeImageNotFound)
 	}
 
 	logger.Info("inspecting 'fat' image metadata...")
 	err = imageInspector.Inspect()
 	errutils.FailOn(err)
 
+	localVolumePath, _ := fsutils.StateDirs(statePath, imageInspector.ImageInfo.ID)
+	unlockState := lockStateDir(printer, localVolumePath)
+	defer unlockState()
+
 	_, artifactLocation := fsutils.PrepareStateDirs(statePath, imageInspector.ImageInfo.ID)
+	sealState := sealStateDir(artifactLocation)
+	defer sealState()
+
 	imageInspector.ArtifactLocation = artifactLocation
+	if doAnalysisCache {
+		imageInspector.AnalysisCache = cache.New(localVolumePath)
+	}
 
-	fmt.Printf("docker-slim[info]: info=image id=%v size.bytes=%v size.human=%v\n",
-		imageInspector.ImageInfo.ID,
-		imageInspector.ImageInfo.VirtualSize,
-		humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
+	printer.Info("image",
+		"id", imageInspector.ImageInfo.ID,
+		"size.bytes", imageInspector.ImageInfo.VirtualSize,
+		"size.human", humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
 
 	logger.Info("processing 'fat' image info...")
 	err = imageInspector.ProcessCollectedData()
 	errutils.FailOn(err)
 
-	fmt.Println("docker-slim[info]: state=completed")
+	printer.State("completed")
 	cmdReport.State = report.CmdStateCompleted
 
-	fmt.Println("docker-slim[info]: state=done")
+	printer.State("done")
 	cmdReport.State = report.CmdStateDone
 	cmdReport.Save()
 }
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/exec"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+)
+
+// monitorDeadline returns the channel for the end of the maximum monitoring period
+// (nil if there's no limit, so it never fires)
+func monitorDeadline(timeout time.Duration) <-chan time.Time {
+	if timeout <= 0 {
+		return nil
+	}
+
+	return time.After(timeout)
+}
+
+// waitForContinue waits until the continue-after condition is met
+// (returns false if the maximum monitoring period ends first)
+func waitForContinue(printer *console.Printer, continueAfter *config.ContinueAfter, deadline <-chan time.Time) bool {
+	var done <-chan struct{}
+	var doneMessage string
+	switch continueAfter.Mode {
+	case "enter":
+		printer.Info("prompt", "message", "press <enter> when you are done using the container")
+		enterChan := make(chan struct{})
+		go func() {
+			creader := bufio.NewReader(os.Stdin)
+			_, _, _ = creader.ReadLine()
+			close(enterChan)
+		}()
+		done = enterChan
+	case "signal":
+		printer.Info("prompt", "message", "send SIGUSR1 when you are done using the container")
+		done = continueAfter.ContinueChan
+		doneMessage = "got SIGUSR1"
+	case "timeout":
+		printer.Info("prompt", "message", fmt.Sprintf("waiting for the target container (%v seconds)", int(continueAfter.Timeout)))
+		done = afterChan(time.Second * continueAfter.Timeout)
+		doneMessage = "done waiting for the target container"
+	case "probe":
+		printer.Info("prompt", "message", "waiting for the HTTP probe to finish")
+		done = continueAfter.ContinueChan
+		doneMessage = "HTTP probe is done"
+	case "exec":
+		printer.Info("prompt", "message", "waiting for the test script to finish")
+		done = continueAfter.ContinueChan
+		doneMessage = "test script is done"
+	default:
+		errutils.Fail("unknown continue-after mode")
+	}
+
+	select {
+	case <-done:
+		if doneMessage != "" {
+			printer.Info("event", "message", doneMessage)
+		}
+		return true
+	case <-deadline:
+		printer.Info("event", "message", "the maximum monitoring period is over")
+		return false
+	}
+}
+
+// runHook runs the monitoring hook for the stage and returns its results
+// (nil if there's no hook for the stage)
+func runHook(printer *console.Printer,
+	inspector *container.Inspector,
+	hooks *config.MonitorHooks,
+	stage string,
+	artifactsDir string) *report.HookReport {
+	if hooks == nil {
+		return nil
+	}
+
+	command := hooks.BeforeMonitor
+	if stage == exec.HookAfterMonitor {
+		command = hooks.AfterMonitor
+	}
+
+	if command == "" {
+		return nil
+	}
+
+	return exec.RunHook(inspector, stage, command, artifactsDir, printer)
+}
+
+// failedHook returns the first failed hook (nil if all hooks passed)
+func failedHook(hookReports []report.HookReport) *report.HookReport {
+	for idx := range hookReports {
+		if !hookReports[idx].Passed {
+			return &hookReports[idx]
+		}
+	}
+
+	return nil
+}
+
+// afterChan returns a channel that is closed after the duration
+func afterChan(d time.Duration) <-chan struct{} {
+	ch := make(chan struct{})
+	time.AfterFunc(d, func() { close(ch) })
+	return ch
+}
@@ -1,16 +1,22 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
-	"os"
-	"time"
+	"strings"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/artifacts"
+	"github.com/docker-slim/docker-slim/internal/app/master/cache"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/containerd"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/exec"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/probes/http"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/metrics"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/internal/app/master/tracing"
 	"github.com/docker-slim/docker-slim/internal/app/master/version"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
@@ -24,9 +30,14 @@ import (
 // OnProfile implements the 'profile' docker-slim command
 func OnProfile(
 	cmdReportLocation string,
+	cmdReportFormat string,
+	cmdReportUpload string,
+	consoleFormat string,
 	doDebug bool,
 	statePath string,
 	clientConfig *config.DockerClient,
+	metricsConfig *config.Metrics,
+	tracingConfig *config.Tracing,
 	imageRef string,
 	doHTTPProbe bool,
 	httpProbeCmds []config.HTTPProbeCmd,
@@ -36,138 +47,405 @@ func OnProfile(
 	etcHostsMaps []string,
 	dnsServers []string,
 	dnsSearchDomains []string,
+	containerName string,
+	containerLabels map[string]string,
 	volumeMounts map[string]config.VolumeMount,
 	excludePaths map[string]bool,
 	includePaths map[string]bool,
-	continueAfter *config.ContinueAfter) {
+	continueAfter *config.ContinueAfter,
+	targetRestarts int,
+	useArtifacts []string,
+	seccompMerge *config.SeccompMerge,
+	doAnnotateSeccomp bool,
+	doGzipRemovedFiles bool,
+	doAnalysisCache bool,
+	kubernetesConfig *config.Kubernetes,
+	containerdConfig *config.Containerd,
+	timeouts *config.Timeouts,
+	artifactsTransfer string,
+	doCompressArtifacts bool,
+	sensorThrottle *config.SensorThrottle,
+	ipcTransport string,
+	sensorDelivery string,
+	execRedactPattern string,
+	dependencies []config.Dependency,
+	execFile string,
+	failOn []string,
+	doIncludeDistro bool,
+	doIncludeTzdata bool,
+	includeLocales []string,
+	hooks *config.MonitorHooks) {
 	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "profile"})
 
-	cmdReport := report.NewProfileCommand(cmdReportLocation)
+	cmdReport := report.NewProfileCommand(cmdReportLocation, cmdReportFormat)
 	cmdReport.State = report.CmdStateStarted
 	cmdReport.OriginalImage = imageRef
 
-	fmt.Println("docker-slim[profile]: state=started")
-	fmt.Printf("docker-slim[profile]: info=params target=%v\n", imageRef)
+	printer := console.New(string(report.CmdTypeProfile), consoleFormat)
+	runMetrics := metrics.NewRun(string(report.CmdTypeProfile), imageRef, metricsConfig, printer)
+	runTracer := tracing.NewTracer(string(report.CmdTypeProfile), imageRef, tracingConfig)
+
+	printer.State("started")
+	if runTracer.Enabled() {
+		printer.Info("tracing", "trace.id", runTracer.TraceID())
+	}
+	printer.Info("params", "target", imageRef)
 	doRmFileArtifacts := false
 
-	client := dockerclient.New(clientConfig)
+	client, closeClient := dockerclient.New(clientConfig)
+	defer closeClient()
+	var ctrClient *containerd.Client
+	if containerdConfig != nil {
+		ctrClient = connectContainerd(containerdConfig)
+	} else {
+		err := client.Ping()
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 
-	if doDebug {
-		version.Print(client)
+		if doDebug {
+			version.Print(client)
+		}
 	}
 
 	imageInspector, err := image.NewInspector(client, imageRef)
 	errutils.FailOn(err)
 
+	if ctrClient != nil {
+		useContainerdImages(printer, ctrClient, imageInspector)
+	}
+
 	if imageInspector.NoImage() {
-		fmt.Println("docker-slim[profile]: target image not found -", imageRef)
-		fmt.Println("docker-slim[profile]: state=exited")
-		return
+		printer.Info("target.image.error", "status", "not.found", "image", imageRef)
+		printer.State("exited")
+		runTracer.Finish(report.CmdStateExited)
+		runMetrics.Finish(report.CmdStateExited)
+		errutils.Exit(errutils.ExitCodeImageNotFound)
 	}
 
-	fmt.Println("docker-slim[profile]: state=inspecting.image")
+	printer.State("inspecting.image")
+	runMetrics.Phase("inspecting.image")
+	runTracer.Phase("inspecting.image")
 
 	logger.Info("inspecting 'fat' image metadata...")
 	err = imageInspector.Inspect()
 	errutils.FailOn(err)
 
+	runMetrics.SetImageSizes(imageInspector.ImageInfo.VirtualSize, 0, 0)
+
+	stateVolumePath, _ := fsutils.StateDirs(statePath, imageInspector.ImageInfo.ID)
+	unlockState := lockStateDir(printer, stateVolumePath)
+	defer unlockState()
+
 	localVolumePath, artifactLocation := fsutils.PrepareStateDirs(statePath, imageInspector.ImageInfo.ID)
+	sealState := sealStateDir(artifactLocation)
+	defer sealState()
+
 	imageInspector.ArtifactLocation = artifactLocation
+	if doAnalysisCache {
+		imageInspector.AnalysisCache = cache.New(localVolumePath)
+	}
 
-	fmt.Printf("docker-slim[profile]: info=image id=%v size.bytes=%v size.human=%v\n",
-		imageInspector.ImageInfo.ID,
-		imageInspector.ImageInfo.VirtualSize,
-		humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
+	printer.Info("image",
+		"id", imageInspector.ImageInfo.ID,
+		"size.bytes", imageInspector.ImageInfo.VirtualSize,
+		"size.human", humanize.Bytes(uint64(imageInspector.ImageInfo.VirtualSize)))
 
 	logger.Info("processing 'fat' image info...")
 	err = imageInspector.ProcessCollectedData()
 	errutils.FailOn(err)
 
-	fmt.Println("docker-slim[profile]: state=inspecting.container")
-
-	containerInspector, err := container.NewInspector(client,
-		imageInspector,
-		localVolumePath,
-		overrides,
-		links,
-		etcHostsMaps,
-		dnsServers,
-		dnsSearchDomains,
-		doShowContainerLogs,
-		volumeMounts,
-		excludePaths,
-		includePaths,
-		doDebug)
+	printer.State("inspecting.container")
+	runMetrics.Phase("inspecting.container")
+	runTracer.Phase("inspecting.container")
+
+	containerInspector, err := container.NewInspector(client, imageInspector, &container.InspectorOptions{
+		LocalVolumePath:   localVolumePath,
+		Overrides:         overrides,
+		Links:             links,
+		EtcHostsMaps:      etcHostsMaps,
+		DNSServers:        dnsServers,
+		DNSSearchDomains:  dnsSearchDomains,
+		ContainerName:     containerName,
+		ContainerLabels:   containerLabels,
+		ShowContainerLogs: doShowContainerLogs,
+		VolumeMounts:      volumeMounts,
+		ExcludePaths:      excludePaths,
+		IncludePaths:      includePaths,
+		SeccompMerge:      seccompMerge,
+		AnnotateSeccomp:   doAnnotateSeccomp,
+		Debug:             doDebug,
+		Kubernetes:        kubernetesConfig,
+		ContainerClient:   containerClient(ctrClient),
+		Timeouts:          timeouts,
+		ArtifactsTransfer: artifactsTransfer,
+		CompressArtifacts: doCompressArtifacts,
+		SensorThrottle:    sensorThrottle,
+		IPCTransport:      ipcTransport,
+		SensorDelivery:    sensorDelivery,
+		StatePath:         statePath,
+		ExecRedactPattern: execRedactPattern,
+		Dependencies:      dependencies,
+		IncludeDistro:     doIncludeDistro,
+		IncludeTzdata:     doIncludeTzdata,
+		IncludeLocales:    includeLocales,
+	})
 	errutils.FailOn(err)
 
 	logger.Info("starting instrumented 'fat' container...")
 	err = containerInspector.RunContainer()
-	errutils.FailOn(err)
+	failOnContainerError(err)
+
+	cmdReport.ContainerName = containerInspector.ContainerName
+	printer.Info("container",
+		"name", containerInspector.ContainerName,
+		"id", containerInspector.ContainerID)
+
+	showSensorEvents(printer, containerInspector)
+
+	if hookReport := runHook(printer, containerInspector, hooks, exec.HookBeforeMonitor, artifactLocation); hookReport != nil {
+		cmdReport.Hooks = append(cmdReport.Hooks, *hookReport)
+		if !hookReport.Passed {
+			//no probes if the target environment is not ready (the monitoring results would be incomplete)
+			errutils.WarnOn(containerInspector.FinishMonitoring())
+			errutils.WarnOn(containerInspector.ShutdownContainer())
+
+			printer.Info("hook",
+				"stage", hookReport.Stage,
+				"status", "failed",
+				"exit.code", hookReport.ExitCode,
+				"message", hookReport.Error)
+			printer.State("error", "message", "before-monitor hook failed")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "before-monitor hook failed"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+			errutils.FailCode("before-monitor hook failed", errutils.ExitCodeHookFailure)
+		}
+	}
 
 	logger.Info("watching container monitor...")
+	runMetrics.Phase("monitoring")
+	runTracer.Phase("monitoring")
 
 	if "probe" == continueAfter.Mode {
 		doHTTPProbe = true
 	}
 
+	var probe *http.CustomProbe
 	if doHTTPProbe {
-		probe, err := http.NewCustomProbe(containerInspector, httpProbeCmds, true, "docker-slim[profile]:")
-		errutils.FailOn(err)
+		probe, err = http.NewCustomProbe(containerInspector, httpProbeCmds, true, printer)
+		errutils.FailOnCode(err, errutils.ExitCodeProbeFailure)
 		probe.Start()
 		continueAfter.ContinueChan = probe.DoneChan()
 	}
 
-	switch continueAfter.Mode {
-	case "enter":
-		fmt.Println("docker-slim[profile]: info=prompt message='press <enter> when you are done using the container'")
-		creader := bufio.NewReader(os.Stdin)
-		_, _, _ = creader.ReadLine()
-	case "signal":
-		fmt.Println("docker-slim[profile]: info=prompt message='send SIGUSR1 when you are done using the container'")
-		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[profile]: info=event message='got SIGUSR1'")
-	case "timeout":
-		fmt.Printf("docker-slim[profile]: info=prompt message='waiting for the target container (%v seconds)'\n", int(continueAfter.Timeout))
-		<-time.After(time.Second * continueAfter.Timeout)
-		fmt.Printf("docker-slim[profile]: info=event message='done waiting for the target container'")
-	case "probe":
-		fmt.Println("docker-slim[profile]: info=prompt message='waiting for the HTTP probe to finish'")
-		<-continueAfter.ContinueChan
-		fmt.Println("docker-slim[profile]: info=event message='HTTP probe is done'")
-	default:
-		errutils.Fail("unknown continue-after mode")
-	}
-
-	containerInspector.FinishMonitoring()
+	var testProbe *exec.TestProbe
+	if execFile != "" {
+		testProbe, err = exec.NewTestProbe(containerInspector, execFile, true, printer)
+		errutils.FailOnCode(err, errutils.ExitCodeTestFailure)
+		testProbe.Start()
+		if "exec" == continueAfter.Mode {
+			continueAfter.ContinueChan = testProbe.DoneChan()
+		}
+	}
+
+	deadline := monitorDeadline(timeouts.Monitor)
+	isMonitoring := waitForContinue(printer, continueAfter, deadline)
+
+	if isMonitoring && targetRestarts > 0 {
+		isMonitoring, err = containerInspector.RestartTargets(targetRestarts, deadline, func(idx int) <-chan struct{} {
+			printer.Progress("target.restart", idx+1, targetRestarts)
+			if !doHTTPProbe {
+				return nil
+			}
+
+			probe, err := http.NewCustomProbe(containerInspector, httpProbeCmds, true, printer)
+			errutils.FailOnCode(err, errutils.ExitCodeProbeFailure)
+			probe.Start()
+			return probe.DoneChan()
+		})
+		failOnContainerError(err)
+
+		if !isMonitoring {
+			printer.Info("event", "message", "the maximum monitoring period is over")
+		}
+	}
+
+	if testProbe != nil {
+		//the test script is not done if the monitoring ended first (it's a failed run)
+		testProbe.Stop()
+		<-testProbe.DoneChan()
+		cmdReport.ExecProbe = testProbe.Report()
+	}
+
+	monitorErr := containerInspector.FinishMonitoring()
+	errutils.WarnOn(monitorErr)
+
+	//the target container is still running (the hook can collect more data from it)
+	if hookReport := runHook(printer, containerInspector, hooks, exec.HookAfterMonitor, artifactLocation); hookReport != nil {
+		cmdReport.Hooks = append(cmdReport.Hooks, *hookReport)
+	}
+
+	if probe != nil {
+		//the probe results are available only if the probe is done
+		select {
+		case <-probe.DoneChan():
+			cmdReport.HTTPProbe = probe.Report()
+			runMetrics.SetProbeResults(cmdReport.HTTPProbe.OkCount, cmdReport.HTTPProbe.ErrorCount)
+		default:
+		}
+	}
 
 	logger.Info("shutting down 'fat' container...")
 	err = containerInspector.ShutdownContainer()
 	errutils.WarnOn(err)
 
-	fmt.Println("docker-slim[profile]: state=processing")
+	if cmdReport.ExecProbe != nil && !cmdReport.ExecProbe.Passed {
+		//no profiles if the tests failed (the app behavior wasn't fully exercised)
+		printer.Info("exec.probe",
+			"status", "failed",
+			"exit.code", cmdReport.ExecProbe.ExitCode,
+			"message", cmdReport.ExecProbe.Error)
+		printer.State("error", "message", "test script failed")
+		cmdReport.State = report.CmdStateError
+		cmdReport.Error = "test script failed"
+		cmdReport.Save()
+		runTracer.Finish(report.CmdStateError)
+		runMetrics.Finish(report.CmdStateError)
+		errutils.FailCode("test script failed", errutils.ExitCodeTestFailure)
+	}
+
+	if hookReport := failedHook(cmdReport.Hooks); hookReport != nil {
+		printer.Info("hook",
+			"stage", hookReport.Stage,
+			"status", "failed",
+			"exit.code", hookReport.ExitCode,
+			"message", hookReport.Error)
+		printer.State("error", "message", "after-monitor hook failed")
+		cmdReport.State = report.CmdStateError
+		cmdReport.Error = "after-monitor hook failed"
+		cmdReport.Save()
+		runTracer.Finish(report.CmdStateError)
+		runMetrics.Finish(report.CmdStateError)
+		errutils.FailCode("after-monitor hook failed", errutils.ExitCodeHookFailure)
+	}
+
+	printer.State("processing")
+	runMetrics.Phase("processing")
+	runTracer.Phase("processing")
 
 	if !containerInspector.HasCollectedData() {
-		imageInspector.ShowFatImageDockerInstructions()
-		fmt.Printf("docker-slim[profile]: info=results status='no data collected (no minified image generated). (version: %v)'\n",
-			v.Current())
-		fmt.Println("docker-slim[profile]: state=exited")
-		return
+		imageInspector.ShowFatImageDockerInstructions(printer)
+		printer.Info("results",
+			"status", fmt.Sprintf("no data collected (no minified image generated). (version: %v)", v.Current()))
+		printer.State("exited")
+		runTracer.Finish(report.CmdStateExited)
+		runMetrics.Finish(report.CmdStateExited)
+
+		if monitorErr == container.ErrMonitorTimeout {
+			errutils.Exit(errutils.ExitCodeMonitorTimeout)
+		}
+
+		errutils.Exit(errutils.ExitCodeNoData)
+	}
+
+	printSensorStats(printer, artifactLocation)
+
+	if len(useArtifacts) > 0 {
+		logger.Info("merging artifacts from other monitoring runs...")
+		mergeResult, err := artifacts.Merge(artifactLocation, useArtifacts)
+		errutils.FailOn(err)
+
+		printer.Info("artifacts.merged",
+			"reports", mergeResult.ReportCount,
+			"files", mergeResult.FileCount,
+			"copied", mergeResult.CopiedCount)
 	}
 
 	logger.Info("processing instrumented 'fat' container info...")
 	err = containerInspector.ProcessCollectedData()
 	errutils.FailOn(err)
 
-	fmt.Println("docker-slim[profile]: state=completed")
+	if len(failOn) > 0 {
+		cmdReport.PolicyViolations = findingViolations(printer, containerInspector.Findings, failOn)
+		if len(cmdReport.PolicyViolations) > 0 {
+			//the findings are in the SARIF report in the artifacts directory
+			printer.State("error", "message", "policy violations found")
+			cmdReport.State = report.CmdStateError
+			cmdReport.Error = "policy violations found"
+			cmdReport.Save()
+			runTracer.Finish(report.CmdStateError)
+			runMetrics.Finish(report.CmdStateError)
+			errutils.FailCode("policy violations found", errutils.ExitCodePolicyFailure)
+		}
+	}
+
+	logger.Info("creating the size breakdown...")
+	imageInventory, err := loadImageInventory(imageInspector)
+	errutils.WarnOn(err)
+	if err == nil {
+		cmdReport.DirSizes, err = artifacts.DirSizes(imageInventory, artifactLocation)
+		errutils.WarnOn(err)
+
+		removedFiles, err := artifacts.SaveRemovedFiles(imageInventory, artifactLocation, doGzipRemovedFiles)
+		errutils.WarnOn(err)
+		if err == nil {
+			cmdReport.RemovedFilesName = removedFiles.Name
+			cmdReport.RemovedFilesCount = removedFiles.Count
+			printer.Info("results",
+				"removed.files", removedFiles.Count,
+				"removed.size", humanize.Bytes(uint64(removedFiles.Size)),
+				"artifacts.removed.files", removedFiles.Name)
+		}
+	}
+
+	if cmdReportFormat == report.FormatYAML {
+		err = report.SaveContainerReportYAML(artifactLocation)
+		errutils.WarnOn(err)
+	}
+
+	cmdReport.Capabilities = containerInspector.Capabilities
+	printer.Info("results",
+		"capabilities", strings.Join(cmdReport.Capabilities, ","))
+	printer.Info("results",
+		"capabilities.docker", strings.Join(capabilities.DockerRunOptions(cmdReport.Capabilities), " "))
+	printer.Info("results",
+		"capabilities.k8s", fmt.Sprintf("capabilities: {drop: [ALL], add: [%v]}", strings.Join(cmdReport.Capabilities, ", ")))
+
+	for _, info := range cmdReport.DirSizes {
+		printer.Info("size.breakdown",
+			"dir", info.Dir,
+			"original", humanize.Bytes(uint64(info.OriginalSize)),
+			"kept", humanize.Bytes(uint64(info.KeptSize)),
+			"dropped", humanize.Bytes(uint64(info.DroppedSize)),
+			"dropped.files", info.DroppedFileCount)
+	}
+
+	cmdReport.FindingsReportName = containerInspector.ImageInspector.FindingsReportName
+	cmdReport.FindingsCount = containerInspector.FindingsCount
+	printer.Info("results",
+		"findings", cmdReport.FindingsCount,
+		"report", cmdReport.FindingsReportName)
+	cmdReport.UnusedEnvVars = printEnvUsage(printer, containerInspector.EnvVars)
+	cmdReport.ExecutedBinaries = printExecs(printer, containerInspector.ImageInspector.ArtifactLocation)
+	cmdReport.Distro = printDistro(printer, containerInspector.ImageInspector.ArtifactLocation)
+
+	printer.State("completed")
 	cmdReport.State = report.CmdStateCompleted
 
+	printer.State("done")
+	cmdReport.State = report.CmdStateDone
+	cmdReport.Save()
+
+	if cmdReportUpload != "" {
+		uploadResults(printer, cmdReportUpload, cmdReportLocation, imageInspector)
+	}
+
 	if doRmFileArtifacts {
 		logger.Info("removing temporary artifacts...")
 		err = fsutils.Remove(artifactLocation) //TODO: remove only the "files" subdirectory
 		errutils.WarnOn(err)
 	}
-
-	fmt.Println("docker-slim[profile]: state=done")
-	cmdReport.State = report.CmdStateDone
-	cmdReport.Save()
+	runTracer.Finish(cmdReport.State)
+	runMetrics.Finish(cmdReport.State)
 }
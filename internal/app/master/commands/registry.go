@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/registry"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	"github.com/dustin/go-humanize"
+)
+
+// OnRegistryTags implements the 'registry tags' docker-slim command
+func OnRegistryTags(consoleFormat string, registryConfig *config.RegistryClient, repo string) {
+	printer := console.New("registry.tags", consoleFormat)
+	printer.State("started")
+
+	ref, err := registry.ParseReference(repo)
+	errutils.FailOn(err)
+
+	client, err := registry.New(registryConfig)
+	errutils.FailOn(err)
+
+	tags, err := client.Tags(ref)
+	audit.Registry(audit.ActionList, repo, err)
+	errutils.FailOn(err)
+
+	printer.Info("params", "registry", ref.Host, "repository", ref.Repository)
+	for _, tag := range tags {
+		printer.Info("tag", "name", tag)
+	}
+
+	printer.Info("results", "tags", len(tags))
+	printer.State("done")
+}
+
+// OnRegistryInspect implements the 'registry inspect' docker-slim command
+func OnRegistryInspect(consoleFormat string, registryConfig *config.RegistryClient, imageRef string) {
+	printer := console.New("registry.inspect", consoleFormat)
+	printer.State("started")
+
+	image := fetchRemoteImage(registryConfig, imageRef)
+
+	printer.Info("image",
+		"reference", image.Reference.String(),
+		"digest", image.Digest,
+		"media.type", image.Manifest.MediaType,
+		"platform", fmt.Sprintf("%v/%v", image.Config.OS, image.Config.Architecture))
+
+	if image.IndexDigest != "" {
+		printer.Info("index",
+			"digest", image.IndexDigest,
+			"platforms", strings.Join(image.Platforms, ","))
+	}
+
+	if image.Config.Created != nil {
+		printer.Info("config", "created", image.Config.Created.UTC())
+	}
+
+	var exposedPorts []string
+	for port := range image.Config.Config.ExposedPorts {
+		exposedPorts = append(exposedPorts, port)
+	}
+	sort.Strings(exposedPorts)
+
+	printer.Info("config",
+		"user", image.Config.Config.User,
+		"entrypoint", strings.Join(image.Config.Config.Entrypoint, " "),
+		"cmd", strings.Join(image.Config.Config.Cmd, " "),
+		"workdir", image.Config.Config.WorkingDir,
+		"ports", strings.Join(exposedPorts, ","))
+
+	for idx, layer := range image.Manifest.Layers {
+		printer.Info("layer",
+			"index", idx,
+			"digest", layer.Digest,
+			"size.bytes", layer.Size,
+			"size.human", humanize.Bytes(uint64(layer.Size)))
+	}
+
+	printer.Info("results",
+		"layers", len(image.Manifest.Layers),
+		"compressed.size.bytes", image.CompressedSize,
+		"compressed.size.human", humanize.Bytes(uint64(image.CompressedSize)))
+	printer.State("done")
+}
+
+// OnRegistryManifest implements the 'registry manifest' docker-slim command
+// (it prints the image manifest JSON)
+func OnRegistryManifest(registryConfig *config.RegistryClient, imageRef string) {
+	image := fetchRemoteImage(registryConfig, imageRef)
+	printJSON(image.RawManifest)
+}
+
+// OnRegistryConfig implements the 'registry config' docker-slim command
+// (it prints the image config JSON)
+func OnRegistryConfig(registryConfig *config.RegistryClient, imageRef string) {
+	image := fetchRemoteImage(registryConfig, imageRef)
+	printJSON(image.RawConfig)
+}
+
+func fetchRemoteImage(registryConfig *config.RegistryClient, imageRef string) *registry.Image {
+	ref, err := registry.ParseReference(imageRef)
+	errutils.FailOn(err)
+
+	client, err := registry.New(registryConfig)
+	errutils.FailOn(err)
+
+	image, err := client.Image(ref)
+	audit.Registry(audit.ActionInspect, imageRef, err)
+	errutils.FailOn(err)
+
+	return image
+}
+
+func printJSON(data []byte) {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		os.Stdout.Write(data)
+		return
+	}
+
+	fmt.Println(out.String())
+}
@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/artifacts"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Security profile names for the merged artifacts
+const (
+	mergedSeccompProfileName  = "merged-seccomp.json"
+	mergedAppArmorProfileName = "merged-apparmor-profile"
+)
+
+// OnReportDiff implements the 'report diff' docker-slim command
+func OnReportDiff(oldLocation, newLocation string, doJSON bool) {
+	oldSet, err := report.LoadReportSet(oldLocation)
+	errutils.FailOn(err)
+
+	newSet, err := report.LoadReportSet(newLocation)
+	errutils.FailOn(err)
+
+	diff := report.DiffReports(oldSet, newSet)
+
+	if doJSON {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		errutils.FailOn(err)
+
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("docker-slim[report.diff]: info=reports old='%v' new='%v'\n", diff.OldLocation, diff.NewLocation)
+
+	printSizeDiff("image.original", diff.OriginalImageSize)
+	printSizeDiff("image.minified", diff.MinifiedImageSize)
+	printListDiff("capabilities", diff.Capabilities)
+	printListDiff("files", diff.Files)
+	if len(diff.ChangedFiles) > 0 {
+		fmt.Printf("docker-slim[report.diff]: info=files.changed count=%v\n", len(diff.ChangedFiles))
+		for _, name := range diff.ChangedFiles {
+			fmt.Printf("docker-slim[report.diff]: info=files.changed  %v\n", name)
+		}
+	}
+	printListDiff("syscalls", diff.Syscalls)
+	printListDiff("sockets", diff.Sockets)
+
+	if oldSet.Container == nil || newSet.Container == nil {
+		fmt.Printf("docker-slim[report.diff]: info=message message='container report not available (files, syscalls and sockets not compared)'\n")
+	}
+}
+
+func printSizeDiff(name string, diff *report.SizeDiff) {
+	if diff == nil {
+		return
+	}
+
+	sign := "+"
+	delta := diff.Delta
+	if delta < 0 {
+		sign = "-"
+		delta = -delta
+	}
+
+	fmt.Printf("docker-slim[report.diff]: info=%v old='%v' new='%v' delta='%v%v'\n",
+		name,
+		humanize.Bytes(uint64(diff.Old)),
+		humanize.Bytes(uint64(diff.New)),
+		sign,
+		humanize.Bytes(uint64(delta)))
+}
+
+func printListDiff(name string, diff *report.ListDiff) {
+	if diff == nil {
+		return
+	}
+
+	fmt.Printf("docker-slim[report.diff]: info=%v added=%v removed=%v\n", name, len(diff.Added), len(diff.Removed))
+	for _, item := range diff.Added {
+		fmt.Printf("docker-slim[report.diff]: info=%v.added  %v\n", name, item)
+	}
+
+	for _, item := range diff.Removed {
+		fmt.Printf("docker-slim[report.diff]: info=%v.removed  %v\n", name, item)
+	}
+}
+
+// OnMerge implements the 'merge' (and 'report merge') docker-slim command:
+// it merges the artifacts and generates the security profiles for the merged container report
+func OnMerge(cmdName, consoleFormat, outputLocation string, sources []string) {
+	printer := console.New(cmdName, consoleFormat)
+
+	mergeResult, err := artifacts.Merge(outputLocation, sources)
+	errutils.FailOn(err)
+
+	printer.Info("artifacts.merged",
+		"location", outputLocation,
+		"reports", mergeResult.ReportCount,
+		"files", mergeResult.FileCount,
+		"copied", mergeResult.CopiedCount,
+		"syscalls", mergeResult.SyscallCount)
+
+	seccompProfileName := mergedSeccompProfileName
+	err = seccomp.GenProfile(outputLocation, seccompProfileName, "", nil)
+	if err == seccomp.ErrNoSyscallData {
+		//e.g., the merged node agent profiles
+		printer.Info("artifacts.seccomp", "message", "no system call data - skipping the seccomp profile")
+		seccompProfileName = ""
+		err = nil
+	}
+	errutils.FailOn(err)
+
+	err = apparmor.GenProfile(outputLocation, mergedAppArmorProfileName, nil)
+	errutils.FailOn(err)
+
+	printer.Info("artifacts.profiles",
+		"seccomp", seccompProfileName,
+		"apparmor", mergedAppArmorProfileName)
+}
@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/dockerrun"
+	"github.com/docker-slim/docker-slim/internal/app/master/version"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	runContainerNamePat = "dockerslimr_%v_%v"
+	runStopTimeout      = 10
+	runOutputWait       = time.Second
+	sigSysExitCode      = 128 + 31
+)
+
+// OnRun implements the 'run' docker-slim command
+func OnRun(
+	consoleFormat string,
+	doDebug bool,
+	statePath string,
+	clientConfig *config.DockerClient,
+	imageRef string,
+	artifactLocation string,
+	containerName string,
+	doDetach bool,
+	doRemove bool,
+	cmd []string) {
+	printer := console.New("run", consoleFormat)
+	printer.State("started")
+
+	client, closeClient := dockerclient.New(clientConfig)
+	defer closeClient()
+	err := client.Ping()
+	errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+
+	if doDebug {
+		version.Print(client)
+	}
+
+	imageInfo, err := client.InspectImage(imageRef)
+	if err == dockerapi.ErrNoSuchImage {
+		printer.Info("target.image.error", "status", "not.found", "image", imageRef)
+		printer.State("exited")
+		errutils.Exit(errutils.ExitCodeImageNotFound)
+	}
+	errutils.FailOn(err)
+
+	if artifactLocation == "" {
+		artifactLocation, err = dockerrun.FindArtifacts(statePath, imageInfo.ID)
+		if err != nil {
+			printer.Info("target.image.error",
+				"status", "no.artifacts",
+				"image", imageRef,
+				"message", "no saved security profiles for the image (build it with docker-slim or use --artifacts)")
+			printer.State("exited")
+			errutils.Exit(errutils.ExitCodeNoData)
+		}
+	}
+
+	runConfig, err := dockerrun.LoadRunConfig(artifactLocation)
+	errutils.FailOn(err)
+
+	runConfig.ImageName = imageRef
+	useAppArmor := apparmor.IsProfileLoaded(runConfig.AppArmorProfileName)
+
+	if containerName == "" {
+		containerName = fmt.Sprintf(runContainerNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	}
+
+	containerOptions, err := runConfig.ContainerOptions(containerName, cmd, useAppArmor)
+	errutils.FailOn(err)
+
+	appArmorStatus := runConfig.AppArmorProfileName
+	if !useAppArmor {
+		appArmorStatus = "not.loaded"
+	}
+
+	printer.Info("params",
+		"image", imageRef,
+		"artifacts.location", artifactLocation,
+		"capabilities", strings.Join(runConfig.Capabilities, ","),
+		"seccomp", runConfig.SeccompProfilePath,
+		"apparmor", appArmorStatus,
+		"read.only", runConfig.ReadOnly,
+		"ports", strings.Join(runConfig.Ports, ","))
+
+	containerInfo, err := client.CreateContainer(*containerOptions)
+	if err != nil {
+		audit.Container(audit.RuntimeDocker, audit.ActionCreate, containerOptions.Name, imageRef, err)
+	}
+	errutils.FailOn(err)
+
+	containerID := containerInfo.ID
+	audit.Container(audit.RuntimeDocker, audit.ActionCreate, containerID, imageRef, nil)
+
+	var attachErr chan error
+	if !doDetach {
+		attached := make(chan struct{})
+		attachErr = make(chan error, 1)
+		go func() {
+			attachErr <- client.AttachToContainer(dockerapi.AttachToContainerOptions{
+				Container:    containerID,
+				OutputStream: os.Stdout,
+				ErrorStream:  os.Stderr,
+				Stream:       true,
+				Stdout:       true,
+				Stderr:       true,
+				Success:      attached,
+			})
+		}()
+
+		select {
+		case <-attached:
+			attached <- struct{}{}
+		case err := <-attachErr:
+			errutils.FailOn(err)
+		}
+	}
+
+	err = client.StartContainer(containerID, nil)
+	errutils.FailOn(err)
+
+	printer.Info("container", "id", containerID, "name", containerName)
+
+	if doDetach {
+		printer.State("done")
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Debugf("docker-slim: stopping container => %v", containerID)
+		client.StopContainer(containerID, runStopTimeout)
+	}()
+
+	exitCode, err := client.WaitContainer(containerID)
+	errutils.FailOn(err)
+
+	select {
+	case <-attachErr:
+	case <-time.After(runOutputWait):
+	}
+
+	if doRemove {
+		removeOption := dockerapi.RemoveContainerOptions{
+			ID:            containerID,
+			RemoveVolumes: true,
+			Force:         true,
+		}
+
+		err := client.RemoveContainer(removeOption)
+		audit.Container(audit.RuntimeDocker, audit.ActionRemove, containerID, imageRef, err)
+		if err != nil {
+			log.Infof("docker-slim: error removing container => %v - %v", containerID, err)
+		}
+	}
+
+	printer.Info("results", "exit.code", exitCode)
+	if exitCode == sigSysExitCode {
+		printer.Info("results", "message", "container killed by a blocked system call (SIGSYS)")
+	}
+
+	printer.State("done")
+	if exitCode != 0 {
+		errutils.Exit(errutils.ExitCodeError)
+	}
+}
@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+)
+
+// OnSchema implements the 'schema' docker-slim command
+func OnSchema(name string) {
+	if name == "" {
+		fmt.Printf("docker-slim[schema]: info=schemas version=%v\n", report.SchemaVersion)
+		for _, schemaName := range report.SchemaNames() {
+			fmt.Printf("docker-slim[schema]: info=schema name=%v\n", schemaName)
+		}
+		return
+	}
+
+	schema, err := report.Schema(name)
+	errutils.FailOn(err)
+
+	fmt.Println(string(schema))
+}
@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/pkg/ipc/event"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// printSensorStats shows the sensor event counts
+// (including the dropped file events and the sampled out system calls)
+func printSensorStats(printer *console.Printer, artifactLocation string) {
+	creport, err := report.LoadContainerReport(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		log.Debugf("printSensorStats: error loading the container report - %v", err)
+		return
+	}
+
+	var params []interface{}
+	var overflows uint32
+	if fan := creport.Monitors.Fan; fan != nil {
+		overflows = fan.OverflowCount
+		params = append(params,
+			"file.events", fan.EventCount,
+			"file.overflows", overflows)
+	}
+
+	if pt := creport.Monitors.Pt; pt != nil {
+		params = append(params,
+			"syscalls", pt.SyscallCount,
+			"syscalls.sampled.out", pt.SampledOutCount)
+	}
+
+	if len(params) == 0 {
+		return
+	}
+
+	printer.Info("sensor.stats", params...)
+
+	if overflows > 0 {
+		printer.Info("event",
+			"message", fmt.Sprintf("the sensor dropped file events (%v queue overflows) - the minified image may miss files (try a larger --sensor-event-queue-size)", overflows))
+	}
+}
+
+// showSensorEvents shows the informational sensor events while the target container is monitored
+// (the monitoring progress and the sensor warnings)
+func showSensorEvents(printer *console.Printer, containerInspector *container.Inspector) {
+	evts := containerInspector.SensorEvents()
+	if evts == nil {
+		return
+	}
+
+	go func() {
+		for evt := range evts {
+			switch evt.Name {
+			case event.MonitorStartedName:
+				printer.Info("sensor.monitor", "status", "started")
+			case event.MonitorProgressName:
+				if evt.Progress == nil {
+					continue
+				}
+
+				printer.Info("sensor.progress",
+					"events", evt.Progress.EventCount,
+					"files", evt.Progress.FileCount,
+					"processes", evt.Progress.ProcessCount,
+					"syscalls", evt.Progress.SyscallCount,
+					"dropped", evt.Progress.DroppedCount)
+			case event.SensorWarningName:
+				printer.Info("sensor.warning", "message", evt.Warning)
+			}
+		}
+	}()
+}
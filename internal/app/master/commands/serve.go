@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/server"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+)
+
+// OnServe implements the 'serve' docker-slim command
+func OnServe(consoleFormat, statePath string, serverConfig *config.Server) {
+	printer := console.New("serve", consoleFormat)
+
+	runner, err := server.NewJobRunner(statePath, serverConfig.GlobalArgs)
+	errutils.FailOn(err)
+
+	profilesLocation, err := fsutils.PrepareProfilesDir(statePath)
+	errutils.FailOn(err)
+
+	printer.State("started")
+	printer.Info("params",
+		"listen", serverConfig.ListenAddr,
+		"max.jobs", serverConfig.MaxJobs,
+		"jobs", len(runner.Jobs()),
+		"auth", serverConfig.Token != "")
+
+	apiServer := server.New(serverConfig, runner, profilesLocation)
+	errutils.FailOn(apiServer.Run())
+}
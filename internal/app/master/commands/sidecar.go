@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/project"
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	sidecarReportPat = "sidecar.%d.report.json"
+	sidecarOutputPat = "sidecar.%d.log"
+)
+
+// sidecarRun is a sidecar build running in a child docker-slim process
+// (the sidecar container joins the target container network namespace)
+type sidecarRun struct {
+	image      string
+	reportPath string
+	outputPath string
+	cmd        *exec.Cmd
+	done       chan struct{}
+	err        error
+	stopOnce   sync.Once
+}
+
+// startSidecars starts the sidecar builds after the target container is started.
+// The sidecar builds continue when they get the continue signal,
+// so the sidecars are monitored for the same period the target container is.
+func startSidecars(printer *console.Printer, sidecars *config.Sidecars, containerID, location string) []*sidecarRun {
+	if sidecars == nil || len(sidecars.Images) == 0 {
+		return nil
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		exePath = os.Args[0]
+	}
+
+	var runs []*sidecarRun
+	for idx, image := range sidecars.Images {
+		run := &sidecarRun{
+			image:      image,
+			reportPath: filepath.Join(location, fmt.Sprintf(sidecarReportPat, idx+1)),
+			outputPath: filepath.Join(location, fmt.Sprintf(sidecarOutputPat, idx+1)),
+			done:       make(chan struct{}),
+		}
+
+		runs = append(runs, run)
+
+		args := sidecarArgs(sidecars.GlobalArgs, run.reportPath, containerID, idx+1, image)
+		if err := run.start(exePath, args, sidecars.Env); err != nil {
+			run.err = err
+			close(run.done)
+			printer.Info("sidecar.error", "image", image, "message", err.Error())
+			continue
+		}
+
+		printer.Info("sidecar", "image", image, "state", "started", "output", run.outputPath)
+	}
+
+	//the sidecar builds wait for the signal, so they are stopped if the target build fails
+	errutils.OnExit(func(code int) {
+		stopSidecars(runs)
+	})
+
+	return runs
+}
+
+// sidecarArgs creates the docker-slim command line for the sidecar build
+// (the sidecar sensor uses the next free pair of the IPC ports in the shared network namespace)
+func sidecarArgs(globalArgs []string, reportPath, containerID string, idx int, image string) []string {
+	cmdPort, _ := channel.SensorPorts(idx)
+
+	args := append([]string{}, globalArgs...)
+	return append(args,
+		"--report", reportPath,
+		"--report-format", "json",
+		"build",
+		"--config", project.NoFile,
+		"--network", container.NetworkModeContainerPrefix+containerID,
+		"--continue-after", "signal",
+		"--ipc-transport", container.IPCTransportExec,
+		"--sensor-port", strconv.Itoa(cmdPort),
+		image)
+}
+
+func (r *sidecarRun) start(exePath string, args, env []string) error {
+	output, err := os.Create(r.outputPath)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("sidecar: %v %v", exePath, args)
+	r.cmd = exec.Command(exePath, args...)
+	r.cmd.Env = env
+	r.cmd.Stdout = output
+	r.cmd.Stderr = output
+	if err := r.cmd.Start(); err != nil {
+		output.Close()
+		return err
+	}
+
+	go func() {
+		r.err = r.cmd.Wait()
+		output.Close()
+		close(r.done)
+	}()
+
+	return nil
+}
+
+// stop sends the continue signal to the sidecar build (the sidecar monitoring ends)
+func (r *sidecarRun) stop() {
+	r.stopOnce.Do(func() {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+
+		if err := r.cmd.Process.Signal(syscall.SIGUSR1); err != nil {
+			log.Debugf("sidecar: error signaling the %v build - %v", r.image, err)
+		}
+	})
+}
+
+func stopSidecars(runs []*sidecarRun) {
+	for _, run := range runs {
+		run.stop()
+	}
+}
+
+// waitForSidecars waits for the sidecar builds to finish and returns their results
+// (call it while the target container is still running, the sidecars use its network namespace)
+func waitForSidecars(printer *console.Printer, runs []*sidecarRun) []report.SidecarReport {
+	var results []report.SidecarReport
+	for _, run := range runs {
+		run.stop()
+		<-run.done
+
+		result := report.SidecarReport{
+			Image:          run.image,
+			ReportLocation: run.reportPath,
+			OutputLocation: run.outputPath,
+			ExitCode:       errutils.ExitCodeOk,
+		}
+
+		if run.err != nil {
+			result.ExitCode = errutils.ExitCodeError
+			result.Error = run.err.Error()
+			if exitErr, ok := run.err.(*exec.ExitError); ok {
+				result.ExitCode = exitErr.ExitCode()
+			}
+		}
+
+		if cmdReport := loadSidecarReport(run.reportPath); cmdReport != nil {
+			result.MinifiedImage = cmdReport.MinifiedImage
+			result.ContainerName = cmdReport.ContainerName
+			result.ArtifactLocation = cmdReport.ArtifactLocation
+			if cmdReport.Error != "" {
+				result.Error = cmdReport.Error
+			}
+		}
+
+		if result.Error != "" {
+			printer.Info("sidecar.error",
+				"image", result.Image,
+				"exit.code", result.ExitCode,
+				"message", result.Error,
+				"output", result.OutputLocation)
+		} else {
+			printer.Info("sidecar",
+				"image", result.Image,
+				"state", "done",
+				"minified.image", result.MinifiedImage,
+				"artifacts", result.ArtifactLocation)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func loadSidecarReport(reportPath string) *report.BuildCommand {
+	data, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		return nil
+	}
+
+	var cmdReport report.BuildCommand
+	if err := json.Unmarshal(data, &cmdReport); err != nil {
+		log.Debugf("sidecar: bad report %v - %v", reportPath, err)
+		return nil
+	}
+
+	return &cmdReport
+}
+
+// sidecarErrors returns the errors for the failed sidecar builds
+func sidecarErrors(results []report.SidecarReport) []string {
+	var errors []string
+	for _, result := range results {
+		if result.Error != "" || result.ExitCode != errutils.ExitCodeOk {
+			errors = append(errors, fmt.Sprintf("sidecar %v build failed (exit code %v)", result.Image, result.ExitCode))
+		}
+	}
+
+	return errors
+}
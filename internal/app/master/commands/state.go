@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/dockerrun"
+	"github.com/docker-slim/docker-slim/internal/app/master/state"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dustin/go-humanize"
+)
+
+// OnStateList implements the 'state ls' docker-slim command
+func OnStateList(consoleFormat, statePath string) {
+	printer := console.New("state.ls", consoleFormat)
+	printer.State("started")
+
+	images, err := state.List(statePath)
+	errutils.FailOn(err)
+
+	printer.Info("params", "location", fsutils.StateImagesDir(statePath))
+	for _, image := range images {
+		printStateImage(printer, "image", image)
+	}
+
+	printStateTotal(printer, "results", images)
+	printer.State("done")
+}
+
+// OnStateRemove implements the 'state rm' docker-slim command
+func OnStateRemove(consoleFormat, statePath string, imageIDs []string, doAll bool) {
+	printer := console.New("state.rm", consoleFormat)
+	printer.State("started")
+
+	images, err := state.List(statePath)
+	errutils.FailOn(err)
+
+	if !doAll {
+		images, err = state.Find(images, imageIDs)
+		if err != nil {
+			printer.Info("state.error", "message", err.Error())
+			printer.State("exited")
+			errutils.Exit(errutils.ExitCodeError)
+		}
+	}
+
+	removeStateImages(printer, statePath, images)
+	printer.State("done")
+}
+
+// OnStatePrune implements the 'state prune' docker-slim command
+func OnStatePrune(consoleFormat, statePath string, policy state.Policy, doDryRun bool) {
+	printer := console.New("state.prune", consoleFormat)
+	printer.State("started")
+
+	images, err := state.List(statePath)
+	errutils.FailOn(err)
+
+	selected, err := state.Select(images, policy, time.Now())
+	errutils.FailOn(err)
+
+	printer.Info("params",
+		"older.than", policy.MaxAge,
+		"max.size", humanize.Bytes(uint64(policy.MaxSize)),
+		"dry.run", doDryRun)
+
+	if doDryRun {
+		for _, image := range selected {
+			printStateImage(printer, "image.prunable", image)
+		}
+
+		printStateTotal(printer, "results", selected)
+		printer.State("done")
+		return
+	}
+
+	removeStateImages(printer, statePath, selected)
+	printer.State("done")
+}
+
+func removeStateImages(printer *console.Printer, statePath string, images []*state.Image) {
+	for _, image := range images {
+		errutils.FailOn(image.Remove())
+		printStateImage(printer, "image.removed", image)
+	}
+
+	//the 'run' command links for the removed minified image artifacts are removed too
+	linkCount, err := dockerrun.PruneImageLinks(statePath)
+	errutils.WarnOn(err)
+
+	printer.Info("results",
+		"removed", len(images),
+		"removed.size", humanize.Bytes(uint64(state.TotalSize(images))),
+		"removed.links", linkCount)
+}
+
+func printStateImage(printer *console.Printer, kind string, image *state.Image) {
+	printer.Info(kind,
+		"id", image.ID,
+		"size", humanize.Bytes(uint64(image.Size)),
+		"modified", humanize.Time(image.Modified),
+		"location", image.Location)
+}
+
+func printStateTotal(printer *console.Printer, kind string, images []*state.Image) {
+	printer.Info(kind,
+		"images", len(images),
+		"size", humanize.Bytes(uint64(state.TotalSize(images))))
+}
+
+// lockStateDir locks the image state directory for the command run
+// (the concurrent runs for the same image, e.g., the batch jobs, wait for each other)
+func lockStateDir(printer *console.Printer, localVolumePath string) func() {
+	unlock, err := fsutils.LockStateDir(localVolumePath, func() {
+		printer.Info("state.lock", "message", "waiting for another run with the same image to finish")
+	})
+	errutils.FailOn(err)
+
+	return unlock
+}
+
+// unsealStateDir decrypts the encrypted artifacts in the image state for the command run
+// and returns the function that encrypts them again (see sealStateDir)
+func unsealStateDir(printer *console.Printer, artifactLocation string) func() {
+	unsealed, err := fsutils.UnsealArtifacts(artifactLocation)
+	if err != nil {
+		printer.Info("state.encryption",
+			"location", artifactLocation,
+			"message", fmt.Sprintf("%v - use the same state key or remove the image state ('state rm')", err))
+	}
+	errutils.FailOn(err)
+
+	if unsealed && !fsutils.HasStateKey() {
+		printer.Info("state.encryption", "message", "the artifacts were decrypted (they are not encrypted again without the state key)")
+	}
+
+	return sealStateDir(artifactLocation)
+}
+
+// sealStateDir returns the function that encrypts the artifacts in the image state with the state key
+// (it does nothing without the state key). The artifacts are also encrypted when the command fails
+// or when it's interrupted, so the failed runs don't leave the unencrypted artifacts in the state.
+func sealStateDir(artifactLocation string) func() {
+	if !fsutils.HasStateKey() {
+		return func() {}
+	}
+
+	var once sync.Once
+	seal := func() {
+		once.Do(func() {
+			if err := fsutils.SealArtifacts(artifactLocation); err != nil {
+				log.Warnf("error encrypting the artifacts in %v - %v", artifactLocation, err)
+			}
+		})
+	}
+
+	errutils.OnExit(func(int) {
+		seal()
+	})
+	errutils.ExitOnSignals()
+	return seal
+}
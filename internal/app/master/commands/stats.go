@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/telemetry"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+)
+
+// OnStats implements the 'stats' docker-slim command
+func OnStats(consoleFormat, statePath string) {
+	printer := console.New("stats", consoleFormat)
+	printer.State("started")
+
+	records, err := telemetry.Load(statePath)
+	errutils.FailOn(err)
+
+	printer.Info("params", "location", fsutils.StateTelemetryDir(statePath))
+	if len(records) == 0 {
+		printer.Info("results", "message", "no telemetry records (enable the telemetry with --telemetry)")
+		printer.State("done")
+		return
+	}
+
+	for _, summary := range telemetry.Summarize(records) {
+		printer.Info("command",
+			"name", summary.Command,
+			"runs", summary.Runs,
+			"succeeded", summary.Succeeded,
+			"failed", summary.Failed,
+			"avg.duration", time.Duration(summary.AvgDurationSec)*time.Second)
+
+		for _, bucket := range telemetry.ReductionBuckets() {
+			if count := summary.SizeReductions[bucket]; count > 0 {
+				printer.Info("size.reduction",
+					"command", summary.Command,
+					"reduction", bucket,
+					"runs", count)
+			}
+		}
+	}
+
+	printer.Info("results", "records", len(records))
+	printer.State("done")
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/update"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+)
+
+const releaseCheckTimeout = 30 * time.Second
+
+// OnUpdate implements the 'update' docker-slim command
+func OnUpdate(consoleFormat, channel string, doCheckOnly, doForce bool) {
+	printer := console.New("update", consoleFormat)
+	printer.State("started")
+
+	release, err := update.LatestRelease(channel, releaseCheckTimeout)
+	errutils.FailOn(err)
+
+	isNewer := update.IsNewer(v.Tag(), release.Tag)
+	printer.Info("release",
+		"channel", channel,
+		"current", v.Tag(),
+		"latest", release.Tag,
+		"newer", isNewer,
+		"url", release.URL)
+
+	if doCheckOnly || (!isNewer && !doForce) {
+		printer.State("done")
+		return
+	}
+
+	location := fsutils.ExeDir()
+	printer.Info("install", "version", release.Tag, "location", location)
+
+	err = update.Install(release, location)
+	errutils.FailOn(err)
+
+	printer.Info("installed", "version", release.Tag)
+	printer.State("done")
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/artifacts"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/internal/app/master/upload"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/logutils"
+)
+
+// uploadResults uploads the command report, the container report and the generated profiles
+// (the artifacts that were not generated are skipped). The files from each run are uploaded
+// with their own prefix (the image name and the run ID) under the target location.
+func uploadResults(printer *console.Printer, target, cmdReportLocation string, imageInspector *image.Inspector) {
+	artifactLocation := imageInspector.ArtifactLocation
+	runPrefix := upload.RunPrefix(imageInspector.ImageRef, time.Now())
+	files := map[string]string{}
+
+	if cmdReportLocation != "" {
+		files[path.Join(runPrefix, filepath.Base(cmdReportLocation))] = cmdReportLocation
+	}
+
+	var seccompAnnotatedName string
+	if imageInspector.SeccompProfileName != "" {
+		seccompAnnotatedName = seccomp.AnnotatedProfileName(imageInspector.SeccompProfileName)
+	}
+
+	for _, name := range []string{
+		report.DefaultContainerReportFileName,
+		report.DefaultContainerReportYAMLFileName,
+		"Dockerfile",
+		"Dockerfile.fat",
+		imageInspector.SeccompProfileName,
+		seccompAnnotatedName,
+		imageInspector.AppArmorProfileName,
+		imageInspector.OCISpecName,
+		imageInspector.K8sSecurityContextName,
+		imageInspector.DockerRunScriptName,
+		imageInspector.ComposeSnippetName,
+		imageInspector.FindingsReportName,
+		artifacts.RemovedFilesName,
+		artifacts.RemovedFilesGzipName,
+		logutils.SensorLogFileName,
+	} {
+		if name != "" {
+			files[path.Join(runPrefix, name)] = filepath.Join(artifactLocation, name)
+		}
+	}
+
+	printer.Info("upload", "target", target, "prefix", runPrefix)
+	locations, err := upload.Files(target, files)
+	if err != nil {
+		printer.Info("upload.error", "message", err)
+	}
+
+	printer.Info("upload", "status", uploadStatus(err), "files", len(locations))
+}
+
+func uploadStatus(err error) string {
+	if err != nil {
+		return "failed"
+	}
+
+	return "done"
+}
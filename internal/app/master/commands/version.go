@@ -1,13 +1,20 @@
 package commands
 
 import (
+	"time"
+
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	"github.com/docker-slim/docker-slim/internal/app/master/version"
 )
 
 // OnVersion implements the 'version' docker-slim command
-func OnVersion(clientConfig *config.DockerClient) {
-	client := dockerclient.New(clientConfig)
+func OnVersion(clientConfig *config.DockerClient, doCheckUpdate bool, checkTimeout time.Duration) {
+	client, closeClient := dockerclient.New(clientConfig)
+	defer closeClient()
 	version.Print(client)
+
+	if doCheckUpdate {
+		version.PrintUpdateCheck(checkTimeout)
+	}
 }
@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/server"
+	"github.com/docker-slim/docker-slim/internal/app/master/version"
+	"github.com/docker-slim/docker-slim/internal/app/master/watch"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// OnWatch implements the 'watch' docker-slim command
+func OnWatch(
+	consoleFormat string,
+	doDebug bool,
+	statePath string,
+	clientConfig *config.DockerClient,
+	watchConfig *config.Watch,
+	imageRef string) {
+	logger := log.WithFields(log.Fields{"app": "docker-slim", "command": "watch"})
+
+	printer := console.New("watch", consoleFormat)
+	printer.State("started")
+
+	client, closeClient := dockerclient.New(clientConfig)
+	defer closeClient()
+	err := client.Ping()
+	errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+
+	if doDebug {
+		version.Print(client)
+	}
+
+	watchLocation, err := fsutils.PrepareWatchDir(statePath)
+	errutils.FailOn(err)
+
+	state, err := watch.LoadState(watchLocation, imageRef)
+	errutils.FailOn(err)
+
+	if watchConfig.BuildArgs != nil {
+		state.BuildArgs = watchConfig.BuildArgs
+	}
+
+	errutils.FailOn(state.Save(watchLocation))
+
+	printer.Info("params",
+		"target", imageRef,
+		"interval", watchConfig.Interval,
+		"pull", watchConfig.DoPull,
+		"build.flags", strings.Join(state.BuildArgs, " "))
+
+	runner, err := server.NewJobRunner(statePath, watchConfig.GlobalArgs)
+	errutils.FailOn(err)
+
+	runner.Start(1)
+
+	for {
+		checkImage(printer, client, runner, watchLocation, state, watchConfig.DoPull)
+
+		if watchConfig.RunOnce {
+			break
+		}
+
+		logger.Debugf("next image check in %v", watchConfig.Interval)
+		time.Sleep(watchConfig.Interval)
+	}
+
+	printer.State("done")
+}
+
+// checkImage rebuilds the minified image if the fat image changed since the last successful build
+// (the failed builds are retried on the next check)
+func checkImage(
+	printer *console.Printer,
+	client *docker.Client,
+	runner *server.JobRunner,
+	watchLocation string,
+	state *watch.State,
+	doPull bool) {
+	now := time.Now().UTC()
+	state.LastChecked = &now
+
+	imageID, err := watch.ImageID(client, state.Image, doPull)
+	if err != nil {
+		printer.Info("image.error", "image", state.Image, "error", err)
+		return
+	}
+
+	if imageID == state.ImageID {
+		printer.Info("image.unchanged", "image", state.Image, "id", imageID)
+		saveWatchState(state, watchLocation)
+		return
+	}
+
+	printer.Info("image.changed", "image", state.Image, "id", imageID, "previous.id", state.ImageID)
+
+	job, err := runner.Queue(&server.JobRequest{
+		Command: server.CommandBuild,
+		Image:   state.Image,
+		Args:    state.BuildArgs,
+	})
+	if err != nil {
+		printer.Info("build.error", "image", state.Image, "error", err)
+		return
+	}
+
+	runner.Wait()
+	job = runner.Job(job.ID)
+
+	state.LastJobID = job.ID
+	if job.State == server.JobStateDone {
+		state.ImageID = imageID
+		state.LastBuilt = job.Finished
+	}
+
+	printer.Info("build",
+		"image", state.Image,
+		"state", job.State,
+		"exit.code", job.ExitCode,
+		"minified.image", job.MinifiedImage,
+		"job", job.ID)
+
+	saveWatchState(state, watchLocation)
+}
+
+func saveWatchState(state *watch.State, watchLocation string) {
+	if err := state.Save(watchLocation); err != nil {
+		log.Warnf("docker-slim: error saving the watch state - %v", err)
+	}
+}
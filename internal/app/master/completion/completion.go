@@ -0,0 +1,288 @@
+package completion
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Supported shells
+const (
+	ShellBash       = "bash"
+	ShellZsh        = "zsh"
+	ShellFish       = "fish"
+	ShellPowerShell = "powershell"
+)
+
+// imagesCmd lists the local Docker images (the untagged images are skipped)
+const imagesCmd = `docker images --format '{{.Repository}}:{{.Tag}}' 2>/dev/null | grep -v '<none>'`
+
+// Command is a command (or a subcommand) with its completion data
+type Command struct {
+	Name    string
+	Aliases []string
+	Usage   string
+	// Flags are the flag names without the dashes (e.g., 'http-probe')
+	Flags []string
+	// ImageArg is true if the command argument is a local image
+	ImageArg    bool
+	Subcommands []*Command
+}
+
+// Spec is the command line interface the completions are generated for
+type Spec struct {
+	Program  string
+	Flags    []string
+	Commands []*Command
+}
+
+// Shells returns the supported shells
+func Shells() []string {
+	return []string{ShellBash, ShellZsh, ShellFish, ShellPowerShell}
+}
+
+// Generate writes the completion script for the shell
+func Generate(w io.Writer, shell string, spec *Spec) error {
+	var script bytes.Buffer
+	switch shell {
+	case ShellBash:
+		genBash(&script, spec)
+	case ShellZsh:
+		//zsh runs the bash completion function with bashcompinit
+		fmt.Fprintf(&script, "#compdef %s\n\n", spec.Program)
+		script.WriteString("autoload -U +X bashcompinit && bashcompinit\n\n")
+		genBash(&script, spec)
+	case ShellFish:
+		genFish(&script, spec)
+	case ShellPowerShell:
+		genPowerShell(&script, spec)
+	default:
+		return fmt.Errorf("unsupported shell - %s (supported shells: %s)", shell, strings.Join(Shells(), ", "))
+	}
+
+	_, err := w.Write(script.Bytes())
+	return err
+}
+
+func genBash(w *bytes.Buffer, spec *Spec) {
+	fnName := "_" + strings.NewReplacer("-", "_", " ", "_").Replace(spec.Program)
+
+	fmt.Fprintf(w, "# bash completion for %s\n\n", spec.Program)
+	fmt.Fprintf(w, "%s() {\n", fnName)
+	w.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	w.WriteString("\tlocal path=\"\" word flags=\"\" words=\"\" images=\"\" i\n")
+	w.WriteString("\tfor ((i=1; i<COMP_CWORD; i++)); do\n")
+	w.WriteString("\t\tword=\"${COMP_WORDS[i]}\"\n")
+	w.WriteString("\t\tcase \"$path/$word\" in\n")
+	walkCommands(spec.Commands, "", func(cmd *Command, parent string) {
+		fmt.Fprintf(w, "\t\t%s) path=\"%s\" ;;\n",
+			strings.Join(prefixed(parent+"/", names(cmd)), "|"), joinPath(parent, cmd.Name))
+	})
+	w.WriteString("\t\tesac\n")
+	w.WriteString("\tdone\n\n")
+
+	w.WriteString("\tcase \"$path\" in\n")
+	fmt.Fprintf(w, "\t\"\")\n\t\tflags=\"%s\"\n\t\twords=\"%s\"\n\t\t;;\n",
+		strings.Join(flagArgs(spec.Flags), " "), strings.Join(commandNames(spec.Commands), " "))
+	walkCommands(spec.Commands, "", func(cmd *Command, parent string) {
+		fmt.Fprintf(w, "\t\"%s\")\n", joinPath(parent, cmd.Name))
+		fmt.Fprintf(w, "\t\tflags=\"%s\"\n", strings.Join(flagArgs(cmd.Flags), " "))
+		if len(cmd.Subcommands) > 0 {
+			fmt.Fprintf(w, "\t\twords=\"%s\"\n", strings.Join(commandNames(cmd.Subcommands), " "))
+		}
+		if cmd.ImageArg {
+			w.WriteString("\t\timages=1\n")
+		}
+		w.WriteString("\t\t;;\n")
+	})
+	w.WriteString("\tesac\n\n")
+
+	w.WriteString("\tif [[ \"$cur\" == -* ]]; then\n")
+	w.WriteString("\t\tCOMPREPLY=( $(compgen -W \"$flags\" -- \"$cur\") )\n")
+	w.WriteString("\t\treturn\n")
+	w.WriteString("\tfi\n\n")
+	w.WriteString("\tif [[ -n \"$images\" ]]; then\n")
+	fmt.Fprintf(w, "\t\twords=\"$words $(%s)\"\n", imagesCmd)
+	w.WriteString("\tfi\n\n")
+	w.WriteString("\tCOMPREPLY=( $(compgen -W \"$words\" -- \"$cur\") )\n")
+	w.WriteString("}\n\n")
+	fmt.Fprintf(w, "complete -o default -F %s %s\n", fnName, spec.Program)
+}
+
+func genFish(w *bytes.Buffer, spec *Spec) {
+	fmt.Fprintf(w, "# fish completion for %s\n\n", spec.Program)
+
+	for _, name := range spec.Flags {
+		fmt.Fprintf(w, "complete -c %s %s\n", spec.Program, fishFlag(name))
+	}
+
+	allNames := commandNames(spec.Commands)
+	for _, cmd := range spec.Commands {
+		fmt.Fprintf(w, "complete -c %s -n 'not __fish_seen_subcommand_from %s' -a '%s' -d '%s'\n",
+			spec.Program, strings.Join(allNames, " "), cmd.Name, fishQuote(cmd.Usage))
+	}
+
+	for _, cmd := range spec.Commands {
+		condition := fmt.Sprintf("__fish_seen_subcommand_from %s", strings.Join(names(cmd), " "))
+		genFishCommand(w, spec.Program, cmd, condition)
+
+		for _, sub := range cmd.Subcommands {
+			subCondition := fmt.Sprintf("%s; and __fish_seen_subcommand_from %s", condition, strings.Join(names(sub), " "))
+			fmt.Fprintf(w, "complete -c %s -n '%s; and not __fish_seen_subcommand_from %s' -a '%s' -d '%s'\n",
+				spec.Program, condition, strings.Join(commandNames(cmd.Subcommands), " "), sub.Name, fishQuote(sub.Usage))
+			genFishCommand(w, spec.Program, sub, subCondition)
+		}
+	}
+}
+
+func genFishCommand(w *bytes.Buffer, program string, cmd *Command, condition string) {
+	for _, name := range cmd.Flags {
+		fmt.Fprintf(w, "complete -c %s -n '%s' %s\n", program, condition, fishFlag(name))
+	}
+
+	if cmd.ImageArg {
+		fmt.Fprintf(w, "complete -c %s -n '%s' -a '(%s)'\n",
+			program, condition, strings.Replace(imagesCmd, "'", "\"", -1))
+	}
+}
+
+func genPowerShell(w *bytes.Buffer, spec *Spec) {
+	fmt.Fprintf(w, "# powershell completion for %s\n\n", spec.Program)
+	fmt.Fprintf(w, "Register-ArgumentCompleter -Native -CommandName '%s' -ScriptBlock {\n", spec.Program)
+	w.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n\n")
+
+	w.WriteString("    $completions = @{\n")
+	fmt.Fprintf(w, "        '' = @(%s)\n",
+		psList(append(flagArgs(spec.Flags), commandNames(spec.Commands)...)))
+	walkCommands(spec.Commands, "", func(cmd *Command, parent string) {
+		words := flagArgs(cmd.Flags)
+		if len(cmd.Subcommands) > 0 {
+			words = append(words, commandNames(cmd.Subcommands)...)
+		}
+		fmt.Fprintf(w, "        '%s' = @(%s)\n", joinSpaced(parent, cmd.Name), psList(words))
+	})
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    $aliases = @{\n")
+	walkCommands(spec.Commands, "", func(cmd *Command, parent string) {
+		for _, alias := range cmd.Aliases {
+			fmt.Fprintf(w, "        '%s' = '%s'\n", joinSpaced(parent, alias), joinSpaced(parent, cmd.Name))
+		}
+	})
+	w.WriteString("    }\n\n")
+
+	var imageCommands []string
+	walkCommands(spec.Commands, "", func(cmd *Command, parent string) {
+		if cmd.ImageArg {
+			imageCommands = append(imageCommands, joinSpaced(parent, cmd.Name))
+		}
+	})
+	fmt.Fprintf(w, "    $imageCommands = @(%s)\n\n", psList(imageCommands))
+
+	w.WriteString(`    $path = ''
+    foreach ($element in ($commandAst.CommandElements | Select-Object -Skip 1)) {
+        if ($element.Extent.StartOffset -ge ($cursorPosition - $wordToComplete.Length)) {
+            break
+        }
+
+        $next = ("$path " + $element.ToString()).Trim()
+        if ($aliases.ContainsKey($next)) {
+            $next = $aliases[$next]
+        }
+
+        if ($completions.ContainsKey($next)) {
+            $path = $next
+        }
+    }
+
+    $candidates = @($completions[$path])
+    if (($imageCommands -contains $path) -and -not $wordToComplete.StartsWith('-')) {
+        $candidates += @(docker images --format '{{.Repository}}:{{.Tag}}' 2>$null | Where-Object { $_ -notmatch '<none>' })
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`)
+}
+
+// walkCommands calls the function for each command and subcommand with the parent command path
+func walkCommands(cmds []*Command, parent string, fn func(cmd *Command, parent string)) {
+	for _, cmd := range cmds {
+		fn(cmd, parent)
+		walkCommands(cmd.Subcommands, joinPath(parent, cmd.Name), fn)
+	}
+}
+
+func names(cmd *Command) []string {
+	return append([]string{cmd.Name}, cmd.Aliases...)
+}
+
+func commandNames(cmds []*Command) []string {
+	var all []string
+	for _, cmd := range cmds {
+		all = append(all, cmd.Name)
+	}
+
+	sort.Strings(all)
+	return all
+}
+
+func flagArgs(flags []string) []string {
+	var args []string
+	for _, name := range flags {
+		if len(name) == 1 {
+			args = append(args, "-"+name)
+			continue
+		}
+
+		args = append(args, "--"+name)
+	}
+
+	return args
+}
+
+func fishFlag(name string) string {
+	if len(name) == 1 {
+		return "-s " + name
+	}
+
+	return "-l " + name
+}
+
+func fishQuote(text string) string {
+	return strings.Replace(text, "'", "\\'", -1)
+}
+
+func psList(items []string) string {
+	quoted := make([]string, 0, len(items))
+	for _, item := range items {
+		quoted = append(quoted, "'"+strings.Replace(item, "'", "''", -1)+"'")
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func prefixed(prefix string, items []string) []string {
+	all := make([]string, 0, len(items))
+	for _, item := range items {
+		all = append(all, prefix+item)
+	}
+
+	return all
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "/" + name
+}
+
+func joinSpaced(parent, name string) string {
+	return strings.Replace(joinPath(parent, name), "/", " ", -1)
+}
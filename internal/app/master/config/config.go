@@ -26,16 +26,47 @@ type VolumeMount struct {
 	Options     string
 }
 
+// Dependency provides the parameters for a dependency container started before the target container
+// (e.g., a database the target app needs to start)
+type Dependency struct {
+	Image string
+	// Alias is the host name the target app uses to connect to the dependency
+	Alias string
+	Env   []string
+	// Ready is the readiness check: 'tcp:<port>', 'exec:<command>' or empty (the container is running)
+	Ready string
+}
+
+// MonitorHooks provides the host commands that run before and after the target container monitoring
+// (e.g., to seed a database or to collect extra evidence)
+type MonitorHooks struct {
+	BeforeMonitor string
+	AfterMonitor  string
+}
+
+// Sidecars provides the parameters for the sidecar containers monitored with the target container
+// (e.g., an envoy proxy). The sidecars share the target container network namespace
+// and each sidecar image is built by its own docker-slim process.
+type Sidecars struct {
+	Images []string
+	// GlobalArgs are the global options for the sidecar docker-slim processes
+	GlobalArgs []string
+	// Env is the environment for the sidecar docker-slim processes
+	Env []string
+}
+
 // HTTPProbeCmd provides the HTTP probe parameters
 type HTTPProbeCmd struct {
 	Method   string   `json:"method"`
 	Resource string   `json:"resource"`
+	Host     string   `json:"host,omitempty"`
 	Port     int      `json:"port"`
 	Protocol string   `json:"protocol"`
 	Headers  []string `json:"headers"`
 	Body     string   `json:"body"`
 	Username string   `json:"username"`
 	Password string   `json:"password"`
+	Timeout  int      `json:"timeout,omitempty"`
 }
 
 // HTTPProbeCmds is a list of HTTPProbeCmd instances
@@ -48,8 +79,16 @@ type DockerClient struct {
 	UseTLS      bool
 	VerifyTLS   bool
 	TLSCertPath string
-	Host        string
-	Env         map[string]string
+	//the custom TLS files (they replace the files in the cert path and they are used for the registries too)
+	TLSCACert string
+	TLSCert   string
+	TLSKey    string
+	//the registries accessed without the TLS certificate verification
+	InsecureRegistries []string
+	Host               string
+	Context            string
+	UsePodman          bool
+	Env                map[string]string
 }
 
 // ContinueAfter provides the command execution mode parameters
@@ -58,3 +97,145 @@ type ContinueAfter struct {
 	Timeout      time.Duration
 	ContinueChan <-chan struct{}
 }
+
+// Timeouts provides the per-phase timeouts (zero values use the built-in behavior)
+type Timeouts struct {
+	//the target container (and the sensor) startup
+	ContainerStart time.Duration
+	//the target app readiness (before the HTTP probe starts)
+	AppReady time.Duration
+	//the maximum monitoring period (no limit by default)
+	Monitor time.Duration
+	//the sensor "done" event after the monitoring is stopped
+	SensorDone time.Duration
+	//the artifact copy from the container (with the Docker API transfer) or the pod
+	ArtifactCopy time.Duration
+	//the minified image build
+	ImageBuild time.Duration
+}
+
+// SensorThrottle provides the sensor overhead controls (zero values use the built-in behavior)
+type SensorThrottle struct {
+	//record only one of each N calls of the same system call (the other calls are only counted)
+	PtraceSampleRate int
+	//the monitor event queue size
+	EventQueueSize int
+	//the scheduling priority adjustment for the sensor threads
+	Nice int
+}
+
+// SizeBudget provides the minified image size thresholds (zero values are not checked)
+type SizeBudget struct {
+	//the maximum minified image size in bytes
+	MaxSize int64
+	//the minimum size reduction (percent of the original image size)
+	MinReduction float64
+}
+
+// SeccompMerge provides the parameters to merge the generated seccomp profile with a baseline profile
+type SeccompMerge struct {
+	Baseline string
+	Mode     string
+}
+
+// Metrics provides the run metrics parameters
+type Metrics struct {
+	PushGateway string
+	ListenAddr  string
+	Linger      time.Duration
+	// Telemetry is nil if the anonymous usage telemetry is not enabled
+	Telemetry *Telemetry
+}
+
+// Telemetry provides the opt-in anonymous usage telemetry parameters
+// (the run records are saved in the state path and sent to the endpoint if it's set)
+type Telemetry struct {
+	Endpoint  string
+	StatePath string
+}
+
+// Tracing provides the OpenTelemetry tracing parameters
+type Tracing struct {
+	Endpoint string
+	Headers  map[string]string
+}
+
+// Server provides the 'serve' mode parameters
+type Server struct {
+	ListenAddr string
+	MaxJobs    int
+	Token      string
+	GlobalArgs []string
+}
+
+// Lambda provides the AWS Lambda container image mode parameters
+type Lambda struct {
+	EventFiles []string
+	RIEPath    string
+}
+
+// Swarm provides the parameters to profile a running Docker Swarm service task
+type Swarm struct {
+	Service  string
+	Duration time.Duration
+}
+
+// Agent provides the Kubernetes node agent configuration
+// (the pod containers on the node are selected by the pod label selector)
+type Agent struct {
+	NodeName        string
+	Selector        string
+	Duration        time.Duration
+	Interval        time.Duration
+	RunOnce         bool
+	RuntimeEndpoint string
+	ServerURL       string
+	ServerToken     string
+	BuildArgs       []string
+}
+
+// Watch provides the 'watch' mode configuration
+// (the stored build options are used if BuildArgs is nil)
+type Watch struct {
+	Interval   time.Duration
+	DoPull     bool
+	RunOnce    bool
+	BuildArgs  []string
+	GlobalArgs []string
+}
+
+// RegistryClient provides the remote registry client parameters
+// (the Docker config credentials are used if Username is empty)
+type RegistryClient struct {
+	Username string
+	Password string
+	Insecure bool
+	Platform string
+	//the TLS options (the custom CA bundle, the client certificate and the insecure registries)
+	TLS *DockerClient
+}
+
+// Kubernetes provides the parameters to run the target container in a Kubernetes cluster
+// (the cluster is accessed using kubectl)
+type Kubernetes struct {
+	Namespace   string
+	Context     string
+	Kubeconfig  string
+	HelperImage string
+}
+
+// K8sPatch provides the parameters to generate the Kubernetes manifest patches for the minified image
+type K8sPatch struct {
+	Workload  string
+	Container string
+	Base      string
+}
+
+// Containerd provides the containerd runtime parameters
+// (containerd is accessed using ctr)
+type Containerd struct {
+	Address   string
+	Namespace string
+	//the target container is connected to the CNI network (ctr uses the default CNI configuration)
+	CNI bool
+}
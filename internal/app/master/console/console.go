@@ -0,0 +1,228 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Console output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Console event types
+const (
+	EventState    = "state"
+	EventInfo     = "info"
+	EventProgress = "progress"
+	EventBlock    = "block"
+	EventResult   = "result"
+)
+
+// in the quiet mode the printers print only the final command results
+var quietMode bool
+
+// SetQuiet enables or disables the quiet mode for the new printers
+func SetQuiet(quiet bool) {
+	quietMode = quiet
+}
+
+// Progress describes the progress of a multi-step operation
+type Progress struct {
+	Current int `json:"current"`
+	Total   int `json:"total"`
+}
+
+// Event is one console event in the JSON console output (one event per line)
+type Event struct {
+	Time     string            `json:"time"`
+	Command  string            `json:"command"`
+	Type     string            `json:"type"`
+	Phase    string            `json:"phase"`
+	Status   string            `json:"status,omitempty"`
+	Progress *Progress         `json:"progress,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// Printer prints the command states and results to the console
+// (as the 'docker-slim[command]: key=value' lines or as a line-delimited JSON event stream)
+type Printer struct {
+	command string
+	format  string
+	phase   string
+	quiet   bool
+	out     io.Writer
+	lock    sync.Mutex
+}
+
+// New creates a new console printer for a command
+func New(command, format string) *Printer {
+	if format != FormatJSON {
+		format = FormatText
+	}
+
+	return &Printer{
+		command: command,
+		format:  format,
+		quiet:   quietMode,
+		out:     os.Stdout,
+	}
+}
+
+// IsValidFormat returns true if the console output format is supported
+func IsValidFormat(format string) bool {
+	return format == FormatText || format == FormatJSON
+}
+
+// JSON returns true if the console output is a JSON event stream
+func (p *Printer) JSON() bool {
+	return p.format == FormatJSON
+}
+
+// State prints a command state change (params are the key/value pairs with the extra state information)
+func (p *Printer) State(state string, params ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.phase = state
+	if p.quiet {
+		return
+	}
+
+	if p.JSON() {
+		p.writeEvent(&Event{Type: EventState, Data: toData(params)})
+		return
+	}
+
+	p.writeLine(fmt.Sprintf("state=%s", state), params)
+}
+
+// Info prints command information (params are the key/value pairs with the information data)
+func (p *Printer) Info(kind string, params ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.quiet {
+		return
+	}
+
+	if p.JSON() {
+		p.writeEvent(&Event{Type: EventInfo, Status: kind, Data: toData(params)})
+		return
+	}
+
+	p.writeLine(fmt.Sprintf("info=%s", kind), params)
+}
+
+// Progress prints the progress of a multi-step operation
+func (p *Printer) Progress(kind string, current, total int, params ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.quiet {
+		return
+	}
+
+	if p.JSON() {
+		p.writeEvent(&Event{
+			Type:     EventProgress,
+			Status:   kind,
+			Progress: &Progress{Current: current, Total: total},
+			Data:     toData(params),
+		})
+		return
+	}
+
+	params = append([]interface{}{"count", fmt.Sprintf("%d/%d", current, total)}, params...)
+	p.writeLine(fmt.Sprintf("info=%s", kind), params)
+}
+
+// Block prints a block of text (e.g., the build logs)
+func (p *Printer) Block(title, text string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.quiet {
+		return
+	}
+
+	if p.JSON() {
+		p.writeEvent(&Event{Type: EventBlock, Status: title, Data: map[string]string{"text": text}})
+		return
+	}
+
+	fmt.Fprintf(p.out, "docker-slim[%s]: %s ====================\n", p.command, title)
+	fmt.Fprintln(p.out, text)
+	fmt.Fprintf(p.out, "docker-slim[%s]: end of %s =============\n", p.command, title)
+}
+
+// Result prints the final command result in the quiet mode
+// (the result is already a part of the regular command output in the normal mode)
+func (p *Printer) Result(value string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.quiet {
+		return
+	}
+
+	if p.JSON() {
+		p.writeEvent(&Event{Type: EventResult, Data: map[string]string{"value": value}})
+		return
+	}
+
+	fmt.Fprintln(p.out, value)
+}
+
+func (p *Printer) writeLine(prefix string, params []interface{}) {
+	var line bytes.Buffer
+	fmt.Fprintf(&line, "docker-slim[%s]: %s", p.command, prefix)
+
+	for idx := 0; idx+1 < len(params); idx += 2 {
+		fmt.Fprintf(&line, " %v=%s", params[idx], textValue(params[idx+1]))
+	}
+
+	fmt.Fprintln(p.out, line.String())
+}
+
+func (p *Printer) writeEvent(event *Event) {
+	event.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	event.Command = p.command
+	event.Phase = p.phase
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(p.out, string(data))
+}
+
+func textValue(value interface{}) string {
+	text := fmt.Sprintf("%v", value)
+	if text == "" || strings.ContainsAny(text, " \t") {
+		return fmt.Sprintf("'%s'", text)
+	}
+
+	return text
+}
+
+func toData(params []interface{}) map[string]string {
+	if len(params) < 2 {
+		return nil
+	}
+
+	data := map[string]string{}
+	for idx := 0; idx+1 < len(params); idx += 2 {
+		data[fmt.Sprintf("%v", params[idx])] = fmt.Sprintf("%v", params[idx+1])
+	}
+
+	return data
+}
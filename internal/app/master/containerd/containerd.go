@@ -0,0 +1,524 @@
+package containerd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/registry"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	// DefaultAddress is the default containerd socket
+	DefaultAddress = "/run/containerd/containerd.sock"
+	// DefaultNamespace is the default containerd namespace
+	DefaultNamespace = "default"
+
+	ctrBin              = "ctr"
+	missingLayerID      = "<missing>"
+	taskDeleteRetries   = 10
+	taskDeleteInterval  = 500 * time.Millisecond
+	exportDirPattern    = "docker-slim-export-"
+	exportPipeName      = "image.tar"
+	importFilePattern   = "docker-slim-import-"
+	execIDPat           = "docker-slim-exec-%d-%d"
+	imageListDigestCol  = 2
+	imageListMinColumns = 3
+)
+
+// ErrNoCtr is returned when ctr is not installed
+var ErrNoCtr = errors.New("ctr not found")
+
+// Client runs ctr commands (images and containers in the configured containerd namespace)
+// (it's the containerd runtime ImageClient and ContainerClient)
+type Client struct {
+	Config  *config.Containerd
+	ctrPath string
+	//image IDs (config digests) to the image references
+	imageRefs map[string]string
+	//the number of the started exec processes (for the unique exec IDs)
+	execCount uint64
+}
+
+// New creates a new ctr client
+func New(cfg *config.Containerd) (*Client, error) {
+	ctrPath, err := exec.LookPath(ctrBin)
+	if err != nil {
+		return nil, ErrNoCtr
+	}
+
+	return &Client{
+		Config:    cfg,
+		ctrPath:   ctrPath,
+		imageRefs: map[string]string{},
+	}, nil
+}
+
+// Name returns the container runtime name
+func (c *Client) Name() string {
+	return runtime.Containerd
+}
+
+func (c *Client) command(args ...string) *exec.Cmd {
+	var ctrArgs []string
+	if c.Config.Address != "" {
+		ctrArgs = append(ctrArgs, "--address", c.Config.Address)
+	}
+
+	if c.Config.Namespace != "" {
+		ctrArgs = append(ctrArgs, "--namespace", c.Config.Namespace)
+	}
+
+	ctrArgs = append(ctrArgs, args...)
+	log.Debugf("containerd: ctr %v", strings.Join(ctrArgs, " "))
+	return exec.Command(c.ctrPath, ctrArgs...)
+}
+
+func (c *Client) run(stdin io.Reader, stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := c.command(args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("ctr %v: %v", strings.Join(args[:commandNameLen(args)], " "), message)
+		}
+
+		return fmt.Errorf("ctr %v: %v", strings.Join(args[:commandNameLen(args)], " "), err)
+	}
+
+	return nil
+}
+
+//the ctr commands have two parts (e.g., 'images ls') except 'run' and 'version'
+func commandNameLen(args []string) int {
+	if len(args) > 1 && args[0] != "run" && args[0] != "version" {
+		return 2
+	}
+
+	return 1
+}
+
+// Ping checks if containerd is available
+func (c *Client) Ping() error {
+	return c.run(nil, nil, "version")
+}
+
+// NormalizeRef returns the fully qualified image reference containerd uses
+// (e.g., 'nginx' is 'docker.io/library/nginx:latest')
+func NormalizeRef(imageRef string) string {
+	if strings.HasPrefix(imageRef, "sha256:") {
+		return imageRef
+	}
+
+	ref, err := registry.ParseReference(imageRef)
+	if err != nil {
+		return imageRef
+	}
+
+	return ref.String()
+}
+
+// ImageRef returns the image reference for an image ID or an image reference
+func (c *Client) ImageRef(name string) string {
+	if ref, ok := c.imageRefs[name]; ok {
+		return ref
+	}
+
+	return NormalizeRef(name)
+}
+
+type imageConfig struct {
+	Created      time.Time        `json:"created"`
+	Author       string           `json:"author"`
+	Architecture string           `json:"architecture"`
+	OS           string           `json:"os"`
+	Config       dockerapi.Config `json:"config"`
+	History      []struct {
+		Created    time.Time `json:"created"`
+		CreatedBy  string    `json:"created_by"`
+		Comment    string    `json:"comment"`
+		EmptyLayer bool      `json:"empty_layer"`
+	} `json:"history"`
+}
+
+type imageContent struct {
+	Ref      string
+	Manifest registry.Manifest
+	Config   imageConfig
+}
+
+// images returns the image references and their target digests
+func (c *Client) images(filters ...string) (map[string]string, error) {
+	var out bytes.Buffer
+	args := append([]string{"images", "ls"}, filters...)
+	if err := c.run(nil, &out, args...); err != nil {
+		return nil, err
+	}
+
+	images := map[string]string{}
+	scanner := bufio.NewScanner(&out)
+	for isHeader := true; scanner.Scan(); isHeader = false {
+		fields := strings.Fields(scanner.Text())
+		if isHeader || len(fields) < imageListMinColumns {
+			continue
+		}
+
+		images[fields[0]] = fields[imageListDigestCol]
+	}
+
+	return images, scanner.Err()
+}
+
+func (c *Client) content(digest string, data interface{}) error {
+	var out bytes.Buffer
+	if err := c.run(nil, &out, "content", "get", digest); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(out.Bytes(), data)
+}
+
+// loadImage returns the image manifest and config
+// (for the multi-platform images the manifest is selected for the current platform)
+func (c *Client) loadImage(ref, digest string) (*imageContent, error) {
+	image := &imageContent{Ref: ref}
+	if err := c.content(digest, &image.Manifest); err != nil {
+		return nil, err
+	}
+
+	if image.Manifest.IsIndex() {
+		var manifestDigest string
+		for _, desc := range image.Manifest.Manifests {
+			if desc.Platform != nil &&
+				desc.Platform.OS == goruntime.GOOS &&
+				desc.Platform.Architecture == goruntime.GOARCH {
+				manifestDigest = desc.Digest
+				break
+			}
+		}
+
+		if manifestDigest == "" {
+			return nil, registry.ErrNoPlatform
+		}
+
+		image.Manifest = registry.Manifest{}
+		if err := c.content(manifestDigest, &image.Manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	if image.Manifest.Config == nil {
+		return nil, registry.ErrUnsupportedManifest
+	}
+
+	if err := c.content(image.Manifest.Config.Digest, &image.Config); err != nil {
+		return nil, err
+	}
+
+	c.imageRefs[image.Manifest.Config.Digest] = ref
+	return image, nil
+}
+
+func (c *Client) inspect(name string) (*imageContent, error) {
+	ref := c.ImageRef(name)
+	images, err := c.images("name==" + ref)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, ok := images[ref]
+	if !ok {
+		return nil, dockerapi.ErrNoSuchImage
+	}
+
+	return c.loadImage(ref, digest)
+}
+
+// InspectImage returns the image metadata
+// (the image ID is the image config digest and the image size is the size of the compressed layers)
+func (c *Client) InspectImage(name string) (*dockerapi.Image, error) {
+	image, err := c.inspect(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	for _, layer := range image.Manifest.Layers {
+		size += layer.Size
+	}
+
+	return &dockerapi.Image{
+		ID:           image.Manifest.Config.Digest,
+		Created:      image.Config.Created,
+		Author:       image.Config.Author,
+		Config:       &image.Config.Config,
+		Architecture: image.Config.Architecture,
+		Size:         size,
+		VirtualSize:  size,
+	}, nil
+}
+
+// ListImages returns the images in the namespace
+// (the images without the content for the current platform are skipped)
+func (c *Client) ListImages() ([]dockerapi.APIImages, error) {
+	images, err := c.images()
+	if err != nil {
+		return nil, err
+	}
+
+	imagesByID := map[string]*dockerapi.APIImages{}
+	var imageList []dockerapi.APIImages
+	for ref, digest := range images {
+		image, err := c.loadImage(ref, digest)
+		if err != nil {
+			log.Debugf("containerd.ListImages: skipping %v - %v", ref, err)
+			continue
+		}
+
+		id := image.Manifest.Config.Digest
+		if info, ok := imagesByID[id]; ok {
+			info.RepoTags = append(info.RepoTags, registry.FamiliarRef(ref))
+			continue
+		}
+
+		imagesByID[id] = &dockerapi.APIImages{
+			ID:       id,
+			RepoTags: []string{registry.FamiliarRef(ref)},
+			Created:  image.Config.Created.Unix(),
+		}
+	}
+
+	for _, info := range imagesByID {
+		imageList = append(imageList, *info)
+	}
+
+	return imageList, nil
+}
+
+// ImageHistory returns the image history from the image config (the latest layer first)
+func (c *Client) ImageHistory(name string) ([]dockerapi.ImageHistory, error) {
+	image, err := c.inspect(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []dockerapi.ImageHistory
+	for idx := len(image.Config.History) - 1; idx >= 0; idx-- {
+		entry := image.Config.History[idx]
+		layerID := missingLayerID
+		if len(history) == 0 {
+			layerID = image.Manifest.Config.Digest
+		}
+
+		history = append(history, dockerapi.ImageHistory{
+			ID:        layerID,
+			Created:   entry.Created.Unix(),
+			CreatedBy: entry.CreatedBy,
+			Comment:   entry.Comment,
+		})
+	}
+
+	if len(history) > 0 {
+		history[0].Tags = []string{registry.FamiliarRef(image.Ref)}
+	}
+
+	return history, nil
+}
+
+// ExportImage streams the image archive
+// (ctr saves the image archives only to files, so it writes to a named pipe instead of a staged archive file)
+func (c *Client) ExportImage(name string, output io.Writer) error {
+	pipeDir, err := ioutil.TempDir("", exportDirPattern)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(pipeDir)
+
+	pipePath := filepath.Join(pipeDir, exportPipeName)
+	if err := syscall.Mkfifo(pipePath, 0600); err != nil {
+		return err
+	}
+
+	//the pipe is also opened for writing here, so opening it for reading doesn't wait for ctr
+	//(and doesn't hang if ctr fails before it opens the pipe)
+	pipeWriter, err := os.OpenFile(pipePath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer pipeWriter.Close()
+
+	reader, err := os.Open(pipePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	exportErr := make(chan error, 1)
+	go func() {
+		err := c.run(nil, nil, "images", "export", pipePath, c.ImageRef(name))
+		//the reader gets EOF when both ctr and this pipe writer are done
+		pipeWriter.Close()
+		exportErr <- err
+	}()
+
+	if _, err := io.Copy(output, reader); err != nil {
+		//ctr stops when the pipe has no readers
+		reader.Close()
+		pipeWriter.Close()
+		<-exportErr
+		return err
+	}
+
+	return <-exportErr
+}
+
+// ImportImage loads the image archive ('docker save' format)
+func (c *Client) ImportImage(input io.Reader) error {
+	file, err := ioutil.TempFile("", importFilePattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, input); err != nil {
+		return err
+	}
+
+	return c.run(nil, nil, "images", "import", file.Name())
+}
+
+// RemoveImage removes the image reference
+// (containerd removes the image content when it has no references)
+func (c *Client) RemoveImage(name string) error {
+	return c.run(nil, nil, "images", "rm", c.ImageRef(name))
+}
+
+// PullImage pulls the image to the namespace
+// (ctr doesn't use the Docker credentials, so only the public images can be pulled)
+func (c *Client) PullImage(name string, output io.Writer) error {
+	imageRef := c.ImageRef(name)
+	err := c.run(nil, output, "images", "pull", imageRef)
+	audit.Image(runtime.Containerd, audit.ActionPull, imageRef, err)
+	return err
+}
+
+// RunContainer creates and starts a container
+// (the container task has its own network namespace with only the loopback interface
+// unless the CNI networking is enabled and the container output is not kept)
+func (c *Client) RunContainer(options *runtime.ContainerOptions) error {
+	args := []string{"run", "--detach", "--null-io"}
+	if c.Config.CNI {
+		args = append(args, "--cni")
+	}
+
+	if options.Privileged {
+		args = append(args, "--privileged")
+	}
+
+	for _, mount := range options.Mounts {
+		mountMode := "rw"
+		if mount.ReadOnly {
+			mountMode = "ro"
+		}
+
+		args = append(args, "--mount",
+			fmt.Sprintf("type=bind,src=%s,dst=%s,options=rbind:%s", mount.Source, mount.Destination, mountMode))
+	}
+
+	for _, envVar := range options.Env {
+		args = append(args, "--env", envVar)
+	}
+
+	for name, value := range options.Labels {
+		args = append(args, "--label", name+"="+value)
+	}
+
+	args = append(args, c.ImageRef(options.ImageRef), options.ID)
+	args = append(args, options.Args...)
+	err := c.run(nil, nil, args...)
+	audit.Container(runtime.Containerd, audit.ActionCreate, options.ID, options.ImageRef, err)
+	return err
+}
+
+// ExecContainer runs the command in the container task
+// (the command runs in the container namespaces)
+func (c *Client) ExecContainer(id string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	execID := fmt.Sprintf(execIDPat, os.Getpid(), atomic.AddUint64(&c.execCount, 1))
+	args := append([]string{"tasks", "exec", "--exec-id", execID, id}, cmd...)
+	command := c.command(args...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	//the input is copied separately, so the command doesn't wait for the end of the input after it exits
+	var input io.WriteCloser
+	if stdin != nil {
+		var err error
+		if input, err = command.StdinPipe(); err != nil {
+			return err
+		}
+	}
+
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	if input != nil {
+		go func() {
+			io.Copy(input, stdin)
+			input.Close()
+		}()
+	}
+
+	if err := command.Wait(); err != nil {
+		return fmt.Errorf("ctr tasks exec: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveContainer kills the container task and deletes the container
+func (c *Client) RemoveContainer(id string) error {
+	if err := c.run(nil, nil, "tasks", "kill", "--signal", "SIGKILL", id); err != nil {
+		log.Debugf("containerd.RemoveContainer: %v", err)
+	}
+
+	//the task can be deleted only after it exits
+	var err error
+	for retry := 0; retry < taskDeleteRetries; retry++ {
+		if err = c.run(nil, nil, "tasks", "delete", id); err == nil {
+			break
+		}
+
+		time.Sleep(taskDeleteInterval)
+	}
+
+	if err != nil {
+		log.Debugf("containerd.RemoveContainer: %v", err)
+	}
+
+	err = c.run(nil, nil, "containers", "delete", id)
+	audit.Container(runtime.Containerd, audit.ActionRemove, id, "", err)
+	return err
+}
@@ -0,0 +1,129 @@
+package containerd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+)
+
+// fakeCtr saves the ctr arguments and runs 'head -c 5' for the exec commands
+const fakeCtr = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args.txt"
+if [ "$1" = "tasks" ] && [ "$2" = "exec" ]; then
+  head -c 5
+fi
+`
+
+func newTestClient(t *testing.T, cfg *config.Containerd) (*Client, string) {
+	dir, err := ioutil.TempDir("", "dslim-ctr-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	ctrPath := filepath.Join(dir, "ctr")
+	if err := ioutil.WriteFile(ctrPath, []byte(fakeCtr), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Client{
+		Config:    cfg,
+		ctrPath:   ctrPath,
+		imageRefs: map[string]string{},
+	}, filepath.Join(dir, "args.txt")
+}
+
+func TestRunContainer(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *config.Containerd
+		expected string
+	}{
+		{
+			name:     "own network namespace",
+			config:   &config.Containerd{Namespace: "k8s.io"},
+			expected: "--namespace k8s.io run --detach --null-io --privileged --mount type=bind,src=/tmp/artifacts,dst=/opt/dockerslim/artifacts,options=rbind:rw docker.io/library/app:latest app.slim /opt/dockerslim/bin/sensor -d\n",
+		},
+		{
+			name:     "cni network",
+			config:   &config.Containerd{CNI: true},
+			expected: "run --detach --null-io --cni --privileged --mount type=bind,src=/tmp/artifacts,dst=/opt/dockerslim/artifacts,options=rbind:rw docker.io/library/app:latest app.slim /opt/dockerslim/bin/sensor -d\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, argsPath := newTestClient(t, test.config)
+			err := client.RunContainer(&runtime.ContainerOptions{
+				ID:         "app.slim",
+				ImageRef:   "app",
+				Args:       []string{"/opt/dockerslim/bin/sensor", "-d"},
+				Mounts:     []runtime.Mount{{Source: "/tmp/artifacts", Destination: "/opt/dockerslim/artifacts"}},
+				Privileged: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			args, err := ioutil.ReadFile(argsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(args) != test.expected {
+				t.Fatalf("unexpected ctr arguments:\n%s\nexpected:\n%s", args, test.expected)
+			}
+		})
+	}
+}
+
+func TestExecContainer(t *testing.T) {
+	client, argsPath := newTestClient(t, &config.Containerd{})
+
+	//the input is not closed, so the exec has to return when the command exits
+	input, inputWriter := io.Pipe()
+	defer inputWriter.Close()
+
+	go inputWriter.Write([]byte("hello world"))
+
+	var output bytes.Buffer
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- client.ExecContainer("app.slim", []string{"/opt/dockerslim/bin/sensor", "-relay", "127.0.0.1:65501"}, input, &output, ioutil.Discard)
+	}()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the exec doesn't return after the command exits")
+	}
+
+	if output.String() != "hello" {
+		t.Fatalf("unexpected exec output: %q", output.String())
+	}
+
+	args, err := ioutil.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := strings.Fields(string(args))
+	if len(fields) != 8 || fields[0] != "tasks" || fields[1] != "exec" || fields[2] != "--exec-id" ||
+		!strings.HasPrefix(fields[3], "docker-slim-exec-") || fields[4] != "app.slim" || fields[6] != "-relay" {
+		t.Fatalf("unexpected ctr arguments: %s", args)
+	}
+}
@@ -0,0 +1,256 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	containerNamePat = "dockerslimd_%v_%v"
+	labelName        = "dockerslim.debug"
+	sharedModePat    = "container:%s"
+)
+
+const attachDrainTimeout = time.Second
+
+// Default debug side-car image and command
+const (
+	DefaultImage = "busybox:latest"
+	DefaultCmd   = "sh"
+)
+
+// debug side-car capabilities (to inspect the target processes and their file systems with /proc/<pid>/root)
+var sideCarCapabilities = []string{"SYS_PTRACE", "SYS_ADMIN"}
+
+// ErrTargetNotRunning is returned when the target container is not running
+var ErrTargetNotRunning = errors.New("target container is not running")
+
+// SideCar is a debugging container sharing the pid, network and ipc namespaces and the volumes with the target container
+type SideCar struct {
+	Target        string
+	TargetID      string
+	ImageRef      string
+	Cmd           []string
+	ContainerID   string
+	ContainerName string
+	APIClient     *dockerapi.Client
+}
+
+// New creates a new debug side-car for the running target container
+func New(client *dockerapi.Client, target, imageRef string, cmd []string) (*SideCar, error) {
+	targetInfo, err := client.InspectContainer(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if targetInfo.State.Pid == 0 || !targetInfo.State.Running {
+		return nil, ErrTargetNotRunning
+	}
+
+	if imageRef == "" {
+		imageRef = DefaultImage
+	}
+
+	if len(cmd) == 0 {
+		cmd = []string{DefaultCmd}
+	}
+
+	sideCar := &SideCar{
+		Target:    target,
+		TargetID:  targetInfo.ID,
+		ImageRef:  imageRef,
+		Cmd:       cmd,
+		APIClient: client,
+	}
+
+	return sideCar, nil
+}
+
+// PullImage pulls the side-car image if it's not available locally
+func (s *SideCar) PullImage() error {
+	_, err := s.APIClient.InspectImage(s.ImageRef)
+	if err == nil {
+		return nil
+	}
+
+	if err != dockerapi.ErrNoSuchImage {
+		return err
+	}
+
+	repo, tag := s.ImageRef, "latest"
+	if idx := strings.LastIndex(repo, ":"); idx > strings.LastIndex(repo, "/") {
+		repo, tag = repo[:idx], repo[idx+1:]
+	}
+
+	log.Infof("debug: pulling the side-car image => %v", s.ImageRef)
+	err = s.APIClient.PullImage(dockerapi.PullImageOptions{
+		Repository:   repo,
+		Tag:          tag,
+		OutputStream: os.Stderr,
+	}, dockerapi.AuthConfiguration{})
+	audit.Image(audit.RuntimeDocker, audit.ActionPull, s.ImageRef, err)
+	return err
+}
+
+// Run starts the side-car container and connects it to the terminal
+// (it returns the side-car exit code when the side-car command exits)
+func (s *SideCar) Run() (int, error) {
+	s.ContainerName = fmt.Sprintf(containerNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	sharedMode := fmt.Sprintf(sharedModePat, s.TargetID)
+
+	isTerminal := isTerminal(os.Stdin)
+	containerOptions := dockerapi.CreateContainerOptions{
+		Name: s.ContainerName,
+		Config: &dockerapi.Config{
+			Image:        s.ImageRef,
+			Cmd:          s.Cmd,
+			Labels:       map[string]string{"type": labelName},
+			Tty:          isTerminal,
+			OpenStdin:    true,
+			StdinOnce:    true,
+			AttachStdin:  true,
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+		HostConfig: &dockerapi.HostConfig{
+			PidMode:     sharedMode,
+			NetworkMode: sharedMode,
+			IpcMode:     sharedMode,
+			VolumesFrom: []string{s.TargetID},
+			CapAdd:      sideCarCapabilities,
+		},
+	}
+
+	containerInfo, err := s.APIClient.CreateContainer(containerOptions)
+	audit.Container(audit.RuntimeDocker, audit.ActionCreate, s.ContainerName, s.ImageRef, err)
+	if err != nil {
+		return -1, err
+	}
+
+	s.ContainerID = containerInfo.ID
+	log.Debugf("debug: created side-car container => %v", s.ContainerID)
+	defer s.remove()
+
+	if isTerminal {
+		restore, err := makeRaw()
+		if err != nil {
+			return -1, err
+		}
+		defer restore()
+	}
+
+	attached := make(chan struct{})
+	attachErr := make(chan error, 1)
+	go func() {
+		attachErr <- s.APIClient.AttachToContainer(dockerapi.AttachToContainerOptions{
+			Container:    s.ContainerID,
+			InputStream:  os.Stdin,
+			OutputStream: os.Stdout,
+			ErrorStream:  os.Stderr,
+			Stream:       true,
+			Stdin:        true,
+			Stdout:       true,
+			Stderr:       true,
+			RawTerminal:  isTerminal,
+			Success:      attached,
+		})
+	}()
+
+	select {
+	case <-attached:
+		attached <- struct{}{}
+	case err := <-attachErr:
+		return -1, err
+	}
+
+	if err := s.APIClient.StartContainer(s.ContainerID, nil); err != nil {
+		return -1, err
+	}
+
+	if isTerminal {
+		if height, width, err := terminalSize(); err == nil {
+			s.APIClient.ResizeContainerTTY(s.ContainerID, height, width)
+		}
+	}
+
+	exitCode, err := s.APIClient.WaitContainer(s.ContainerID)
+
+	//give the attached streams a chance to copy the remaining output
+	//(the stdin copy may stay blocked until the next key press, so there's a timeout)
+	select {
+	case <-attachErr:
+	case <-time.After(attachDrainTimeout):
+	}
+
+	return exitCode, err
+}
+
+func (s *SideCar) remove() {
+	removeOption := dockerapi.RemoveContainerOptions{
+		ID:            s.ContainerID,
+		RemoveVolumes: true,
+		Force:         true,
+	}
+
+	err := s.APIClient.RemoveContainer(removeOption)
+	audit.Container(audit.RuntimeDocker, audit.ActionRemove, s.ContainerName, s.ImageRef, err)
+	if err != nil {
+		log.Infof("debug: error removing side-car container => %v - %v", s.ContainerID, err)
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// makeRaw puts the terminal into the raw mode (with 'stty', so there's no platform specific terminal code)
+// and returns the function to restore the original terminal settings
+func makeRaw() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		stty(strings.TrimSpace(state))
+	}, nil
+}
+
+func terminalSize() (int, int, error) {
+	output, err := stty("size")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var height, width int
+	if _, err := fmt.Sscanf(output, "%d %d", &height, &width); err != nil {
+		return 0, 0, err
+	}
+
+	return height, width, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
@@ -1,7 +1,6 @@
 package dockerclient
 
 import (
-	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -12,56 +11,99 @@ import (
 	log "github.com/Sirupsen/logrus"
 )
 
-// New creates a new Docker client instance
-func New(config *config.DockerClient) *docker.Client {
+// New creates a new Docker client instance. The close function releases the local resources
+// the client uses (e.g., the local socket for the ssh:// Docker hosts). It's also called
+// when the application is terminated by one of the failure functions.
+func New(config *config.DockerClient) (*docker.Client, func()) {
 	var client *docker.Client
+	closeFunc := func() {}
 	var err error
 
+	//the custom TLS files replace the matching files in the cert path
+	//(the client certificate is optional with the custom CA bundle)
 	newTLSClient := func(host string, certPath string, verify bool) (*docker.Client, error) {
-		var ca []byte
+		caFile, certFile, keyFile := config.TLSCACert, config.TLSCert, config.TLSKey
+		if certPath != "" {
+			if caFile == "" {
+				caFile = filepath.Join(certPath, "ca.pem")
+			}
 
-		cert, err := ioutil.ReadFile(filepath.Join(certPath, "cert.pem"))
-		if err != nil {
-			return nil, err
+			if certFile == "" {
+				certFile = filepath.Join(certPath, "cert.pem")
+				keyFile = filepath.Join(certPath, "key.pem")
+			}
 		}
 
-		key, err := ioutil.ReadFile(filepath.Join(certPath, "key.pem"))
+		tlsConfig, err := NewTLSConfig(caFile, certFile, keyFile, false, !verify)
 		if err != nil {
 			return nil, err
 		}
 
-		if verify {
-			var err error
-			ca, err = ioutil.ReadFile(filepath.Join(certPath, "ca.pem"))
-			if err != nil {
-				return nil, err
-			}
+		return newTLSConfigClient(host, tlsConfig)
+	}
+
+	hasTLSFiles := config.TLSCertPath != "" || config.TLSCACert != "" || config.TLSCert != ""
+
+	//the Docker CLI context is used only if the Docker host is not set (the same way the Docker CLI does it)
+	//and if the Podman socket is not selected
+	if config.Host == "" && config.Env["DOCKER_HOST"] == "" && !config.UsePodman {
+		contextName := CurrentContext(config.Context)
+		endpoint, err := LoadContextEndpoint(contextName)
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+
+		if endpoint != nil {
+			config.Host = endpoint.Host
+			config.UseTLS = endpoint.TLSCertPath != ""
+			config.VerifyTLS = !endpoint.SkipTLSVerify
+			config.TLSCertPath = endpoint.TLSCertPath
+			log.Debugf("docker-slim: using Docker context %v (%v)", contextName, config.Host)
 		}
+	}
 
-		return docker.NewVersionedTLSClientFromBytes(host, cert, key, ca, "")
+	//the custom TLS files are used for the Docker host from the environment too
+	if config.Host == "" && config.Env["DOCKER_HOST"] != "" &&
+		(config.TLSCACert != "" || config.TLSCert != "") &&
+		!IsSSHHost(config.Env["DOCKER_HOST"]) {
+		config.Host = config.Env["DOCKER_HOST"]
+		if config.TLSCertPath == "" {
+			config.TLSCertPath = config.Env["DOCKER_CERT_PATH"]
+		}
 	}
 
 	switch {
+	case IsSSHHost(config.Host) ||
+		(config.Host == "" && IsSSHHost(config.Env["DOCKER_HOST"])):
+		if config.Host == "" {
+			config.Host = config.Env["DOCKER_HOST"]
+		}
+
+		client, closeFunc, err = NewSSHClient(config.Host)
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+		errutils.OnExit(func(int) {
+			closeFunc()
+		})
+		log.Debug("docker-slim: new Docker client (ssh) [0]")
+
 	case config.Host != "" &&
 		config.UseTLS &&
 		config.VerifyTLS &&
-		config.TLSCertPath != "":
+		hasTLSFiles:
 		client, err = newTLSClient(config.Host, config.TLSCertPath, true)
-		errutils.FailOn(err)
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 		log.Debug("docker-slim: new Docker client (TLS,verify) [1]")
 
 	case config.Host != "" &&
 		config.UseTLS &&
 		!config.VerifyTLS &&
-		config.TLSCertPath != "":
+		hasTLSFiles:
 		client, err = newTLSClient(config.Host, config.TLSCertPath, false)
-		errutils.FailOn(err)
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 		log.Debug("docker-slim: new Docker client (TLS,no verify) [2]")
 
 	case config.Host != "" &&
 		!config.UseTLS:
 		client, err = docker.NewClient(config.Host)
-		errutils.FailOn(err)
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 		log.Debug("docker-slim: new Docker client [3]")
 
 	case config.Host == "" &&
@@ -70,22 +112,26 @@ func New(config *config.DockerClient) *docker.Client {
 		config.Env["DOCKER_CERT_PATH"] != "" &&
 		config.Env["DOCKER_HOST"] != "":
 		client, err = newTLSClient(config.Env["DOCKER_HOST"], config.Env["DOCKER_CERT_PATH"], false)
-		errutils.FailOn(err)
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 		log.Debug("docker-slim: new Docker client (TLS,no verify) [4]")
 
 	case config.Env["DOCKER_HOST"] != "":
 		client, err = docker.NewClientFromEnv()
-		errutils.FailOn(err)
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
 		log.Debug("docker-slim: new Docker client (env) [5]")
 
 	case config.Host == "" && config.Env["DOCKER_HOST"] == "":
 		config.Host = "unix:///var/run/docker.sock"
+		if config.UsePodman {
+			config.Host = "unix://" + PodmanSocket()
+		}
+
 		client, err = docker.NewClient(config.Host)
-		errutils.FailOn(err)
-		log.Debug("docker-slim: new Docker client (default) [6]")
+		errutils.FailOnCode(err, errutils.ExitCodeDockerConnect)
+		log.Debugf("docker-slim: new Docker client (default - %v) [6]", config.Host)
 
 	default:
-		errutils.Fail("no config for Docker client")
+		errutils.FailCode("no config for Docker client", errutils.ExitCodeDockerConnect)
 	}
 
 	if config.Env["DOCKER_HOST"] == "" {
@@ -96,5 +142,5 @@ func New(config *config.DockerClient) *docker.Client {
 		log.Debug("docker-slim: configured DOCKER_HOST env var")
 	}
 
-	return client
+	return client, closeFunc
 }
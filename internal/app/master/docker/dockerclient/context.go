@@ -0,0 +1,124 @@
+package dockerclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+)
+
+const (
+	defaultContextName = "default"
+	configFileName     = "config.json"
+	contextMetaDir     = "contexts/meta"
+	contextTLSDir      = "contexts/tls"
+	contextMetaFile    = "meta.json"
+	dockerEndpointName = "docker"
+)
+
+// ContextEndpoint is the Docker endpoint of a Docker CLI context
+// (TLSCertPath is set only if the context has the TLS files)
+type ContextEndpoint struct {
+	Name          string
+	Host          string
+	SkipTLSVerify bool
+	TLSCertPath   string
+}
+
+type contextMeta struct {
+	Name      string
+	Endpoints map[string]struct {
+		Host          string
+		SkipTLSVerify bool
+	}
+}
+
+// configDir returns the Docker CLI config directory (DOCKER_CONFIG or ~/.docker)
+func configDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".docker")
+}
+
+// CurrentContext returns the selected Docker CLI context name
+// (the context name parameter, DOCKER_CONTEXT or the current context in the Docker CLI config)
+func CurrentContext(name string) string {
+	if name != "" {
+		return name
+	}
+
+	if name = os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(configDir(), configFileName))
+	if err != nil {
+		return defaultContextName
+	}
+
+	var cliConfig struct {
+		CurrentContext string `json:"currentContext"`
+	}
+
+	if err := json.Unmarshal(data, &cliConfig); err != nil || cliConfig.CurrentContext == "" {
+		return defaultContextName
+	}
+
+	return cliConfig.CurrentContext
+}
+
+// LoadContextEndpoint returns the Docker endpoint of the Docker CLI context
+// (returns nil for the default context, which uses the regular Docker host settings)
+func LoadContextEndpoint(name string) (*ContextEndpoint, error) {
+	if name == "" || name == defaultContextName {
+		return nil, nil
+	}
+
+	//the Docker CLI saves the context data in the directories named with the context name digest
+	nameDigest := sha256.Sum256([]byte(name))
+	contextID := hex.EncodeToString(nameDigest[:])
+
+	data, err := ioutil.ReadFile(filepath.Join(configDir(), contextMetaDir, contextID, contextMetaFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("docker context not found - %v", name)
+		}
+
+		return nil, err
+	}
+
+	var meta contextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid docker context %v - %v", name, err)
+	}
+
+	endpoint, ok := meta.Endpoints[dockerEndpointName]
+	if !ok || endpoint.Host == "" {
+		return nil, fmt.Errorf("docker context has no Docker endpoint - %v", name)
+	}
+
+	contextEndpoint := &ContextEndpoint{
+		Name:          name,
+		Host:          endpoint.Host,
+		SkipTLSVerify: endpoint.SkipTLSVerify,
+	}
+
+	tlsPath := filepath.Join(configDir(), contextTLSDir, contextID, dockerEndpointName)
+	if fsutils.Exists(filepath.Join(tlsPath, "cert.pem")) {
+		contextEndpoint.TLSCertPath = tlsPath
+	}
+
+	return contextEndpoint, nil
+}
@@ -0,0 +1,47 @@
+package dockerclient
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Podman API socket locations
+const (
+	PodmanRootfulSocket     = "/run/podman/podman.sock"
+	podmanRootlessSocketPat = "/run/user/%d/podman/podman.sock"
+	podmanEngineName        = "Podman Engine"
+)
+
+// PodmanSocket returns the default Podman API socket
+// (the rootful socket for root and the rootless socket in XDG_RUNTIME_DIR for the other users)
+func PodmanSocket() string {
+	if os.Geteuid() == 0 {
+		return PodmanRootfulSocket
+	}
+
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return runtimeDir + "/podman/podman.sock"
+	}
+
+	return fmt.Sprintf(podmanRootlessSocketPat, os.Geteuid())
+}
+
+// IsPodman returns true if the Docker API endpoint is the Podman API socket
+// (Podman adds its engine to the version components)
+func IsPodman(client *docker.Client) bool {
+	ver, err := client.Version()
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(ver.Get("Components"), podmanEngineName)
+}
+
+// IsRootlessPodman returns true if the Podman API endpoint is rootless
+// (only the local users other than root can use the rootless Podman sockets)
+func IsRootlessPodman(client *docker.Client) bool {
+	return os.Geteuid() != 0 && IsPodman(client)
+}
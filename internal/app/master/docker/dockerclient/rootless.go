@@ -0,0 +1,33 @@
+package dockerclient
+
+import (
+	"os"
+	"strings"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	rootlessDataDir      = "/.local/share/docker"
+	rootlessSocketPrefix = "unix:///run/user/"
+)
+
+// IsRootlessDocker returns true if the Docker API endpoint is a rootless Docker daemon
+// (rootless dockerd keeps its data in the user home directory and listens on the socket in XDG_RUNTIME_DIR)
+func IsRootlessDocker(client *docker.Client) bool {
+	if IsPodman(client) {
+		return false
+	}
+
+	if info, err := client.Info(); err == nil && strings.Contains(info.DockerRootDir, rootlessDataDir) {
+		return true
+	}
+
+	return strings.HasPrefix(os.Getenv("DOCKER_HOST"), rootlessSocketPrefix)
+}
+
+// IsRootless returns true if the containers run in a user namespace without the real root privileges
+// (rootless Docker or rootless Podman)
+func IsRootless(client *docker.Client) bool {
+	return IsRootlessDocker(client) || IsRootlessPodman(client)
+}
@@ -0,0 +1,230 @@
+package dockerclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	sshScheme          = "ssh"
+	sshBin             = "ssh"
+	sshSocketDirPrefix = "docker-slim-ssh-"
+	sshForwardHost     = "127.0.0.1"
+	sshForwardTimeout  = 30 * time.Second
+	sshForwardInterval = 200 * time.Millisecond
+)
+
+// ErrNoSSH is returned when ssh is not installed
+var ErrNoSSH = errors.New("ssh not found")
+
+// IsSSHHost returns true for the ssh:// Docker hosts
+func IsSSHHost(host string) bool {
+	return strings.HasPrefix(host, sshScheme+"://")
+}
+
+// sshArgs returns the ssh arguments to connect to the ssh://[user@]host[:port] Docker host
+func sshArgs(host string) ([]string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != sshScheme || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ssh host - %v", host)
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("ssh host can't have a path - %v", host)
+	}
+
+	var args []string
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+
+	return append(args, "--", u.Hostname()), nil
+}
+
+// NewSSHClient creates a Docker client for the ssh:// Docker host
+// (the client connects to a local unix socket and each connection
+// runs 'docker system dial-stdio' on the remote host the same way the Docker CLI does it).
+// The close function stops accepting the connections and removes the local socket.
+func NewSSHClient(host string) (*docker.Client, func(), error) {
+	if _, err := exec.LookPath(sshBin); err != nil {
+		return nil, nil, ErrNoSSH
+	}
+
+	args, err := sshArgs(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	socketDir, err := ioutil.TempDir("", sshSocketDirPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	socketPath := filepath.Join(socketDir, "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		os.RemoveAll(socketDir)
+		return nil, nil, err
+	}
+
+	var closeOnce sync.Once
+	closeFunc := func() {
+		closeOnce.Do(func() {
+			listener.Close()
+			os.RemoveAll(socketDir)
+		})
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go dialStdio(conn, args)
+		}
+	}()
+
+	log.Debugf("dockerclient.NewSSHClient: %v => %v", host, socketPath)
+	client, err := docker.NewClient("unix://" + socketPath)
+	if err != nil {
+		closeFunc()
+		return nil, nil, err
+	}
+
+	return client, closeFunc, nil
+}
+
+func dialStdio(conn net.Conn, args []string) {
+	defer conn.Close()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(sshBin, append(args, "docker", "system", "dial-stdio")...)
+	cmd.Stdout = conn
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Debugf("dockerclient.dialStdio: %v", err)
+		return
+	}
+
+	if err := cmd.Start(); err != nil {
+		log.Debugf("dockerclient.dialStdio: %v", err)
+		return
+	}
+
+	go func() {
+		io.Copy(stdin, conn)
+		stdin.Close()
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		log.Debugf("dockerclient.dialStdio: %v (%v)", err, strings.TrimSpace(stderr.String()))
+	}
+}
+
+// SSHPortForward forwards the local ports to the ports on the ssh Docker host
+type SSHPortForward struct {
+	// Ports maps the remote ports to the local ports
+	Ports map[string]string
+	cmd   *exec.Cmd
+}
+
+// ForwardSSHPorts starts forwarding free local ports to the ports on the ssh Docker host
+// (the remote ports are the published container ports, so they are available on the remote host loopback address)
+func ForwardSSHPorts(host string, ports []string) (*SSHPortForward, error) {
+	args, err := sshArgs(host)
+	if err != nil {
+		return nil, err
+	}
+
+	forward := &SSHPortForward{Ports: map[string]string{}}
+	forwardArgs := []string{"-N", "-o", "ExitOnForwardFailure=yes"}
+	for _, port := range ports {
+		localPort, err := freeLocalPort()
+		if err != nil {
+			return nil, err
+		}
+
+		forward.Ports[port] = localPort
+		forwardArgs = append(forwardArgs, "-L", fmt.Sprintf("%s:%s:%s:%s", sshForwardHost, localPort, sshForwardHost, port))
+	}
+
+	var stderr bytes.Buffer
+	forward.cmd = exec.Command(sshBin, append(forwardArgs, args...)...)
+	forward.cmd.Stderr = &stderr
+	if err := forward.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	exitChan := make(chan error, 1)
+	go func() {
+		exitChan <- forward.cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(sshForwardTimeout)
+	for _, localPort := range forward.Ports {
+		for {
+			conn, err := net.Dial("tcp", net.JoinHostPort(sshForwardHost, localPort))
+			if err == nil {
+				conn.Close()
+				break
+			}
+
+			select {
+			case <-exitChan:
+				return nil, fmt.Errorf("ssh port forwarding: %v", strings.TrimSpace(stderr.String()))
+			case <-time.After(sshForwardInterval):
+			}
+
+			if time.Now().After(deadline) {
+				forward.Close()
+				return nil, errors.New("ssh port forwarding: ports are not forwarded")
+			}
+		}
+	}
+
+	log.Debugf("dockerclient.ForwardSSHPorts: %+v", forward.Ports)
+	return forward, nil
+}
+
+// Close stops forwarding the ports
+func (f *SSHPortForward) Close() {
+	if f.cmd.Process != nil {
+		f.cmd.Process.Kill()
+	}
+}
+
+func freeLocalPort() (string, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(sshForwardHost, "0"))
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), nil
+}
@@ -0,0 +1,80 @@
+package dockerclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// NewTLSConfig creates the TLS config with the CA bundle and the client certificate files (the files are optional).
+// The CA bundle is added to the system CAs if useSystemCAs is true (it's the only CA source otherwise,
+// the same way the Docker CLI verifies the Docker host).
+func NewTLSConfig(caCertFile, certFile, keyFile string, useSystemCAs, skipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("both TLS client certificate and key are required")
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caCertFile != "" && !skipVerify {
+		caData, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+
+		var pool *x509.CertPool
+		if useSystemCAs {
+			pool, _ = x509.SystemCertPool()
+		}
+
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no CA certificates in %v", caCertFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// newTLSConfigClient creates the Docker client with the TLS config
+// (the TLS clients in the Docker client library require the client certificate)
+func newTLSConfigClient(host string, tlsConfig *tls.Config) (*docker.Client, error) {
+	if strings.HasPrefix(host, "tcp://") {
+		host = "https://" + strings.TrimPrefix(host, "tcp://")
+	}
+
+	client, err := docker.NewClient(host)
+	if err != nil {
+		return nil, err
+	}
+
+	client.TLSConfig = tlsConfig
+	client.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return client, nil
+}
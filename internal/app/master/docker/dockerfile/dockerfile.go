@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/cloudimmunity/go-dockerclientx"
 )
@@ -24,7 +26,7 @@ type imageInst struct {
 }
 
 // ReverseDockerfileFromHistory recreates Dockerfile information from container image history
-func ReverseDockerfileFromHistory(apiClient *docker.Client, imageID string) ([]string, error) {
+func ReverseDockerfileFromHistory(apiClient runtime.ImageClient, imageID string) ([]string, error) {
 	//NOTE: comment field is missing (TODO: enhance the lib...)
 	imageHistory, err := apiClient.ImageHistory(imageID)
 	if err != nil {
@@ -167,21 +169,28 @@ func SaveDockerfileData(fatImageDockerfileLocation string, fatImageDockerInstruc
 }
 
 // GenerateFromInfo builds and saves a Dockerfile file object
+// (the kept files are added to the base image, 'scratch' for the minimal images,
+// with a COPY instruction for each layer directory)
 func GenerateFromInfo(location string,
+	baseImage string,
 	workingDir string,
 	env []string,
 	exposedPorts map[docker.Port]struct{},
 	entrypoint []string,
 	cmd []string,
-	hasData bool) error {
+	layerDirs []string) error {
 
 	dockerfileLocation := filepath.Join(location, "Dockerfile")
 
 	var dfData bytes.Buffer
-	dfData.WriteString("FROM scratch\n")
-
-	if hasData {
-		dfData.WriteString("COPY files /\n")
+	dfData.WriteString("FROM ")
+	dfData.WriteString(baseImage)
+	dfData.WriteByte('\n')
+
+	for _, layerDir := range layerDirs {
+		dfData.WriteString("COPY ")
+		dfData.WriteString(layerDir)
+		dfData.WriteString(" /\n")
 	}
 
 	if workingDir != "" {
@@ -6,27 +6,61 @@ import (
 	"os"
 )
 
+const localHostIP = "127.0.0.1"
+
 // GetIP returns the Docker host IP address
+// (the host names are resolved, so the IP address is also available for the ssh:// hosts)
 func GetIP() string {
 	dockerHost := os.Getenv("DOCKER_HOST")
 	if dockerHost == "" {
-		return "127.0.0.1"
+		return localHostIP
 	}
 
 	u, err := url.Parse(dockerHost)
 	if err != nil {
-		return "127.0.0.1"
+		return localHostIP
 	}
 
 	switch u.Scheme {
-	case "unix":
-		return "127.0.0.1"
+	case "unix", "npipe":
+		return localHostIP
 	default:
-		host, _, err := net.SplitHostPort(u.Host)
-		if err != nil {
-			return "127.0.0.1"
+		host := u.Hostname()
+		if host == "" {
+			return localHostIP
+		}
+
+		if net.ParseIP(host) != nil {
+			return host
+		}
+
+		addrs, err := net.LookupHost(host)
+		if err != nil || len(addrs) == 0 {
+			return host
 		}
 
-		return host
+		return addrs[0]
+	}
+}
+
+// IsRemote returns true if the Docker host is not on the local machine
+// (the local paths can't be mounted in the containers on the remote Docker hosts)
+func IsRemote() bool {
+	dockerHost := os.Getenv("DOCKER_HOST")
+	if dockerHost == "" {
+		return false
+	}
+
+	u, err := url.Parse(dockerHost)
+	if err != nil {
+		return false
 	}
+
+	switch u.Scheme {
+	case "unix", "npipe":
+		return false
+	}
+
+	ip := net.ParseIP(GetIP())
+	return ip == nil || !ip.IsLoopback()
 }
@@ -0,0 +1,273 @@
+package dockerimage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	manifestFileName = "manifest.json"
+	whiteoutPrefix   = ".wh."
+	whiteoutOpaque   = ".wh..wh..opq"
+)
+
+const (
+	// layerWorkers is the number of the compressed layers decompressed at the same time
+	layerWorkers = 4
+	// maxBufferedLayerSize is the largest compressed layer that is buffered in memory
+	// to be decompressed concurrently (the larger layers are decompressed as they are streamed)
+	maxBufferedLayerSize = 64 << 20
+)
+
+// FileInfo describes a file in the image filesystem
+type FileInfo struct {
+	Path       string
+	Size       int64
+	LayerIndex int
+	LayerID    string
+}
+
+// Inventory contains the files in the image filesystem (the result of applying all image layers)
+type Inventory struct {
+	Files  map[string]*FileInfo
+	Layers []string
+}
+
+type manifestInfo struct {
+	Config string
+	Layers []string
+}
+
+type layerEntry struct {
+	path     string
+	size     int64
+	isDir    bool
+	whiteout bool
+	opaque   bool
+}
+
+// LoadInventory exports the image and creates its file inventory
+func LoadInventory(client runtime.ImageClient, imageRef string) (*Inventory, error) {
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(client.ExportImage(imageRef, writer))
+	}()
+
+	inventory, err := ReadInventory(reader)
+	//drain the export stream if the inventory is created before the stream ends
+	io.Copy(ioutil.Discard, reader)
+	reader.Close()
+
+	return inventory, err
+}
+
+// ReadInventory creates the file inventory from the image archive ('docker save' format or the OCI layout).
+// The archive is read as a stream (nothing is staged on disk): the uncompressed layers are parsed
+// as they are read and the compressed layers are decompressed concurrently while the archive is still streamed.
+func ReadInventory(archive io.Reader) (*Inventory, error) {
+	var manifests []manifestInfo
+	layerEntries := map[string][]layerEntry{}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	workers := make(chan struct{}, layerWorkers)
+	addLayer := func(name string, entries []layerEntry, err error) {
+		//the other files fail to parse as tar archives and they are skipped
+		if err != nil {
+			log.Debugf("dockerimage.ReadInventory: skipping %v - %v", name, err)
+			return
+		}
+
+		mu.Lock()
+		layerEntries[name] = entries
+		mu.Unlock()
+	}
+
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			wg.Wait()
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		if hdr.Name == manifestFileName {
+			if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+				wg.Wait()
+				return nil, err
+			}
+
+			continue
+		}
+
+		//the layer archives ('<id>/layer.tar' or 'blobs/sha256/<digest>' in the OCI layout)
+		br := bufio.NewReader(tr)
+		if hdr.Size > maxBufferedLayerSize || !isGzip(br) {
+			entries, err := readLayer(br)
+			addLayer(hdr.Name, entries, err)
+			continue
+		}
+
+		workers <- struct{}{}
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			<-workers
+			wg.Wait()
+			return nil, err
+		}
+
+		wg.Add(1)
+		go func(name string, data []byte) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			entries, err := readLayer(bytes.NewReader(data))
+			addLayer(name, entries, err)
+		}(hdr.Name, data)
+	}
+
+	wg.Wait()
+
+	inventory := &Inventory{
+		Files: map[string]*FileInfo{},
+	}
+
+	if len(manifests) == 0 {
+		return inventory, nil
+	}
+
+	for idx, layerName := range manifests[0].Layers {
+		layerID := path.Base(layerName)
+		if strings.HasSuffix(layerName, "/layer.tar") {
+			layerID = path.Dir(layerName)
+		}
+
+		inventory.Layers = append(inventory.Layers, layerID)
+		inventory.apply(idx, layerID, layerEntries[layerName])
+	}
+
+	return inventory, nil
+}
+
+func isGzip(br *bufio.Reader) bool {
+	magic, err := br.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+func readLayer(r io.Reader) ([]layerEntry, error) {
+	var entries []layerEntry
+
+	//the layers are compressed in the OCI layout (the 'docker save' layers are not compressed)
+	br := bufio.NewReader(r)
+	if isGzip(br) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		r = zr
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		filePath := "/" + strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		baseName := path.Base(filePath)
+
+		entry := layerEntry{
+			path:  filePath,
+			size:  hdr.Size,
+			isDir: hdr.Typeflag == tar.TypeDir,
+		}
+
+		switch {
+		case baseName == whiteoutOpaque:
+			entry.path = path.Dir(filePath)
+			entry.opaque = true
+		case strings.HasPrefix(baseName, whiteoutPrefix):
+			entry.path = path.Join(path.Dir(filePath), strings.TrimPrefix(baseName, whiteoutPrefix))
+			entry.whiteout = true
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (i *Inventory) apply(layerIndex int, layerID string, entries []layerEntry) {
+	//the whiteouts hide the files from the lower layers only, so they are applied first
+	for _, entry := range entries {
+		switch {
+		case entry.opaque:
+			i.removeChildren(entry.path)
+		case entry.whiteout:
+			delete(i.Files, entry.path)
+			i.removeChildren(entry.path)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.opaque || entry.whiteout || entry.isDir {
+			continue
+		}
+
+		i.Files[entry.path] = &FileInfo{
+			Path:       entry.path,
+			Size:       entry.size,
+			LayerIndex: layerIndex,
+			LayerID:    layerID,
+		}
+	}
+}
+
+func (i *Inventory) removeChildren(dirPath string) {
+	prefix := strings.TrimSuffix(dirPath, "/") + "/"
+	for filePath := range i.Files {
+		if strings.HasPrefix(filePath, prefix) {
+			delete(i.Files, filePath)
+		}
+	}
+}
+
+// FileSizes returns the file sizes keyed by the file path
+func (i *Inventory) FileSizes() map[string]int64 {
+	sizes := make(map[string]int64, len(i.Files))
+	for filePath, info := range i.Files {
+		sizes[filePath] = info.Size
+	}
+
+	return sizes
+}
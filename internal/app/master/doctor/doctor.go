@@ -0,0 +1,453 @@
+package doctor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/sensorbin"
+	"github.com/docker-slim/docker-slim/internal/app/master/version"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/dustin/go-humanize"
+)
+
+// Check statuses
+const (
+	StatusOk      = "ok"
+	StatusWarning = "warning"
+	StatusError   = "error"
+	StatusUnknown = "unknown"
+)
+
+const (
+	minAPIVersion = "1.21"
+	minFreeSpace  = 2 << 30
+)
+
+// Check is the result of one environment check
+// (Fix is the suggested action for the failed checks)
+type Check struct {
+	Name    string
+	Status  string
+	Message string
+	Fix     string
+}
+
+// Failed returns true for the checks with errors
+func Failed(checks []*Check) bool {
+	for _, check := range checks {
+		if check.Status == StatusError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Docker checks the Docker connection, the API version, the Docker host OS and the storage driver
+// (it also returns the Docker host architecture for the sensor check if Docker is available)
+func Docker(client *docker.Client) ([]*Check, string) {
+	if err := client.Ping(); err != nil {
+		fix := "start the Docker daemon and check the Docker host settings (DOCKER_HOST or --host and the TLS options)"
+		if strings.Contains(err.Error(), "permission denied") {
+			fix = "add your user to the 'docker' group (or run docker-slim with sudo) to access the Docker socket"
+		}
+
+		return []*Check{{
+			Name:    "docker.connect",
+			Status:  StatusError,
+			Message: err.Error(),
+			Fix:     fix,
+		}}, ""
+	}
+
+	checks := []*Check{{Name: "docker.connect", Status: StatusOk}}
+
+	ver, err := client.Version()
+	if err != nil {
+		checks = append(checks, &Check{Name: "docker.api.version", Status: StatusUnknown, Message: err.Error()})
+	} else {
+		apiVersion := ver.Get("ApiVersion")
+		check := &Check{
+			Name:    "docker.api.version",
+			Status:  StatusOk,
+			Message: fmt.Sprintf("api=%v server=%v", apiVersion, ver.Get("Version")),
+		}
+
+		if compareVersions(apiVersion, minAPIVersion) < 0 {
+			check.Status = StatusError
+			check.Fix = fmt.Sprintf("upgrade Docker (API version %v or newer is required)", minAPIVersion)
+		}
+
+		checks = append(checks, check)
+
+		if dockerclient.IsPodman(client) {
+			engineCheck := &Check{
+				Name:    "docker.engine",
+				Status:  StatusOk,
+				Message: "podman",
+			}
+
+			if dockerclient.IsRootlessPodman(client) {
+				engineCheck.Status = StatusWarning
+				engineCheck.Message = "podman (rootless)"
+				engineCheck.Fix = "use the rootful Podman socket (run docker-slim as root with --podman) if the target app starts child processes (only the main process file activity is collected in the rootless mode)"
+			}
+
+			checks = append(checks, engineCheck)
+		} else if dockerclient.IsRootlessDocker(client) {
+			checks = append(checks, &Check{
+				Name:    "docker.engine",
+				Status:  StatusWarning,
+				Message: "docker (rootless)",
+				Fix:     "use the rootful Docker daemon if the target app starts child processes (only the main process file activity is collected in the rootless mode)",
+			})
+		}
+	}
+
+	info, err := client.Info()
+	if err != nil {
+		checks = append(checks, &Check{Name: "docker.info", Status: StatusUnknown, Message: err.Error()})
+		return checks, ""
+	}
+
+	osCheck := &Check{
+		Name:    "docker.host",
+		Status:  StatusOk,
+		Message: fmt.Sprintf("os=%v kernel=%v arch=%v", info.OperatingSystem, info.KernelVersion, info.Architecture),
+	}
+
+	if info.OSType != "" && info.OSType != "linux" {
+		osCheck.Status = StatusError
+		osCheck.Fix = "switch Docker to Linux containers (docker-slim doesn't support Windows containers)"
+	}
+
+	checks = append(checks, osCheck)
+
+	driverCheck := &Check{
+		Name:    "docker.storage.driver",
+		Status:  StatusOk,
+		Message: info.Driver,
+	}
+
+	switch info.Driver {
+	case "vfs":
+		driverCheck.Status = StatusWarning
+		driverCheck.Fix = "use the overlay2 storage driver ('vfs' copies each layer, so the builds are slow and use a lot of disk space)"
+	case "devicemapper":
+		for _, status := range info.DriverStatus {
+			if strings.HasPrefix(status[0], "Data loop file") {
+				driverCheck.Status = StatusWarning
+				driverCheck.Fix = "use the overlay2 storage driver (devicemapper in the loop-lvm mode is slow and not supported for production)"
+				break
+			}
+		}
+	}
+
+	checks = append(checks, driverCheck)
+	return checks, info.Architecture
+}
+
+// Kernel checks the kernel features the sensor and the generated security profiles need
+// (the checks are for the local host, so they apply only if the Docker host is local)
+func Kernel() []*Check {
+	if runtime.GOOS != "linux" {
+		message := fmt.Sprintf("the local host is not Linux (%v), the kernel features are not checked", runtime.GOOS)
+		return []*Check{{Name: "kernel", Status: StatusUnknown, Message: message}}
+	}
+
+	kernelConfig := loadKernelConfig()
+
+	fanotifyCheck := &Check{Name: "kernel.fanotify", Status: StatusOk}
+	switch {
+	case kernelConfig != nil && kernelConfig["CONFIG_FANOTIFY"] == "y":
+	case kernelConfig != nil:
+		fanotifyCheck.Status = StatusError
+		fanotifyCheck.Message = "the kernel is built without fanotify"
+		fanotifyCheck.Fix = "use a kernel with CONFIG_FANOTIFY=y (the sensor uses fanotify to find the files the application uses)"
+	case fsutils.Exists("/proc/sys/fs/fanotify"):
+	default:
+		fanotifyCheck.Status = StatusUnknown
+		fanotifyCheck.Message = "no kernel config to check"
+	}
+
+	seccompCheck := &Check{Name: "kernel.seccomp", Status: StatusOk}
+	if mode, ok := procStatusField("Seccomp"); !ok {
+		seccompCheck.Status = StatusWarning
+		seccompCheck.Message = "the kernel is built without seccomp"
+		seccompCheck.Fix = "use a kernel with CONFIG_SECCOMP_FILTER=y to use the generated seccomp profiles"
+	} else {
+		seccompCheck.Message = "mode=" + mode
+	}
+
+	appArmorCheck := &Check{Name: "kernel.apparmor", Status: StatusOk, Message: "disabled"}
+	if value, err := readTrimmed("/sys/module/apparmor/parameters/enabled"); err == nil && value == "Y" {
+		appArmorCheck.Message = "enabled"
+		if _, err := os.Stat("/sbin/apparmor_parser"); err != nil {
+			appArmorCheck.Status = StatusWarning
+			appArmorCheck.Fix = "install apparmor_parser (the apparmor package) to load the generated AppArmor profiles"
+		}
+	}
+
+	selinuxCheck := &Check{Name: "kernel.selinux", Status: StatusOk, Message: "disabled"}
+	if value, err := readTrimmed("/sys/fs/selinux/enforce"); err == nil {
+		selinuxCheck.Message = "permissive"
+		if value == "1" {
+			selinuxCheck.Status = StatusWarning
+			selinuxCheck.Message = "enforcing"
+			selinuxCheck.Fix = "if the sensor can't write its artifacts label the state path for the containers (chcon -Rt container_file_t <state path>)"
+		}
+	}
+
+	return []*Check{fanotifyCheck, seccompCheck, appArmorCheck, selinuxCheck}
+}
+
+// StatePath checks that the state path is writable and that it has enough free disk space
+func StatePath(statePath string) *Check {
+	statePath = fsutils.StatePath(statePath)
+
+	check := &Check{Name: "state.path", Status: StatusOk}
+
+	if err := os.MkdirAll(statePath, 0777); err != nil {
+		check.Status = StatusError
+		check.Message = err.Error()
+		check.Fix = "use --state-path (or DSLIM_STATE_PATH) to select a writable state directory"
+		return check
+	}
+
+	testFile, err := ioutil.TempFile(statePath, ".docker-slim-doctor-")
+	if err != nil {
+		check.Status = StatusError
+		check.Message = fmt.Sprintf("%v is not writable - %v", statePath, err)
+		check.Fix = "use --state-path (or DSLIM_STATE_PATH) to select a writable state directory"
+		return check
+	}
+
+	testFile.Close()
+	os.Remove(testFile.Name())
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(statePath, &stat); err != nil {
+		check.Status = StatusUnknown
+		check.Message = err.Error()
+		return check
+	}
+
+	free := uint64(stat.Bavail) * uint64(stat.Bsize)
+	check.Message = fmt.Sprintf("location=%v free=%v", statePath, humanize.Bytes(free))
+	if free < minFreeSpace {
+		check.Status = StatusWarning
+		check.Fix = "free some disk space ('docker-slim state prune' removes the old image state) or use a different --state-path"
+	}
+
+	return check
+}
+
+// Sensor checks the sensor binary (it has to be next to docker-slim or embedded in docker-slim
+// and match the Docker host architecture)
+func Sensor(dockerArch, statePath string) []*Check {
+	sensorPath := filepath.Join(fsutils.ExeDir(), container.SensorBinLocal)
+	installFix := "install docker-slim-sensor next to docker-slim (run 'docker-slim update --force' to reinstall both)"
+
+	if !fsutils.Exists(sensorPath) && len(sensorbin.Archs()) > 0 {
+		//the embedded sensor is extracted (and verified) the same way the build and profile commands do it
+		arch := runtime.GOARCH
+		if dockerArch != "" {
+			arch = container.ImageArch(dockerArch)
+		}
+
+		embeddedPath, err := sensorbin.Extract(arch, statePath)
+		if err != nil {
+			return []*Check{{Name: "sensor", Status: StatusError, Message: fmt.Sprintf("embedded sensor (%v) - %v", arch, err), Fix: installFix}}
+		}
+
+		sensorPath = embeddedPath
+	}
+
+	info, err := os.Stat(sensorPath)
+	if err != nil {
+		return []*Check{{Name: "sensor", Status: StatusError, Message: err.Error(), Fix: installFix}}
+	}
+
+	check := &Check{Name: "sensor", Status: StatusOk, Message: sensorPath}
+	if info.Mode()&0111 == 0 {
+		check.Status = StatusError
+		check.Fix = fmt.Sprintf("make the sensor executable (chmod +x %v)", sensorPath)
+		return []*Check{check}
+	}
+
+	checks := []*Check{check}
+
+	archCheck := &Check{Name: "sensor.arch", Status: StatusOk}
+	sensorArch, err := container.BinArch(sensorPath)
+	switch {
+	case err != nil:
+		archCheck.Status = StatusError
+		archCheck.Message = fmt.Sprintf("not a Linux binary - %v", err)
+		archCheck.Fix = installFix
+	case dockerArch == "":
+		archCheck.Status = StatusUnknown
+		archCheck.Message = fmt.Sprintf("sensor=%v (unknown Docker host architecture)", sensorArch)
+	case sensorArch != container.ImageArch(dockerArch):
+		//the architecture specific sensor is used for the images with the Docker host architecture
+		archSensorPath, err := container.FindSensor(dockerArch, statePath)
+		if err != nil {
+			archCheck.Status = StatusError
+			archCheck.Message = fmt.Sprintf("sensor=%v docker=%v", sensorArch, dockerArch)
+			archCheck.Fix = fmt.Sprintf("install the docker-slim release for the %v Docker hosts", dockerArch)
+			break
+		}
+
+		sensorPath = archSensorPath
+		archCheck.Message = fmt.Sprintf("%v (%v)", container.ImageArch(dockerArch), filepath.Base(archSensorPath))
+	default:
+		archCheck.Message = sensorArch
+	}
+
+	//the other architecture sensors are used for the emulated (or the multi-arch) images
+	var otherArchs []string
+	for _, arch := range container.SensorArchs {
+		if fsutils.Exists(filepath.Join(fsutils.ExeDir(), fmt.Sprintf(container.SensorBinArchPat, arch))) {
+			otherArchs = append(otherArchs, arch)
+		}
+	}
+
+	if len(otherArchs) > 0 {
+		archCheck.Message = fmt.Sprintf("%v [installed: %v]", archCheck.Message, strings.Join(otherArchs, ","))
+	}
+
+	if embeddedArchs := sensorbin.Archs(); len(embeddedArchs) > 0 {
+		archCheck.Message = fmt.Sprintf("%v [embedded: %v]", archCheck.Message, strings.Join(embeddedArchs, ","))
+	}
+
+	checks = append(checks, archCheck)
+
+	if runtime.GOOS != "linux" || archCheck.Status == StatusError {
+		//the sensor can run only on the Linux hosts with the same architecture
+		return checks
+	}
+
+	versionCheck := &Check{Name: "sensor.version", Status: StatusOk}
+	sensorVersion, err := version.SensorVersion(sensorPath)
+	switch {
+	case err != nil:
+		versionCheck.Status = StatusWarning
+		versionCheck.Message = err.Error()
+		versionCheck.Fix = "run 'docker-slim update --force' to reinstall the matching sensor"
+	case !version.SameBuild(sensorVersion, v.Current()):
+		versionCheck.Status = StatusWarning
+		versionCheck.Message = fmt.Sprintf("sensor=%v docker-slim=%v", sensorVersion, v.Current())
+		versionCheck.Fix = "run 'docker-slim update --force' to reinstall the matching sensor"
+	default:
+		versionCheck.Message = sensorVersion
+	}
+
+	return append(checks, versionCheck)
+}
+
+// loadKernelConfig loads the kernel build config (from /proc/config.gz or /boot)
+// (it returns nil if the config is not available)
+func loadKernelConfig() map[string]string {
+	var reader io.Reader
+	if file, err := os.Open("/proc/config.gz"); err == nil {
+		defer file.Close()
+
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil
+		}
+
+		reader = gzReader
+	} else {
+		release, err := readTrimmed("/proc/sys/kernel/osrelease")
+		if err != nil {
+			return nil
+		}
+
+		file, err := os.Open(filepath.Join("/boot", "config-"+release))
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	kernelConfig := map[string]string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "="); idx > 0 && !strings.HasPrefix(line, "#") {
+			kernelConfig[line[:idx]] = line[idx+1:]
+		}
+	}
+
+	if scanner.Err() != nil {
+		return nil
+	}
+
+	return kernelConfig
+}
+
+func procStatusField(name string) (string, bool) {
+	data, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return "", false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, name+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, name+":")), true
+		}
+	}
+
+	return "", false
+}
+
+func readTrimmed(location string) (string, error) {
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// compareVersions compares the dotted API versions (e.g., '1.21' and '1.9')
+func compareVersions(version, other string) int {
+	parts := strings.Split(version, ".")
+	otherParts := strings.Split(other, ".")
+	for idx := 0; idx < len(parts) || idx < len(otherParts); idx++ {
+		var part, otherPart int
+		if idx < len(parts) {
+			part, _ = strconv.Atoi(parts[idx])
+		}
+
+		if idx < len(otherParts) {
+			otherPart, _ = strconv.Atoi(otherParts[idx])
+		}
+
+		if part != otherPart {
+			if part < otherPart {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,199 @@
+package findings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/k8s"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Config analyzer rule IDs
+const (
+	RuleRootUser             = "config/root-user"
+	RuleSensitiveCapability  = "config/sensitive-capability"
+	RuleSensitiveExposedPort = "config/sensitive-port"
+	RuleUnusedEnvSecret      = "config/unused-env-secret"
+	RuleLatestBase           = "config/latest-base"
+)
+
+// the base image name from the OCI image annotations (some build tools save it as a label)
+const baseNameLabel = "org.opencontainers.image.base.name"
+
+const latestTag = "latest"
+
+// capabilities that give the container (almost) full control of the host
+var sensitiveCapabilities = map[string]struct{}{
+	capabilities.SysAdmin:  {},
+	capabilities.SysModule: {},
+	capabilities.SysPtrace: {},
+	capabilities.SysRawio:  {},
+	capabilities.SysBoot:   {},
+}
+
+// ports for the remote admin services that shouldn't be exposed by application containers
+var sensitivePorts = map[string]string{
+	"22":   "ssh",
+	"23":   "telnet",
+	"2375": "docker",
+	"3389": "rdp",
+	"5900": "vnc",
+}
+
+func init() {
+	addRules(
+		&Rule{
+			ID:          RuleRootUser,
+			Analyzer:    AnalyzerConfig,
+			Name:        "RootUser",
+			Description: "The container runs as root",
+			Level:       LevelWarning,
+		},
+		&Rule{
+			ID:          RuleSensitiveCapability,
+			Analyzer:    AnalyzerConfig,
+			Name:        "SensitiveCapability",
+			Description: "The application uses a capability that allows it to escape the container",
+			Level:       LevelWarning,
+		},
+		&Rule{
+			ID:          RuleSensitiveExposedPort,
+			Analyzer:    AnalyzerConfig,
+			Name:        "SensitivePort",
+			Description: "The image exposes a remote admin service port",
+			Level:       LevelWarning,
+		},
+		&Rule{
+			ID:          RuleUnusedEnvSecret,
+			Analyzer:    AnalyzerConfig,
+			Name:        "UnusedEnvSecret",
+			Description: "A secret-like ENV variable is not used by the application",
+			Level:       LevelWarning,
+		},
+		&Rule{
+			ID:          RuleLatestBase,
+			Analyzer:    AnalyzerConfig,
+			Name:        "LatestBase",
+			Description: "The image is not pinned to a version (it uses the latest tag or no tag)",
+			Level:       LevelNote,
+		})
+}
+
+// checkConfig checks the image config, the observed capabilities and the environment variable usage
+func checkConfig(imageRef string,
+	imageInfo *dockerapi.Image,
+	capabilities []string,
+	exposedPorts map[dockerapi.Port]struct{},
+	envVars []report.EnvVarUsage) []*Finding {
+	var findings []*Finding
+
+	if finding := checkBaseImage(imageRef, imageInfo); finding != nil {
+		findings = append(findings, finding)
+	}
+
+	if imageInfo != nil && imageInfo.Config != nil && !k8s.IsNonRootUser(imageInfo.Config.User) {
+		user := imageInfo.Config.User
+		if user == "" {
+			user = "default"
+		}
+
+		findings = append(findings, newFinding(RuleRootUser,
+			fmt.Sprintf("The image user (%s) is root", user),
+			LocationArtifacts,
+			fatDockerfileName,
+			0))
+	}
+
+	for _, capName := range capabilities {
+		if _, ok := sensitiveCapabilities[capName]; ok {
+			findings = append(findings, newFinding(RuleSensitiveCapability,
+				fmt.Sprintf("The application uses the CAP_%s capability", capName),
+				LocationArtifacts,
+				report.DefaultContainerReportFileName,
+				0))
+		}
+	}
+
+	var ports []string
+	for port := range exposedPorts {
+		ports = append(ports, string(port))
+	}
+	sort.Strings(ports)
+
+	for _, port := range ports {
+		portNum := strings.Split(port, "/")[0]
+		if service, ok := sensitivePorts[portNum]; ok {
+			findings = append(findings, newFinding(RuleSensitiveExposedPort,
+				fmt.Sprintf("The image exposes port %s (%s)", port, service),
+				LocationArtifacts,
+				fatDockerfileName,
+				0))
+		}
+	}
+
+	//the unused secrets can be removed from the image (they only leak the credentials)
+	for _, envVar := range envVars {
+		if envVar.Secret && envVar.Status == report.EnvVarUnused {
+			findings = append(findings, newFinding(RuleUnusedEnvSecret,
+				fmt.Sprintf("The application doesn't use the secret-like ENV variable - %s", envVar.Name),
+				LocationArtifacts,
+				report.DefaultContainerReportFileName,
+				0))
+		}
+	}
+
+	return findings
+}
+
+// checkBaseImage checks if the base image uses the latest tag. The image history doesn't have
+// the base image name, so the base image is known only if the image has the OCI base name label
+// (the target image reference is checked otherwise).
+func checkBaseImage(imageRef string, imageInfo *dockerapi.Image) *Finding {
+	ref, refType := imageRef, "target image"
+	if imageInfo != nil && imageInfo.Config != nil {
+		if baseName := imageInfo.Config.Labels[baseNameLabel]; baseName != "" {
+			ref, refType = baseName, "base image"
+		}
+	}
+
+	if !isLatestRef(ref) {
+		return nil
+	}
+
+	return newFinding(RuleLatestBase,
+		fmt.Sprintf("The %s (%s) uses the latest tag", refType, ref),
+		LocationArtifacts,
+		fatDockerfileName,
+		0)
+}
+
+// isLatestRef returns true if the image reference uses the latest tag or no tag
+// (the image IDs and the references with digests are pinned)
+func isLatestRef(ref string) bool {
+	if ref == "" || strings.Contains(ref, "@") || isImageID(ref) {
+		return false
+	}
+
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	idx := strings.LastIndex(name, ":")
+	return idx == -1 || name[idx+1:] == latestTag
+}
+
+func isImageID(ref string) bool {
+	ref = strings.TrimPrefix(ref, "sha256:")
+	if len(ref) < 12 || len(ref) > 64 {
+		return false
+	}
+
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,113 @@
+package findings
+
+import (
+	"sort"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Analyzer names
+const (
+	AnalyzerSecrets = "secrets"
+	AnalyzerLint    = "lint"
+	AnalyzerConfig  = "config"
+)
+
+// Finding levels (the same values SARIF uses)
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNote    = "note"
+)
+
+// Location base IDs
+const (
+	// LocationImage is used for the file paths inside the target image
+	LocationImage = "IMAGE_ROOT"
+	// LocationArtifacts is used for the files in the artifacts directory (e.g., Dockerfile.fat)
+	LocationArtifacts = "ARTIFACTS"
+)
+
+// Rule describes a finding type
+type Rule struct {
+	ID          string
+	Analyzer    string
+	Name        string
+	Description string
+	Level       string
+}
+
+// Finding is a security-relevant finding
+type Finding struct {
+	RuleID   string
+	Message  string
+	BaseID   string
+	Path     string
+	Line     int
+	Analyzer string
+	Level    string
+}
+
+var rules = map[string]*Rule{}
+
+func addRules(ruleList ...*Rule) {
+	for _, rule := range ruleList {
+		rules[rule.ID] = rule
+	}
+}
+
+func newFinding(ruleID, message, baseID, path string, line int) *Finding {
+	rule := rules[ruleID]
+	return &Finding{
+		RuleID:   ruleID,
+		Message:  message,
+		BaseID:   baseID,
+		Path:     path,
+		Line:     line,
+		Analyzer: rule.Analyzer,
+		Level:    rule.Level,
+	}
+}
+
+// Rules returns the finding rules ordered by ID
+func Rules() []*Rule {
+	var ruleList []*Rule
+	for _, rule := range rules {
+		ruleList = append(ruleList, rule)
+	}
+
+	sort.Slice(ruleList, func(i, j int) bool {
+		return ruleList[i].ID < ruleList[j].ID
+	})
+
+	return ruleList
+}
+
+// Analyze runs the analyzers on the collected image and container data
+func Analyze(artifactLocation string,
+	imageRef string,
+	imageInfo *dockerapi.Image,
+	capabilities []string,
+	exposedPorts map[dockerapi.Port]struct{},
+	envVars []report.EnvVarUsage) ([]*Finding, error) {
+	var findings []*Finding
+
+	secretFindings, err := findSecrets(artifactLocation)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, secretFindings...)
+
+	lintFindings, err := lintDockerfile(artifactLocation)
+	if err != nil {
+		log.Debugf("findings: Dockerfile lint error - %v", err)
+	}
+	findings = append(findings, lintFindings...)
+
+	findings = append(findings, checkConfig(imageRef, imageInfo, capabilities, exposedPorts, envVars)...)
+
+	return findings, nil
+}
@@ -0,0 +1,41 @@
+package findings
+
+import (
+	"strings"
+)
+
+// IsGate returns true if the gate name selects any finding rules. The gates are the analyzer names
+// (e.g., 'secrets'), the rule IDs (e.g., 'config/root-user') and the rule IDs without their analyzer
+// (e.g., 'root-user').
+func IsGate(name string) bool {
+	for _, rule := range rules {
+		if gateMatches(name, rule.ID, rule.Analyzer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Violations returns the findings selected by the gates
+func Violations(findingList []*Finding, gates []string) []*Finding {
+	var violations []*Finding
+	for _, finding := range findingList {
+		for _, gate := range gates {
+			if gateMatches(gate, finding.RuleID, finding.Analyzer) {
+				violations = append(violations, finding)
+				break
+			}
+		}
+	}
+
+	return violations
+}
+
+func gateMatches(gate, ruleID, analyzer string) bool {
+	if gate == analyzer || gate == ruleID {
+		return true
+	}
+
+	return strings.TrimPrefix(ruleID, analyzer+"/") == gate
+}
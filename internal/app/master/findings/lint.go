@@ -0,0 +1,122 @@
+package findings
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Lint analyzer rule IDs
+const (
+	RuleAddInstruction  = "lint/add-instruction"
+	RuleAptListsKept    = "lint/apt-lists-kept"
+	RuleSudoInstruction = "lint/sudo"
+	RuleMaintainerUsed  = "lint/maintainer"
+	RuleCurlPipeToShell = "lint/curl-pipe-shell"
+)
+
+const (
+	baseImageAddPrefix   = "ADD file:"
+	aptInstallCommand    = "apt-get install"
+	aptListsCleanupMatch = "/var/lib/apt/lists"
+)
+
+func init() {
+	addRules(
+		&Rule{
+			ID:          RuleAddInstruction,
+			Analyzer:    AnalyzerLint,
+			Name:        "AddInstruction",
+			Description: "Use COPY instead of ADD (ADD fetches remote URLs and extracts archives implicitly)",
+			Level:       LevelNote,
+		},
+		&Rule{
+			ID:          RuleAptListsKept,
+			Analyzer:    AnalyzerLint,
+			Name:        "AptListsKept",
+			Description: "The apt package lists are not removed after 'apt-get install'",
+			Level:       LevelNote,
+		},
+		&Rule{
+			ID:          RuleSudoInstruction,
+			Analyzer:    AnalyzerLint,
+			Name:        "Sudo",
+			Description: "Don't use sudo in RUN instructions (use the USER instruction instead)",
+			Level:       LevelWarning,
+		},
+		&Rule{
+			ID:          RuleMaintainerUsed,
+			Analyzer:    AnalyzerLint,
+			Name:        "Maintainer",
+			Description: "The MAINTAINER instruction is deprecated (use a LABEL instead)",
+			Level:       LevelNote,
+		},
+		&Rule{
+			ID:          RuleCurlPipeToShell,
+			Analyzer:    AnalyzerLint,
+			Name:        "CurlPipeToShell",
+			Description: "Downloaded scripts are piped to a shell without verification",
+			Level:       LevelWarning,
+		})
+}
+
+// lintDockerfile checks the Dockerfile reverse engineered from the image history
+func lintDockerfile(artifactLocation string) ([]*Finding, error) {
+	lines, err := readLines(filepath.Join(artifactLocation, fatDockerfileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []*Finding
+	addFinding := func(ruleID, message string, line int) {
+		findings = append(findings, newFinding(ruleID, message, LocationArtifacts, fatDockerfileName, line))
+	}
+
+	for idx := 0; idx < len(lines); idx++ {
+		line := lines[idx]
+		lineNum := idx + 1
+
+		//multiline RUN instructions end with ' \'
+		inst := line
+		for strings.HasSuffix(lines[idx], "\\") && idx+1 < len(lines) {
+			idx++
+			inst += "\n" + lines[idx]
+		}
+
+		switch {
+		case strings.HasPrefix(inst, "ADD ") && !strings.HasPrefix(inst, baseImageAddPrefix):
+			addFinding(RuleAddInstruction, "ADD instruction: "+firstLine(inst), lineNum)
+		case strings.HasPrefix(inst, "MAINTAINER "):
+			addFinding(RuleMaintainerUsed, "MAINTAINER instruction: "+firstLine(inst), lineNum)
+		case strings.HasPrefix(inst, "RUN "):
+			if strings.Contains(inst, aptInstallCommand) && !strings.Contains(inst, aptListsCleanupMatch) {
+				addFinding(RuleAptListsKept, "'apt-get install' without removing /var/lib/apt/lists", lineNum)
+			}
+
+			if containsWord(inst, "sudo") {
+				addFinding(RuleSudoInstruction, "RUN instruction uses sudo", lineNum)
+			}
+
+			if (strings.Contains(inst, "curl ") || strings.Contains(inst, "wget ")) &&
+				(strings.Contains(inst, "| sh") || strings.Contains(inst, "| bash") ||
+					strings.Contains(inst, "|sh") || strings.Contains(inst, "|bash")) {
+				addFinding(RuleCurlPipeToShell, "RUN instruction pipes a downloaded script to a shell", lineNum)
+			}
+		}
+	}
+
+	return findings, nil
+}
+
+func firstLine(inst string) string {
+	return strings.SplitN(inst, "\n", 2)[0]
+}
+
+func containsWord(text, word string) bool {
+	for _, field := range strings.Fields(text) {
+		if field == word {
+			return true
+		}
+	}
+
+	return false
+}
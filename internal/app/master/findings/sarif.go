@@ -0,0 +1,166 @@
+package findings
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/docker-slim/docker-slim/pkg/version"
+)
+
+const (
+	sarifVersion   = "2.1.0"
+	sarifSchema    = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName  = "docker-slim"
+	sarifToolURI   = "https://github.com/docker-slim/docker-slim"
+	sarifImageRoot = "file:///"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                   `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLoc `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult               `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	Name                 string              `json:"name"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	DefaultConfiguration sarifRuleConfig     `json:"defaultConfiguration"`
+	Properties           sarifRuleProperties `json:"properties"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProperties struct {
+	Analyzer string `json:"analyzer"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLoc `json:"artifactLocation"`
+	Region           *sarifRegion     `json:"region,omitempty"`
+}
+
+type sarifArtifactLoc struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// SaveSARIF saves the findings in the SARIF format
+// (the artifact location is used to resolve the ARTIFACTS base URI)
+func SaveSARIF(filePath, artifactLocation string, findings []*Finding) error {
+	ruleList := Rules()
+	ruleIndexes := map[string]int{}
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           sarifToolName,
+				Version:        version.Tag(),
+				InformationURI: sarifToolURI,
+			},
+		},
+		OriginalURIBaseIDs: map[string]sarifArtifactLoc{
+			LocationImage:     {URI: sarifImageRoot},
+			LocationArtifacts: {URI: "file://" + artifactLocation + "/"},
+		},
+		Results: []sarifResult{},
+	}
+
+	for idx, rule := range ruleList {
+		ruleIndexes[rule.ID] = idx
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			Name:                 rule.Name,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifRuleConfig{Level: rule.Level},
+			Properties:           sarifRuleProperties{Analyzer: rule.Analyzer},
+		})
+	}
+
+	sorted := make([]*Finding, len(findings))
+	copy(sorted, findings)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].RuleID < sorted[j].RuleID
+	})
+
+	for _, finding := range sorted {
+		result := sarifResult{
+			RuleID:    finding.RuleID,
+			RuleIndex: ruleIndexes[finding.RuleID],
+			Level:     finding.Level,
+			Message:   sarifMessage{Text: finding.Message},
+		}
+
+		if finding.Path != "" {
+			location := sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLoc{
+						URI:       finding.Path,
+						URIBaseID: finding.BaseID,
+					},
+				},
+			}
+
+			//SARIF line numbers start with 1
+			if finding.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.Line}
+			}
+
+			result.Locations = append(result.Locations, location)
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	sarifData := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	}
+
+	data, err := json.MarshalIndent(sarifData, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filePath, data, 0644)
+}
@@ -0,0 +1,209 @@
+package findings
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/artifacts"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Secrets analyzer rule IDs
+const (
+	RulePrivateKey   = "secrets/private-key"
+	RuleAWSAccessKey = "secrets/aws-access-key"
+	RuleAPIToken     = "secrets/api-token"
+	RuleEnvSecret    = "secrets/env-secret"
+)
+
+const (
+	filesDirName      = "files"
+	fatDockerfileName = "Dockerfile.fat"
+	maxSecretFileSize = 1024 * 1024
+	binaryCheckSize   = 8000
+)
+
+type secretPattern struct {
+	ruleID  string
+	pattern *regexp.Regexp
+	what    string
+}
+
+var secretPatterns = []secretPattern{
+	{
+		ruleID:  RulePrivateKey,
+		pattern: regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`),
+		what:    "private key",
+	},
+	{
+		ruleID:  RuleAWSAccessKey,
+		pattern: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+		what:    "AWS access key ID",
+	},
+	{
+		ruleID:  RuleAPIToken,
+		pattern: regexp.MustCompile(`\b(xox[baprs]-[0-9A-Za-z-]{10,}|gh[pousr]_[0-9A-Za-z]{36})\b`),
+		what:    "API token",
+	},
+}
+
+func init() {
+	addRules(
+		&Rule{
+			ID:          RulePrivateKey,
+			Analyzer:    AnalyzerSecrets,
+			Name:        "PrivateKey",
+			Description: "A private key is stored in the image",
+			Level:       LevelError,
+		},
+		&Rule{
+			ID:          RuleAWSAccessKey,
+			Analyzer:    AnalyzerSecrets,
+			Name:        "AWSAccessKey",
+			Description: "An AWS access key ID is stored in the image",
+			Level:       LevelError,
+		},
+		&Rule{
+			ID:          RuleAPIToken,
+			Analyzer:    AnalyzerSecrets,
+			Name:        "APIToken",
+			Description: "An API token (GitHub, Slack) is stored in the image",
+			Level:       LevelError,
+		},
+		&Rule{
+			ID:          RuleEnvSecret,
+			Analyzer:    AnalyzerSecrets,
+			Name:        "EnvSecret",
+			Description: "A secret is set in an ENV instruction (it's visible in the image config and history)",
+			Level:       LevelWarning,
+		})
+}
+
+// findSecrets scans the files kept in the minified image and the ENV instructions
+func findSecrets(artifactLocation string) ([]*Finding, error) {
+	var findings []*Finding
+
+	filesLocation := filepath.Join(artifactLocation, filesDirName)
+	if _, err := os.Stat(filesLocation); err == nil {
+		err := filepath.Walk(filesLocation, func(fullPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Debugf("findings: secrets - error accessing %v: %v", fullPath, err)
+				return nil
+			}
+
+			if !info.Mode().IsRegular() || info.Size() > maxSecretFileSize {
+				return nil
+			}
+
+			imagePath, err := filepath.Rel(filesLocation, fullPath)
+			if err != nil {
+				return nil
+			}
+
+			findings = append(findings, scanFileSecrets(fullPath, filepath.ToSlash(imagePath))...)
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	findings = append(findings, findEnvSecrets(filepath.Join(artifactLocation, fatDockerfileName))...)
+
+	return findings, nil
+}
+
+func scanFileSecrets(fullPath, imagePath string) []*Finding {
+	data, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		log.Debugf("findings: secrets - error reading %v: %v", fullPath, err)
+		return nil
+	}
+
+	checkData := data
+	if len(checkData) > binaryCheckSize {
+		checkData = checkData[:binaryCheckSize]
+	}
+
+	if bytes.IndexByte(checkData, 0) != -1 {
+		//binary file
+		return nil
+	}
+
+	var findings []*Finding
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxSecretFileSize)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		for _, sp := range secretPatterns {
+			if sp.pattern.MatchString(line) {
+				findings = append(findings, newFinding(sp.ruleID,
+					fmt.Sprintf("Possible %s in /%s", sp.what, imagePath),
+					LocationImage,
+					imagePath,
+					lineNum))
+			}
+		}
+	}
+
+	return findings
+}
+
+func findEnvSecrets(dockerfilePath string) []*Finding {
+	lines, err := readLines(dockerfilePath)
+	if err != nil {
+		return nil
+	}
+
+	var findings []*Finding
+	for idx, line := range lines {
+		if !strings.HasPrefix(line, "ENV ") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "ENV "))
+		for _, field := range envVars(fields) {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				continue
+			}
+
+			//ENV instructions with secret-like names (and a value) probably include secrets
+			if artifacts.IsSecretEnvName(parts[0]) {
+				findings = append(findings, newFinding(RuleEnvSecret,
+					fmt.Sprintf("ENV instruction sets a secret-like variable - %s", parts[0]),
+					LocationArtifacts,
+					fatDockerfileName,
+					idx+1))
+			}
+		}
+	}
+
+	return findings
+}
+
+// envVars normalizes the 'ENV name value' and 'ENV name=value ...' instruction formats
+func envVars(fields []string) []string {
+	if len(fields) > 1 && !strings.Contains(fields[0], "=") {
+		return []string{fmt.Sprintf("%s=%s", fields[0], strings.Join(fields[1:], " "))}
+	}
+
+	return fields
+}
+
+func readLines(filePath string) ([]string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(string(data), "\n"), nil
+}
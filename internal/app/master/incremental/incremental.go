@@ -0,0 +1,195 @@
+package incremental
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/cache"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerimage"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	docker "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const filesDirName = "files"
+
+// Layers is the image layer record saved in the image state
+// (the incremental builds use it to find the images with the same bottom layers)
+type Layers struct {
+	IDs []string `json:"ids"`
+	// ConfigDigest is the digest of the image config fields that change how the app runs
+	ConfigDigest string `json:"config_digest"`
+}
+
+// Base is a previously minified image that shares the bottom layers with the target image
+type Base struct {
+	ImageID          string
+	ArtifactLocation string
+	SharedLayers     int
+	Layers           int
+	SameConfig       bool
+	// SkipMonitoring is true if the target app can't observe the changed layers
+	// (the image config is the same and none of the files the app used come from the changed layers)
+	SkipMonitoring bool
+}
+
+// NewLayers creates the image layer record
+func NewLayers(imageInfo *docker.Image, inventory *dockerimage.Inventory) *Layers {
+	return &Layers{
+		IDs:          inventory.Layers,
+		ConfigDigest: configDigest(imageInfo),
+	}
+}
+
+// Save saves the image layer record in the image state
+func (l *Layers) Save(localVolumePath string) {
+	cache.New(localVolumePath).Save(cache.EntryLayers, l)
+}
+
+// FindBase returns the minified image state with the most shared bottom layers
+// (more than half of the target image layers must be shared and the state must have the monitoring artifacts).
+// It returns nil if there's no base image state.
+func FindBase(statePath string, imageInfo *docker.Image, inventory *dockerimage.Inventory) (*Base, error) {
+	target := NewLayers(imageInfo, inventory)
+	if len(target.IDs) == 0 {
+		return nil, nil
+	}
+
+	imageID := imageInfo.ID
+	if parts := strings.SplitN(imageID, ":", 2); len(parts) == 2 {
+		imageID = parts[1]
+	}
+
+	location := fsutils.StateImagesDir(statePath)
+	entries, err := ioutil.ReadDir(location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var best *Base
+	var bestTime time.Time
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == imageID {
+			continue
+		}
+
+		localVolumePath, artifactLocation := fsutils.StateDirs(statePath, entry.Name())
+
+		var layers Layers
+		if !cache.New(localVolumePath).Load(cache.EntryLayers, &layers) {
+			continue
+		}
+
+		//the encrypted artifacts have the report in the encrypted archive
+		reportInfo, err := os.Stat(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+		if err != nil {
+			if reportInfo, err = os.Stat(filepath.Join(artifactLocation, fsutils.SealedArtifactsName)); err != nil {
+				continue
+			}
+		}
+
+		shared := sharedLayers(layers.IDs, target.IDs)
+		if shared*2 <= len(target.IDs) {
+			continue
+		}
+
+		if best != nil &&
+			(shared < best.SharedLayers || shared == best.SharedLayers && !reportInfo.ModTime().After(bestTime)) {
+			continue
+		}
+
+		best = &Base{
+			ImageID:          entry.Name(),
+			ArtifactLocation: artifactLocation,
+			SharedLayers:     shared,
+			Layers:           len(target.IDs),
+			SameConfig:       layers.ConfigDigest == target.ConfigDigest,
+		}
+		bestTime = reportInfo.ModTime()
+	}
+
+	if best == nil || !best.SameConfig {
+		return best, nil
+	}
+
+	artifactLocation, closeArtifacts, err := fsutils.OpenArtifacts(best.ArtifactLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer closeArtifacts()
+
+	creport, err := report.LoadContainerReport(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	unchanged := best.Unchanged(inventory)
+	best.SkipMonitoring = true
+	for _, file := range creport.Image.Files {
+		if file == nil {
+			continue
+		}
+
+		if !unchanged(file.FilePath) && !fsutils.IsDir(filepath.Join(artifactLocation, filesDirName, file.FilePath)) {
+			best.SkipMonitoring = false
+			break
+		}
+	}
+
+	return best, nil
+}
+
+// Unchanged returns a function that checks if the target image file comes from the shared layers
+// (the files from the changed layers and the removed files are not reused)
+func (b *Base) Unchanged(inventory *dockerimage.Inventory) func(filePath string) bool {
+	return func(filePath string) bool {
+		info, ok := inventory.Files[filePath]
+		return ok && info.LayerIndex < b.SharedLayers
+	}
+}
+
+func sharedLayers(base, target []string) int {
+	var count int
+	for count < len(base) && count < len(target) && base[count] == target[count] {
+		count++
+	}
+
+	return count
+}
+
+func configDigest(imageInfo *docker.Image) string {
+	if imageInfo.Config == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(struct {
+		Entrypoint []string
+		Cmd        []string
+		Env        []string
+		WorkingDir string
+		User       string
+	}{
+		Entrypoint: imageInfo.Config.Entrypoint,
+		Cmd:        imageInfo.Config.Cmd,
+		Env:        imageInfo.Config.Env,
+		WorkingDir: imageInfo.Config.WorkingDir,
+		User:       imageInfo.Config.User,
+	})
+	if err != nil {
+		return ""
+	}
+
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
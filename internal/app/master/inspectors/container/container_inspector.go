@@ -3,39 +3,109 @@ package container
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/artifacts"
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+	"github.com/docker-slim/docker-slim/internal/app/master/findings"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container/ipc"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/image"
+	"github.com/docker-slim/docker-slim/internal/app/master/kubernetes"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
 	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/k8s"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/oci"
 	"github.com/docker-slim/docker-slim/internal/app/master/security/seccomp"
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
 	"github.com/docker-slim/docker-slim/pkg/ipc/command"
+	"github.com/docker-slim/docker-slim/pkg/ipc/event"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
 	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/logutils"
+	v "github.com/docker-slim/docker-slim/pkg/version"
 
 	log "github.com/Sirupsen/logrus"
 	dockerapi "github.com/cloudimmunity/go-dockerclientx"
 )
 
-// IpcErrRecvTimeoutStr - an IPC receive timeout error
-const IpcErrRecvTimeoutStr = "receive time out"
+// ErrMonitorTimeout is returned when the sensor doesn't finish its work in time
+var ErrMonitorTimeout = errors.New("timeout waiting for the sensor to finish its work")
 
+// ErrArtifactCopyTimeout is returned when the artifacts are not copied from the container in time
+var ErrArtifactCopyTimeout = errors.New("timeout copying the artifacts from the container")
+
+// SensorError is an error communicating with the sensor in the target container
+type SensorError struct {
+	Err error
+}
+
+func (e *SensorError) Error() string {
+	return fmt.Sprintf("sensor error - %v", e.Err)
+}
+
+// IncompatibleSensorError is returned when the sensor and docker-slim don't support the same protocol version
+// (it's detected in the start monitor handshake)
+type IncompatibleSensorError struct {
+	SensorPath    string
+	SensorVersion string
+	Err           error
+}
+
+func (e *IncompatibleSensorError) Error() string {
+	sensorVersion := e.SensorVersion
+	if sensorVersion == "" {
+		sensorVersion = "unknown (older than the protocol version 2)"
+	}
+
+	return fmt.Sprintf("incompatible sensor %v (sensor version: %v, docker-slim version: %v) - %v. Install the %v binary from the same docker-slim release package next to docker-slim",
+		e.SensorPath, sensorVersion, v.Current(), e.Err, SensorBinLocal)
+}
+
+const (
+	SensorBinPath       = "/opt/dockerslim/bin/sensor"
+	SensorArtifactsPath = "/opt/dockerslim/artifacts"
+	ContainerNamePat    = "dockerslimk_%v_%v"
+	PodNamePat          = "dockerslimk-%v-%v"
+	ArtifactsDir        = "artifacts"
+	SensorBinLocal      = "docker-slim-sensor"
+	ArtifactsMountPat   = "%s:/opt/dockerslim/artifacts"
+	SensorMountPat      = "%s:/opt/dockerslim/bin/sensor:ro"
+	CmdPortDefault      = "65501/tcp"
+	EvtPortDefault      = "65502/tcp"
+	LabelName           = "dockerslim"
+)
+
+// NetworkModeContainerPrefix is the network mode prefix for the containers that share
+// the network namespace of another container
+const NetworkModeContainerPrefix = "container:"
+
+// Artifacts transfer modes (how the sensor gets into the target container and how the artifacts get out)
 const (
-	SensorBinPath     = "/opt/dockerslim/bin/sensor"
-	ContainerNamePat  = "dockerslimk_%v_%v"
-	ArtifactsDir      = "artifacts"
-	SensorBinLocal    = "docker-slim-sensor"
-	ArtifactsMountPat = "%s:/opt/dockerslim/artifacts"
-	SensorMountPat    = "%s:/opt/dockerslim/bin/sensor:ro"
-	CmdPortDefault    = "65501/tcp"
-	EvtPortDefault    = "65502/tcp"
-	LabelName         = "dockerslim"
+	// ArtifactsTransferAuto uses the Docker API for the remote Docker hosts and the bind mounts for the local ones
+	ArtifactsTransferAuto = "auto"
+	// ArtifactsTransferMount bind mounts the sensor and the local artifacts directory
+	ArtifactsTransferMount = "mount"
+	// ArtifactsTransferAPI copies the sensor and the artifacts with the Docker API (like 'docker cp')
+	ArtifactsTransferAPI = "api"
+)
+
+const (
+	portsInspectAttempts = 10
+	portsInspectInterval = 500 * time.Millisecond
+	sensorRetryInterval  = time.Second
+	// how long to wait for the target app to start after a restart
+	// (used when there's nothing to exercise the restarted app)
+	targetRestartWait = 5 * time.Second
 )
 
 // Inspector is a container execution inspector
@@ -55,11 +125,45 @@ type Inspector struct {
 	EtcHostsMaps      []string
 	DnsServers        []string
 	DnsSearchDomains  []string
+	CustomName        string
+	Labels            map[string]string
 	ShowContainerLogs bool
 	VolumeMounts      map[string]config.VolumeMount
 	ExcludePaths      map[string]bool
 	IncludePaths      map[string]bool
 	DoDebug           bool
+	SeccompMerge      *config.SeccompMerge
+	AnnotateSeccomp   bool
+	Capabilities      []string
+	FindingsCount     int
+	Findings          []*findings.Finding
+	EnvVars           []report.EnvVarUsage
+	Kubernetes        *config.Kubernetes
+	//the target container runs with the container runtime client if it's set (e.g., containerd)
+	//instead of the Docker API client
+	ContainerClient   runtime.ContainerClient
+	Timeouts          *config.Timeouts
+	ArtifactsTransfer string
+	CompressArtifacts bool
+	SensorThrottle    *config.SensorThrottle
+	IPCTransport      string
+	SensorDelivery    string
+	StatePath         string
+	ExecRedactPattern string
+	Dependencies      []config.Dependency
+	IncludeDistro     bool
+	IncludeTzdata     bool
+	IncludeLocales    []string
+	startMonitorCmd   *command.StartMonitor
+	kubeClient        *kubernetes.Client
+	portForward       *kubernetes.PortForward
+	useAPITransfer    bool
+	sshForward        *dockerclient.SSHPortForward
+	execTunnel        *execTunnel
+	sensorPath        string
+	sensorVolumeBind  string
+	sensorImage       string
+	depContainers     []*depContainer
 }
 
 func pathMapKeys(m map[string]bool) []string {
@@ -75,39 +179,113 @@ func pathMapKeys(m map[string]bool) []string {
 	return keys
 }
 
+// InspectorOptions are the container inspector options
+type InspectorOptions struct {
+	LocalVolumePath   string
+	Overrides         *config.ContainerOverrides
+	Links             []string
+	EtcHostsMaps      []string
+	DNSServers        []string
+	DNSSearchDomains  []string
+	ContainerName     string
+	ContainerLabels   map[string]string
+	ShowContainerLogs bool
+	VolumeMounts      map[string]config.VolumeMount
+	ExcludePaths      map[string]bool
+	IncludePaths      map[string]bool
+	SeccompMerge      *config.SeccompMerge
+	AnnotateSeccomp   bool
+	Debug             bool
+	Kubernetes        *config.Kubernetes
+	ContainerClient   runtime.ContainerClient
+	Timeouts          *config.Timeouts
+	ArtifactsTransfer string
+	CompressArtifacts bool
+	SensorThrottle    *config.SensorThrottle
+	IPCTransport      string
+	SensorDelivery    string
+	StatePath         string
+	ExecRedactPattern string
+	Dependencies      []config.Dependency
+	IncludeDistro     bool
+	IncludeTzdata     bool
+	IncludeLocales    []string
+	//the sensor command port (the event port is the next port, the default ports are used if it's not set)
+	SensorPort int
+}
+
 // NewInspector creates a new container execution inspector
 func NewInspector(client *dockerapi.Client,
 	imageInspector *image.Inspector,
-	localVolumePath string,
-	overrides *config.ContainerOverrides,
-	links []string,
-	etcHostsMaps []string,
-	dnsServers []string,
-	dnsSearchDomains []string,
-	showContainerLogs bool,
-	volumeMounts map[string]config.VolumeMount,
-	excludePaths map[string]bool,
-	includePaths map[string]bool,
-	doDebug bool) (*Inspector, error) {
+	opts *InspectorOptions) (*Inspector, error) {
+	timeouts := opts.Timeouts
+	if timeouts == nil {
+		timeouts = &config.Timeouts{}
+	}
+
+	sensorThrottle := opts.SensorThrottle
+	if sensorThrottle == nil {
+		sensorThrottle = &config.SensorThrottle{}
+	}
+
+	ipcTransport := opts.IPCTransport
+	if ipcTransport == "" {
+		ipcTransport = IPCTransportAuto
+	}
+
+	sensorDelivery := opts.SensorDelivery
+	if sensorDelivery == "" {
+		sensorDelivery = SensorDeliveryAuto
+	}
+
+	artifactsTransfer := opts.ArtifactsTransfer
+	if artifactsTransfer == "" {
+		artifactsTransfer = ArtifactsTransferAuto
+	}
 
 	inspector := &Inspector{
-		LocalVolumePath:   localVolumePath,
+		LocalVolumePath:   opts.LocalVolumePath,
 		CmdPort:           CmdPortDefault,
 		EvtPort:           EvtPortDefault,
 		ImageInspector:    imageInspector,
 		APIClient:         client,
-		Overrides:         overrides,
-		Links:             links,
-		EtcHostsMaps:      etcHostsMaps,
-		DnsServers:        dnsServers,
-		DnsSearchDomains:  dnsSearchDomains,
-		ShowContainerLogs: showContainerLogs,
-		VolumeMounts:      volumeMounts,
-		ExcludePaths:      excludePaths,
-		IncludePaths:      includePaths,
-		DoDebug:           doDebug,
+		Overrides:         opts.Overrides,
+		Links:             opts.Links,
+		EtcHostsMaps:      opts.EtcHostsMaps,
+		DnsServers:        opts.DNSServers,
+		DnsSearchDomains:  opts.DNSSearchDomains,
+		CustomName:        opts.ContainerName,
+		Labels:            opts.ContainerLabels,
+		ShowContainerLogs: opts.ShowContainerLogs,
+		VolumeMounts:      opts.VolumeMounts,
+		ExcludePaths:      opts.ExcludePaths,
+		IncludePaths:      opts.IncludePaths,
+		SeccompMerge:      opts.SeccompMerge,
+		AnnotateSeccomp:   opts.AnnotateSeccomp,
+		DoDebug:           opts.Debug,
+		Kubernetes:        opts.Kubernetes,
+		ContainerClient:   opts.ContainerClient,
+		Timeouts:          timeouts,
+		ArtifactsTransfer: artifactsTransfer,
+		CompressArtifacts: opts.CompressArtifacts,
+		SensorThrottle:    sensorThrottle,
+		IPCTransport:      ipcTransport,
+		SensorDelivery:    sensorDelivery,
+		StatePath:         opts.StatePath,
+		ExecRedactPattern: opts.ExecRedactPattern,
+		Dependencies:      opts.Dependencies,
+		IncludeDistro:     opts.IncludeDistro,
+		IncludeTzdata:     opts.IncludeTzdata,
+		IncludeLocales:    opts.IncludeLocales,
 	}
 
+	//the sensors sharing a network namespace (the sidecars) need their own IPC ports
+	if opts.SensorPort > 0 {
+		inspector.CmdPort = dockerapi.Port(fmt.Sprintf("%d/tcp", opts.SensorPort))
+		inspector.EvtPort = dockerapi.Port(fmt.Sprintf("%d/tcp", opts.SensorPort+1))
+	}
+
+	overrides := opts.Overrides
 	if overrides != nil && ((len(overrides.Entrypoint) > 0) || overrides.ClearEntrypoint) {
 		log.Debugf("overriding Entrypoint %+v => %+v (%v)",
 			imageInspector.ImageInfo.Config.Entrypoint, overrides.Entrypoint, overrides.ClearEntrypoint)
@@ -133,34 +311,255 @@ func NewInspector(client *dockerapi.Client,
 	return inspector, nil
 }
 
+// prepareContainer picks the target container name and the sensor binary
+// and returns the sensor arguments and the container labels
+func (i *Inspector) prepareContainer() ([]string, map[string]string, error) {
+	var containerCmd []string
+	if i.DoDebug {
+		containerCmd = append(containerCmd, "-d")
+	}
+
+	//the sensor logs are saved in the artifacts directory (using the same log format the master uses)
+	containerCmd = append(containerCmd,
+		"-log-format", logutils.Format(),
+		"-log-file", filepath.Join(SensorArtifactsPath, logutils.SensorLogFileName))
+
+	if i.CmdPort != CmdPortDefault {
+		containerCmd = append(containerCmd,
+			"-cmd-port", i.CmdPort.Port(),
+			"-evt-port", i.EvtPort.Port())
+	}
+
+	switch {
+	case i.CustomName != "":
+		i.ContainerName = i.CustomName
+	case i.Kubernetes != nil:
+		i.ContainerName = fmt.Sprintf(PodNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	default:
+		i.ContainerName = fmt.Sprintf(ContainerNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	}
+
+	//the sensor has to match the target image architecture (it runs in the target container)
+	sensorPath, err := FindSensor(i.ImageInspector.ImageInfo.Architecture, i.StatePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i.sensorPath = sensorPath
+
+	labels := map[string]string{}
+	for k, v := range i.Labels {
+		labels[k] = v
+	}
+
+	//the 'type' label is used to identify docker-slim containers (don't let users override it)
+	labels["type"] = LabelName
+
+	return containerCmd, labels, nil
+}
+
 // RunContainer starts the container inspector instance execution
 func (i *Inspector) RunContainer() error {
-	artifactsPath := filepath.Join(i.LocalVolumePath, ArtifactsDir)
-	sensorPath := filepath.Join(fsutils.ExeDir(), SensorBinLocal)
+	containerCmd, labels, err := i.prepareContainer()
+	if err != nil {
+		return err
+	}
+
+	if i.Kubernetes != nil {
+		if err := i.runPod(containerCmd, labels); err != nil {
+			return err
+		}
+
+		return i.startMonitor()
+	}
+
+	if i.ContainerClient != nil {
+		if err := i.runTask(containerCmd, labels); err != nil {
+			return err
+		}
+
+		return i.startMonitor()
+	}
+
+	//the rootless containers have only the user capabilities (in their own user namespace),
+	//so the privileged mode doesn't help and the sensor uses ptrace instead of FANOTIFY for the file activity
+	isRootless := dockerclient.IsRootless(i.APIClient)
+	if isRootless {
+		log.Info("RunContainer: rootless container engine - the sensor will use ptrace to monitor the file activity (only the main target app process is traced)")
+
+		//the container root user is mapped to the engine user (and the other container users to its subordinate uids),
+		//so the artifacts directory must be writable for all of them
+		if err := os.Chmod(filepath.Join(i.LocalVolumePath, ArtifactsDir), 0777); err != nil {
+			return err
+		}
+	}
+
+	if err := i.startDependencies(); err != nil {
+		return err
+	}
+
+	//the dependencies are not needed if the target container is not started
+	isStarted := false
+	defer func() {
+		if !isStarted {
+			i.removeDependencies()
+		}
+	}()
+
+	switch i.SensorDelivery {
+	case SensorDeliveryVolume:
+		if i.sensorVolumeBind, err = i.prepareSensorVolume(); err != nil {
+			return err
+		}
+	case SensorDeliveryImage:
+		if i.sensorImage, err = i.prepareSensorImage(); err != nil {
+			return err
+		}
+	}
+
+	containerOptions, err := i.newContainerOptions(containerCmd, labels, isRootless)
+	if err != nil {
+		return err
+	}
+
+	containerInfo, err := i.APIClient.CreateContainer(*containerOptions)
+	if err != nil {
+		audit.Container(audit.RuntimeDocker, audit.ActionCreate, containerOptions.Name, containerOptions.Config.Image, err)
+		return err
+	}
+
+	audit.Container(audit.RuntimeDocker, audit.ActionCreate, containerInfo.ID, containerOptions.Config.Image, nil)
+
+	i.ContainerID = containerInfo.ID
+	log.Infoln("RunContainer: created container =>", i.ContainerID)
+
+	if i.useAPITransfer {
+		if err := i.copySensorToContainer(); err != nil {
+			return err
+		}
+	}
+
+	if err := i.APIClient.StartContainer(i.ContainerID, nil); err != nil {
+		return err
+	}
+
+	if err := i.inspectPublishedPorts(); err != nil {
+		return err
+	}
+
+	log.Debugf("RunContainer: container NetworkSettings.Ports => %#v", i.ContainerInfo.NetworkSettings.Ports)
+
+	if dockerclient.IsSSHHost(os.Getenv("DOCKER_HOST")) {
+		if err := i.forwardSSHPorts(); err != nil {
+			return err
+		}
+	}
+
+	if err := i.setupIPCTransport(); err != nil {
+		return err
+	}
 
+	err = i.startMonitor()
+	isStarted = err == nil
+	return err
+}
+
+// setupIPCTransport tunnels the sensor connections with 'docker exec' if the published sensor ports
+// are not reachable (NAT, VPNs or the remote hosts without a network path to the container)
+// or if the exec transport is selected
+func (i *Inspector) setupIPCTransport() error {
+	if i.IPCTransport == IPCTransportTCP {
+		if i.sharesNetwork() {
+			return errors.New("the sensor ports are not published in the container network mode (use the 'exec' IPC transport)")
+		}
+
+		return nil
+	}
+
+	if i.DockerHostIP == "" {
+		i.DockerHostIP = dockerhost.GetIP()
+	}
+
+	ports := i.ContainerInfo.NetworkSettings.Ports
+	if i.IPCTransport == IPCTransportAuto && !i.sharesNetwork() {
+		if portsReachable(i.DockerHostIP, HostPort(ports[i.CmdPort]), HostPort(ports[i.EvtPort])) {
+			return nil
+		}
+
+		log.Warnf("RunContainer: the sensor ports are not reachable on %v - tunneling the sensor connections with 'docker exec'", i.DockerHostIP)
+	}
+
+	tunnel, err := newExecTunnel(runtime.NewDockerContainerClient(i.APIClient), i.ContainerID, []string{i.CmdPort.Port(), i.EvtPort.Port()})
+	if err != nil {
+		return err
+	}
+
+	i.execTunnel = tunnel
+	for _, port := range []dockerapi.Port{i.CmdPort, i.EvtPort} {
+		ports[port] = []dockerapi.PortBinding{{
+			HostIP:   localHostIP,
+			HostPort: tunnel.Ports[port.Port()],
+		}}
+	}
+
+	i.DockerHostIP = localHostIP
+	log.Debugf("RunContainer: tunneled sensor ports => %#v", tunnel.Ports)
+	return nil
+}
+
+// newContainerOptions creates the Docker options for the target container
+func (i *Inspector) newContainerOptions(containerCmd []string, labels map[string]string, isRootless bool) (*dockerapi.CreateContainerOptions, error) {
+	artifactsPath := filepath.Join(i.LocalVolumePath, ArtifactsDir)
 	artifactsMountInfo := fmt.Sprintf(ArtifactsMountPat, artifactsPath)
-	sensorMountInfo := fmt.Sprintf(SensorMountPat, sensorPath)
+	sensorMountInfo := fmt.Sprintf(SensorMountPat, i.sensorPath)
+
+	//Podman has the Docker API, but it handles the volume binds and the published ports differently
+	isPodman := dockerclient.IsPodman(i.APIClient)
+	if isPodman {
+		log.Debug("RunContainer: using the Podman API")
+	}
 
 	var volumeBinds []string
 	for _, volumeMount := range i.VolumeMounts {
+		//Podman doesn't create the missing bind mount sources (Docker creates them as directories)
+		if isPodman && filepath.IsAbs(volumeMount.Source) && !fsutils.Exists(volumeMount.Source) {
+			return nil, fmt.Errorf("volume mount source doesn't exist - %v (Podman doesn't create it)", volumeMount.Source)
+		}
+
 		mountInfo := fmt.Sprintf("%s:%s:%s", volumeMount.Source, volumeMount.Destination, volumeMount.Options)
 		volumeBinds = append(volumeBinds, mountInfo)
 	}
 
-	volumeBinds = append(volumeBinds, artifactsMountInfo)
-	volumeBinds = append(volumeBinds, sensorMountInfo)
+	//the sensor and the artifacts are copied for the remote Docker hosts (the local paths can't be mounted there)
+	//and with the 'api' transfer mode (no host filesystem permission problems with the bind mounts)
+	isRemote := dockerhost.IsRemote()
+	if isRemote && i.ArtifactsTransfer == ArtifactsTransferMount {
+		log.Warn("RunContainer: the local paths can't be mounted on the remote Docker host (using the Docker API to transfer the artifacts)")
+	}
 
-	var containerCmd []string
-	if i.DoDebug {
-		containerCmd = append(containerCmd, "-d")
+	i.useAPITransfer = isRemote || i.ArtifactsTransfer == ArtifactsTransferAPI
+
+	if !i.useAPITransfer {
+		volumeBinds = append(volumeBinds, artifactsMountInfo)
+		if i.SensorDelivery == SensorDeliveryAuto {
+			volumeBinds = append(volumeBinds, sensorMountInfo)
+		}
 	}
 
-	i.ContainerName = fmt.Sprintf(ContainerNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+	if i.sensorVolumeBind != "" {
+		volumeBinds = append(volumeBinds, i.sensorVolumeBind)
+	}
+
+	//the helper sensor image is the target image with the sensor layer
+	imageRef := i.ImageInspector.ImageRef
+	if i.sensorImage != "" {
+		imageRef = i.sensorImage
+	}
 
-	containerOptions := dockerapi.CreateContainerOptions{
+	containerOptions := &dockerapi.CreateContainerOptions{
 		Name: i.ContainerName,
 		Config: &dockerapi.Config{
-			Image: i.ImageInspector.ImageRef,
+			Image: imageRef,
 			//ExposedPorts: map[dockerapi.Port]struct{}{
 			//	i.CmdPort: {},
 			//	i.EvtPort: {},
@@ -168,7 +567,7 @@ func (i *Inspector) RunContainer() error {
 			Entrypoint: []string{SensorBinPath},
 			Cmd:        containerCmd,
 			Env:        i.Overrides.Env,
-			Labels:     map[string]string{"type": LabelName},
+			Labels:     labels,
 			Hostname:   i.Overrides.Hostname,
 		},
 		HostConfig: &dockerapi.HostConfig{
@@ -179,12 +578,21 @@ func (i *Inspector) RunContainer() error {
 		},
 	}
 
+	if isRootless {
+		containerOptions.HostConfig.Privileged = false
+		containerOptions.HostConfig.CapAdd = []string{"SYS_PTRACE"}
+	}
+
 	commsExposedPorts := map[dockerapi.Port]struct{}{
 		i.CmdPort: {},
 		i.EvtPort: {},
 	}
 
-	if len(i.Overrides.ExposedPorts) > 0 {
+	if i.sharesNetwork() {
+		//the container uses the network namespace (and the published ports) of another container,
+		//so there's nothing to expose or publish (the sensor connections are tunneled with 'docker exec')
+		containerOptions.HostConfig.PublishAllPorts = false
+	} else if len(i.Overrides.ExposedPorts) > 0 {
 		containerOptions.Config.ExposedPorts = i.Overrides.ExposedPorts
 		for k, v := range commsExposedPorts {
 			if _, ok := containerOptions.Config.ExposedPorts[k]; ok {
@@ -196,7 +604,23 @@ func (i *Inspector) RunContainer() error {
 		log.Debugf("RunContainer: Config.ExposedPorts => %#v", containerOptions.Config.ExposedPorts)
 	} else {
 		containerOptions.Config.ExposedPorts = commsExposedPorts
-		log.Debug("RunContainer: default exposed ports => %#v", containerOptions.Config.ExposedPorts)
+		log.Debugf("RunContainer: default exposed ports => %#v", containerOptions.Config.ExposedPorts)
+	}
+
+	if isPodman && !i.sharesNetwork() {
+		//the older Podman versions ignore PublishAllPorts, so the image and the container exposed ports
+		//are published explicitly (to random host ports)
+		containerOptions.HostConfig.PublishAllPorts = false
+		containerOptions.HostConfig.PortBindings = map[dockerapi.Port][]dockerapi.PortBinding{}
+		for port := range i.ExposedPorts() {
+			containerOptions.HostConfig.PortBindings[port] = []dockerapi.PortBinding{{}}
+		}
+
+		for port := range containerOptions.Config.ExposedPorts {
+			containerOptions.HostConfig.PortBindings[port] = []dockerapi.PortBinding{{}}
+		}
+
+		log.Debugf("RunContainer: Podman HostConfig.PortBindings => %#v", containerOptions.HostConfig.PortBindings)
 	}
 
 	if i.Overrides.Network != "" {
@@ -226,48 +650,187 @@ func (i *Inspector) RunContainer() error {
 		log.Debugf("RunContainer: HostConfig.DNSSearch => %v", i.DnsSearchDomains)
 	}
 
-	containerInfo, err := i.APIClient.CreateContainer(containerOptions)
+	return containerOptions, nil
+}
+
+// newStartMonitorCmd creates the sensor command that starts the target app
+func (i *Inspector) newStartMonitorCmd() *command.StartMonitor {
+	cmd := &command.StartMonitor{
+		ProtocolVersion: channel.ProtocolVersion,
+		MasterVersion:   v.Current(),
+	}
+	if len(i.FatContainerCmd) > 0 {
+		cmd.AppName = i.FatContainerCmd[0]
+		cmd.AppArgs = i.FatContainerCmd[1:]
+	}
+
+	if len(i.ExcludePaths) > 0 {
+		cmd.Excludes = pathMapKeys(i.ExcludePaths)
+	}
+
+	if len(i.IncludePaths) > 0 {
+		cmd.Includes = pathMapKeys(i.IncludePaths)
+	}
+
+	//the artifacts are compressed only when they are copied (no point compressing the bind mounted artifacts)
+	cmd.CompressArtifacts = i.CompressArtifacts && (i.useAPITransfer || i.Kubernetes != nil)
+
+	cmd.PtraceSampleRate = i.SensorThrottle.PtraceSampleRate
+	cmd.EventQueueSize = i.SensorThrottle.EventQueueSize
+	cmd.Nice = i.SensorThrottle.Nice
+	cmd.ExecRedactPattern = i.ExecRedactPattern
+	cmd.DistroIncludes = i.IncludeDistro
+	cmd.IncludeTzdata = i.IncludeTzdata
+	cmd.IncludeLocales = i.IncludeLocales
+
+	return cmd
+}
+
+// ContainerPlan is the target container configuration (used by the dry-run mode)
+type ContainerPlan struct {
+	Name         string
+	Runtime      string
+	SensorPath   string
+	SensorArgs   []string
+	StartMonitor *command.StartMonitor
+	//the Docker options are available only in the Docker mode
+	Options *dockerapi.CreateContainerOptions
+}
+
+// Plan returns the target container configuration without creating the container
+func (i *Inspector) Plan() (*ContainerPlan, error) {
+	containerCmd, labels, err := i.prepareContainer()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	i.ContainerID = containerInfo.ID
-	log.Infoln("RunContainer: created container =>", i.ContainerID)
+	plan := &ContainerPlan{
+		Name:         i.ContainerName,
+		Runtime:      runtime.Docker,
+		SensorPath:   i.sensorPath,
+		SensorArgs:   containerCmd,
+		StartMonitor: i.newStartMonitorCmd(),
+	}
 
-	if err := i.APIClient.StartContainer(i.ContainerID, nil); err != nil {
-		return err
+	switch {
+	case i.Kubernetes != nil:
+		plan.Runtime = "kubernetes"
+	case i.ContainerClient != nil:
+		plan.Runtime = i.ContainerClient.Name()
+	default:
+		plan.Options, err = i.newContainerOptions(containerCmd, labels, dockerclient.IsRootless(i.APIClient))
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if i.ContainerInfo, err = i.APIClient.InspectContainer(i.ContainerID); err != nil {
-		return err
+	return plan, nil
+}
+
+// startMonitor connects to the sensor and starts monitoring the target app
+func (i *Inspector) startMonitor() error {
+	if err := i.initContainerChannels(); err != nil {
+		return &SensorError{Err: err}
 	}
 
-	errutils.FailWhen(i.ContainerInfo.NetworkSettings == nil, "docker-slim: error => no network info")
-	errutils.FailWhen(len(i.ContainerInfo.NetworkSettings.Ports) < len(commsExposedPorts), "docker-slim: error => missing comms ports")
-	log.Debugf("RunContainer: container NetworkSettings.Ports => %#v", i.ContainerInfo.NetworkSettings.Ports)
+	cmd := i.newStartMonitorCmd()
+	i.startMonitorCmd = cmd
+
+	//the start command is retried until the container start timeout expires (if it's set)
+	deadline := time.Now().Add(i.Timeouts.ContainerStart)
+	for {
+		resp, err := ipc.SendContainerCmd(cmd)
+		if resp != nil {
+			//the version 1 sensors don't have the protocol versions in their responses
+			if versionErr := channel.CheckProtocolVersion(resp.Version); versionErr != nil {
+				return &SensorError{Err: &IncompatibleSensorError{
+					SensorPath:    i.sensorPath,
+					SensorVersion: resp.SensorVersion,
+					Err:           versionErr,
+				}}
+			}
 
-	if err = i.initContainerChannels(); err != nil {
-		return err
+			log.Debugf("startMonitor: sensor version - %v", resp.SensorVersion)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		//the rejected command is not retried (e.g., the sensor doesn't support the docker-slim protocol version)
+		if _, ok := err.(*command.Error); ok {
+			return &SensorError{Err: &IncompatibleSensorError{
+				SensorPath:    i.sensorPath,
+				SensorVersion: resp.SensorVersion,
+				Err:           err,
+			}}
+		}
+
+		if i.Timeouts.ContainerStart <= 0 || time.Now().After(deadline) {
+			return &SensorError{Err: err}
+		}
+
+		log.Debugf("startMonitor: sensor is not ready (%v), retrying...", err)
+		time.Sleep(sensorRetryInterval)
 	}
+}
 
-	cmd := &command.StartMonitor{
-		AppName: i.FatContainerCmd[0],
+// RestartTarget stops the target app and starts it again in the same monitoring session
+// (the sensor merges the data collected from all target app runs)
+func (i *Inspector) RestartTarget() error {
+	cmdResponse, err := ipc.SendContainerCmd(&command.StopMonitor{})
+	if err != nil {
+		return &SensorError{Err: err}
 	}
+	log.Debugf("'stop' monitor response => %+v", cmdResponse)
 
-	if len(i.FatContainerCmd) > 1 {
-		cmd.AppArgs = i.FatContainerCmd[1:]
+	evt, err := ipc.GetContainerEvt()
+	if err != nil {
+		return &SensorError{Err: err}
+	}
+	log.Debugf("sensor event => '%v'", evt)
+
+	if evt != event.StopMonitorDoneName {
+		return &SensorError{Err: fmt.Errorf("unexpected sensor event: %v", evt)}
 	}
 
-	if len(i.ExcludePaths) > 0 {
-		cmd.Excludes = pathMapKeys(i.ExcludePaths)
+	cmdResponse, err = ipc.SendContainerCmd(i.startMonitorCmd)
+	if err != nil {
+		return &SensorError{Err: err}
 	}
+	log.Debugf("'start' monitor response => %+v", cmdResponse)
 
-	if len(i.IncludePaths) > 0 {
-		cmd.Includes = pathMapKeys(i.IncludePaths)
+	return nil
+}
+
+// RestartTargets restarts the target app the given number of times in the same monitoring session.
+// The onRestart function is called after each restart (e.g., to probe the restarted app) and it returns
+// the channel that is closed when the target app run is done (nil waits for the app to start).
+// It returns false if the maximum monitoring period (the deadline) ends first.
+func (i *Inspector) RestartTargets(count int,
+	deadline <-chan time.Time,
+	onRestart func(idx int) <-chan struct{}) (bool, error) {
+	for idx := 0; idx < count; idx++ {
+		if err := i.RestartTarget(); err != nil {
+			return true, err
+		}
+
+		runDone := onRestart(idx)
+
+		var waitDone <-chan time.Time
+		if runDone == nil {
+			waitDone = time.After(targetRestartWait)
+		}
+
+		select {
+		case <-runDone:
+		case <-waitDone:
+		case <-deadline:
+			return false, nil
+		}
 	}
 
-	_, err = ipc.SendContainerCmd(cmd)
-	return err
+	return true, nil
 }
 
 func (i *Inspector) showContainerLogs() {
@@ -303,6 +866,14 @@ func (i *Inspector) showContainerLogs() {
 func (i *Inspector) ShutdownContainer() error {
 	i.shutdownContainerChannels()
 
+	if i.Kubernetes != nil {
+		return i.shutdownPod()
+	}
+
+	if i.ContainerClient != nil {
+		return i.shutdownTask()
+	}
+
 	if i.ShowContainerLogs {
 		i.showContainerLogs()
 	}
@@ -321,33 +892,62 @@ func (i *Inspector) ShutdownContainer() error {
 		errutils.WarnOn(err)
 	}
 
+	if i.sshForward != nil {
+		i.sshForward.Close()
+	}
+
+	if i.execTunnel != nil {
+		i.execTunnel.Close()
+	}
+
+	var copyErr error
+	if i.useAPITransfer {
+		copyErr = runWithTimeout(i.Timeouts.ArtifactCopy, ErrArtifactCopyTimeout, i.copyArtifactsFromContainer)
+		if copyErr == nil {
+			copyErr = i.unpackArtifacts()
+		}
+	}
+
 	removeOption := dockerapi.RemoveContainerOptions{
 		ID:            i.ContainerID,
 		RemoveVolumes: true,
 		Force:         true,
 	}
-	_ = i.APIClient.RemoveContainer(removeOption)
-	return nil
+	removeErr := i.APIClient.RemoveContainer(removeOption)
+	audit.Container(audit.RuntimeDocker, audit.ActionRemove, i.ContainerID, i.ImageInspector.ImageRef, removeErr)
+
+	if i.sensorImage != "" {
+		i.removeSensorImage()
+	}
+
+	i.removeDependencies()
+	return copyErr
+}
+
+// SensorEvents returns the informational sensor events (the monitoring progress and the warnings)
+// (the channel is closed when the monitoring is over)
+func (i *Inspector) SensorEvents() <-chan *event.Message {
+	return ipc.ContainerInfoEvts()
 }
 
 // FinishMonitoring ends the target container monitoring activities
-func (i *Inspector) FinishMonitoring() {
+// (returns ErrMonitorTimeout if the sensor doesn't finish its work in time)
+func (i *Inspector) FinishMonitoring() error {
 	cmdResponse, err := ipc.SendContainerCmd(&command.StopMonitor{})
 	errutils.WarnOn(err)
 	//_ = cmdResponse
-	log.Debugf("'stop' monitor response => '%v'", cmdResponse)
+	log.Debugf("'stop' monitor response => %+v", cmdResponse)
 
 	log.Info("waiting for the container to finish its work...")
 
 	//for now there's only one event ("done")
-	//getEvt() should timeout in two minutes (todo: pick a good timeout)
+	//getEvt() times out after the sensor done timeout (two minutes by default)
 	evt, err := ipc.GetContainerEvt()
 	log.Debugf("sensor event => '%v'", evt)
 
-	//don't want to expose mangos here... mangos.ErrRecvTimeout = errors.New("receive time out")
-	if err != nil && err.Error() == IpcErrRecvTimeoutStr {
+	if err == ipc.ErrEvtTimeout {
 		log.Info("timeout waiting for the docker-slim container to finish its work...")
-		return
+		return ErrMonitorTimeout
 	}
 
 	errutils.WarnOn(err)
@@ -356,7 +956,9 @@ func (i *Inspector) FinishMonitoring() {
 
 	cmdResponse, err = ipc.SendContainerCmd(&command.ShutdownSensor{})
 	errutils.WarnOn(err)
-	log.Debugf("'shutdown' sensor response => '%v'", cmdResponse)
+	log.Debugf("'shutdown' sensor response => %+v", cmdResponse)
+
+	return nil
 }
 
 func (i *Inspector) initContainerChannels() error {
@@ -371,17 +973,81 @@ func (i *Inspector) initContainerChannels() error {
 		}
 	*/
 
-	cmdPortBindings := i.ContainerInfo.NetworkSettings.Ports[i.CmdPort]
-	evtPortBindings := i.ContainerInfo.NetworkSettings.Ports[i.EvtPort]
-	i.DockerHostIP = dockerhost.GetIP()
+	cmdPort := HostPort(i.ContainerInfo.NetworkSettings.Ports[i.CmdPort])
+	evtPort := HostPort(i.ContainerInfo.NetworkSettings.Ports[i.EvtPort])
+	if i.DockerHostIP == "" {
+		i.DockerHostIP = dockerhost.GetIP()
+	}
 
-	if err := ipc.InitContainerChannels(i.DockerHostIP, cmdPortBindings[0].HostPort, evtPortBindings[0].HostPort); err != nil {
+	if err := ipc.InitContainerChannels(i.DockerHostIP, cmdPort, evtPort, i.Timeouts.SensorDone); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// inspectPublishedPorts inspects the started container until its comms ports are published
+// (the rootless engines publish the ports with a user mode port forwarder, which can take a moment)
+func (i *Inspector) inspectPublishedPorts() error {
+	for attempt := 0; ; attempt++ {
+		var err error
+		if i.ContainerInfo, err = i.APIClient.InspectContainer(i.ContainerID); err != nil {
+			return err
+		}
+
+		if i.ContainerInfo.NetworkSettings == nil {
+			return errors.New("no container network info")
+		}
+
+		if i.sharesNetwork() {
+			//no published ports (the tunneled sensor ports are added later)
+			if i.ContainerInfo.NetworkSettings.Ports == nil {
+				i.ContainerInfo.NetworkSettings.Ports = map[dockerapi.Port][]dockerapi.PortBinding{}
+			}
+
+			return nil
+		}
+
+		ports := i.ContainerInfo.NetworkSettings.Ports
+		if HostPort(ports[i.CmdPort]) != "" && HostPort(ports[i.EvtPort]) != "" {
+			return nil
+		}
+
+		if attempt == portsInspectAttempts {
+			return fmt.Errorf("comms ports are not published (%v, %v) - %#v", i.CmdPort, i.EvtPort, ports)
+		}
+
+		time.Sleep(portsInspectInterval)
+	}
+}
+
+// sharesNetwork returns true if the target container uses the network namespace of another container
+// (e.g., a sidecar monitored with its main container)
+func (i *Inspector) sharesNetwork() bool {
+	return i.Overrides != nil && strings.HasPrefix(i.Overrides.Network, NetworkModeContainerPrefix)
+}
+
+// HostPort returns the host port from the published port bindings
+// (the IPv4 binding is preferred because the IPv6 bindings are not always reachable)
+func HostPort(bindings []dockerapi.PortBinding) string {
+	var hostPort string
+	for _, binding := range bindings {
+		if binding.HostPort == "" {
+			continue
+		}
+
+		if !strings.Contains(binding.HostIP, ":") {
+			return binding.HostPort
+		}
+
+		if hostPort == "" {
+			hostPort = binding.HostPort
+		}
+	}
+
+	return hostPort
+}
+
 func (i *Inspector) shutdownContainerChannels() {
 	ipc.ShutdownContainerChannels()
 }
@@ -391,13 +1057,97 @@ func (i *Inspector) HasCollectedData() bool {
 	return fsutils.Exists(filepath.Join(i.ImageInspector.ArtifactLocation, report.DefaultContainerReportFileName))
 }
 
+// ExposedPorts returns the ports exposed by the target image (including the port overrides)
+func (i *Inspector) ExposedPorts() map[dockerapi.Port]struct{} {
+	exposedPorts := map[dockerapi.Port]struct{}{}
+	for k, v := range i.ImageInspector.ImageInfo.Config.ExposedPorts {
+		exposedPorts[k] = v
+	}
+
+	for k, v := range i.Overrides.ExposedPorts {
+		exposedPorts[k] = v
+	}
+
+	return exposedPorts
+}
+
 // ProcessCollectedData performs post-processing on the collected container data
 func (i *Inspector) ProcessCollectedData() error {
+	exposedPorts := i.ExposedPorts()
+
 	log.Info("generating AppArmor profile...")
-	err := apparmor.GenProfile(i.ImageInspector.ArtifactLocation, i.ImageInspector.AppArmorProfileName)
+	err := apparmor.GenProfile(i.ImageInspector.ArtifactLocation, i.ImageInspector.AppArmorProfileName, exposedPorts)
+	if err != nil {
+		return err
+	}
+
+	log.Info("generating seccomp profile...")
+	var annotatedProfileName string
+	if i.AnnotateSeccomp {
+		annotatedProfileName = seccomp.AnnotatedProfileName(i.ImageInspector.SeccompProfileName)
+	}
+
+	err = seccomp.GenProfile(i.ImageInspector.ArtifactLocation,
+		i.ImageInspector.SeccompProfileName,
+		annotatedProfileName,
+		i.SeccompMerge)
+	switch {
+	case err == seccomp.ErrNoSyscallData:
+		//e.g., the node agent profiles (the other artifacts don't reference the seccomp profile then)
+		log.Warn("docker-slim: no system call data in the container report - skipping the seccomp profile")
+		i.ImageInspector.SeccompProfileName = ""
+	case err != nil:
+		return err
+	}
+
+	log.Info("finding minimal capability set...")
+	i.Capabilities, err = capabilities.Find(i.ImageInspector.ArtifactLocation)
+	if err != nil {
+		return err
+	}
+
+	log.Info("generating OCI runtime spec...")
+	err = oci.GenSpec(i.ImageInspector.ArtifactLocation,
+		i.ImageInspector.OCISpecName,
+		i.ImageInspector.SeccompProfileName,
+		i.ImageInspector.AppArmorProfileName,
+		i.Capabilities,
+		i.VolumeMounts,
+		i.ImageInspector.ImageInfo.Config.Volumes)
+	if err != nil {
+		return err
+	}
+
+	log.Info("generating Kubernetes securityContext...")
+	err = k8s.GenSecurityContext(i.ImageInspector.ArtifactLocation,
+		i.ImageInspector.K8sSecurityContextName,
+		i.ImageInspector.SeccompProfileName,
+		i.ImageInspector.ImageInfo.Config.User,
+		i.Capabilities)
+	if err != nil {
+		return err
+	}
+
+	log.Info("checking environment variable usage...")
+	i.EnvVars, err = artifacts.EnvUsage(i.ImageInspector.ArtifactLocation, i.ImageInspector.ImageInfo.Config.Env)
+	if err != nil {
+		log.Warnf("error checking environment variable usage - %v", err)
+	}
+
+	log.Info("analyzing security findings...")
+	findingList, err := findings.Analyze(i.ImageInspector.ArtifactLocation,
+		i.ImageInspector.ImageRef,
+		i.ImageInspector.ImageInfo,
+		i.Capabilities,
+		exposedPorts,
+		i.EnvVars)
 	if err != nil {
 		return err
 	}
 
-	return seccomp.GenProfile(i.ImageInspector.ArtifactLocation, i.ImageInspector.SeccompProfileName)
+	i.FindingsCount = len(findingList)
+	i.Findings = findingList
+	return findings.SaveSARIF(filepath.Join(i.ImageInspector.ArtifactLocation, i.ImageInspector.FindingsReportName),
+		i.ImageInspector.ArtifactLocation,
+		findingList)
 }
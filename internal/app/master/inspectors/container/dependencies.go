@@ -0,0 +1,248 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Dependency readiness check types
+const (
+	// DepReadyTCP waits until the dependency port accepts connections (the port is published on the Docker host)
+	DepReadyTCP = "tcp:"
+	// DepReadyExec waits until the command succeeds in the dependency container (it runs with 'sh -c')
+	DepReadyExec = "exec:"
+)
+
+const (
+	depContainerNamePat = "dockerslim-dep-%s-%d-%s"
+	depReadyTimeout     = 2 * time.Minute
+	depReadyInterval    = time.Second
+	hostNetworkMode     = "host"
+)
+
+// ErrDepReadyTimeout is returned when a dependency container is not ready in time
+var ErrDepReadyTimeout = errors.New("timeout waiting for the dependency container to be ready")
+
+type depContainer struct {
+	ID   string
+	Name string
+	Dep  config.Dependency
+}
+
+// startDependencies starts the dependency containers and waits until they are ready.
+// The target container is linked to the dependency containers, so the target app can use
+// the dependency aliases as their host names (the host network has no links: the dependencies use localhost there).
+func (i *Inspector) startDependencies() error {
+	for _, dep := range i.Dependencies {
+		log.Infof("RunContainer: starting dependency container => %v (%v)", dep.Alias, dep.Image)
+		if err := i.startDependency(dep); err != nil {
+			i.removeDependencies()
+			return fmt.Errorf("dependency %v (%v) - %v", dep.Alias, dep.Image, err)
+		}
+	}
+
+	if i.Overrides.Network != hostNetworkMode {
+		for _, dc := range i.depContainers {
+			i.Links = append(i.Links, fmt.Sprintf("%s:%s", dc.Name, dc.Dep.Alias))
+		}
+	}
+
+	return nil
+}
+
+func (i *Inspector) startDependency(dep config.Dependency) error {
+	if err := i.pullDependencyImage(dep.Image); err != nil {
+		return err
+	}
+
+	dc := &depContainer{
+		Name: fmt.Sprintf(depContainerNamePat, dep.Alias, os.Getpid(), time.Now().UTC().Format("20060102150405")),
+		Dep:  dep,
+	}
+
+	containerOptions := dockerapi.CreateContainerOptions{
+		Name: dc.Name,
+		Config: &dockerapi.Config{
+			Image:  dep.Image,
+			Env:    dep.Env,
+			Labels: map[string]string{"type": LabelName},
+		},
+		HostConfig: &dockerapi.HostConfig{
+			NetworkMode: i.Overrides.Network,
+		},
+	}
+
+	if port := depReadyPort(dep); port != "" && i.Overrides.Network != hostNetworkMode {
+		//the port is published to a random host port for the readiness check
+		containerOptions.Config.ExposedPorts = map[dockerapi.Port]struct{}{port: {}}
+		containerOptions.HostConfig.PortBindings = map[dockerapi.Port][]dockerapi.PortBinding{port: {{}}}
+	}
+
+	containerInfo, err := i.APIClient.CreateContainer(containerOptions)
+	if err != nil {
+		audit.Container(audit.RuntimeDocker, audit.ActionCreate, dc.Name, containerOptions.Config.Image, err)
+		return err
+	}
+
+	audit.Container(audit.RuntimeDocker, audit.ActionCreate, containerInfo.ID, containerOptions.Config.Image, nil)
+
+	dc.ID = containerInfo.ID
+	i.depContainers = append(i.depContainers, dc)
+
+	if err := i.APIClient.StartContainer(dc.ID, nil); err != nil {
+		return err
+	}
+
+	return i.waitForDependency(dc)
+}
+
+func (i *Inspector) pullDependencyImage(imageRef string) error {
+	_, err := i.APIClient.InspectImage(imageRef)
+	if err == nil {
+		return nil
+	}
+
+	if err != dockerapi.ErrNoSuchImage {
+		return err
+	}
+
+	repo, tag := imageRef, "latest"
+	if idx := strings.LastIndex(repo, ":"); idx > strings.LastIndex(repo, "/") {
+		repo, tag = repo[:idx], repo[idx+1:]
+	}
+
+	log.Infof("RunContainer: pulling the dependency image => %v", imageRef)
+	err = i.APIClient.PullImage(dockerapi.PullImageOptions{
+		Repository:   repo,
+		Tag:          tag,
+		OutputStream: ioutil.Discard,
+	}, dockerapi.AuthConfiguration{})
+	audit.Image(audit.RuntimeDocker, audit.ActionPull, imageRef, err)
+	return err
+}
+
+// waitForDependency waits until the dependency readiness check passes
+// (the container start timeout is used if it's set)
+func (i *Inspector) waitForDependency(dc *depContainer) error {
+	timeout := depReadyTimeout
+	if i.Timeouts.ContainerStart > 0 {
+		timeout = i.Timeouts.ContainerStart
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ready, err := i.dependencyReady(dc)
+		if err != nil {
+			return err
+		}
+
+		if ready {
+			log.Debugf("RunContainer: dependency container is ready => %v", dc.Name)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return ErrDepReadyTimeout
+		}
+
+		time.Sleep(depReadyInterval)
+	}
+}
+
+func (i *Inspector) dependencyReady(dc *depContainer) (bool, error) {
+	info, err := i.APIClient.InspectContainer(dc.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if !info.State.Running {
+		return false, fmt.Errorf("the dependency container exited (exit code: %v)", info.State.ExitCode)
+	}
+
+	switch {
+	case strings.HasPrefix(dc.Dep.Ready, DepReadyTCP):
+		if i.Overrides.Network == hostNetworkMode {
+			return portsReachable(localHostIP, strings.TrimPrefix(dc.Dep.Ready, DepReadyTCP)), nil
+		}
+
+		if info.NetworkSettings == nil {
+			return false, nil
+		}
+
+		hostPort := HostPort(info.NetworkSettings.Ports[depReadyPort(dc.Dep)])
+		if hostPort == "" {
+			return false, nil
+		}
+
+		if i.DockerHostIP == "" {
+			i.DockerHostIP = dockerhost.GetIP()
+		}
+
+		return portsReachable(i.DockerHostIP, hostPort), nil
+	case strings.HasPrefix(dc.Dep.Ready, DepReadyExec):
+		exec, err := i.APIClient.CreateExec(dockerapi.CreateExecOptions{
+			Container:    dc.ID,
+			Cmd:          []string{"sh", "-c", strings.TrimPrefix(dc.Dep.Ready, DepReadyExec)},
+			AttachStdout: true,
+			AttachStderr: true,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		err = i.APIClient.StartExec(exec.ID, dockerapi.StartExecOptions{
+			OutputStream: ioutil.Discard,
+			ErrorStream:  ioutil.Discard,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		execInfo, err := i.APIClient.InspectExec(exec.ID)
+		if err != nil {
+			return false, err
+		}
+
+		return !execInfo.Running && execInfo.ExitCode == 0, nil
+	default:
+		return true, nil
+	}
+}
+
+// removeDependencies removes the dependency containers (with their anonymous volumes)
+func (i *Inspector) removeDependencies() {
+	for _, dc := range i.depContainers {
+		removeOption := dockerapi.RemoveContainerOptions{
+			ID:            dc.ID,
+			RemoveVolumes: true,
+			Force:         true,
+		}
+
+		err := i.APIClient.RemoveContainer(removeOption)
+		audit.Container(audit.RuntimeDocker, audit.ActionRemove, dc.ID, dc.Dep.Image, err)
+		if err != nil {
+			log.Debugf("error removing the dependency container %v - %v", dc.Name, err)
+		}
+	}
+
+	i.depContainers = nil
+}
+
+func depReadyPort(dep config.Dependency) dockerapi.Port {
+	if !strings.HasPrefix(dep.Ready, DepReadyTCP) {
+		return ""
+	}
+
+	return dockerapi.Port(fmt.Sprintf("%s/tcp", strings.TrimPrefix(dep.Ready, DepReadyTCP)))
+}
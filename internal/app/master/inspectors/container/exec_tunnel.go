@@ -0,0 +1,114 @@
+package container
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// IPC transport modes (how the master connects to the sensor ports)
+const (
+	// IPCTransportAuto uses the published sensor ports and tunnels the connections with 'docker exec'
+	// if the published ports are not reachable
+	IPCTransportAuto = "auto"
+	// IPCTransportTCP uses the published sensor ports
+	IPCTransportTCP = "tcp"
+	// IPCTransportExec tunnels the sensor connections with 'docker exec'
+	IPCTransportExec = "exec"
+)
+
+const (
+	portProbeTimeout   = 3 * time.Second
+	sensorRelayFlag    = "-relay"
+	sensorRelayAddrPat = "127.0.0.1:%s"
+)
+
+// execTunnel forwards the local ports to the ports in the target container with the container runtime exec
+// (e.g., 'docker exec'). Each connection runs the sensor in the relay mode in the container,
+// so no network path to the container is needed.
+type execTunnel struct {
+	// Ports maps the container ports to the local ports
+	Ports       map[string]string
+	client      runtime.ContainerClient
+	containerID string
+	listeners   []net.Listener
+}
+
+func newExecTunnel(client runtime.ContainerClient, containerID string, ports []string) (*execTunnel, error) {
+	tunnel := &execTunnel{
+		Ports:       map[string]string{},
+		client:      client,
+		containerID: containerID,
+	}
+
+	for _, port := range ports {
+		listener, err := net.Listen("tcp", net.JoinHostPort(localHostIP, "0"))
+		if err != nil {
+			tunnel.Close()
+			return nil, err
+		}
+
+		_, localPort, err := net.SplitHostPort(listener.Addr().String())
+		if err != nil {
+			listener.Close()
+			tunnel.Close()
+			return nil, err
+		}
+
+		tunnel.listeners = append(tunnel.listeners, listener)
+		tunnel.Ports[port] = localPort
+		go tunnel.serve(listener, port)
+	}
+
+	return tunnel, nil
+}
+
+func (t *execTunnel) serve(listener net.Listener, port string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			//the tunnel is closed
+			return
+		}
+
+		go t.relay(conn, port)
+	}
+}
+
+func (t *execTunnel) relay(conn net.Conn, port string) {
+	defer conn.Close()
+
+	relayLog := log.StandardLogger().WriterLevel(log.DebugLevel)
+	defer relayLog.Close()
+
+	relayCmd := []string{SensorBinPath, sensorRelayFlag, fmt.Sprintf(sensorRelayAddrPat, port)}
+	if err := t.client.ExecContainer(t.containerID, relayCmd, conn, conn, relayLog); err != nil {
+		log.Debugf("execTunnel.relay(%v): %v", port, err)
+	}
+}
+
+// Close stops forwarding the ports
+func (t *execTunnel) Close() {
+	for _, listener := range t.listeners {
+		listener.Close()
+	}
+}
+
+// portsReachable returns true if all ports are reachable on the host
+func portsReachable(host string, ports ...string) bool {
+	for _, port := range ports {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), portProbeTimeout)
+		if err != nil {
+			log.Debugf("portsReachable: %v", err)
+			return false
+		}
+
+		conn.Close()
+	}
+
+	return true
+}
@@ -0,0 +1,98 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/docker-slim/docker-slim/pkg/utils/logutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// SensorCmdPath is the start monitor command file in the instrumented images
+	SensorCmdPath = "/opt/dockerslim/sensor.json"
+	// InstrumentedLabel is the instrumented image label with the target image reference
+	InstrumentedLabel = "dockerslim.instrumented"
+	instrumentedDir   = "dockerslim"
+)
+
+// BuildInstrumentedImage builds the instrumented image: the target image with the sensor as its entrypoint.
+// The sensor runs in the standalone mode with the same start monitor command it gets in the target container,
+// so the instrumented containers (e.g., in a staging environment) save the monitoring artifacts
+// in the artifacts directory when they are stopped or when the target app exits.
+// The instrumented container command replaces the target app command.
+func (i *Inspector) BuildInstrumentedImage(imageName string) error {
+	//the sensor has to match the target image architecture (it runs in the instrumented containers)
+	sensorPath, err := FindSensor(i.ImageInspector.ImageInfo.Architecture, i.StatePath)
+	if err != nil {
+		return err
+	}
+
+	cmd := i.newStartMonitorCmd()
+	cmd.CompressArtifacts = false
+	cmdData, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	var entrypoint []string
+	entrypoint = append(entrypoint, SensorBinPath)
+	if i.DoDebug {
+		entrypoint = append(entrypoint, "-d")
+	}
+
+	//the arguments after '--' are the target app command (the instrumented container command)
+	entrypoint = append(entrypoint,
+		"-log-format", logutils.Format(),
+		"-log-file", path.Join(SensorArtifactsPath, logutils.SensorLogFileName),
+		"-standalone", SensorCmdPath,
+		"--")
+	entrypointData, err := json.Marshal(entrypoint)
+	if err != nil {
+		return err
+	}
+
+	//the sensor directory is copied as a whole, so the artifacts directory keeps its permissions
+	//(the target app user has to be able to save the artifacts)
+	var buildContext bytes.Buffer
+	tw := tar.NewWriter(&buildContext)
+	dockerfile := fmt.Sprintf("FROM %s\nCOPY %s %s/\nLABEL %s=%q\nENTRYPOINT %s\n",
+		i.ImageInspector.ImageInfo.ID,
+		instrumentedDir, path.Dir(SensorCmdPath),
+		InstrumentedLabel, i.ImageInspector.ImageRef,
+		entrypointData)
+	if err := writeDataTar(tw, "Dockerfile", []byte(dockerfile), 0644); err != nil {
+		return err
+	}
+
+	binDir := path.Join(instrumentedDir, path.Base(path.Dir(SensorBinPath)))
+	for _, dir := range []string{instrumentedDir, binDir} {
+		if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+			return err
+		}
+	}
+
+	artifactsDir := path.Join(instrumentedDir, path.Base(SensorArtifactsPath))
+	if err := tw.WriteHeader(&tar.Header{Name: artifactsDir + "/", Typeflag: tar.TypeDir, Mode: 0777}); err != nil {
+		return err
+	}
+
+	if err := writeSensorTar(tw, sensorPath, path.Join(binDir, path.Base(SensorBinPath))); err != nil {
+		return err
+	}
+
+	if err := writeDataTar(tw, path.Join(instrumentedDir, path.Base(SensorCmdPath)), cmdData, 0644); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	log.Debugf("BuildInstrumentedImage: building the instrumented image => %v", imageName)
+	return i.buildSensorImage(imageName, &buildContext)
+}
@@ -1,7 +1,9 @@
 package ipc
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -16,8 +18,30 @@ import (
 	"github.com/docker-slim/docker-slim/pkg/ipc/event"
 )
 
+// DefaultEvtTimeout is how long to wait for the next sensor event
+const DefaultEvtTimeout = 2 * time.Minute
+
+// Channel errors (the transport errors are not exposed)
+var (
+	ErrCmdTimeout    = errors.New("timeout sending the sensor command")
+	ErrEvtTimeout    = errors.New("timeout waiting for the sensor event")
+	ErrChannelClosed = errors.New("sensor event channel is closed")
+)
+
+const (
+	cmdTimeout = 3 * time.Second
+	cmdRetries = 3
+	//the sensor connection is lost if there are no heartbeats for this long
+	heartbeatTimeout = 3 * channel.HeartbeatInterval
+	//how long the commands are retried while the lost sensor connection is reconnected
+	reconnectTimeout = time.Minute
+	evtQueueSize     = 16
+	infoEvtQueueSize = 64
+)
+
 // InitContainerChannels initializes the communication channels with the target container
-func InitContainerChannels(dockerHostIP, cmdChannelPort, evtChannelPort string) error {
+// (the event channel uses the default event timeout if evtTimeout is not set)
+func InitContainerChannels(dockerHostIP, cmdChannelPort, evtChannelPort string, evtTimeout time.Duration) error {
 	cmdChannelAddr = fmt.Sprintf("tcp://%v:%v", dockerHostIP, cmdChannelPort)
 	evtChannelAddr = fmt.Sprintf("tcp://%v:%v", dockerHostIP, evtChannelPort)
 	log.Debugf("cmdChannelAddr=%v evtChannelAddr=%v", cmdChannelAddr, evtChannelAddr)
@@ -26,6 +50,10 @@ func InitContainerChannels(dockerHostIP, cmdChannelPort, evtChannelPort string)
 	//cmdChannelAddr = fmt.Sprintf("ipc://%v/ipc/docker-slim-sensor.cmds.ipc", localVolumePath)
 
 	var err error
+	if evtTimeout <= 0 {
+		evtTimeout = DefaultEvtTimeout
+	}
+
 	evtChannel, err = newEvtChannel(evtChannelAddr)
 	if err != nil {
 		return err
@@ -35,21 +63,44 @@ func InitContainerChannels(dockerHostIP, cmdChannelPort, evtChannelPort string)
 		return err
 	}
 
+	//the events are read in the background, so the heartbeats are handled
+	//even when the master is not waiting for an event
+	health = &connHealth{}
+	evtQueue = make(chan event.Name, evtQueueSize)
+	infoEvtQueue = make(chan *event.Message, infoEvtQueueSize)
+	getEvtTimeout = evtTimeout
+	go readEvts(evtChannel, evtQueue, infoEvtQueue, health)
+	pingStop = make(chan struct{})
+	go pingSensor(cmdChannel, health, pingStop)
+
 	return nil
 }
 
 // SendContainerCmd sends the given command to the target container
-func SendContainerCmd(cmd command.Message) (string, error) {
+// (returns ErrCmdTimeout if the sensor doesn't respond and the command error if the sensor rejects the command)
+func SendContainerCmd(cmd command.Message) (*command.Response, error) {
 	return sendCmd(cmdChannel, cmd)
 }
 
 // GetContainerEvt returns the current event generated by the target container
+// (returns ErrEvtTimeout if there's no event before the event timeout)
 func GetContainerEvt() (event.Name, error) {
-	return getEvt(evtChannel)
+	return getEvt(evtQueue, getEvtTimeout)
+}
+
+// ContainerInfoEvts returns the informational events from the target container
+// (the channel is closed when the communication channels are shut down)
+func ContainerInfoEvts() <-chan *event.Message {
+	return infoEvtQueue
 }
 
 // ShutdownContainerChannels destroys the communication channels with the target container
 func ShutdownContainerChannels() {
+	if pingStop != nil {
+		close(pingStop)
+		pingStop = nil
+	}
+
 	shutdownEvtChannel()
 	shutdownCmdChannel()
 }
@@ -59,18 +110,24 @@ var cmdChannelAddr = fmt.Sprintf("tcp://127.0.0.1:%d", channel.CmdPort)
 
 var cmdChannel mangos.Socket
 
+//the command channel is shared by the commands and the pings
+var (
+	cmdLock  sync.Mutex
+	pingStop chan struct{}
+)
+
 func newCmdClient(addr string) (mangos.Socket, error) {
 	socket, err := req.NewSocket()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := socket.SetOption(mangos.OptionSendDeadline, time.Second*3); err != nil {
+	if err := socket.SetOption(mangos.OptionSendDeadline, cmdTimeout); err != nil {
 		socket.Close()
 		return nil, err
 	}
 
-	if err := socket.SetOption(mangos.OptionRecvDeadline, time.Second*3); err != nil {
+	if err := socket.SetOption(mangos.OptionRecvDeadline, cmdTimeout); err != nil {
 		socket.Close()
 		return nil, err
 	}
@@ -92,46 +149,93 @@ func shutdownCmdChannel() {
 	}
 }
 
-func sendCmd(channel mangos.Socket, cmd command.Message) (string, error) {
-	sendTimeouts := 0
-	recvTimeouts := 0
-
+func sendCmd(channel mangos.Socket, cmd command.Message) (*command.Response, error) {
 	log.Debugf("sendCmd(%s)", cmd)
-	for {
-		sendData, err := command.Encode(cmd)
-		if err != nil {
-			log.Info("sendCmd(): malformed cmd - ", err)
-			return "", err
-		}
+	sendData, err := command.Encode(cmd)
+	if err != nil {
+		log.Info("sendCmd(): malformed cmd - ", err)
+		return nil, err
+	}
+
+	cmdLock.Lock()
+	defer cmdLock.Unlock()
 
+	//the request is sent again after each timeout (a new request cancels the previous one)
+	//and it's retried longer if the sensor connection is lost (waiting for the reconnect)
+	reconnectDeadline := time.Now().Add(reconnectTimeout)
+	for attempt := 1; ; attempt++ {
 		if err := channel.Send(sendData); err != nil {
-			switch err {
-			case mangos.ErrSendTimeout:
-				log.Info("sendCmd(): send timeout...")
-				sendTimeouts++
-				if sendTimeouts > 3 {
-					return "", err
-				}
-			default:
-				return "", err
+			if err != mangos.ErrSendTimeout {
+				return nil, err
+			}
+
+			log.Info("sendCmd(): send timeout...")
+			if attempt > cmdRetries && !(health.isLost() && time.Now().Before(reconnectDeadline)) {
+				return nil, ErrCmdTimeout
 			}
+
+			continue
 		}
 
-		response, err := channel.Recv()
+		rawResponse, err := channel.Recv()
 		if err != nil {
-			switch err {
-			case mangos.ErrRecvTimeout:
-				log.Info("sendCmd(): receive timeout...")
-				recvTimeouts++
-				if recvTimeouts > 3 {
-					return "", err
-				}
-			default:
-				return "", err
+			if err != mangos.ErrRecvTimeout {
+				return nil, err
+			}
+
+			log.Info("sendCmd(): receive timeout...")
+			if attempt > cmdRetries && !(health.isLost() && time.Now().Before(reconnectDeadline)) {
+				return nil, ErrCmdTimeout
 			}
+
+			continue
+		}
+
+		response, err := command.DecodeResponse(rawResponse)
+		if err != nil {
+			return nil, err
+		}
+
+		return response, response.Err()
+	}
+}
+
+// pingSensor pings the sensor on the command channel until the channels are shut down
+// (the version 1 sensors don't send the heartbeats, so they are not pinged)
+func pingSensor(socket mangos.Socket, health *connHealth, stop <-chan struct{}) {
+	pingData, err := command.Encode(&command.Ping{})
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(channel.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
 		}
 
-		return string(response), nil
+		if !health.isActive() {
+			continue
+		}
+
+		cmdLock.Lock()
+		err := socket.Send(pingData)
+		if err == nil {
+			_, err = socket.Recv()
+		}
+		cmdLock.Unlock()
+
+		switch err {
+		case nil:
+		case mangos.ErrClosed:
+			return
+		default:
+			log.Debugf("sensor connection: ping error - %v", err)
+		}
 	}
 }
 
@@ -140,13 +244,21 @@ var evtChannelAddr = fmt.Sprintf("tcp://127.0.0.1:%d", channel.EvtPort)
 //var evtChannelAddr = "ipc:///tmp/docker-slim-sensor.events.ipc"
 var evtChannel mangos.Socket
 
+var (
+	evtQueue      chan event.Name
+	infoEvtQueue  chan *event.Message
+	getEvtTimeout time.Duration
+	health        *connHealth
+)
+
 func newEvtChannel(addr string) (mangos.Socket, error) {
 	socket, err := sub.NewSocket()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := socket.SetOption(mangos.OptionRecvDeadline, time.Second*120); err != nil {
+	//the event reader wakes up at least once per heartbeat interval to check the connection health
+	if err := socket.SetOption(mangos.OptionRecvDeadline, channel.HeartbeatInterval); err != nil {
 		socket.Close()
 		return nil, err
 	}
@@ -173,13 +285,128 @@ func shutdownEvtChannel() {
 	}
 }
 
-func getEvt(channel mangos.Socket) (event.Name, error) {
+func getEvt(evts <-chan event.Name, timeout time.Duration) (event.Name, error) {
 	log.Debug("getEvt()")
-	evt, err := channel.Recv()
-	log.Debug("getEvt(): channel.Recv() - done")
-	if err != nil {
-		return "", err
+	select {
+	case name, ok := <-evts:
+		log.Debug("getEvt(): done")
+		if !ok {
+			return "", ErrChannelClosed
+		}
+
+		return name, nil
+	case <-time.After(timeout):
+		return "", ErrEvtTimeout
 	}
+}
+
+// readEvts reads the sensor events until the event channel is closed
+// (the heartbeats are not queued, but the events they carry are queued if they were missed;
+// the informational events are queued separately and they are dropped if nobody reads them)
+func readEvts(channel mangos.Socket, evts chan<- event.Name, infoEvts chan<- *event.Message, health *connHealth) {
+	defer close(evts)
+	defer close(infoEvts)
+
+	var lastSeq uint64
+	for {
+		rawEvt, err := channel.Recv()
+		if err != nil {
+			if err != mangos.ErrRecvTimeout {
+				log.Debugf("readEvts(): %v", err)
+				return
+			}
+
+			health.check()
+			continue
+		}
+
+		evt, err := event.Decode(rawEvt)
+		if err != nil {
+			log.Debugf("readEvts(): malformed event - %v", err)
+			continue
+		}
+
+		if event.IsInfo(evt.Name) {
+			select {
+			case infoEvts <- evt:
+			default:
+			}
+
+			continue
+		}
+
+		if evt.Name == event.HeartbeatName {
+			health.heartbeat()
+			if evt.Last == nil || evt.Last.Seq <= lastSeq {
+				continue
+			}
+
+			log.Debugf("sensor connection: recovered the missed '%v' event", evt.Last.Name)
+			evt = evt.Last
+		}
+
+		//the version 1 events are not numbered
+		if evt.Seq != 0 {
+			if evt.Seq <= lastSeq {
+				continue
+			}
+
+			lastSeq = evt.Seq
+		}
+
+		health.check()
+		evts <- evt.Name
+	}
+}
+
+// connHealth tracks the sensor connection health with the sensor heartbeats
+// (the version 1 sensors don't send the heartbeats, so their connections are never lost)
+type connHealth struct {
+	sync.Mutex
+	lastHeartbeat time.Time
+	lost          bool
+}
+
+func (h *connHealth) heartbeat() {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.lost {
+		log.Debugf("sensor connection: restored (no heartbeats for %v)", time.Since(h.lastHeartbeat).Round(time.Second))
+		h.lost = false
+	}
+
+	h.lastHeartbeat = time.Now()
+}
+
+func (h *connHealth) check() {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.lastHeartbeat.IsZero() || h.lost {
+		return
+	}
+
+	if silence := time.Since(h.lastHeartbeat); silence > heartbeatTimeout {
+		log.Debugf("sensor connection: lost (no heartbeats for %v), reconnecting...", silence.Round(time.Second))
+		h.lost = true
+	}
+}
+
+func (h *connHealth) isActive() bool {
+	h.Lock()
+	defer h.Unlock()
+
+	return !h.lastHeartbeat.IsZero()
+}
+
+func (h *connHealth) isLost() bool {
+	if h == nil {
+		return false
+	}
+
+	h.Lock()
+	defer h.Unlock()
 
-	return event.Name(evt), nil
+	return h.lost
 }
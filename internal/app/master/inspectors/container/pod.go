@@ -0,0 +1,261 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/kubernetes"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	PodTargetContainer    = "target"
+	PodSensorContainer    = "dockerslim-sensor"
+	PodArtifactsContainer = "dockerslim-artifacts"
+	podSensorVolume       = "dockerslim-sensor"
+	podArtifactsVolume    = "dockerslim-artifacts"
+	podStartTimeout       = 5 * time.Minute
+)
+
+// runPod starts the target container in a Kubernetes pod
+// (an init container waits for the sensor to be copied to the pod
+// and a helper container keeps the artifacts available after the sensor is done)
+func (i *Inspector) runPod(sensorArgs []string, labels map[string]string) (err error) {
+	client, err := kubernetes.New(i.Kubernetes)
+	if err != nil {
+		return err
+	}
+
+	i.kubeClient = client
+
+	if len(i.VolumeMounts) > 0 || len(i.Links) > 0 || i.Overrides.Network != "" {
+		log.Warn("RunContainer: volume mounts, container links and network overrides are ignored in the Kubernetes mode")
+	}
+
+	pod := i.newPod(sensorArgs, labels)
+	if err := client.CreatePod(pod); err != nil {
+		return err
+	}
+
+	i.ContainerID = i.ContainerName
+	log.Infoln("RunContainer: created pod =>", i.ContainerName)
+
+	defer func() {
+		if err != nil {
+			if delErr := client.DeletePod(i.ContainerName); delErr != nil {
+				log.Infof("RunContainer: error deleting pod => %v - %v", i.ContainerName, delErr)
+			}
+		}
+	}()
+
+	startTimeout := podStartTimeout
+	if i.Timeouts.ContainerStart > 0 {
+		startTimeout = i.Timeouts.ContainerStart
+	}
+
+	if err := client.WaitForContainer(i.ContainerName, PodSensorContainer, startTimeout); err != nil {
+		return err
+	}
+
+	if err := client.CopyFileToPod(i.ContainerName, PodSensorContainer, i.sensorPath, SensorBinPath, 0755); err != nil {
+		return err
+	}
+
+	if err := client.WaitForContainer(i.ContainerName, PodTargetContainer, startTimeout); err != nil {
+		return err
+	}
+
+	ports := []dockerapi.Port{i.CmdPort, i.EvtPort}
+	for port := range i.ExposedPorts() {
+		//kubectl forwards only the TCP ports
+		if port.Proto() == "tcp" {
+			ports = append(ports, port)
+		}
+	}
+
+	var podPorts []string
+	for _, port := range ports {
+		podPorts = append(podPorts, port.Port())
+	}
+
+	if i.portForward, err = client.PortForward(i.ContainerName, podPorts); err != nil {
+		return err
+	}
+
+	//the pod ports are forwarded to the local ports (the rest of the inspector uses them as the published container ports)
+	portBindings := map[dockerapi.Port][]dockerapi.PortBinding{}
+	for _, port := range ports {
+		portBindings[port] = []dockerapi.PortBinding{
+			{
+				HostIP:   kubernetes.LocalHost,
+				HostPort: i.portForward.Ports[port.Port()],
+			},
+		}
+	}
+
+	i.DockerHostIP = kubernetes.LocalHost
+	i.ContainerInfo = &dockerapi.Container{
+		ID:   i.ContainerName,
+		Name: i.ContainerName,
+		NetworkSettings: &dockerapi.NetworkSettings{
+			Ports: portBindings,
+		},
+	}
+
+	log.Debugf("RunContainer: pod ports => %#v", portBindings)
+	return nil
+}
+
+func (i *Inspector) newPod(sensorArgs []string, labels map[string]string) *kubernetes.Pod {
+	helperImage := i.Kubernetes.HelperImage
+	if helperImage == "" {
+		helperImage = kubernetes.DefaultHelperImage
+	}
+
+	sensorMount := kubernetes.VolumeMount{
+		Name:      podSensorVolume,
+		MountPath: filepath.Dir(SensorBinPath),
+	}
+
+	artifactsMount := kubernetes.VolumeMount{
+		Name:      podArtifactsVolume,
+		MountPath: SensorArtifactsPath,
+	}
+
+	pod := kubernetes.NewPod(i.ContainerName, labels)
+	pod.Spec.Volumes = []kubernetes.Volume{
+		{Name: podSensorVolume, EmptyDir: &struct{}{}},
+		{Name: podArtifactsVolume, EmptyDir: &struct{}{}},
+	}
+
+	pod.Spec.InitContainers = []kubernetes.Container{
+		{
+			Name:         PodSensorContainer,
+			Image:        helperImage,
+			Command:      []string{"sh", "-c", fmt.Sprintf("until [ -x %s ]; do sleep 1; done", SensorBinPath)},
+			VolumeMounts: []kubernetes.VolumeMount{sensorMount},
+		},
+	}
+
+	privileged := true
+	target := kubernetes.Container{
+		Name:    PodTargetContainer,
+		Image:   i.ImageInspector.ImageRef,
+		Command: []string{SensorBinPath},
+		Args:    sensorArgs,
+		VolumeMounts: []kubernetes.VolumeMount{
+			{Name: podSensorVolume, MountPath: sensorMount.MountPath, ReadOnly: true},
+			artifactsMount,
+		},
+		SecurityContext: &kubernetes.SecurityContext{
+			Privileged: &privileged,
+			Capabilities: &kubernetes.Capabilities{
+				Add: []string{"SYS_ADMIN"},
+			},
+		},
+	}
+
+	for _, envVar := range i.Overrides.Env {
+		parts := strings.SplitN(envVar, "=", 2)
+		env := kubernetes.EnvVar{Name: parts[0]}
+		if len(parts) == 2 {
+			env.Value = parts[1]
+		}
+
+		target.Env = append(target.Env, env)
+	}
+
+	for port := range i.ExposedPorts() {
+		portNumber, err := strconv.Atoi(port.Port())
+		if err != nil {
+			continue
+		}
+
+		target.Ports = append(target.Ports, kubernetes.ContainerPort{
+			ContainerPort: portNumber,
+			Protocol:      strings.ToUpper(port.Proto()),
+		})
+	}
+
+	helper := kubernetes.Container{
+		Name:         PodArtifactsContainer,
+		Image:        helperImage,
+		Command:      []string{"sh", "-c", "trap 'exit 0' TERM; while true; do sleep 1; done"},
+		VolumeMounts: []kubernetes.VolumeMount{artifactsMount},
+	}
+
+	pod.Spec.Containers = []kubernetes.Container{target, helper}
+	pod.Spec.Hostname = i.Overrides.Hostname
+
+	//the --add-host values use the Docker format (host:ip)
+	for _, hostMap := range i.EtcHostsMaps {
+		parts := strings.SplitN(hostMap, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		pod.Spec.HostAliases = append(pod.Spec.HostAliases, kubernetes.HostAlias{
+			IP:        parts[1],
+			Hostnames: []string{parts[0]},
+		})
+	}
+
+	if len(i.DnsServers) > 0 || len(i.DnsSearchDomains) > 0 {
+		pod.Spec.DNSConfig = &kubernetes.PodDNSConfig{
+			Nameservers: i.DnsServers,
+			Searches:    i.DnsSearchDomains,
+		}
+
+		if len(i.DnsServers) > 0 {
+			pod.Spec.DNSPolicy = "None"
+		}
+	}
+
+	return pod
+}
+
+// shutdownPod copies the artifacts from the pod and deletes the pod
+func (i *Inspector) shutdownPod() error {
+	if i.portForward != nil {
+		i.portForward.Close()
+	}
+
+	if i.ShowContainerLogs {
+		i.showPodLogs()
+	}
+
+	log.Info("copying the artifacts from the pod...")
+	artifactsPath := filepath.Join(i.LocalVolumePath, ArtifactsDir)
+	err := runWithTimeout(i.Timeouts.ArtifactCopy, ErrArtifactCopyTimeout, func() error {
+		return i.kubeClient.CopyDirFromPod(i.ContainerName, PodArtifactsContainer, SensorArtifactsPath, artifactsPath)
+	})
+
+	if err == nil {
+		err = i.unpackArtifacts()
+	}
+
+	if delErr := i.kubeClient.DeletePod(i.ContainerName); delErr != nil {
+		log.Infof("error deleting pod => %v - %v", i.ContainerName, delErr)
+	}
+
+	return err
+}
+
+func (i *Inspector) showPodLogs() {
+	var outData bytes.Buffer
+	if err := i.kubeClient.Logs(i.ContainerName, PodTargetContainer, &outData); err != nil {
+		log.Infof("error getting pod logs => %v - %v", i.ContainerName, err)
+		return
+	}
+
+	fmt.Println("docker-slim: pod container output:")
+	outData.WriteTo(os.Stdout)
+	fmt.Println("docker-slim: end of pod container logs =============")
+}
@@ -0,0 +1,285 @@
+package exec
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Environment variables with the target container addresses for the test script
+const (
+	EnvTargetHost  = "DSLIM_TARGET_HOST"
+	EnvTargetPorts = "DSLIM_TARGET_PORTS"
+	//the host port for each published container port (e.g., 'DSLIM_TARGET_PORT_8080')
+	EnvTargetPortPrefix = "DSLIM_TARGET_PORT_"
+)
+
+const (
+	defaultStartWait   = 4 * time.Second
+	readyCheckInterval = 500 * time.Millisecond
+	readyDialTimeout   = time.Second
+)
+
+// TestProbe runs a user test script against the published ports of the target container
+type TestProbe struct {
+	PrintState bool
+	Printer    *console.Printer
+	File       string
+	TargetHost string
+	//container port (e.g., '8080/tcp') => host port
+	Ports map[string]string
+	//how long to wait for the target app to accept connections
+	//(the probe waits a few seconds if it's not set)
+	ReadyTimeout time.Duration
+	ExitCode     int
+	Err          error
+	Duration     time.Duration
+	cmd          *exec.Cmd
+	lock         sync.Mutex
+	stopOnce     sync.Once
+	stopChan     chan struct{}
+	doneChan     chan struct{}
+}
+
+// NewTestProbe creates a new test script probe for the target container
+func NewTestProbe(inspector *container.Inspector,
+	file string,
+	printState bool,
+	printer *console.Printer) (*TestProbe, error) {
+	probe, err := NewEndpointTestProbe(inspector.DockerHostIP, targetPorts(inspector), file, printState, printer)
+	if err != nil {
+		return nil, err
+	}
+
+	if inspector.Timeouts != nil {
+		probe.ReadyTimeout = inspector.Timeouts.AppReady
+	}
+
+	return probe, nil
+}
+
+// NewEndpointTestProbe creates a new test script probe for the given host and ports
+// (container port => host port)
+func NewEndpointTestProbe(targetHost string,
+	ports map[string]string,
+	file string,
+	printState bool,
+	printer *console.Printer) (*TestProbe, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return nil, fmt.Errorf("test script is not an executable file - %v", file)
+	}
+
+	probe := &TestProbe{
+		PrintState: printState,
+		Printer:    printer,
+		File:       file,
+		TargetHost: targetHost,
+		Ports:      ports,
+		ExitCode:   -1,
+		stopChan:   make(chan struct{}),
+		doneChan:   make(chan struct{}),
+	}
+
+	return probe, nil
+}
+
+// Start starts the test script (the script output goes to stderr,
+// so it doesn't mix with the JSON console output)
+func (p *TestProbe) Start() {
+	go func() {
+		defer close(p.doneChan)
+
+		p.waitForApp()
+
+		p.lock.Lock()
+		if p.isStopped() {
+			p.lock.Unlock()
+			p.Err = fmt.Errorf("the monitoring ended before the test script started")
+			return
+		}
+
+		p.cmd = exec.Command(p.File)
+		p.cmd.Env = append(os.Environ(), p.env()...)
+		p.cmd.Stdout = os.Stderr
+		p.cmd.Stderr = os.Stderr
+		//the script is the process group leader, so its child processes are stopped with it
+		p.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+		if p.PrintState {
+			p.Printer.Info("exec.probe", "state", "starting", "file", p.File)
+		}
+
+		log.Infof("test script probe started - %v", p.File)
+		startTime := time.Now()
+		err := p.cmd.Start()
+		p.lock.Unlock()
+
+		if err == nil {
+			err = p.cmd.Wait()
+		}
+
+		p.Duration = time.Since(startTime)
+		switch exitErr := err.(type) {
+		case nil:
+			p.ExitCode = 0
+		case *exec.ExitError:
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				p.Err = fmt.Errorf("the test script was killed (%v)", status.Signal())
+			} else {
+				p.ExitCode = exitErr.ExitCode()
+			}
+		default:
+			p.Err = err
+		}
+
+		log.Infof("test script probe done - exit code: %v error: %v", p.ExitCode, p.Err)
+
+		if p.PrintState {
+			p.Printer.Info("exec.probe", "state", "done", "exit.code", p.ExitCode)
+		}
+	}()
+}
+
+// Stop kills the test script if it's still running
+// (the monitoring ended before the script was done)
+func (p *TestProbe) Stop() {
+	p.stopOnce.Do(func() { close(p.stopChan) })
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.cmd != nil && p.cmd.Process != nil {
+		select {
+		case <-p.doneChan:
+		default:
+			log.Info("test script probe: the monitoring is over, stopping the test script...")
+			syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}
+}
+
+// env returns the environment variables with the target container addresses
+func (p *TestProbe) env() []string {
+	return targetEnv(p.TargetHost, p.Ports)
+}
+
+// targetPorts returns the published target container ports without the sensor ports
+// (container port => host port)
+func targetPorts(inspector *container.Inspector) map[string]string {
+	ports := map[string]string{}
+	for nsPortKey, nsPortData := range inspector.ContainerInfo.NetworkSettings.Ports {
+		if (nsPortKey == inspector.CmdPort) || (nsPortKey == inspector.EvtPort) {
+			continue
+		}
+
+		if hostPort := container.HostPort(nsPortData); hostPort != "" {
+			ports[string(nsPortKey)] = hostPort
+		}
+	}
+
+	return ports
+}
+
+// targetEnv returns the environment variables with the target container addresses
+func targetEnv(targetHost string, ports map[string]string) []string {
+	var hostPorts []string
+	vars := []string{fmt.Sprintf("%s=%s", EnvTargetHost, targetHost)}
+	for containerPort, hostPort := range ports {
+		hostPorts = append(hostPorts, hostPort)
+		portName := strings.Replace(containerPort, "/tcp", "", 1)
+		portName = strings.ToUpper(strings.Replace(portName, "/", "_", -1))
+		vars = append(vars, fmt.Sprintf("%s%s=%s", EnvTargetPortPrefix, portName, hostPort))
+	}
+
+	sort.Strings(hostPorts)
+	vars = append(vars, fmt.Sprintf("%s=%s", EnvTargetPorts, strings.Join(hostPorts, ",")))
+	return vars
+}
+
+// waitForApp waits until the target app accepts connections on any published port
+// (or until the ready timeout expires; the script starts anyway)
+func (p *TestProbe) waitForApp() {
+	if p.ReadyTimeout <= 0 || len(p.Ports) == 0 {
+		select {
+		case <-time.After(defaultStartWait):
+		case <-p.stopChan:
+		}
+		return
+	}
+
+	deadline := time.Now().Add(p.ReadyTimeout)
+	for {
+		for _, port := range p.Ports {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(p.TargetHost, port), readyDialTimeout)
+			if err == nil {
+				conn.Close()
+				log.Debugf("test script probe: target app is ready (port %v)", port)
+				return
+			}
+		}
+
+		if time.Now().After(deadline) {
+			log.Infof("test script probe: target app is not ready after %v", p.ReadyTimeout)
+			return
+		}
+
+		select {
+		case <-time.After(readyCheckInterval):
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+func (p *TestProbe) isStopped() bool {
+	select {
+	case <-p.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// DoneChan returns the 'done' channel for the test script probe
+func (p *TestProbe) DoneChan() <-chan struct{} {
+	return p.doneChan
+}
+
+// Passed returns true if the test script exited with the zero exit code
+// (call it only after the probe is done)
+func (p *TestProbe) Passed() bool {
+	return p.Err == nil && p.ExitCode == 0
+}
+
+// Report returns the test script results (call it only after the probe is done)
+func (p *TestProbe) Report() *report.ExecProbeReport {
+	result := &report.ExecProbeReport{
+		File:     p.File,
+		ExitCode: p.ExitCode,
+		Passed:   p.Passed(),
+		Duration: p.Duration.Round(time.Millisecond).String(),
+	}
+
+	if p.Err != nil {
+		result.Error = p.Err.Error()
+	}
+
+	return result
+}
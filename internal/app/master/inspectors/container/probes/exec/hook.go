@@ -0,0 +1,86 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Monitoring hook stages
+const (
+	HookBeforeMonitor = "before-monitor"
+	HookAfterMonitor  = "after-monitor"
+)
+
+// Environment variables with the target container information for the hooks
+// (the hooks also get the target container addresses the test script gets)
+const (
+	EnvHook              = "DSLIM_HOOK"
+	EnvTargetContainer   = "DSLIM_TARGET_CONTAINER"
+	EnvTargetContainerID = "DSLIM_TARGET_CONTAINER_ID"
+	EnvArtifactsDir      = "DSLIM_ARTIFACTS_DIR"
+)
+
+// RunHook runs the hook command on the host (with 'sh -c') and waits for it to finish.
+// The before-monitor hook runs before the probes start and the after-monitor hook runs
+// when the monitoring is over, but the target container is still running.
+// The hook output goes to stderr, so it doesn't mix with the JSON console output.
+// The hook runs with the docker-slim privileges (often root or the docker group),
+// so the hook commands must come only from the local command line, never from the remote
+// job requests, the image lists or the project config files.
+func RunHook(inspector *container.Inspector,
+	stage string,
+	command string,
+	artifactsDir string,
+	printer *console.Printer) *report.HookReport {
+	result := &report.HookReport{
+		Stage:    stage,
+		Command:  command,
+		ExitCode: -1,
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), targetEnv(inspector.DockerHostIP, targetPorts(inspector))...)
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("%s=%s", EnvHook, stage),
+		fmt.Sprintf("%s=%s", EnvTargetContainer, inspector.ContainerName),
+		fmt.Sprintf("%s=%s", EnvTargetContainerID, inspector.ContainerID),
+		fmt.Sprintf("%s=%s", EnvArtifactsDir, artifactsDir))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	printer.Info("hook", "stage", stage, "state", "starting")
+	log.Infof("%v hook started - %v", stage, command)
+
+	startTime := time.Now()
+	err := cmd.Run()
+	result.Duration = time.Since(startTime).Round(time.Millisecond).String()
+
+	switch exitErr := err.(type) {
+	case nil:
+		result.ExitCode = 0
+	case *exec.ExitError:
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			result.Error = fmt.Sprintf("the hook was killed (%v)", status.Signal())
+		} else {
+			result.ExitCode = exitErr.ExitCode()
+			result.Error = fmt.Sprintf("the hook exited with the exit code %v", result.ExitCode)
+		}
+	default:
+		result.Error = err.Error()
+	}
+
+	result.Passed = result.Error == ""
+	log.Infof("%v hook done - exit code: %v error: %v", stage, result.ExitCode, result.Error)
+	printer.Info("hook", "stage", stage, "state", "done", "exit.code", result.ExitCode)
+
+	return result
+}
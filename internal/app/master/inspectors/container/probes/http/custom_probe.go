@@ -1,47 +1,96 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	nethttp "net/http"
+	"strings"
 	"time"
 
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
 	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/netutils"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/franela/goreq"
 )
 
+const (
+	defaultRequestTimeout = 5 * time.Second
+	defaultStartWait      = 4 * time.Second
+	readyCheckInterval    = 500 * time.Millisecond
+	readyDialTimeout      = time.Second
+	connectTimeout        = 10 * time.Second
+)
+
 // CustomProbe is a custom HTTP probe
 type CustomProbe struct {
-	PrintState         bool
-	PrintPrefix        string
-	Ports              []string
-	Cmds               []config.HTTPProbeCmd
-	ContainerInspector *container.Inspector
-	doneChan           chan struct{}
+	PrintState bool
+	Printer    *console.Printer
+	TargetHost string
+	Ports      []string
+	Cmds       []config.HTTPProbeCmd
+	//how long to wait for the target app to accept connections
+	//(the probe waits a few seconds if it's not set)
+	ReadyTimeout time.Duration
+	CallCount    uint64
+	OkCount      uint64
+	ErrCount     uint64
+	Results      []report.HTTPProbeResult
+	okCmds       map[string]bool
+	hostClients  map[string]*nethttp.Client
+	doneChan     chan struct{}
 }
 
 // NewCustomProbe creates a new custom HTTP probe
 func NewCustomProbe(inspector *container.Inspector,
 	cmds []config.HTTPProbeCmd,
 	printState bool,
-	printPrefix string) (*CustomProbe, error) {
+	printer *console.Printer) (*CustomProbe, error) {
 	//note: the default probe should already be there if the user asked for it
 
-	probe := &CustomProbe{
-		PrintState:         printState,
-		PrintPrefix:        printPrefix,
-		Cmds:               cmds,
-		ContainerInspector: inspector,
-		doneChan:           make(chan struct{}),
-	}
-
+	var ports []string
 	for nsPortKey, nsPortData := range inspector.ContainerInfo.NetworkSettings.Ports {
 		if (nsPortKey == inspector.CmdPort) || (nsPortKey == inspector.EvtPort) {
 			continue
 		}
 
-		probe.Ports = append(probe.Ports, nsPortData[0].HostPort)
+		if hostPort := container.HostPort(nsPortData); hostPort != "" {
+			ports = append(ports, hostPort)
+		}
+	}
+
+	probe, err := NewEndpointProbe(inspector.DockerHostIP, ports, cmds, printState, printer)
+	if err != nil {
+		return nil, err
+	}
+
+	if inspector.Timeouts != nil {
+		probe.ReadyTimeout = inspector.Timeouts.AppReady
+	}
+
+	return probe, nil
+}
+
+// NewEndpointProbe creates a new custom HTTP probe for the given host and ports
+func NewEndpointProbe(targetHost string,
+	ports []string,
+	cmds []config.HTTPProbeCmd,
+	printState bool,
+	printer *console.Printer) (*CustomProbe, error) {
+	probe := &CustomProbe{
+		PrintState:  printState,
+		Printer:     printer,
+		TargetHost:  targetHost,
+		Ports:       ports,
+		Cmds:        cmds,
+		okCmds:      map[string]bool{},
+		hostClients: map[string]*nethttp.Client{},
+		doneChan:    make(chan struct{}),
 	}
 
 	return probe, nil
@@ -50,15 +99,14 @@ func NewCustomProbe(inspector *container.Inspector,
 // Start starts the HTTP probe instance execution
 func (p *CustomProbe) Start() {
 	go func() {
-		//TODO: need to do a better job figuring out if the target app is ready to accept connections
-		time.Sleep(4 * time.Second)
+		p.waitForApp()
 
 		if p.PrintState {
-			fmt.Printf("%s state=http.probe.starting\n", p.PrintPrefix)
+			p.Printer.Info("http.probe", "state", "starting")
 		}
 
 		log.Info("HTTP probe started...")
-		goreq.SetConnectTimeout(10 * time.Second)
+		goreq.SetConnectTimeout(connectTimeout)
 
 		for _, port := range p.Ports {
 			for _, cmd := range p.Cmds {
@@ -69,22 +117,38 @@ func (p *CustomProbe) Start() {
 					protocols = []string{cmd.Protocol}
 				}
 
+				timeout := defaultRequestTimeout
+				if cmd.Timeout > 0 {
+					timeout = time.Duration(cmd.Timeout) * time.Second
+				}
+
 				for _, proto := range protocols {
-					addr := fmt.Sprintf("%s://%v:%v%v", proto, p.ContainerInspector.DockerHostIP, port, cmd.Resource)
-					res, err := goreq.Request{
-						Method:  cmd.Method,
-						Uri:     addr,
-						Body:    cmd.Body,
-						Timeout: 5 * time.Second,
-						//ShowDebug: true,
-					}.Do()
+					addr := fmt.Sprintf("%s://%v:%v%v", proto, p.TargetHost, port, cmd.Resource)
+					statusCode, err := p.call(cmd, addr, timeout)
+					p.CallCount++
+
+					result := report.HTTPProbeResult{
+						Method:   cmd.Method,
+						Resource: cmd.Resource,
+						Host:     cmd.Host,
+						Protocol: proto,
+						Port:     port,
+					}
 
 					if err == nil {
-						log.Infof("http probe - %v %v => %v", cmd.Method, addr, res.StatusCode)
+						result.StatusCode = statusCode
+						p.Results = append(p.Results, result)
+						p.OkCount++
+						p.okCmds[cmdKey(cmd)] = true
+						log.Infof("http probe - %v %v%v => %v", cmd.Method, addr, hostInfo(cmd), statusCode)
 						break
 					}
 
-					log.Infof("http probe - %v %v error: %v", cmd.Method, addr, err)
+					err = netutils.ProxyError(err, addr)
+					result.Error = err.Error()
+					p.Results = append(p.Results, result)
+					p.ErrCount++
+					log.Infof("http probe - %v %v%v error: %v", cmd.Method, addr, hostInfo(cmd), err)
 				}
 			}
 		}
@@ -92,14 +156,143 @@ func (p *CustomProbe) Start() {
 		log.Info("HTTP probe done.")
 
 		if p.PrintState {
-			fmt.Printf("%s state=http.probe.done\n", p.PrintPrefix)
+			p.Printer.Info("http.probe", "state", "done")
 		}
 
 		close(p.doneChan)
 	}()
 }
 
+// call executes the probe command and returns the response status code.
+// The commands with a host use their own client, so the host is both the Host header and the TLS server name (SNI)
+// and the name-based virtual hosts in the target app select the right site and certificate.
+func (p *CustomProbe) call(cmd config.HTTPProbeCmd, addr string, timeout time.Duration) (int, error) {
+	if cmd.Host == "" {
+		res, err := goreq.Request{
+			Method:  cmd.Method,
+			Uri:     addr,
+			Body:    cmd.Body,
+			Timeout: timeout,
+			//ShowDebug: true,
+		}.Do()
+		if err != nil {
+			return 0, err
+		}
+
+		res.Body.Close()
+		return res.StatusCode, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := nethttp.NewRequestWithContext(ctx, cmd.Method, addr, strings.NewReader(cmd.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Host = cmd.Host
+	res, err := p.hostClient(cmd.Host).Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// hostClient returns the HTTP client for the virtual host
+// (the same as the goreq client: proxies from the environment and no redirects)
+func (p *CustomProbe) hostClient(host string) *nethttp.Client {
+	if client, ok := p.hostClients[host]; ok {
+		return client
+	}
+
+	serverName := host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		serverName = name
+	}
+
+	client := &nethttp.Client{
+		Transport: &nethttp.Transport{
+			Proxy:           nethttp.ProxyFromEnvironment,
+			DialContext:     (&net.Dialer{Timeout: connectTimeout}).DialContext,
+			TLSClientConfig: &tls.Config{ServerName: serverName},
+		},
+		CheckRedirect: func(req *nethttp.Request, via []*nethttp.Request) error {
+			return nethttp.ErrUseLastResponse
+		},
+	}
+
+	p.hostClients[host] = client
+	return client
+}
+
+func hostInfo(cmd config.HTTPProbeCmd) string {
+	if cmd.Host == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" (host %v)", cmd.Host)
+}
+
+// waitForApp waits until the target app accepts connections on any probe port
+// (or until the ready timeout expires; the probe starts anyway)
+func (p *CustomProbe) waitForApp() {
+	if p.ReadyTimeout <= 0 || len(p.Ports) == 0 {
+		time.Sleep(defaultStartWait)
+		return
+	}
+
+	deadline := time.Now().Add(p.ReadyTimeout)
+	for {
+		for _, port := range p.Ports {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(p.TargetHost, port), readyDialTimeout)
+			if err == nil {
+				conn.Close()
+				log.Debugf("HTTP probe: target app is ready (port %v)", port)
+				return
+			}
+		}
+
+		if time.Now().After(deadline) {
+			log.Infof("HTTP probe: target app is not ready after %v", p.ReadyTimeout)
+			return
+		}
+
+		time.Sleep(readyCheckInterval)
+	}
+}
+
 // DoneChan returns the 'done' channel for the HTTP probe instance
 func (p *CustomProbe) DoneChan() <-chan struct{} {
 	return p.doneChan
 }
+
+// Report returns the HTTP probe results (call it only after the probe is done)
+func (p *CustomProbe) Report() *report.HTTPProbeReport {
+	return &report.HTTPProbeReport{
+		CallCount:  p.CallCount,
+		OkCount:    p.OkCount,
+		ErrorCount: p.ErrCount,
+		Results:    p.Results,
+	}
+}
+
+// FailedCmds returns the probe commands that worked with the reference probe, but not with this probe
+// (call it only after the probes are done)
+func (p *CustomProbe) FailedCmds(ref *CustomProbe) []config.HTTPProbeCmd {
+	var failed []config.HTTPProbeCmd
+	for _, cmd := range p.Cmds {
+		key := cmdKey(cmd)
+		if ref.okCmds[key] && !p.okCmds[key] {
+			failed = append(failed, cmd)
+		}
+	}
+
+	return failed
+}
+
+func cmdKey(cmd config.HTTPProbeCmd) string {
+	return fmt.Sprintf("%s:%s:%s:%s", cmd.Protocol, cmd.Method, cmd.Host, cmd.Resource)
+}
@@ -0,0 +1,164 @@
+package container
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const localHostIP = "127.0.0.1"
+
+// copySensorToContainer copies the sensor to the created (not started) container
+// (used instead of the sensor bind mount for the remote Docker hosts and with the 'api' artifacts transfer mode).
+// Only the artifacts directory is created if the sensor is delivered with a volume or a helper image.
+func (i *Inspector) copySensorToContainer() error {
+	sensorInfo, err := os.Stat(i.sensorPath)
+	if err != nil {
+		return err
+	}
+
+	withSensor := i.SensorDelivery == SensorDeliveryAuto
+
+	reader, writer := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(writer)
+		writeErr := func() error {
+			//the parent directories are added explicitly because the target image doesn't have them
+			dirs := []string{path.Dir(path.Dir(SensorBinPath)), SensorArtifactsPath}
+			if withSensor {
+				dirs = []string{path.Dir(path.Dir(SensorBinPath)), path.Dir(SensorBinPath), SensorArtifactsPath}
+			}
+
+			for _, dir := range dirs {
+				hdr := &tar.Header{
+					Name:     strings.TrimPrefix(dir, "/") + "/",
+					Typeflag: tar.TypeDir,
+					Mode:     0777,
+					ModTime:  sensorInfo.ModTime(),
+				}
+
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+			}
+
+			if withSensor {
+				if err := writeSensorTar(tw, i.sensorPath, strings.TrimPrefix(SensorBinPath, "/")); err != nil {
+					return err
+				}
+			}
+
+			return tw.Close()
+		}()
+
+		writer.CloseWithError(writeErr)
+	}()
+	defer reader.Close()
+
+	log.Debugf("RunContainer: copying the sensor to the container => %v", i.ContainerID)
+	return i.APIClient.UploadToContainer(i.ContainerID, dockerapi.UploadToContainerOptions{
+		InputStream: reader,
+		Path:        "/",
+	})
+}
+
+// copyArtifactsFromContainer copies the artifacts from the stopped container to the local artifacts directory
+// (the archive has the artifacts directory, so it's extracted to its parent directory)
+func (i *Inspector) copyArtifactsFromContainer() error {
+	log.Info("copying the artifacts from the container...")
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(i.APIClient.DownloadFromContainer(i.ContainerID,
+			dockerapi.DownloadFromContainerOptions{
+				Path:         SensorArtifactsPath,
+				OutputStream: writer,
+			}))
+	}()
+	defer reader.Close()
+
+	return fsutils.ExtractArtifactsArchive(reader, i.LocalVolumePath)
+}
+
+// unpackArtifacts extracts the compressed artifacts archive the sensor creates when the artifacts are copied
+// (the archive checksum is verified before it's extracted)
+func (i *Inspector) unpackArtifacts() error {
+	artifactsPath := filepath.Join(i.LocalVolumePath, ArtifactsDir)
+	unpacked, err := fsutils.UnpackArtifacts(artifactsPath)
+	if err != nil {
+		return err
+	}
+
+	if unpacked {
+		log.Debugf("unpacked the compressed artifacts => %v", artifactsPath)
+	}
+
+	return nil
+}
+
+// runWithTimeout runs the operation and returns the timeout error if it doesn't finish in time
+// (no timeout if it's not set; the operation keeps running in the background after the timeout)
+func runWithTimeout(timeout time.Duration, timeoutErr error, op func() error) error {
+	if timeout <= 0 {
+		return op()
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- op()
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(timeout):
+		return timeoutErr
+	}
+}
+
+// forwardSSHPorts forwards the published container ports on the ssh Docker host to the local ports
+// (the published ports on the remote host are usually not reachable directly)
+func (i *Inspector) forwardSSHPorts() error {
+	//the IPv4 and IPv6 bindings can have the same host port
+	var remotePorts []string
+	seen := map[string]bool{}
+	for _, bindings := range i.ContainerInfo.NetworkSettings.Ports {
+		for _, binding := range bindings {
+			if !seen[binding.HostPort] {
+				seen[binding.HostPort] = true
+				remotePorts = append(remotePorts, binding.HostPort)
+			}
+		}
+	}
+
+	forward, err := dockerclient.ForwardSSHPorts(os.Getenv("DOCKER_HOST"), remotePorts)
+	if err != nil {
+		return err
+	}
+
+	i.sshForward = forward
+	for port, bindings := range i.ContainerInfo.NetworkSettings.Ports {
+		var localBindings []dockerapi.PortBinding
+		for _, binding := range bindings {
+			localBindings = append(localBindings, dockerapi.PortBinding{
+				HostIP:   localHostIP,
+				HostPort: forward.Ports[binding.HostPort],
+			})
+		}
+
+		i.ContainerInfo.NetworkSettings.Ports[port] = localBindings
+	}
+
+	i.DockerHostIP = localHostIP
+	log.Debugf("RunContainer: forwarded ssh ports => %#v", i.ContainerInfo.NetworkSettings.Ports)
+	return nil
+}
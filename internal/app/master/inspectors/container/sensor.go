@@ -0,0 +1,116 @@
+package container
+
+import (
+	"debug/elf"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/sensorbin"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// SensorBinArchPat is the name pattern of the sensor binaries for the specific image architectures
+// (e.g., docker-slim-sensor-arm64 next to the default docker-slim-sensor binary)
+const SensorBinArchPat = "docker-slim-sensor-%v"
+
+// SensorArchs are the image architectures with the sensor builds in the release packages
+var SensorArchs = []string{"amd64", "arm64"}
+
+// ImageArch normalizes the image (or the Docker host) architecture name to the name Go uses
+// (the 32-bit arm variants are not distinguished and there are no 32-bit arm sensor builds)
+func ImageArch(arch string) string {
+	switch strings.ToLower(arch) {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64", "arm64/v8":
+		return "arm64"
+	case "i386", "i686", "x86":
+		return "386"
+	}
+
+	if strings.HasPrefix(arch, "arm") && !strings.HasPrefix(arch, "arm64") {
+		return "arm"
+	}
+
+	return arch
+}
+
+// BinArch returns the architecture of the Linux binary (with the names Go uses)
+func BinArch(binPath string) (string, error) {
+	file, err := elf.Open(binPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	switch file.Machine {
+	case elf.EM_X86_64:
+		return "amd64", nil
+	case elf.EM_AARCH64:
+		return "arm64", nil
+	case elf.EM_386:
+		return "386", nil
+	case elf.EM_ARM:
+		return "arm", nil
+	}
+
+	return file.Machine.String(), nil
+}
+
+// FindSensor returns the sensor binary for the target image architecture
+// (the architecture specific sensor is used if it's installed, otherwise the default sensor
+// is used if it's built for the same architecture). The sensor embedded in docker-slim
+// is extracted to the state path if there's no matching sensor next to docker-slim.
+func FindSensor(imageArch, statePath string) (string, error) {
+	sensorPath := filepath.Join(fsutils.ExeDir(), SensorBinLocal)
+	if imageArch == "" {
+		if !fsutils.Exists(sensorPath) {
+			arch := ImageArch(runtime.GOARCH)
+			return findEmbeddedSensor(arch, statePath,
+				fmt.Errorf("no sensor for the %v image architecture (%v doesn't exist)", arch, sensorPath))
+		}
+
+		return sensorPath, nil
+	}
+
+	arch := ImageArch(imageArch)
+	archSensorPath := filepath.Join(fsutils.ExeDir(), fmt.Sprintf(SensorBinArchPat, arch))
+	if fsutils.Exists(archSensorPath) {
+		log.Debugf("FindSensor(%v): %v", imageArch, archSensorPath)
+		return archSensorPath, nil
+	}
+
+	sensorArch, err := BinArch(sensorPath)
+	if err != nil {
+		return findEmbeddedSensor(arch, statePath,
+			fmt.Errorf("no sensor for the %v image architecture (%v: %v)", arch, sensorPath, err))
+	}
+
+	if sensorArch != arch {
+		return findEmbeddedSensor(arch, statePath,
+			fmt.Errorf("no sensor for the %v image architecture (%v is built for %v, install %v from the docker-slim release package)",
+				arch, sensorPath, sensorArch, fmt.Sprintf(SensorBinArchPat, arch)))
+	}
+
+	log.Debugf("FindSensor(%v): %v", imageArch, sensorPath)
+	return sensorPath, nil
+}
+
+// findEmbeddedSensor extracts the embedded sensor
+// (it returns the installed sensor error if docker-slim doesn't have the embedded sensor)
+func findEmbeddedSensor(arch, statePath string, installedErr error) (string, error) {
+	embeddedPath, err := sensorbin.Extract(arch, statePath)
+	switch {
+	case err == sensorbin.ErrNotEmbedded:
+		return "", installedErr
+	case err != nil:
+		return "", err
+	}
+
+	log.Debugf("FindSensor(%v): embedded sensor => %v", arch, embeddedPath)
+	return embeddedPath, nil
+}
@@ -0,0 +1,259 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Sensor delivery modes (how the sensor binary gets into the target container)
+const (
+	// SensorDeliveryAuto bind mounts the sensor or copies it with the Docker API (see the artifacts transfer modes)
+	SensorDeliveryAuto = "auto"
+	// SensorDeliveryVolume copies the sensor into a named volume (the volume is reused by the next runs)
+	SensorDeliveryVolume = "volume"
+	// SensorDeliveryImage layers the sensor on top of the target image in a temporary helper image
+	SensorDeliveryImage = "image"
+)
+
+const (
+	SensorVolumeNamePat  = "dockerslim-sensor-%s"
+	SensorVolumeMountPat = "%s:/opt/dockerslim/bin:ro"
+	SensorImageNamePat   = "dockerslim-sensor:%s-%s"
+	sensorDigestLen      = 12
+	sensorImageFileName  = "sensor"
+)
+
+// sensorDigest returns the short sensor binary digest
+// (used to name the sensor volumes and images, so a new sensor version gets a new volume)
+func sensorDigest(sensorPath string) (string, error) {
+	sensorFile, err := os.Open(sensorPath)
+	if err != nil {
+		return "", err
+	}
+	defer sensorFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, sensorFile); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:sensorDigestLen], nil
+}
+
+// writeSensorTar writes the sensor binary to the tar stream (with the archive file name)
+func writeSensorTar(tw *tar.Writer, sensorPath, name string) error {
+	sensorFile, err := os.Open(sensorPath)
+	if err != nil {
+		return err
+	}
+	defer sensorFile.Close()
+
+	sensorInfo, err := sensorFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0755,
+		Size:     sensorInfo.Size(),
+		ModTime:  sensorInfo.ModTime(),
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, sensorFile)
+	return err
+}
+
+// writeDataTar writes the file data to the tar stream
+func writeDataTar(tw *tar.Writer, name string, data []byte, mode int64) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     mode,
+		Size:     int64(len(data)),
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(data)
+	return err
+}
+
+// prepareSensorVolume copies the sensor into the named sensor volume (if the volume doesn't exist yet)
+// and returns the volume bind for the target container.
+// The sensor is copied with a helper container created (but not started) from the target image,
+// so the Docker host doesn't need the sensor binary and no extra images are pulled.
+func (i *Inspector) prepareSensorVolume() (string, error) {
+	digest, err := sensorDigest(i.sensorPath)
+	if err != nil {
+		return "", err
+	}
+
+	volumeName := fmt.Sprintf(SensorVolumeNamePat, digest)
+	volumeBind := fmt.Sprintf(SensorVolumeMountPat, volumeName)
+
+	_, err = i.APIClient.InspectVolume(volumeName)
+	if err == nil {
+		log.Debugf("RunContainer: reusing the sensor volume => %v", volumeName)
+		return volumeBind, nil
+	}
+
+	if err != dockerapi.ErrNoSuchVolume {
+		return "", err
+	}
+
+	log.Debugf("RunContainer: creating the sensor volume => %v", volumeName)
+	if _, err := i.APIClient.CreateVolume(dockerapi.CreateVolumeOptions{Name: volumeName}); err != nil {
+		return "", err
+	}
+
+	if err := i.copySensorToVolume(volumeName); err != nil {
+		//don't leave the volume without the sensor (the next runs would reuse it)
+		if rmErr := i.APIClient.RemoveVolume(volumeName); rmErr != nil {
+			log.Debugf("RunContainer: error removing the sensor volume %v - %v", volumeName, rmErr)
+		}
+
+		return "", err
+	}
+
+	return volumeBind, nil
+}
+
+func (i *Inspector) copySensorToVolume(volumeName string) error {
+	helperInfo, err := i.APIClient.CreateContainer(dockerapi.CreateContainerOptions{
+		Config: &dockerapi.Config{
+			Image:      i.ImageInspector.ImageRef,
+			Entrypoint: []string{SensorBinPath},
+			Labels:     map[string]string{"type": LabelName},
+		},
+		HostConfig: &dockerapi.HostConfig{
+			Binds: []string{fmt.Sprintf("%s:%s", volumeName, path.Dir(SensorBinPath))},
+		},
+	})
+	if err != nil {
+		audit.Container(audit.RuntimeDocker, audit.ActionCreate, "", i.ImageInspector.ImageRef, err)
+		return err
+	}
+
+	audit.Container(audit.RuntimeDocker, audit.ActionCreate, helperInfo.ID, i.ImageInspector.ImageRef, nil)
+
+	defer func() {
+		removeOption := dockerapi.RemoveContainerOptions{
+			ID:    helperInfo.ID,
+			Force: true,
+		}
+
+		err := i.APIClient.RemoveContainer(removeOption)
+		audit.Container(audit.RuntimeDocker, audit.ActionRemove, helperInfo.ID, i.ImageInspector.ImageRef, err)
+		if err != nil {
+			log.Debugf("RunContainer: error removing the sensor volume helper container %v - %v", helperInfo.ID, err)
+		}
+	}()
+
+	reader, writer := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(writer)
+		writeErr := writeSensorTar(tw, i.sensorPath, path.Base(SensorBinPath))
+		if writeErr == nil {
+			writeErr = tw.Close()
+		}
+
+		writer.CloseWithError(writeErr)
+	}()
+	defer reader.Close()
+
+	return i.APIClient.UploadToContainer(helperInfo.ID, dockerapi.UploadToContainerOptions{
+		InputStream: reader,
+		Path:        path.Dir(SensorBinPath),
+	})
+}
+
+// prepareSensorImage builds the helper image with the sensor layered on top of the target image
+// and returns its name (the helper image is removed when the target container is removed)
+func (i *Inspector) prepareSensorImage() (string, error) {
+	digest, err := sensorDigest(i.sensorPath)
+	if err != nil {
+		return "", err
+	}
+
+	imageID := i.ImageInspector.ImageInfo.ID
+	if parts := strings.SplitN(imageID, ":", 2); len(parts) == 2 {
+		imageID = parts[1]
+	}
+
+	if len(imageID) > sensorDigestLen {
+		imageID = imageID[:sensorDigestLen]
+	}
+
+	imageName := fmt.Sprintf(SensorImageNamePat, imageID, digest)
+
+	var buildContext bytes.Buffer
+	tw := tar.NewWriter(&buildContext)
+	dockerfile := fmt.Sprintf("FROM %s\nCOPY %s %s\n", i.ImageInspector.ImageInfo.ID, sensorImageFileName, SensorBinPath)
+	if err := writeDataTar(tw, "Dockerfile", []byte(dockerfile), 0644); err != nil {
+		return "", err
+	}
+
+	if err := writeSensorTar(tw, i.sensorPath, sensorImageFileName); err != nil {
+		return "", err
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	log.Debugf("RunContainer: building the sensor image => %v", imageName)
+	if err := i.buildSensorImage(imageName, &buildContext); err != nil {
+		return "", err
+	}
+
+	return imageName, nil
+}
+
+// buildSensorImage builds the image with the sensor from the build context (with the Dockerfile)
+func (i *Inspector) buildSensorImage(imageName string, buildContext io.Reader) error {
+	var buildLog bytes.Buffer
+	err := i.APIClient.BuildImage(dockerapi.BuildImageOptions{
+		Name:           imageName,
+		Dockerfile:     "Dockerfile",
+		RmTmpContainer: true,
+		InputStream:    buildContext,
+		OutputStream:   &buildLog,
+	})
+	audit.Image(audit.RuntimeDocker, audit.ActionBuild, imageName, err)
+	if err != nil {
+		log.Debugf("sensor image build log:\n%s", buildLog.String())
+		return err
+	}
+
+	return nil
+}
+
+// removeSensorImage removes the helper sensor image
+// (it's not removed if another docker-slim container still uses it)
+func (i *Inspector) removeSensorImage() {
+	err := i.APIClient.RemoveImage(i.sensorImage)
+	audit.Image(audit.RuntimeDocker, audit.ActionRemove, i.sensorImage, err)
+	if err != nil {
+		log.Debugf("error removing the sensor image %v - %v", i.sensorImage, err)
+	}
+}
@@ -0,0 +1,123 @@
+package container
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// runTask starts the target container with the container runtime client (e.g., containerd).
+// The container has its own network namespace, so the sensor ports and the exposed ports
+// are forwarded from the local ports with the exec tunnel.
+func (i *Inspector) runTask(sensorArgs []string, labels map[string]string) error {
+	if i.IPCTransport == IPCTransportTCP {
+		return errors.New("the sensor ports are not published with the " + i.ContainerClient.Name() + " runtime (use the 'exec' IPC transport)")
+	}
+
+	if len(i.Links) > 0 || len(i.EtcHostsMaps) > 0 || len(i.DnsServers) > 0 ||
+		len(i.DnsSearchDomains) > 0 || i.Overrides.Network != "" || i.Overrides.Hostname != "" {
+		log.Warnf("RunContainer: container links, network, hostname and DNS overrides are ignored with the %v runtime", i.ContainerClient.Name())
+	}
+
+	var mounts []runtime.Mount
+	for _, volumeMount := range i.VolumeMounts {
+		mount := runtime.Mount{
+			Source:      volumeMount.Source,
+			Destination: volumeMount.Destination,
+		}
+
+		for _, option := range strings.Split(volumeMount.Options, ",") {
+			if option == "ro" {
+				mount.ReadOnly = true
+			}
+		}
+
+		mounts = append(mounts, mount)
+	}
+
+	mounts = append(mounts,
+		runtime.Mount{
+			Source:      filepath.Join(i.LocalVolumePath, ArtifactsDir),
+			Destination: SensorArtifactsPath,
+		},
+		runtime.Mount{
+			Source:      i.sensorPath,
+			Destination: SensorBinPath,
+			ReadOnly:    true,
+		})
+
+	err := i.ContainerClient.RunContainer(&runtime.ContainerOptions{
+		ID:         i.ContainerName,
+		ImageRef:   i.ImageInspector.ImageRef,
+		Args:       append([]string{SensorBinPath}, sensorArgs...),
+		Env:        i.Overrides.Env,
+		Labels:     labels,
+		Mounts:     mounts,
+		Privileged: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	i.ContainerID = i.ContainerName
+	log.Infof("RunContainer: created %v container => %v", i.ContainerClient.Name(), i.ContainerName)
+
+	ports := []string{i.CmdPort.Port(), i.EvtPort.Port()}
+	for port := range i.ExposedPorts() {
+		//the tunnel forwards only the TCP connections
+		if port.Proto() != "tcp" {
+			log.Debugf("RunContainer: the exposed port is not forwarded - %v", port)
+			continue
+		}
+
+		ports = append(ports, port.Port())
+	}
+
+	tunnel, err := newExecTunnel(i.ContainerClient, i.ContainerID, ports)
+	if err != nil {
+		return err
+	}
+
+	i.execTunnel = tunnel
+
+	portBindings := map[dockerapi.Port][]dockerapi.PortBinding{}
+	for port, localPort := range tunnel.Ports {
+		portBindings[dockerapi.Port(port+"/tcp")] = []dockerapi.PortBinding{
+			{
+				HostIP:   localHostIP,
+				HostPort: localPort,
+			},
+		}
+	}
+
+	i.DockerHostIP = localHostIP
+	i.ContainerInfo = &dockerapi.Container{
+		ID:   i.ContainerName,
+		Name: i.ContainerName,
+		NetworkSettings: &dockerapi.NetworkSettings{
+			Ports: portBindings,
+		},
+	}
+
+	log.Debugf("RunContainer: %v container ports => %#v", i.ContainerClient.Name(), portBindings)
+	return nil
+}
+
+// shutdownTask stops and deletes the container started with the container runtime client
+// (the artifacts are already in the local volume because they are bind mounted)
+func (i *Inspector) shutdownTask() error {
+	if i.ShowContainerLogs {
+		log.Infof("the container output is not available with the %v runtime", i.ContainerClient.Name())
+	}
+
+	if i.execTunnel != nil {
+		i.execTunnel.Close()
+	}
+
+	return i.ContainerClient.RemoveContainer(i.ContainerName)
+}
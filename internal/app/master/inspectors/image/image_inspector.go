@@ -5,7 +5,12 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/cache"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
 	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerfile"
+	"github.com/docker-slim/docker-slim/internal/app/master/registry"
+	"github.com/docker-slim/docker-slim/internal/app/master/runtime"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
 
 	log "github.com/Sirupsen/logrus"
@@ -14,11 +19,22 @@ import (
 
 const (
 	slimImageRepo          = "slim"
+	instrumentedImageRepo  = "instrumented"
 	appArmorProfileName    = "apparmor-profile"
 	seccompProfileName     = "seccomp-profile"
+	ociSpecName            = "oci-config.json"
+	k8sSecurityContextName = "k8s-security-context.yaml"
+	dockerRunScriptName    = "docker-run.sh"
+	composeSnippetName     = "docker-compose.yml"
+	findingsReportName     = "findings.sarif"
 	fatDockerfileName      = "Dockerfile.fat"
 	appArmorProfileNamePat = "%s-apparmor-profile"
 	seccompProfileNamePat  = "%s-seccomp.json"
+	ociSpecNamePat         = "%s-oci-config.json"
+	k8sSecurityContextPat  = "%s-k8s-security-context.yaml"
+	dockerRunScriptNamePat = "%s-docker-run.sh"
+	composeSnippetNamePat  = "%s-docker-compose.yml"
+	findingsReportNamePat  = "%s-findings.sarif"
 )
 
 // Inspector is a container image inspector
@@ -26,23 +42,38 @@ type Inspector struct {
 	ImageRef                   string
 	ArtifactLocation           string
 	SlimImageRepo              string
+	InstrumentedImageRepo      string
 	AppArmorProfileName        string
 	SeccompProfileName         string
+	OCISpecName                string
+	K8sSecurityContextName     string
+	DockerRunScriptName        string
+	ComposeSnippetName         string
+	FindingsReportName         string
 	ImageInfo                  *docker.Image
 	ImageRecordInfo            docker.APIImages
 	APIClient                  *docker.Client
+	ImageClient                runtime.ImageClient
+	AnalysisCache              *cache.Cache
 	fatImageDockerInstructions []string
 }
 
 // NewInspector creates a new container image inspector
 func NewInspector(client *docker.Client, imageRef string /*, artifactLocation string*/) (*Inspector, error) {
 	inspector := &Inspector{
-		ImageRef:            imageRef,
-		SlimImageRepo:       slimImageRepo,
-		AppArmorProfileName: appArmorProfileName,
-		SeccompProfileName:  seccompProfileName,
+		ImageRef:               imageRef,
+		SlimImageRepo:          slimImageRepo,
+		InstrumentedImageRepo:  instrumentedImageRepo,
+		AppArmorProfileName:    appArmorProfileName,
+		SeccompProfileName:     seccompProfileName,
+		OCISpecName:            ociSpecName,
+		K8sSecurityContextName: k8sSecurityContextName,
+		DockerRunScriptName:    dockerRunScriptName,
+		ComposeSnippetName:     composeSnippetName,
+		FindingsReportName:     findingsReportName,
 		//ArtifactLocation:    artifactLocation,
-		APIClient: client,
+		APIClient:   client,
+		ImageClient: runtime.NewDockerImageClient(client),
 	}
 
 	return inspector, nil
@@ -50,7 +81,7 @@ func NewInspector(client *docker.Client, imageRef string /*, artifactLocation st
 
 // NoImage returns true if the target image doesn't exist
 func (i *Inspector) NoImage() bool {
-	_, err := i.APIClient.InspectImage(i.ImageRef)
+	_, err := i.ImageClient.InspectImage(i.ImageRef)
 	if err != nil {
 		if err == docker.ErrNoSuchImage {
 			return true
@@ -63,7 +94,8 @@ func (i *Inspector) NoImage() bool {
 // Inspect starts the target image inspection
 func (i *Inspector) Inspect() error {
 	var err error
-	i.ImageInfo, err = i.APIClient.InspectImage(i.ImageRef)
+	i.ImageInfo, err = i.ImageClient.InspectImage(i.ImageRef)
+	audit.Image(i.ImageClient.Name(), audit.ActionInspect, i.ImageRef, err)
 	if err != nil {
 		if err == docker.ErrNoSuchImage {
 			log.Info("could not find target image")
@@ -71,7 +103,7 @@ func (i *Inspector) Inspect() error {
 		return err
 	}
 
-	imageList, err := i.APIClient.ListImages(docker.ListImagesOptions{All: true})
+	imageList, err := i.ImageClient.ListImages()
 	if err != nil {
 		return err
 	}
@@ -93,17 +125,34 @@ func (i *Inspector) Inspect() error {
 
 func (i *Inspector) processImageName() {
 	if len(i.ImageRecordInfo.RepoTags) > 0 {
-		if rtInfo := strings.Split(i.ImageRecordInfo.RepoTags[0], ":"); len(rtInfo) > 1 {
+		//Podman and containerd use the fully qualified image names
+		if rtInfo := strings.Split(registry.FamiliarRef(i.ImageRecordInfo.RepoTags[0]), ":"); len(rtInfo) > 1 {
 			i.SlimImageRepo = fmt.Sprintf("%s.slim", rtInfo[0])
+			i.InstrumentedImageRepo = fmt.Sprintf("%s.instrumented", rtInfo[0])
 			if nameParts := strings.Split(rtInfo[0], "/"); len(nameParts) > 1 {
 				i.AppArmorProfileName = strings.Join(nameParts, "-")
 				i.SeccompProfileName = strings.Join(nameParts, "-")
+				i.OCISpecName = strings.Join(nameParts, "-")
+				i.K8sSecurityContextName = strings.Join(nameParts, "-")
+				i.DockerRunScriptName = strings.Join(nameParts, "-")
+				i.ComposeSnippetName = strings.Join(nameParts, "-")
+				i.FindingsReportName = strings.Join(nameParts, "-")
 			} else {
 				i.AppArmorProfileName = rtInfo[0]
 				i.SeccompProfileName = rtInfo[0]
+				i.OCISpecName = rtInfo[0]
+				i.K8sSecurityContextName = rtInfo[0]
+				i.DockerRunScriptName = rtInfo[0]
+				i.ComposeSnippetName = rtInfo[0]
+				i.FindingsReportName = rtInfo[0]
 			}
 			i.AppArmorProfileName = fmt.Sprintf(appArmorProfileNamePat, i.AppArmorProfileName)
 			i.SeccompProfileName = fmt.Sprintf(seccompProfileNamePat, i.SeccompProfileName)
+			i.OCISpecName = fmt.Sprintf(ociSpecNamePat, i.OCISpecName)
+			i.K8sSecurityContextName = fmt.Sprintf(k8sSecurityContextPat, i.K8sSecurityContextName)
+			i.DockerRunScriptName = fmt.Sprintf(dockerRunScriptNamePat, i.DockerRunScriptName)
+			i.ComposeSnippetName = fmt.Sprintf(composeSnippetNamePat, i.ComposeSnippetName)
+			i.FindingsReportName = fmt.Sprintf(findingsReportNamePat, i.FindingsReportName)
 		}
 	}
 }
@@ -113,10 +162,15 @@ func (i *Inspector) ProcessCollectedData() error {
 	i.processImageName()
 
 	var err error
-	i.fatImageDockerInstructions, err = dockerfile.ReverseDockerfileFromHistory(i.APIClient, i.ImageRef)
-	if err != nil {
-		return err
+	if !i.AnalysisCache.Load(cache.EntryDockerfile, &i.fatImageDockerInstructions) {
+		i.fatImageDockerInstructions, err = dockerfile.ReverseDockerfileFromHistory(i.ImageClient, i.ImageRef)
+		if err != nil {
+			return err
+		}
+
+		i.AnalysisCache.Save(cache.EntryDockerfile, i.fatImageDockerInstructions)
 	}
+
 	fatImageDockerfileLocation := filepath.Join(i.ArtifactLocation, fatDockerfileName)
 	err = dockerfile.SaveDockerfileData(fatImageDockerfileLocation, i.fatImageDockerInstructions)
 	errutils.FailOn(err)
@@ -125,10 +179,8 @@ func (i *Inspector) ProcessCollectedData() error {
 }
 
 // ShowFatImageDockerInstructions prints the original target image Dockerfile instructions
-func (i *Inspector) ShowFatImageDockerInstructions() {
+func (i *Inspector) ShowFatImageDockerInstructions(printer *console.Printer) {
 	if i.fatImageDockerInstructions != nil {
-		fmt.Println("docker-slim: Fat image - Dockerfile instructures: start ====")
-		fmt.Println(strings.Join(i.fatImageDockerInstructions, "\n"))
-		fmt.Println("docker-slim: Fat image - Dockerfile instructures: end ======")
+		printer.Block("fat image Dockerfile instructions", strings.Join(i.fatImageDockerInstructions, "\n"))
 	}
 }
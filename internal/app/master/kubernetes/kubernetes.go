@@ -0,0 +1,328 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// DefaultHelperImage is the default image for the helper containers
+	// (the helper containers need 'sh', 'tar' and 'sleep')
+	DefaultHelperImage = "busybox:1.31"
+	// LocalHost is the address kubectl uses to forward the pod ports
+	LocalHost = "127.0.0.1"
+
+	kubectlBin         = "kubectl"
+	waitInterval       = time.Second
+	portForwardTimeout = 30 * time.Second
+)
+
+var (
+	// ErrNoKubectl is returned when kubectl is not installed
+	ErrNoKubectl = errors.New("kubectl not found")
+	// ErrTimeout is returned when the pod container doesn't start in time
+	ErrTimeout = errors.New("timeout waiting for the pod container")
+)
+
+// the container waiting reasons that need user attention (the container is not going to start on its own)
+var failedWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+var portForwardPat = regexp.MustCompile(`^Forwarding from 127\.0\.0\.1:(\d+) -> (\d+)`)
+
+// Client runs kubectl commands
+type Client struct {
+	Config      *config.Kubernetes
+	kubectlPath string
+}
+
+// New creates a new kubectl client
+func New(cfg *config.Kubernetes) (*Client, error) {
+	kubectlPath, err := exec.LookPath(kubectlBin)
+	if err != nil {
+		return nil, ErrNoKubectl
+	}
+
+	return &Client{
+		Config:      cfg,
+		kubectlPath: kubectlPath,
+	}, nil
+}
+
+func (c *Client) command(args ...string) *exec.Cmd {
+	var kubectlArgs []string
+	if c.Config.Kubeconfig != "" {
+		kubectlArgs = append(kubectlArgs, "--kubeconfig", c.Config.Kubeconfig)
+	}
+
+	if c.Config.Context != "" {
+		kubectlArgs = append(kubectlArgs, "--context", c.Config.Context)
+	}
+
+	if c.Config.Namespace != "" {
+		kubectlArgs = append(kubectlArgs, "--namespace", c.Config.Namespace)
+	}
+
+	kubectlArgs = append(kubectlArgs, args...)
+	log.Debugf("kubernetes: kubectl %v", strings.Join(kubectlArgs, " "))
+	return exec.Command(c.kubectlPath, kubectlArgs...)
+}
+
+func (c *Client) run(stdin io.Reader, stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := c.command(args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("kubectl %v: %v", args[0], message)
+		}
+
+		return fmt.Errorf("kubectl %v: %v", args[0], err)
+	}
+
+	return nil
+}
+
+// CreatePod creates a new pod
+func (c *Client) CreatePod(pod *Pod) error {
+	data, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	err = c.run(bytes.NewReader(data), nil, "create", "-f", "-")
+	var image string
+	if len(pod.Spec.Containers) > 0 {
+		image = pod.Spec.Containers[0].Image
+	}
+
+	audit.Container(audit.RuntimeKubernetes, audit.ActionCreate, pod.Metadata.Name, image, err)
+	return err
+}
+
+// GetPod returns the pod information
+func (c *Client) GetPod(name string) (*Pod, error) {
+	var out bytes.Buffer
+	if err := c.run(nil, &out, "get", "pod", name, "-o", "json"); err != nil {
+		return nil, err
+	}
+
+	var pod Pod
+	if err := json.Unmarshal(out.Bytes(), &pod); err != nil {
+		return nil, err
+	}
+
+	return &pod, nil
+}
+
+// ListNodePods returns the pods selected by the label selector on the node
+// (the pods in all namespaces are listed if the namespace is not configured)
+func (c *Client) ListNodePods(selector, nodeName string) ([]Pod, error) {
+	args := []string{"get", "pods", "-o", "json"}
+	if selector != "" {
+		args = append(args, "--selector", selector)
+	}
+
+	if nodeName != "" {
+		args = append(args, "--field-selector", "spec.nodeName="+nodeName)
+	}
+
+	if c.Config.Namespace == "" {
+		args = append(args, "--all-namespaces")
+	}
+
+	var out bytes.Buffer
+	if err := c.run(nil, &out, args...); err != nil {
+		return nil, err
+	}
+
+	var pods PodList
+	if err := json.Unmarshal(out.Bytes(), &pods); err != nil {
+		return nil, err
+	}
+
+	return pods.Items, nil
+}
+
+// DeletePod deletes the pod (without waiting for the pod to terminate)
+func (c *Client) DeletePod(name string) error {
+	err := c.run(nil, nil, "delete", "pod", name, "--grace-period=1", "--wait=false")
+	audit.Container(audit.RuntimeKubernetes, audit.ActionRemove, name, "", err)
+	return err
+}
+
+// WaitForContainer waits until the pod container (or init container) is running
+func (c *Client) WaitForContainer(podName, containerName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pod, err := c.GetPod(podName)
+		if err != nil {
+			return err
+		}
+
+		if status := pod.ContainerStatus(containerName); status != nil {
+			switch {
+			case status.State.Running != nil:
+				return nil
+			case status.State.Terminated != nil:
+				return fmt.Errorf("pod container %v terminated (%v, exit code %v)",
+					containerName, status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+			case status.State.Waiting != nil && failedWaitingReasons[status.State.Waiting.Reason]:
+				return fmt.Errorf("pod container %v is not starting (%v: %v)",
+					containerName, status.State.Waiting.Reason, status.State.Waiting.Message)
+			}
+		}
+
+		if pod.Status.Phase == PodFailed {
+			return fmt.Errorf("pod %v failed (%v: %v)", podName, pod.Status.Reason, pod.Status.Message)
+		}
+
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+
+		time.Sleep(waitInterval)
+	}
+}
+
+// Exec runs a command in the pod container
+func (c *Client) Exec(podName, containerName string, stdin io.Reader, stdout io.Writer, cmd ...string) error {
+	args := []string{"exec", podName, "-c", containerName}
+	if stdin != nil {
+		args = append(args, "-i")
+	}
+
+	args = append(args, "--")
+	args = append(args, cmd...)
+	return c.run(stdin, stdout, args...)
+}
+
+// Logs writes the pod container logs
+func (c *Client) Logs(podName, containerName string, stdout io.Writer) error {
+	return c.run(nil, stdout, "logs", podName, "-c", containerName)
+}
+
+// CopyFileToPod copies a local file to the pod container (using 'sh' in the container)
+// (the file is moved to its final location only after it's copied and its mode is set)
+func (c *Client) CopyFileToPod(podName, containerName, src, dst string, mode os.FileMode) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tmpDst := dst + ".tmp"
+	script := fmt.Sprintf("cat > %[1]s && chmod %[2]o %[1]s && mv %[1]s %[3]s", tmpDst, mode.Perm(), dst)
+	return c.Exec(podName, containerName, file, nil, "sh", "-c", script)
+}
+
+// CopyDirFromPod copies a directory from the pod container to a local directory (using 'tar' in the container)
+func (c *Client) CopyDirFromPod(podName, containerName, src, dst string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(c.Exec(podName, containerName, nil, writer, "tar", "cf", "-", "-C", src, "."))
+	}()
+	defer reader.Close()
+
+	return fsutils.ExtractArtifactsArchive(reader, dst)
+}
+
+// PortForward forwards the local ports to the pod ports
+type PortForward struct {
+	// Ports maps the pod ports to the local ports
+	Ports map[string]string
+	cmd   *exec.Cmd
+}
+
+// PortForward starts forwarding random local ports to the pod ports
+func (c *Client) PortForward(podName string, ports []string) (*PortForward, error) {
+	args := []string{"port-forward", "--address", LocalHost, "pod/" + podName}
+	for _, port := range ports {
+		args = append(args, ":"+port)
+	}
+
+	var stderr bytes.Buffer
+	cmd := c.command(args...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	forward := &PortForward{cmd: cmd}
+	readyChan := make(chan map[string]string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		forwardedPorts := map[string]string{}
+		isReady := false
+		for scanner.Scan() {
+			log.Debugf("kubernetes.PortForward: %v", scanner.Text())
+			if isReady {
+				continue
+			}
+
+			if match := portForwardPat.FindStringSubmatch(scanner.Text()); match != nil {
+				forwardedPorts[match[2]] = match[1]
+				if len(forwardedPorts) == len(ports) {
+					isReady = true
+					readyChan <- forwardedPorts
+				}
+			}
+		}
+
+		if !isReady {
+			readyChan <- nil
+		}
+	}()
+
+	select {
+	case forward.Ports = <-readyChan:
+	case <-time.After(portForwardTimeout):
+	}
+
+	if forward.Ports == nil {
+		forward.Close()
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("kubectl port-forward: %v", message)
+		}
+
+		return nil, errors.New("kubectl port-forward: ports are not forwarded")
+	}
+
+	return forward, nil
+}
+
+// Close stops forwarding the ports
+func (f *PortForward) Close() {
+	if f.cmd.Process != nil {
+		f.cmd.Process.Kill()
+		f.cmd.Wait()
+	}
+}
@@ -0,0 +1,164 @@
+package kubernetes
+
+// PodFailed is the failed pod phase
+const PodFailed = "Failed"
+
+// Pod is a Kubernetes pod (only the fields docker-slim uses)
+type Pod struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       PodSpec    `json:"spec"`
+	Status     PodStatus  `json:"status,omitempty"`
+}
+
+// NewPod creates a new pod
+func NewPod(name string, labels map[string]string) *Pod {
+	return &Pod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: PodSpec{
+			RestartPolicy: "Never",
+		},
+	}
+}
+
+// ContainerStatus returns the status of the pod container or init container
+func (p *Pod) ContainerStatus(name string) *ContainerStatus {
+	for _, statusList := range [][]ContainerStatus{p.Status.InitContainerStatuses, p.Status.ContainerStatuses} {
+		for idx := range statusList {
+			if statusList[idx].Name == name {
+				return &statusList[idx]
+			}
+		}
+	}
+
+	return nil
+}
+
+// PodList is a list of pods
+type PodList struct {
+	Items []Pod `json:"items"`
+}
+
+// ObjectMeta is the pod metadata
+type ObjectMeta struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// PodSpec is the pod specification
+type PodSpec struct {
+	InitContainers []Container   `json:"initContainers,omitempty"`
+	Containers     []Container   `json:"containers"`
+	Volumes        []Volume      `json:"volumes,omitempty"`
+	RestartPolicy  string        `json:"restartPolicy,omitempty"`
+	Hostname       string        `json:"hostname,omitempty"`
+	HostAliases    []HostAlias   `json:"hostAliases,omitempty"`
+	DNSPolicy      string        `json:"dnsPolicy,omitempty"`
+	DNSConfig      *PodDNSConfig `json:"dnsConfig,omitempty"`
+	NodeName       string        `json:"nodeName,omitempty"`
+}
+
+// Container is a pod container
+type Container struct {
+	Name            string           `json:"name"`
+	Image           string           `json:"image"`
+	Command         []string         `json:"command,omitempty"`
+	Args            []string         `json:"args,omitempty"`
+	WorkingDir      string           `json:"workingDir,omitempty"`
+	Env             []EnvVar         `json:"env,omitempty"`
+	Ports           []ContainerPort  `json:"ports,omitempty"`
+	VolumeMounts    []VolumeMount    `json:"volumeMounts,omitempty"`
+	SecurityContext *SecurityContext `json:"securityContext,omitempty"`
+}
+
+// EnvVar is a container environment variable
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ContainerPort is a container port
+type ContainerPort struct {
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// VolumeMount is a container volume mount
+type VolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+// SecurityContext is the container security context
+type SecurityContext struct {
+	Privileged   *bool         `json:"privileged,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// Capabilities are the container capabilities
+type Capabilities struct {
+	Add []string `json:"add,omitempty"`
+}
+
+// Volume is a pod volume (only the 'emptyDir' volumes are used)
+type Volume struct {
+	Name     string    `json:"name"`
+	EmptyDir *struct{} `json:"emptyDir,omitempty"`
+}
+
+// HostAlias is an /etc/hosts entry for the pod
+type HostAlias struct {
+	IP        string   `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+}
+
+// PodDNSConfig is the pod DNS configuration
+type PodDNSConfig struct {
+	Nameservers []string `json:"nameservers,omitempty"`
+	Searches    []string `json:"searches,omitempty"`
+}
+
+// PodStatus is the pod status
+type PodStatus struct {
+	Phase                 string            `json:"phase,omitempty"`
+	Reason                string            `json:"reason,omitempty"`
+	Message               string            `json:"message,omitempty"`
+	InitContainerStatuses []ContainerStatus `json:"initContainerStatuses,omitempty"`
+	ContainerStatuses     []ContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+// ContainerStatus is the pod container status
+type ContainerStatus struct {
+	Name        string         `json:"name"`
+	State       ContainerState `json:"state"`
+	Image       string         `json:"image,omitempty"`
+	ImageID     string         `json:"imageID,omitempty"`
+	ContainerID string         `json:"containerID,omitempty"`
+}
+
+// ContainerState is the pod container state (only one of the states is set)
+type ContainerState struct {
+	Waiting    *ContainerStateWaiting    `json:"waiting,omitempty"`
+	Running    *struct{}                 `json:"running,omitempty"`
+	Terminated *ContainerStateTerminated `json:"terminated,omitempty"`
+}
+
+// ContainerStateWaiting is the waiting container state
+type ContainerStateWaiting struct {
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ContainerStateTerminated is the terminated container state
+type ContainerStateTerminated struct {
+	ExitCode int    `json:"exitCode"`
+	Reason   string `json:"reason,omitempty"`
+}
@@ -0,0 +1,155 @@
+package lambda
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+
+	docker "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// AWS Lambda container image constants
+const (
+	// RIEPort is the Runtime Interface Emulator (RIE) API port
+	RIEPort = "8080/tcp"
+	// InvokeResource is the RIE function invocation resource
+	InvokeResource = "/2015-03-31/functions/function/invocations"
+	// EntrypointScript is the entrypoint in the AWS Lambda base images
+	// (it starts the runtime with the RIE when the image runs outside of Lambda)
+	EntrypointScript = "/lambda-entrypoint.sh"
+	// BaseImageRIEPath is the RIE location in the AWS Lambda base images
+	BaseImageRIEPath = "/usr/local/bin/aws-lambda-rie"
+	// RIEMountPath is the RIE location in the container when the RIE is mounted
+	RIEMountPath = "/aws-lambda/aws-lambda-rie"
+
+	defaultRuntimeDir = "/var/runtime"
+	defaultTaskRoot   = "/var/task"
+	bootstrapName     = "bootstrap"
+	envRuntimeDir     = "LAMBDA_RUNTIME_DIR"
+	envTaskRoot       = "LAMBDA_TASK_ROOT"
+	defaultEvent      = "{}"
+	invokeTimeout     = 30
+)
+
+// IsBaseImage returns true if the image is based on an AWS Lambda base image
+// (the base images have the RIE, so they can run outside of Lambda)
+func IsBaseImage(imageInfo *docker.Image) bool {
+	if imageInfo.Config == nil {
+		return false
+	}
+
+	if len(imageInfo.Config.Entrypoint) > 0 && imageInfo.Config.Entrypoint[0] == EntrypointScript {
+		return true
+	}
+
+	return imageEnv(imageInfo, envRuntimeDir) != ""
+}
+
+// ProbeCmds returns the HTTP probe commands that invoke the function with the sample events
+// (the function is invoked with an empty JSON object if there are no sample event files)
+func ProbeCmds(eventFiles []string) ([]config.HTTPProbeCmd, error) {
+	events := []string{defaultEvent}
+	if len(eventFiles) > 0 {
+		events = nil
+		for _, eventFile := range eventFiles {
+			data, err := ioutil.ReadFile(eventFile)
+			if err != nil {
+				return nil, err
+			}
+
+			events = append(events, string(data))
+		}
+	}
+
+	var cmds []config.HTTPProbeCmd
+	for _, event := range events {
+		cmds = append(cmds, config.HTTPProbeCmd{
+			Protocol: "http",
+			Method:   "POST",
+			Resource: InvokeResource,
+			Body:     event,
+			Timeout:  invokeTimeout,
+		})
+	}
+
+	return cmds, nil
+}
+
+// KeepPaths returns the paths the runtime needs in the minified image:
+// the entrypoint script, the RIE, the runtime interface client and the custom runtime bootstrap
+// (the runtime code that handles the events is loaded on demand, so it's not always observed)
+func KeepPaths(imageInfo *docker.Image) []string {
+	runtimeDir := imageEnv(imageInfo, envRuntimeDir)
+	if runtimeDir == "" {
+		runtimeDir = defaultRuntimeDir
+	}
+
+	taskRoot := imageEnv(imageInfo, envTaskRoot)
+	if taskRoot == "" {
+		taskRoot = defaultTaskRoot
+	}
+
+	return []string{
+		EntrypointScript,
+		BaseImageRIEPath,
+		runtimeDir,
+		path.Join(taskRoot, bootstrapName),
+	}
+}
+
+// MountRIE runs the function with the local RIE binary mounted in the container
+// (for the images with the runtime interface client that are not based on an AWS Lambda base image)
+func MountRIE(imageInfo *docker.Image, riePath string, overrides *config.ContainerOverrides) (*config.VolumeMount, error) {
+	fullPath, err := filepath.Abs(riePath)
+	if err != nil {
+		return nil, err
+	}
+
+	//the runtime interface client command (the entrypoint and the cmd) is passed to the RIE
+	var entrypoint, cmd []string
+	if imageInfo.Config != nil {
+		entrypoint, cmd = imageInfo.Config.Entrypoint, imageInfo.Config.Cmd
+	}
+
+	if len(overrides.Entrypoint) > 0 || overrides.ClearEntrypoint {
+		entrypoint = overrides.Entrypoint
+	}
+
+	if len(overrides.Cmd) > 0 || overrides.ClearCmd {
+		cmd = overrides.Cmd
+	}
+
+	clientCmd := append(append([]string{}, entrypoint...), cmd...)
+	if len(clientCmd) == 0 {
+		return nil, fmt.Errorf("no runtime interface client command in the image")
+	}
+
+	overrides.Entrypoint = []string{RIEMountPath}
+	overrides.ClearEntrypoint = false
+	overrides.Cmd = clientCmd
+	overrides.ClearCmd = false
+
+	return &config.VolumeMount{
+		Source:      fullPath,
+		Destination: RIEMountPath,
+		Options:     "ro",
+	}, nil
+}
+
+func imageEnv(imageInfo *docker.Image, name string) string {
+	if imageInfo.Config == nil {
+		return ""
+	}
+
+	for _, kv := range imageInfo.Config.Env {
+		if strings.HasPrefix(kv, name+"=") {
+			return strings.TrimPrefix(kv, name+"=")
+		}
+	}
+
+	return ""
+}
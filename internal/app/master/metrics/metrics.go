@@ -0,0 +1,306 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/console"
+	"github.com/docker-slim/docker-slim/internal/app/master/telemetry"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	metricsPath    = "/metrics"
+	pushJobName    = "docker_slim"
+	pushTimeout    = 10 * time.Second
+	contentType    = "text/plain; version=0.0.4"
+	metricPrefix   = "docker_slim_"
+	runStateMetric = "run_state"
+)
+
+type metricInfo struct {
+	name   string
+	help   string
+	labels map[string]string
+	value  float64
+}
+
+// Run collects the metrics for one docker-slim command run
+// (the metrics are exposed in the Prometheus text format)
+type Run struct {
+	command     string
+	image       string
+	pushGateway string
+	linger      time.Duration
+	printer     *console.Printer
+	listener    net.Listener
+	started     time.Time
+	finished    time.Time
+	phase       string
+	phaseStart  time.Time
+	phases      []string
+	durations   map[string]float64
+	values      []*metricInfo
+	state       string
+	telemetry   *config.Telemetry
+	imageSize   int64
+	minSize     int64
+	lock        sync.Mutex
+}
+
+// NewRun creates a new metrics collector for a command run and starts
+// the /metrics endpoint if it's enabled (the collector does nothing if the metrics are not enabled)
+func NewRun(command, image string, metricsConfig *config.Metrics, printer *console.Printer) *Run {
+	run := &Run{
+		command:   command,
+		image:     image,
+		printer:   printer,
+		started:   time.Now(),
+		durations: map[string]float64{},
+	}
+
+	if metricsConfig == nil {
+		return run
+	}
+
+	run.pushGateway = strings.TrimSuffix(metricsConfig.PushGateway, "/")
+	run.telemetry = metricsConfig.Telemetry
+	run.linger = metricsConfig.Linger
+
+	if metricsConfig.ListenAddr != "" {
+		listener, err := net.Listen("tcp", metricsConfig.ListenAddr)
+		if err != nil {
+			log.Warnf("metrics: error starting the metrics endpoint (%v) - %v", metricsConfig.ListenAddr, err)
+			return run
+		}
+
+		run.listener = listener
+		mux := http.NewServeMux()
+		mux.HandleFunc(metricsPath, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Write(run.Export())
+		})
+
+		go http.Serve(listener, mux)
+		log.Infof("metrics: serving metrics on %v%v", listener.Addr(), metricsPath)
+	}
+
+	return run
+}
+
+// Phase ends the current run phase and starts a new one
+func (r *Run) Phase(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.endPhase()
+	r.phase = name
+	r.phaseStart = time.Now()
+}
+
+func (r *Run) endPhase() {
+	if r.phase == "" {
+		return
+	}
+
+	if _, ok := r.durations[r.phase]; !ok {
+		r.phases = append(r.phases, r.phase)
+	}
+
+	r.durations[r.phase] += time.Since(r.phaseStart).Seconds()
+	r.phase = ""
+}
+
+// Set records a metric value
+func (r *Run) Set(name, help string, value float64, labels map[string]string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, info := range r.values {
+		if info.name == name && sameLabels(info.labels, labels) {
+			info.value = value
+			return
+		}
+	}
+
+	r.values = append(r.values, &metricInfo{
+		name:   name,
+		help:   help,
+		labels: labels,
+		value:  value,
+	})
+}
+
+// SetImageSizes records the original and minified image sizes and the reduction ratio
+func (r *Run) SetImageSizes(originalSize, minifiedSize int64, minifiedBy float64) {
+	r.lock.Lock()
+	r.imageSize = originalSize
+	r.minSize = minifiedSize
+	r.lock.Unlock()
+
+	r.Set("original_image_size_bytes", "Original image size", float64(originalSize), nil)
+	if minifiedSize > 0 {
+		r.Set("minified_image_size_bytes", "Minified image size", float64(minifiedSize), nil)
+		r.Set("minified_by_ratio", "Original to minified image size ratio", minifiedBy, nil)
+	}
+}
+
+// SetProbeResults records the HTTP probe call counts
+func (r *Run) SetProbeResults(okCount, errorCount uint64) {
+	const help = "HTTP probe calls"
+	r.Set("http_probe_calls", help, float64(okCount), map[string]string{"result": "ok"})
+	r.Set("http_probe_calls", help, float64(errorCount), map[string]string{"result": "error"})
+}
+
+// Finish ends the run, pushes the metrics to the Pushgateway (if it's configured)
+// and keeps the metrics endpoint up for the configured linger time
+func (r *Run) Finish(state string) {
+	r.lock.Lock()
+	r.endPhase()
+	r.state = state
+	r.finished = time.Now()
+	r.lock.Unlock()
+
+	if r.telemetry != nil {
+		telemetry.Report(r.telemetry,
+			telemetry.NewRecord(r.command, state, r.started, r.finished.Sub(r.started), r.imageSize, r.minSize))
+	}
+
+	if r.pushGateway != "" {
+		if err := r.push(); err != nil {
+			log.Warnf("metrics: error pushing metrics to %v - %v", r.pushGateway, err)
+		}
+	}
+
+	if r.listener != nil {
+		if r.linger > 0 {
+			r.printer.Info("metrics",
+				"message", fmt.Sprintf("metrics available on %v%v for %v", r.listener.Addr(), metricsPath, r.linger))
+			time.Sleep(r.linger)
+		}
+
+		r.listener.Close()
+	}
+}
+
+func (r *Run) push() error {
+	url := fmt.Sprintf("%s/metrics/job/%s/command/%s", r.pushGateway, pushJobName, r.command)
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(r.Export()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	client := &http.Client{Timeout: pushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status - %v", resp.Status)
+	}
+
+	return nil
+}
+
+// Export returns the metrics in the Prometheus text format
+func (r *Run) Export() []byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var out bytes.Buffer
+	baseLabels := map[string]string{"command": r.command, "image": r.image}
+
+	writeHeader(&out, "run_duration_seconds", "Command run duration")
+	runDuration := time.Since(r.started)
+	if !r.finished.IsZero() {
+		runDuration = r.finished.Sub(r.started)
+	}
+	writeSample(&out, "run_duration_seconds", baseLabels, nil, runDuration.Seconds())
+
+	phases := append([]string{}, r.phases...)
+	if _, ok := r.durations[r.phase]; r.phase != "" && !ok {
+		phases = append(phases, r.phase)
+	}
+
+	if len(phases) > 0 {
+		writeHeader(&out, "phase_duration_seconds", "Command run phase duration")
+		for _, phase := range phases {
+			duration := r.durations[phase]
+			if phase == r.phase {
+				//the current phase
+				duration += time.Since(r.phaseStart).Seconds()
+			}
+
+			writeSample(&out, "phase_duration_seconds", baseLabels, map[string]string{"phase": phase}, duration)
+		}
+	}
+
+	if r.state != "" {
+		writeHeader(&out, runStateMetric, "Command run final state")
+		writeSample(&out, runStateMetric, baseLabels, map[string]string{"state": r.state}, 1)
+	}
+
+	written := map[string]bool{}
+	for _, info := range r.values {
+		if !written[info.name] {
+			writeHeader(&out, info.name, info.help)
+			written[info.name] = true
+		}
+
+		writeSample(&out, info.name, baseLabels, info.labels, info.value)
+	}
+
+	return out.Bytes()
+}
+
+func writeHeader(out *bytes.Buffer, name, help string) {
+	fmt.Fprintf(out, "# HELP %s%s %s\n", metricPrefix, name, help)
+	fmt.Fprintf(out, "# TYPE %s%s gauge\n", metricPrefix, name)
+}
+
+func writeSample(out *bytes.Buffer, name string, baseLabels, labels map[string]string, value float64) {
+	var pairs []string
+	for _, labelSet := range []map[string]string{baseLabels, labels} {
+		for _, key := range sortedKeys(labelSet) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", key, labelSet[key]))
+		}
+	}
+
+	fmt.Fprintf(out, "%s%s{%s} %v\n", metricPrefix, name, strings.Join(pairs, ","), value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/docker/go-connections/nat"
 
 	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
 )
 
 //based on expose opt parsing in Docker
@@ -128,6 +129,97 @@ func parseVolumeMounts(values []string) (map[string]config.VolumeMount, error) {
 	return volumeMounts, nil
 }
 
+func parseContainerLabels(values []string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	for _, raw := range values {
+		parts := strings.SplitN(raw, "=", 2)
+		if len(parts[0]) < 1 {
+			return nil, fmt.Errorf("Invalid container label format: %s", raw)
+		}
+
+		if len(parts) == 2 {
+			labels[parts[0]] = parts[1]
+		} else {
+			labels[parts[0]] = ""
+		}
+	}
+
+	return labels, nil
+}
+
+// parseDependencies parses the dependency container specs
+// ('image=postgres:13,alias=db,env=POSTGRES_PASSWORD=secret,ready=tcp:5432'; the image key is optional for the first field)
+func parseDependencies(values []string) ([]config.Dependency, error) {
+	var deps []config.Dependency
+	aliases := map[string]bool{}
+	for _, raw := range values {
+		var dep config.Dependency
+		for idx, field := range strings.Split(raw, ",") {
+			parts := strings.SplitN(field, "=", 2)
+			if len(parts) != 2 {
+				if idx == 0 && field != "" {
+					dep.Image = field
+					continue
+				}
+
+				return nil, fmt.Errorf("Invalid dependency format: %s", raw)
+			}
+
+			switch parts[0] {
+			case "image":
+				dep.Image = parts[1]
+			case "alias":
+				dep.Alias = parts[1]
+			case "env":
+				dep.Env = append(dep.Env, parts[1])
+			case "ready":
+				dep.Ready = parts[1]
+			default:
+				return nil, fmt.Errorf("Invalid dependency field: %s (%s)", parts[0], raw)
+			}
+		}
+
+		if dep.Image == "" {
+			return nil, fmt.Errorf("Invalid dependency format (no image): %s", raw)
+		}
+
+		if dep.Alias == "" {
+			//the image name without the registry, the repository path and the tag (e.g., 'postgres')
+			dep.Alias = dep.Image
+			if idx := strings.LastIndex(dep.Alias, "/"); idx >= 0 {
+				dep.Alias = dep.Alias[idx+1:]
+			}
+
+			dep.Alias = strings.SplitN(strings.SplitN(dep.Alias, "@", 2)[0], ":", 2)[0]
+		}
+
+		if aliases[dep.Alias] {
+			return nil, fmt.Errorf("Duplicate dependency alias: %s", dep.Alias)
+		}
+		aliases[dep.Alias] = true
+
+		switch {
+		case dep.Ready == "":
+		case strings.HasPrefix(dep.Ready, container.DepReadyTCP):
+			port, err := strconv.Atoi(strings.TrimPrefix(dep.Ready, container.DepReadyTCP))
+			if err != nil || !isPortNum(port) {
+				return nil, fmt.Errorf("Invalid dependency readiness port: %s", dep.Ready)
+			}
+		case strings.HasPrefix(dep.Ready, container.DepReadyExec):
+			if strings.TrimPrefix(dep.Ready, container.DepReadyExec) == "" {
+				return nil, fmt.Errorf("Invalid dependency readiness command: %s", dep.Ready)
+			}
+		default:
+			return nil, fmt.Errorf("Invalid dependency readiness check: %s (use tcp:<port> or exec:<command>)", dep.Ready)
+		}
+
+		deps = append(deps, dep)
+	}
+
+	return deps, nil
+}
+
 func parsePaths(values []string) map[string]bool {
 	paths := map[string]bool{}
 
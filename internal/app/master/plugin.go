@@ -0,0 +1,143 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/version"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Docker CLI plugin constants
+// (docker-slim is the 'slim' plugin when it's installed in the Docker CLI plugin directory)
+const (
+	PluginName          = "slim"
+	pluginMetadataCmd   = "docker-cli-plugin-metadata"
+	pluginCmdEnv        = "DOCKER_CLI_PLUGIN_ORIGINAL_CLI_COMMAND"
+	pluginSchemaVersion = "0.1.0"
+	pluginVendor        = "docker-slim"
+	pluginURL           = "https://github.com/docker-slim/docker-slim"
+)
+
+type pluginMetadata struct {
+	SchemaVersion    string
+	Vendor           string
+	Version          string
+	ShortDescription string
+	URL              string
+}
+
+// the Docker CLI global options with values (the options without values are flags)
+var pluginOptionsWithValues = map[string]bool{
+	"-c":          true,
+	"--context":   true,
+	"-H":          true,
+	"--host":      true,
+	"--config":    true,
+	"-l":          true,
+	"--log-level": true,
+	"--tlscacert": true,
+	"--tlscert":   true,
+	"--tlskey":    true,
+}
+
+// isPluginMetadataCmd returns true if the Docker CLI asks for the plugin metadata
+func isPluginMetadataCmd(args []string) bool {
+	return len(args) > 1 && args[1] == pluginMetadataCmd
+}
+
+func printPluginMetadata() {
+	metadata := pluginMetadata{
+		SchemaVersion:    pluginSchemaVersion,
+		Vendor:           pluginVendor,
+		Version:          version.Tag(),
+		ShortDescription: AppUsage,
+		URL:              pluginURL,
+	}
+
+	data, err := json.Marshal(&metadata)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(string(data))
+}
+
+// isPluginRun returns true if the Docker CLI runs docker-slim as a plugin ('docker slim ...')
+func isPluginRun() bool {
+	return os.Getenv(pluginCmdEnv) != ""
+}
+
+// pluginArgs converts the Docker CLI plugin invocation args to the regular docker-slim args
+// (the Docker CLI passes its global options and the plugin name before the plugin command,
+// so the Docker connection options are converted to the docker-slim global flags)
+func pluginArgs(args []string) []string {
+	pluginIdx := -1
+	for idx := 1; idx < len(args); idx++ {
+		name := args[idx]
+		if name == PluginName {
+			pluginIdx = idx
+			break
+		}
+
+		if !strings.HasPrefix(name, "-") {
+			break
+		}
+
+		if pluginOptionsWithValues[name] && idx+1 < len(args) {
+			idx++
+		}
+	}
+
+	if pluginIdx < 0 {
+		return args
+	}
+
+	converted := []string{args[0]}
+	for idx := 1; idx < pluginIdx; idx++ {
+		name, value := args[idx], ""
+		if parts := strings.SplitN(name, "=", 2); len(parts) == 2 {
+			name, value = parts[0], parts[1]
+		} else if pluginOptionsWithValues[name] && idx+1 < pluginIdx {
+			idx++
+			value = args[idx]
+		}
+
+		switch name {
+		case "-c", "--context":
+			converted = append(converted, "--"+FlagContext, value)
+		case "-H", "--host":
+			converted = append(converted, "--"+FlagHost, value)
+		case "-l", "--log-level":
+			converted = append(converted, "--"+FlagLogLevel, value)
+		case "-D", "--debug":
+			converted = append(converted, boolFlagArg(FlagDebug, value))
+		case "--tlsverify":
+			converted = append(converted, boolFlagArg(FlagVerifyTLS, value))
+		case "--tlscacert", "--tlscert", "--tlskey":
+			//docker-slim uses the TLS files in one directory
+			converted = append(converted, "--"+FlagTLSCertPath, filepath.Dir(value))
+		case "--config":
+			//the Docker CLI config has the contexts and the registry credentials
+			os.Setenv("DOCKER_CONFIG", value)
+		case "--tls":
+			//TLS is enabled by default
+		default:
+			log.Debugf("docker-slim: ignoring Docker CLI option - %v", args[idx])
+		}
+	}
+
+	return append(converted, args[pluginIdx+1:]...)
+}
+
+func boolFlagArg(name, value string) string {
+	if value == "" {
+		return "--" + name
+	}
+
+	return fmt.Sprintf("--%s=%s", name, value)
+}
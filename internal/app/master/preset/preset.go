@@ -0,0 +1,131 @@
+package preset
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Preset is a bundle of the build defaults for a common application stack
+type Preset struct {
+	Name        string
+	Description string
+	// IncludePaths are the files the apps load on demand (the missing paths are skipped)
+	IncludePaths  []string
+	HTTPProbe     bool
+	ContinueAfter string
+}
+
+// the CA certificates (Debian/Ubuntu, RHEL/Fedora and Alpine locations)
+var certPaths = []string{
+	"/etc/ssl/certs",
+	"/etc/ssl/cert.pem",
+	"/etc/pki/tls/certs",
+	"/etc/pki/ca-trust/extracted",
+	"/usr/share/ca-certificates",
+}
+
+// the time zone data
+var tzPaths = []string{
+	"/usr/share/zoneinfo",
+	"/etc/localtime",
+	"/etc/timezone",
+}
+
+// the user and the name resolution lookups
+// (glibc loads the NSS modules only when the app resolves a host or a user name)
+var nssPaths = []string{
+	"/etc/passwd",
+	"/etc/group",
+	"/etc/nsswitch.conf",
+	"/lib/x86_64-linux-gnu/libnss_files.so.2",
+	"/lib/x86_64-linux-gnu/libnss_dns.so.2",
+	"/lib/x86_64-linux-gnu/libresolv.so.2",
+	"/lib/aarch64-linux-gnu/libnss_files.so.2",
+	"/lib/aarch64-linux-gnu/libnss_dns.so.2",
+	"/lib/aarch64-linux-gnu/libresolv.so.2",
+	"/lib64/libnss_files.so.2",
+	"/lib64/libnss_dns.so.2",
+	"/lib64/libresolv.so.2",
+}
+
+var presets = map[string]*Preset{
+	"node": {
+		Name:        "node",
+		Description: "Node.js apps (CA certificates, time zones and the NSS modules)",
+		IncludePaths: paths(certPaths, tzPaths, nssPaths, []string{
+			"/etc/ssl/openssl.cnf",
+		}),
+		HTTPProbe:     true,
+		ContinueAfter: "probe",
+	},
+	"python": {
+		Name:        "python",
+		Description: "Python apps (CA certificates, time zones, the NSS modules and the MIME types)",
+		IncludePaths: paths(certPaths, tzPaths, nssPaths, []string{
+			"/etc/mime.types",
+		}),
+		HTTPProbe:     true,
+		ContinueAfter: "probe",
+	},
+	"java": {
+		Name:        "java",
+		Description: "JVM apps (CA certificates, the Java trust store, time zones and the NSS modules)",
+		IncludePaths: paths(certPaths, tzPaths, nssPaths, []string{
+			"/etc/ssl/certs/java",
+			"/etc/java",
+		}),
+		HTTPProbe:     true,
+		ContinueAfter: "probe",
+	},
+	"go-static": {
+		Name:          "go-static",
+		Description:   "statically linked Go apps (CA certificates, time zones and the user lookups)",
+		IncludePaths:  paths(certPaths, tzPaths, []string{"/etc/passwd", "/etc/group", "/etc/nsswitch.conf"}),
+		HTTPProbe:     true,
+		ContinueAfter: "probe",
+	},
+	"nginx": {
+		Name:        "nginx",
+		Description: "nginx (the config, the static content, the cache and log directories and the entrypoint scripts)",
+		IncludePaths: paths(certPaths, nssPaths, []string{
+			"/etc/nginx",
+			"/usr/share/nginx/html",
+			"/var/cache/nginx",
+			"/var/log/nginx",
+			"/docker-entrypoint.d",
+		}),
+		HTTPProbe:     true,
+		ContinueAfter: "probe",
+	},
+}
+
+// Get returns the named preset
+func Get(name string) (*Preset, error) {
+	preset, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset - %s (supported presets: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	return preset, nil
+}
+
+// Names returns the supported preset names
+func Names() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func paths(groups ...[]string) []string {
+	var all []string
+	for _, group := range groups {
+		all = append(all, group...)
+	}
+
+	return all
+}
@@ -0,0 +1,245 @@
+package project
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultFileName is the project config file the 'build' command loads from the current directory
+const DefaultFileName = "slim.yaml"
+
+// NoFile is the config file location that disables the project config file
+// (e.g., for the builds started by another build)
+const NoFile = "none"
+
+// KeyImage is the config file key for the target image
+const KeyImage = "image"
+
+// Config is the project config file: the target image and the 'build' command flag values
+// (the keys are the long flag names, e.g., 'http-probe-cmd' or 'include-path')
+type Config struct {
+	Location string
+	Image    string
+	Keys     []string
+	Values   map[string][]string
+}
+
+// Load reads the project config file.
+// The file is a flat YAML mapping: each value is a scalar or a list of scalars
+// (a block list with the '- value' items or a flow list, e.g., '[8080, 8443]').
+func Load(location string) (*Config, error) {
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg := &Config{
+		Location: location,
+		Values:   map[string][]string{},
+	}
+
+	var listKey string
+	lineNum := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" || line[0] != ' ' && line[0] != '-' {
+				return nil, fmt.Errorf("%s:%d: list item without a key", location, lineNum)
+			}
+
+			value, err := parseScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", location, lineNum, err)
+			}
+
+			cfg.Values[listKey] = append(cfg.Values[listKey], value)
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("%s:%d: nested values are not supported", location, lineNum)
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected 'key: value'", location, lineNum)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			return nil, fmt.Errorf("%s:%d: empty key", location, lineNum)
+		}
+
+		if _, ok := cfg.Values[key]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate key - %s", location, lineNum, key)
+		}
+
+		cfg.Keys = append(cfg.Keys, key)
+		cfg.Values[key] = nil
+
+		listKey = ""
+		raw := strings.TrimSpace(parts[1])
+		switch {
+		case raw == "":
+			//the values are in the block list on the next lines
+			listKey = key
+		case strings.HasPrefix(raw, "["):
+			values, err := parseFlowList(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", location, lineNum, err)
+			}
+
+			cfg.Values[key] = values
+		default:
+			value, err := parseScalar(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", location, lineNum, err)
+			}
+
+			cfg.Values[key] = []string{value}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if values, ok := cfg.Values[KeyImage]; ok {
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%s: '%s' must have one value", location, KeyImage)
+		}
+
+		cfg.Image = values[0]
+	}
+
+	return cfg, nil
+}
+
+// Has returns true if the config file has a value for the key
+func (c *Config) Has(key string) bool {
+	if c == nil {
+		return false
+	}
+
+	_, ok := c.Values[key]
+	return ok
+}
+
+// stripComment removes the '#' comment from the line (the '#' in the quoted values is kept)
+func stripComment(line string) string {
+	var quote rune
+	for idx, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (idx == 0 || line[idx-1] == ' ' || line[idx-1] == '\t'):
+			return strings.TrimRight(line[:idx], " \t")
+		}
+	}
+
+	return strings.TrimRight(line, " \t")
+}
+
+func parseScalar(raw string) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '"':
+		if len(raw) < 2 || raw[len(raw)-1] != '"' {
+			return "", fmt.Errorf("unterminated quote - %s", raw)
+		}
+
+		var value strings.Builder
+		escaped := false
+		for _, c := range raw[1 : len(raw)-1] {
+			switch {
+			case escaped:
+				switch c {
+				case 'n':
+					value.WriteRune('\n')
+				case 't':
+					value.WriteRune('\t')
+				default:
+					value.WriteRune(c)
+				}
+				escaped = false
+			case c == '\\':
+				escaped = true
+			default:
+				value.WriteRune(c)
+			}
+		}
+
+		return value.String(), nil
+	case '\'':
+		if len(raw) < 2 || raw[len(raw)-1] != '\'' {
+			return "", fmt.Errorf("unterminated quote - %s", raw)
+		}
+
+		return strings.Replace(raw[1:len(raw)-1], "''", "'", -1), nil
+	case '[', '{', '|', '>', '&', '*':
+		return "", fmt.Errorf("unsupported value - %s", raw)
+	}
+
+	return raw, nil
+}
+
+func parseFlowList(raw string) ([]string, error) {
+	if !strings.HasSuffix(raw, "]") {
+		return nil, fmt.Errorf("unterminated list - %s", raw)
+	}
+
+	raw = strings.TrimSpace(raw[1 : len(raw)-1])
+	if raw == "" {
+		return []string{}, nil
+	}
+
+	var items []string
+	var current strings.Builder
+	var quote rune
+	for _, c := range raw {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, current.String())
+			current.Reset()
+			continue
+		}
+
+		current.WriteRune(c)
+	}
+	items = append(items, current.String())
+
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		value, err := parseScalar(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,576 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerclient"
+	"github.com/docker-slim/docker-slim/pkg/utils/netutils"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Docker Hub and registry API constants
+const (
+	DockerHub          = "docker.io"
+	dockerHubAPI       = "registry-1.docker.io"
+	dockerHubAuthKey   = "https://index.docker.io/v1/"
+	officialRepoName   = "library"
+	defaultTag         = "latest"
+	defaultPlatform    = "linux/amd64"
+	requestTimeout     = 60 * time.Second
+	maxManifestSize    = 4 << 20
+	maxConfigSize      = 16 << 20
+	digestHeader       = "Docker-Content-Digest"
+	authenticateHeader = "WWW-Authenticate"
+)
+
+// Manifest media types
+const (
+	MediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestMediaTypes = []string{
+	MediaTypeManifestList,
+	MediaTypeOCIIndex,
+	MediaTypeManifest,
+	MediaTypeOCIManifest,
+}
+
+var (
+	// ErrUnsupportedManifest is returned for the manifest formats other than the v2 and OCI formats (e.g., schema 1)
+	ErrUnsupportedManifest = errors.New("unsupported manifest format")
+	// ErrNoPlatform is returned when the image index doesn't have a manifest for the selected platform
+	ErrNoPlatform = errors.New("no image for the platform")
+
+	challengeParamPat = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	linkNextPat       = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
+// Reference is a parsed remote image reference
+type Reference struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses the image reference
+// (the image is in Docker Hub if the reference doesn't start with a registry host)
+func ParseReference(imageRef string) (*Reference, error) {
+	ref := &Reference{Host: DockerHub}
+
+	name := imageRef
+	if idx := strings.Index(name, "@"); idx != -1 {
+		name, ref.Digest = name[:idx], name[idx+1:]
+	}
+
+	if idx := strings.LastIndex(name, ":"); idx > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:idx], name[idx+1:]
+	}
+
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 &&
+		(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Host, name = parts[0], parts[1]
+	}
+
+	if name == "" || strings.ToLower(name) != name {
+		return nil, fmt.Errorf("invalid image reference - %q", imageRef)
+	}
+
+	if ref.Host == DockerHub && !strings.Contains(name, "/") {
+		name = officialRepoName + "/" + name
+	}
+
+	ref.Repository = name
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+
+	return ref, nil
+}
+
+// Name returns the tag or the digest the reference points to
+func (r *Reference) Name() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+// String returns the full image reference
+func (r *Reference) String() string {
+	name := r.Host + "/" + r.Repository
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+
+	return name
+}
+
+// FamiliarRef returns the short image reference (the reference format Docker uses)
+// (e.g., 'docker.io/library/nginx:latest' is 'nginx:latest')
+func FamiliarRef(imageRef string) string {
+	switch {
+	case strings.HasPrefix(imageRef, DockerHub+"/"+officialRepoName+"/"):
+		return strings.TrimPrefix(imageRef, DockerHub+"/"+officialRepoName+"/")
+	case strings.HasPrefix(imageRef, DockerHub+"/"):
+		return strings.TrimPrefix(imageRef, DockerHub+"/")
+	}
+
+	return imageRef
+}
+
+// Platform is the image OS and architecture
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String returns the platform in the 'os/arch[/variant]' format
+func (p *Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+
+	return p.OS + "/" + p.Architecture
+}
+
+// Descriptor references a manifest, a config or a layer blob
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// Manifest is an image manifest or an image index (manifest list)
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        *Descriptor  `json:"config,omitempty"`
+	Layers        []Descriptor `json:"layers,omitempty"`
+	Manifests     []Descriptor `json:"manifests,omitempty"`
+}
+
+// IsIndex returns true for the multi-platform image indexes (manifest lists)
+func (m *Manifest) IsIndex() bool {
+	return len(m.Manifests) > 0 || m.MediaType == MediaTypeManifestList || m.MediaType == MediaTypeOCIIndex
+}
+
+// ImageConfig is the part of the image config blob the registry commands show
+type ImageConfig struct {
+	Created      *time.Time `json:"created,omitempty"`
+	OS           string     `json:"os"`
+	Architecture string     `json:"architecture"`
+	Config       struct {
+		User         string              `json:"User"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		WorkingDir   string              `json:"WorkingDir"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	} `json:"config"`
+}
+
+// Image is the remote image information for one platform
+type Image struct {
+	Reference      *Reference
+	Digest         string
+	IndexDigest    string
+	Platforms      []string
+	Manifest       *Manifest
+	RawManifest    []byte
+	RawConfig      []byte
+	Config         *ImageConfig
+	CompressedSize int64
+}
+
+// Client is a Docker Registry HTTP API V2 client (read-only)
+// (the insecure registries are accessed with plain HTTP)
+type Client struct {
+	options     *config.RegistryClient
+	httpClient  *http.Client
+	scheme      string
+	authHeaders map[string]string
+	//the client for the registries accessed without the TLS certificate verification
+	insecureClient *http.Client
+	insecureHosts  map[string]bool
+}
+
+// New creates a new registry client
+// (the custom CA bundle is added to the system CAs and the client certificate is sent to all registries)
+func New(options *config.RegistryClient) (*Client, error) {
+	scheme := "https"
+	if options.Insecure {
+		scheme = "http"
+	}
+
+	client := &Client{
+		options:       options,
+		httpClient:    &http.Client{Timeout: requestTimeout},
+		scheme:        scheme,
+		authHeaders:   map[string]string{},
+		insecureHosts: map[string]bool{},
+	}
+
+	if options.TLS == nil {
+		return client, nil
+	}
+
+	newClient := func(skipVerify bool) (*http.Client, error) {
+		tlsConfig, err := dockerclient.NewTLSConfig(options.TLS.TLSCACert, options.TLS.TLSCert, options.TLS.TLSKey, true, skipVerify)
+		if err != nil {
+			return nil, err
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		return &http.Client{Timeout: requestTimeout, Transport: transport}, nil
+	}
+
+	var err error
+	if options.TLS.TLSCACert != "" || options.TLS.TLSCert != "" {
+		if client.httpClient, err = newClient(false); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(options.TLS.InsecureRegistries) > 0 {
+		if client.insecureClient, err = newClient(true); err != nil {
+			return nil, err
+		}
+
+		for _, host := range options.TLS.InsecureRegistries {
+			client.insecureHosts[strings.ToLower(host)] = true
+		}
+	}
+
+	return client, nil
+}
+
+// client returns the HTTP client for the host (the registry host or the auth server host)
+func (c *Client) client(host string) *http.Client {
+	if c.insecureClient != nil && c.insecureHosts[strings.ToLower(host)] {
+		return c.insecureClient
+	}
+
+	return c.httpClient
+}
+
+// Tags returns the repository tags
+func (c *Client) Tags(ref *Reference) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("/v2/%s/tags/list", ref.Repository)
+	for next != "" {
+		resp, err := c.get(ref, next, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if match := linkNextPat.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			next = match[1]
+		}
+	}
+
+	return tags, nil
+}
+
+// Image fetches the image manifest and config
+// (the manifest for the platform is selected if the reference points to a multi-platform image index)
+func (c *Client) Image(ref *Reference) (*Image, error) {
+	manifest, raw, digest, err := c.manifest(ref, ref.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	image := &Image{Reference: ref}
+	if manifest.IsIndex() {
+		platform := c.options.Platform
+		if platform == "" {
+			platform = defaultPlatform
+		}
+
+		var selected *Descriptor
+		for idx := range manifest.Manifests {
+			desc := &manifest.Manifests[idx]
+			if desc.Platform == nil {
+				continue
+			}
+
+			name := desc.Platform.String()
+			image.Platforms = append(image.Platforms, name)
+			if selected == nil && (name == platform || desc.Platform.OS+"/"+desc.Platform.Architecture == platform) {
+				selected = desc
+			}
+		}
+
+		if selected == nil {
+			return nil, fmt.Errorf("%v - %v (available: %v)", ErrNoPlatform, platform, strings.Join(image.Platforms, ", "))
+		}
+
+		image.IndexDigest = digest
+		manifest, raw, digest, err = c.manifest(ref, selected.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		if manifest.IsIndex() {
+			return nil, ErrUnsupportedManifest
+		}
+	}
+
+	if manifest.Config == nil {
+		return nil, ErrUnsupportedManifest
+	}
+
+	image.Digest = digest
+	image.Manifest = manifest
+	image.RawManifest = raw
+
+	image.CompressedSize = manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		image.CompressedSize += layer.Size
+	}
+
+	resp, err := c.get(ref, fmt.Sprintf("/v2/%s/blobs/%s", ref.Repository, manifest.Config.Digest), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	image.RawConfig, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxConfigSize))
+	if err != nil {
+		return nil, err
+	}
+
+	image.Config = &ImageConfig{}
+	if err := json.Unmarshal(image.RawConfig, image.Config); err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+func (c *Client) manifest(ref *Reference, name string) (*Manifest, []byte, string, error) {
+	header := http.Header{"Accept": []string{strings.Join(manifestMediaTypes, ", ")}}
+	resp, err := c.get(ref, fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, name), header)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, nil, "", err
+	}
+
+	if manifest.SchemaVersion != 2 {
+		return nil, nil, "", ErrUnsupportedManifest
+	}
+
+	if manifest.MediaType == "" {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+
+	digest := resp.Header.Get(digestHeader)
+	if digest == "" && strings.HasPrefix(name, "sha256:") {
+		digest = name
+	}
+
+	return &manifest, raw, digest, nil
+}
+
+// get sends a GET request to the registry API (authenticating if the registry asks for it)
+func (c *Client) get(ref *Reference, path string, header http.Header) (*http.Response, error) {
+	host := ref.Host
+	if host == DockerHub {
+		host = dockerHubAPI
+	}
+
+	target := path
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = fmt.Sprintf("%s://%s%s", c.scheme, host, path)
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		scope := fmt.Sprintf("repository:%s:pull", ref.Repository)
+		if authHeader, ok := c.authHeaders[scope]; ok {
+			req.Header.Set("Authorization", authHeader)
+		}
+
+		resp, err := c.client(req.URL.Host).Do(req)
+		if err != nil {
+			return nil, netutils.ProxyError(err, target)
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get(authenticateHeader)
+			resp.Body.Close()
+
+			if err := c.authenticate(ref, challenge, scope); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%v - unexpected status: %v", target, resp.Status)
+		}
+
+		return resp, nil
+	}
+}
+
+// authenticate handles the registry auth challenge
+// (the basic auth and the token auth the Docker Hub and most other registries use)
+func (c *Client) authenticate(ref *Reference, challenge, scope string) error {
+	username, password := c.credentials(ref.Host)
+
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	switch scheme {
+	case "basic":
+		if username == "" {
+			return fmt.Errorf("registry %v requires credentials", ref.Host)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(username, password)
+		c.authHeaders[scope] = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		params := map[string]string{}
+		for _, match := range challengeParamPat.FindAllStringSubmatch(challenge, -1) {
+			params[strings.ToLower(match[1])] = match[2]
+		}
+
+		realm := params["realm"]
+		if realm == "" {
+			return fmt.Errorf("registry %v auth challenge without realm", ref.Host)
+		}
+
+		query := url.Values{}
+		if params["service"] != "" {
+			query.Set("service", params["service"])
+		}
+		query.Set("scope", scope)
+
+		req, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+
+		resp, err := c.client(req.URL.Host).Do(req)
+		if err != nil {
+			return netutils.ProxyError(err, realm)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("registry %v auth failed - %v", ref.Host, resp.Status)
+		}
+
+		var tokenInfo struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&tokenInfo); err != nil {
+			return err
+		}
+
+		token := tokenInfo.Token
+		if token == "" {
+			token = tokenInfo.AccessToken
+		}
+
+		c.authHeaders[scope] = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("registry %v - unsupported auth challenge: %q", ref.Host, challenge)
+	}
+}
+
+// credentials returns the registry credentials (the client options or the Docker config credentials)
+func (c *Client) credentials(host string) (string, string) {
+	if c.options.Username != "" {
+		return c.options.Username, c.options.Password
+	}
+
+	auth := AuthConfig(host)
+	return auth.Username, auth.Password
+}
+
+// AuthConfig returns the Docker config credentials for the registry (if there are any)
+func AuthConfig(host string) docker.AuthConfiguration {
+	if host == DockerHub {
+		host = dockerHubAuthKey
+	}
+
+	configs, err := docker.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
+		log.Debugf("registry.AuthConfig: no Docker config credentials - %v", err)
+		return docker.AuthConfiguration{}
+	}
+
+	if auth, ok := configs.Configs[host]; ok {
+		return auth
+	}
+
+	if auth, ok := configs.Configs["https://"+host]; ok {
+		return auth
+	}
+
+	return docker.AuthConfiguration{}
+}
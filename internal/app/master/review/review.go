@@ -0,0 +1,476 @@
+package review
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerimage"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	filesDirName     = "files"
+	keepReasonDetail = "review"
+	prompt           = "review> "
+	//the container is only used to copy the files from the image (it's never started)
+	extractCmd = "/docker-slim-review"
+)
+
+// ErrAborted is returned when the user aborts the review session
+var ErrAborted = errors.New("review aborted")
+
+const helpText = `commands:
+  ls [DIR]      show the kept and removed files in the directory ([+] kept, [-] removed, [~] partially kept)
+  keep PATH     keep a file or a directory from the original image
+  drop PATH     remove a kept file or directory from the minified image
+  status        show the kept and removed totals and the changes
+  build         assemble the minified image with the current file set and show its size
+  done          finish the review and build the final image
+  abort         stop without building the minified image
+  help          show this help`
+
+// AssembleFunc builds the minified image from the artifacts and returns the image size
+type AssembleFunc func() (int64, error)
+
+// Session is an interactive review of the files kept in the minified image
+// (the kept files are the files in the artifacts 'files' directory)
+type Session struct {
+	APIClient        *dockerapi.Client
+	ImageID          string
+	ArtifactLocation string
+	Inventory        *dockerimage.Inventory
+	Assemble         AssembleFunc
+	kept             map[string]int64
+	changes          []string
+	creport          *report.ContainerReport
+	containerID      string
+	out              io.Writer
+}
+
+// New creates a new review session for the collected artifacts
+func New(client *dockerapi.Client,
+	imageID string,
+	artifactLocation string,
+	inventory *dockerimage.Inventory,
+	assemble AssembleFunc) (*Session, error) {
+	creport, err := report.LoadContainerReport(filepath.Join(artifactLocation, report.DefaultContainerReportFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		APIClient:        client,
+		ImageID:          imageID,
+		ArtifactLocation: artifactLocation,
+		Inventory:        inventory,
+		Assemble:         assemble,
+		creport:          creport,
+	}
+
+	if err := session.loadKept(); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Run reads the review commands until the user is done (or aborts the review)
+func (s *Session) Run(in io.Reader, out io.Writer) error {
+	s.out = out
+	defer s.removeContainer()
+
+	fmt.Fprintln(out, helpText)
+	s.printStatus()
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+
+			//no more input (e.g., the input is not a terminal)
+			return s.save()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch cmd, args := fields[0], fields[1:]; {
+		case cmd == "ls":
+			dir := "/"
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			err = s.list(dir)
+		case cmd == "keep" && len(args) > 0:
+			for _, target := range args {
+				if err = s.keep(target); err != nil {
+					break
+				}
+			}
+		case cmd == "drop" && len(args) > 0:
+			for _, target := range args {
+				if err = s.drop(target); err != nil {
+					break
+				}
+			}
+		case cmd == "status":
+			s.printStatus()
+		case cmd == "build":
+			err = s.build()
+		case cmd == "done":
+			return s.save()
+		case cmd == "abort":
+			return ErrAborted
+		default:
+			fmt.Fprintln(out, helpText)
+		}
+
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+}
+
+func (s *Session) filesLocation() string {
+	return filepath.Join(s.ArtifactLocation, filesDirName)
+}
+
+// loadKept finds the kept files (the regular files and the symlinks in the 'files' directory)
+func (s *Session) loadKept() error {
+	s.kept = map[string]int64{}
+	location := s.filesLocation()
+	if !fsutils.IsDir(location) {
+		return nil
+	}
+
+	return filepath.Walk(location, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(location, fullPath)
+		if err != nil {
+			return err
+		}
+
+		s.kept["/"+filepath.ToSlash(relPath)] = info.Size()
+		return nil
+	})
+}
+
+type dirEntry struct {
+	name         string
+	isDir        bool
+	keptCount    int
+	keptSize     int64
+	removedCount int
+	removedSize  int64
+}
+
+func (s *Session) list(dir string) error {
+	dir, err := cleanPath(dir)
+	if err != nil {
+		return err
+	}
+
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	entries := map[string]*dirEntry{}
+	add := func(filePath string, size int64, isKept bool) {
+		if !strings.HasPrefix(filePath, prefix) {
+			return
+		}
+
+		name := strings.TrimPrefix(filePath, prefix)
+		isDir := false
+		if idx := strings.Index(name, "/"); idx != -1 {
+			name, isDir = name[:idx], true
+		}
+
+		entry, ok := entries[name]
+		if !ok {
+			entry = &dirEntry{name: name, isDir: isDir}
+			entries[name] = entry
+		}
+
+		if isKept {
+			entry.keptCount++
+			entry.keptSize += size
+		} else {
+			entry.removedCount++
+			entry.removedSize += size
+		}
+	}
+
+	for filePath, size := range s.kept {
+		add(filePath, size, true)
+	}
+
+	for filePath, info := range s.Inventory.Files {
+		if _, ok := s.kept[filePath]; !ok {
+			add(filePath, info.Size, false)
+		}
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("no files in %v", dir)
+	}
+
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := entries[name]
+		mark := "[~]"
+		switch {
+		case entry.removedCount == 0:
+			mark = "[+]"
+		case entry.keptCount == 0:
+			mark = "[-]"
+		}
+
+		if entry.isDir {
+			name += "/"
+		}
+
+		fmt.Fprintf(s.out, "%s %-40s kept=%v (%d) removed=%v (%d)\n",
+			mark, name,
+			humanize.Bytes(uint64(entry.keptSize)), entry.keptCount,
+			humanize.Bytes(uint64(entry.removedSize)), entry.removedCount)
+	}
+
+	return nil
+}
+
+// keep copies a file or a directory from the original image to the kept files
+func (s *Session) keep(target string) error {
+	target, err := cleanPath(target)
+	if err != nil {
+		return err
+	}
+
+	if err := s.createContainer(); err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(s.APIClient.DownloadFromContainer(s.containerID,
+			dockerapi.DownloadFromContainerOptions{
+				Path:         target,
+				OutputStream: writer,
+			}))
+	}()
+
+	added, err := s.extract(reader, path.Dir(target))
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	s.changes = append(s.changes, "keep "+target)
+	fmt.Fprintf(s.out, "kept %v (%d files added)\n", target, added)
+	return nil
+}
+
+// extract saves the files from the container archive in the kept files
+// (the archive entries are relative to the parent directory of the target path).
+// The kept files have the image symlinks, so the archive is extracted without following them
+// and the entries under the symlinks are rejected.
+func (s *Session) extract(archive io.Reader, parentDir string) (int, error) {
+	var added int
+	err := fsutils.ExtractImageArchive(archive, s.filesLocation(), strings.TrimPrefix(parentDir, "/"),
+		func(name string, hdr *tar.Header) {
+			if hdr.Typeflag == tar.TypeDir {
+				return
+			}
+
+			filePath := "/" + filepath.ToSlash(name)
+			if _, ok := s.kept[filePath]; !ok {
+				added++
+			}
+
+			s.kept[filePath] = hdr.Size
+			s.addReportFile(filePath, hdr, hdr.FileInfo().Mode())
+		})
+
+	return added, err
+}
+
+func (s *Session) addReportFile(filePath string, hdr *tar.Header, mode os.FileMode) {
+	for _, props := range s.creport.Image.Files {
+		if props.FilePath == filePath {
+			props.AddReason(report.KeepReasonInclude, keepReasonDetail)
+			return
+		}
+	}
+
+	props := &report.ArtifactProps{
+		FilePath: filePath,
+		Mode:     mode,
+		ModeText: mode.String(),
+		LinkRef:  hdr.Linkname,
+		FileSize: hdr.Size,
+	}
+
+	props.AddReason(report.KeepReasonInclude, keepReasonDetail)
+	s.creport.Image.Files = append(s.creport.Image.Files, props)
+}
+
+// drop removes a file or a directory from the kept files
+func (s *Session) drop(target string) error {
+	target, err := cleanPath(target)
+	if err != nil {
+		return err
+	}
+
+	if target == "/" {
+		return errors.New("can't drop all files")
+	}
+
+	prefix := target + "/"
+	var removed int
+	for filePath := range s.kept {
+		if filePath == target || strings.HasPrefix(filePath, prefix) {
+			delete(s.kept, filePath)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return fmt.Errorf("%v is not kept", target)
+	}
+
+	if err := fsutils.Remove(filepath.Join(s.filesLocation(), filepath.FromSlash(target))); err != nil {
+		return err
+	}
+
+	var files []*report.ArtifactProps
+	for _, props := range s.creport.Image.Files {
+		if props.FilePath != target && !strings.HasPrefix(props.FilePath, prefix) {
+			files = append(files, props)
+		}
+	}
+	s.creport.Image.Files = files
+
+	s.changes = append(s.changes, "drop "+target)
+	fmt.Fprintf(s.out, "dropped %v (%d files removed)\n", target, removed)
+	return nil
+}
+
+func (s *Session) printStatus() {
+	var keptSize, removedSize int64
+	var removedCount int
+	for _, size := range s.kept {
+		keptSize += size
+	}
+
+	for filePath, info := range s.Inventory.Files {
+		if _, ok := s.kept[filePath]; !ok {
+			removedCount++
+			removedSize += info.Size
+		}
+	}
+
+	fmt.Fprintf(s.out, "kept: %d files (%v), removed: %d files (%v)\n",
+		len(s.kept), humanize.Bytes(uint64(keptSize)),
+		removedCount, humanize.Bytes(uint64(removedSize)))
+
+	for _, change := range s.changes {
+		fmt.Fprintf(s.out, "  %v\n", change)
+	}
+}
+
+func (s *Session) build() error {
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(s.out, "building the minified image...")
+	size, err := s.Assemble()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "minified image size: %v\n", humanize.Bytes(uint64(size)))
+	return nil
+}
+
+// save saves the container report with the reviewed file set
+func (s *Session) save() error {
+	return report.SaveContainerReport(filepath.Join(s.ArtifactLocation, report.DefaultContainerReportFileName), s.creport)
+}
+
+func (s *Session) createContainer() error {
+	if s.containerID != "" {
+		return nil
+	}
+
+	containerInfo, err := s.APIClient.CreateContainer(dockerapi.CreateContainerOptions{
+		Config: &dockerapi.Config{
+			Image:      s.ImageID,
+			Entrypoint: []string{extractCmd},
+		},
+	})
+	if err != nil {
+		audit.Container(audit.RuntimeDocker, audit.ActionCreate, "", s.ImageID, err)
+		return err
+	}
+
+	audit.Container(audit.RuntimeDocker, audit.ActionCreate, containerInfo.ID, s.ImageID, nil)
+
+	s.containerID = containerInfo.ID
+	return nil
+}
+
+func (s *Session) removeContainer() {
+	if s.containerID == "" {
+		return
+	}
+
+	err := s.APIClient.RemoveContainer(dockerapi.RemoveContainerOptions{
+		ID:            s.containerID,
+		RemoveVolumes: true,
+		Force:         true,
+	})
+	audit.Container(audit.RuntimeDocker, audit.ActionRemove, s.containerID, s.ImageID, err)
+	if err != nil {
+		log.Infof("review: error removing container => %v - %v", s.containerID, err)
+	}
+
+	s.containerID = ""
+}
+
+func cleanPath(target string) (string, error) {
+	if !strings.HasPrefix(target, "/") {
+		return "", fmt.Errorf("%v is not an absolute path", target)
+	}
+
+	return path.Clean(target), nil
+}
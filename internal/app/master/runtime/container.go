@@ -0,0 +1,125 @@
+package runtime
+
+import (
+	"io"
+
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// ContainerClient provides the container operations docker-slim needs to run the target container
+type ContainerClient interface {
+	// Name returns the container runtime name
+	Name() string
+	// RunContainer creates and starts the container (in its own network namespace)
+	RunContainer(options *ContainerOptions) error
+	// ExecContainer runs the command in the running container with the standard streams
+	// (it returns when the command exits)
+	ExecContainer(id string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error
+	// RemoveContainer stops and removes the container
+	RemoveContainer(id string) error
+}
+
+// Mount is a container bind mount
+type Mount struct {
+	Source      string
+	Destination string
+	ReadOnly    bool
+}
+
+// ContainerOptions are the container parameters
+// (the container output is not kept)
+type ContainerOptions struct {
+	ID         string
+	ImageRef   string
+	Args       []string
+	Env        []string
+	Labels     map[string]string
+	Mounts     []Mount
+	Privileged bool
+}
+
+// DockerContainerClient is the Docker ContainerClient
+type DockerContainerClient struct {
+	APIClient *dockerapi.Client
+}
+
+// NewDockerContainerClient creates a new Docker ContainerClient
+func NewDockerContainerClient(client *dockerapi.Client) *DockerContainerClient {
+	return &DockerContainerClient{
+		APIClient: client,
+	}
+}
+
+// Name returns the container runtime name
+func (c *DockerContainerClient) Name() string {
+	return Docker
+}
+
+// RunContainer creates and starts the container
+// (the first argument is the container entrypoint)
+func (c *DockerContainerClient) RunContainer(options *ContainerOptions) error {
+	var binds []string
+	for _, mount := range options.Mounts {
+		mountMode := "rw"
+		if mount.ReadOnly {
+			mountMode = "ro"
+		}
+
+		binds = append(binds, mount.Source+":"+mount.Destination+":"+mountMode)
+	}
+
+	config := &dockerapi.Config{
+		Image:  options.ImageRef,
+		Env:    options.Env,
+		Labels: options.Labels,
+	}
+
+	if len(options.Args) > 0 {
+		config.Entrypoint = options.Args[:1]
+		config.Cmd = options.Args[1:]
+	}
+
+	_, err := c.APIClient.CreateContainer(dockerapi.CreateContainerOptions{
+		Name:   options.ID,
+		Config: config,
+		HostConfig: &dockerapi.HostConfig{
+			Binds:      binds,
+			Privileged: options.Privileged,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.APIClient.StartContainer(options.ID, nil)
+}
+
+// ExecContainer runs the command in the container
+// (the exec streams are multiplexed without a tty, so the data is not changed)
+func (c *DockerContainerClient) ExecContainer(id string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	exec, err := c.APIClient.CreateExec(dockerapi.CreateExecOptions{
+		Container:    id,
+		Cmd:          cmd,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.APIClient.StartExec(exec.ID, dockerapi.StartExecOptions{
+		InputStream:  stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+	})
+}
+
+// RemoveContainer removes the container (and its anonymous volumes)
+func (c *DockerContainerClient) RemoveContainer(id string) error {
+	return c.APIClient.RemoveContainer(dockerapi.RemoveContainerOptions{
+		ID:            id,
+		RemoveVolumes: true,
+		Force:         true,
+	})
+}
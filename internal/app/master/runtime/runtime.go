@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	"io"
+
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Container runtime names
+const (
+	Docker     = "docker"
+	Containerd = "containerd"
+)
+
+// ImageClient provides the image operations docker-slim needs from the container runtime
+// (the image information uses the Docker API types for all runtimes)
+type ImageClient interface {
+	// Name returns the container runtime name
+	Name() string
+	// InspectImage returns the image metadata (dockerapi.ErrNoSuchImage if there's no image)
+	InspectImage(imageRef string) (*dockerapi.Image, error)
+	// ListImages returns the local images
+	ListImages() ([]dockerapi.APIImages, error)
+	// ImageHistory returns the image history (the latest layer first)
+	ImageHistory(imageRef string) ([]dockerapi.ImageHistory, error)
+	// ExportImage saves the image archive ('docker save' format or the OCI layout)
+	ExportImage(imageRef string, output io.Writer) error
+	// ImportImage loads the image archive ('docker save' format)
+	ImportImage(input io.Reader) error
+	// RemoveImage removes the image reference (and the image if it has no other references)
+	RemoveImage(imageRef string) error
+}
+
+// DockerImageClient is the Docker ImageClient
+type DockerImageClient struct {
+	APIClient *dockerapi.Client
+}
+
+// NewDockerImageClient creates a new Docker ImageClient
+func NewDockerImageClient(client *dockerapi.Client) *DockerImageClient {
+	return &DockerImageClient{
+		APIClient: client,
+	}
+}
+
+// Name returns the container runtime name
+func (c *DockerImageClient) Name() string {
+	return Docker
+}
+
+// InspectImage returns the image metadata
+func (c *DockerImageClient) InspectImage(imageRef string) (*dockerapi.Image, error) {
+	return c.APIClient.InspectImage(imageRef)
+}
+
+// ListImages returns the local images
+func (c *DockerImageClient) ListImages() ([]dockerapi.APIImages, error) {
+	return c.APIClient.ListImages(dockerapi.ListImagesOptions{All: true})
+}
+
+// ImageHistory returns the image history
+func (c *DockerImageClient) ImageHistory(imageRef string) ([]dockerapi.ImageHistory, error) {
+	return c.APIClient.ImageHistory(imageRef)
+}
+
+// ExportImage saves the image archive ('docker save' format)
+func (c *DockerImageClient) ExportImage(imageRef string, output io.Writer) error {
+	return c.APIClient.ExportImage(dockerapi.ExportImageOptions{
+		Name:         imageRef,
+		OutputStream: output,
+	})
+}
+
+// ImportImage loads the image archive
+func (c *DockerImageClient) ImportImage(input io.Reader) error {
+	return c.APIClient.LoadImage(dockerapi.LoadImageOptions{
+		InputStream: input,
+	})
+}
+
+// RemoveImage removes the image reference
+func (c *DockerImageClient) RemoveImage(imageRef string) error {
+	return c.APIClient.RemoveImage(imageRef)
+}
@@ -1,19 +1,26 @@
 package apparmor
 
 import (
-	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"text/template"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
 	"github.com/docker-slim/docker-slim/pkg/report"
+
+	"github.com/cloudimmunity/go-dockerclientx"
 )
 
 const appArmorTemplate = `
 profile {{.ProfileName}} flags=(attach_disconnected,mediate_deleted) {
 
-  network,
-
+{{range $value := .ExposedPorts}}  # exposed port: {{$value}}
+{{end}}{{range $value := .NetworkRules}}  {{$value}},
+{{end}}
 {{range $value := .ExeFileRules}}  {{$value.FilePath}} {{$value.PermSet}},
 {{end}}
 {{range $value := .WriteFileRules}}  {{$value.FilePath}} {{$value.PermSet}},
@@ -23,6 +30,8 @@ profile {{.ProfileName}} flags=(attach_disconnected,mediate_deleted) {
 }
 `
 
+const profilesPath = "/sys/kernel/security/apparmor/profiles"
+
 type appArmorFileRule struct {
 	FilePath string
 	PermSet  string
@@ -30,6 +39,8 @@ type appArmorFileRule struct {
 
 type appArmorProfileData struct {
 	ProfileName    string
+	ExposedPorts   []string
+	NetworkRules   []string
 	ExeFileRules   []appArmorFileRule
 	WriteFileRules []appArmorFileRule
 	ReadFileRules  []appArmorFileRule
@@ -40,23 +51,39 @@ type appArmorProfileData struct {
 //1. exe bit
 //2. w/r operation info (so we can add useful write rules)
 
+// genNetworkRules creates the network rules from the observed socket activity
+// (AppArmor network rules can't restrict ports)
+func genNetworkRules(creport *report.ContainerReport) []string {
+	//no socket activity data in older reports
+	if creport.Monitors.Pt == nil || creport.Monitors.Pt.SocketStats == nil {
+		return []string{"network"}
+	}
+
+	//only the main process is traced (can't restrict the network activity of other processes)
+	if creport.Monitors.Fan != nil && len(creport.Monitors.Fan.Processes) > 1 {
+		return []string{"network"}
+	}
+
+	var rules []string
+	for _, info := range creport.Monitors.Pt.SocketStats {
+		rules = append(rules, fmt.Sprintf("network %s %s", info.FamilyName, info.TypeName))
+	}
+
+	sort.Strings(rules)
+	return rules
+}
+
 // GenProfile creates an AppArmor profile
-func GenProfile(artifactLocation string, profileName string) error {
+func GenProfile(artifactLocation string, profileName string, exposedPorts map[docker.Port]struct{}) error {
 	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
 
 	if _, err := os.Stat(containerReportFilePath); err != nil {
 		return err
 	}
-	reportFile, err := os.Open(containerReportFilePath)
+	creport, err := report.LoadContainerReport(containerReportFilePath)
 	if err != nil {
 		return err
 	}
-	defer reportFile.Close()
-
-	var creport report.ContainerReport
-	if err = json.NewDecoder(reportFile).Decode(&creport); err != nil {
-		return err
-	}
 
 	profilePath := filepath.Join(artifactLocation, profileName)
 
@@ -67,7 +94,15 @@ func GenProfile(artifactLocation string, profileName string) error {
 
 	defer profileFile.Close()
 
-	profileData := appArmorProfileData{ProfileName: profileName}
+	profileData := appArmorProfileData{
+		ProfileName:  profileName,
+		NetworkRules: genNetworkRules(creport),
+	}
+
+	for portInfo := range exposedPorts {
+		profileData.ExposedPorts = append(profileData.ExposedPorts, string(portInfo))
+	}
+	sort.Strings(profileData.ExposedPorts)
 
 	for _, aprops := range creport.Image.Files {
 		if aprops == nil {
@@ -121,3 +156,23 @@ func GenProfile(artifactLocation string, profileName string) error {
 
 	return nil
 }
+
+// IsProfileLoaded returns true if the AppArmor profile is loaded on the (local) Docker host
+func IsProfileLoaded(name string) bool {
+	if dockerhost.GetIP() != "127.0.0.1" {
+		return false
+	}
+
+	profiles, err := ioutil.ReadFile(profilesPath)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(profiles), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,203 @@
+package capabilities
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// Linux capability names (without the 'CAP_' prefix, the same way Docker and Kubernetes use them)
+const (
+	Chown          = "CHOWN"
+	DacOverride    = "DAC_OVERRIDE"
+	Fowner         = "FOWNER"
+	Kill           = "KILL"
+	Mknod          = "MKNOD"
+	NetBindService = "NET_BIND_SERVICE"
+	NetRaw         = "NET_RAW"
+	Setgid         = "SETGID"
+	Setuid         = "SETUID"
+	Setpcap        = "SETPCAP"
+	SysAdmin       = "SYS_ADMIN"
+	SysBoot        = "SYS_BOOT"
+	SysChroot      = "SYS_CHROOT"
+	SysModule      = "SYS_MODULE"
+	SysNice        = "SYS_NICE"
+	SysPtrace      = "SYS_PTRACE"
+	SysRawio       = "SYS_RAWIO"
+	SysResource    = "SYS_RESOURCE"
+	SysTime        = "SYS_TIME"
+	IpcLock        = "IPC_LOCK"
+)
+
+// privileged ports require NET_BIND_SERVICE
+const maxPrivilegedPort = 1023
+
+// the raw and packet sockets require NET_RAW (the Linux socket family and type values)
+const (
+	sockFamilyPacket = 17
+	sockTypeRaw      = 3
+)
+
+// system calls that need a capability to succeed (unless the process calls them
+// without changing anything, e.g., setuid with the current user ID). The system calls that need
+// a capability only with some arguments (e.g., kill, chmod, prlimit64, mknod, bind and open)
+// are checked by the sensor (see the capability stats in the container report).
+var syscallCapabilities = map[string]string{
+	"chown":              Chown,
+	"chown32":            Chown,
+	"fchown":             Chown,
+	"fchown32":           Chown,
+	"fchownat":           Chown,
+	"lchown":             Chown,
+	"lchown32":           Chown,
+	"setuid":             Setuid,
+	"setuid32":           Setuid,
+	"setreuid":           Setuid,
+	"setreuid32":         Setuid,
+	"setresuid":          Setuid,
+	"setresuid32":        Setuid,
+	"setfsuid":           Setuid,
+	"setfsuid32":         Setuid,
+	"setgid":             Setgid,
+	"setgid32":           Setgid,
+	"setregid":           Setgid,
+	"setregid32":         Setgid,
+	"setresgid":          Setgid,
+	"setresgid32":        Setgid,
+	"setfsgid":           Setgid,
+	"setfsgid32":         Setgid,
+	"setgroups":          Setgid,
+	"setgroups32":        Setgid,
+	"capset":             Setpcap,
+	"mount":              SysAdmin,
+	"umount":             SysAdmin,
+	"umount2":            SysAdmin,
+	"pivot_root":         SysAdmin,
+	"sethostname":        SysAdmin,
+	"setdomainname":      SysAdmin,
+	"setns":              SysAdmin,
+	"unshare":            SysAdmin,
+	"quotactl":           SysAdmin,
+	"swapon":             SysAdmin,
+	"swapoff":            SysAdmin,
+	"reboot":             SysBoot,
+	"kexec_load":         SysBoot,
+	"chroot":             SysChroot,
+	"init_module":        SysModule,
+	"finit_module":       SysModule,
+	"delete_module":      SysModule,
+	"setpriority":        SysNice,
+	"sched_setscheduler": SysNice,
+	"sched_setparam":     SysNice,
+	"sched_setattr":      SysNice,
+	"ioprio_set":         SysNice,
+	"ptrace":             SysPtrace,
+	"process_vm_readv":   SysPtrace,
+	"process_vm_writev":  SysPtrace,
+	"iopl":               SysRawio,
+	"ioperm":             SysRawio,
+	"settimeofday":       SysTime,
+	"clock_settime":      SysTime,
+	"adjtimex":           SysTime,
+	"clock_adjtime":      SysTime,
+	"stime":              SysTime,
+	"mlock":              IpcLock,
+	"mlock2":             IpcLock,
+	"mlockall":           IpcLock,
+}
+
+// writing to these locations requires SYS_ADMIN
+var adminWritePaths = []string{
+	"/proc/sys/",
+	"/sys/",
+}
+
+// Find returns the minimal capability set required by the monitored application.
+// The capability set is based on the observed activity: the system calls that always need a capability,
+// the capability checks for the system calls (the sensor checks the call arguments and the process credentials),
+// the raw sockets, the listening ports and the files written in /proc/sys and /sys.
+// The code paths the application didn't use while it was monitored may need more capabilities.
+func Find(artifactLocation string) ([]string, error) {
+	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+
+	if _, err := os.Stat(containerReportFilePath); err != nil {
+		return nil, err
+	}
+	creport, err := report.LoadContainerReport(containerReportFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := map[string]struct{}{}
+
+	if creport.Monitors.Pt != nil {
+		for _, scInfo := range creport.Monitors.Pt.SyscallStats {
+			if capName, ok := syscallCapabilities[scInfo.Name]; ok {
+				caps[capName] = struct{}{}
+			}
+		}
+
+		for _, capInfo := range creport.Monitors.Pt.CapabilityStats {
+			caps[capInfo.Capability] = struct{}{}
+		}
+
+		for _, sockInfo := range creport.Monitors.Pt.SocketStats {
+			if sockInfo.Type == sockTypeRaw || sockInfo.Family == sockFamilyPacket {
+				caps[NetRaw] = struct{}{}
+			}
+		}
+	}
+
+	//the ports the application listened on (the sensor capability checks also find the loopback only ports)
+	if creport.Monitors.Net != nil {
+		for _, port := range creport.Monitors.Net.ListeningPorts {
+			if port.Port > 0 && port.Port <= maxPrivilegedPort {
+				caps[NetBindService] = struct{}{}
+			}
+		}
+	}
+
+	for _, aprops := range creport.Image.Files {
+		if aprops == nil || !aprops.Flags["W"] {
+			continue
+		}
+
+		for _, prefix := range adminWritePaths {
+			if strings.HasPrefix(aprops.FilePath, prefix) {
+				caps[SysAdmin] = struct{}{}
+			}
+		}
+	}
+
+	capList := make([]string, 0, len(caps))
+	for capName := range caps {
+		capList = append(capList, capName)
+	}
+	sort.Strings(capList)
+
+	return capList, nil
+}
+
+// DockerRunOptions returns the 'docker run' capability flags for the capability set
+func DockerRunOptions(caps []string) []string {
+	options := []string{"--cap-drop=ALL"}
+	for _, capName := range caps {
+		options = append(options, "--cap-add="+capName)
+	}
+
+	return options
+}
+
+// OCINames returns the capability names in the format used by the OCI runtime spec
+func OCINames(caps []string) []string {
+	names := make([]string, 0, len(caps))
+	for _, capName := range caps {
+		names = append(names, "CAP_"+capName)
+	}
+
+	return names
+}
@@ -0,0 +1,100 @@
+package capabilities
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name     string
+		monitors report.MonitorReports
+		files    []*report.ArtifactProps
+		expected []string
+	}{
+		{
+			name: "system calls without capability uses",
+			monitors: report.MonitorReports{
+				Pt: &report.PtMonitorReport{
+					SyscallStats: map[string]report.SyscallStatInfo{
+						"62":  {Name: "kill", Count: 3},
+						"90":  {Name: "chmod", Count: 1},
+						"302": {Name: "prlimit64", Count: 2},
+						"49":  {Name: "bind", Count: 1},
+					},
+				},
+				Net: &report.NetMonitorReport{ListeningPorts: []report.ListeningPort{{Port: 8080, Protocol: "tcp"}}},
+			},
+			expected: []string{},
+		},
+		{
+			name: "system calls and capability checks",
+			monitors: report.MonitorReports{
+				Pt: &report.PtMonitorReport{
+					SyscallStats: map[string]report.SyscallStatInfo{
+						"105": {Name: "setuid", Count: 1},
+						"62":  {Name: "kill", Count: 3},
+						"257": {Name: "openat", Count: 10},
+					},
+					CapabilityStats: map[string]report.CapabilityStatInfo{
+						"KILL:kill":           {Capability: Kill, Syscall: "kill", Count: 1},
+						"DAC_OVERRIDE:openat": {Capability: DacOverride, Syscall: "openat", Count: 2},
+					},
+				},
+			},
+			expected: []string{DacOverride, Kill, Setuid},
+		},
+		{
+			name: "sockets and ports",
+			monitors: report.MonitorReports{
+				Pt: &report.PtMonitorReport{
+					SyscallStats: map[string]report.SyscallStatInfo{"41": {Name: "socket", Count: 2}},
+					SocketStats: map[string]report.SocketStatInfo{
+						"2:1": {Family: 2, Type: 1, Count: 1},
+						"2:3": {Family: 2, Type: 3, Count: 1},
+					},
+				},
+				Net: &report.NetMonitorReport{ListeningPorts: []report.ListeningPort{{Port: 80, Protocol: "tcp"}}},
+			},
+			expected: []string{NetBindService, NetRaw},
+		},
+		{
+			name:     "written kernel parameters",
+			files:    []*report.ArtifactProps{{FilePath: "/proc/sys/net/core/somaxconn", Flags: map[string]bool{"W": true}}},
+			expected: []string{SysAdmin},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "dslim-capabilities-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			creport := &report.ContainerReport{
+				Monitors: test.monitors,
+				Image:    report.ImageReport{Files: test.files},
+			}
+
+			if err := report.SaveContainerReport(filepath.Join(dir, report.DefaultContainerReportFileName), creport); err != nil {
+				t.Fatal(err)
+			}
+
+			caps, err := Find(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(caps, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, caps)
+			}
+		})
+	}
+}
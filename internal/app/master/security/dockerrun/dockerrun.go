@@ -0,0 +1,380 @@
+package dockerrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/security/k8s"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const defaultServiceName = "app"
+
+const runScriptTemplate = `#!/bin/sh
+# generated by docker-slim (runs the minified image with the generated security options)
+{{- if .AppArmorProfileName}}
+# load the generated AppArmor profile first: sudo apparmor_parser -r -W {{.AppArmorProfilePath}}
+{{- end}}
+docker run -it --rm \
+{{- if .User}}
+  --user {{.User}} \
+{{- end}}
+{{- if .ReadOnly}}
+  --read-only \
+{{- end}}
+  --cap-drop=ALL \
+{{- range $value := .Capabilities}}
+  --cap-add={{$value}} \
+{{- end}}
+  --security-opt no-new-privileges \
+{{- if .SeccompProfilePath}}
+  --security-opt seccomp={{.SeccompProfilePath}} \
+{{- end}}
+{{- if .AppArmorProfileName}}
+  --security-opt apparmor={{.AppArmorProfileName}} \
+{{- end}}
+{{- range $value := .Ports}}
+  -p {{$value}} \
+{{- end}}
+  {{.ImageName}} "$@"
+`
+
+const composeTemplate = `# generated by docker-slim (runs the minified image with the generated security options)
+version: "2.1"
+services:
+  {{.ServiceName}}:
+    image: {{.ImageName}}
+{{- if .User}}
+    user: "{{.User}}"
+{{- end}}
+{{- if .ReadOnly}}
+    read_only: true
+{{- end}}
+    cap_drop:
+      - ALL
+{{- if .Capabilities}}
+    cap_add:
+{{- range $value := .Capabilities}}
+      - {{$value}}
+{{- end}}
+{{- end}}
+    security_opt:
+      - no-new-privileges
+{{- if .SeccompProfilePath}}
+      - seccomp:{{.SeccompProfilePath}}
+{{- end}}
+{{- if .AppArmorProfileName}}
+      - apparmor:{{.AppArmorProfileName}}
+{{- end}}
+{{- if .Ports}}
+    ports:
+{{- range $value := .Ports}}
+      - "{{$value}}"
+{{- end}}
+{{- end}}
+`
+
+// RunConfigName is the name of the saved minified image run configuration (in the artifact location)
+const RunConfigName = "run-config.json"
+
+// RunConfig contains the security options and the port mappings for the minified image
+// (the 'docker run' script, the compose file fragment and the 'run' command use them)
+type RunConfig struct {
+	ServiceName         string   `json:"service_name"`
+	ImageName           string   `json:"image_name"`
+	User                string   `json:"user,omitempty"`
+	ReadOnly            bool     `json:"read_only"`
+	Capabilities        []string `json:"capabilities"`
+	SeccompProfilePath  string   `json:"seccomp_profile_path"`
+	AppArmorProfileName string   `json:"apparmor_profile_name,omitempty"`
+	AppArmorProfilePath string   `json:"apparmor_profile_path,omitempty"`
+	Ports               []string `json:"ports,omitempty"`
+}
+
+// minifiedImageLink connects a minified image with the artifacts it was built from
+type minifiedImageLink struct {
+	ImageID          string `json:"image_id"`
+	ArtifactLocation string `json:"artifact_location"`
+}
+
+var invalidServiceNameChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// GenSnippets creates a 'docker run' script and a compose file fragment
+// that run the minified image with the generated security options
+func GenSnippets(artifactLocation string,
+	runScriptName string,
+	composeSnippetName string,
+	imageName string,
+	seccompProfileName string,
+	appArmorProfileName string,
+	user string,
+	capabilities []string,
+	exposedPorts map[dockerapi.Port]struct{}) error {
+	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+
+	if _, err := os.Stat(containerReportFilePath); err != nil {
+		return err
+	}
+	creport, err := report.LoadContainerReport(containerReportFilePath)
+	if err != nil {
+		return err
+	}
+
+	data := RunConfig{
+		ServiceName:         serviceName(imageName),
+		ImageName:           imageName,
+		ReadOnly:            true,
+		Capabilities:        capabilities,
+		AppArmorProfileName: appArmorProfileName,
+	}
+
+	if seccompProfileName != "" {
+		data.SeccompProfilePath = filepath.Join(artifactLocation, seccompProfileName)
+	}
+
+	if appArmorProfileName != "" {
+		data.AppArmorProfilePath = filepath.Join(artifactLocation, appArmorProfileName)
+	}
+
+	if k8s.IsNonRootUser(user) {
+		data.User = user
+	}
+
+	for _, aprops := range creport.Image.Files {
+		if aprops != nil && aprops.Flags["W"] {
+			data.ReadOnly = false
+			break
+		}
+	}
+
+	for port := range exposedPorts {
+		mapping := fmt.Sprintf("%s:%s", port.Port(), port.Port())
+		if port.Proto() == "udp" {
+			mapping = fmt.Sprintf("%s/udp", mapping)
+		}
+
+		data.Ports = append(data.Ports, mapping)
+	}
+	sort.Strings(data.Ports)
+
+	runScriptPath := filepath.Join(artifactLocation, runScriptName)
+	log.Debug("docker-slim: saving 'docker run' script to ", runScriptPath)
+	if err := saveSnippet(runScriptPath, "run", runScriptTemplate, 0755, data); err != nil {
+		return err
+	}
+
+	composeSnippetPath := filepath.Join(artifactLocation, composeSnippetName)
+	log.Debug("docker-slim: saving compose file fragment to ", composeSnippetPath)
+	if err := saveSnippet(composeSnippetPath, "compose", composeTemplate, 0644, data); err != nil {
+		return err
+	}
+
+	runConfigData, err := json.MarshalIndent(&data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(artifactLocation, RunConfigName), runConfigData, 0644)
+}
+
+// LoadRunConfig loads the saved run configuration from the artifact location
+func LoadRunConfig(artifactLocation string) (*RunConfig, error) {
+	data, err := ioutil.ReadFile(filepath.Join(artifactLocation, RunConfigName))
+	if err != nil {
+		return nil, err
+	}
+
+	var runConfig RunConfig
+	if err := json.Unmarshal(data, &runConfig); err != nil {
+		return nil, err
+	}
+
+	return &runConfig, nil
+}
+
+// ContainerOptions creates the options for a container that runs the minified image with the saved security options
+// (the AppArmor profile is used only if useAppArmor is true because it needs to be loaded on the Docker host first)
+func (c *RunConfig) ContainerOptions(name string, cmd []string, useAppArmor bool) (*dockerapi.CreateContainerOptions, error) {
+	securityOpts := []string{"no-new-privileges"}
+	if c.SeccompProfilePath != "" {
+		seccompProfile, err := ioutil.ReadFile(c.SeccompProfilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		securityOpts = append(securityOpts, fmt.Sprintf("seccomp=%s", seccompProfile))
+	}
+
+	if useAppArmor && c.AppArmorProfileName != "" {
+		securityOpts = append(securityOpts, fmt.Sprintf("apparmor=%s", c.AppArmorProfileName))
+	}
+
+	options := &dockerapi.CreateContainerOptions{
+		Name: name,
+		Config: &dockerapi.Config{
+			Image:        c.ImageName,
+			Cmd:          cmd,
+			User:         c.User,
+			ExposedPorts: map[dockerapi.Port]struct{}{},
+		},
+		HostConfig: &dockerapi.HostConfig{
+			CapDrop:        []string{"ALL"},
+			CapAdd:         c.Capabilities,
+			SecurityOpt:    securityOpts,
+			ReadonlyRootfs: c.ReadOnly,
+			PortBindings:   map[dockerapi.Port][]dockerapi.PortBinding{},
+		},
+	}
+
+	for _, mapping := range c.Ports {
+		proto := "tcp"
+		if idx := strings.Index(mapping, "/"); idx != -1 {
+			mapping, proto = mapping[:idx], mapping[idx+1:]
+		}
+
+		parts := strings.SplitN(mapping, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad port mapping - %q", mapping)
+		}
+
+		port := dockerapi.Port(fmt.Sprintf("%s/%s", parts[1], proto))
+		options.Config.ExposedPorts[port] = struct{}{}
+		options.HostConfig.PortBindings[port] = append(options.HostConfig.PortBindings[port],
+			dockerapi.PortBinding{HostPort: parts[0]})
+	}
+
+	return options, nil
+}
+
+// SaveImageLink records the artifact location for the minified image
+// (so the 'run' command can find the generated security profiles by the image name)
+func SaveImageLink(statePath, imageID, artifactLocation string) error {
+	location, err := fsutils.PrepareMinifiedDir(statePath)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(&minifiedImageLink{
+		ImageID:          imageID,
+		ArtifactLocation: artifactLocation,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(location, imageLinkName(imageID)), data, 0644)
+}
+
+// FindArtifacts returns the artifact location for the minified image
+func FindArtifacts(statePath, imageID string) (string, error) {
+	location, err := fsutils.PrepareMinifiedDir(statePath)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(location, imageLinkName(imageID)))
+	if err != nil {
+		return "", err
+	}
+
+	var link minifiedImageLink
+	if err := json.Unmarshal(data, &link); err != nil {
+		return "", err
+	}
+
+	return link.ArtifactLocation, nil
+}
+
+// PruneImageLinks removes the minified image links to the artifact locations that don't exist anymore
+func PruneImageLinks(statePath string) (int, error) {
+	location, err := fsutils.PrepareMinifiedDir(statePath)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := ioutil.ReadDir(location)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, entry := range entries {
+		linkPath := filepath.Join(location, entry.Name())
+		if !entry.Mode().IsRegular() || filepath.Ext(linkPath) != ".json" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(linkPath)
+		if err != nil {
+			return count, err
+		}
+
+		var link minifiedImageLink
+		if err := json.Unmarshal(data, &link); err == nil && fsutils.Exists(link.ArtifactLocation) {
+			continue
+		}
+
+		if err := os.Remove(linkPath); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func imageLinkName(imageID string) string {
+	//images IDs in Docker 1.9+ are prefixed with a hash type...
+	if idx := strings.Index(imageID, ":"); idx != -1 {
+		imageID = imageID[idx+1:]
+	}
+
+	return imageID + ".json"
+}
+
+func saveSnippet(snippetPath, name, text string, perm os.FileMode, data RunConfig) error {
+	snippetFile, err := os.OpenFile(snippetPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer snippetFile.Close()
+
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(snippetFile, data)
+}
+
+// serviceName creates a compose service name from the image name (without the registry and the tag)
+func serviceName(imageName string) string {
+	name := imageName
+	if idx := strings.LastIndex(name, "/"); idx != -1 {
+		name = name[idx+1:]
+	}
+
+	if idx := strings.Index(name, ":"); idx != -1 {
+		name = name[:idx]
+	}
+
+	name = strings.TrimSuffix(name, ".slim")
+	name = strings.Trim(invalidServiceNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if name == "" {
+		return defaultServiceName
+	}
+
+	return name
+}
@@ -0,0 +1,175 @@
+package k8s
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const securityContextTemplate = `# generated by docker-slim (container securityContext)
+{{- if .SeccompProfileName}}
+# copy the generated seccomp profile ({{.SeccompProfileName}}) to the kubelet seccomp profile directory
+{{- end}}
+securityContext:
+{{indent 2 .Fields}}`
+
+const securityContextFieldsTemplate = `runAsNonRoot: {{.RunAsNonRoot}}
+{{- if .RunAsUser}}
+runAsUser: {{.RunAsUser}}
+{{- else if .UserName}}
+# set runAsUser (the image user is not numeric: {{.UserName}})
+{{- end}}
+readOnlyRootFilesystem: {{.ReadOnlyRootFilesystem}}
+allowPrivilegeEscalation: false
+capabilities:
+  drop:
+  - ALL
+{{- if .Capabilities}}
+  add:
+{{- range $value := .Capabilities}}
+  - {{$value}}
+{{- end}}
+{{- end}}
+{{- if .SeccompProfileName}}
+seccompProfile:
+  type: Localhost
+  localhostProfile: {{.SeccompProfileName}}
+{{- end}}
+`
+
+var templateFuncs = template.FuncMap{
+	"indent": indent,
+	"add": func(a, b int) int {
+		return a + b
+	},
+}
+
+type securityContextData struct {
+	RunAsNonRoot           bool
+	RunAsUser              string
+	UserName               string
+	ReadOnlyRootFilesystem bool
+	Capabilities           []string
+	SeccompProfileName     string
+}
+
+// GenSecurityContext creates a Kubernetes securityContext snippet
+func GenSecurityContext(artifactLocation string,
+	snippetName string,
+	seccompProfileName string,
+	user string,
+	capabilities []string) error {
+	fields, err := securityContextFields(artifactLocation, seccompProfileName, user, capabilities)
+	if err != nil {
+		return err
+	}
+
+	snippetPath := filepath.Join(artifactLocation, snippetName)
+	log.Debug("docker-slim: saving Kubernetes securityContext to ", snippetPath)
+
+	return saveTemplate(snippetPath, securityContextTemplate, struct {
+		SeccompProfileName string
+		Fields             string
+	}{
+		SeccompProfileName: seccompProfileName,
+		Fields:             fields,
+	})
+}
+
+// securityContextFields returns the securityContext fields (without the 'securityContext' key)
+func securityContextFields(artifactLocation string,
+	seccompProfileName string,
+	user string,
+	capabilities []string) (string, error) {
+	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+
+	if _, err := os.Stat(containerReportFilePath); err != nil {
+		return "", err
+	}
+	creport, err := report.LoadContainerReport(containerReportFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	data := securityContextData{
+		RunAsNonRoot:           IsNonRootUser(user),
+		ReadOnlyRootFilesystem: true,
+		Capabilities:           capabilities,
+		SeccompProfileName:     seccompProfileName,
+	}
+
+	if data.RunAsNonRoot {
+		name := strings.Split(user, ":")[0]
+		if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+			data.RunAsUser = name
+		} else {
+			data.UserName = name
+		}
+	}
+
+	for _, aprops := range creport.Image.Files {
+		if aprops != nil && aprops.Flags["W"] {
+			data.ReadOnlyRootFilesystem = false
+			break
+		}
+	}
+
+	t, err := template.New("securityContextFields").Parse(securityContextFieldsTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var fields bytes.Buffer
+	if err := t.Execute(&fields, data); err != nil {
+		return "", err
+	}
+
+	return fields.String(), nil
+}
+
+func saveTemplate(filePath, text string, data interface{}) error {
+	t, err := template.New(filepath.Base(filePath)).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return err
+	}
+
+	outFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	return t.Execute(outFile, data)
+}
+
+// indent adds the indentation to all non-empty lines
+func indent(spaces int, text string) string {
+	prefix := strings.Repeat(" ", spaces)
+	lines := strings.Split(text, "\n")
+	for idx, line := range lines {
+		if line != "" {
+			lines[idx] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// IsNonRootUser returns true if the image user (USER instruction value) is not root
+func IsNonRootUser(user string) bool {
+	//the user can be in the 'user:group' format
+	name := strings.Split(user, ":")[0]
+	switch name {
+	case "", "root", "0":
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,190 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Manifest patch file names
+const (
+	PatchDirName             = "k8s-patches"
+	KustomizationName        = "kustomization.yaml"
+	SecurityContextPatchName = "security-context-patch.yaml"
+	HelmValuesName           = "helm-values.yaml"
+)
+
+// DefaultKustomizeBase is the default kustomize base (the original manifests)
+const DefaultKustomizeBase = "../base"
+
+const (
+	defaultWorkloadKind       = "deployment"
+	latestTag                 = "latest"
+	podSpecPathTemplate       = "spec.template.spec"
+	podSpecPathCronJob        = "spec.jobTemplate.spec.template.spec"
+	podSpecPathPod            = "spec"
+	securityContextPatchTitle = "# generated by docker-slim (kustomize patch for %s/%s)"
+)
+
+type workloadKind struct {
+	Kind        string
+	APIVersion  string
+	PodSpecPath string
+}
+
+var workloadKinds = map[string]workloadKind{
+	"deployment":  {Kind: "Deployment", APIVersion: "apps/v1", PodSpecPath: podSpecPathTemplate},
+	"statefulset": {Kind: "StatefulSet", APIVersion: "apps/v1", PodSpecPath: podSpecPathTemplate},
+	"daemonset":   {Kind: "DaemonSet", APIVersion: "apps/v1", PodSpecPath: podSpecPathTemplate},
+	"job":         {Kind: "Job", APIVersion: "batch/v1", PodSpecPath: podSpecPathTemplate},
+	"cronjob":     {Kind: "CronJob", APIVersion: "batch/v1beta1", PodSpecPath: podSpecPathCronJob},
+	"pod":         {Kind: "Pod", APIVersion: "v1", PodSpecPath: podSpecPathPod},
+}
+
+const kustomizationTemplate = `# generated by docker-slim (kustomize overlay using the minified image)
+# copy this directory next to your base manifests and apply it with: kubectl apply -k {{.DirName}}
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- {{.Base}}
+images:
+- name: {{.ImageName}}
+  newName: {{.NewName}}
+  newTag: "{{.NewTag}}"
+patchesStrategicMerge:
+- {{.PatchName}}
+`
+
+const securityContextPatchTemplate = `{{.Title}}
+{{- if .SeccompProfileName}}
+# copy the generated seccomp profile ({{.SeccompProfileName}}) to the kubelet seccomp profile directory
+{{- end}}
+apiVersion: {{.APIVersion}}
+kind: {{.Kind}}
+metadata:
+  name: {{.Name}}
+{{.PodSpecHeader}}{{indent .Indent "containers:"}}
+{{indent .Indent (printf "- name: %s" .Container)}}
+{{indent .Indent "  securityContext:"}}
+{{indent (add .Indent 4) .Fields}}`
+
+const helmValuesTemplate = `# generated by docker-slim (Helm values using the minified image)
+# use it with: helm upgrade RELEASE CHART -f {{.FileName}}
+# (the 'image' and 'securityContext' values follow the 'helm create' chart conventions)
+{{- if .SeccompProfileName}}
+# copy the generated seccomp profile ({{.SeccompProfileName}}) to the kubelet seccomp profile directory
+{{- end}}
+image:
+  repository: {{.NewName}}
+  tag: "{{.NewTag}}"
+securityContext:
+{{indent 2 .Fields}}`
+
+// GenPatches creates the kustomize and Helm patches to deploy the minified image
+// (the patches are saved in the PatchDirName directory in the artifact location)
+func GenPatches(artifactLocation string,
+	patchConfig *config.K8sPatch,
+	imageRef string,
+	minifiedImageRef string,
+	seccompProfileName string,
+	user string,
+	capabilities []string) error {
+	imageName, _ := SplitImageRef(imageRef)
+	newName, newTag := SplitImageRef(minifiedImageRef)
+	appName := path.Base(imageName)
+
+	kindName := defaultWorkloadKind
+	workloadName := appName
+	if patchConfig.Workload != "" {
+		parts := strings.SplitN(patchConfig.Workload, "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("invalid workload (kind/name) - %v", patchConfig.Workload)
+		}
+
+		kindName, workloadName = strings.ToLower(parts[0]), parts[1]
+	}
+
+	kind, ok := workloadKinds[kindName]
+	if !ok {
+		return fmt.Errorf("unsupported workload kind - %v", kindName)
+	}
+
+	containerName := patchConfig.Container
+	if containerName == "" {
+		containerName = appName
+	}
+
+	base := patchConfig.Base
+	if base == "" {
+		base = DefaultKustomizeBase
+	}
+
+	fields, err := securityContextFields(artifactLocation, seccompProfileName, user, capabilities)
+	if err != nil {
+		return err
+	}
+
+	patchDir := filepath.Join(artifactLocation, PatchDirName)
+	if err := os.MkdirAll(patchDir, 0777); err != nil {
+		return err
+	}
+
+	log.Debug("docker-slim: saving Kubernetes manifest patches to ", patchDir)
+
+	err = saveTemplate(filepath.Join(patchDir, KustomizationName), kustomizationTemplate, map[string]interface{}{
+		"DirName":   PatchDirName,
+		"Base":      base,
+		"ImageName": imageName,
+		"NewName":   newName,
+		"NewTag":    newTag,
+		"PatchName": SecurityContextPatchName,
+	})
+	if err != nil {
+		return err
+	}
+
+	var podSpecHeader strings.Builder
+	pathKeys := strings.Split(kind.PodSpecPath, ".")
+	for idx, key := range pathKeys {
+		fmt.Fprintf(&podSpecHeader, "%s%s:\n", strings.Repeat("  ", idx), key)
+	}
+
+	err = saveTemplate(filepath.Join(patchDir, SecurityContextPatchName), securityContextPatchTemplate, map[string]interface{}{
+		"Title":              fmt.Sprintf(securityContextPatchTitle, kind.Kind, workloadName),
+		"SeccompProfileName": seccompProfileName,
+		"APIVersion":         kind.APIVersion,
+		"Kind":               kind.Kind,
+		"Name":               workloadName,
+		"PodSpecHeader":      podSpecHeader.String(),
+		"Indent":             len(pathKeys) * 2,
+		"Container":          containerName,
+		"Fields":             fields,
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveTemplate(filepath.Join(patchDir, HelmValuesName), helmValuesTemplate, map[string]interface{}{
+		"FileName":           HelmValuesName,
+		"SeccompProfileName": seccompProfileName,
+		"NewName":            newName,
+		"NewTag":             newTag,
+		"Fields":             fields,
+	})
+}
+
+// SplitImageRef returns the image name and tag ('latest' if the image reference has no tag)
+func SplitImageRef(imageRef string) (string, string) {
+	imageRef = strings.Split(imageRef, "@")[0]
+	if idx := strings.LastIndex(imageRef, ":"); idx > strings.LastIndex(imageRef, "/") {
+		return imageRef[:idx], imageRef[idx+1:]
+	}
+
+	return imageRef, latestTag
+}
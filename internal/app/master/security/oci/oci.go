@@ -0,0 +1,252 @@
+package oci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/capabilities"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const ociVersion = "1.0.0"
+
+// the default capability set used by runc (used when the minimal capability set is unknown)
+var defaultCapabilities = []string{
+	"CAP_AUDIT_WRITE",
+	"CAP_KILL",
+	"CAP_NET_BIND_SERVICE",
+}
+
+var defaultMaskedPaths = []string{
+	"/proc/acpi",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+}
+
+var defaultReadonlyPaths = []string{
+	"/proc/asound",
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// the image volumes are tmpfs mounts in the spec (the spec has no anonymous volumes)
+var imageVolumeMountOptions = []string{"nosuid", "nodev", "mode=1777"}
+
+// GenSpec creates an OCI runtime spec (config.json) fragment. The root filesystem is read-only
+// if the application didn't write any files outside of the volume mounts and the image volumes.
+func GenSpec(artifactLocation string,
+	specName string,
+	seccompProfileName string,
+	appArmorProfileName string,
+	capabilityNames []string,
+	volumeMounts map[string]config.VolumeMount,
+	imageVolumes map[string]struct{}) error {
+	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
+
+	if _, err := os.Stat(containerReportFilePath); err != nil {
+		return err
+	}
+	creport, err := report.LoadContainerReport(containerReportFilePath)
+	if err != nil {
+		return err
+	}
+
+	//there's no seccomp profile if the container report has no system call data
+	var linuxSeccomp *specs.LinuxSeccomp
+	if seccompProfileName != "" {
+		seccompProfileData, err := ioutil.ReadFile(filepath.Join(artifactLocation, seccompProfileName))
+		if err != nil {
+			return err
+		}
+
+		var seccompProfile specs.Seccomp
+		if err = json.Unmarshal(seccompProfileData, &seccompProfile); err != nil {
+			return err
+		}
+
+		linuxSeccomp = seccompToLinuxSeccomp(&seccompProfile)
+	}
+
+	writtenFiles := map[string]bool{}
+	for _, aprops := range creport.Image.Files {
+		if aprops != nil && aprops.Flags["W"] {
+			writtenFiles[aprops.FilePath] = true
+		}
+	}
+
+	//the writes under the mounts don't change the root filesystem
+	volumeMountPaths := map[string]bool{}
+	mountPaths := map[string]bool{}
+	for _, volumeMount := range volumeMounts {
+		volumeMountPaths[volumeMount.Destination] = true
+		mountPaths[volumeMount.Destination] = true
+	}
+
+	for volumePath := range imageVolumes {
+		mountPaths[volumePath] = true
+	}
+
+	var rootWrites bool
+	for filePath := range writtenFiles {
+		if !isUnderMounts(filePath, mountPaths) {
+			rootWrites = true
+			break
+		}
+	}
+
+	procCaps := defaultCapabilities
+	if capabilityNames != nil {
+		procCaps = capabilities.OCINames(capabilityNames)
+	}
+
+	spec := &specs.Spec{
+		Version: ociVersion,
+		Process: &specs.Process{
+			NoNewPrivileges: true,
+			Capabilities: &specs.LinuxCapabilities{
+				Bounding:  procCaps,
+				Effective: procCaps,
+				Permitted: procCaps,
+			},
+			ApparmorProfile: appArmorProfileName,
+		},
+		Root: &specs.Root{
+			Path:     "rootfs",
+			Readonly: !rootWrites,
+		},
+		Linux: &specs.Linux{
+			Seccomp:       linuxSeccomp,
+			MaskedPaths:   defaultMaskedPaths,
+			ReadonlyPaths: defaultReadonlyPaths,
+		},
+	}
+
+	for _, volumeMount := range volumeMounts {
+		mount := specs.Mount{
+			Destination: volumeMount.Destination,
+			Type:        "bind",
+			Source:      volumeMount.Source,
+			Options:     []string{"rbind"},
+		}
+
+		if volumeMount.Options == "ro" || !hasWritesUnder(writtenFiles, volumeMount.Destination) {
+			mount.Options = append(mount.Options, "ro")
+		} else {
+			mount.Options = append(mount.Options, "rw")
+		}
+
+		spec.Mounts = append(spec.Mounts, mount)
+	}
+
+	for volumePath := range imageVolumes {
+		if volumeMountPaths[volumePath] {
+			continue
+		}
+
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: volumePath,
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     imageVolumeMountOptions,
+		})
+	}
+
+	sort.Slice(spec.Mounts, func(i, j int) bool {
+		return spec.Mounts[i].Destination < spec.Mounts[j].Destination
+	})
+
+	specPath := filepath.Join(artifactLocation, specName)
+	log.Debug("docker-slim: saving OCI runtime spec to ", specPath)
+
+	specData, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(specPath, specData, 0644)
+}
+
+func seccompToLinuxSeccomp(profile *specs.Seccomp) *specs.LinuxSeccomp {
+	linuxSeccomp := &specs.LinuxSeccomp{
+		DefaultAction: profile.DefaultAction,
+		Architectures: profile.Architectures,
+	}
+
+	//group the syscalls by action (the OCI format allows multiple names per rule)
+	actionNames := map[specs.Action][]string{}
+	var actions []specs.Action
+	for _, syscall := range profile.Syscalls {
+		if syscall == nil {
+			continue
+		}
+
+		names := syscall.Names
+		if syscall.Name != "" {
+			names = append([]string{syscall.Name}, names...)
+		}
+
+		if len(syscall.Args) > 0 {
+			linuxSeccomp.Syscalls = append(linuxSeccomp.Syscalls, specs.LinuxSyscall{
+				Names:  names,
+				Action: syscall.Action,
+				Args:   syscall.Args,
+			})
+			continue
+		}
+
+		if _, ok := actionNames[syscall.Action]; !ok {
+			actions = append(actions, syscall.Action)
+		}
+
+		actionNames[syscall.Action] = append(actionNames[syscall.Action], names...)
+	}
+
+	for _, action := range actions {
+		names := actionNames[action]
+		sort.Strings(names)
+		linuxSeccomp.Syscalls = append(linuxSeccomp.Syscalls, specs.LinuxSyscall{
+			Names:  names,
+			Action: action,
+		})
+	}
+
+	return linuxSeccomp
+}
+
+func isUnderMounts(filePath string, mountPaths map[string]bool) bool {
+	for mountPath := range mountPaths {
+		if strings.HasPrefix(filePath, strings.TrimSuffix(mountPath, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasWritesUnder(writtenFiles map[string]bool, dirPath string) bool {
+	prefix := strings.TrimSuffix(dirPath, "/") + "/"
+	for filePath := range writtenFiles {
+		if strings.HasPrefix(filePath, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,83 @@
+package oci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
+)
+
+func TestGenSpecReadonlyRoot(t *testing.T) {
+	volumeMounts := map[string]config.VolumeMount{
+		"data": {Source: "/srv/data", Destination: "/data"},
+	}
+
+	imageVolumes := map[string]struct{}{
+		"/var/cache/app": {},
+		"/data":          {},
+	}
+
+	tests := []struct {
+		name     string
+		written  []string
+		readonly bool
+	}{
+		{name: "no writes", readonly: true},
+		{name: "writes under the volume mount", written: []string{"/data/db.sqlite"}, readonly: true},
+		{name: "writes under the image volume", written: []string{"/var/cache/app/index"}, readonly: true},
+		{name: "writes next to the image volume", written: []string{"/var/cache/app.lock"}},
+		{name: "writes in the root filesystem", written: []string{"/data/db.sqlite", "/etc/app.conf"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "dslim-oci-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			creport := &report.ContainerReport{}
+			for _, filePath := range test.written {
+				creport.Image.Files = append(creport.Image.Files, &report.ArtifactProps{
+					FilePath: filePath,
+					Flags:    map[string]bool{"W": true},
+				})
+			}
+
+			if err := report.SaveContainerReport(filepath.Join(dir, report.DefaultContainerReportFileName), creport); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := GenSpec(dir, "config.json", "", "", nil, volumeMounts, imageVolumes); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var spec specs.Spec
+			if err := json.Unmarshal(data, &spec); err != nil {
+				t.Fatal(err)
+			}
+
+			if spec.Root.Readonly != test.readonly {
+				t.Fatalf("expected readonly root %v", test.readonly)
+			}
+
+			//the volume mount replaces the image volume with the same path
+			if len(spec.Mounts) != 2 ||
+				spec.Mounts[0].Destination != "/data" || spec.Mounts[0].Type != "bind" ||
+				spec.Mounts[1].Destination != "/var/cache/app" || spec.Mounts[1].Type != "tmpfs" {
+				t.Fatalf("unexpected mounts: %+v", spec.Mounts)
+			}
+		})
+	}
+}
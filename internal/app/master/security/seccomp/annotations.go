@@ -0,0 +1,126 @@
+package seccomp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// the reasons a system call is included in the generated profile
+const (
+	sourceObserved = "observed"
+	sourceExtra    = "extra"
+	sourceBaseline = "baseline"
+)
+
+// max number of file paths listed in a single annotation
+const maxAnnotationFiles = 5
+
+// appActivity summarizes the monitored application activity used to annotate the profile rules
+type appActivity struct {
+	processPath   string
+	readFiles     []string
+	writtenFiles  []string
+	executedFiles []string
+	sockets       []string
+}
+
+func newAppActivity(creport *report.ContainerReport) *appActivity {
+	activity := &appActivity{
+		processPath: "the target app",
+	}
+
+	if creport.Monitors.Fan != nil && creport.Monitors.Fan.MainProcess != nil {
+		activity.processPath = creport.Monitors.Fan.MainProcess.Path
+	}
+
+	for _, aprops := range creport.Image.Files {
+		if aprops == nil {
+			continue
+		}
+
+		if aprops.Flags["R"] {
+			activity.readFiles = append(activity.readFiles, aprops.FilePath)
+		}
+
+		if aprops.Flags["W"] {
+			activity.writtenFiles = append(activity.writtenFiles, aprops.FilePath)
+		}
+
+		if aprops.Flags["X"] {
+			activity.executedFiles = append(activity.executedFiles, aprops.FilePath)
+		}
+	}
+
+	sort.Strings(activity.readFiles)
+	sort.Strings(activity.writtenFiles)
+	sort.Strings(activity.executedFiles)
+
+	if creport.Monitors.Pt != nil {
+		for _, ssInfo := range creport.Monitors.Pt.SocketStats {
+			activity.sockets = append(activity.sockets,
+				fmt.Sprintf("%s/%s x%d", ssInfo.FamilyName, ssInfo.TypeName, ssInfo.Count))
+		}
+		sort.Strings(activity.sockets)
+	}
+
+	return activity
+}
+
+// annotate explains why the system call is allowed by the profile
+func (a *appActivity) annotate(name, category, source string, scInfo report.SyscallStatInfo, compatABIs []string) string {
+	switch source {
+	case sourceExtra:
+		return fmt.Sprintf("[%s] required by the container runtime to start the app (not observed)", category)
+	case sourceBaseline:
+		return fmt.Sprintf("[%s] allowed by the baseline profile (not observed)", category)
+	}
+
+	annotation := fmt.Sprintf("[%s] called %d time(s) by %s", category, scInfo.Count, a.processPath)
+	if len(compatABIs) > 0 {
+		sort.Strings(compatABIs)
+		annotation = fmt.Sprintf("%s (compat ABI: %s)", annotation, strings.Join(compatABIs, ", "))
+	}
+
+	var details string
+	switch {
+	case name == "execve" || name == "execveat":
+		details = fileListDetails("executed", a.executedFiles)
+	case category == CategoryNetwork && len(a.sockets) > 0:
+		details = fmt.Sprintf("sockets: %s", strings.Join(a.sockets, ", "))
+	case category == CategoryFile:
+		var fileDetails []string
+		if info := fileListDetails("read", a.readFiles); info != "" {
+			fileDetails = append(fileDetails, info)
+		}
+
+		if info := fileListDetails("written", a.writtenFiles); info != "" {
+			fileDetails = append(fileDetails, info)
+		}
+
+		details = strings.Join(fileDetails, "; ")
+	}
+
+	if details != "" {
+		annotation = fmt.Sprintf("%s (%s)", annotation, details)
+	}
+
+	return annotation
+}
+
+func fileListDetails(action string, files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	if len(files) <= maxAnnotationFiles {
+		return fmt.Sprintf("%s: %s", action, strings.Join(files, ", "))
+	}
+
+	return fmt.Sprintf("%s: %s and %d more",
+		action,
+		strings.Join(files[:maxAnnotationFiles], ", "),
+		len(files)-maxAnnotationFiles)
+}
@@ -0,0 +1,133 @@
+package seccomp
+
+// System call categories (used to group the rules in the generated profiles)
+const (
+	CategoryFile    = "file"
+	CategoryNetwork = "network"
+	CategoryProcess = "process"
+	CategoryMemory  = "memory"
+	CategorySignal  = "signal"
+	CategoryIPC     = "ipc"
+	CategoryTime    = "time"
+	CategorySystem  = "system"
+	CategoryOther   = "other"
+)
+
+// the order of the rule groups in the generated profiles
+var categoryOrder = []string{
+	CategoryFile,
+	CategoryNetwork,
+	CategoryProcess,
+	CategoryMemory,
+	CategorySignal,
+	CategoryIPC,
+	CategoryTime,
+	CategorySystem,
+	CategoryOther,
+}
+
+var categoryDescriptions = map[string]string{
+	CategoryFile:    "file system access",
+	CategoryNetwork: "networking",
+	CategoryProcess: "process and thread management",
+	CategoryMemory:  "memory management",
+	CategorySignal:  "signal handling",
+	CategoryIPC:     "inter-process communication and event notification",
+	CategoryTime:    "clocks and timers",
+	CategorySystem:  "system information and administration",
+	CategoryOther:   "uncategorized system calls",
+}
+
+var syscallCategories = map[string]string{}
+
+func init() {
+	categoryCalls := map[string][]string{
+		CategoryFile: {
+			"access", "chdir", "chmod", "chown", "chown32", "chroot", "close", "copy_file_range",
+			"creat", "dup", "dup2", "dup3", "faccessat", "fadvise64", "fadvise64_64", "fallocate",
+			"fchdir", "fchmod", "fchmodat", "fchown", "fchown32", "fchownat", "fcntl", "fcntl64",
+			"fdatasync", "fgetxattr", "flistxattr", "flock", "fremovexattr", "fsetxattr", "fstat",
+			"fstat64", "fstatat64", "fstatfs", "fstatfs64", "fsync", "ftruncate", "ftruncate64",
+			"futimesat", "getcwd", "getdents", "getdents64", "getxattr", "ioctl", "lchown",
+			"lchown32", "lgetxattr", "link", "linkat", "listxattr", "llistxattr", "_llseek",
+			"lremovexattr", "lseek", "lsetxattr", "lstat", "lstat64", "mkdir", "mkdirat", "mknod",
+			"mknodat", "mount", "newfstatat", "open", "openat", "pivot_root", "pread64", "preadv",
+			"preadv2", "pwrite64", "pwritev", "pwritev2", "read", "readahead", "readlink",
+			"readlinkat", "readv", "removexattr", "rename", "renameat", "renameat2", "rmdir",
+			"sendfile", "sendfile64", "setxattr", "splice", "stat", "stat64", "statfs", "statfs64",
+			"statx", "symlink", "symlinkat", "sync", "sync_file_range", "syncfs", "tee", "truncate",
+			"truncate64", "umask", "umount", "umount2", "unlink", "unlinkat", "utime", "utimensat",
+			"utimes", "vmsplice", "write", "writev", "io_cancel", "io_destroy", "io_getevents",
+			"io_setup", "io_submit", "quotactl",
+		},
+		CategoryNetwork: {
+			"accept", "accept4", "bind", "connect", "getpeername", "getsockname", "getsockopt",
+			"listen", "recv", "recvfrom", "recvmmsg", "recvmsg", "send", "sendmmsg", "sendmsg",
+			"sendto", "setsockopt", "shutdown", "socket", "socketcall", "socketpair",
+		},
+		CategoryProcess: {
+			"arch_prctl", "capget", "capset", "clone", "execve", "execveat", "exit", "exit_group",
+			"fork", "get_robust_list", "get_thread_area", "getegid", "getegid32", "geteuid",
+			"geteuid32", "getgid", "getgid32", "getgroups", "getgroups32", "getpgid", "getpgrp",
+			"getpid", "getppid", "getpriority", "getresgid", "getresgid32", "getresuid",
+			"getresuid32", "getrlimit", "getrusage", "getsid", "gettid", "getuid", "getuid32",
+			"ioprio_get", "ioprio_set", "kcmp", "modify_ldt", "prctl", "prlimit64",
+			"process_vm_readv", "process_vm_writev", "ptrace", "sched_getaffinity",
+			"sched_getattr", "sched_getparam", "sched_get_priority_max", "sched_get_priority_min",
+			"sched_getscheduler", "sched_rr_get_interval", "sched_setaffinity", "sched_setattr",
+			"sched_setparam", "sched_setscheduler", "sched_yield", "seccomp", "set_robust_list",
+			"set_thread_area", "set_tid_address", "setfsgid", "setfsgid32", "setfsuid",
+			"setfsuid32", "setgid", "setgid32", "setgroups", "setgroups32", "setns", "setpgid",
+			"setpriority", "setregid", "setregid32", "setresgid", "setresgid32", "setresuid",
+			"setresuid32", "setreuid", "setreuid32", "setrlimit", "setsid", "setuid", "setuid32",
+			"ugetrlimit", "unshare", "vfork", "wait4", "waitid", "waitpid",
+		},
+		CategoryMemory: {
+			"brk", "madvise", "membarrier", "memfd_create", "mincore", "mlock", "mlock2",
+			"mlockall", "mmap", "mmap2", "mprotect", "mremap", "msync", "munlock", "munlockall",
+			"munmap", "remap_file_pages", "futex",
+		},
+		CategorySignal: {
+			"kill", "pause", "restart_syscall", "rt_sigaction", "rt_sigpending", "rt_sigprocmask",
+			"rt_sigqueueinfo", "rt_sigreturn", "rt_sigsuspend", "rt_sigtimedwait",
+			"rt_tgsigqueueinfo", "sigaltstack", "signalfd", "signalfd4", "sigreturn", "tgkill",
+			"tkill",
+		},
+		CategoryIPC: {
+			"epoll_create", "epoll_create1", "epoll_ctl", "epoll_ctl_old", "epoll_pwait",
+			"epoll_wait", "epoll_wait_old", "eventfd", "eventfd2", "fanotify_init",
+			"fanotify_mark", "inotify_add_watch", "inotify_init", "inotify_init1",
+			"inotify_rm_watch", "ipc", "mq_getsetattr", "mq_notify", "mq_open", "mq_timedreceive",
+			"mq_timedsend", "mq_unlink", "msgctl", "msgget", "msgrcv", "msgsnd", "_newselect",
+			"pipe", "pipe2", "poll", "ppoll", "pselect6", "select", "semctl", "semget", "semop",
+			"semtimedop", "shmat", "shmctl", "shmdt", "shmget",
+		},
+		CategoryTime: {
+			"adjtimex", "alarm", "clock_adjtime", "clock_getres", "clock_gettime",
+			"clock_nanosleep", "clock_settime", "getitimer", "gettimeofday", "nanosleep",
+			"setitimer", "settimeofday", "stime", "time", "timer_create", "timer_delete",
+			"timer_getoverrun", "timer_gettime", "timer_settime", "timerfd_create",
+			"timerfd_gettime", "timerfd_settime", "times",
+		},
+		CategorySystem: {
+			"delete_module", "finit_module", "getcpu", "getrandom", "init_module", "iopl",
+			"ioperm", "kexec_load", "reboot", "sethostname", "setdomainname", "swapoff",
+			"swapon", "sysinfo", "syslog", "uname",
+		},
+	}
+
+	for category, calls := range categoryCalls {
+		for _, name := range calls {
+			syscallCategories[name] = category
+		}
+	}
+}
+
+// SyscallCategory returns the functional category for the system call
+func SyscallCategory(name string) string {
+	if category, ok := syscallCategories[name]; ok {
+		return category
+	}
+
+	return CategoryOther
+}
@@ -2,10 +2,15 @@ package seccomp
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
 
@@ -13,16 +18,66 @@ import (
 	"github.com/cloudimmunity/system"
 )
 
+// architecture (and system call ABI) names used by the sensor
+const (
+	archNameArm   system.ArchName = "arm"
+	archNameArm64 system.ArchName = "arm64"
+	archNameX32   system.ArchName = "x32"
+)
+
+// ErrNoSyscallData is returned when the container report has no system call data
+// (the reports collected without the ptrace monitor, e.g., by the node agent)
+var ErrNoSyscallData = errors.New("no system call data in the container report")
+
 var archMap = map[system.ArchName]specs.Arch{
 	system.ArchName386:   specs.ArchX86,
 	system.ArchNameAmd64: specs.ArchX86_64,
+	archNameX32:          specs.ArchX32,
+	archNameArm:          specs.ArchARM,
+	archNameArm64:        specs.ArchAARCH64,
 }
 
-func archNameToSeccompArch(name string) specs.Arch {
-	if arch, ok := archMap[system.ArchName(name)]; ok == true {
-		return arch
+// profileArchitectures returns the seccomp architectures for the target app architecture
+// and for the compat system call ABIs the target app used
+func profileArchitectures(ptReport *report.PtMonitorReport) []specs.Arch {
+	var archList []specs.Arch
+	if arch, ok := archMap[system.ArchName(ptReport.ArchName)]; ok {
+		archList = append(archList, arch)
+	} else {
+		//the native architecture is used if the architecture list is empty
+		log.Warnf("docker-slim: unsupported seccomp architecture - %v", ptReport.ArchName)
+	}
+
+	compatArchs := map[specs.Arch]struct{}{}
+	for _, scInfo := range ptReport.SyscallStats {
+		if scInfo.Arch == "" {
+			continue
+		}
+
+		arch, ok := archMap[system.ArchName(scInfo.Arch)]
+		if !ok {
+			log.Warnf("docker-slim: unsupported seccomp system call ABI - %v", scInfo.Arch)
+			continue
+		}
+
+		if len(archList) > 0 && arch == archList[0] {
+			continue
+		}
+
+		compatArchs[arch] = struct{}{}
 	}
-	return "unknown"
+
+	var compatList []string
+	for arch := range compatArchs {
+		compatList = append(compatList, string(arch))
+	}
+	sort.Strings(compatList)
+
+	for _, arch := range compatList {
+		archList = append(archList, specs.Arch(arch))
+	}
+
+	return archList
 }
 
 var extraCalls = []string{
@@ -42,54 +97,213 @@ var extraCalls = []string{
 	"getgid",
 }
 
-// GenProfile creates a SecComp profile
-func GenProfile(artifactLocation string, profileName string) error {
+const annotatedProfileNamePat = "%s-annotated.json"
+
+// Baseline profile merge modes
+const (
+	MergeModeUnion        = "union"
+	MergeModeIntersection = "intersection"
+)
+
+type baselineProfile struct {
+	Syscalls []struct {
+		Name   string       `json:"name"`
+		Names  []string     `json:"names"`
+		Action specs.Action `json:"action"`
+		Args   []*specs.Arg `json:"args"`
+	} `json:"syscalls"`
+}
+
+// loadBaselineCalls returns the syscalls unconditionally allowed by the baseline profile
+func loadBaselineCalls(baseline string) (map[string]struct{}, error) {
+	calls := map[string]struct{}{}
+
+	if baseline == DockerDefaultBaseline {
+		for _, name := range dockerDefaultCalls {
+			calls[name] = struct{}{}
+		}
+
+		return calls, nil
+	}
+
+	profileData, err := ioutil.ReadFile(baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile baselineProfile
+	if err := json.Unmarshal(profileData, &profile); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range profile.Syscalls {
+		//rules with argument filters are too specific to be merged
+		if rule.Action != specs.ActAllow || len(rule.Args) > 0 {
+			continue
+		}
+
+		if rule.Name != "" {
+			calls[rule.Name] = struct{}{}
+		}
+
+		for _, name := range rule.Names {
+			calls[name] = struct{}{}
+		}
+	}
+
+	return calls, nil
+}
+
+// IsMergeMode returns true if the value is a supported baseline profile merge mode
+func IsMergeMode(value string) bool {
+	switch value {
+	case MergeModeUnion, MergeModeIntersection:
+		return true
+	default:
+		return false
+	}
+}
+
+// AnnotatedProfileName returns the name of the annotated variant of the seccomp profile
+func AnnotatedProfileName(profileName string) string {
+	return fmt.Sprintf(annotatedProfileNamePat, strings.TrimSuffix(profileName, ".json"))
+}
+
+// GenProfile creates a SecComp profile (and its annotated variant if annotatedProfileName is not empty)
+func GenProfile(artifactLocation string,
+	profileName string,
+	annotatedProfileName string,
+	merge *config.SeccompMerge) error {
 	containerReportFilePath := filepath.Join(artifactLocation, report.DefaultContainerReportFileName)
 
 	if _, err := os.Stat(containerReportFilePath); err != nil {
 		return err
 	}
-	reportFile, err := os.Open(containerReportFilePath)
+	creport, err := report.LoadContainerReport(containerReportFilePath)
 	if err != nil {
 		return err
 	}
-	defer reportFile.Close()
 
-	var creport report.ContainerReport
-	if err = json.NewDecoder(reportFile).Decode(&creport); err != nil {
-		return err
+	if creport.Monitors.Pt == nil {
+		//never generate a profile without the system call data (it would allow everything)
+		return ErrNoSyscallData
 	}
 
-	profilePath := filepath.Join(artifactLocation, profileName)
-	log.Debug("docker-slim: saving seccomp profile to ", profilePath)
+	//the same system call can be called using different system call ABIs
+	observedCalls := map[string]report.SyscallStatInfo{}
+	compatCalls := map[string][]string{}
+	for _, scInfo := range creport.Monitors.Pt.SyscallStats {
+		if scInfo.Arch != "" {
+			compatCalls[scInfo.Name] = append(compatCalls[scInfo.Name], scInfo.Arch)
+		}
 
-	profile := &specs.Seccomp{
-		DefaultAction: specs.ActErrno,
-		Architectures: []specs.Arch{archNameToSeccompArch(creport.Monitors.Pt.ArchName)},
+		if info, ok := observedCalls[scInfo.Name]; ok {
+			info.Count += scInfo.Count
+			observedCalls[scInfo.Name] = info
+			continue
+		}
+
+		observedCalls[scInfo.Name] = scInfo
+	}
+
+	calls := map[string]string{}
+	for name := range observedCalls {
+		calls[name] = sourceObserved
 	}
 
 	for _, xcall := range extraCalls {
-		if _, ok := creport.Monitors.Pt.SyscallStats[xcall]; !ok {
-			creport.Monitors.Pt.SyscallStats[xcall] = report.SyscallStatInfo{Name: xcall}
+		if _, ok := calls[xcall]; !ok {
+			calls[xcall] = sourceExtra
 		}
 	}
 
-	for _, scInfo := range creport.Monitors.Pt.SyscallStats {
+	if merge != nil && merge.Baseline != "" {
+		log.Debugf("docker-slim: merging seccomp profile with baseline - %v (%v)", merge.Baseline, merge.Mode)
+		baselineCalls, err := loadBaselineCalls(merge.Baseline)
+		if err != nil {
+			return err
+		}
+
+		switch merge.Mode {
+		case MergeModeIntersection:
+			for name := range calls {
+				if _, ok := baselineCalls[name]; !ok {
+					delete(calls, name)
+				}
+			}
+		default:
+			for name := range baselineCalls {
+				if _, ok := calls[name]; !ok {
+					calls[name] = sourceBaseline
+				}
+			}
+		}
+	}
+
+	categoryNames := map[string][]string{}
+	for name := range calls {
+		category := SyscallCategory(name)
+		categoryNames[category] = append(categoryNames[category], name)
+	}
+
+	architectures := profileArchitectures(creport.Monitors.Pt)
+
+	profile := newProfile(architectures)
+	for _, category := range categoryOrder {
+		names := categoryNames[category]
+		if len(names) == 0 {
+			continue
+		}
+
+		sort.Strings(names)
 		profile.Syscalls = append(profile.Syscalls, &specs.Syscall{
-			Name:   scInfo.Name,
-			Action: specs.ActAllow,
+			Names:   names,
+			Action:  specs.ActAllow,
+			Comment: fmt.Sprintf("%s: %s", category, categoryDescriptions[category]),
 		})
 	}
 
-	profileData, err := json.MarshalIndent(profile, "", "  ")
-	if err != nil {
+	profilePath := filepath.Join(artifactLocation, profileName)
+	log.Debug("docker-slim: saving seccomp profile to ", profilePath)
+
+	if err := saveProfile(profilePath, profile); err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(profilePath, profileData, 0644)
+	if annotatedProfileName == "" {
+		return nil
+	}
+
+	activity := newAppActivity(creport)
+	annotatedProfile := newProfile(architectures)
+	for _, category := range categoryOrder {
+		for _, name := range categoryNames[category] {
+			annotatedProfile.Syscalls = append(annotatedProfile.Syscalls, &specs.Syscall{
+				Name:    name,
+				Action:  specs.ActAllow,
+				Comment: activity.annotate(name, category, calls[name], observedCalls[name], compatCalls[name]),
+			})
+		}
+	}
+
+	annotatedProfilePath := filepath.Join(artifactLocation, annotatedProfileName)
+	log.Debug("docker-slim: saving annotated seccomp profile to ", annotatedProfilePath)
+
+	return saveProfile(annotatedProfilePath, annotatedProfile)
+}
+
+func newProfile(architectures []specs.Arch) *specs.Seccomp {
+	return &specs.Seccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: architectures,
+	}
+}
+
+func saveProfile(profilePath string, profile *specs.Seccomp) error {
+	profileData, err := json.MarshalIndent(profile, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return ioutil.WriteFile(profilePath, profileData, 0644)
 }
@@ -0,0 +1,160 @@
+package sensorbin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// BinNamePat is the name pattern of the embedded sensor binaries
+// (the checksum file has the same name with the '.sha256' extension)
+const BinNamePat = "docker-slim-sensor-%v"
+
+const (
+	binDir        = "bin"
+	checksumExt   = ".sha256"
+	digestLen     = 12
+	tmpFilePrefix = ".docker-slim-sensor-"
+)
+
+// ErrNotEmbedded is returned when docker-slim doesn't have the embedded sensor for the architecture
+var ErrNotEmbedded = errors.New("no embedded sensor")
+
+// ErrBadChecksum is returned when the embedded sensor doesn't match its checksum (a broken docker-slim build)
+var ErrBadChecksum = errors.New("embedded sensor checksum mismatch")
+
+// the sensor binaries are copied to the 'bin' directory by the release builds
+//
+//go:embed bin
+var binFS embed.FS
+
+// Archs returns the architectures of the embedded sensors
+func Archs() []string {
+	entries, err := binFS.ReadDir(binDir)
+	if err != nil {
+		return nil
+	}
+
+	prefix := fmt.Sprintf(BinNamePat, "")
+	var archs []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, prefix) && !strings.HasSuffix(name, checksumExt) {
+			archs = append(archs, strings.TrimPrefix(name, prefix))
+		}
+	}
+
+	sort.Strings(archs)
+	return archs
+}
+
+// Has returns true if docker-slim has the embedded sensor for the architecture
+func Has(arch string) bool {
+	_, err := binFS.Open(binPath(arch))
+	return err == nil
+}
+
+// Extract extracts the embedded sensor for the architecture to the state directory and returns its path.
+// The embedded sensor is verified with its checksum. The extracted sensors are keyed by their digest,
+// so they are reused by the next runs (they are extracted again if they are changed or removed).
+func Extract(arch, statePath string) (string, error) {
+	data, err := binFS.ReadFile(binPath(arch))
+	if err != nil {
+		return "", ErrNotEmbedded
+	}
+
+	digest, err := verify(arch, data)
+	if err != nil {
+		return "", err
+	}
+
+	sensorsLocation, err := fsutils.PrepareSensorsDir(statePath)
+	if err != nil {
+		return "", err
+	}
+
+	location := filepath.Join(sensorsLocation, digest[:digestLen])
+	sensorPath := filepath.Join(location, fmt.Sprintf(BinNamePat, arch))
+	if extracted, err := ioutil.ReadFile(sensorPath); err == nil {
+		if fileDigest := sha256.Sum256(extracted); hex.EncodeToString(fileDigest[:]) == digest {
+			log.Debugf("sensorbin.Extract(%v): reusing %v", arch, sensorPath)
+			return sensorPath, nil
+		}
+
+		log.Debugf("sensorbin.Extract(%v): the extracted sensor is changed (extracting it again)", arch)
+	}
+
+	if err := os.MkdirAll(location, 0777); err != nil {
+		return "", err
+	}
+
+	//the sensor is renamed, so the concurrent runs never use a partially written sensor
+	tmpFile, err := ioutil.TempFile(location, tmpFilePrefix)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), 0755)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), sensorPath)
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	log.Debugf("sensorbin.Extract(%v): extracted %v", arch, sensorPath)
+	return sensorPath, nil
+}
+
+// verify checks the embedded sensor with its checksum file (the 'sha256sum' output format)
+// and returns the sensor digest
+func verify(arch string, data []byte) (string, error) {
+	checksumData, err := binFS.ReadFile(binPath(arch) + checksumExt)
+	if err != nil {
+		return "", fmt.Errorf("%v (%v) - no checksum", ErrBadChecksum, arch)
+	}
+
+	fields := strings.Fields(string(checksumData))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%v (%v) - empty checksum", ErrBadChecksum, arch)
+	}
+
+	expected, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return "", fmt.Errorf("%v (%v) - %v", ErrBadChecksum, arch, err)
+	}
+
+	digest := sha256.Sum256(data)
+	if !bytes.Equal(digest[:], expected) {
+		return "", fmt.Errorf("%v (%v)", ErrBadChecksum, arch)
+	}
+
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func binPath(arch string) string {
+	//embed.FS paths always use forward slashes
+	return binDir + "/" + fmt.Sprintf(BinNamePat, arch)
+}
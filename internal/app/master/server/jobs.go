@@ -0,0 +1,574 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Job commands
+const (
+	CommandBuild   = "build"
+	CommandProfile = "profile"
+	CommandInfo    = "info"
+)
+
+// Job states
+const (
+	JobStateQueued  = "queued"
+	JobStateRunning = "running"
+	JobStateDone    = "done"
+	JobStateFailed  = "failed"
+)
+
+// Job file names (in the job directory)
+const (
+	jobInfoFileName   = "job.json"
+	jobReportFileName = "report.json"
+	jobOutputFileName = "output.log"
+	jobArtifactsDir   = "artifacts"
+)
+
+const maxQueuedJobs = 256
+
+// ErrQueueFull is returned when there are too many queued jobs
+var ErrQueueFull = errors.New("too many queued jobs")
+
+// jobFlags are the command options the jobs can use (the value is true if the option has a value).
+// The jobs come from the API clients and from the image lists, so the options that use
+// the host files or run the host commands (e.g., --mount, --from-report, --exec-file,
+// --host-exec-before-monitor and --host-exec-after-monitor) are not allowed.
+var jobFlags = map[string]bool{
+	"http-probe":                false,
+	"p":                         false,
+	"http-probe-cmd":            true,
+	"http-probe-host":           true,
+	"show-clogs":                false,
+	"show-blogs":                false,
+	"remove-file-artifacts":     false,
+	"r":                         false,
+	"tag":                       true,
+	"image-overrides":           true,
+	"verify-profiles":           false,
+	"verify-image":              false,
+	"timeout-image-build":       true,
+	"entrypoint":                true,
+	"cmd":                       true,
+	"workdir":                   true,
+	"env":                       true,
+	"link":                      true,
+	"etc-hosts-map":             true,
+	"container-dns":             true,
+	"container-dns-search":      true,
+	"container-name":            true,
+	"container-label":           true,
+	"network":                   true,
+	"hostname":                  true,
+	"expose":                    true,
+	"auto-expose":               false,
+	"max-size":                  true,
+	"min-reduction":             true,
+	"fail-on":                   true,
+	"output-base":               true,
+	"layers":                    true,
+	"app-path":                  true,
+	"exclude-mounts":            false,
+	"exclude-path":              true,
+	"include-path":              true,
+	"include-distro":            false,
+	"include-tzdata":            false,
+	"include-locales":           true,
+	"continue-after":            true,
+	"preset":                    true,
+	"target-restarts":           true,
+	"timeout-container-start":   true,
+	"timeout-app-ready":         true,
+	"timeout-monitor":           true,
+	"timeout-sensor-done":       true,
+	"timeout-artifact-copy":     true,
+	"compress-artifacts":        false,
+	"sensor-ptrace-sample-rate": true,
+	"sensor-event-queue-size":   true,
+	"sensor-nice":               true,
+	"ipc-transport":             true,
+	"sensor-delivery":           true,
+	"exec-redact":               true,
+	"seccomp-merge-mode":        true,
+	"seccomp-annotate":          false,
+	"removed-files-gzip":        false,
+	"analysis-cache":            false,
+	"cache-artifacts":           false,
+	"incremental":               false,
+	"dry-run":                   false,
+	"k8s-patch":                 false,
+	"k8s-workload":              true,
+	"k8s-container":             true,
+}
+
+// Job is one build, profile or info command run
+type Job struct {
+	ID               string     `json:"id"`
+	Command          string     `json:"command"`
+	Image            string     `json:"image"`
+	Args             []string   `json:"args,omitempty"`
+	FromReport       string     `json:"from_report,omitempty"`
+	State            string     `json:"state"`
+	ExitCode         int        `json:"exit_code"`
+	Error            string     `json:"error,omitempty"`
+	Created          time.Time  `json:"created"`
+	Started          *time.Time `json:"started,omitempty"`
+	Finished         *time.Time `json:"finished,omitempty"`
+	MinifiedImage    string     `json:"minified_image,omitempty"`
+	ArtifactLocation string     `json:"artifact_location,omitempty"`
+}
+
+// JobRequest contains the parameters for a new job
+// (FromReport is set only by the server, e.g., for the node agent profiles)
+type JobRequest struct {
+	Command    string   `json:"command"`
+	Image      string   `json:"image"`
+	Args       []string `json:"args,omitempty"`
+	FromReport string   `json:"-"`
+}
+
+// jobReport contains the command report fields the job runner uses
+type jobReport struct {
+	State            string `json:"state"`
+	Error            string `json:"error"`
+	MinifiedImage    string `json:"minified_image"`
+	ArtifactLocation string `json:"artifact_location"`
+}
+
+// JobRunner runs the jobs with the docker-slim executable (one process per job)
+// and keeps the job results in the jobs state directory
+type JobRunner struct {
+	exePath    string
+	globalArgs []string
+	location   string
+	jobs       map[string]*Job
+	queue      chan *Job
+	pending    sync.WaitGroup
+	lock       sync.Mutex
+}
+
+// NewJobRunner creates a new job runner and loads the jobs from the previous runs
+func NewJobRunner(statePath string, globalArgs []string) (*JobRunner, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := fsutils.PrepareJobsDir(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	runner := &JobRunner{
+		exePath:    exePath,
+		globalArgs: globalArgs,
+		location:   location,
+		jobs:       map[string]*Job{},
+		queue:      make(chan *Job, maxQueuedJobs),
+	}
+
+	if err := runner.load(); err != nil {
+		return nil, err
+	}
+
+	return runner, nil
+}
+
+// Start starts the job workers
+func (r *JobRunner) Start(workerCount int) {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+
+	for idx := 0; idx < workerCount; idx++ {
+		go func() {
+			for job := range r.queue {
+				r.run(job)
+				r.pending.Done()
+			}
+		}()
+	}
+}
+
+// Submit validates the job request and queues a new job
+// (it fails if there are too many queued jobs)
+func (r *JobRunner) Submit(req *JobRequest) (*Job, error) {
+	return r.submit(req, false)
+}
+
+// Queue validates the job request and queues a new job
+// (it waits if there are too many queued jobs)
+func (r *JobRunner) Queue(req *JobRequest) (*Job, error) {
+	return r.submit(req, true)
+}
+
+// Wait waits until all submitted jobs are done
+func (r *JobRunner) Wait() {
+	r.pending.Wait()
+}
+
+func (r *JobRunner) submit(req *JobRequest, wait bool) (*Job, error) {
+	switch req.Command {
+	case CommandBuild, CommandProfile, CommandInfo:
+	default:
+		return nil, fmt.Errorf("unsupported command - %q (use build, profile or info)", req.Command)
+	}
+
+	if req.Image == "" {
+		return nil, errors.New("no image")
+	}
+
+	if strings.HasPrefix(req.Image, "-") {
+		return nil, fmt.Errorf("bad image name - %q", req.Image)
+	}
+
+	if err := CheckJobArgs(req.Args); err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:         newJobID(),
+		Command:    req.Command,
+		Image:      req.Image,
+		Args:       req.Args,
+		FromReport: req.FromReport,
+		State:      JobStateQueued,
+		Created:    time.Now().UTC(),
+	}
+
+	if err := os.MkdirAll(r.jobLocation(job.ID), 0777); err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	r.jobs[job.ID] = job
+	r.lock.Unlock()
+	r.save(job)
+
+	r.pending.Add(1)
+	if wait {
+		r.queue <- job
+		return r.Job(job.ID), nil
+	}
+
+	select {
+	case r.queue <- job:
+	default:
+		r.finish(job, errutils.ExitCodeError, ErrQueueFull.Error(), nil)
+		r.pending.Done()
+		return nil, ErrQueueFull
+	}
+
+	return r.Job(job.ID), nil
+}
+
+// Jobs returns all jobs (the newest jobs first)
+func (r *JobRunner) Jobs() []*Job {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var jobs []*Job
+	for _, job := range r.jobs {
+		jobCopy := *job
+		jobs = append(jobs, &jobCopy)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.After(jobs[j].Created)
+	})
+
+	return jobs
+}
+
+// Job returns a copy of the job info (or nil if the job doesn't exist)
+func (r *JobRunner) Job(id string) *Job {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil
+	}
+
+	jobCopy := *job
+	return &jobCopy
+}
+
+// ReportPath returns the command report location for the job
+func (r *JobRunner) ReportPath(id string) string {
+	return filepath.Join(r.jobLocation(id), jobReportFileName)
+}
+
+// OutputPath returns the console output location for the job
+func (r *JobRunner) OutputPath(id string) string {
+	return filepath.Join(r.jobLocation(id), jobOutputFileName)
+}
+
+// ArtifactsPath returns the location of the artifacts saved for the job
+func (r *JobRunner) ArtifactsPath(id string) string {
+	return filepath.Join(r.jobLocation(id), jobArtifactsDir)
+}
+
+// Artifacts returns the names of the artifacts saved for the job
+func (r *JobRunner) Artifacts(id string) []string {
+	files, err := ioutil.ReadDir(r.ArtifactsPath(id))
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, info := range files {
+		if info.Mode().IsRegular() {
+			names = append(names, info.Name())
+		}
+	}
+
+	return names
+}
+
+func (r *JobRunner) jobLocation(id string) string {
+	return filepath.Join(r.location, id)
+}
+
+func (r *JobRunner) load() error {
+	dirs, err := ioutil.ReadDir(r.location)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(r.location, dir.Name(), jobInfoFileName))
+		if err != nil {
+			log.Debugf("server.JobRunner.load: skipping %v - %v", dir.Name(), err)
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Warnf("server.JobRunner.load: bad job info in %v - %v", dir.Name(), err)
+			continue
+		}
+
+		r.jobs[job.ID] = &job
+		if job.State == JobStateQueued || job.State == JobStateRunning {
+			//the jobs from the previous server run can't be resumed
+			r.finish(&job, errutils.ExitCodeError, "interrupted (server restarted)", nil)
+		}
+	}
+
+	return nil
+}
+
+func (r *JobRunner) save(job *Job) {
+	r.lock.Lock()
+	data, err := json.MarshalIndent(job, "", "  ")
+	r.lock.Unlock()
+
+	if err != nil {
+		log.Warnf("server.JobRunner.save: error encoding job %v - %v", job.ID, err)
+		return
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(r.jobLocation(job.ID), jobInfoFileName), data, 0644); err != nil {
+		log.Warnf("server.JobRunner.save: error saving job %v - %v", job.ID, err)
+	}
+}
+
+func (r *JobRunner) finish(job *Job, exitCode int, errorText string, cmdReport *jobReport) {
+	now := time.Now().UTC()
+
+	r.lock.Lock()
+	job.Finished = &now
+	job.ExitCode = exitCode
+	job.Error = errorText
+	job.State = JobStateDone
+	if exitCode != errutils.ExitCodeOk {
+		job.State = JobStateFailed
+	}
+
+	if cmdReport != nil {
+		job.MinifiedImage = cmdReport.MinifiedImage
+		job.ArtifactLocation = cmdReport.ArtifactLocation
+		if job.Error == "" {
+			job.Error = cmdReport.Error
+		}
+	}
+	r.lock.Unlock()
+
+	r.save(job)
+}
+
+func (r *JobRunner) run(job *Job) {
+	now := time.Now().UTC()
+
+	r.lock.Lock()
+	job.State = JobStateRunning
+	job.Started = &now
+	r.lock.Unlock()
+	r.save(job)
+
+	log.Infof("server: running job %v (%v %v)", job.ID, job.Command, job.Image)
+
+	output, err := os.Create(r.OutputPath(job.ID))
+	if err != nil {
+		r.finish(job, errutils.ExitCodeError, err.Error(), nil)
+		return
+	}
+	defer output.Close()
+
+	cmd := exec.Command(r.exePath, jobCommandArgs(r.globalArgs, r.ReportPath(job.ID), job)...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	exitCode := errutils.ExitCodeOk
+	var errorText string
+	if err := cmd.Run(); err != nil {
+		exitCode = errutils.ExitCodeError
+		errorText = err.Error()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	cmdReport := r.loadReport(job.ID)
+	if cmdReport != nil && cmdReport.ArtifactLocation != "" {
+		if err := copyArtifacts(cmdReport.ArtifactLocation, r.ArtifactsPath(job.ID)); err != nil {
+			log.Warnf("server: error saving the artifacts for job %v - %v", job.ID, err)
+		}
+	}
+
+	r.finish(job, exitCode, errorText, cmdReport)
+	log.Infof("server: job %v is done (exit code: %v)", job.ID, exitCode)
+}
+
+func (r *JobRunner) loadReport(id string) *jobReport {
+	data, err := ioutil.ReadFile(r.ReportPath(id))
+	if err != nil {
+		return nil
+	}
+
+	var cmdReport jobReport
+	if err := json.Unmarshal(data, &cmdReport); err != nil {
+		return nil
+	}
+
+	return &cmdReport
+}
+
+// jobCommandArgs creates the docker-slim command line for the job
+// (the job reports are always saved in the JSON format and the console output is a JSON event stream)
+func jobCommandArgs(globalArgs []string, reportPath string, job *Job) []string {
+	args := append([]string{}, globalArgs...)
+	args = append(args,
+		"--report", reportPath,
+		"--report-format", "json",
+		"--console-format", "json",
+		job.Command)
+
+	args = append(args, job.Args...)
+	if job.FromReport != "" {
+		args = append(args, "--from-report", job.FromReport)
+	}
+
+	if job.Command != CommandInfo && !hasFlag(job.Args, "--continue-after") {
+		//there's no one to press <enter> in the serve mode
+		continueAfter := "timeout"
+		if hasFlag(job.Args, "--http-probe") || hasFlag(job.Args, "-p") {
+			continueAfter = "probe"
+		}
+
+		args = append(args, "--continue-after", continueAfter)
+	}
+
+	return append(args, job.Image)
+}
+
+// CheckJobArgs returns an error if the job command options have an option the jobs can't use
+// (or an argument that is not an option)
+func CheckJobArgs(args []string) error {
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			return fmt.Errorf("unexpected job argument - %q (the image is a separate job parameter)", arg)
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		hasValue := strings.Contains(name, "=")
+		name = strings.SplitN(name, "=", 2)[0]
+
+		withValue, ok := jobFlags[name]
+		if !ok {
+			return fmt.Errorf("unsupported job option - %q", "--"+name)
+		}
+
+		if withValue && !hasValue {
+			if idx+1 == len(args) {
+				return fmt.Errorf("no value for the job option - %q", arg)
+			}
+
+			idx++
+		}
+	}
+
+	return nil
+}
+
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyArtifacts copies the generated artifact files (the 'files' directory with the kept files is not copied)
+// because the artifact location is reused by the next run for the same image
+func copyArtifacts(artifactLocation, dst string) error {
+	files, err := ioutil.ReadDir(artifactLocation)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range files {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		if err := fsutils.CopyRegularFile(filepath.Join(artifactLocation, info.Name()), filepath.Join(dst, info.Name()), true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newJobID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
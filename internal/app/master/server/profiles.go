@@ -0,0 +1,145 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ProfilesPath is the API path for the node agent profiles
+const ProfilesPath = APIPrefix + "/profiles"
+
+// Profile parameters (the query parameters of the profile upload request)
+const (
+	ProfileParamImage     = "image"
+	ProfileParamNode      = "node"
+	ProfileParamPod       = "pod"
+	ProfileParamContainer = "container"
+	ProfileParamBuildArg  = "arg"
+)
+
+const (
+	profileInfoFileName = "profile.json"
+	maxProfileSize      = 1 << 30
+)
+
+// Profile is the container monitoring profile a node agent uploads
+// (the profile has the same artifacts the sensor saves, so the minified image is built offline)
+type Profile struct {
+	ID        string    `json:"id"`
+	Image     string    `json:"image"`
+	Node      string    `json:"node,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Received  time.Time `json:"received"`
+	JobID     string    `json:"job_id,omitempty"`
+}
+
+// handleProfiles receives a node agent profile (POST with the gzipped artifacts tar archive)
+// and submits a build job to create the minified image from the profile artifacts
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method")
+		return
+	}
+
+	if !hasContentType(r, "application/gzip") {
+		writeError(w, http.StatusUnsupportedMediaType, "the profile must be a gzipped tar archive (Content-Type: application/gzip)")
+		return
+	}
+
+	query := r.URL.Query()
+	profile := &Profile{
+		ID:        newJobID(),
+		Image:     query.Get(ProfileParamImage),
+		Node:      query.Get(ProfileParamNode),
+		Pod:       query.Get(ProfileParamPod),
+		Container: query.Get(ProfileParamContainer),
+		Received:  time.Now().UTC(),
+	}
+
+	if profile.Image == "" {
+		writeError(w, http.StatusBadRequest, "no image")
+		return
+	}
+
+	if err := CheckJobArgs(query[ProfileParamBuildArg]); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	location := filepath.Join(s.profilesLocation, profile.ID)
+	if err := s.saveProfileArtifacts(r.Body, location); err != nil {
+		os.RemoveAll(location)
+		writeError(w, http.StatusBadRequest, "bad profile - "+err.Error())
+		return
+	}
+
+	log.Infof("server: received profile %v (image: %v, node: %v, pod: %v)",
+		profile.ID, profile.Image, profile.Node, profile.Pod)
+
+	job, err := s.runner.Submit(&JobRequest{
+		Command:    CommandBuild,
+		Image:      profile.Image,
+		Args:       query[ProfileParamBuildArg],
+		FromReport: location,
+	})
+	if job != nil {
+		profile.JobID = job.ID
+	}
+
+	saveProfileInfo(location, profile)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == ErrQueueFull {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// saveProfileArtifacts extracts the uploaded artifacts and checks that they have the container report
+func (s *Server) saveProfileArtifacts(body io.Reader, location string) error {
+	zr, err := gzip.NewReader(io.LimitReader(body, maxProfileSize))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	if err := os.MkdirAll(location, 0777); err != nil {
+		return err
+	}
+
+	if err := fsutils.ExtractArchive(zr, location); err != nil {
+		return err
+	}
+
+	_, err = report.LoadContainerReport(filepath.Join(location, report.DefaultContainerReportFileName))
+	return err
+}
+
+func saveProfileInfo(location string, profile *Profile) {
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		log.Warnf("server.saveProfileInfo: error encoding profile %v - %v", profile.ID, err)
+		return
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(location, profileInfoFileName), data, 0644); err != nil {
+		log.Warnf("server.saveProfileInfo: error saving profile %v - %v", profile.ID, err)
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// API paths
+const (
+	APIPrefix  = "/api/v1"
+	healthPath = APIPrefix + "/health"
+	jobsPath   = APIPrefix + "/jobs"
+)
+
+const maxRequestSize = 1 << 20
+
+// ErrNoToken is returned when the server would listen on a non-loopback address without an API token
+// (anyone who can submit jobs can run containers)
+var ErrNoToken = errors.New("an API token is required to listen on a non-loopback address")
+
+// Server is the 'serve' mode HTTP/JSON API server
+type Server struct {
+	config           *config.Server
+	runner           *JobRunner
+	profilesLocation string
+	mux              *http.ServeMux
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type healthResponse struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+}
+
+type artifactsResponse struct {
+	Artifacts []string `json:"artifacts"`
+}
+
+// New creates a new API server
+// (the node agent profiles are saved in the profiles location)
+func New(serverConfig *config.Server, runner *JobRunner, profilesLocation string) *Server {
+	s := &Server{
+		config:           serverConfig,
+		runner:           runner,
+		profilesLocation: profilesLocation,
+		mux:              http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc(healthPath, s.handleHealth)
+	s.mux.HandleFunc(jobsPath, s.handleJobs)
+	s.mux.HandleFunc(jobsPath+"/", s.handleJob)
+	s.mux.HandleFunc(ProfilesPath, s.handleProfiles)
+	s.mux.HandleFunc(uiIndexPath, s.handleUIIndex)
+	s.mux.HandleFunc(uiRunPath, s.handleUIRun)
+
+	return s
+}
+
+// Run starts the job workers and serves the API (it returns only when the server fails)
+func (s *Server) Run() error {
+	if s.config.Token == "" && !IsLoopbackAddr(s.config.ListenAddr) {
+		return ErrNoToken
+	}
+
+	s.runner.Start(s.config.MaxJobs)
+
+	log.Infof("server: listening on %v", s.config.ListenAddr)
+	return http.ListenAndServe(s.config.ListenAddr, s)
+}
+
+// ServeHTTP checks the API token and dispatches the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.Token != "" && r.URL.Path != healthPath && !s.isAuthorized(r) {
+		if !strings.HasPrefix(r.URL.Path, APIPrefix+"/") {
+			//the web UI users enter the token as the password
+			w.Header().Set("WWW-Authenticate", `Basic realm="docker-slim"`)
+		}
+
+		writeError(w, http.StatusUnauthorized, "missing or bad API token")
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// isAuthorized returns true if the request has the API token (as a bearer token or as the basic auth password)
+func (s *Server) isAuthorized(r *http.Request) bool {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") &&
+		isToken(strings.TrimPrefix(auth, "Bearer "), s.config.Token) {
+		return true
+	}
+
+	_, password, ok := r.BasicAuth()
+	return ok && isToken(password, s.config.Token)
+}
+
+func isToken(value, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+}
+
+// IsLoopbackAddr returns true if the listen address is a loopback address
+// (the addresses without a host listen on all interfaces)
+func IsLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// hasContentType returns true if the request body has the media type
+// (the browsers can't send the cross-site form requests with the JSON or gzip media types)
+func hasContentType(r *http.Request, mediaType string) bool {
+	value, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && value == mediaType
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &healthResponse{Status: "ok", Version: v.Current()})
+}
+
+// handleJobs lists the jobs (GET) or submits a new job (POST)
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jobs := s.runner.Jobs()
+		if jobs == nil {
+			jobs = []*Job{}
+		}
+
+		writeJSON(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		if !hasContentType(r, "application/json") {
+			writeError(w, http.StatusUnsupportedMediaType, "the job request must be JSON (Content-Type: application/json)")
+			return
+		}
+
+		var req JobRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad job request - "+err.Error())
+			return
+		}
+
+		job, err := s.runner.Submit(&req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if err == ErrQueueFull {
+				status = http.StatusServiceUnavailable
+			}
+
+			writeError(w, status, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, job)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method")
+	}
+}
+
+// handleJob serves the job info and the job results:
+// /jobs/<id>, /jobs/<id>/report, /jobs/<id>/output, /jobs/<id>/artifacts and /jobs/<id>/artifacts/<name>
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, jobsPath), "/"), "/")
+	job := s.runner.Job(parts[0])
+	if job == nil {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		writeJSON(w, http.StatusOK, job)
+	case len(parts) == 2 && parts[1] == "report":
+		serveFile(w, s.runner.ReportPath(job.ID), "application/json")
+	case len(parts) == 2 && parts[1] == "output":
+		serveFile(w, s.runner.OutputPath(job.ID), "application/x-ndjson")
+	case len(parts) == 2 && parts[1] == "artifacts":
+		names := s.runner.Artifacts(job.ID)
+		if names == nil {
+			names = []string{}
+		}
+
+		writeJSON(w, http.StatusOK, &artifactsResponse{Artifacts: names})
+	case len(parts) == 3 && parts[1] == "artifacts":
+		name := parts[2]
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			writeError(w, http.StatusBadRequest, "bad artifact name")
+			return
+		}
+
+		serveFile(w, filepath.Join(s.runner.ArtifactsPath(job.ID), name), "")
+	default:
+		writeError(w, http.StatusNotFound, "unknown job resource")
+	}
+}
+
+func serveFile(w http.ResponseWriter, location, contentType string) {
+	file, err := os.Open(location)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not available")
+		return
+	}
+	defer file.Close()
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+		switch filepath.Ext(location) {
+		case ".json", ".sarif":
+			contentType = "application/json"
+		case ".yaml", ".yml", ".sh", ".tsv", ".log":
+			contentType = "text/plain; charset=utf-8"
+		case ".gz":
+			contentType = "application/gzip"
+		}
+
+		if filepath.Base(location) == "Dockerfile" || filepath.Base(location) == "Dockerfile.fat" {
+			contentType = "text/plain; charset=utf-8"
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	io.Copy(w, file)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &errorResponse{Error: message})
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+)
+
+func newTestServer(t *testing.T, token string) *Server {
+	statePath, err := ioutil.TempDir("", "dslim-server-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(statePath)
+	})
+
+	runner, err := NewJobRunner(statePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(&config.Server{ListenAddr: "127.0.0.1:0", Token: token}, runner, statePath)
+}
+
+func TestServerAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		path     string
+		bearer   string
+		password string
+		status   int
+	}{
+		{name: "no token configured", path: jobsPath, status: http.StatusOK},
+		{name: "health without token", token: "secret", path: healthPath, status: http.StatusOK},
+		{name: "missing token", token: "secret", path: jobsPath, status: http.StatusUnauthorized},
+		{name: "bearer token", token: "secret", path: jobsPath, bearer: "secret", status: http.StatusOK},
+		{name: "bad bearer token", token: "secret", path: jobsPath, bearer: "secret2", status: http.StatusUnauthorized},
+		{name: "token prefix", token: "secret", path: jobsPath, bearer: "sec", status: http.StatusUnauthorized},
+		{name: "basic auth password", token: "secret", path: uiIndexPath, password: "secret", status: http.StatusOK},
+		{name: "bad basic auth password", token: "secret", path: uiIndexPath, password: "nope", status: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, test.token)
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+test.bearer)
+			}
+
+			if test.password != "" {
+				req.SetBasicAuth("user", test.password)
+			}
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %v, got %v (%v)", test.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSubmitJobRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{
+			name:        "form content type",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `{"command": "build", "image": "my/app"}`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:   "no content type",
+			body:   `{"command": "build", "image": "my/app"}`,
+			status: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "unsupported command",
+			contentType: "application/json",
+			body:        `{"command": "run", "image": "my/app"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "hook option",
+			contentType: "application/json",
+			body:        `{"command": "build", "image": "my/app", "args": ["--host-exec-before-monitor", "id"]}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "option as image",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"command": "build", "image": "--mount=/:/host"}`,
+			status:      http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, "")
+
+			req := httptest.NewRequest(http.MethodPost, jobsPath, strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %v, got %v (%v)", test.status, w.Code, w.Body.String())
+			}
+
+			if len(s.runner.Jobs()) != 0 {
+				t.Fatal("unexpected job")
+			}
+		})
+	}
+}
+
+func TestCheckJobArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{name: "no options", ok: true},
+		{name: "bool options", args: []string{"--http-probe", "--show-clogs", "-p"}, ok: true},
+		{name: "value options", args: []string{"--tag", "my/app:slim", "--env=A=B", "--include-path", "/etc/app"}, ok: true},
+		{name: "bool option with value", args: []string{"--http-probe=false"}, ok: true},
+		{name: "missing value", args: []string{"--tag"}},
+		{name: "positional argument", args: []string{"my/app"}},
+		{name: "end of options", args: []string{"--", "my/app"}},
+		{name: "host exec before", args: []string{"--host-exec-before-monitor", "touch /tmp/x"}},
+		{name: "host exec after", args: []string{"--host-exec-after-monitor=touch /tmp/x"}},
+		{name: "exec file", args: []string{"--exec-file", "/etc/shadow"}},
+		{name: "mount", args: []string{"--mount", "/:/host"}},
+		{name: "from report", args: []string{"--from-report", "/tmp"}},
+		{name: "project config", args: []string{"--config=/tmp/project.yaml"}},
+		{name: "sidecar", args: []string{"--sidecar", "my/sidecar"}},
+		{name: "value hides option", args: []string{"--tag", "--mount"}, ok: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckJobArgs(test.args)
+			if test.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !test.ok && err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		loopback bool
+	}{
+		{addr: "127.0.0.1:7070", loopback: true},
+		{addr: "localhost:7070", loopback: true},
+		{addr: "[::1]:7070", loopback: true},
+		{addr: ":7070"},
+		{addr: "0.0.0.0:7070"},
+		{addr: "10.0.0.1:7070"},
+		{addr: "docker-slim.tools:7070"},
+		{addr: "127.0.0.1"},
+	}
+
+	for _, test := range tests {
+		if loopback := IsLoopbackAddr(test.addr); loopback != test.loopback {
+			t.Errorf("%v: expected %v, got %v", test.addr, test.loopback, loopback)
+		}
+	}
+}
+
+func TestJobCommandArgs(t *testing.T) {
+	job := &Job{
+		Command:    CommandBuild,
+		Image:      "my/app",
+		Args:       []string{"--http-probe"},
+		FromReport: "/state/.profiles/1",
+	}
+
+	args := strings.Join(jobCommandArgs([]string{"--state-path", "/state"}, "/state/report.json", job), " ")
+	expected := "--state-path /state --report /state/report.json --report-format json --console-format json build " +
+		"--http-probe --from-report /state/.profiles/1 --continue-after probe my/app"
+	if args != expected {
+		t.Fatalf("unexpected args:\n%v\nexpected:\n%v", args, expected)
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Web UI paths
+const (
+	uiIndexPath = "/"
+	uiRunPath   = "/runs/"
+)
+
+const uiRefreshSeconds = 5
+
+const uiIndexTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{- if .Active}}
+<meta http-equiv="refresh" content="{{.Refresh}}">
+{{- end}}
+<title>docker-slim runs</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+h1 { font-size: 1.6em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #dfe2e5; padding: 4px 10px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+.mono { font-family: SFMono-Regular, Consolas, Menlo, monospace; font-size: .9em; }
+.state-failed { color: #cb2431; font-weight: bold; }
+.state-done { color: #22863a; font-weight: bold; }
+.bar { background: #0366d6; height: .8em; display: inline-block; }
+.muted { color: #6a737d; }
+</style>
+</head>
+<body>
+<h1>docker-slim runs</h1>
+<p>{{.Total}} runs ({{.Done}} done, {{.Failed}} failed, {{.Pending}} queued or running){{if .Saved}}, <b>{{.Saved}}</b> saved by the minified images{{end}}</p>
+{{- if .Runs}}
+<table>
+<tr><th>Run</th><th>Command</th><th>Image</th><th>State</th><th>Original</th><th>Minified</th><th colspan="2">Size savings</th><th>Created</th><th>Duration</th><th></th></tr>
+{{- range .Runs}}
+<tr>
+<td class="mono"><a href="/runs/{{.ID}}">{{.ID}}</a></td>
+<td>{{.Command}}</td>
+<td class="mono">{{.Image}}{{if .MinifiedImage}}<br><span class="muted">&rarr; {{.MinifiedImage}}</span>{{end}}</td>
+<td class="state-{{.State}}">{{.State}}{{if .ExitCode}} ({{.ExitCode}}){{end}}</td>
+<td>{{.OriginalSize}}</td>
+<td>{{.MinifiedSize}}</td>
+<td style="width: 150px">{{if .SavedPercent}}<span class="bar" style="width: {{.SavedPercent}}%"></span>{{end}}</td>
+<td>{{if .SavedPercent}}{{.SavedPercent}}%{{end}}</td>
+<td>{{.Created}}</td>
+<td>{{.Duration}}</td>
+<td><a href="/api/v1/jobs/{{.ID}}/output">output</a></td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">No runs yet. Submit a job with <code>POST /api/v1/jobs</code>.</p>
+{{- end}}
+</body>
+</html>
+`
+
+const uiRunTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{- if .Active}}
+<meta http-equiv="refresh" content="{{.Refresh}}">
+{{- end}}
+<title>docker-slim run {{.Job.ID}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #dfe2e5; padding: 4px 10px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+.mono { font-family: SFMono-Regular, Consolas, Menlo, monospace; font-size: .9em; }
+</style>
+</head>
+<body>
+<p><a href="/">&larr; all runs</a></p>
+<h1>docker-slim run {{.Job.ID}}</h1>
+<table>
+<tr><th>Command</th><td>{{.Job.Command}}</td></tr>
+<tr><th>Image</th><td class="mono">{{.Job.Image}}</td></tr>
+<tr><th>Options</th><td class="mono">{{range .Job.Args}}{{.}} {{end}}</td></tr>
+<tr><th>State</th><td>{{.Job.State}}{{if .Job.Error}} - {{.Job.Error}}{{end}}</td></tr>
+</table>
+<p>No command report yet. See the <a href="/api/v1/jobs/{{.Job.ID}}/output">command output</a>.</p>
+</body>
+</html>
+`
+
+type uiRun struct {
+	*Job
+	OriginalSize string
+	MinifiedSize string
+	SavedPercent int
+	Created      string
+	Duration     string
+}
+
+type uiIndexData struct {
+	Runs    []*uiRun
+	Total   int
+	Done    int
+	Failed  int
+	Pending int
+	Saved   string
+	Active  bool
+	Refresh int
+}
+
+type uiRunData struct {
+	Job     *Job
+	Active  bool
+	Refresh int
+}
+
+var (
+	uiIndexPage = template.Must(template.New("index").Parse(uiIndexTemplate))
+	uiRunPage   = template.Must(template.New("run").Parse(uiRunTemplate))
+)
+
+// handleUIIndex lists the runs with their size savings
+func (s *Server) handleUIIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != uiIndexPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := uiIndexData{Refresh: uiRefreshSeconds}
+	var savedBytes int64
+
+	for _, job := range s.runner.Jobs() {
+		run := &uiRun{
+			Job:     job,
+			Created: job.Created.Local().Format("2006-01-02 15:04:05"),
+		}
+
+		if job.Started != nil && job.Finished != nil {
+			run.Duration = job.Finished.Sub(*job.Started).Round(time.Second).String()
+		}
+
+		switch job.State {
+		case JobStateDone:
+			data.Done++
+		case JobStateFailed:
+			data.Failed++
+		default:
+			data.Pending++
+			data.Active = true
+		}
+
+		if info, err := report.LoadCommandReport(s.runner.ReportPath(job.ID)); err == nil {
+			originalSize, minifiedSize := reportSizes(info)
+			if originalSize > 0 {
+				run.OriginalSize = humanize.Bytes(uint64(originalSize))
+			}
+
+			if minifiedSize > 0 {
+				run.MinifiedSize = humanize.Bytes(uint64(minifiedSize))
+				if originalSize > minifiedSize {
+					run.SavedPercent = int((originalSize - minifiedSize) * 100 / originalSize)
+					savedBytes += originalSize - minifiedSize
+				}
+			}
+		}
+
+		data.Runs = append(data.Runs, run)
+	}
+
+	data.Total = len(data.Runs)
+	if savedBytes > 0 {
+		data.Saved = humanize.Bytes(uint64(savedBytes))
+	}
+
+	writeTemplate(w, uiIndexPage, &data)
+}
+
+// handleUIRun shows the run report (the HTML command report with the links to the job artifacts)
+func (s *Server) handleUIRun(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, uiRunPath), "/")
+	job := s.runner.Job(id)
+	if job == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := report.LoadCommandReport(s.runner.ReportPath(job.ID))
+	if err != nil {
+		writeTemplate(w, uiRunPage, &uiRunData{
+			Job:     job,
+			Active:  job.State == JobStateQueued || job.State == JobStateRunning,
+			Refresh: uiRefreshSeconds,
+		})
+		return
+	}
+
+	page, err := report.HTMLReport(info, &report.HTMLOptions{
+		ArtifactLocation: s.runner.ArtifactsPath(job.ID),
+		ArtifactURL:      fmt.Sprintf("%s/%s/artifacts", jobsPath, job.ID),
+		IndexURL:         uiIndexPath,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+func reportSizes(info interface{}) (int64, int64) {
+	switch cmdReport := info.(type) {
+	case *report.BuildCommand:
+		return cmdReport.OriginalImageSize, cmdReport.MinifiedImageSize
+	case *report.ProfileCommand:
+		return cmdReport.OriginalImageSize, cmdReport.MinifiedImageSize
+	case *report.InfoCommand:
+		return cmdReport.OriginalImageSize, 0
+	}
+
+	return 0, 0
+}
+
+func writeTemplate(w http.ResponseWriter, t *template.Template, data interface{}) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(out.Bytes())
+}
@@ -0,0 +1,169 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+)
+
+// ErrNoPolicy is returned when prune is called without an age or size policy
+var ErrNoPolicy = errors.New("no prune policy (age or size)")
+
+// Image is the saved state for one image (its artifacts and the sensor volume data)
+type Image struct {
+	ID       string    `json:"id"`
+	Location string    `json:"location"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Policy selects the image state to prune:
+// the state not modified for MaxAge and the oldest state above the MaxSize total size
+// (a zero value disables the policy)
+type Policy struct {
+	MaxAge  time.Duration
+	MaxSize int64
+}
+
+// List returns the saved image state (the most recently modified first)
+func List(statePath string) ([]*Image, error) {
+	location := fsutils.StateImagesDir(statePath)
+	entries, err := ioutil.ReadDir(location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var images []*Image
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		image, err := inspect(entry.Name(), filepath.Join(location, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, image)
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Modified.After(images[j].Modified)
+	})
+
+	return images, nil
+}
+
+// inspect calculates the state size and finds its last modification time
+// (the newest file in the state directory)
+func inspect(id, location string) (*Image, error) {
+	image := &Image{
+		ID:       id,
+		Location: location,
+	}
+
+	err := filepath.Walk(location, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			image.Size += info.Size()
+		}
+
+		if info.ModTime().After(image.Modified) {
+			image.Modified = info.ModTime()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// Find returns the saved image state for the image IDs (or their unique prefixes)
+func Find(images []*Image, ids []string) ([]*Image, error) {
+	var found []*Image
+	for _, id := range ids {
+		//images IDs in Docker 1.9+ are prefixed with a hash type...
+		if idx := strings.Index(id, ":"); idx != -1 {
+			id = id[idx+1:]
+		}
+
+		var matches []*Image
+		for _, image := range images {
+			if strings.HasPrefix(image.ID, id) {
+				matches = append(matches, image)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no saved state for image %v", id)
+		case 1:
+			found = append(found, matches[0])
+		default:
+			return nil, fmt.Errorf("ambiguous image ID prefix %v (%v matches)", id, len(matches))
+		}
+	}
+
+	return found, nil
+}
+
+// Select returns the image state matching the prune policy
+// (the images are expected in the List order)
+func Select(images []*Image, policy Policy, now time.Time) ([]*Image, error) {
+	if policy.MaxAge <= 0 && policy.MaxSize <= 0 {
+		return nil, ErrNoPolicy
+	}
+
+	var selected []*Image
+	var keptSize int64
+	var isFull bool
+	for _, image := range images {
+		if policy.MaxAge > 0 && now.Sub(image.Modified) > policy.MaxAge {
+			selected = append(selected, image)
+			continue
+		}
+
+		//the newer images are kept first, so the older images go when the total is too big
+		if policy.MaxSize > 0 && (isFull || keptSize+image.Size > policy.MaxSize) {
+			isFull = true
+			selected = append(selected, image)
+			continue
+		}
+
+		keptSize += image.Size
+	}
+
+	return selected, nil
+}
+
+// Remove removes the saved image state
+func (i *Image) Remove() error {
+	return fsutils.Remove(i.Location)
+}
+
+// TotalSize returns the total size of the saved image state
+func TotalSize(images []*Image) int64 {
+	var size int64
+	for _, image := range images {
+		size += image.Size
+	}
+
+	return size
+}
@@ -0,0 +1,83 @@
+package swarm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/agent"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+
+	docker "github.com/cloudimmunity/go-dockerclientx"
+)
+
+// Swarm task container labels
+const (
+	ServiceLabel = "com.docker.swarm.service.name"
+	TaskLabel    = "com.docker.swarm.task.name"
+)
+
+// ErrRemoteHost is returned when the Docker host is not the local machine
+// (the task container is monitored from the host, so it must run on the local Swarm node)
+var ErrRemoteHost = errors.New("the Swarm service task must run on the local Docker host (the local Swarm node)")
+
+// Task is a running Swarm service task container on the local node
+type Task struct {
+	Name        string
+	ContainerID string
+	ImageID     string
+	Target      *agent.Target
+}
+
+// FindTask returns a running task container of the service on the local Swarm node
+// (the first running task is used if the node runs more than one task of the service)
+func FindTask(client *docker.Client, service string) (*Task, error) {
+	if dockerhost.IsRemote() {
+		return nil, ErrRemoteHost
+	}
+
+	containers, err := client.ListContainers(docker.ListContainersOptions{
+		Filters: map[string][]string{
+			"label":  {fmt.Sprintf("%s=%s", ServiceLabel, service)},
+			"status": {"running"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("no running tasks for the %v service on this node", service)
+	}
+
+	containerInfo, err := client.InspectContainer(containers[0].ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if containerInfo.State.Pid == 0 {
+		return nil, fmt.Errorf("task container %v is not running", containerInfo.ID)
+	}
+
+	task := &Task{
+		Name:        strings.TrimPrefix(containerInfo.Name, "/"),
+		ContainerID: containerInfo.ID,
+		ImageID:     containerInfo.Image,
+		Target: &agent.Target{
+			Container:   strings.TrimPrefix(containerInfo.Name, "/"),
+			ContainerID: containerInfo.ID,
+			ImageID:     containerInfo.Image,
+			Pid:         containerInfo.State.Pid,
+		},
+	}
+
+	if containerInfo.Config != nil {
+		if name := containerInfo.Config.Labels[TaskLabel]; name != "" {
+			task.Name = name
+		}
+
+		task.Target.Image = containerInfo.Config.Image
+	}
+
+	return task, nil
+}
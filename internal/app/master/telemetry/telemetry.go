@@ -0,0 +1,235 @@
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	recordsFileName = "runs.jsonl"
+	sendTimeout     = 5 * time.Second
+	dateFormat      = "2006-01-02"
+)
+
+// Record is an anonymous run record
+// (no image names, container names, paths or host information)
+type Record struct {
+	Date          string `json:"date"`
+	Command       string `json:"command"`
+	Version       string `json:"version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	DurationSec   int64  `json:"duration_sec"`
+	State         string `json:"state"`
+	Success       bool   `json:"success"`
+	SizeReduction string `json:"size_reduction,omitempty"`
+}
+
+// CommandSummary is the local run statistics for a command
+type CommandSummary struct {
+	Command        string
+	Runs           int
+	Succeeded      int
+	Failed         int
+	AvgDurationSec int64
+	// SizeReductions are the run counts for each size reduction bucket
+	SizeReductions map[string]int
+}
+
+// size reduction buckets (the percentage of the original image size removed)
+var reductionBuckets = []struct {
+	limit float64
+	name  string
+}{
+	{25, "0-25%"},
+	{50, "25-50%"},
+	{75, "50-75%"},
+	{90, "75-90%"},
+	{95, "90-95%"},
+	{100, "95-100%"},
+}
+
+// NewRecord creates an anonymous run record
+// (the exact sizes are not recorded, only the size reduction bucket)
+func NewRecord(command, state string, started time.Time, duration time.Duration, originalSize, minifiedSize int64) *Record {
+	return &Record{
+		Date:          started.UTC().Format(dateFormat),
+		Command:       command,
+		Version:       v.Tag(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		DurationSec:   int64(duration.Round(time.Second) / time.Second),
+		State:         state,
+		Success:       state == report.CmdStateCompleted,
+		SizeReduction: ReductionBucket(originalSize, minifiedSize),
+	}
+}
+
+// ReductionBucket returns the size reduction bucket for the image sizes
+// (an empty string if there's no minified image)
+func ReductionBucket(originalSize, minifiedSize int64) string {
+	if originalSize <= 0 || minifiedSize <= 0 {
+		return ""
+	}
+
+	reduction := 100 * (1 - float64(minifiedSize)/float64(originalSize))
+	for _, bucket := range reductionBuckets {
+		if reduction < bucket.limit {
+			return bucket.name
+		}
+	}
+
+	return reductionBuckets[len(reductionBuckets)-1].name
+}
+
+// Report saves the run record in the state path and sends it to the telemetry endpoint (if it's set)
+// (the telemetry errors never fail the run)
+func Report(telemetryConfig *config.Telemetry, record *Record) {
+	if telemetryConfig == nil {
+		return
+	}
+
+	if err := save(telemetryConfig.StatePath, record); err != nil {
+		log.Debugf("telemetry: error saving the run record - %v", err)
+	}
+
+	if telemetryConfig.Endpoint != "" {
+		if err := send(telemetryConfig.Endpoint, record); err != nil {
+			log.Debugf("telemetry: error sending the run record to %v - %v", telemetryConfig.Endpoint, err)
+		}
+	}
+}
+
+func save(statePath string, record *Record) error {
+	location, err := fsutils.PrepareTelemetryDir(statePath)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(location, recordsFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func send(endpoint string, record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: sendTimeout}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status - %v", resp.Status)
+	}
+
+	return nil
+}
+
+// Load returns the local run records from the state path
+// (no records if the telemetry was never enabled)
+func Load(statePath string) ([]*Record, error) {
+	file, err := os.Open(filepath.Join(fsutils.StateTelemetryDir(statePath), recordsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Debugf("telemetry: skipping malformed run record - %v", err)
+			continue
+		}
+
+		records = append(records, &record)
+	}
+
+	return records, scanner.Err()
+}
+
+// Summarize returns the run statistics for each command (sorted by the command name)
+func Summarize(records []*Record) []*CommandSummary {
+	summaries := map[string]*CommandSummary{}
+	totalDurations := map[string]int64{}
+	for _, record := range records {
+		summary, ok := summaries[record.Command]
+		if !ok {
+			summary = &CommandSummary{
+				Command:        record.Command,
+				SizeReductions: map[string]int{},
+			}
+			summaries[record.Command] = summary
+		}
+
+		summary.Runs++
+		if record.Success {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+
+		totalDurations[record.Command] += record.DurationSec
+		if record.SizeReduction != "" {
+			summary.SizeReductions[record.SizeReduction]++
+		}
+	}
+
+	var all []*CommandSummary
+	for command, summary := range summaries {
+		summary.AvgDurationSec = totalDurations[command] / int64(summary.Runs)
+		all = append(all, summary)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Command < all[j].Command
+	})
+
+	return all
+}
+
+// ReductionBuckets returns the size reduction bucket names (from the smallest reduction)
+func ReductionBuckets() []string {
+	var names []string
+	for _, bucket := range reductionBuckets {
+		names = append(names, bucket.name)
+	}
+
+	return names
+}
@@ -0,0 +1,317 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/config"
+	"github.com/docker-slim/docker-slim/pkg/report"
+	v "github.com/docker-slim/docker-slim/pkg/version"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	serviceName      = "docker-slim"
+	tracesPath       = "/v1/traces"
+	exportTimeout    = 10 * time.Second
+	spanKindInternal = 1
+	statusCodeOk     = 1
+	statusCodeError  = 2
+)
+
+// Span is one traced operation
+type Span struct {
+	tracer    *Tracer
+	id        string
+	parentID  string
+	name      string
+	start     time.Time
+	end       time.Time
+	attrs     map[string]string
+	errorText string
+	failed    bool
+}
+
+// Tracer traces the command run phases and exports the spans
+// to an OpenTelemetry collector (OTLP/HTTP with the JSON encoding)
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	traceID  string
+	root     *Span
+	phase    *Span
+	spans    []*Span
+	lock     sync.Mutex
+}
+
+// NewTracer creates a new tracer for a command run
+// (the tracer does nothing if the collector endpoint is not configured)
+func NewTracer(command, image string, tracingConfig *config.Tracing) *Tracer {
+	tracer := &Tracer{
+		traceID: randomID(16),
+	}
+
+	if tracingConfig != nil && tracingConfig.Endpoint != "" {
+		tracer.endpoint = strings.TrimSuffix(tracingConfig.Endpoint, "/")
+		if !strings.HasSuffix(tracer.endpoint, tracesPath) {
+			tracer.endpoint += tracesPath
+		}
+
+		tracer.headers = tracingConfig.Headers
+	}
+
+	tracer.root = tracer.Start(fmt.Sprintf("docker-slim %s", command), nil)
+	tracer.root.SetAttr("docker_slim.command", command)
+	tracer.root.SetAttr("docker_slim.image", image)
+
+	return tracer
+}
+
+// Enabled returns true if the spans are exported
+func (t *Tracer) Enabled() bool {
+	return t.endpoint != ""
+}
+
+// TraceID returns the trace ID for the command run
+func (t *Tracer) TraceID() string {
+	return t.traceID
+}
+
+// Start starts a new span (the command run span is the parent if there's no parent span)
+func (t *Tracer) Start(name string, parent *Span) *Span {
+	span := &Span{
+		tracer: t,
+		id:     randomID(8),
+		name:   name,
+		start:  time.Now(),
+		attrs:  map[string]string{},
+	}
+
+	if parent != nil {
+		span.parentID = parent.id
+	} else if t.root != nil {
+		span.parentID = t.root.id
+	}
+
+	return span
+}
+
+// Phase ends the current phase span and starts a new one
+func (t *Tracer) Phase(name string) *Span {
+	t.lock.Lock()
+	current := t.phase
+	t.lock.Unlock()
+
+	if current != nil {
+		current.End()
+	}
+
+	span := t.Start(name, nil)
+
+	t.lock.Lock()
+	t.phase = span
+	t.lock.Unlock()
+
+	return span
+}
+
+// Finish ends the current phase and the command run spans and exports the spans
+func (t *Tracer) Finish(state string) {
+	t.lock.Lock()
+	current := t.phase
+	t.phase = nil
+	t.lock.Unlock()
+
+	if current != nil {
+		current.End()
+	}
+
+	t.root.SetAttr("docker_slim.state", state)
+	if state == report.CmdStateError {
+		t.root.SetError("command failed")
+	}
+	t.root.End()
+
+	if !t.Enabled() {
+		return
+	}
+
+	if err := t.export(); err != nil {
+		log.Warnf("tracing: error exporting spans to %v - %v", t.endpoint, err)
+	}
+}
+
+// SetAttr adds a span attribute
+func (s *Span) SetAttr(key, value string) {
+	s.attrs[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	s.failed = true
+	s.errorText = message
+}
+
+// End ends the span
+func (s *Span) End() {
+	if !s.end.IsZero() {
+		return
+	}
+
+	s.end = time.Now()
+
+	s.tracer.lock.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.lock.Unlock()
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func (t *Tracer) export() error {
+	t.lock.Lock()
+	var spans []otlpSpan
+	for _, span := range t.spans {
+		spanData := otlpSpan{
+			TraceID:           t.traceID,
+			SpanID:            span.id,
+			ParentSpanID:      span.parentID,
+			Name:              span.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: statusCodeOk},
+		}
+
+		var keys []string
+		for key := range span.attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			spanData.Attributes = append(spanData.Attributes,
+				otlpAttribute{Key: key, Value: otlpValue{StringValue: span.attrs[key]}})
+		}
+
+		if span.failed {
+			spanData.Status = otlpStatus{Code: statusCodeError, Message: span.errorText}
+		}
+
+		spans = append(spans, spanData)
+	}
+	t.lock.Unlock()
+
+	traces := otlpTraces{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpAttribute{
+						{Key: "service.name", Value: otlpValue{StringValue: serviceName}},
+						{Key: "service.version", Value: otlpValue{StringValue: v.Tag()}},
+					},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: serviceName, Version: v.Tag()},
+						Spans: spans,
+					},
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(&traces)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{Timeout: exportTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status - %v", resp.Status)
+	}
+
+	return nil
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	if _, err := rand.Read(id); err != nil {
+		//not unique, but still valid
+		id[0] = 1
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,514 @@
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/netutils"
+)
+
+// Release channels
+const (
+	ChannelStable     = "stable"
+	ChannelPrerelease = "prerelease"
+)
+
+// Release asset and binary names
+const (
+	ChecksumsName     = "SHA256SUMS"
+	SignatureName     = "SHA256SUMS.sig"
+	linuxPackage      = "dist_linux.tar.gz"
+	linuxArm64Package = "dist_linux_arm64.tar.gz"
+	macPackage        = "dist_mac.zip"
+	masterBinName     = "docker-slim"
+	sensorBinName     = "docker-slim-sensor"
+	newBinSuffix      = ".new"
+	oldBinSuffix      = ".old"
+	releasesURL       = "https://api.github.com/repos/docker-slim/docker-slim/releases"
+	maxPackageSize    = 500 << 20
+	maxChecksumsSize  = 1 << 20
+)
+
+// releaseKeyData is the public key (base64 encoded Ed25519 key) for the release checksum signatures
+// (the release build signs the SHA256SUMS file with the private key, see scripts/src.build.sh)
+const releaseKeyData = "LLeOa0PwcvHgFsJNwCobZHWmz41GAX2qaXRxOMTnrhQ="
+
+var releaseKey = mustDecodeKey(releaseKeyData)
+
+func mustDecodeKey(data string) ed25519.PublicKey {
+	key, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		panic("update: bad release key")
+	}
+
+	return ed25519.PublicKey(key)
+}
+
+const downloadTimeout = 10 * time.Minute
+
+var (
+	// ErrNoChecksums is returned when the release doesn't have the package checksums
+	ErrNoChecksums = errors.New("no package checksums in the release")
+	// ErrNoSignature is returned when the release doesn't have the checksum signature
+	ErrNoSignature = errors.New("no checksum signature in the release")
+	// ErrBadSignature is returned when the checksum signature doesn't match the release key
+	ErrBadSignature = errors.New("bad checksum signature")
+	// ErrBadChecksum is returned when the downloaded package doesn't match its checksum
+	ErrBadChecksum = errors.New("package checksum mismatch")
+	// ErrUnsupportedPlatform is returned when there's no release package for the current OS and architecture
+	ErrUnsupportedPlatform = fmt.Errorf("no release package for %v/%v", runtime.GOOS, runtime.GOARCH)
+
+	errNoPackageFile = errors.New("binary is not in the release package")
+)
+
+// Asset is a release file
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// Release is a docker-slim release
+type Release struct {
+	Tag        string    `json:"tag_name"`
+	Name       string    `json:"name"`
+	URL        string    `json:"html_url"`
+	Draft      bool      `json:"draft"`
+	Prerelease bool      `json:"prerelease"`
+	Published  time.Time `json:"published_at"`
+	Assets     []Asset   `json:"assets"`
+}
+
+// Asset returns the release file with the given name (or nil if the release doesn't have it)
+func (r *Release) Asset(name string) *Asset {
+	for idx := range r.Assets {
+		if r.Assets[idx].Name == name {
+			return &r.Assets[idx]
+		}
+	}
+
+	return nil
+}
+
+// LatestRelease returns the latest release in the release channel
+// (the prerelease channel includes the stable releases too)
+func LatestRelease(channel string, timeout time.Duration) (*Release, error) {
+	client := &http.Client{Timeout: timeout}
+
+	switch channel {
+	case ChannelStable:
+		var release Release
+		if err := getJSON(client, releasesURL+"/latest", &release); err != nil {
+			return nil, err
+		}
+
+		return &release, nil
+	case ChannelPrerelease:
+		var releases []Release
+		if err := getJSON(client, releasesURL, &releases); err != nil {
+			return nil, err
+		}
+
+		for idx := range releases {
+			if !releases[idx].Draft {
+				return &releases[idx], nil
+			}
+		}
+
+		return nil, errors.New("no releases")
+	default:
+		return nil, fmt.Errorf("unknown release channel - %q (use %v or %v)", channel, ChannelStable, ChannelPrerelease)
+	}
+}
+
+// IsNewer returns true if the latest release tag is newer than the current version tag
+// (if one of the tags is not a release version, e.g., a development build, the tags are just compared)
+func IsNewer(current, latest string) bool {
+	currentParts, currentOk := parseVersion(current)
+	latestParts, latestOk := parseVersion(latest)
+	if !currentOk || !latestOk {
+		return current != latest
+	}
+
+	for idx := 0; idx < len(currentParts) || idx < len(latestParts); idx++ {
+		var currentPart, latestPart int
+		if idx < len(currentParts) {
+			currentPart = currentParts[idx]
+		}
+
+		if idx < len(latestParts) {
+			latestPart = latestParts[idx]
+		}
+
+		if currentPart != latestPart {
+			return latestPart > currentPart
+		}
+	}
+
+	return false
+}
+
+// parseVersion parses the version tags (e.g., '1.26.1', 'v1.26' or '1.26.1-5-gabcdef' from 'git describe')
+func parseVersion(tag string) ([]int, bool) {
+	tag = strings.TrimPrefix(tag, "v")
+	if idx := strings.Index(tag, "-"); idx != -1 {
+		tag = tag[:idx]
+	}
+
+	var parts []int
+	for _, field := range strings.Split(tag, ".") {
+		part, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts, true
+}
+
+// PackageName returns the release package name for the current OS and architecture
+func PackageName() (string, error) {
+	switch {
+	case runtime.GOOS == "linux" && runtime.GOARCH == "amd64":
+		return linuxPackage, nil
+	case runtime.GOOS == "linux" && runtime.GOARCH == "arm64":
+		return linuxArm64Package, nil
+	case runtime.GOOS == "darwin" && runtime.GOARCH == "amd64":
+		return macPackage, nil
+	}
+
+	return "", ErrUnsupportedPlatform
+}
+
+// Install downloads the release package, verifies its checksum and replaces the docker-slim
+// and docker-slim-sensor binaries in the target directory. The checksum file is trusted only
+// if its signature matches the embedded release key. All binaries are extracted and verified
+// before they are replaced and the replaced binaries are restored if one of them can't be replaced,
+// so a failed update doesn't leave mismatched binaries behind.
+func Install(release *Release, targetDir string) error {
+	packageName, err := PackageName()
+	if err != nil {
+		return err
+	}
+
+	packageAsset := release.Asset(packageName)
+	if packageAsset == nil {
+		return fmt.Errorf("no %v package in release %v", packageName, release.Tag)
+	}
+
+	checksumsAsset := release.Asset(ChecksumsName)
+	if checksumsAsset == nil {
+		return ErrNoChecksums
+	}
+
+	signatureAsset := release.Asset(SignatureName)
+	if signatureAsset == nil {
+		return ErrNoSignature
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	checksums, err := getChecksums(client, checksumsAsset.URL, signatureAsset.URL)
+	if err != nil {
+		return err
+	}
+
+	expected, ok := checksums[packageName]
+	if !ok {
+		return fmt.Errorf("%v: no checksum for %v", ChecksumsName, packageName)
+	}
+
+	packageFile, err := ioutil.TempFile(targetDir, ".docker-slim-update-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(packageFile.Name())
+	defer packageFile.Close()
+
+	hash := sha256.New()
+	if err := download(client, packageAsset.URL, io.MultiWriter(packageFile, hash)); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != expected {
+		return ErrBadChecksum
+	}
+
+	binNames := []string{sensorBinName, masterBinName}
+	var newBinPaths []string
+	defer func() {
+		for _, newBinPath := range newBinPaths {
+			os.Remove(newBinPath)
+		}
+	}()
+
+	for _, binName := range binNames {
+		newBinPath := filepath.Join(targetDir, binName+newBinSuffix)
+		newBinPaths = append(newBinPaths, newBinPath)
+
+		if err := extractFile(packageFile.Name(), packageName, binName, newBinPath); err != nil {
+			if err == errNoPackageFile {
+				return fmt.Errorf("no %v in the release package", binName)
+			}
+
+			return err
+		}
+	}
+
+	//the architecture specific sensors are in the newer release packages only
+	for _, arch := range container.SensorArchs {
+		binName := fmt.Sprintf(container.SensorBinArchPat, arch)
+		newBinPath := filepath.Join(targetDir, binName+newBinSuffix)
+		if err := extractFile(packageFile.Name(), packageName, binName, newBinPath); err != nil {
+			os.Remove(newBinPath)
+			if err == errNoPackageFile {
+				continue
+			}
+
+			return err
+		}
+
+		binNames = append(binNames, binName)
+		newBinPaths = append(newBinPaths, newBinPath)
+	}
+
+	return replaceFiles(targetDir, binNames)
+}
+
+// replaceFiles replaces the binaries with the extracted new binaries (the '.new' files).
+// The current binaries are renamed to the '.old' backup files first and they are restored
+// if one of the new binaries can't be installed. The backup files are removed when all binaries are replaced.
+func replaceFiles(targetDir string, binNames []string) (err error) {
+	var replaced []string
+	defer func() {
+		if err == nil {
+			for _, binName := range replaced {
+				os.Remove(filepath.Join(targetDir, binName+oldBinSuffix))
+			}
+
+			return
+		}
+
+		for idx := len(replaced) - 1; idx >= 0; idx-- {
+			binPath := filepath.Join(targetDir, replaced[idx])
+			backupPath := binPath + oldBinSuffix
+			if fsutils.Exists(backupPath) {
+				os.Rename(backupPath, binPath)
+			} else {
+				//there was no current binary
+				os.Remove(binPath)
+			}
+		}
+	}()
+
+	for _, binName := range binNames {
+		binPath := filepath.Join(targetDir, binName)
+		backupPath := binPath + oldBinSuffix
+		os.Remove(backupPath)
+		if fsutils.Exists(binPath) {
+			if err = os.Rename(binPath, backupPath); err != nil {
+				return err
+			}
+		}
+
+		replaced = append(replaced, binName)
+		if err = os.Rename(binPath+newBinSuffix, binPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getJSON(client *http.Client, url string, data interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return netutils.ProxyError(err, url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v - unexpected status: %v", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(data)
+}
+
+func download(client *http.Client, url string, output io.Writer) error {
+	return downloadFile(client, url, output, maxPackageSize)
+}
+
+func downloadFile(client *http.Client, url string, output io.Writer, maxSize int64) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return netutils.ProxyError(err, url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v - unexpected status: %v", url, resp.Status)
+	}
+
+	written, err := io.Copy(output, io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return err
+	}
+
+	if written > maxSize {
+		return fmt.Errorf("%v - download is too big", url)
+	}
+
+	return nil
+}
+
+// getChecksums downloads the checksum file and its signature, verifies the signature
+// and parses the checksums
+func getChecksums(client *http.Client, url, signatureURL string) (map[string]string, error) {
+	var data, signature bytes.Buffer
+	if err := downloadFile(client, url, &data, maxChecksumsSize); err != nil {
+		return nil, err
+	}
+
+	if err := downloadFile(client, signatureURL, &signature, maxChecksumsSize); err != nil {
+		return nil, err
+	}
+
+	return parseChecksums(data.Bytes(), signature.Bytes(), releaseKey)
+}
+
+// parseChecksums verifies the checksum file signature (a raw Ed25519 signature
+// or its base64 encoded version) and parses the checksums (the 'sha256sum' output format)
+func parseChecksums(data, signature []byte, key ed25519.PublicKey) (map[string]string, error) {
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+		if err != nil {
+			return nil, ErrBadSignature
+		}
+
+		signature = decoded
+	}
+
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(key, data, signature) {
+		return nil, ErrBadSignature
+	}
+
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+
+	return checksums, scanner.Err()
+}
+
+// extractFile extracts a binary from the release package (the binaries are in the package directory)
+func extractFile(packagePath, packageName, binName, target string) error {
+	output, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	if strings.HasSuffix(packageName, ".zip") {
+		err = extractZipFile(packagePath, binName, output)
+	} else {
+		err = extractTarFile(packagePath, binName, output)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return output.Close()
+}
+
+func extractTarFile(packagePath, binName string, output io.Writer) error {
+	file, err := os.Open(packagePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == binName {
+			_, err = io.Copy(output, tarReader)
+			return err
+		}
+	}
+
+	return errNoPackageFile
+}
+
+func extractZipFile(packagePath, binName string, output io.Writer) error {
+	zipReader, err := zip.OpenReader(packagePath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	for _, file := range zipReader.File {
+		if !file.FileInfo().Mode().IsRegular() || filepath.Base(file.Name) != binName {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		_, err = io.Copy(output, reader)
+		return err
+	}
+
+	return errNoPackageFile
+}
@@ -0,0 +1,183 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testChecksums = `0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef  dist_linux.tar.gz
+FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210 *dist_mac.zip
+`
+
+func TestParseChecksums(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(testChecksums)
+	signature := ed25519.Sign(priv, data)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		signature []byte
+		key       ed25519.PublicKey
+		expected  error
+	}{
+		{
+			name:      "raw signature",
+			data:      data,
+			signature: signature,
+			key:       pub,
+		},
+		{
+			name:      "base64 signature",
+			data:      data,
+			signature: []byte(base64.StdEncoding.EncodeToString(signature) + "\n"),
+			key:       pub,
+		},
+		{
+			name:      "modified checksums",
+			data:      []byte(testChecksums + "0000  dist_linux_arm64.tar.gz\n"),
+			signature: signature,
+			key:       pub,
+			expected:  ErrBadSignature,
+		},
+		{
+			name:      "other key",
+			data:      data,
+			signature: signature,
+			key:       otherPub,
+			expected:  ErrBadSignature,
+		},
+		{
+			name:      "no signature",
+			data:      data,
+			signature: nil,
+			key:       pub,
+			expected:  ErrBadSignature,
+		},
+		{
+			name:      "bad signature",
+			data:      data,
+			signature: []byte("not a signature"),
+			key:       pub,
+			expected:  ErrBadSignature,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checksums, err := parseChecksums(test.data, test.signature, test.key)
+			if err != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+
+			if test.expected != nil {
+				return
+			}
+
+			if len(checksums) != 2 ||
+				checksums["dist_linux.tar.gz"] != "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef" ||
+				checksums["dist_mac.zip"] != "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210" {
+				t.Fatalf("unexpected checksums: %v", checksums)
+			}
+		})
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkTestFiles(t *testing.T, dir string, files map[string]string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != len(files) {
+		t.Fatalf("expected %v files, got %v", len(files), len(entries))
+	}
+
+	for name, expected := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != expected {
+			t.Fatalf("%v: expected %q, got %q (%v)", name, expected, data, err)
+		}
+	}
+}
+
+func TestReplaceFiles(t *testing.T) {
+	binNames := []string{sensorBinName, masterBinName, "docker-slim-sensor-arm64"}
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		fail     bool
+		expected map[string]string
+	}{
+		{
+			name: "all binaries replaced",
+			files: map[string]string{
+				sensorBinName:                             "sensor",
+				masterBinName:                             "master",
+				sensorBinName + newBinSuffix:              "sensor.new",
+				masterBinName + newBinSuffix:              "master.new",
+				"docker-slim-sensor-arm64" + newBinSuffix: "arm64.new",
+			},
+			expected: map[string]string{
+				sensorBinName:              "sensor.new",
+				masterBinName:              "master.new",
+				"docker-slim-sensor-arm64": "arm64.new",
+			},
+		},
+		{
+			name: "rolled back",
+			files: map[string]string{
+				sensorBinName:                sensorBinName,
+				masterBinName:                masterBinName,
+				sensorBinName + newBinSuffix: "sensor.new",
+				masterBinName + newBinSuffix: "master.new",
+			},
+			fail: true,
+			expected: map[string]string{
+				sensorBinName: sensorBinName,
+				masterBinName: masterBinName,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "dslim-update-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			writeTestFiles(t, dir, test.files)
+
+			err = replaceFiles(dir, binNames)
+			if test.fail != (err != nil) {
+				t.Fatalf("unexpected result: %v", err)
+			}
+
+			checkTestFiles(t, dir, test.expected)
+		})
+	}
+}
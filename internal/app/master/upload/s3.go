@@ -0,0 +1,225 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Environment variables for the S3 upload configuration
+// (the same variables the AWS tools use)
+const (
+	EnvAWSAccessKeyID     = "AWS_ACCESS_KEY_ID"
+	EnvAWSSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+	EnvAWSSessionToken    = "AWS_SESSION_TOKEN"
+	EnvAWSRegion          = "AWS_REGION"
+	EnvAWSDefaultRegion   = "AWS_DEFAULT_REGION"
+	EnvAWSEndpointURL     = "AWS_ENDPOINT_URL"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	s3Service       = "s3"
+	amzDateFormat   = "20060102T150405Z"
+	amzDayFormat    = "20060102"
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+)
+
+// ErrNoS3Credentials is returned when the AWS credentials are not set
+var ErrNoS3Credentials = errors.New("no AWS credentials (set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+
+type s3Uploader struct {
+	bucket       string
+	prefix       string
+	region       string
+	endpoint     *url.URL
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+func newS3Uploader(targetURL *url.URL) (*s3Uploader, error) {
+	uploader := &s3Uploader{
+		bucket:       targetURL.Host,
+		prefix:       strings.Trim(targetURL.Path, "/"),
+		region:       os.Getenv(EnvAWSRegion),
+		accessKey:    os.Getenv(EnvAWSAccessKeyID),
+		secretKey:    os.Getenv(EnvAWSSecretAccessKey),
+		sessionToken: os.Getenv(EnvAWSSessionToken),
+		client:       &http.Client{Timeout: uploadTimeout},
+	}
+
+	if uploader.bucket == "" {
+		return nil, fmt.Errorf("no S3 bucket name - %v", targetURL)
+	}
+
+	if uploader.accessKey == "" || uploader.secretKey == "" {
+		return nil, ErrNoS3Credentials
+	}
+
+	if uploader.region == "" {
+		uploader.region = os.Getenv(EnvAWSDefaultRegion)
+	}
+
+	if uploader.region == "" {
+		uploader.region = defaultS3Region
+	}
+
+	//custom endpoints (e.g., MinIO) use the path-style URLs
+	if endpoint := os.Getenv(EnvAWSEndpointURL); endpoint != "" {
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		uploader.endpoint = endpointURL
+	}
+
+	return uploader, nil
+}
+
+func (u *s3Uploader) Location(name string) string {
+	return fmt.Sprintf("%s://%s/%s", SchemeS3, u.bucket, joinKey(u.prefix, name))
+}
+
+// objectURL returns the object URL (its path is encoded like the signed canonical URI)
+func (u *s3Uploader) objectURL(key string) *url.URL {
+	objectURL := &url.URL{
+		Scheme: SchemeHTTPS,
+		Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", u.bucket, u.region),
+		Path:   "/" + key,
+	}
+
+	if u.endpoint != nil {
+		endpointURL := *u.endpoint
+		endpointURL.Path = fmt.Sprintf("/%s/%s", u.bucket, key)
+		objectURL = &endpointURL
+	}
+
+	objectURL.RawPath = canonicalURI(objectURL.Path)
+	return objectURL
+}
+
+func (u *s3Uploader) Upload(name string, data []byte, contentType string) error {
+	objectURL := u.objectURL(joinKey(u.prefix, name))
+
+	req, err := http.NewRequest(http.MethodPut, objectURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	u.sign(req, data, time.Now().UTC())
+
+	return doRequest(u.client, req)
+}
+
+// sign adds the AWS Signature Version 4 headers
+func (u *s3Uploader) sign(req *http.Request, payload []byte, now time.Time) {
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headerNames := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if u.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.sessionToken)
+		headerNames = append(headerNames, "x-amz-security-token")
+	}
+
+	signV4(req, payloadHash, headerNames, u.region, u.accessKey, u.secretKey, now)
+}
+
+// signV4 signs the request for S3 (AWS Signature Version 4) with the given signed headers
+// (the header names are lowercase and sorted) and adds the Authorization header
+func signV4(req *http.Request, payloadHash string, headerNames []string, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	day := now.Format(amzDayFormat)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range headerNames {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.Join(strings.Fields(value), " "))
+	}
+
+	signedHeaders := strings.Join(headerNames, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", day, region, s3Service)
+	stringToSign := strings.Join([]string{
+		signAlgorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), day)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalURI encodes each path segment with the SigV4 URI encoding (S3 object keys are encoded once
+// and the '/' separators are kept). The request URLs use the same encoding (see objectURL).
+func canonicalURI(urlPath string) string {
+	if urlPath == "" {
+		return "/"
+	}
+
+	segments := strings.Split(urlPath, "/")
+	for idx, segment := range segments {
+		segments[idx] = uriEncode(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// uriEncode encodes everything except the unreserved characters (RFC 3986) with the uppercase hex digits
+func uriEncode(value string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9',
+			b == '-', b == '.', b == '_', b == '~':
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return encoded.String()
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
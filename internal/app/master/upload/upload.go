@@ -0,0 +1,218 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/utils/netutils"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Upload target URL schemes
+const (
+	SchemeS3    = "s3"
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+)
+
+// Environment variables for the HTTP upload credentials
+const (
+	EnvHTTPToken = "DSLIM_UPLOAD_TOKEN"
+)
+
+const uploadTimeout = 60 * time.Second
+
+// ErrUnsupportedTarget is returned when the upload target URL scheme is not supported
+var ErrUnsupportedTarget = errors.New("unsupported upload target (use s3://bucket/prefix or http(s)://host/path)")
+
+// Uploader uploads files to remote storage
+type Uploader interface {
+	// Upload stores the file data with the given name (relative to the target location)
+	Upload(name string, data []byte, contentType string) error
+	// Location returns the remote location for the file name
+	Location(name string) string
+}
+
+// New creates an uploader for the target URL (the credentials come from the environment)
+func New(target string) (Uploader, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch targetURL.Scheme {
+	case SchemeS3:
+		return newS3Uploader(targetURL)
+	case SchemeHTTP, SchemeHTTPS:
+		return newHTTPUploader(targetURL), nil
+	default:
+		return nil, ErrUnsupportedTarget
+	}
+}
+
+// Files uploads the local files (the keys are the remote names) and returns the uploaded file locations
+// (the missing files are skipped)
+func Files(target string, files map[string]string) ([]string, error) {
+	uploader, err := New(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for name, localPath := range files {
+		if localPath == "" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				log.Debugf("upload.Files: skipping missing file - %v", localPath)
+				continue
+			}
+
+			return locations, err
+		}
+
+		if err := uploader.Upload(name, data, contentType(name)); err != nil {
+			return locations, fmt.Errorf("error uploading %v - %v", name, err)
+		}
+
+		locations = append(locations, uploader.Location(name))
+	}
+
+	return locations, nil
+}
+
+func contentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".json", ".sarif":
+		return "application/json"
+	case ".yaml", ".yml":
+		return "application/x-yaml"
+	case ".sh":
+		return "text/x-shellscript"
+	}
+
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		return ctype
+	}
+
+	return "text/plain"
+}
+
+// RunPrefix returns the remote name prefix for the files from one command run
+// ('<image name>/<UTC timestamp>-<random run ID>'), so the runs for different images
+// and the repeated runs for the same image don't overwrite each other's files
+func RunPrefix(imageName string, now time.Time) string {
+	runID := now.UTC().Format("20060102T150405Z")
+	data := make([]byte, 4)
+	if _, err := rand.Read(data); err == nil {
+		runID = fmt.Sprintf("%s-%s", runID, hex.EncodeToString(data))
+	}
+
+	return path.Join(imageKeyName(imageName), runID)
+}
+
+// imageKeyName converts the image name (e.g., 'registry:5000/team/app:1.0') to a safe key prefix
+// ('registry_5000/team/app_1.0'): the repository path separators are kept and the other
+// special characters are replaced
+func imageKeyName(imageName string) string {
+	var parts []string
+	for _, part := range strings.Split(imageName, "/") {
+		part = strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+				return r
+			}
+
+			return '_'
+		}, part)
+
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return "image"
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func joinKey(prefix, name string) string {
+	return strings.TrimPrefix(path.Join(prefix, name), "/")
+}
+
+type httpUploader struct {
+	baseURL *url.URL
+	token   string
+	client  *http.Client
+}
+
+func newHTTPUploader(targetURL *url.URL) *httpUploader {
+	return &httpUploader{
+		baseURL: targetURL,
+		token:   os.Getenv(EnvHTTPToken),
+		client:  &http.Client{Timeout: uploadTimeout},
+	}
+}
+
+func (u *httpUploader) Location(name string) string {
+	location := *u.baseURL
+	location.User = nil
+	location.Path = "/" + joinKey(u.baseURL.Path, name)
+	return location.String()
+}
+
+func (u *httpUploader) Upload(name string, data []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPut, u.Location(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if u.baseURL.User != nil {
+		password, _ := u.baseURL.User.Password()
+		req.SetBasicAuth(u.baseURL.User.Username(), password)
+	} else if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+
+	return doRequest(u.client, req)
+}
+
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return netutils.ProxyError(err, req.URL.String())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if len(body) > 256 {
+			body = body[:256]
+		}
+
+		return fmt.Errorf("unexpected status - %v (%s)", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
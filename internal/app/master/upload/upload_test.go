@@ -0,0 +1,35 @@
+package upload
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRunPrefix(t *testing.T) {
+	now := time.Date(2022, 3, 15, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		image    string
+		expected string
+	}{
+		{image: "nginx", expected: "nginx"},
+		{image: "nginx:1.21", expected: "nginx_1.21"},
+		{image: "my-registry:5000/team/app:1.0", expected: "my-registry_5000/team/app_1.0"},
+		{image: "app@sha256:abcd", expected: "app_sha256_abcd"},
+		{image: "../../etc/./app", expected: "etc/app"},
+		{image: "", expected: "image"},
+	}
+
+	for _, test := range tests {
+		prefix := RunPrefix(test.image, now)
+		pattern := "^" + regexp.QuoteMeta(test.expected) + "/20220315T101500Z-[0-9a-f]{8}$"
+		if !regexp.MustCompile(pattern).MatchString(prefix) {
+			t.Errorf("%q: unexpected prefix %q", test.image, prefix)
+		}
+	}
+
+	if RunPrefix("nginx", now) == RunPrefix("nginx", now) {
+		t.Error("expected different prefixes for the runs at the same time")
+	}
+}
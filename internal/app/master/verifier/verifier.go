@@ -0,0 +1,212 @@
+package verifier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/docker/dockerhost"
+	"github.com/docker-slim/docker-slim/internal/app/master/security/apparmor"
+	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+
+	log "github.com/Sirupsen/logrus"
+	dockerapi "github.com/cloudimmunity/go-dockerclientx"
+)
+
+const (
+	containerNamePat = "dockerslimv_%v_%v"
+	labelName        = "dockerslim.verifier"
+	sigSysExitCode   = 128 + 31
+)
+
+// Verifier runs the minified image with the generated security profiles
+type Verifier struct {
+	ImageRef            string
+	SeccompProfilePath  string
+	AppArmorProfileName string
+	Network             string
+	ContainerID         string
+	ContainerName       string
+	ContainerInfo       *dockerapi.Container
+	DockerHostIP        string
+	UseAppArmor         bool
+	APIClient           *dockerapi.Client
+	removeOnce          sync.Once
+}
+
+// Result contains the profile verification results
+type Result struct {
+	Running     bool
+	ExitCode    int
+	Errors      []string
+	ProbeFailed bool
+}
+
+// New creates a new profile verifier
+// (the minified image runs without the security profiles if the profile paths are empty)
+func New(client *dockerapi.Client,
+	imageRef string,
+	seccompProfilePath string,
+	appArmorProfileName string,
+	network string) (*Verifier, error) {
+	verifier := &Verifier{
+		ImageRef:            imageRef,
+		SeccompProfilePath:  seccompProfilePath,
+		AppArmorProfileName: appArmorProfileName,
+		Network:             network,
+		APIClient:           client,
+	}
+
+	if appArmorProfileName != "" {
+		verifier.UseAppArmor = apparmor.IsProfileLoaded(appArmorProfileName)
+		if !verifier.UseAppArmor {
+			log.Infof("verifier: AppArmor profile is not loaded (skipping) - %v", appArmorProfileName)
+		}
+	}
+
+	return verifier, nil
+}
+
+// Start starts the minified container with the security profiles applied
+// (the container is removed if it can't be started)
+func (v *Verifier) Start() error {
+	var securityOpts []string
+	if v.SeccompProfilePath != "" {
+		seccompProfile, err := ioutil.ReadFile(v.SeccompProfilePath)
+		if err != nil {
+			return err
+		}
+
+		securityOpts = append(securityOpts, fmt.Sprintf("seccomp=%s", seccompProfile))
+	}
+
+	if v.UseAppArmor {
+		securityOpts = append(securityOpts, fmt.Sprintf("apparmor=%s", v.AppArmorProfileName))
+	}
+
+	v.ContainerName = fmt.Sprintf(containerNamePat, os.Getpid(), time.Now().UTC().Format("20060102150405"))
+
+	containerOptions := dockerapi.CreateContainerOptions{
+		Name: v.ContainerName,
+		Config: &dockerapi.Config{
+			Image:  v.ImageRef,
+			Labels: map[string]string{"type": labelName},
+		},
+		HostConfig: &dockerapi.HostConfig{
+			PublishAllPorts: true,
+			SecurityOpt:     securityOpts,
+		},
+	}
+
+	if v.Network != "" {
+		containerOptions.HostConfig.NetworkMode = v.Network
+	}
+
+	containerInfo, err := v.APIClient.CreateContainer(containerOptions)
+	if err != nil {
+		audit.Container(audit.RuntimeDocker, audit.ActionCreate, "", v.ImageRef, err)
+		return err
+	}
+
+	audit.Container(audit.RuntimeDocker, audit.ActionCreate, containerInfo.ID, v.ImageRef, nil)
+
+	v.ContainerID = containerInfo.ID
+	log.Infoln("verifier: created container =>", v.ContainerID)
+
+	//the minified container is also removed when docker-slim fails before Finish
+	errutils.OnExit(func(int) {
+		v.removeContainer()
+	})
+
+	if err := v.APIClient.StartContainer(v.ContainerID, nil); err != nil {
+		v.removeContainer()
+		return err
+	}
+
+	if v.ContainerInfo, err = v.APIClient.InspectContainer(v.ContainerID); err != nil {
+		v.removeContainer()
+		return err
+	}
+
+	v.DockerHostIP = dockerhost.GetIP()
+	return nil
+}
+
+// Ports returns the host ports published by the minified container
+func (v *Verifier) Ports() []string {
+	var ports []string
+	if v.ContainerInfo == nil || v.ContainerInfo.NetworkSettings == nil {
+		return ports
+	}
+
+	for _, nsPortData := range v.ContainerInfo.NetworkSettings.Ports {
+		if len(nsPortData) > 0 {
+			ports = append(ports, nsPortData[0].HostPort)
+		}
+	}
+
+	return ports
+}
+
+// PortMap returns the ports published by the minified container (container port => host port)
+func (v *Verifier) PortMap() map[string]string {
+	ports := map[string]string{}
+	if v.ContainerInfo == nil || v.ContainerInfo.NetworkSettings == nil {
+		return ports
+	}
+
+	for nsPortKey, nsPortData := range v.ContainerInfo.NetworkSettings.Ports {
+		if len(nsPortData) > 0 {
+			ports[string(nsPortKey)] = nsPortData[0].HostPort
+		}
+	}
+
+	return ports
+}
+
+// Finish collects the verification results and removes the minified container
+func (v *Verifier) Finish() (*Result, error) {
+	defer v.removeContainer()
+
+	result := &Result{}
+
+	containerInfo, err := v.APIClient.InspectContainer(v.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Running = containerInfo.State.Running
+	result.ExitCode = containerInfo.State.ExitCode
+
+	if !result.Running {
+		switch result.ExitCode {
+		case 0:
+		case sigSysExitCode:
+			result.Errors = append(result.Errors, "container killed by a blocked system call (SIGSYS)")
+		default:
+			result.Errors = append(result.Errors, fmt.Sprintf("container exited with code %v", result.ExitCode))
+		}
+	}
+
+	return result, nil
+}
+
+// removeContainer removes the minified container (only once)
+func (v *Verifier) removeContainer() {
+	v.removeOnce.Do(func() {
+		removeOption := dockerapi.RemoveContainerOptions{
+			ID:            v.ContainerID,
+			RemoveVolumes: true,
+			Force:         true,
+		}
+
+		err := v.APIClient.RemoveContainer(removeOption)
+		audit.Container(audit.RuntimeDocker, audit.ActionRemove, v.ContainerID, v.ImageRef, err)
+		if err != nil {
+			log.Infof("verifier: error removing container => %v - %v", v.ContainerID, err)
+		}
+	})
+}
@@ -1,19 +1,32 @@
 package version
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/cloudimmunity/go-dockerclientx"
+	"github.com/docker-slim/docker-slim/internal/app/master/inspectors/container"
+	"github.com/docker-slim/docker-slim/internal/app/master/update"
+	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
 	v "github.com/docker-slim/docker-slim/pkg/version"
 
 	"github.com/cloudimmunity/system"
 )
 
+const sensorVersionTimeout = 5 * time.Second
+
 // Print shows the master app version information
 func Print(client *docker.Client) {
 	fmt.Println("docker-slim:")
 	fmt.Println(v.Current())
 
+	printSensor()
+
 	fmt.Println("host:")
 	hostInfo := system.GetSystemInfo()
 	fmt.Printf("OsName=%v\n", hostInfo.OsName)
@@ -47,3 +60,71 @@ func Print(client *docker.Client) {
 	fmt.Printf("BuildTime=%v\n", ver.Get("BuildTime"))
 	fmt.Printf("GitCommit=%v\n", ver.Get("GitCommit"))
 }
+
+// printSensor shows the sensor version information
+// (the sensor is built for Linux, so it can't run on the other host platforms)
+func printSensor() {
+	fmt.Println("sensor:")
+	sensorPath := filepath.Join(fsutils.ExeDir(), container.SensorBinLocal)
+	fmt.Printf("Location=%v\n", sensorPath)
+
+	sensorVersion, err := SensorVersion(sensorPath)
+	if err != nil {
+		fmt.Printf("Error=%v\n", err)
+		return
+	}
+
+	fmt.Println(sensorVersion)
+	if !SameBuild(sensorVersion, v.Current()) {
+		fmt.Println("Warning=the sensor and docker-slim versions are different (run 'docker-slim update --force' to reinstall them)")
+	}
+}
+
+// SensorVersion runs the sensor to get its version information
+func SensorVersion(sensorPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sensorVersionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, sensorPath, "-version").Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			//the old sensor versions don't have the '-version' flag
+			return "", errors.New("no sensor version info (the sensor is too old)")
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// SameBuild returns true if the version info is for the same build (ignoring the OS name)
+func SameBuild(info, other string) bool {
+	trimOS := func(value string) string {
+		if idx := strings.Index(value, "|"); idx != -1 {
+			return value[idx+1:]
+		}
+
+		return value
+	}
+
+	return trimOS(info) == trimOS(other)
+}
+
+// PrintUpdateCheck checks if there's a newer docker-slim release
+func PrintUpdateCheck(timeout time.Duration) {
+	fmt.Println("update:")
+	release, err := update.LatestRelease(update.ChannelStable, timeout)
+	if err != nil {
+		fmt.Printf("Error=%v\n", err)
+		return
+	}
+
+	fmt.Printf("Latest=%v\n", release.Tag)
+	available := update.IsNewer(v.Tag(), release.Tag)
+	fmt.Printf("Available=%v\n", available)
+	if available {
+		fmt.Printf("URL=%v\n", release.URL)
+		fmt.Println("Run 'docker-slim update' to install the latest release")
+	}
+}
@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/master/audit"
+	"github.com/docker-slim/docker-slim/internal/app/master/registry"
+
+	"github.com/cloudimmunity/go-dockerclientx"
+)
+
+const defaultTag = "latest"
+
+// ErrDigestReference is returned for the image references with a digest (they never change)
+var ErrDigestReference = errors.New("image digest references can't change")
+
+// State is the stored 'watch' mode state for an image:
+// the build options and the ID of the last image version built successfully
+type State struct {
+	Image       string     `json:"image"`
+	BuildArgs   []string   `json:"build_args,omitempty"`
+	ImageID     string     `json:"image_id,omitempty"`
+	LastJobID   string     `json:"last_job_id,omitempty"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	LastBuilt   *time.Time `json:"last_built,omitempty"`
+}
+
+// LoadState loads the stored state for the image
+// (it returns a new state if the image wasn't watched before)
+func LoadState(location, imageRef string) (*State, error) {
+	data, err := ioutil.ReadFile(statePath(location, imageRef))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &State{Image: imageRef}, nil
+		}
+
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// Save saves the image state
+func (s *State) Save(location string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(statePath(location, s.Image), data, 0644)
+}
+
+func statePath(location, imageRef string) string {
+	name := strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(imageRef)
+	return filepath.Join(location, name+".json")
+}
+
+// ImageID returns the current ID of the image
+// (the image is pulled first if doPull is true, so the ID changes when the image changes in the registry)
+func ImageID(client *docker.Client, imageRef string, doPull bool) (string, error) {
+	if strings.Contains(imageRef, "@") {
+		return "", ErrDigestReference
+	}
+
+	if doPull {
+		repo, tag := parseImageRef(imageRef)
+		options := docker.PullImageOptions{
+			Repository:   repo,
+			Tag:          tag,
+			OutputStream: ioutil.Discard,
+		}
+
+		err := client.PullImage(options, registryAuth(repo))
+		audit.Image(audit.RuntimeDocker, audit.ActionPull, imageRef, err)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	info, err := client.InspectImage(imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	return info.ID, nil
+}
+
+func parseImageRef(imageRef string) (string, string) {
+	if idx := strings.LastIndex(imageRef, ":"); idx > strings.LastIndex(imageRef, "/") {
+		return imageRef[:idx], imageRef[idx+1:]
+	}
+
+	return imageRef, defaultTag
+}
+
+// registryAuth returns the Docker config credentials for the image registry (if there are any)
+func registryAuth(repo string) docker.AuthConfiguration {
+	host := registry.DockerHub
+	if parts := strings.SplitN(repo, "/", 2); len(parts) == 2 &&
+		(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host = parts[0]
+	}
+
+	return registry.AuthConfig(host)
+}
@@ -2,17 +2,22 @@ package app
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/docker-slim/docker-slim/internal/app/sensor/ipc"
 	"github.com/docker-slim/docker-slim/internal/app/sensor/monitors/fanotify"
 	"github.com/docker-slim/docker-slim/internal/app/sensor/monitors/pevent"
 	"github.com/docker-slim/docker-slim/internal/app/sensor/monitors/ptrace"
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
 	"github.com/docker-slim/docker-slim/pkg/ipc/command"
 	"github.com/docker-slim/docker-slim/pkg/ipc/event"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/logutils"
+	v "github.com/docker-slim/docker-slim/pkg/version"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/cloudimmunity/system"
@@ -20,6 +25,12 @@ import (
 
 var doneChan chan struct{}
 
+// monitor reports from the previous target app runs in the same monitoring session
+// (the target app can be restarted multiple times and all runs are merged into one artifact set)
+var sessionFanReport *report.FanMonitorReport
+var sessionPtReport *report.PtMonitorReport
+var sessionNetReport *report.NetMonitorReport
+
 ///////////////////////////////////////////////////////////////////////////////
 
 func monitor(stopWork chan bool,
@@ -27,7 +38,8 @@ func monitor(stopWork chan bool,
 	pids chan []int,
 	ptmonStartChan chan int,
 	cmd *command.StartMonitor,
-	dirName string) {
+	dirName string,
+	appExitChan chan<- struct{}) {
 	log.Info("sensor: monitor starting...")
 	mountPoint := "/"
 
@@ -44,37 +56,115 @@ func monitor(stopWork chan bool,
 		//ProcEvents are not enabled in the default boot2docker kernel
 	}
 
-	fanReportChan := fanotify.Run(mountPoint, stopMonitor) //data.AppName, data.AppArgs
-	ptReportChan := ptrace.Run(ptmonStartChan, stopMonitor, cmd.AppName, cmd.AppArgs, dirName)
+	//FANOTIFY needs CAP_SYS_ADMIN in the host user namespace (not available with rootless Docker),
+	//so ptrace tracks the file activity when it's not available
+	redactPattern := execRedactPattern(cmd)
+	fanStats := &fanotify.Stats{}
+	fanReportChan, err := fanotify.Run(mountPoint, stopMonitor, cmd.EventQueueSize, redactPattern, fanStats) //data.AppName, data.AppArgs
+	if err != nil {
+		log.Warnf("sensor: FANOTIFY is not available (%v) - using ptrace to track the file activity (only the main target app process is traced)", err)
+		publishWarning(fmt.Sprintf("FANOTIFY is not available (%v) - only the main target app process is traced", err))
+	}
+
+	ptStats := &ptrace.Stats{}
+
+	ptReportChan := ptrace.Run(ptmonStartChan,
+		stopMonitor,
+		cmd.AppName,
+		cmd.AppArgs,
+		dirName,
+		fanReportChan == nil,
+		cmd.PtraceSampleRate,
+		cmd.EventQueueSize,
+		cmd.Nice,
+		ptStats)
+
+	go reportProgress(stopMonitor, fanStats, ptStats)
+
+	netReportChan := trackListeningPorts(stopMonitor)
 
 	go func() {
 		log.Debug("sensor: monitor - waiting to stop monitoring...")
-		<-stopWork
+		var ptReport *report.PtMonitorReport
+		select {
+		case <-stopWork:
+		case ptReport = <-ptReportChan:
+			//the target app exited before the monitoring was stopped (the standalone mode stops the monitoring then)
+			log.Info("sensor: monitor - target app exited")
+			if appExitChan != nil {
+				appExitChan <- struct{}{}
+			}
+
+			<-stopWork
+		}
 		log.Debug("sensor: monitor - stop message...")
 
 		close(stopMonitor)
 
 		log.Debug("sensor: monitor - processing data...")
 
-		fanReport := <-fanReportChan
-		ptReport := <-ptReportChan
+		var fanReport *report.FanMonitorReport
+		if fanReportChan != nil {
+			fanReport = <-fanReportChan
+		}
+
+		if ptReport == nil {
+			ptReport = <-ptReportChan
+		}
+
+		if fanReportChan == nil {
+			fanReport = fanReportFromFSActivity(ptReport, cmd, redactPattern)
+		}
 
 		if peReportChan != nil {
 			peReport = <-peReportChan
 			//TODO: when peReport is available filter file events from fanReport
 		}
 
-		processReports(mountPoint, fanReport, ptReport, peReport, cmd)
+		sessionFanReport = report.MergeFanMonitorReports(sessionFanReport, fanReport)
+		sessionPtReport = report.MergePtMonitorReports(sessionPtReport, ptReport)
+		sessionNetReport = report.MergeNetMonitorReports(sessionNetReport, <-netReportChan)
+
+		processReports(mountPoint, sessionFanReport, sessionPtReport, peReport, sessionNetReport, cmd)
 		stopWorkAck <- true
 	}()
 }
 
+// execRedactPattern returns the pattern for the executed command arguments to redact
+// (the default pattern is used if the master didn't send a valid pattern)
+func execRedactPattern(cmd *command.StartMonitor) *regexp.Regexp {
+	if cmd.ExecRedactPattern != "" {
+		pattern, err := regexp.Compile(cmd.ExecRedactPattern)
+		if err == nil {
+			return pattern
+		}
+
+		log.Warnf("sensor: bad exec redaction pattern (using the default pattern) - %v", err)
+	}
+
+	return regexp.MustCompile(command.DefaultExecRedactPattern)
+}
+
 /////////
 
 var enableDebug bool
+var logFormat string
+var logFile string
+var showVersion bool
+var relayAddr string
+var standaloneConfig string
+var cmdPort int
+var evtPort int
 
 func init() {
 	flag.BoolVar(&enableDebug, "d", false, "enable debug logging")
+	flag.StringVar(&logFormat, "log-format", logutils.FormatText, "log format ('text' or 'json')")
+	flag.StringVar(&logFile, "log-file", "", "log file (the logs also go to stderr)")
+	flag.BoolVar(&showVersion, "version", false, "print the sensor version and exit")
+	flag.StringVar(&relayAddr, "relay", "", "relay stdin/stdout to the TCP address and exit (the IPC tunnel mode)")
+	flag.StringVar(&standaloneConfig, "standalone", "", "monitor the target app without the master using the start monitor command file (the instrumented image mode)")
+	flag.IntVar(&cmdPort, "cmd-port", channel.CmdPort, "IPC command port (the sensors sharing a network namespace use different ports)")
+	flag.IntVar(&evtPort, "evt-port", channel.EvtPort, "IPC event port")
 }
 
 /////////
@@ -83,10 +173,28 @@ func init() {
 func Run() {
 	flag.Parse()
 
+	if showVersion {
+		fmt.Println(v.Current())
+		return
+	}
+
+	if relayAddr != "" {
+		if err := relay(relayAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "sensor: relay error - %v\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	if enableDebug {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	if err := logutils.Setup(logFormat, logFile, true); err != nil {
+		log.Warnf("sensor: error configuring logs - %v", err)
+	}
+
 	log.Debugf("sensor: sysinfo => %#v", system.GetSystemInfo())
 	log.Debugf("sensor: kernel flags => %#v", system.DefaultKernelFeatures.Raw)
 
@@ -96,6 +204,12 @@ func Run() {
 	errutils.WarnOn(err)
 	log.Debugf("sensor: cwd => %#v", dirName)
 
+	if standaloneConfig != "" {
+		//the sensor handles the stop signals itself (the artifacts are saved before it exits)
+		errutils.FailOn(runStandalone(standaloneConfig, flag.Args(), dirName))
+		return
+	}
+
 	initSignalHandlers()
 	defer func() {
 		log.Debug("defered cleanup on shutdown...")
@@ -105,12 +219,14 @@ func Run() {
 	log.Debug("sensor: setting up channels...")
 	doneChan = make(chan struct{})
 
-	err = ipc.InitChannels()
+	err = ipc.InitChannels(cmdPort, evtPort)
 	errutils.FailOn(err)
 
 	cmdChan, err := ipc.RunCmdServer(doneChan)
 	errutils.FailOn(err)
 
+	ipc.RunHeartbeat(doneChan)
+
 	monDoneChan := make(chan bool, 1)
 	monDoneAckChan := make(chan bool)
 	pidsChan := make(chan []int, 1)
@@ -130,7 +246,7 @@ doneRunning:
 				}
 
 				log.Debugf("sensor: 'start' monitor command (%#v)", data)
-				monitor(monDoneChan, monDoneAckChan, pidsChan, ptmonStartChan, data, dirName)
+				monitor(monDoneChan, monDoneAckChan, pidsChan, ptmonStartChan, data, dirName, nil)
 
 				//target app started by ptmon... (long story :-))
 				//TODO: need to get the target app pid to pemon, so it can filter process events
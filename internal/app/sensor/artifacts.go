@@ -1,13 +1,13 @@
 package app
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
@@ -16,10 +16,12 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/docker-slim/docker-slim/pkg/distro"
 	"github.com/docker-slim/docker-slim/pkg/ipc/command"
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
 	"github.com/docker-slim/docker-slim/pkg/utils/fsutils"
+	"github.com/docker-slim/docker-slim/pkg/utils/logutils"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -54,15 +56,23 @@ func saveResults(fanMonReport *report.FanMonitorReport,
 	fileNames map[string]*report.ArtifactProps,
 	ptMonReport *report.PtMonitorReport,
 	peReport *report.PeMonitorReport,
+	netReport *report.NetMonitorReport,
 	cmd *command.StartMonitor) {
 	log.Debugf("saveResults(%v,...)", len(fileNames))
 
 	artifactDirName := defaultArtifactDirName
 
-	artifactStore := newArtifactStore(artifactDirName, fanMonReport, fileNames, ptMonReport, peReport, cmd)
+	artifactStore := newArtifactStore(artifactDirName, fanMonReport, fileNames, ptMonReport, peReport, netReport, cmd)
 	artifactStore.prepareArtifacts()
 	artifactStore.saveArtifacts()
 	artifactStore.saveReport()
+
+	if cmd.CompressArtifacts {
+		//the sensor log is still written, so it's not packed
+		if err := fsutils.PackArtifacts(artifactDirName, logutils.SensorLogFileName); err != nil {
+			log.Warnf("saveResults - error compressing the artifacts (they'll be copied uncompressed) => %v", err)
+		}
+	}
 }
 
 type artifactStore struct {
@@ -70,12 +80,24 @@ type artifactStore struct {
 	fanMonReport  *report.FanMonitorReport
 	ptMonReport   *report.PtMonitorReport
 	peMonReport   *report.PeMonitorReport
+	netMonReport  *report.NetMonitorReport
 	rawNames      map[string]*report.ArtifactProps
 	nameList      []string
 	resolve       map[string]struct{}
 	linkMap       map[string]*report.ArtifactProps
 	fileMap       map[string]*report.ArtifactProps
+	pids          []string
 	cmd           *command.StartMonitor
+	distro        *distro.Info
+	//the include paths from the distro ruleset and the data options
+	ruleIncludes []ruleInclude
+	libcWarnings []string
+}
+
+// ruleInclude is an include path the sensor adds (with the keep reason for its files)
+type ruleInclude struct {
+	path   string
+	reason string
 }
 
 func newArtifactStore(storeLocation string,
@@ -83,12 +105,14 @@ func newArtifactStore(storeLocation string,
 	rawNames map[string]*report.ArtifactProps,
 	ptMonReport *report.PtMonitorReport,
 	peMonReport *report.PeMonitorReport,
+	netMonReport *report.NetMonitorReport,
 	cmd *command.StartMonitor) *artifactStore {
 	store := &artifactStore{
 		storeLocation: storeLocation,
 		fanMonReport:  fanMonReport,
 		ptMonReport:   ptMonReport,
 		peMonReport:   peMonReport,
+		netMonReport:  netMonReport,
 		rawNames:      rawNames,
 		nameList:      make([]string, 0, len(rawNames)),
 		resolve:       map[string]struct{}{},
@@ -97,6 +121,12 @@ func newArtifactStore(storeLocation string,
 		cmd:           cmd,
 	}
 
+	//the process IDs are sorted once (not for each artifact)
+	for pid := range fanMonReport.ProcessFiles {
+		store.pids = append(store.pids, pid)
+	}
+	sort.Strings(store.pids)
+
 	return store
 }
 
@@ -142,6 +172,7 @@ func (p *artifactStore) prepareArtifact(artifactFileName string) {
 	}
 
 	props.Flags = p.getArtifactFlags(artifactFileName)
+	p.addObservedReasons(props)
 
 	log.Debugf("prepareArtifact - file mode:%v", srcLinkFileInfo.Mode())
 	switch {
@@ -153,6 +184,11 @@ func (p *artifactStore) prepareArtifact(artifactFileName string) {
 			props.DataType, _ = getDataType(artifactFileName)
 		}
 
+		if len(props.Reasons) == 0 {
+			//the file was not accessed directly, so it's a hard link to an accessed file
+			props.AddReason(report.KeepReasonLink, "hard link to an accessed file")
+		}
+
 		p.fileMap[artifactFileName] = props
 		p.rawNames[artifactFileName] = props
 	case (srcLinkFileInfo.Mode() & os.ModeSymlink) != 0:
@@ -164,6 +200,9 @@ func (p *artifactStore) prepareArtifact(artifactFileName string) {
 
 		props.FileType = report.SymlinkArtifactType
 		props.LinkRef = linkRef
+		if len(props.Reasons) == 0 {
+			props.AddReason(report.KeepReasonLink, fmt.Sprintf("symlink to %s", linkRef))
+		}
 
 		if _, ok := p.rawNames[linkRef]; !ok {
 			p.resolve[linkRef] = struct{}{}
@@ -180,6 +219,54 @@ func (p *artifactStore) prepareArtifact(artifactFileName string) {
 	}
 }
 
+// addObservedReasons adds the keep reasons for the files the monitored processes accessed
+func (p *artifactStore) addObservedReasons(props *report.ArtifactProps) {
+	for _, pid := range p.pids {
+		finfo, ok := p.fanMonReport.ProcessFiles[pid][props.FilePath]
+		if !ok {
+			continue
+		}
+
+		processName := fmt.Sprintf("pid %s", pid)
+		if pinfo, ok := p.fanMonReport.Processes[pid]; ok && pinfo != nil && pinfo.Path != "" {
+			processName = pinfo.Path
+		}
+
+		if finfo.ExeCount == 0 && isSharedLibrary(props.FilePath) {
+			props.AddReason(report.KeepReasonLibrary, fmt.Sprintf("loaded by %s", processName))
+			continue
+		}
+
+		props.AddReason(report.KeepReasonObserved, fmt.Sprintf("%s by %s", fileAccessText(finfo), processName))
+	}
+}
+
+func fileAccessText(finfo *report.FileInfo) string {
+	var access []string
+	if finfo.ExeCount > 0 {
+		access = append(access, "executed")
+	}
+
+	if finfo.ReadCount > 0 {
+		access = append(access, "read")
+	}
+
+	if finfo.WriteCount > 0 {
+		access = append(access, "written")
+	}
+
+	if len(access) == 0 {
+		return "opened"
+	}
+
+	return strings.Join(access, "/")
+}
+
+func isSharedLibrary(fileName string) bool {
+	baseName := path.Base(fileName)
+	return strings.HasSuffix(baseName, ".so") || strings.Contains(baseName, ".so.")
+}
+
 func (p *artifactStore) prepareArtifacts() {
 	log.Debugf("p.prepareArtifacts() p.rawNames=%v", len(p.rawNames))
 
@@ -188,9 +275,120 @@ func (p *artifactStore) prepareArtifacts() {
 		p.prepareArtifact(artifactFileName)
 	}
 
+	p.prepareDistroIncludes()
+	p.prepareDataIncludes()
+	p.prepareIncludedArtifacts()
+	p.resolveLibDeps()
+	p.addPackageInfo()
 	p.resolveLinks()
 }
 
+// prepareDistroIncludes detects the base distro of the target container
+// and finds the include paths from its ruleset (if they are enabled)
+func (p *artifactStore) prepareDistroIncludes() {
+	p.distro = distro.Detect("/")
+	if p.distro == nil {
+		log.Debug("prepareDistroIncludes - unknown distro")
+		return
+	}
+
+	log.Debugf("prepareDistroIncludes - distro: %+v", p.distro)
+	if p.cmd.DistroIncludes {
+		includePaths := distro.IncludePaths("/", p.distro)
+		log.Debugf("prepareDistroIncludes - include paths: %+v", includePaths)
+		p.addRuleIncludes(includePaths, fmt.Sprintf("%s distro ruleset", p.distro.Family))
+	}
+}
+
+// prepareDataIncludes finds the include paths for the time zone and the locale data options
+func (p *artifactStore) prepareDataIncludes() {
+	if p.cmd.IncludeTzdata {
+		includePaths := distro.TzdataPaths("/")
+		log.Debugf("prepareDataIncludes - tzdata paths: %+v", includePaths)
+		p.addRuleIncludes(includePaths, "tzdata")
+	}
+
+	if len(p.cmd.IncludeLocales) > 0 {
+		includePaths := distro.LocalePaths("/", p.cmd.IncludeLocales)
+		log.Debugf("prepareDataIncludes - locale paths: %+v", includePaths)
+		p.addRuleIncludes(includePaths, fmt.Sprintf("locales %s", strings.Join(p.cmd.IncludeLocales, ",")))
+	}
+}
+
+func (p *artifactStore) addRuleIncludes(includePaths []string, reason string) {
+	for _, inPath := range includePaths {
+		p.ruleIncludes = append(p.ruleIncludes, ruleInclude{path: inPath, reason: reason})
+	}
+}
+
+// addPackageInfo adds the OS package names to the kept files the package managers installed
+func (p *artifactStore) addPackageInfo() {
+	packages := distro.PackageFiles("/")
+	log.Debugf("addPackageInfo - package files: %v", len(packages))
+	for fileName, props := range p.rawNames {
+		if pkgName, ok := packages[fileName]; ok {
+			props.Package = pkgName
+		}
+	}
+}
+
+// prepareIncludedArtifacts adds the files from the include paths to the report
+// (the include paths are copied as is, so the files are not added to the file and link maps)
+func (p *artifactStore) prepareIncludedArtifacts() {
+	for _, inPath := range p.cmd.Includes {
+		p.prepareIncludedPath(inPath, fmt.Sprintf("include path %s", inPath))
+	}
+
+	for _, include := range p.ruleIncludes {
+		p.prepareIncludedPath(include.path, include.reason)
+	}
+}
+
+func (p *artifactStore) prepareIncludedPath(inPath, reason string) {
+	err := filepath.Walk(inPath, func(fileName string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			log.Debugf("prepareIncludedArtifacts - skipping %v (%v)", fileName, err)
+			return nil
+		}
+
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		if props := p.rawNames[fileName]; props != nil {
+			props.AddReason(report.KeepReasonInclude, reason)
+			return nil
+		}
+
+		props := &report.ArtifactProps{
+			FilePath: fileName,
+			Mode:     fileInfo.Mode(),
+			ModeText: fileInfo.Mode().String(),
+			FileSize: fileInfo.Size(),
+		}
+
+		switch {
+		case fileInfo.Mode().IsRegular():
+			props.FileType = report.FileArtifactType
+			props.Sha1Hash, _ = getFileHash(fileName)
+		case (fileInfo.Mode() & os.ModeSymlink) != 0:
+			props.FileType = report.SymlinkArtifactType
+			props.LinkRef, _ = os.Readlink(fileName)
+		default:
+			return nil
+		}
+
+		props.AddReason(report.KeepReasonInclude, reason)
+		p.rawNames[fileName] = props
+		p.nameList = append(p.nameList, fileName)
+		return nil
+	})
+
+	if err != nil {
+		log.Warnf("prepareIncludedArtifacts - error walking %v: %v", inPath, err)
+	}
+}
+
 func (p *artifactStore) resolveLinks() {
 	for name := range p.resolve {
 		_ = name
@@ -226,22 +424,35 @@ func (p *artifactStore) saveArtifacts() {
 		return paths
 	}
 
-	includePaths = preparePaths(p.cmd.Includes)
+	includeList := append([]string{}, p.cmd.Includes...)
+	for _, include := range p.ruleIncludes {
+		includeList = append(includeList, include.path)
+	}
+
+	includePaths = preparePaths(includeList)
 	excludePaths = preparePaths(p.cmd.Excludes)
 	log.Debugf("saveArtifacts - includePaths: %+v", includePaths)
 	log.Debugf("saveArtifacts - excludePaths: %+v", excludePaths)
 
 	//TODO: use exludePaths to filter discovered files
 	log.Debugf("saveArtifacts - copy %v files", len(p.fileMap))
+	var permErrors int
 	for fileName := range p.fileMap {
 		filePath := fmt.Sprintf("%s/files%s", p.storeLocation, fileName)
 		log.Debug("saveArtifacts - saving file data => ", filePath)
 		err := cpFile(fileName, filePath)
 		if err != nil {
 			log.Warn("saveArtifacts - error saving file => ", err)
+			if os.IsPermission(err) {
+				permErrors++
+			}
 		}
 	}
 
+	if permErrors > 0 {
+		publishWarning(fmt.Sprintf("%v files were not saved (permission denied)", permErrors))
+	}
+
 	//TODO: use exludePaths to filter discovered links
 	log.Debugf("saveArtifacts - copy %v links", len(p.linkMap))
 	for linkName, linkProps := range p.linkMap {
@@ -290,17 +501,6 @@ func (p *artifactStore) saveArtifacts() {
 func (p *artifactStore) saveReport() {
 	sort.Strings(p.nameList)
 
-	creport := report.ContainerReport{
-		Monitors: report.MonitorReports{
-			Pt:  p.ptMonReport,
-			Fan: p.fanMonReport,
-		},
-	}
-
-	for _, fname := range p.nameList {
-		creport.Image.Files = append(creport.Image.Files, p.rawNames[fname])
-	}
-
 	artifactDirName := defaultArtifactDirName
 	reportName := defaultReportName
 
@@ -314,21 +514,114 @@ func (p *artifactStore) saveReport() {
 	reportFilePath := filepath.Join(artifactDirName, reportName)
 	log.Debug("sensor: monitor - saving report to ", reportFilePath)
 
-	reportData, err := json.MarshalIndent(creport, "", "  ")
+	reportFile, err := os.Create(reportFilePath)
 	errutils.FailOn(err)
+	defer reportFile.Close()
 
-	err = ioutil.WriteFile(reportFilePath, reportData, 0644)
-	errutils.FailOn(err)
+	monitors := report.MonitorReports{
+		Pt:  p.ptMonReport,
+		Fan: p.fanMonReport,
+		Net: p.netMonReport,
+	}
+
+	writer := bufio.NewWriter(reportFile)
+	errutils.FailOn(p.writeReport(writer, monitors))
+	errutils.FailOn(writer.Flush())
 }
 
+// writeReport writes the container report encoding the image files one at a time
+// (the report for the images with hundreds of thousands of files is never marshaled in memory as a whole)
+func (p *artifactStore) writeReport(w io.Writer, monitors report.MonitorReports) error {
+	header, err := json.MarshalIndent(struct {
+		SchemaVersion string                `json:"schema_version"`
+		Monitors      report.MonitorReports `json:"monitors"`
+	}{
+		SchemaVersion: report.SchemaVersion,
+		Monitors:      monitors,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//the header object is left open for the image files
+	header = bytes.TrimSuffix(header, []byte("\n}"))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, ",\n  \"image\": {"); err != nil {
+		return err
+	}
+
+	if p.distro != nil {
+		distroData, err := json.MarshalIndent(p.distro, "    ", "  ")
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "\n    \"distro\": %s,", distroData); err != nil {
+			return err
+		}
+	}
+
+	if len(p.libcWarnings) > 0 {
+		warningData, err := json.MarshalIndent(p.libcWarnings, "    ", "  ")
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "\n    \"libc_warnings\": %s,", warningData); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "\n    \"files\": ["); err != nil {
+		return err
+	}
+
+	for idx, fname := range p.nameList {
+		fileData, err := json.MarshalIndent(p.rawNames[fname], "      ", "  ")
+		if err != nil {
+			return err
+		}
+
+		separator := ",\n      "
+		if idx == 0 {
+			separator = "\n      "
+		}
+
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(fileData); err != nil {
+			return err
+		}
+	}
+
+	closing := "]\n  }\n}\n"
+	if len(p.nameList) > 0 {
+		closing = "\n    " + closing
+	}
+
+	_, err = io.WriteString(w, closing)
+	return err
+}
+
+// getFileHash hashes the file as it's read (the large files are not loaded in memory)
 func getFileHash(artifactFileName string) (string, error) {
-	fileData, err := ioutil.ReadFile(artifactFileName)
+	file, err := os.Open(artifactFileName)
 	if err != nil {
 		return "", err
 	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
 
-	hash := sha1.Sum(fileData)
-	return hex.EncodeToString(hash[:]), nil
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func getDataType(artifactFileName string) (string, error) {
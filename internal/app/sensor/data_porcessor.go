@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -18,23 +20,68 @@ func processReports(mountPoint string,
 	fanReport *report.FanMonitorReport,
 	ptReport *report.PtMonitorReport,
 	peReport *report.PeMonitorReport,
+	netReport *report.NetMonitorReport,
 	cmd *command.StartMonitor) {
 
-	fileCount := 0
-	for _, processFileMap := range fanReport.ProcessFiles {
-		fileCount += len(processFileMap)
-	}
-	fileList := make([]string, 0, fileCount)
+	//the same files are usually accessed by many processes, so the file list is deduplicated
+	//(the images with hundreds of thousands of files would have a lot of duplicate paths otherwise)
+	fileSet := map[string]struct{}{}
 	for _, processFileMap := range fanReport.ProcessFiles {
 		for fpath := range processFileMap {
-			fileList = append(fileList, fpath)
+			fileSet[fpath] = struct{}{}
 		}
 	}
 
-	log.Debugf("processReports(): len(fanReport.ProcessFiles)=%v / fileCount=%v", len(fanReport.ProcessFiles), fileCount)
+	fileList := make([]string, 0, len(fileSet))
+	for fpath := range fileSet {
+		fileList = append(fileList, fpath)
+	}
+
+	log.Debugf("processReports(): len(fanReport.ProcessFiles)=%v / fileCount=%v", len(fanReport.ProcessFiles), len(fileList))
 
 	allFilesMap := findSymlinks(fileList, mountPoint)
-	saveResults(fanReport, allFilesMap, ptReport, peReport, cmd)
+	saveResults(fanReport, allFilesMap, ptReport, peReport, netReport, cmd)
+}
+
+// fanReportFromFSActivity creates the file monitoring report from the ptrace file system activity
+// (only the main target app process is traced, so all file activity belongs to it
+// and the target app command is the only executed command)
+func fanReportFromFSActivity(ptReport *report.PtMonitorReport,
+	cmd *command.StartMonitor,
+	redactPattern *regexp.Regexp) *report.FanMonitorReport {
+	fanReport := &report.FanMonitorReport{
+		MonitorPid:       os.Getpid(),
+		MonitorParentPid: os.Getppid(),
+		ProcessFiles:     map[string]map[string]*report.FileInfo{},
+	}
+
+	if ptReport == nil || len(ptReport.FSActivity) == 0 {
+		return fanReport
+	}
+
+	fanReport.Execs = []*report.ExecInfo{
+		{
+			Pid:       int32(ptReport.TargetPid),
+			ParentPid: int32(os.Getpid()),
+			Path:      cmd.AppName,
+			Args:      fanotify.RedactArgs(append([]string{cmd.AppName}, cmd.AppArgs...), redactPattern),
+		},
+	}
+
+	files := map[string]*report.FileInfo{}
+	for fpath, activity := range ptReport.FSActivity {
+		fanReport.EventCount++
+		files[fpath] = &report.FileInfo{
+			EventCount:   uint32(activity.OpsAll),
+			FirstEventID: fanReport.EventCount,
+			Name:         fpath,
+			ReadCount:    uint32(activity.OpsAll - activity.OpsCheckFile),
+			ExeCount:     uint32(activity.OpsExec),
+		}
+	}
+
+	fanReport.ProcessFiles[strconv.Itoa(ptReport.TargetPid)] = files
+	return fanReport
 }
 
 func getProcessChildren(pid int, targetPidList map[int]bool, processChildrenMap map[int][]int) {
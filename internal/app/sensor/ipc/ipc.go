@@ -2,6 +2,7 @@ package ipc
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -16,8 +17,11 @@ import (
 	"github.com/docker-slim/docker-slim/pkg/ipc/event"
 )
 
-// InitChannels initializes the communication channels with the master
-func InitChannels() error {
+// InitChannels initializes the communication channels with the master on the IPC ports
+func InitChannels(cmdPort, evtPort int) error {
+	cmdChannelAddr = fmt.Sprintf(channelAddrPat, cmdPort)
+	evtChannelAddr = fmt.Sprintf(channelAddrPat, evtPort)
+
 	var err error
 	evtChannel, err = newEvtPublisher(evtChannelAddr)
 	if err != nil {
@@ -43,7 +47,35 @@ func RunCmdServer(done <-chan struct{}) (<-chan command.Message, error) {
 	return runCmdServer(cmdChannel, done)
 }
 
-var cmdChannelAddr = fmt.Sprintf("tcp://0.0.0.0:%d", channel.CmdPort)
+// RunHeartbeat starts publishing the heartbeat events
+// (the heartbeats include the last published event, so the master can recover it after a reconnect)
+func RunHeartbeat(done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(channel.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				log.Debug("sensor: heartbeat - done...")
+				return
+			case <-ticker.C:
+				evtLock.Lock()
+				if evtChannel != nil {
+					heartbeat := &event.Message{Name: event.HeartbeatName, Last: lastEvt}
+					if err := publishEvt(evtChannel, heartbeat); err != nil {
+						log.Debugln("sensor: heartbeat - error =>", err)
+					}
+				}
+				evtLock.Unlock()
+			}
+		}
+	}()
+}
+
+const channelAddrPat = "tcp://0.0.0.0:%d"
+
+var cmdChannelAddr = fmt.Sprintf(channelAddrPat, channel.CmdPort)
 
 //var cmdChannelAddr = "ipc:///tmp/docker-slim-sensor.cmds.ipc"
 //var cmdChannelAddr = "ipc:///opt/dockerslim/ipc/docker-slim-sensor.cmds.ipc"
@@ -92,18 +124,28 @@ func runCmdServer(channel mangos.Socket, done <-chan struct{}) (<-chan command.M
 				} else {
 					log.Debug("sensor: cmd server - got a command => ", string(rawCmd))
 
-					if cmd, err := command.Decode(rawCmd); err != nil {
-						log.Println(err)
-					} else {
+					cmd, cmdErr := command.Decode(rawCmd)
+					if cmdErr == nil {
+						cmdErr = validateCmd(cmd)
+					}
+
+					switch {
+					case cmdErr != nil:
+						log.Warnln("sensor: cmd server - bad command =>", cmdErr)
+					case cmd.GetName() == command.PingName:
+					default:
 						cmdChan <- cmd
 					}
 
 					//for now just ack the command and process the command asynchronously
+					//(the malformed and the unknown commands are rejected)
 					//NOTE:
 					//must reply before receiving the next message
 					//otherwise nanomsg/mangos will be confused :-)
-					cmdStatusReply := "ok"
-					err = channel.Send([]byte(cmdStatusReply))
+					cmdStatusReply, err := command.EncodeResponse(cmdErr)
+					if err == nil {
+						err = channel.Send(cmdStatusReply)
+					}
 					if err != nil {
 						log.Warnln("sensor: cmd server - fail to send command status reply =>", err)
 					}
@@ -115,6 +157,20 @@ func runCmdServer(channel mangos.Socket, done <-chan struct{}) (<-chan command.M
 	return cmdChan, nil
 }
 
+// validateCmd checks the master protocol version in the start monitor command (the protocol handshake)
+func validateCmd(cmd command.Message) error {
+	startCmd, ok := cmd.(*command.StartMonitor)
+	if !ok {
+		return nil
+	}
+
+	if err := channel.CheckProtocolVersion(startCmd.ProtocolVersion); err != nil {
+		return fmt.Errorf("incompatible docker-slim (version: %v) - %v", startCmd.MasterVersion, err)
+	}
+
+	return nil
+}
+
 func shutdownCmdChannel() {
 	if cmdChannel != nil {
 		cmdChannel.Close()
@@ -122,12 +178,19 @@ func shutdownCmdChannel() {
 	}
 }
 
-var evtChannelAddr = fmt.Sprintf("tcp://0.0.0.0:%d", channel.EvtPort)
+var evtChannelAddr = fmt.Sprintf(channelAddrPat, channel.EvtPort)
 
 //var evtChannelAddr = "ipc:///tmp/docker-slim-sensor.events.ipc"
 //var evtChannelAddr = "ipc:///opt/dockerslim/ipc/docker-slim-sensor.events.ipc"
 var evtChannel mangos.Socket
 
+//the event sequence numbers and the last event (for the heartbeats)
+var (
+	evtLock sync.Mutex
+	evtSeq  uint64
+	lastEvt *event.Message
+)
+
 func newEvtPublisher(addr string) (mangos.Socket, error) {
 	log.Info("sensor: creating event publisher...")
 	socket, err := pub.NewSocket()
@@ -150,25 +213,52 @@ func newEvtPublisher(addr string) (mangos.Socket, error) {
 	return socket, nil
 }
 
-func publishEvt(channel mangos.Socket, event event.Name) error {
-	log.Debugf("publishEvt(%v)", event)
-	if err := channel.Send([]byte(event)); err != nil {
-		log.Debugf("fail to publish '%v' event:%v", event, err)
+func publishEvt(channel mangos.Socket, msg *event.Message) error {
+	log.Debugf("publishEvt(%v)", msg.Name)
+	data, err := event.Encode(msg)
+	if err != nil {
+		return err
+	}
+
+	if err := channel.Send(data); err != nil {
+		log.Debugf("fail to publish '%v' event:%v", msg.Name, err)
 		return err
 	}
 
 	return nil
 }
 
+// PublishInfoEvt publishes an informational event to the master
+// (the informational events are not numbered and they are not retried)
+func PublishInfoEvt(msg *event.Message) {
+	evtLock.Lock()
+	defer evtLock.Unlock()
+
+	if evtChannel == nil {
+		return
+	}
+
+	if err := publishEvt(evtChannel, msg); err != nil {
+		log.Debugln("sensor: publish info event error =>", err)
+	}
+}
+
 // TryPublishEvt attempts to publish an event to the master
-func TryPublishEvt(ptry uint, event event.Name) {
-	log.Debugf("TryPublishEvt(%v,%v)", ptry, event)
+func TryPublishEvt(ptry uint, name event.Name) {
+	log.Debugf("TryPublishEvt(%v,%v)", ptry, name)
+
+	evtLock.Lock()
+	defer evtLock.Unlock()
+
+	evtSeq++
+	msg := &event.Message{Name: name, Seq: evtSeq}
+	lastEvt = msg
 
 	for ptry := 0; ptry < 3; ptry++ {
-		log.Debugf("sensor: trying to publish '%v' event (attempt %v)", event, ptry+1)
-		err := publishEvt(evtChannel, event)
+		log.Debugf("sensor: trying to publish '%v' event (attempt %v)", name, ptry+1)
+		err := publishEvt(evtChannel, msg)
 		if err == nil {
-			log.Infof("sensor: published '%v'", event)
+			log.Infof("sensor: published '%v'", name)
 			break
 		}
 
@@ -182,6 +272,9 @@ func TryPublishEvt(ptry uint, event event.Name) {
 }
 
 func shutdownEvtChannel() {
+	evtLock.Lock()
+	defer evtLock.Unlock()
+
 	if evtChannel != nil {
 		evtChannel.Close()
 		evtChannel = nil
@@ -0,0 +1,282 @@
+package app
+
+import (
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/distro"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	maxLibcWarnings = 20
+	maxLinkDepth    = 16
+)
+
+// elfDeps are the dynamic linking dependencies of an ELF binary
+type elfDeps struct {
+	interp      string
+	needed      []string
+	searchPaths []string
+}
+
+type libDepTarget struct {
+	fileName string
+	//the C library of the binary that needs the library (empty for the kept files)
+	libc string
+}
+
+// resolveLibDeps adds the shared libraries (and the loaders) the kept ELF binaries need, but the target app
+// didn't load while it was monitored (e.g., the binaries from the include paths or the binaries executed only
+// on some code paths). The libraries are resolved with the loader paths for the C library of each binary.
+// The glibc and musl libraries are never mixed: the binaries linked with the other C library are reported
+// (they crash or don't start in the minified image) and their libraries are not added.
+func (p *artifactStore) resolveLibDeps() {
+	imageLibc := ""
+	if p.distro != nil {
+		imageLibc = p.distro.Libc
+	}
+
+	var queue []libDepTarget
+	for fileName, props := range p.rawNames {
+		if props.FileType == report.FileArtifactType && isELFCandidate(props) {
+			queue = append(queue, libDepTarget{fileName: fileName})
+		}
+	}
+
+	sort.Slice(queue, func(i, j int) bool {
+		return queue[i].fileName < queue[j].fileName
+	})
+
+	libPaths := map[string][]string{}
+	envPaths := filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))
+	checked := map[string]bool{}
+	for len(queue) > 0 {
+		target := queue[0]
+		queue = queue[1:]
+		if checked[target.fileName] {
+			continue
+		}
+
+		checked[target.fileName] = true
+		deps, err := readELFDeps(target.fileName)
+		if err != nil || deps == nil {
+			continue
+		}
+
+		libc := target.libc
+		if deps.interp != "" {
+			libc = distro.InterpLibc(deps.interp)
+		}
+
+		if libc == "" {
+			libc = imageLibc
+		}
+
+		if imageLibc != "" && libc != "" && libc != imageLibc {
+			p.addLibcWarning(fmt.Sprintf("%s is linked with %s (the image uses %s) - its libraries are not added",
+				target.fileName, libc, imageLibc))
+			continue
+		}
+
+		if deps.interp != "" {
+			interpPath := realDirPath(deps.interp)
+			if _, err := os.Stat(interpPath); err != nil {
+				p.addLibcWarning(fmt.Sprintf("%s needs the missing loader %s", target.fileName, deps.interp))
+				continue
+			}
+
+			p.addLibDep(interpPath, fmt.Sprintf("loader for %s", target.fileName))
+		}
+
+		if libc == "" || len(deps.needed) == 0 {
+			continue
+		}
+
+		if _, ok := libPaths[libc]; !ok {
+			libPaths[libc] = distro.LibraryPaths("/", libc)
+			log.Debugf("resolveLibDeps - %s library paths: %+v", libc, libPaths[libc])
+		}
+
+		searchPaths := append(append(append([]string{}, deps.searchPaths...), envPaths...), libPaths[libc]...)
+		for _, libName := range deps.needed {
+			libPath := findLib(libName, searchPaths)
+			if libPath == "" {
+				p.addLibcWarning(fmt.Sprintf("%s needs %s, but it's not in the %s library paths", target.fileName, libName, libc))
+				continue
+			}
+
+			for _, added := range p.addLibDep(libPath, fmt.Sprintf("needed by %s", target.fileName)) {
+				queue = append(queue, libDepTarget{fileName: added, libc: libc})
+			}
+		}
+	}
+
+	if len(p.libcWarnings) > maxLibcWarnings {
+		more := len(p.libcWarnings) - maxLibcWarnings
+		p.libcWarnings = append(p.libcWarnings[:maxLibcWarnings], fmt.Sprintf("%v more C library warnings", more))
+	}
+}
+
+func (p *artifactStore) addLibcWarning(message string) {
+	log.Debugf("resolveLibDeps - %s", message)
+	p.libcWarnings = append(p.libcWarnings, message)
+}
+
+// addLibDep adds the library (and the symlinks to it) to the kept files
+// and returns the regular files it added (their dependencies are not resolved yet)
+func (p *artifactStore) addLibDep(fileName, reason string) []string {
+	var added []string
+	for depth := 0; depth < maxLinkDepth; depth++ {
+		if props, ok := p.rawNames[fileName]; ok {
+			if props.FileType != report.SymlinkArtifactType {
+				return added
+			}
+
+			fileName = linkTargetPath(fileName, props.LinkRef)
+			continue
+		}
+
+		fileInfo, err := os.Lstat(fileName)
+		if err != nil {
+			log.Debugf("resolveLibDeps - skipping %v (%v)", fileName, err)
+			return added
+		}
+
+		props := &report.ArtifactProps{
+			FilePath: fileName,
+			Mode:     fileInfo.Mode(),
+			ModeText: fileInfo.Mode().String(),
+			FileSize: fileInfo.Size(),
+		}
+
+		props.AddReason(report.KeepReasonDependency, reason)
+		switch {
+		case (fileInfo.Mode() & os.ModeSymlink) != 0:
+			linkRef, err := os.Readlink(fileName)
+			if err != nil {
+				return added
+			}
+
+			props.FileType = report.SymlinkArtifactType
+			props.LinkRef = linkRef
+			p.linkMap[fileName] = props
+			p.rawNames[fileName] = props
+			p.nameList = append(p.nameList, fileName)
+			fileName = linkTargetPath(fileName, linkRef)
+		case fileInfo.Mode().IsRegular():
+			props.FileType = report.FileArtifactType
+			props.Sha1Hash, _ = getFileHash(fileName)
+			if fileTypeCmd != "" {
+				props.DataType, _ = getDataType(fileName)
+			}
+
+			p.fileMap[fileName] = props
+			p.rawNames[fileName] = props
+			p.nameList = append(p.nameList, fileName)
+			return append(added, fileName)
+		default:
+			return added
+		}
+	}
+
+	return added
+}
+
+// readELFDeps reads the loader, the needed libraries and the library search paths (RUNPATH or RPATH)
+// of the ELF executable or shared library (it returns nil for the other ELF files)
+func readELFDeps(fileName string) (*elfDeps, error) {
+	file, err := elf.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if file.Type != elf.ET_EXEC && file.Type != elf.ET_DYN {
+		return nil, nil
+	}
+
+	deps := &elfDeps{}
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(prog.Open())
+		if err == nil {
+			deps.interp = strings.TrimRight(string(data), "\x00")
+		}
+	}
+
+	//the static binaries don't have the dynamic section
+	deps.needed, _ = file.DynString(elf.DT_NEEDED)
+	runPaths, _ := file.DynString(elf.DT_RUNPATH)
+	if len(runPaths) == 0 {
+		runPaths, _ = file.DynString(elf.DT_RPATH)
+	}
+
+	origin := filepath.Dir(fileName)
+	for _, runPath := range runPaths {
+		for _, dir := range strings.Split(runPath, ":") {
+			dir = strings.Replace(dir, "${ORIGIN}", origin, -1)
+			dir = strings.Replace(dir, "$ORIGIN", origin, -1)
+			if dir != "" {
+				deps.searchPaths = append(deps.searchPaths, dir)
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// findLib returns the library path in the first search path that has it
+// (the names with a slash are the library paths)
+func findLib(libName string, searchPaths []string) string {
+	if strings.Contains(libName, "/") {
+		if _, err := os.Stat(libName); err == nil {
+			return realDirPath(libName)
+		}
+
+		return ""
+	}
+
+	for _, dir := range searchPaths {
+		libPath := filepath.Join(dir, libName)
+		if _, err := os.Stat(libPath); err == nil {
+			return realDirPath(libPath)
+		}
+	}
+
+	return ""
+}
+
+// realDirPath resolves the directory symlinks in the file path (e.g., '/lib' linked to '/usr/lib'),
+// so the libraries are saved in the real directories and the directory symlinks in the image are not replaced
+func realDirPath(fileName string) string {
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(fileName)); err == nil {
+		return filepath.Join(dir, filepath.Base(fileName))
+	}
+
+	return fileName
+}
+
+func linkTargetPath(linkName, linkRef string) string {
+	if !filepath.IsAbs(linkRef) {
+		linkRef = filepath.Join(filepath.Dir(linkName), linkRef)
+	}
+
+	return realDirPath(linkRef)
+}
+
+// isELFCandidate returns true if the file can be an ELF executable or shared library
+// (only the executable files and the shared libraries are checked)
+func isELFCandidate(props *report.ArtifactProps) bool {
+	return props.Mode&0111 != 0 || isSharedLibrary(props.FilePath)
+}
@@ -0,0 +1,88 @@
+package fanotify
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+const redactedArg = "<redacted>"
+
+// RedactArgs returns the command arguments with the arguments matching the pattern redacted
+// (nil pattern doesn't redact anything). The executable (the first argument) is never redacted.
+// A matching 'name=value' argument keeps its name, a matching flag without a value
+// (e.g., '--password') redacts the next argument and the other matching arguments are redacted completely.
+func RedactArgs(args []string, pattern *regexp.Regexp) []string {
+	if pattern == nil || len(args) == 0 {
+		return args
+	}
+
+	redacted := make([]string, len(args))
+	redacted[0] = args[0]
+	redactNext := false
+	for idx := 1; idx < len(args); idx++ {
+		arg := args[idx]
+		switch {
+		case redactNext:
+			redacted[idx] = redactedArg
+			redactNext = false
+		case !pattern.MatchString(arg):
+			redacted[idx] = arg
+		case strings.Contains(arg, "="):
+			redacted[idx] = fmt.Sprintf("%s=%s", strings.SplitN(arg, "=", 2)[0], redactedArg)
+		case strings.HasPrefix(arg, "-"):
+			redacted[idx] = arg
+			redactNext = true
+		default:
+			redacted[idx] = redactedArg
+		}
+	}
+
+	return redacted
+}
+
+// execInfo returns the executed command if the process executed the file
+// (the executable is opened by the process doing the exec, so the file is the process executable
+// once the exec is done; the processes that exit before their events are handled are not reported)
+func execInfo(pid int32, file string, redactPattern *regexp.Regexp) *report.ExecInfo {
+	exePath, err := os.Readlink(procFilePath(int(pid), "exe"))
+	if err != nil || exePath != file {
+		return nil
+	}
+
+	info := &report.ExecInfo{
+		Pid:       pid,
+		ParentPid: -1,
+		Path:      exePath,
+		Args:      RedactArgs(procArgs(int(pid)), redactPattern),
+	}
+
+	stat, err := ioutil.ReadFile(procFilePath(int(pid), "stat"))
+	if err == nil {
+		//the process name can have spaces, so the fields after the name are parsed
+		if idx := bytes.LastIndexByte(stat, ')'); idx >= 0 {
+			var procStatus string
+			var procPpid int32
+			if _, err := fmt.Sscanf(string(stat[idx+1:]), " %s %d", &procStatus, &procPpid); err == nil {
+				info.ParentPid = procPpid
+			}
+		}
+	}
+
+	return info
+}
+
+func procArgs(pid int) []string {
+	rawCmdline, err := ioutil.ReadFile(procFilePath(pid, "cmdline"))
+	if err != nil || len(rawCmdline) == 0 {
+		return nil
+	}
+
+	rawCmdline = bytes.TrimRight(rawCmdline, "\x00")
+	return strings.Split(string(rawCmdline), "\x00")
+}
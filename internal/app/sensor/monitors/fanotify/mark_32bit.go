@@ -0,0 +1,26 @@
+//go:build 386 || arm
+// +build 386 arm
+
+package fanotify
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// mark adds, removes or modifies the FANOTIFY mark
+// (the 64-bit mask is passed in two registers on the 32-bit architectures)
+func (nd *notifyFD) mark(flags int, mask uint64, dfd int, path string) error {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_FANOTIFY_MARK,
+		nd.f.Fd(), uintptr(flags), uintptr(mask), uintptr(mask>>32), uintptr(dfd), uintptr(unsafe.Pointer(pathPtr)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
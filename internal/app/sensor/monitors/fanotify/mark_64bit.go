@@ -0,0 +1,25 @@
+//go:build amd64 || arm64
+// +build amd64 arm64
+
+package fanotify
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// mark adds, removes or modifies the FANOTIFY mark
+func (nd *notifyFD) mark(flags int, mask uint64, dfd int, path string) error {
+	pathPtr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_FANOTIFY_MARK,
+		nd.f.Fd(), uintptr(flags), uintptr(mask), uintptr(dfd), uintptr(unsafe.Pointer(pathPtr)), 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
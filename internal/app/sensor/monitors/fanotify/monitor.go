@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/docker-slim/docker-slim/pkg/report"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
@@ -23,6 +26,14 @@ type Event struct {
 	IsWrite bool
 }
 
+// Stats is the live monitoring statistics (the fields are updated atomically)
+type Stats struct {
+	Events    uint64
+	Files     uint64
+	Processes uint64
+	Overflows uint64
+}
+
 const (
 	eventBufSize   = 1000
 	procFsFdInfo   = "/proc/self/fd/%d"
@@ -30,15 +41,28 @@ const (
 )
 
 // Run starts the FANOTIFY monitor
-func Run(mountPoint string, stopChan chan struct{}) <-chan *report.FanMonitorReport {
+// (returns an error if FANOTIFY is not available, e.g., when the container doesn't have
+// CAP_SYS_ADMIN in the host user namespace, which is always the case with rootless Docker).
+// The queue size is the event queue size (0 uses the default size) and the stats (optional)
+// are updated while the monitor is running. The executed commands are also recorded
+// (their arguments matching the redaction pattern are redacted; nil doesn't redact anything).
+func Run(mountPoint string,
+	stopChan chan struct{},
+	queueSize int,
+	redactPattern *regexp.Regexp,
+	stats *Stats) (<-chan *report.FanMonitorReport, error) {
 	log.Info("fanmon: Run")
 
-	nd, err := fanapi.Initialize(fanapi.FAN_CLASS_NOTIF, os.O_RDONLY)
-	//TODO: need to propagate the FANOTIFY init failure back to the master instead of just crashing the sensor!
-	errutils.FailOn(err)
-	err = nd.Mark(fanapi.FAN_MARK_ADD|fanapi.FAN_MARK_MOUNT,
+	nd, err := initNotify(fanapi.FAN_CLASS_NOTIF, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nd.mark(fanapi.FAN_MARK_ADD|fanapi.FAN_MARK_MOUNT,
 		fanapi.FAN_MODIFY|fanapi.FAN_ACCESS|fanapi.FAN_OPEN, -1, mountPoint)
-	errutils.FailOn(err)
+	if err != nil {
+		return nil, err
+	}
 
 	resultChan := make(chan *report.FanMonitorReport, 1)
 
@@ -48,22 +72,34 @@ func Run(mountPoint string, stopChan chan struct{}) <-chan *report.FanMonitorRep
 		fanReport := &report.FanMonitorReport{
 			MonitorPid:       os.Getpid(),
 			MonitorParentPid: os.Getppid(),
+			Processes:        make(map[string]*report.ProcessInfo),
 			ProcessFiles:     make(map[string]map[string]*report.FileInfo),
 		}
 
-		eventChan := make(chan Event, eventBufSize)
+		if queueSize <= 0 {
+			queueSize = eventBufSize
+		}
+
+		if stats == nil {
+			stats = &Stats{}
+		}
+
+		//the distinct files observed by all processes
+		seenFiles := map[string]struct{}{}
+		eventChan := make(chan Event, queueSize)
 		go func() {
 			log.Debug("fanmon: collector - starting...")
 			var eventID uint32
 
 			for {
 				//TODO: enhance FA Notify to return the original file handle too
-				data, err := nd.GetEvent()
+				data, err := nd.getEvent()
 				errutils.FailOn(err)
 				log.Debugf("fanmon: collector - data.Mask =>%x", data.Mask)
 
 				if (data.Mask & fanapi.FAN_Q_OVERFLOW) == fanapi.FAN_Q_OVERFLOW {
 					log.Debug("fanmon: collector - overflow event")
+					atomic.AddUint64(&stats.Overflows, 1)
 					continue
 				}
 
@@ -115,18 +151,23 @@ func Run(mountPoint string, stopChan chan struct{}) <-chan *report.FanMonitorRep
 				break done
 			case e := <-eventChan:
 				fanReport.EventCount++
+				atomic.AddUint64(&stats.Events, 1)
 				log.Debugf("fanmon: processor - [%v] handling event %v", fanReport.EventCount, e)
 
+				if _, ok := seenFiles[e.File]; !ok {
+					seenFiles[e.File] = struct{}{}
+					atomic.AddUint64(&stats.Files, 1)
+				}
+
 				if e.ID == 1 {
 					//first event represents the main process
-					if pinfo, err := getProcessInfo(e.Pid); (err == nil) && (pinfo != nil) {
+					if pinfo, err := getProcessInfo(e.Pid, redactPattern); (err == nil) && (pinfo != nil) {
 						fanReport.MainProcess = pinfo
-						fanReport.Processes = make(map[string]*report.ProcessInfo)
 						fanReport.Processes[strconv.Itoa(int(e.Pid))] = pinfo
 					}
 				} else {
 					if _, ok := fanReport.Processes[strconv.Itoa(int(e.Pid))]; !ok {
-						if pinfo, err := getProcessInfo(e.Pid); (err == nil) && (pinfo != nil) {
+						if pinfo, err := getProcessInfo(e.Pid, redactPattern); (err == nil) && (pinfo != nil) {
 							fanReport.Processes[strconv.Itoa(int(e.Pid))] = pinfo
 						}
 					}
@@ -134,9 +175,16 @@ func Run(mountPoint string, stopChan chan struct{}) <-chan *report.FanMonitorRep
 
 				if _, ok := fanReport.ProcessFiles[strconv.Itoa(int(e.Pid))]; !ok {
 					fanReport.ProcessFiles[strconv.Itoa(int(e.Pid))] = make(map[string]*report.FileInfo)
+					atomic.AddUint64(&stats.Processes, 1)
 				}
 
 				if existingFi, ok := fanReport.ProcessFiles[strconv.Itoa(int(e.Pid))][e.File]; !ok {
+					//the executables are checked only the first time the process opens them
+					if exec := execInfo(e.Pid, e.File, redactPattern); exec != nil {
+						log.Debugf("fanmon: processor - exec => %v %v", exec.Path, exec.Args)
+						fanReport.Execs = append(fanReport.Execs, exec)
+					}
+
 					fi := &report.FileInfo{
 						EventCount:   1,
 						Name:         e.File,
@@ -174,18 +222,23 @@ func Run(mountPoint string, stopChan chan struct{}) <-chan *report.FanMonitorRep
 			}
 		}
 
+		fanReport.OverflowCount = uint32(atomic.LoadUint64(&stats.Overflows))
+		if fanReport.OverflowCount > 0 {
+			log.Warnf("fanmon: processor - the kernel event queue overflowed %v times (some file events were dropped)", fanReport.OverflowCount)
+		}
+
 		log.Debugf("fanmon: processor - sending report (processed %v events)...", fanReport.EventCount)
 		resultChan <- fanReport
 	}()
 
-	return resultChan
+	return resultChan, nil
 }
 
 func procFilePath(pid int, key string) string {
 	return fmt.Sprintf(procFsFilePath, pid, key)
 }
 
-func getProcessInfo(pid int32) (*report.ProcessInfo, error) {
+func getProcessInfo(pid int32, redactPattern *regexp.Regexp) (*report.ProcessInfo, error) {
 	info := &report.ProcessInfo{Pid: pid}
 	var err error
 
@@ -213,7 +266,8 @@ func getProcessInfo(pid int32) (*report.ProcessInfo, error) {
 		rawCmdline = bytes.TrimRight(rawCmdline, "\x00")
 		//NOTE: later/future (when we do more app analytics)
 		//split rawCmdline and resolve the "entry point" (exe or cmd param)
-		info.Cmd = string(bytes.Replace(rawCmdline, []byte("\x00"), []byte(" "), -1))
+		args := RedactArgs(strings.Split(string(rawCmdline), "\x00"), redactPattern)
+		info.Cmd = strings.Join(args, " ")
 	}
 
 	//note: will need to get "environ" at some point :)
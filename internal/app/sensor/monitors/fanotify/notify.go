@@ -0,0 +1,57 @@
+package fanotify
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"syscall"
+
+	fanapi "bitbucket.org/madmo/fanotify"
+)
+
+// notifyFD is the FANOTIFY group file descriptor
+// (the vendored fanotify package doesn't have the fanotify_mark() wrapper for all sensor architectures
+// and it doesn't expose its file descriptor, so the sensor uses its own notify group wrapper)
+type notifyFD struct {
+	f *os.File
+	r *bufio.Reader
+}
+
+// the event metadata layout (struct fanotify_event_metadata)
+type eventMetadata struct {
+	Len         uint32
+	Version     uint8
+	Reserved    uint8
+	MetadataLen uint16
+	Mask        uint64
+	Fd          int32
+	Pid         int32
+}
+
+func initNotify(faflags, openflags int) (*notifyFD, error) {
+	fd, _, errno := syscall.Syscall(syscall.SYS_FANOTIFY_INIT, uintptr(faflags), uintptr(openflags), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	f := os.NewFile(fd, "")
+	return &notifyFD{f: f, r: bufio.NewReader(f)}, nil
+}
+
+// getEvent reads the next event (the caller closes the event file)
+func (nd *notifyFD) getEvent() (*fanapi.EventMetadata, error) {
+	ev := &eventMetadata{}
+	if err := binary.Read(nd.r, binary.LittleEndian, ev); err != nil {
+		return nil, err
+	}
+
+	return &fanapi.EventMetadata{
+		Len:         ev.Len,
+		Version:     ev.Version,
+		Reserved:    ev.Reserved,
+		MetadataLen: ev.MetadataLen,
+		Mask:        ev.Mask,
+		File:        os.NewFile(uintptr(ev.Fd), ""),
+		Pid:         ev.Pid,
+	}, nil
+}
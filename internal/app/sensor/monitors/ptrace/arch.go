@@ -0,0 +1,90 @@
+package ptrace
+
+import (
+	"github.com/cloudimmunity/system"
+)
+
+// architecture (and system call ABI) names not defined in the system package
+const (
+	archNameArm64 system.ArchName = "arm64"
+	archNameX32   system.ArchName = "x32"
+)
+
+// x32 ABI system calls are x86_64 system calls with this bit set
+const x32SyscallBit = 0x40000000
+
+// the x32 ABI uses its own numbers for the system calls with different argument structures
+const x32SyscallMinNum = 512
+
+var syscallNumTableX32 = [...]string{
+	"rt_sigaction",
+	"rt_sigreturn",
+	"ioctl",
+	"readv",
+	"writev",
+	"recvfrom",
+	"sendmsg",
+	"recvmsg",
+	"execve",
+	"ptrace",
+	"rt_sigpending",
+	"rt_sigtimedwait",
+	"rt_sigqueueinfo",
+	"sigaltstack",
+	"timer_create",
+	"mq_notify",
+	"kexec_load",
+	"waitid",
+	"set_robust_list",
+	"get_robust_list",
+	"vmsplice",
+	"move_pages",
+	"preadv",
+	"pwritev",
+	"rt_tgsigqueueinfo",
+	"recvmmsg",
+	"sendmmsg",
+	"process_vm_readv",
+	"process_vm_writev",
+	"setsockopt",
+	"getsockopt",
+	"io_setup",
+	"io_submit",
+	"execveat",
+	"preadv2",
+	"pwritev2",
+}
+
+func callNameX32(num int16) string {
+	if num >= x32SyscallMinNum {
+		if idx := int(num) - x32SyscallMinNum; idx < len(syscallNumTableX32) {
+			return syscallNumTableX32[idx]
+		}
+
+		return system.SyscallX86UnknownName
+	}
+
+	return system.CallNumberResolver(system.ArchNameAmd64)(num)
+}
+
+// targetArchName maps the machine name to the architecture name (the system package doesn't support arm64)
+func targetArchName(machine string) system.ArchName {
+	switch machine {
+	case "aarch64", "arm64":
+		return archNameArm64
+	default:
+		return system.MachineToArchName(machine)
+	}
+}
+
+// callNumberResolver returns the system call name resolver for the architecture (or system call ABI)
+func callNumberResolver(arch system.ArchName) system.NumberResolverFunc {
+	switch arch {
+	case archNameArm64:
+		return callNameArm64
+	case archNameX32:
+		return callNameX32
+	default:
+		return system.CallNumberResolver(arch)
+	}
+}
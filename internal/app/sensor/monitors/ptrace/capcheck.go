@@ -0,0 +1,416 @@
+package ptrace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/cloudimmunity/system"
+)
+
+// the capabilities the checked system calls need (the same names the master app uses)
+const (
+	capDacOverride    = "DAC_OVERRIDE"
+	capFowner         = "FOWNER"
+	capKill           = "KILL"
+	capMknod          = "MKNOD"
+	capNetBindService = "NET_BIND_SERVICE"
+	capSysResource    = "SYS_RESOURCE"
+)
+
+const (
+	maxCallArgs       = 4
+	maxPrivilegedPort = 1023
+	procFsPidStatus   = "/proc/%d/status"
+	rlimitInfinity32  = 0xffffffff
+	//the open flags (the same values for all supported ABIs)
+	openPath = 0x200000
+)
+
+// file access mask bits
+const (
+	accessRead  = 4
+	accessWrite = 2
+	accessExec  = 1
+)
+
+// capCall is a system call with its arguments at the system call entry stop
+// (the file path is set for the tracked file system calls)
+type capCall struct {
+	pid    int
+	name   string
+	abi    system.ArchName
+	args   [maxCallArgs]uint64
+	fsPath string
+}
+
+// capChecks are the system calls that need a capability only with some arguments or credentials
+// (e.g., prlimit64 needs SYS_RESOURCE only to raise the hard limit and kill needs KILL only
+// for the processes of other users). Each check returns the capability the call needs
+// if it succeeds (the permission checks without the capability would fail) or an empty string.
+var capChecks = map[string]func(call *capCall) string{
+	"open":      checkOpen,
+	"openat":    checkOpen,
+	"chmod":     checkChmod,
+	"fchmod":    checkChmod,
+	"fchmodat":  checkChmod,
+	"kill":      checkKill,
+	"tkill":     checkKill,
+	"tgkill":    checkKill,
+	"setrlimit": checkRlimit,
+	"prlimit64": checkRlimit,
+	"mknod":     checkMknod,
+	"mknodat":   checkMknod,
+	"bind":      checkBind,
+}
+
+// capCheck returns the capability the system call needs if it succeeds (or an empty string)
+func capCheck(call *capCall) string {
+	if check, ok := capChecks[call.name]; ok {
+		return check(call)
+	}
+
+	return ""
+}
+
+// checkOpen finds the files opened with the access their mode doesn't allow
+// and the files created in the directories the process can't write to (they need DAC_OVERRIDE)
+func checkOpen(call *capCall) string {
+	info := fsCalls[call.name]
+	flags := call.args[1]
+	if info.at {
+		flags = call.args[2]
+	}
+
+	var mask uint32
+	switch flags & syscall.O_ACCMODE {
+	case syscall.O_RDONLY:
+		mask = accessRead
+	case syscall.O_WRONLY:
+		mask = accessWrite
+	case syscall.O_RDWR:
+		mask = accessRead | accessWrite
+	}
+
+	if flags&syscall.O_TRUNC != 0 {
+		mask |= accessWrite
+	}
+
+	if flags&openPath != 0 {
+		return ""
+	}
+
+	fpath := call.fsPath
+	if fpath == "" {
+		fpath = callPath(call.pid, info, call.args[0], call.args[1])
+	}
+
+	if fpath == "" || isIgnoredPath(fpath) {
+		return ""
+	}
+
+	var fileInfo syscall.Stat_t
+	if err := syscall.Stat(fpath, &fileInfo); err != nil {
+		if err != syscall.ENOENT || flags&syscall.O_CREAT == 0 {
+			return ""
+		}
+
+		//a new file needs the write access to its directory
+		if err := syscall.Stat(filepath.Dir(fpath), &fileInfo); err != nil {
+			return ""
+		}
+
+		mask = accessWrite | accessExec
+	}
+
+	//the files everybody can access (most files) don't need the process credentials
+	if fileInfo.Mode&mask == mask {
+		return ""
+	}
+
+	creds, err := readCreds(call.pid)
+	if err != nil || creds.hasAccess(&fileInfo, mask) {
+		return ""
+	}
+
+	return capDacOverride
+}
+
+// checkChmod finds the mode changes for the files the process doesn't own (they need FOWNER)
+func checkChmod(call *capCall) string {
+	var fpath string
+	switch call.name {
+	case "fchmod":
+		fpath = fmt.Sprintf(procFsPidFdPat, call.pid, int32(call.args[0]))
+	case "fchmodat":
+		fpath = callPath(call.pid, fsCallInfo{at: true}, call.args[0], call.args[1])
+	default:
+		fpath = callPath(call.pid, fsCallInfo{}, call.args[0], call.args[1])
+	}
+
+	var fileInfo syscall.Stat_t
+	if fpath == "" || syscall.Stat(fpath, &fileInfo) != nil {
+		return ""
+	}
+
+	creds, err := readCreds(call.pid)
+	if err != nil || creds.fsuid == fileInfo.Uid {
+		return ""
+	}
+
+	return capFowner
+}
+
+// checkKill finds the signals sent to the processes of other users (they need KILL)
+// (the signals sent to the process groups and to all processes are not checked)
+func checkKill(call *capCall) string {
+	target := int(int32(call.args[0]))
+	if call.name == "tgkill" {
+		target = int(int32(call.args[1]))
+	}
+
+	if target <= 0 || target == call.pid {
+		return ""
+	}
+
+	sender, err := readCreds(call.pid)
+	if err != nil {
+		return ""
+	}
+
+	receiver, err := readCreds(target)
+	if err != nil {
+		return ""
+	}
+
+	if sender.euid == receiver.ruid || sender.euid == receiver.suid ||
+		sender.ruid == receiver.ruid || sender.ruid == receiver.suid {
+		return ""
+	}
+
+	return capKill
+}
+
+// checkRlimit finds the resource limit changes that raise the hard limit (they need SYS_RESOURCE)
+// (reading the limits and changing the soft limits don't need it)
+func checkRlimit(call *capCall) string {
+	target := call.pid
+	resource, limitAddr := call.args[0], call.args[1]
+	is32 := call.abi == system.ArchName386
+	if call.name == "prlimit64" {
+		if pid := int(int32(call.args[0])); pid != 0 {
+			target = pid
+		}
+
+		resource, limitAddr = call.args[1], call.args[2]
+		is32 = false
+	}
+
+	if limitAddr == 0 {
+		return ""
+	}
+
+	var newMax uint64
+	if is32 {
+		data := readData(call.pid, limitAddr, 8)
+		if len(data) != 8 {
+			return ""
+		}
+
+		newMax = uint64(binary.LittleEndian.Uint32(data[4:]))
+		if newMax == rlimitInfinity32 {
+			newMax = ^uint64(0)
+		}
+	} else {
+		data := readData(call.pid, limitAddr, 16)
+		if len(data) != 16 {
+			return ""
+		}
+
+		newMax = binary.LittleEndian.Uint64(data[8:])
+	}
+
+	var current [2]uint64
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		uintptr(target), uintptr(resource), 0, uintptr(unsafe.Pointer(&current)), 0, 0)
+	if errno != 0 || newMax <= current[1] {
+		return ""
+	}
+
+	return capSysResource
+}
+
+// checkMknod finds the device files (the other special files don't need MKNOD)
+func checkMknod(call *capCall) string {
+	mode := call.args[1]
+	if call.name == "mknodat" {
+		mode = call.args[2]
+	}
+
+	switch uint32(mode) & syscall.S_IFMT {
+	case syscall.S_IFCHR, syscall.S_IFBLK:
+		return capMknod
+	}
+
+	return ""
+}
+
+// checkBind finds the binds to the privileged ports (they need NET_BIND_SERVICE unless the privileged
+// port range is changed, e.g., Docker lets the containers bind to all ports, but Kubernetes doesn't)
+func checkBind(call *capCall) string {
+	data := readData(call.pid, call.args[1], 4)
+	if len(data) != 4 {
+		return ""
+	}
+
+	//the address family is in the host byte order (little endian on the supported architectures)
+	//and the port is in the network byte order
+	family := binary.LittleEndian.Uint16(data)
+	if family != syscall.AF_INET && family != syscall.AF_INET6 {
+		return ""
+	}
+
+	port := binary.BigEndian.Uint16(data[2:])
+	if port == 0 || port > maxPrivilegedPort {
+		return ""
+	}
+
+	return capNetBindService
+}
+
+func isIgnoredPath(fpath string) bool {
+	for _, prefix := range fsIgnoredPrefixes {
+		if strings.HasPrefix(fpath, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readData reads the data from the process memory
+func readData(pid int, addr uint64, size int) []byte {
+	if addr == 0 {
+		return nil
+	}
+
+	mem, err := os.Open(fmt.Sprintf(procFsPidMem, pid))
+	if err != nil {
+		return nil
+	}
+	defer mem.Close()
+
+	data := make([]byte, size)
+	n, _ := mem.ReadAt(data, int64(addr))
+	return data[:n]
+}
+
+// procCreds are the process credentials (from the proc status file)
+type procCreds struct {
+	ruid   uint32
+	euid   uint32
+	suid   uint32
+	fsuid  uint32
+	fsgid  uint32
+	groups []uint32
+}
+
+func readCreds(pid int) (*procCreds, error) {
+	file, err := os.Open(fmt.Sprintf(procFsPidStatus, pid))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var creds procCreds
+	var gotUids, gotGids bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "Uid:":
+			ids, err := parseIDs(fields[1:])
+			if err != nil || len(ids) != 4 {
+				return nil, fmt.Errorf("unexpected Uid line - %v", fields)
+			}
+
+			creds.ruid, creds.euid, creds.suid, creds.fsuid = ids[0], ids[1], ids[2], ids[3]
+			gotUids = true
+		case "Gid:":
+			ids, err := parseIDs(fields[1:])
+			if err != nil || len(ids) != 4 {
+				return nil, fmt.Errorf("unexpected Gid line - %v", fields)
+			}
+
+			creds.fsgid = ids[3]
+			gotGids = true
+		case "Groups:":
+			if creds.groups, err = parseIDs(fields[1:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !gotUids || !gotGids {
+		return nil, fmt.Errorf("no credentials for process %v", pid)
+	}
+
+	return &creds, nil
+}
+
+func parseIDs(fields []string) ([]uint32, error) {
+	var ids []uint32
+	for _, field := range fields {
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, uint32(id))
+	}
+
+	return ids, nil
+}
+
+// inGroup returns true if the group is the process file system group or one of its supplementary groups
+func (c *procCreds) inGroup(gid uint32) bool {
+	if c.fsgid == gid {
+		return true
+	}
+
+	for _, group := range c.groups {
+		if group == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasAccess checks the file mode permission bits for the access mask
+// the same way the kernel does it for the processes without DAC_OVERRIDE
+func (c *procCreds) hasAccess(fileInfo *syscall.Stat_t, mask uint32) bool {
+	mode := fileInfo.Mode & 0777
+	switch {
+	case c.fsuid == fileInfo.Uid:
+		mode >>= 6
+	case c.inGroup(fileInfo.Gid):
+		mode >>= 3
+	}
+
+	return mode&mask == mask
+}
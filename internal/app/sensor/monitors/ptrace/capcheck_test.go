@@ -0,0 +1,164 @@
+package ptrace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestHasAccess(t *testing.T) {
+	creds := &procCreds{fsuid: 1000, fsgid: 1000, groups: []uint32{1000, 50}}
+
+	tests := []struct {
+		name     string
+		uid      uint32
+		gid      uint32
+		mode     uint32
+		mask     uint32
+		expected bool
+	}{
+		{name: "owner read", uid: 1000, gid: 0, mode: 0400, mask: accessRead, expected: true},
+		{name: "owner write denied", uid: 1000, gid: 0, mode: 0466, mask: accessWrite, expected: false},
+		{name: "group write", uid: 0, gid: 50, mode: 0460, mask: accessWrite, expected: true},
+		{name: "group read denied", uid: 0, gid: 50, mode: 0604, mask: accessRead, expected: false},
+		{name: "other read", uid: 0, gid: 0, mode: 0644, mask: accessRead, expected: true},
+		{name: "other write denied", uid: 0, gid: 0, mode: 0644, mask: accessRead | accessWrite, expected: false},
+	}
+
+	for _, test := range tests {
+		fileInfo := &syscall.Stat_t{Uid: test.uid, Gid: test.gid, Mode: syscall.S_IFREG | test.mode}
+		if access := creds.hasAccess(fileInfo, test.mask); access != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, access)
+		}
+	}
+}
+
+func TestCheckOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dslim-capcheck-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "private")
+	if err := ioutil.WriteFile(private, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := filepath.Join(dir, "locked")
+	if err := ioutil.WriteFile(locked, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		flags    uint64
+		expected string
+	}{
+		{name: "own file", path: private, flags: syscall.O_RDWR},
+		{name: "own file without access", path: locked, flags: syscall.O_RDONLY, expected: capDacOverride},
+		{name: "own file truncated", path: locked, flags: syscall.O_RDONLY | syscall.O_TRUNC, expected: capDacOverride},
+		{name: "path only", path: locked, flags: openPath},
+		{name: "new file", path: filepath.Join(dir, "new"), flags: syscall.O_WRONLY | syscall.O_CREAT},
+		{name: "missing file", path: filepath.Join(dir, "missing"), flags: syscall.O_RDONLY},
+		{name: "pseudo file", path: "/proc/self/status", flags: syscall.O_RDONLY},
+	}
+
+	for _, test := range tests {
+		call := &capCall{
+			pid:    os.Getpid(),
+			name:   "openat",
+			args:   [maxCallArgs]uint64{0, 0, test.flags},
+			fsPath: test.path,
+		}
+
+		if capName := checkOpen(call); capName != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.name, test.expected, capName)
+		}
+	}
+}
+
+func TestCheckBind(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     syscall.RawSockaddrInet4
+		expected string
+	}{
+		{name: "privileged port", addr: syscall.RawSockaddrInet4{Family: syscall.AF_INET, Port: 0x5000}, expected: capNetBindService},
+		{name: "unprivileged port", addr: syscall.RawSockaddrInet4{Family: syscall.AF_INET, Port: 0x901f}},
+		{name: "any port", addr: syscall.RawSockaddrInet4{Family: syscall.AF_INET}},
+		{name: "unix socket", addr: syscall.RawSockaddrInet4{Family: syscall.AF_UNIX, Port: 0x5000}},
+	}
+
+	for _, test := range tests {
+		//the address is read from the process memory (the test process is the traced process here)
+		call := &capCall{
+			pid:  os.Getpid(),
+			name: "bind",
+			args: [maxCallArgs]uint64{3, uint64(uintptr(unsafe.Pointer(&test.addr)))},
+		}
+
+		if capName := checkBind(call); capName != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.name, test.expected, capName)
+		}
+	}
+}
+
+func TestCheckRlimit(t *testing.T) {
+	var current syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &current); err != nil {
+		t.Fatal(err)
+	}
+
+	lowered := syscall.Rlimit{Cur: current.Cur / 2, Max: current.Max}
+	raised := syscall.Rlimit{Cur: current.Cur, Max: current.Max + 1}
+
+	tests := []struct {
+		name     string
+		limit    *syscall.Rlimit
+		expected string
+	}{
+		{name: "read only"},
+		{name: "soft limit", limit: &lowered},
+	}
+
+	//the unlimited hard limit can't be raised
+	if current.Max != ^uint64(0) {
+		tests = append(tests, struct {
+			name     string
+			limit    *syscall.Rlimit
+			expected string
+		}{name: "hard limit", limit: &raised, expected: capSysResource})
+	}
+
+	for _, test := range tests {
+		var limitAddr uint64
+		if test.limit != nil {
+			limitAddr = uint64(uintptr(unsafe.Pointer(test.limit)))
+		}
+
+		call := &capCall{
+			pid:  os.Getpid(),
+			name: "prlimit64",
+			args: [maxCallArgs]uint64{0, syscall.RLIMIT_NOFILE, limitAddr},
+		}
+
+		if capName := checkRlimit(call); capName != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.name, test.expected, capName)
+		}
+	}
+}
+
+func TestCheckMknod(t *testing.T) {
+	if capName := checkMknod(&capCall{name: "mknod", args: [maxCallArgs]uint64{0, syscall.S_IFIFO | 0644}}); capName != "" {
+		t.Errorf("fifo: unexpected capability %q", capName)
+	}
+
+	if capName := checkMknod(&capCall{name: "mknodat", args: [maxCallArgs]uint64{0, 0, syscall.S_IFCHR | 0600}}); capName != capMknod {
+		t.Errorf("device: expected %q, got %q", capMknod, capName)
+	}
+}
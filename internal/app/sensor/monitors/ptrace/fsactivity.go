@@ -0,0 +1,147 @@
+package ptrace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker-slim/docker-slim/pkg/report"
+)
+
+// fsCallInfo describes the system calls with a file path argument
+// (the path is the first argument or the second argument after the directory fd for the *at calls)
+type fsCallInfo struct {
+	at        bool
+	checkFile bool
+	exec      bool
+}
+
+var fsCalls = map[string]fsCallInfo{
+	"open":       {},
+	"openat":     {at: true},
+	"openat2":    {at: true},
+	"execve":     {exec: true},
+	"execveat":   {at: true, exec: true},
+	"stat":       {checkFile: true},
+	"stat64":     {checkFile: true},
+	"lstat":      {checkFile: true},
+	"lstat64":    {checkFile: true},
+	"newfstatat": {at: true, checkFile: true},
+	"fstatat64":  {at: true, checkFile: true},
+	"statx":      {at: true, checkFile: true},
+	"access":     {checkFile: true},
+	"faccessat":  {at: true, checkFile: true},
+	"faccessat2": {at: true, checkFile: true},
+	"readlink":   {checkFile: true},
+	"readlinkat": {at: true, checkFile: true},
+}
+
+const (
+	atFdCwd        = -100
+	pathMaxLen     = 4096
+	pathReadChunk  = 256
+	procFsPidMem   = "/proc/%d/mem"
+	procFsPidCwd   = "/proc/%d/cwd"
+	procFsPidExe   = "/proc/%d/exe"
+	procFsPidFdPat = "/proc/%d/fd/%d"
+)
+
+// the pseudo file systems are not a part of the image
+var fsIgnoredPrefixes = []string{"/proc/", "/sys/", "/dev/"}
+
+// callPath returns the absolute file path used by the system call at the system call entry stop
+// (the relative paths are resolved using the process working directory or the directory fd)
+func callPath(pid int, info fsCallInfo, arg0, arg1 uint64) string {
+	pathAddr := arg0
+	dirFd := atFdCwd
+	if info.at {
+		dirFd = int(int32(arg0))
+		pathAddr = arg1
+	}
+
+	fpath := readString(pid, pathAddr)
+	if fpath == "" {
+		return ""
+	}
+
+	if !filepath.IsAbs(fpath) {
+		baseLink := fmt.Sprintf(procFsPidCwd, pid)
+		if dirFd != atFdCwd {
+			baseLink = fmt.Sprintf(procFsPidFdPat, pid, dirFd)
+		}
+
+		baseDir, err := os.Readlink(baseLink)
+		if err != nil {
+			return ""
+		}
+
+		fpath = filepath.Join(baseDir, fpath)
+	}
+
+	return filepath.Clean(fpath)
+}
+
+// readString reads a null terminated string from the process memory
+// (the memory file is opened for each read because it becomes invalid after execve)
+func readString(pid int, addr uint64) string {
+	if addr == 0 {
+		return ""
+	}
+
+	mem, err := os.Open(fmt.Sprintf(procFsPidMem, pid))
+	if err != nil {
+		return ""
+	}
+	defer mem.Close()
+
+	var data []byte
+	buf := make([]byte, pathReadChunk)
+	for len(data) < pathMaxLen {
+		n, err := mem.ReadAt(buf, int64(addr)+int64(len(data)))
+		if idx := bytes.IndexByte(buf[:n], 0); idx >= 0 {
+			return string(append(data, buf[:idx]...))
+		}
+
+		if err != nil || n == 0 {
+			return ""
+		}
+
+		data = append(data, buf[:n]...)
+	}
+
+	return ""
+}
+
+// addFSActivity records the successful file system call
+// (the directories and the pseudo file system paths are skipped and the symlink targets are also added)
+func addFSActivity(activity map[string]*report.FSActivityInfo, fpath string, info fsCallInfo) {
+	if _, ok := activity[fpath]; !ok {
+		for _, prefix := range fsIgnoredPrefixes {
+			if strings.HasPrefix(fpath, prefix) {
+				return
+			}
+		}
+
+		fileInfo, err := os.Stat(fpath)
+		if err != nil || fileInfo.IsDir() {
+			return
+		}
+
+		activity[fpath] = &report.FSActivityInfo{}
+		if target, err := filepath.EvalSymlinks(fpath); err == nil && target != fpath {
+			addFSActivity(activity, target, info)
+		}
+	}
+
+	fsInfo := activity[fpath]
+	fsInfo.OpsAll++
+	if info.checkFile {
+		fsInfo.OpsCheckFile++
+	}
+
+	if info.exec {
+		fsInfo.OpsExec++
+	}
+}
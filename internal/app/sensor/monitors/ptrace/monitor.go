@@ -1,9 +1,14 @@
 package ptrace
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/docker-slim/docker-slim/internal/app/sensor/target"
@@ -15,25 +20,113 @@ import (
 )
 
 type syscallEvent struct {
-	callNum int16
-	retVal  uint64
+	callNum    int16
+	abi        system.ArchName
+	retVal     uint64
+	isSocket   bool
+	sockFamily uint64
+	sockType   uint64
+	fsPath     string
+	fsCall     fsCallInfo
+	capName    string
+	capSyscall string
+}
+
+// syscallID identifies a system call (the same system call has different numbers in different ABIs)
+type syscallID struct {
+	abi system.ArchName
+	num int16
+}
+
+// Stats is the live monitoring statistics (the fields are updated atomically)
+type Stats struct {
+	Syscalls uint64
+	//the files observed when the file system activity is tracked
+	Files uint64
 }
 
 const (
 	eventBufSize = 500
+	procFsTasks  = "/proc/self/task"
+	socketCall   = "socket"
+	sockTypeMask = 0xf //SOCK_NONBLOCK and SOCK_CLOEXEC are ORed with the socket type
 )
 
+var sockFamilyNames = map[uint64]string{
+	syscall.AF_UNIX:    "unix",
+	syscall.AF_INET:    "inet",
+	syscall.AF_INET6:   "inet6",
+	syscall.AF_NETLINK: "netlink",
+	syscall.AF_PACKET:  "packet",
+}
+
+var sockTypeNames = map[uint64]string{
+	syscall.SOCK_STREAM:    "stream",
+	syscall.SOCK_DGRAM:     "dgram",
+	syscall.SOCK_RAW:       "raw",
+	syscall.SOCK_RDM:       "rdm",
+	syscall.SOCK_SEQPACKET: "seqpacket",
+}
+
+func sockFamilyName(family uint64) string {
+	if name, ok := sockFamilyNames[family]; ok {
+		return name
+	}
+
+	return strconv.FormatUint(family, 10)
+}
+
+func sockTypeName(sockType uint64) string {
+	if name, ok := sockTypeNames[sockType]; ok {
+		return name
+	}
+
+	return strconv.FormatUint(sockType, 10)
+}
+
 // Run starts the PTRACE monitor
+// (trackFiles enables the file system activity tracking when the FANOTIFY monitor is not available).
+// The sample rate makes the monitor record only one of each N calls of the same system call
+// (the socket calls and the tracked file system calls are always recorded; the other calls are only counted).
+// The queue size is the event queue size (0 uses the default size) and the nice value is applied
+// to the sensor threads once the target app is started (the target app and the tracer thread are not affected,
+// because the target app waits for the tracer thread at each system call).
+// The stats (optional) are updated while the monitor is running.
 func Run(startChan <-chan int,
 	stopChan chan struct{},
 	appName string,
 	appArgs []string,
-	dirName string) <-chan *report.PtMonitorReport {
+	dirName string,
+	trackFiles bool,
+	sampleRate int,
+	queueSize int,
+	nice int,
+	stats *Stats) <-chan *report.PtMonitorReport {
 	log.Info("ptmon: Run")
 
 	sysInfo := system.GetSystemInfo()
-	archName := system.MachineToArchName(sysInfo.Machine)
-	syscallResolver := system.CallNumberResolver(archName)
+	archName := targetArchName(sysInfo.Machine)
+	syscallResolver := callNumberResolver(archName)
+
+	//the target app can also use the 32-bit compat system call ABIs
+	abiResolvers := map[system.ArchName]system.NumberResolverFunc{}
+	resolveCallName := func(abi system.ArchName, num int16) string {
+		if abi == "" {
+			return syscallResolver(num)
+		}
+
+		resolver, ok := abiResolvers[abi]
+		if !ok {
+			resolver = callNumberResolver(abi)
+			abiResolvers[abi] = resolver
+		}
+
+		if resolver == nil {
+			return system.SyscallX86UnknownName
+		}
+
+		return resolver(num)
+	}
 
 	resultChan := make(chan *report.PtMonitorReport, 1)
 
@@ -41,13 +134,32 @@ func Run(startChan <-chan int,
 		log.Debug("ptmon: processor - starting...")
 
 		ptReport := &report.PtMonitorReport{
-			ArchName:     string(archName),
-			SyscallStats: map[string]report.SyscallStatInfo{},
+			ArchName:        string(archName),
+			SyscallStats:    map[string]report.SyscallStatInfo{},
+			SocketStats:     map[string]report.SocketStatInfo{},
+			CapabilityStats: map[string]report.CapabilityStatInfo{},
+		}
+
+		if trackFiles {
+			ptReport.FSActivity = map[string]*report.FSActivityInfo{}
 		}
 
-		syscallStats := map[int16]uint64{}
-		eventChan := make(chan syscallEvent, eventBufSize)
+		if queueSize <= 0 {
+			queueSize = eventBufSize
+		}
+
+		if stats == nil {
+			stats = &Stats{}
+		}
+
+		syscallStats := map[syscallID]uint64{}
+		eventChan := make(chan syscallEvent, queueSize)
+		//the system calls that were counted, but not recorded (see the sample rate)
+		var sampledOutLock sync.Mutex
+		sampledOut := map[syscallID]uint64{}
 		collectorDoneChan := make(chan int, 1)
+		//the target app is executed before it's traced, so its executable paths are reported separately
+		appPathsChan := make(chan []string, 1)
 
 		var app *exec.Cmd
 
@@ -63,6 +175,10 @@ func Run(startChan <-chan int,
 
 			log.Debugf("ptmon: collector - target PID ==> %d", targetPid)
 
+			if nice != 0 {
+				reniceSensor(nice, syscall.Gettid())
+			}
+
 			var wstat syscall.WaitStatus
 			_, err = syscall.Wait4(targetPid, &wstat, 0, nil)
 			if err != nil {
@@ -73,6 +189,15 @@ func Run(startChan <-chan int,
 
 			log.Debugln("ptmon: initial process status =>", wstat)
 
+			if trackFiles {
+				appPaths := []string{app.Path}
+				if exePath, err := os.Readlink(fmt.Sprintf(procFsPidExe, targetPid)); err == nil {
+					appPaths = append(appPaths, exePath)
+				}
+
+				appPathsChan <- appPaths
+			}
+
 			if wstat.Exited() {
 				log.Warn("ptmon: collector - app exited (unexpected)")
 				collectorDoneChan <- 2
@@ -85,11 +210,27 @@ func Run(startChan <-chan int,
 				return
 			}
 
-			syscallReturn := false
-			gotCallNum := false
+			//the initial stop is the execve exit stop (the target app is traced from its exec),
+			//so it's handled as the system call return to keep the entry and exit stops in sync
+			var initRegs syscall.PtraceRegs
+			if err := syscall.PtraceGetRegs(targetPid, &initRegs); err != nil {
+				log.Fatalf("ptmon: collector - PtraceGetRegs(init): %v", err)
+			}
+
+			callNum, callABI := callInfo(&initRegs)
+			syscallReturn := true
+			gotCallNum := true
+			sampled := true
+			seen := map[syscallID]int{}
 			gotRetVal := false
-			var callNum uint64
 			var retVal uint64
+			var isSocket bool
+			var sockFamily uint64
+			var sockType uint64
+			var fsPath string
+			var fsCall fsCallInfo
+			var capName string
+			var capSyscall string
 			for wstat.Stopped() {
 				var regs syscall.PtraceRegs
 
@@ -99,16 +240,57 @@ func Run(startChan <-chan int,
 						log.Fatalf("ptmon: collector - PtraceGetRegs(call): %v", err)
 					}
 
-					callNum = regs.Orig_rax
+					callNum, callABI = callInfo(&regs)
 					syscallReturn = true
 					gotCallNum = true
+
+					callName := resolveCallName(callABI, int16(callNum))
+					isSocket = callName == socketCall
+					if isSocket {
+						sockFamily, sockType = callArgs(&regs, callABI)
+						sockType &= sockTypeMask
+					}
+
+					fsPath = ""
+					isFSCall := false
+					if trackFiles {
+						if fsCall, isFSCall = fsCalls[callName]; isFSCall {
+							arg0, arg1 := callArgs(&regs, callABI)
+							fsPath = callPath(targetPid, fsCall, arg0, arg1)
+						}
+					}
+
+					capName = capCheck(&capCall{
+						pid:    targetPid,
+						name:   callName,
+						abi:    callABI,
+						args:   callArgList(&regs, callABI),
+						fsPath: fsPath,
+					})
+					capSyscall = callName
+
+					scID := syscallID{abi: callABI, num: int16(callNum)}
+					seen[scID]++
+					atomic.AddUint64(&stats.Syscalls, 1)
+					sampled = isSocket || isFSCall || capName != "" || sampleRate <= 1 || seen[scID]%sampleRate == 1
+					if !sampled {
+						sampledOutLock.Lock()
+						sampledOut[scID]++
+						sampledOutLock.Unlock()
+					}
 				case true:
+					syscallReturn = false
+					if !sampled {
+						//the return value is not needed for the counted calls
+						gotCallNum = false
+						break
+					}
+
 					if err := syscall.PtraceGetRegs(targetPid, &regs); err != nil {
 						log.Fatalf("ptmon: collector - PtraceGetRegs(return): %v", err)
 					}
 
-					retVal = regs.Rax
-					syscallReturn = false
+					retVal = callReturnValue(&regs)
 					gotRetVal = true
 				}
 
@@ -129,8 +311,16 @@ func Run(startChan <-chan int,
 
 					select {
 					case eventChan <- syscallEvent{
-						callNum: int16(callNum),
-						retVal:  retVal,
+						callNum:    int16(callNum),
+						abi:        callABI,
+						retVal:     retVal,
+						isSocket:   isSocket,
+						sockFamily: sockFamily,
+						sockType:   sockType,
+						fsPath:     fsPath,
+						fsCall:     fsCall,
+						capName:    capName,
+						capSyscall: capSyscall,
 					}:
 					case <-stopChan:
 						log.Info("ptmon: collector - stopping...")
@@ -142,12 +332,71 @@ func Run(startChan <-chan int,
 			collectorDoneChan <- 0
 		}()
 
+		handleEvent := func(e syscallEvent) {
+			ptReport.SyscallCount++
+
+			scID := syscallID{abi: e.abi, num: e.callNum}
+			if _, ok := syscallStats[scID]; ok {
+				syscallStats[scID]++
+			} else {
+				syscallStats[scID] = 1
+			}
+
+			//only the sockets that were created successfully
+			if e.isSocket && int64(e.retVal) >= 0 {
+				key := fmt.Sprintf("%v:%v", e.sockFamily, e.sockType)
+				if info, ok := ptReport.SocketStats[key]; ok {
+					info.Count++
+					ptReport.SocketStats[key] = info
+				} else {
+					ptReport.SocketStats[key] = report.SocketStatInfo{
+						Family:     e.sockFamily,
+						FamilyName: sockFamilyName(e.sockFamily),
+						Type:       e.sockType,
+						TypeName:   sockTypeName(e.sockType),
+						Count:      1,
+					}
+				}
+			}
+
+			//only the successful calls used the capabilities
+			if e.capName != "" && int64(e.retVal) >= 0 {
+				key := fmt.Sprintf("%v:%v", e.capName, e.capSyscall)
+				if info, ok := ptReport.CapabilityStats[key]; ok {
+					info.Count++
+					ptReport.CapabilityStats[key] = info
+				} else {
+					ptReport.CapabilityStats[key] = report.CapabilityStatInfo{
+						Capability: e.capName,
+						Syscall:    e.capSyscall,
+						Count:      1,
+					}
+				}
+			}
+
+			if e.fsPath != "" && int64(e.retVal) >= 0 {
+				fileCount := len(ptReport.FSActivity)
+				addFSActivity(ptReport.FSActivity, e.fsPath, e.fsCall)
+				if len(ptReport.FSActivity) > fileCount {
+					atomic.AddUint64(&stats.Files, 1)
+				}
+			}
+		}
+
 	done:
 		for {
 			select {
 			case rc := <-collectorDoneChan:
 				log.Info("ptmon: processor - collector finished =>", rc)
-				break done
+				//the collector can finish before all its events are processed
+				for {
+					select {
+					case e := <-eventChan:
+						handleEvent(e)
+					default:
+						break done
+					}
+				}
 			case <-stopChan:
 				log.Info("ptmon: processor - stopping...")
 				//NOTE: need a better way to stop the target app...
@@ -159,30 +408,76 @@ func Run(startChan <-chan int,
 				}
 				break done
 			case e := <-eventChan:
-				ptReport.SyscallCount++
-
-				if _, ok := syscallStats[e.callNum]; ok {
-					syscallStats[e.callNum]++
-				} else {
-					syscallStats[e.callNum] = 1
-				}
+				handleEvent(e)
 			}
 		}
 
-		log.Debugf("ptmon: processor - executed syscall count = %d", ptReport.SyscallCount)
+		sampledOutLock.Lock()
+		for scID, scCount := range sampledOut {
+			syscallStats[scID] += scCount
+			ptReport.SampledOutCount += scCount
+		}
+		sampledOutLock.Unlock()
+
+		ptReport.SyscallCount += ptReport.SampledOutCount
+		log.Debugf("ptmon: processor - executed syscall count = %d (%d sampled out)", ptReport.SyscallCount, ptReport.SampledOutCount)
 		log.Debugf("ptmon: processor - number of syscalls: %v", len(syscallStats))
-		for scNum, scCount := range syscallStats {
-			log.Debugf("[%v] %v = %v", scNum, syscallResolver(scNum), scCount)
-			ptReport.SyscallStats[strconv.FormatInt(int64(scNum), 10)] = report.SyscallStatInfo{
-				Number: scNum,
-				Name:   syscallResolver(scNum),
+		for scID, scCount := range syscallStats {
+			key := strconv.FormatInt(int64(scID.num), 10)
+			if scID.abi != "" {
+				key = fmt.Sprintf("%v:%v", scID.abi, key)
+			}
+
+			scName := resolveCallName(scID.abi, scID.num)
+			log.Debugf("[%v] %v = %v", key, scName, scCount)
+
+			ptReport.SyscallStats[key] = report.SyscallStatInfo{
+				Number: scID.num,
+				Name:   scName,
+				Arch:   string(scID.abi),
 				Count:  scCount,
 			}
 		}
 
 		ptReport.SyscallNum = uint32(len(ptReport.SyscallStats))
+		if trackFiles {
+			if app != nil {
+				ptReport.TargetPid = app.Process.Pid
+			}
+
+			select {
+			case appPaths := <-appPathsChan:
+				for _, appPath := range appPaths {
+					addFSActivity(ptReport.FSActivity, appPath, fsCallInfo{exec: true})
+				}
+			default:
+			}
+
+			log.Debugf("ptmon: processor - file system activity: %v files", len(ptReport.FSActivity))
+		}
+
 		resultChan <- ptReport
 	}()
 
 	return resultChan
 }
+
+// reniceSensor sets the scheduling priority of the sensor threads (except the tracer thread)
+func reniceSensor(nice int, tracerTid int) {
+	tasks, err := ioutil.ReadDir(procFsTasks)
+	if err != nil {
+		log.Warnf("ptmon: error listing the sensor threads - %v", err)
+		return
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil || tid == tracerTid {
+			continue
+		}
+
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil {
+			log.Debugf("ptmon: error setting the priority for thread %v - %v", tid, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ptrace
+
+import (
+	"syscall"
+
+	"github.com/cloudimmunity/system"
+)
+
+// the code segment selector used by 32-bit processes (and by 64-bit processes in compat mode)
+const userCS32 = 0x23
+
+// callInfo returns the system call number and the system call ABI
+// (empty for the native ABI) at the system call entry stop
+func callInfo(regs *syscall.PtraceRegs) (uint64, system.ArchName) {
+	callNum := regs.Orig_rax
+
+	switch {
+	case regs.Cs == userCS32:
+		return callNum, system.ArchName386
+	case callNum&x32SyscallBit != 0:
+		return callNum &^ x32SyscallBit, archNameX32
+	default:
+		return callNum, ""
+	}
+}
+
+// callArgs returns the first two system call arguments at the system call entry stop
+func callArgs(regs *syscall.PtraceRegs, abi system.ArchName) (uint64, uint64) {
+	if abi == system.ArchName386 {
+		return regs.Rbx, regs.Rcx
+	}
+
+	return regs.Rdi, regs.Rsi
+}
+
+// callArgList returns the first four system call arguments at the system call entry stop
+func callArgList(regs *syscall.PtraceRegs, abi system.ArchName) [maxCallArgs]uint64 {
+	if abi == system.ArchName386 {
+		return [maxCallArgs]uint64{regs.Rbx, regs.Rcx, regs.Rdx, regs.Rsi}
+	}
+
+	return [maxCallArgs]uint64{regs.Rdi, regs.Rsi, regs.Rdx, regs.R10}
+}
+
+// callReturnValue returns the system call return value at the system call exit stop
+func callReturnValue(regs *syscall.PtraceRegs) uint64 {
+	return regs.Rax
+}
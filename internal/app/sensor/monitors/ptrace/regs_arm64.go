@@ -0,0 +1,29 @@
+package ptrace
+
+import (
+	"syscall"
+
+	"github.com/cloudimmunity/system"
+)
+
+// callInfo returns the system call number and the system call ABI
+// (empty for the native ABI) at the system call entry stop
+//NOTE: 32-bit (aarch32) processes are not detected (their registers use a different layout)
+func callInfo(regs *syscall.PtraceRegs) (uint64, system.ArchName) {
+	return regs.Regs[8], ""
+}
+
+// callArgs returns the first two system call arguments at the system call entry stop
+func callArgs(regs *syscall.PtraceRegs, abi system.ArchName) (uint64, uint64) {
+	return regs.Regs[0], regs.Regs[1]
+}
+
+// callArgList returns the first four system call arguments at the system call entry stop
+func callArgList(regs *syscall.PtraceRegs, abi system.ArchName) [maxCallArgs]uint64 {
+	return [maxCallArgs]uint64{regs.Regs[0], regs.Regs[1], regs.Regs[2], regs.Regs[3]}
+}
+
+// callReturnValue returns the system call return value at the system call exit stop
+func callReturnValue(regs *syscall.PtraceRegs) uint64 {
+	return regs.Regs[0]
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
+	"github.com/docker-slim/docker-slim/pkg/report"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const portsScanInterval = 2 * time.Second
+
+const localPortRangeFile = "/proc/sys/net/ipv4/ip_local_port_range"
+
+// socket tables in the container network namespace
+// (the listening TCP sockets are in the LISTEN state and the bound UDP sockets are in the CLOSE state)
+var procNetTables = []struct {
+	path        string
+	protocol    string
+	listenState string
+}{
+	{"/proc/net/tcp", "tcp", "0A"},
+	{"/proc/net/tcp6", "tcp", "0A"},
+	{"/proc/net/udp", "udp", "07"},
+	{"/proc/net/udp6", "udp", "07"},
+}
+
+// trackListeningPorts scans the container sockets until the monitoring is stopped
+// and sends the ports the target app listened on (the ports are scanned periodically,
+// so the ports the app closes before the monitoring is stopped are included too)
+func trackListeningPorts(stopChan <-chan struct{}) <-chan *report.NetMonitorReport {
+	reportChan := make(chan *report.NetMonitorReport, 1)
+	go func() {
+		ephemeralMin, ephemeralMax := localPortRange()
+		found := map[report.ListeningPort]bool{}
+
+		ticker := time.NewTicker(portsScanInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, port := range scanListeningPorts(ephemeralMin, ephemeralMax) {
+				if !found[port] {
+					log.Debugf("sensor: listening port => %v (%v)", port, port.Address)
+					found[port] = true
+				}
+			}
+
+			select {
+			case <-stopChan:
+				netReport := &report.NetMonitorReport{ListeningPorts: []report.ListeningPort{}}
+				for port := range found {
+					netReport.ListeningPorts = append(netReport.ListeningPorts, port)
+				}
+
+				sort.Slice(netReport.ListeningPorts, func(i, j int) bool {
+					pi, pj := netReport.ListeningPorts[i], netReport.ListeningPorts[j]
+					if pi.Port != pj.Port {
+						return pi.Port < pj.Port
+					}
+
+					if pi.Protocol != pj.Protocol {
+						return pi.Protocol < pj.Protocol
+					}
+
+					return pi.Address < pj.Address
+				})
+
+				reportChan <- netReport
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return reportChan
+}
+
+func scanListeningPorts(ephemeralMin, ephemeralMax int) []report.ListeningPort {
+	var ports []report.ListeningPort
+	for _, table := range procNetTables {
+		file, err := os.Open(table.path)
+		if err != nil {
+			//no IPv6 in the container
+			continue
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Scan() //the header line
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[3] != table.listenState {
+				continue
+			}
+
+			ip, port, err := parseSocketAddr(fields[1])
+			if err != nil {
+				log.Debugf("sensor: bad socket address in %v - %v", table.path, err)
+				continue
+			}
+
+			//the loopback only ports are not reachable from outside of the container
+			if ip.IsLoopback() || channel.IsSensorPort(port) {
+				continue
+			}
+
+			//the unconnected UDP client sockets are bound to the ephemeral ports
+			if table.protocol == "udp" && port >= ephemeralMin && port <= ephemeralMax {
+				continue
+			}
+
+			ports = append(ports, report.ListeningPort{
+				Port:     port,
+				Protocol: table.protocol,
+				Address:  ip.String(),
+			})
+		}
+
+		file.Close()
+	}
+
+	return ports
+}
+
+// parseSocketAddr parses the socket address in the /proc/net format
+// (the hex address in the host byte order in 32-bit words and the hex port, e.g., '0100007F:1F90')
+func parseSocketAddr(addr string) (net.IP, int, error) {
+	parts := strings.Split(addr, ":")
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("unexpected address format - %v", addr)
+	}
+
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("unexpected address - %v", addr)
+	}
+
+	//the kernel prints the 32-bit words in the host byte order (little endian on the supported architectures)
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return net.IP(raw), int(port), nil
+}
+
+func localPortRange() (int, int) {
+	//the default Linux ephemeral port range
+	portMin, portMax := 32768, 60999
+
+	data, err := ioutil.ReadFile(localPortRangeFile)
+	if err != nil {
+		return portMin, portMax
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return portMin, portMax
+	}
+
+	if value, err := strconv.Atoi(fields[0]); err == nil {
+		portMin = value
+	}
+
+	if value, err := strconv.Atoi(fields[1]); err == nil {
+		portMax = value
+	}
+
+	return portMin, portMax
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker-slim/docker-slim/internal/app/sensor/ipc"
+	"github.com/docker-slim/docker-slim/internal/app/sensor/monitors/fanotify"
+	"github.com/docker-slim/docker-slim/internal/app/sensor/monitors/ptrace"
+	"github.com/docker-slim/docker-slim/pkg/ipc/event"
+)
+
+const progressInterval = 10 * time.Second
+
+// reportProgress publishes the monitoring progress events until the monitoring is stopped
+// (and the warning events when the file events are dropped; the file count comes from ptrace
+// when FANOTIFY is not available)
+func reportProgress(stopChan <-chan struct{}, fanStats *fanotify.Stats, ptStats *ptrace.Stats) {
+	ipc.PublishInfoEvt(&event.Message{Name: event.MonitorStartedName})
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	var lastDropped uint64
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		progress := &event.Progress{
+			EventCount:   atomic.LoadUint64(&fanStats.Events),
+			FileCount:    atomic.LoadUint64(&fanStats.Files) + atomic.LoadUint64(&ptStats.Files),
+			ProcessCount: atomic.LoadUint64(&fanStats.Processes),
+			SyscallCount: atomic.LoadUint64(&ptStats.Syscalls),
+			DroppedCount: atomic.LoadUint64(&fanStats.Overflows),
+		}
+
+		ipc.PublishInfoEvt(&event.Message{Name: event.MonitorProgressName, Progress: progress})
+
+		if progress.DroppedCount > lastDropped {
+			publishWarning(fmt.Sprintf("the file event queue overflowed %v times (some file events were dropped)", progress.DroppedCount))
+			lastDropped = progress.DroppedCount
+		}
+	}
+}
+
+func publishWarning(message string) {
+	ipc.PublishInfoEvt(&event.Message{Name: event.SensorWarningName, Warning: message})
+}
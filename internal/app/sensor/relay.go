@@ -0,0 +1,29 @@
+package app
+
+import (
+	"io"
+	"net"
+	"os"
+)
+
+// relay connects to the TCP address and relays the data between the connection and stdin/stdout
+// (the master runs the sensor in the relay mode with 'docker exec' to tunnel the IPC connections
+// when the published sensor ports are not reachable)
+func relay(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, os.Stdin)
+		//the master closed its side of the tunnel
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+	}()
+
+	_, err = io.Copy(os.Stdout, conn)
+	return err
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/docker-slim/docker-slim/pkg/ipc/command"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// the signals that stop the monitoring in the standalone mode (e.g., 'docker stop' sends SIGTERM)
+var standaloneStopSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGTERM,
+	syscall.SIGQUIT,
+	syscall.SIGHUP,
+}
+
+// runStandalone monitors the target app without the master (the instrumented images run the sensor this way).
+// The start monitor command is loaded from the command file (the command line arguments replace
+// the target app command from the file). The monitoring stops when the sensor gets a stop signal
+// or when the target app exits and the artifacts are saved in the artifacts directory
+// (they are used to build the minified image with 'build --from-report').
+func runStandalone(cmdPath string, appCmd []string, dirName string) error {
+	data, err := ioutil.ReadFile(cmdPath)
+	if err != nil {
+		return err
+	}
+
+	var cmd command.StartMonitor
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return err
+	}
+
+	if len(appCmd) > 0 {
+		cmd.AppName = appCmd[0]
+		cmd.AppArgs = appCmd[1:]
+	}
+
+	if cmd.AppName == "" {
+		return errors.New("no target app command")
+	}
+
+	//the artifacts stay in the artifacts directory (nothing copies them out of the container)
+	cmd.CompressArtifacts = false
+	if err := os.MkdirAll(defaultArtifactDirName, 0777); err != nil {
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, standaloneStopSignals...)
+
+	monDoneChan := make(chan bool, 1)
+	monDoneAckChan := make(chan bool)
+	appExitChan := make(chan struct{}, 1)
+	ptmonStartChan := make(chan int, 1)
+
+	log.Infof("sensor: standalone - monitoring %v %#v", cmd.AppName, cmd.AppArgs)
+	monitor(monDoneChan, monDoneAckChan, nil, ptmonStartChan, &cmd, dirName, appExitChan)
+
+	select {
+	case sig := <-sigChan:
+		log.Infof("sensor: standalone - stop signal (%v)", sig)
+	case <-appExitChan:
+		log.Info("sensor: standalone - target app exited")
+	}
+
+	monDoneChan <- true
+	log.Info("sensor: standalone - waiting for monitor to finish...")
+	<-monDoneAckChan
+	log.Infof("sensor: standalone - artifacts saved in %v", defaultArtifactDirName)
+	return nil
+}
@@ -0,0 +1,74 @@
+package distro
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// the time zone database and the local time zone config
+var tzdataPaths = []string{
+	"/usr/share/zoneinfo",
+	"/etc/localtime",
+	"/etc/timezone",
+}
+
+// the system locale config (the default locale for the login shells and the services)
+var localeConfigPaths = []string{
+	"/etc/default/locale",
+	"/etc/locale.conf",
+}
+
+// TzdataPaths returns the existing time zone data paths (relative to the root path)
+func TzdataPaths(root string) []string {
+	return expandPaths(root, tzdataPaths)
+}
+
+// LocalePaths returns the existing locale data paths for the locales (relative to the root path).
+// The locales can have the codeset and the modifier (e.g., 'en_US', 'en_US.UTF-8' or 'de_DE@euro'):
+// the compiled glibc locales for all codesets and modifiers of the locale are included with the glibc
+// locale archive, the message catalogs for the locale and its language and the musl locale files.
+func LocalePaths(root string, locales []string) []string {
+	if len(locales) == 0 {
+		return nil
+	}
+
+	patterns := append([]string{"/usr/lib/locale/locale-archive"}, localeConfigPaths...)
+	for _, locale := range locales {
+		name := LocaleName(locale)
+		if name == "" {
+			continue
+		}
+
+		lang := strings.SplitN(name, "_", 2)[0]
+		patterns = append(patterns,
+			filepath.Join("/usr/lib/locale", name),
+			filepath.Join("/usr/lib/locale", name+".*"),
+			filepath.Join("/usr/lib/locale", name+"@*"),
+			filepath.Join("/usr/share/locale", lang),
+			filepath.Join("/usr/share/locale", name),
+			filepath.Join("/usr/share/i18n/locales/musl", name+"*"))
+	}
+
+	return expandPaths(root, patterns)
+}
+
+// LocaleName returns the locale name without the codeset and the modifier
+// (e.g., 'en_US' for 'en_US.UTF-8'; it returns an empty string if the name is not valid)
+func LocaleName(locale string) string {
+	name := locale
+	if idx := strings.IndexAny(name, ".@"); idx != -1 {
+		name = name[:idx]
+	}
+
+	if name == "" {
+		return ""
+	}
+
+	for _, r := range name {
+		if !(r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return ""
+		}
+	}
+
+	return name
+}
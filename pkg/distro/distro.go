@@ -0,0 +1,254 @@
+package distro
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Distro families (the families have their own include rulesets)
+const (
+	FamilyAlpine = "alpine"
+	FamilyDebian = "debian"
+	FamilyRHEL   = "rhel"
+)
+
+// C libraries
+const (
+	LibcMusl  = "musl"
+	LibcGlibc = "glibc"
+)
+
+var osReleasePaths = []string{
+	"/etc/os-release",
+	"/usr/lib/os-release",
+}
+
+// the distro IDs and the ID_LIKE values for each family
+var familyIDs = map[string][]string{
+	FamilyAlpine: {"alpine", "wolfi", "chainguard"},
+	FamilyDebian: {"debian", "ubuntu"},
+	FamilyRHEL:   {"rhel", "centos", "fedora", "rocky", "almalinux", "ol", "amzn"},
+}
+
+// the loader and the C library names for each C library (the paths are glob patterns)
+var libcLoaders = map[string][]string{
+	LibcMusl:  {"/lib/ld-musl-*.so.1"},
+	LibcGlibc: {"/lib/ld-linux*.so.*", "/lib64/ld-linux*.so.*", "/lib/*-linux-gnu/libc.so.6", "/lib64/libc.so.6"},
+}
+
+// the files the name resolution and the user lookups need
+// (the C libraries read them only when the app resolves a host or a user name,
+// /etc/hosts and /etc/resolv.conf are not included because the container runtime mounts them)
+var lookupFiles = []string{
+	"/etc/passwd",
+	"/etc/group",
+	"/etc/nsswitch.conf",
+	"/etc/services",
+	"/etc/protocols",
+}
+
+// the glibc name resolution config and the loader cache and paths
+var glibcConfigFiles = []string{
+	"/etc/host.conf",
+	"/etc/gai.conf",
+	"/etc/ld.so.cache",
+	"/etc/ld.so.conf",
+	"/etc/ld.so.conf.d",
+}
+
+// the NSS modules glibc loads on demand (with the versioned library names the older glibc releases use)
+var glibcNSSLibs = []string{
+	"libnss_files*.so*",
+	"libnss_dns*.so*",
+	"libresolv*.so*",
+}
+
+// the include rulesets (glob patterns, the missing paths are skipped)
+var rulesets = map[string][]string{
+	FamilyAlpine: paths(lookupFiles, []string{
+		//musl has the resolver built in, so only the loader paths are needed
+		"/etc/ld-musl-*.path",
+	}),
+	FamilyDebian: paths(lookupFiles, glibcConfigFiles, libPaths([]string{
+		"/lib/*-linux-gnu",
+		"/usr/lib/*-linux-gnu",
+	}, glibcNSSLibs)),
+	FamilyRHEL: paths(lookupFiles, glibcConfigFiles, libPaths([]string{
+		"/lib64",
+		"/usr/lib64",
+	}, glibcNSSLibs)),
+}
+
+// Info describes the base distro of the image
+type Info struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	Family  string `json:"family,omitempty"`
+	Libc    string `json:"libc,omitempty"`
+}
+
+// Detect detects the distro of the filesystem at the root path
+// (it returns nil if there's no os-release file and no known C library)
+func Detect(root string) *Info {
+	info := &Info{}
+	for _, releasePath := range osReleasePaths {
+		fields, err := readOSRelease(filepath.Join(root, releasePath))
+		if err != nil {
+			continue
+		}
+
+		info.ID = fields["ID"]
+		info.Name = fields["PRETTY_NAME"]
+		info.Version = fields["VERSION_ID"]
+		info.Family = family(fields["ID"], strings.Fields(fields["ID_LIKE"]))
+		break
+	}
+
+	info.Libc = detectLibc(root)
+	if info.Family == "" && info.Libc == LibcMusl {
+		//the musl based images without the os-release file (e.g., the Alpine based minimal images)
+		info.Family = FamilyAlpine
+	}
+
+	if info.ID == "" && info.Libc == "" {
+		return nil
+	}
+
+	return info
+}
+
+// Families returns the distro families with the include rulesets
+func Families() []string {
+	var names []string
+	for name := range rulesets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Ruleset returns the include path patterns for the distro family
+func Ruleset(family string) []string {
+	return rulesets[family]
+}
+
+// IncludePaths returns the existing paths from the distro ruleset (relative to the root path).
+// The directory symlinks are resolved (e.g., '/lib' linked to '/usr/lib' on the merged /usr distros),
+// so the paths are the same paths the sensor sees when the files are used and they are included only once.
+func IncludePaths(root string, info *Info) []string {
+	if info == nil {
+		return nil
+	}
+
+	return expandPaths(root, Ruleset(info.Family))
+}
+
+// expandPaths expands the path patterns and returns the existing paths (relative to the root path)
+// with the directory symlinks resolved and without duplicates
+func expandPaths(root string, patterns []string) []string {
+	var found []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(root, pattern))
+		if err != nil {
+			continue
+		}
+
+		for _, match := range matches {
+			if dir, err := filepath.EvalSymlinks(filepath.Dir(match)); err == nil {
+				match = filepath.Join(dir, filepath.Base(match))
+			}
+
+			relPath, err := filepath.Rel(root, match)
+			if err != nil || strings.HasPrefix(relPath, "..") {
+				continue
+			}
+
+			includePath := filepath.Join("/", relPath)
+			if !seen[includePath] {
+				seen[includePath] = true
+				found = append(found, includePath)
+			}
+		}
+	}
+
+	return found
+}
+
+func family(id string, idLike []string) string {
+	for _, name := range append([]string{id}, idLike...) {
+		for familyName, ids := range familyIDs {
+			for _, familyID := range ids {
+				if name == familyID {
+					return familyName
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func detectLibc(root string) string {
+	for _, libc := range []string{LibcMusl, LibcGlibc} {
+		for _, pattern := range libcLoaders[libc] {
+			if matches, _ := filepath.Glob(filepath.Join(root, pattern)); len(matches) > 0 {
+				return libc
+			}
+		}
+	}
+
+	return ""
+}
+
+// readOSRelease reads the os-release file fields (the 'KEY=value' lines with optional quotes)
+func readOSRelease(filePath string) (map[string]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		fields[parts[0]] = strings.Trim(parts[1], `"'`)
+	}
+
+	return fields, scanner.Err()
+}
+
+func libPaths(dirs []string, libs []string) []string {
+	var all []string
+	for _, dir := range dirs {
+		for _, lib := range libs {
+			all = append(all, dir+"/"+lib)
+		}
+	}
+
+	return all
+}
+
+func paths(groups ...[]string) []string {
+	var all []string
+	for _, group := range groups {
+		all = append(all, group...)
+	}
+
+	return all
+}
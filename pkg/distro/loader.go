@@ -0,0 +1,146 @@
+package distro
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the default library paths the loaders search after the configured paths
+var defaultLibraryPaths = map[string][]string{
+	LibcMusl:  {"/lib", "/usr/local/lib", "/usr/lib"},
+	LibcGlibc: {"/lib64", "/usr/lib64", "/lib", "/usr/lib", "/lib/*-linux-gnu", "/usr/lib/*-linux-gnu"},
+}
+
+const (
+	muslPathFilePat = "/etc/ld-musl-*.path"
+	glibcConfFile   = "/etc/ld.so.conf"
+	maxConfIncludes = 16
+)
+
+// InterpLibc returns the C library of the ELF interpreter (the dynamic loader) path
+// (it returns an empty string for the unknown loaders)
+func InterpLibc(interp string) string {
+	baseName := filepath.Base(interp)
+	switch {
+	case strings.HasPrefix(baseName, "ld-musl-"):
+		return LibcMusl
+	case strings.HasPrefix(baseName, "ld-linux"), strings.HasPrefix(baseName, "ld64.so"):
+		return LibcGlibc
+	}
+
+	return ""
+}
+
+// LibraryPaths returns the directories the loader for the C library searches for the shared libraries
+// in the filesystem at the root path (the paths are relative to the root path and they are in the search order).
+// The musl loader reads its path file (it replaces the default paths), the glibc loader uses ld.so.conf
+// (with its includes) and the default paths.
+func LibraryPaths(root string, libc string) []string {
+	var configured []string
+	switch libc {
+	case LibcMusl:
+		matches, _ := filepath.Glob(filepath.Join(root, muslPathFilePat))
+		if len(matches) > 0 {
+			configured = readMuslPaths(matches[0])
+			if len(configured) > 0 {
+				return existingDirs(root, configured)
+			}
+		}
+	case LibcGlibc:
+		configured = readGlibcConf(root, glibcConfFile, 0)
+	default:
+		return nil
+	}
+
+	return existingDirs(root, append(configured, defaultLibraryPaths[libc]...))
+}
+
+// readMuslPaths reads the musl loader path file (the paths are separated by new lines or colons)
+func readMuslPaths(filePath string) []string {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+
+	return strings.FieldsFunc(string(data), func(r rune) bool {
+		return r == ':' || r == '\n' || r == '\r'
+	})
+}
+
+// readGlibcConf reads the library paths from ld.so.conf and the files it includes
+// (the include patterns are relative to the config file directory if they are not absolute)
+func readGlibcConf(root, confPath string, depth int) []string {
+	if depth > maxConfIncludes {
+		return nil
+	}
+
+	file, err := os.Open(filepath.Join(root, confPath))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] != "include" {
+			dirs = append(dirs, fields...)
+			continue
+		}
+
+		for _, pattern := range fields[1:] {
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(confPath), pattern)
+			}
+
+			matches, _ := filepath.Glob(filepath.Join(root, pattern))
+			for _, match := range matches {
+				if relPath, err := filepath.Rel(root, match); err == nil {
+					dirs = append(dirs, readGlibcConf(root, filepath.Join("/", relPath), depth+1)...)
+				}
+			}
+		}
+	}
+
+	return dirs
+}
+
+// existingDirs expands the directory patterns and returns the existing directories (without duplicates)
+func existingDirs(root string, patterns []string) []string {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.IsDir() {
+				continue
+			}
+
+			relPath, err := filepath.Rel(root, match)
+			if err != nil || strings.HasPrefix(relPath, "..") {
+				continue
+			}
+
+			dir := filepath.Join("/", relPath)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	return dirs
+}
@@ -0,0 +1,91 @@
+package distro
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	dpkgInfoPattern = "/var/lib/dpkg/info/*.list"
+	apkInstalledDB  = "/lib/apk/db/installed"
+)
+
+// PackageFiles returns the OS package names for the files the package managers installed
+// in the filesystem at the root path (the dpkg file lists and the apk installed package database;
+// the rpm database is not supported). The file paths are relative to the root path and their
+// directory symlinks are resolved, so they are the same paths the sensor sees.
+func PackageFiles(root string) map[string]string {
+	files := map[string]string{}
+	resolver := newDirResolver(root)
+
+	listPaths, _ := filepath.Glob(filepath.Join(root, dpkgInfoPattern))
+	for _, listPath := range listPaths {
+		//the list names have the package architecture for the multiarch packages (e.g., 'libc6:amd64.list')
+		pkgName := strings.SplitN(strings.TrimSuffix(filepath.Base(listPath), ".list"), ":", 2)[0]
+		readLines(listPath, func(line string) {
+			if strings.HasPrefix(line, "/") && line != "/." {
+				files[resolver.resolve(line)] = pkgName
+			}
+		})
+	}
+
+	var pkgName, dirName string
+	readLines(filepath.Join(root, apkInstalledDB), func(line string) {
+		switch {
+		case strings.HasPrefix(line, "P:"):
+			pkgName = line[2:]
+			dirName = ""
+		case strings.HasPrefix(line, "F:"):
+			dirName = line[2:]
+		case strings.HasPrefix(line, "R:") && pkgName != "":
+			files[resolver.resolve("/"+filepath.Join(dirName, line[2:]))] = pkgName
+		}
+	})
+
+	return files
+}
+
+func readLines(filePath string, handler func(line string)) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		handler(scanner.Text())
+	}
+}
+
+// dirResolver resolves the directory symlinks in the file paths (the resolved directories are cached)
+type dirResolver struct {
+	root string
+	dirs map[string]string
+}
+
+func newDirResolver(root string) *dirResolver {
+	return &dirResolver{
+		root: root,
+		dirs: map[string]string{},
+	}
+}
+
+func (r *dirResolver) resolve(filePath string) string {
+	dir := filepath.Dir(filePath)
+	realDir, ok := r.dirs[dir]
+	if !ok {
+		realDir = dir
+		if fullDir, err := filepath.EvalSymlinks(filepath.Join(r.root, dir)); err == nil {
+			if relDir, err := filepath.Rel(r.root, fullDir); err == nil && !strings.HasPrefix(relDir, "..") {
+				realDir = filepath.Join("/", relDir)
+			}
+		}
+
+		r.dirs[dir] = realDir
+	}
+
+	return filepath.Join(realDir, filepath.Base(filePath))
+}
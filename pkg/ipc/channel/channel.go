@@ -1,7 +1,57 @@
 package channel
 
+import (
+	"fmt"
+	"time"
+)
+
 // Supported events
 const (
 	CmdPort = 65501
 	EvtPort = 65502
 )
+
+// MaxSensors is the maximum number of the sensors in one network namespace
+// (the target container and its sidecars). Each sensor uses the next pair of the IPC ports.
+const MaxSensors = 8
+
+// SensorPorts returns the IPC command and event ports for the sensor with the index
+// (the target container sensor has the index 0)
+func SensorPorts(idx int) (int, int) {
+	return CmdPort + idx*2, EvtPort + idx*2
+}
+
+// IsSensorPort returns true if the port is one of the sensor IPC ports
+func IsSensorPort(port int) bool {
+	return port >= CmdPort && port < CmdPort+MaxSensors*2
+}
+
+// ProtocolVersion is the master/sensor protocol version
+// (version 1 is the original protocol without the message versions,
+// where the command replies and the events are plain strings)
+const ProtocolVersion = 2
+
+// MinProtocolVersion is the oldest protocol version the master and the sensor work with
+const MinProtocolVersion = 2
+
+// CheckProtocolVersion returns an error if the other side uses an unsupported protocol version
+// (version 0 is the version 1 protocol, which doesn't have the message versions)
+func CheckProtocolVersion(version int) error {
+	if version < MinProtocolVersion || version > ProtocolVersion {
+		if version == 0 {
+			version = 1
+		}
+
+		if MinProtocolVersion == ProtocolVersion {
+			return fmt.Errorf("unsupported protocol version %v (supported version: %v)", version, ProtocolVersion)
+		}
+
+		return fmt.Errorf("unsupported protocol version %v (supported versions: %v-%v)", version, MinProtocolVersion, ProtocolVersion)
+	}
+
+	return nil
+}
+
+// HeartbeatInterval is how often the sensor publishes the heartbeat events
+// and the master pings the sensor (protocol version 2)
+const HeartbeatInterval = 5 * time.Second
@@ -3,6 +3,10 @@ package command
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
+	"github.com/docker-slim/docker-slim/pkg/version"
 )
 
 // Message errors
@@ -18,19 +22,47 @@ const (
 	StartMonitorName   MessageName = "cmd.monitor.start"
 	StopMonitorName    MessageName = "cmd.monitor.stop"
 	ShutdownSensorName MessageName = "cmd.sensor.shutdown"
+	PingName           MessageName = "cmd.sensor.ping"
 )
 
+// DefaultExecRedactPattern matches the command arguments with secrets
+// (the executed command arguments matching the pattern are redacted in the reports)
+const DefaultExecRedactPattern = `(?i)(pass|pwd|secret|token|key|auth|credential)`
+
 // Message represents the message interface
 type Message interface {
 	GetName() MessageName
 }
 
 // StartMonitor contains the start monitor command fields
+// (it's also the protocol handshake: the sensor rejects it if it doesn't support the master protocol version)
 type StartMonitor struct {
-	AppName  string   `json:"app_name"`
-	AppArgs  []string `json:"app_args,omitempty"`
-	Excludes []string `json:"excludes,omitempty"`
-	Includes []string `json:"includes,omitempty"`
+	ProtocolVersion int      `json:"protocol_version,omitempty"`
+	MasterVersion   string   `json:"master_version,omitempty"`
+	AppName         string   `json:"app_name"`
+	AppArgs         []string `json:"app_args,omitempty"`
+	Excludes        []string `json:"excludes,omitempty"`
+	Includes        []string `json:"includes,omitempty"`
+	// CompressArtifacts makes the sensor pack the artifacts in a compressed archive
+	// (when they are copied from the container instead of using a bind mount)
+	CompressArtifacts bool `json:"compress_artifacts,omitempty"`
+	// PtraceSampleRate makes the ptrace monitor record only one of each N calls of the same system call
+	// (the other calls are only counted; 0 or 1 records all calls)
+	PtraceSampleRate int `json:"ptrace_sample_rate,omitempty"`
+	// EventQueueSize is the size of the monitor event queues (0 uses the default size)
+	EventQueueSize int `json:"event_queue_size,omitempty"`
+	// Nice is the scheduling priority adjustment for the sensor threads (the target app is not affected)
+	Nice int `json:"nice,omitempty"`
+	// ExecRedactPattern is the regular expression for the executed command arguments to redact
+	// (empty uses DefaultExecRedactPattern)
+	ExecRedactPattern string `json:"exec_redact_pattern,omitempty"`
+	// DistroIncludes makes the sensor keep the files from the built-in include ruleset
+	// for the detected base distro (the name resolution and the user lookup files)
+	DistroIncludes bool `json:"distro_includes,omitempty"`
+	// IncludeTzdata makes the sensor keep the time zone database and the local time zone config
+	IncludeTzdata bool `json:"include_tzdata,omitempty"`
+	// IncludeLocales are the locales (e.g., 'en_US') to keep the locale data for
+	IncludeLocales []string `json:"include_locales,omitempty"`
 }
 
 // GetName returns the command message ID for the start monitor command
@@ -56,15 +88,98 @@ func (m *ShutdownSensor) GetName() MessageName {
 	return ShutdownSensorName
 }
 
+// Ping contains the ping command fields
+// (the sensor replies to the pings without processing them)
+type Ping struct {
+}
+
+// GetName returns the command message ID for the ping command
+func (m *Ping) GetName() MessageName {
+	return PingName
+}
+
+// Response statuses
+const (
+	ResponseOK    = "ok"
+	ResponseError = "error"
+)
+
+// Response is the command response
+// (the version 1 sensors reply with a plain "ok" string)
+type Response struct {
+	Version int    `json:"version,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	// SensorVersion is the sensor binary version
+	SensorVersion string `json:"sensor_version,omitempty"`
+}
+
+// Error is the command error reported by the sensor
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("sensor command error - %s", e.Message)
+}
+
+// Err returns the command error if the command failed
+func (r *Response) Err() error {
+	if r.Status == ResponseOK {
+		return nil
+	}
+
+	return &Error{Message: r.Error}
+}
+
+// EncodeResponse encodes the command response for the command result
+func EncodeResponse(cmdErr error) ([]byte, error) {
+	resp := Response{
+		Version:       channel.ProtocolVersion,
+		Status:        ResponseOK,
+		SensorVersion: version.Current(),
+	}
+
+	if cmdErr != nil {
+		resp.Status = ResponseError
+		resp.Error = cmdErr.Error()
+	}
+
+	return json.Marshal(&resp)
+}
+
+// DecodeResponse decodes the command response
+// (the plain string responses from the version 1 sensors are the response statuses)
+func DecodeResponse(data []byte) (*Response, error) {
+	var resp Response
+	if len(data) == 0 || data[0] != '{' {
+		resp.Status = string(data)
+		if resp.Status != ResponseOK {
+			resp.Error = resp.Status
+		}
+
+		return &resp, nil
+	}
+
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// the version 1 sensors ignore the message version
 type messageWrapper struct {
-	Name MessageName     `json:"name"`
-	Data json.RawMessage `json:"data,omitempty"`
+	Version int             `json:"version,omitempty"`
+	Name    MessageName     `json:"name"`
+	Data    json.RawMessage `json:"data,omitempty"`
 }
 
 // Encode encodes the message instance to a JSON buffer object
 func Encode(m Message) ([]byte, error) {
 	obj := messageWrapper{
-		Name: m.GetName(),
+		Version: channel.ProtocolVersion,
+		Name:    m.GetName(),
 	}
 
 	switch v := m.(type) {
@@ -76,6 +191,7 @@ func Encode(m Message) ([]byte, error) {
 		}
 	case *StopMonitor:
 	case *ShutdownSensor:
+	case *Ping:
 	default:
 		return nil, ErrUnknownMessage
 	}
@@ -102,6 +218,8 @@ func Decode(data []byte) (Message, error) {
 		return &StopMonitor{}, nil
 	case ShutdownSensorName:
 		return &ShutdownSensor{}, nil
+	case PingName:
+		return &Ping{}, nil
 	default:
 		return nil, ErrUnknownMessage
 	}
@@ -1,7 +1,10 @@
 package event
 
 import (
+	"encoding/json"
 	"errors"
+
+	"github.com/docker-slim/docker-slim/pkg/ipc/channel"
 )
 
 // Event errors
@@ -16,4 +19,64 @@ type Name string
 const (
 	StopMonitorDoneName    Name = "event.monitor.stop.done"
 	ShutdownSensorDoneName Name = "event.sensor.shutdown.done"
+	HeartbeatName          Name = "event.sensor.heartbeat"
+	MonitorStartedName     Name = "event.monitor.started"
+	MonitorProgressName    Name = "event.monitor.progress"
+	SensorWarningName      Name = "event.sensor.warning"
 )
+
+// IsInfo returns true for the informational events
+// (the master shows them, but it doesn't wait for them)
+func IsInfo(name Name) bool {
+	switch name {
+	case MonitorStartedName, MonitorProgressName, SensorWarningName:
+		return true
+	}
+
+	return false
+}
+
+// Progress is the monitoring progress (the partial results)
+type Progress struct {
+	EventCount   uint64 `json:"event_count"`
+	FileCount    uint64 `json:"file_count"`
+	ProcessCount uint64 `json:"process_count,omitempty"`
+	SyscallCount uint64 `json:"syscall_count"`
+	DroppedCount uint64 `json:"dropped_count,omitempty"`
+}
+
+// Message is the event message
+type Message struct {
+	Version int  `json:"version,omitempty"`
+	Name    Name `json:"name"`
+	// Seq is the event sequence number (the heartbeats are not numbered)
+	Seq uint64 `json:"seq,omitempty"`
+	// Last is the last published event in the heartbeats
+	// (the master uses it to recover the events it missed while it was disconnected)
+	Last *Message `json:"last,omitempty"`
+	// Progress is the monitoring progress (in the progress events)
+	Progress *Progress `json:"progress,omitempty"`
+	// Warning is the warning message (in the warning events)
+	Warning string `json:"warning,omitempty"`
+}
+
+// Encode encodes the event message
+func Encode(msg *Message) ([]byte, error) {
+	msg.Version = channel.ProtocolVersion
+	return json.Marshal(msg)
+}
+
+// Decode decodes the event message
+// (the version 1 sensors publish the plain event names)
+func Decode(data []byte) (*Message, error) {
+	if len(data) == 0 || data[0] != '{' {
+		return &Message{Name: Name(data)}, nil
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
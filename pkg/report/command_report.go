@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/docker-slim/docker-slim/pkg/distro"
 	"github.com/docker-slim/docker-slim/pkg/utils/errutils"
 )
 
@@ -23,12 +24,82 @@ const (
 	CmdTypeBuild   CmdType = "build"
 	CmdTypeProfile CmdType = "profile"
 	CmdTypeInfo    CmdType = "info"
+	CmdTypeBatch   CmdType = "batch"
 )
 
 type CmdType string
 
+// Command report formats
+const (
+	FormatJSON = "json"
+	FormatHTML = "html"
+	FormatYAML = "yaml"
+)
+
+// HTTPProbeResult contains the result of one HTTP probe call
+type HTTPProbeResult struct {
+	Method     string `json:"method"`
+	Resource   string `json:"resource"`
+	Host       string `json:"host,omitempty"`
+	Protocol   string `json:"protocol"`
+	Port       string `json:"port"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HTTPProbeReport contains the HTTP probe results
+type HTTPProbeReport struct {
+	CallCount  uint64            `json:"call_count"`
+	OkCount    uint64            `json:"ok_count"`
+	ErrorCount uint64            `json:"error_count"`
+	Results    []HTTPProbeResult `json:"results,omitempty"`
+}
+
+// ImageVerifyReport contains the minified image verification (--verify-image) results
+type ImageVerifyReport struct {
+	Passed    bool             `json:"passed"`
+	Running   bool             `json:"running"`
+	ExitCode  int              `json:"exit_code"`
+	HTTPProbe *HTTPProbeReport `json:"http_probe,omitempty"`
+	ExecProbe *ExecProbeReport `json:"exec_probe,omitempty"`
+	Errors    []string         `json:"errors,omitempty"`
+}
+
+// ExecProbeReport contains the test script (--exec-file) results
+type ExecProbeReport struct {
+	File     string `json:"file"`
+	ExitCode int    `json:"exit_code"`
+	Passed   bool   `json:"passed"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HookReport contains the monitoring hook (--host-exec-before-monitor and --host-exec-after-monitor) results
+type HookReport struct {
+	Stage    string `json:"stage"`
+	Command  string `json:"command"`
+	ExitCode int    `json:"exit_code"`
+	Passed   bool   `json:"passed"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SidecarReport contains the sidecar build results (--sidecar)
+type SidecarReport struct {
+	Image            string `json:"image"`
+	MinifiedImage    string `json:"minified_image,omitempty"`
+	ContainerName    string `json:"container_name,omitempty"`
+	ArtifactLocation string `json:"artifact_location,omitempty"`
+	ReportLocation   string `json:"report_location"`
+	OutputLocation   string `json:"output_location"`
+	ExitCode         int    `json:"exit_code"`
+	Error            string `json:"error,omitempty"`
+}
+
 type Command struct {
 	reportLocation string
+	reportFormat   string
+	SchemaVersion  string  `json:"schema_version"`
 	Type           CmdType `json:"type"`
 	State          string  `json:"state"`
 	Error          string  `json:"error,omitempty"`
@@ -36,83 +107,213 @@ type Command struct {
 
 type BuildCommand struct {
 	Command
-	OriginalImage          string  `json:"original_image"`
-	OriginalImageSize      int64   `json:"original_image_size"`
-	OriginalImageSizeHuman string  `json:"original_image_size_human"`
-	MinifiedImageSize      int64   `json:"minified_image_size"`
-	MinifiedImageSizeHuman string  `json:"minified_image_size_human"`
-	MinifiedImage          string  `json:"minified_image"`
-	MinifiedImageHasData   bool    `json:"minified_image_has_data"`
-	MinifiedBy             float64 `json:"minified_by"`
-	ArtifactLocation       string  `json:"artifact_location"`
-	ContainerReportName    string  `json:"container_report_name"`
-	SeccompProfileName     string  `json:"seccomp_profile_name"`
-	AppArmorProfileName    string  `json:"apparmor_profile_name"`
+	OriginalImage          string             `json:"original_image"`
+	OriginalImageSize      int64              `json:"original_image_size"`
+	OriginalImageSizeHuman string             `json:"original_image_size_human"`
+	MinifiedImageSize      int64              `json:"minified_image_size"`
+	MinifiedImageSizeHuman string             `json:"minified_image_size_human"`
+	MinifiedImage          string             `json:"minified_image"`
+	MinifiedImageHasData   bool               `json:"minified_image_has_data"`
+	MinifiedBy             float64            `json:"minified_by"`
+	ReductionPercent       float64            `json:"reduction_percent,omitempty"`
+	ArtifactLocation       string             `json:"artifact_location"`
+	ContainerReportName    string             `json:"container_report_name"`
+	SeccompProfileName     string             `json:"seccomp_profile_name"`
+	SeccompAnnotatedName   string             `json:"seccomp_annotated_profile_name,omitempty"`
+	AppArmorProfileName    string             `json:"apparmor_profile_name"`
+	OCISpecName            string             `json:"oci_spec_name,omitempty"`
+	K8sSecurityContextName string             `json:"k8s_security_context_name,omitempty"`
+	K8sPatchDirName        string             `json:"k8s_patch_dir_name,omitempty"`
+	DockerRunScriptName    string             `json:"docker_run_script_name,omitempty"`
+	ComposeSnippetName     string             `json:"compose_snippet_name,omitempty"`
+	FindingsReportName     string             `json:"findings_report_name,omitempty"`
+	FindingsCount          int                `json:"findings_count,omitempty"`
+	DirSizes               []DirSizeInfo      `json:"dir_sizes,omitempty"`
+	RemovedFilesName       string             `json:"removed_files_name,omitempty"`
+	RemovedFilesCount      int                `json:"removed_files_count,omitempty"`
+	Capabilities           []string           `json:"capabilities,omitempty"`
+	ContainerName          string             `json:"container_name,omitempty"`
+	HTTPProbe              *HTTPProbeReport   `json:"http_probe,omitempty"`
+	ExecProbe              *ExecProbeReport   `json:"exec_probe,omitempty"`
+	Hooks                  []HookReport       `json:"hooks,omitempty"`
+	ListeningPorts         []string           `json:"listening_ports,omitempty"`
+	DroppedExposedPorts    []string           `json:"dropped_exposed_ports,omitempty"`
+	UnusedEnvVars          []string           `json:"unused_env_vars,omitempty"`
+	ExecutedBinaries       []string           `json:"executed_binaries,omitempty"`
+	Distro                 *distro.Info       `json:"distro,omitempty"`
+	SizeBudgetErrors       []string           `json:"size_budget_errors,omitempty"`
+	ImageVerification      *ImageVerifyReport `json:"image_verification,omitempty"`
+	PolicyViolations       []string           `json:"policy_violations,omitempty"`
+	OutputBase             string             `json:"output_base,omitempty"`
+	MinifiedImageLayers    []string           `json:"minified_image_layers,omitempty"`
+	InstrumentedImage      string             `json:"instrumented_image,omitempty"`
+	Sidecars               []SidecarReport    `json:"sidecars,omitempty"`
 }
 
 type ProfileCommand struct {
 	Command
-	OriginalImage          string  `json:"original_image"`
-	OriginalImageSize      int64   `json:"original_image_size"`
-	OriginalImageSizeHuman string  `json:"original_image_size_human"`
-	MinifiedImageSize      int64   `json:"minified_image_size"`
-	MinifiedImageSizeHuman string  `json:"minified_image_size_human"`
-	MinifiedImage          string  `json:"minified_image"`
-	MinifiedImageHasData   bool    `json:"minified_image_has_data"`
-	MinifiedBy             float64 `json:"minified_by"`
-	ArtifactLocation       string  `json:"artifact_location"`
-	ContainerReportName    string  `json:"container_report_name"`
-	SeccompProfileName     string  `json:"seccomp_profile_name"`
-	AppArmorProfileName    string  `json:"apparmor_profile_name"`
+	OriginalImage          string           `json:"original_image"`
+	OriginalImageSize      int64            `json:"original_image_size"`
+	OriginalImageSizeHuman string           `json:"original_image_size_human"`
+	MinifiedImageSize      int64            `json:"minified_image_size"`
+	MinifiedImageSizeHuman string           `json:"minified_image_size_human"`
+	MinifiedImage          string           `json:"minified_image"`
+	MinifiedImageHasData   bool             `json:"minified_image_has_data"`
+	MinifiedBy             float64          `json:"minified_by"`
+	ArtifactLocation       string           `json:"artifact_location"`
+	ContainerReportName    string           `json:"container_report_name"`
+	SeccompProfileName     string           `json:"seccomp_profile_name"`
+	SeccompAnnotatedName   string           `json:"seccomp_annotated_profile_name,omitempty"`
+	AppArmorProfileName    string           `json:"apparmor_profile_name"`
+	OCISpecName            string           `json:"oci_spec_name,omitempty"`
+	K8sSecurityContextName string           `json:"k8s_security_context_name,omitempty"`
+	DockerRunScriptName    string           `json:"docker_run_script_name,omitempty"`
+	ComposeSnippetName     string           `json:"compose_snippet_name,omitempty"`
+	FindingsReportName     string           `json:"findings_report_name,omitempty"`
+	FindingsCount          int              `json:"findings_count,omitempty"`
+	DirSizes               []DirSizeInfo    `json:"dir_sizes,omitempty"`
+	RemovedFilesName       string           `json:"removed_files_name,omitempty"`
+	RemovedFilesCount      int              `json:"removed_files_count,omitempty"`
+	Capabilities           []string         `json:"capabilities,omitempty"`
+	ContainerName          string           `json:"container_name,omitempty"`
+	HTTPProbe              *HTTPProbeReport `json:"http_probe,omitempty"`
+	ExecProbe              *ExecProbeReport `json:"exec_probe,omitempty"`
+	Hooks                  []HookReport     `json:"hooks,omitempty"`
+	UnusedEnvVars          []string         `json:"unused_env_vars,omitempty"`
+	ExecutedBinaries       []string         `json:"executed_binaries,omitempty"`
+	Distro                 *distro.Info     `json:"distro,omitempty"`
+	PolicyViolations       []string         `json:"policy_violations,omitempty"`
 }
 
 type InfoCommand struct {
 	Command
-	OriginalImage          string  `json:"original_image"`
-	OriginalImageSize      int64   `json:"original_image_size"`
-	OriginalImageSizeHuman string  `json:"original_image_size_human"`
-	MinifiedImageSize      int64   `json:"minified_image_size"`
-	MinifiedImageSizeHuman string  `json:"minified_image_size_human"`
-	MinifiedImage          string  `json:"minified_image"`
-	MinifiedImageHasData   bool    `json:"minified_image_has_data"`
-	MinifiedBy             float64 `json:"minified_by"`
-	ArtifactLocation       string  `json:"artifact_location"`
-	ContainerReportName    string  `json:"container_report_name"`
-	SeccompProfileName     string  `json:"seccomp_profile_name"`
-	AppArmorProfileName    string  `json:"apparmor_profile_name"`
-}
-
-func NewBuildCommand(reportLocation string) *BuildCommand {
+	OriginalImage          string   `json:"original_image"`
+	OriginalImageSize      int64    `json:"original_image_size"`
+	OriginalImageSizeHuman string   `json:"original_image_size_human"`
+	MinifiedImageSize      int64    `json:"minified_image_size"`
+	MinifiedImageSizeHuman string   `json:"minified_image_size_human"`
+	MinifiedImage          string   `json:"minified_image"`
+	MinifiedImageHasData   bool     `json:"minified_image_has_data"`
+	MinifiedBy             float64  `json:"minified_by"`
+	ArtifactLocation       string   `json:"artifact_location"`
+	ContainerReportName    string   `json:"container_report_name"`
+	SeccompProfileName     string   `json:"seccomp_profile_name"`
+	SeccompAnnotatedName   string   `json:"seccomp_annotated_profile_name,omitempty"`
+	AppArmorProfileName    string   `json:"apparmor_profile_name"`
+	OCISpecName            string   `json:"oci_spec_name,omitempty"`
+	K8sSecurityContextName string   `json:"k8s_security_context_name,omitempty"`
+	DockerRunScriptName    string   `json:"docker_run_script_name,omitempty"`
+	ComposeSnippetName     string   `json:"compose_snippet_name,omitempty"`
+	FindingsReportName     string   `json:"findings_report_name,omitempty"`
+	FindingsCount          int      `json:"findings_count,omitempty"`
+	Capabilities           []string `json:"capabilities,omitempty"`
+}
+
+// BatchImageResult contains the build result for one image in a batch
+type BatchImageResult struct {
+	Image                  string   `json:"image"`
+	Args                   []string `json:"args,omitempty"`
+	JobID                  string   `json:"job_id"`
+	State                  string   `json:"state"`
+	ExitCode               int      `json:"exit_code"`
+	Error                  string   `json:"error,omitempty"`
+	OriginalImageSize      int64    `json:"original_image_size,omitempty"`
+	OriginalImageSizeHuman string   `json:"original_image_size_human,omitempty"`
+	MinifiedImage          string   `json:"minified_image,omitempty"`
+	MinifiedImageSize      int64    `json:"minified_image_size,omitempty"`
+	MinifiedImageSizeHuman string   `json:"minified_image_size_human,omitempty"`
+	MinifiedBy             float64  `json:"minified_by,omitempty"`
+	ReportLocation         string   `json:"report_location,omitempty"`
+}
+
+type BatchCommand struct {
+	Command
+	ImageCount             int                `json:"image_count"`
+	DoneCount              int                `json:"done_count"`
+	FailedCount            int                `json:"failed_count"`
+	OriginalImageSize      int64              `json:"original_image_size"`
+	OriginalImageSizeHuman string             `json:"original_image_size_human"`
+	MinifiedImageSize      int64              `json:"minified_image_size"`
+	MinifiedImageSizeHuman string             `json:"minified_image_size_human"`
+	SavedSize              int64              `json:"saved_size"`
+	SavedSizeHuman         string             `json:"saved_size_human"`
+	Images                 []BatchImageResult `json:"images"`
+}
+
+func NewBuildCommand(reportLocation, reportFormat string) *BuildCommand {
 	return &BuildCommand{
 		Command: Command{
 			reportLocation: reportLocation,
+			reportFormat:   reportFormat,
+			SchemaVersion:  SchemaVersion,
 			Type:           CmdTypeBuild,
 			State:          CmdStateUnknown,
 		},
 	}
 }
 
-func NewProfileCommand(reportLocation string) *ProfileCommand {
+func NewProfileCommand(reportLocation, reportFormat string) *ProfileCommand {
 	return &ProfileCommand{
 		Command: Command{
 			reportLocation: reportLocation,
+			reportFormat:   reportFormat,
+			SchemaVersion:  SchemaVersion,
 			Type:           CmdTypeProfile,
 			State:          CmdStateUnknown,
 		},
 	}
 }
 
-func NewInfoCommand(reportLocation string) *InfoCommand {
+func NewInfoCommand(reportLocation, reportFormat string) *InfoCommand {
 	return &InfoCommand{
 		Command: Command{
 			reportLocation: reportLocation,
+			reportFormat:   reportFormat,
+			SchemaVersion:  SchemaVersion,
 			Type:           CmdTypeInfo,
 			State:          CmdStateUnknown,
 		},
 	}
 }
 
+func NewBatchCommand(reportLocation, reportFormat string) *BatchCommand {
+	return &BatchCommand{
+		Command: Command{
+			reportLocation: reportLocation,
+			reportFormat:   reportFormat,
+			SchemaVersion:  SchemaVersion,
+			Type:           CmdTypeBatch,
+			State:          CmdStateUnknown,
+		},
+	}
+}
+
+// Save saves the build command report data
+func (p *BuildCommand) Save() {
+	p.saveInfo(p)
+}
+
+// Save saves the profile command report data
+func (p *ProfileCommand) Save() {
+	p.saveInfo(p)
+}
+
+// Save saves the info command report data
+func (p *InfoCommand) Save() {
+	p.saveInfo(p)
+}
+
+// Save saves the batch command report data
+func (p *BatchCommand) Save() {
+	p.saveInfo(p)
+}
+
+// Save saves the common command report data
 func (p *Command) Save() {
+	p.saveInfo(p)
+}
+
+func (p *Command) saveInfo(info interface{}) {
 	if p.reportLocation != "" {
 		dirName := filepath.Dir(p.reportLocation)
 		baseName := filepath.Base(p.reportLocation)
@@ -131,10 +332,55 @@ func (p *Command) Save() {
 			}
 		}
 
-		reportData, err := json.MarshalIndent(p, "", "  ")
+		var reportData []byte
+		var err error
+		switch p.reportFormat {
+		case FormatHTML:
+			reportData, err = HTMLReport(info, nil)
+		case FormatYAML:
+			if reportData, err = json.Marshal(info); err == nil {
+				reportData, err = jsonToYAML(reportData)
+			}
+		default:
+			reportData, err = json.MarshalIndent(info, "", "  ")
+		}
 		errutils.FailOn(err)
 
 		err = ioutil.WriteFile(p.reportLocation, reportData, 0644)
 		errutils.FailOn(err)
 	}
 }
+
+// LoadCommandReport loads a saved JSON command report
+// (the result is a *BuildCommand, a *ProfileCommand, an *InfoCommand or a *BatchCommand based on the report type)
+func LoadCommandReport(location string) (interface{}, error) {
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, err
+	}
+
+	var info interface{}
+	switch cmd.Type {
+	case CmdTypeBuild:
+		info = &BuildCommand{}
+	case CmdTypeProfile:
+		info = &ProfileCommand{}
+	case CmdTypeInfo:
+		info = &InfoCommand{}
+	case CmdTypeBatch:
+		info = &BatchCommand{}
+	default:
+		return nil, fmt.Errorf("unknown command report type - %q", cmd.Type)
+	}
+
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
@@ -3,7 +3,10 @@ package report
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+
+	"github.com/docker-slim/docker-slim/pkg/distro"
 )
 
 // ArtifactType is an artifact type ID
@@ -55,6 +58,15 @@ type ProcessInfo struct {
 	ParentPid int32  `json:"ppid"`
 }
 
+// ExecInfo describes a command executed while the target app was monitored
+// (the arguments matching the redaction pattern are redacted by the sensor)
+type ExecInfo struct {
+	Pid       int32    `json:"pid"`
+	ParentPid int32    `json:"ppid"`
+	Path      string   `json:"path"`
+	Args      []string `json:"args,omitempty"`
+}
+
 // FileInfo contains various file object and activity metadata
 type FileInfo struct {
 	EventCount   uint32 `json:"event_count"`
@@ -73,6 +85,10 @@ type FanMonitorReport struct {
 	MainProcess      *ProcessInfo                    `json:"main_process"`
 	Processes        map[string]*ProcessInfo         `json:"processes"`
 	ProcessFiles     map[string]map[string]*FileInfo `json:"process_files"`
+	// OverflowCount is the number of the FANOTIFY event queue overflows (the file events were dropped)
+	OverflowCount uint32 `json:"overflow_count,omitempty"`
+	// Execs are the executed commands in the execution order
+	Execs []*ExecInfo `json:"execs,omitempty"`
 }
 
 // PeMonitorReport is a processing monitoring report
@@ -85,15 +101,93 @@ type PeMonitorReport struct {
 type SyscallStatInfo struct {
 	Number int16  `json:"num"`
 	Name   string `json:"name"`
+	Arch   string `json:"arch,omitempty"`
 	Count  uint64 `json:"count"`
 }
 
+// SocketStatInfo contains various socket creation activity metadata
+type SocketStatInfo struct {
+	Family     uint64 `json:"family"`
+	FamilyName string `json:"family_name"`
+	Type       uint64 `json:"type"`
+	TypeName   string `json:"type_name"`
+	Count      uint64 `json:"count"`
+}
+
+// CapabilityStatInfo contains the successful system calls that needed a capability
+// (the sensor checks the call arguments and the process credentials, e.g., a signal sent to a process
+// of another user needs KILL, but a signal sent to a process of the same user doesn't)
+type CapabilityStatInfo struct {
+	Capability string `json:"capability"`
+	Syscall    string `json:"syscall"`
+	Count      uint64 `json:"count"`
+}
+
+// FSActivityInfo contains the file system activity metadata collected with ptrace
+// (used when the FANOTIFY monitor is not available, e.g., with rootless Docker)
+type FSActivityInfo struct {
+	OpsAll       uint64 `json:"ops_all"`
+	OpsCheckFile uint64 `json:"ops_checkfile"`
+	OpsExec      uint64 `json:"ops_exec,omitempty"`
+}
+
 // PtMonitorReport contains various process execution metadata
 type PtMonitorReport struct {
 	ArchName     string                     `json:"arch_name"`
 	SyscallCount uint64                     `json:"syscall_count"`
 	SyscallNum   uint32                     `json:"syscall_num"`
 	SyscallStats map[string]SyscallStatInfo `json:"syscall_stats"`
+	SocketStats  map[string]SocketStatInfo  `json:"socket_stats"`
+	// CapabilityStats are keyed by the capability and the system call names ('<capability>:<syscall>')
+	CapabilityStats map[string]CapabilityStatInfo `json:"capability_stats,omitempty"`
+	TargetPid       int                           `json:"target_pid,omitempty"`
+	FSActivity      map[string]*FSActivityInfo    `json:"fs_activity,omitempty"`
+	// SampledOutCount is the number of the system calls that were only counted (see the ptrace sample rate)
+	SampledOutCount uint64 `json:"sampled_out_count,omitempty"`
+}
+
+// ListeningPort is a port the target app listened on while it was monitored
+type ListeningPort struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+}
+
+// String returns the port in the Docker port format (e.g., '8080/tcp')
+func (p ListeningPort) String() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+// NetMonitorReport contains the network activity observed while the target app was monitored
+type NetMonitorReport struct {
+	// ListeningPorts are the ports reachable from outside of the container
+	// (the loopback only ports and the sensor ports are not included)
+	ListeningPorts []ListeningPort `json:"listening_ports"`
+}
+
+// Keep reason types (why a file is kept in the minified image)
+const (
+	KeepReasonObserved = "observed"
+	KeepReasonLibrary  = "library"
+	KeepReasonLink     = "link"
+	KeepReasonInclude  = "include_path"
+	//a shared library or a loader a kept binary needs (found with the loader paths)
+	KeepReasonDependency = "dependency"
+)
+
+// KeepReason describes why a file is kept in the minified image
+type KeepReason struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// String converts the keep reason to a string
+func (r KeepReason) String() string {
+	if r.Detail == "" {
+		return r.Type
+	}
+
+	return fmt.Sprintf("%s (%s)", r.Type, r.Detail)
 }
 
 // ArtifactProps contains various file system artifact properties
@@ -108,9 +202,22 @@ type ArtifactProps struct {
 	FileSize  int64           `json:"file_size"`
 	Sha1Hash  string          `json:"sha1_hash,omitempty"`
 	AppType   string          `json:"app_type,omitempty"`
+	Package   string          `json:"package,omitempty"`
+	Reasons   []KeepReason    `json:"reasons,omitempty"`
 	FileInode uint64          `json:"-"` //todo
 }
 
+// AddReason adds a keep reason for the artifact (the duplicate reasons are ignored)
+func (p *ArtifactProps) AddReason(reasonType, detail string) {
+	for _, reason := range p.Reasons {
+		if reason.Type == reasonType && reason.Detail == detail {
+			return
+		}
+	}
+
+	p.Reasons = append(p.Reasons, KeepReason{Type: reasonType, Detail: detail})
+}
+
 // UnmarshalJSON decodes artifact property data
 func (p *ArtifactProps) UnmarshalJSON(data []byte) error {
 	type artifactPropsType ArtifactProps
@@ -143,19 +250,27 @@ func (p *ArtifactProps) MarshalJSON() ([]byte, error) {
 
 // ImageReport contains image report fields
 type ImageReport struct {
-	Files []*ArtifactProps `json:"files"`
+	Distro *distro.Info `json:"distro,omitempty"`
+	// LibcWarnings are the kept binaries linked with the other C library
+	// and the libraries the loader can't find
+	LibcWarnings []string         `json:"libc_warnings,omitempty"`
+	Files        []*ArtifactProps `json:"files"`
+	DirSizes     []DirSizeInfo    `json:"dir_sizes,omitempty"`
+	EnvVars      []EnvVarUsage    `json:"env_vars,omitempty"`
 }
 
 // MonitorReports contains monitoring report fields
 type MonitorReports struct {
 	Fan *FanMonitorReport `json:"fan"`
 	Pt  *PtMonitorReport  `json:"pt"`
+	Net *NetMonitorReport `json:"net,omitempty"`
 }
 
 // ContainerReport contains container report fields
 type ContainerReport struct {
-	Monitors MonitorReports `json:"monitors"`
-	Image    ImageReport    `json:"image"`
+	SchemaVersion string         `json:"schema_version"`
+	Monitors      MonitorReports `json:"monitors"`
+	Image         ImageReport    `json:"image"`
 }
 
 // PermSetFromFlags maps artifact flags to permissions
@@ -0,0 +1,224 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ReportSet contains a saved command report and the container report it references
+// (or only the container report if a container report file is loaded)
+type ReportSet struct {
+	Location  string
+	Command   *BuildCommand
+	Container *ContainerReport
+}
+
+// SizeDiff describes an image size change
+type SizeDiff struct {
+	Old   int64 `json:"old"`
+	New   int64 `json:"new"`
+	Delta int64 `json:"delta"`
+}
+
+// ListDiff describes the changes in a set of named items
+type ListDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Empty returns true if there are no changes
+func (d *ListDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// ReportDiff contains the differences between two reports
+type ReportDiff struct {
+	OldLocation       string    `json:"old_location"`
+	NewLocation       string    `json:"new_location"`
+	OriginalImageSize *SizeDiff `json:"original_image_size,omitempty"`
+	MinifiedImageSize *SizeDiff `json:"minified_image_size,omitempty"`
+	Files             *ListDiff `json:"files,omitempty"`
+	ChangedFiles      []string  `json:"changed_files,omitempty"`
+	Syscalls          *ListDiff `json:"syscalls,omitempty"`
+	Sockets           *ListDiff `json:"sockets,omitempty"`
+	Capabilities      *ListDiff `json:"capabilities,omitempty"`
+}
+
+// LoadReportSet loads a command report (and the container report in its artifact location)
+// or a container report
+func LoadReportSet(location string) (*ReportSet, error) {
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("not a JSON report - %v (%v)", location, err)
+	}
+
+	set := &ReportSet{Location: location}
+
+	if _, ok := fields["monitors"]; ok {
+		var creport ContainerReport
+		if err := json.Unmarshal(data, &creport); err != nil {
+			return nil, err
+		}
+
+		set.Container = &creport
+		return set, nil
+	}
+
+	if _, ok := fields["type"]; !ok {
+		return nil, fmt.Errorf("unknown report type - %v", location)
+	}
+
+	//the build command report has all command report fields
+	var cmdReport BuildCommand
+	if err := json.Unmarshal(data, &cmdReport); err != nil {
+		return nil, err
+	}
+	set.Command = &cmdReport
+
+	if cmdReport.ArtifactLocation != "" && cmdReport.ContainerReportName != "" {
+		creportPath := filepath.Join(cmdReport.ArtifactLocation, cmdReport.ContainerReportName)
+		if _, err := os.Stat(creportPath); err == nil {
+			creportSet, err := LoadReportSet(creportPath)
+			if err != nil {
+				return nil, err
+			}
+
+			set.Container = creportSet.Container
+		}
+	}
+
+	return set, nil
+}
+
+// DiffReports compares two report sets
+func DiffReports(oldSet, newSet *ReportSet) *ReportDiff {
+	diff := &ReportDiff{
+		OldLocation: oldSet.Location,
+		NewLocation: newSet.Location,
+	}
+
+	if oldSet.Command != nil && newSet.Command != nil {
+		diff.OriginalImageSize = newSizeDiff(oldSet.Command.OriginalImageSize, newSet.Command.OriginalImageSize)
+		if oldSet.Command.MinifiedImageSize > 0 || newSet.Command.MinifiedImageSize > 0 {
+			diff.MinifiedImageSize = newSizeDiff(oldSet.Command.MinifiedImageSize, newSet.Command.MinifiedImageSize)
+		}
+
+		diff.Capabilities = diffLists(oldSet.Command.Capabilities, newSet.Command.Capabilities)
+	}
+
+	if oldSet.Container != nil && newSet.Container != nil {
+		oldFiles := fileHashes(oldSet.Container)
+		newFiles := fileHashes(newSet.Container)
+		diff.Files = diffLists(mapKeys(oldFiles), mapKeys(newFiles))
+
+		for name, hash := range newFiles {
+			if oldHash, ok := oldFiles[name]; ok && oldHash != hash {
+				diff.ChangedFiles = append(diff.ChangedFiles, name)
+			}
+		}
+		sort.Strings(diff.ChangedFiles)
+
+		diff.Syscalls = diffLists(syscallNames(oldSet.Container), syscallNames(newSet.Container))
+		diff.Sockets = diffLists(socketNames(oldSet.Container), socketNames(newSet.Container))
+	}
+
+	return diff
+}
+
+func newSizeDiff(oldSize, newSize int64) *SizeDiff {
+	return &SizeDiff{
+		Old:   oldSize,
+		New:   newSize,
+		Delta: newSize - oldSize,
+	}
+}
+
+func diffLists(oldList, newList []string) *ListDiff {
+	oldSet := map[string]struct{}{}
+	for _, name := range oldList {
+		oldSet[name] = struct{}{}
+	}
+
+	newSet := map[string]struct{}{}
+	for _, name := range newList {
+		newSet[name] = struct{}{}
+	}
+
+	diff := &ListDiff{}
+	for name := range newSet {
+		if _, ok := oldSet[name]; !ok {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+
+	for name := range oldSet {
+		if _, ok := newSet[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+
+	return diff
+}
+
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+func fileHashes(creport *ContainerReport) map[string]string {
+	files := map[string]string{}
+	for _, file := range creport.Image.Files {
+		if file != nil {
+			files[file.FilePath] = file.Sha1Hash
+		}
+	}
+
+	return files
+}
+
+func syscallNames(creport *ContainerReport) []string {
+	if creport.Monitors.Pt == nil {
+		return nil
+	}
+
+	var names []string
+	for _, info := range creport.Monitors.Pt.SyscallStats {
+		name := info.Name
+		if info.Arch != "" {
+			name = fmt.Sprintf("%s (%s)", name, info.Arch)
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func socketNames(creport *ContainerReport) []string {
+	if creport.Monitors.Pt == nil {
+		return nil
+	}
+
+	var names []string
+	for _, info := range creport.Monitors.Pt.SocketStats {
+		names = append(names, fmt.Sprintf("%s/%s", info.FamilyName, info.TypeName))
+	}
+
+	return names
+}
@@ -0,0 +1,21 @@
+package report
+
+// Environment variable usage statuses
+const (
+	// EnvVarUsed is used for the variables referenced by the files the target app accessed
+	EnvVarUsed = "used"
+	// EnvVarUnused is used for the variables not referenced by any of the files the target app accessed
+	EnvVarUnused = "unused"
+	// EnvVarSystem is used for the variables the loader, libc and the shells read (they are always used)
+	EnvVarSystem = "system"
+)
+
+// EnvVarUsage describes if the target app used an environment variable declared in the image
+type EnvVarUsage struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Secret is true if the variable name looks like a secret name (e.g., 'DB_PASSWORD')
+	Secret bool `json:"secret,omitempty"`
+	// Files are the first accessed files that reference the variable
+	Files []string `json:"files,omitempty"`
+}
@@ -0,0 +1,637 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker-slim/docker-slim/pkg/third_party/opencontainers/specs"
+
+	"github.com/dustin/go-humanize"
+)
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>docker-slim {{.Type}} report - {{.ImageName}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.25em; border-bottom: 1px solid #e1e4e8; padding-bottom: .3em; margin-top: 2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #dfe2e5; padding: 4px 10px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+code, .mono { font-family: SFMono-Regular, Consolas, Menlo, monospace; font-size: .9em; }
+.state-error { color: #cb2431; font-weight: bold; }
+.state-ok { color: #22863a; font-weight: bold; }
+.bar { background: #0366d6; height: .8em; display: inline-block; }
+ul.tree { list-style: none; padding-left: 1.2em; margin: 0; }
+ul.tree li { margin: 1px 0; }
+.size { color: #6a737d; }
+.note { color: #6a737d; font-style: italic; }
+</style>
+</head>
+<body>
+{{- if .IndexURL}}
+<p><a href="{{.IndexURL}}">&larr; all runs</a></p>
+{{- end}}
+<h1>docker-slim {{.Type}} report</h1>
+<table>
+{{- if .ImageName}}
+<tr><th>Image</th><td class="mono">{{.ImageName}}</td></tr>
+{{- end}}
+<tr><th>State</th><td class="{{if .Error}}state-error{{else}}state-ok{{end}}">{{.State}}{{if .Error}} - {{.Error}}{{end}}</td></tr>
+<tr><th>Generated</th><td>{{.Generated}}</td></tr>
+<tr><th>Schema version</th><td>{{.SchemaVersion}}</td></tr>
+</table>
+{{- if .OriginalImage}}
+
+<h2>Image size</h2>
+<table>
+<tr><th></th><th>Image</th><th>Size</th></tr>
+<tr><th>Original</th><td class="mono">{{.OriginalImage}}</td><td>{{.OriginalSize}}</td></tr>
+{{- if .MinifiedImage}}
+<tr><th>Minified</th><td class="mono">{{.MinifiedImage}}</td><td>{{.MinifiedSize}}</td></tr>
+{{- end}}
+</table>
+{{- if .MinifiedBy}}
+<p>Minified by <b>{{printf "%.2f" .MinifiedBy}}X</b>{{if .ReductionPercent}} ({{printf "%.1f" .ReductionPercent}}% smaller){{end}}</p>
+{{- end}}
+{{- end}}
+{{- if .Batch}}
+
+<h2>Images</h2>
+<p>{{.Batch.ImageCount}} images ({{.Batch.DoneCount}} done, {{.Batch.FailedCount}} failed). Original images: {{.Batch.OriginalImageSizeHuman}}, minified images: {{.Batch.MinifiedImageSizeHuman}}, saved: <b>{{.Batch.SavedSizeHuman}}</b></p>
+<table>
+<tr><th>Image</th><th>State</th><th>Original</th><th>Minified</th><th>Minified by</th><th>Report</th></tr>
+{{- range .Batch.Images}}
+<tr><td class="mono">{{.Image}}{{if .MinifiedImage}}<br>&rarr; {{.MinifiedImage}}{{end}}</td><td class="{{if .Error}}state-error{{else}}state-ok{{end}}">{{.State}}{{if .Error}} - {{.Error}}{{end}}</td><td>{{.OriginalImageSizeHuman}}</td><td>{{.MinifiedImageSizeHuman}}</td><td>{{if .MinifiedBy}}{{printf "%.2f" .MinifiedBy}}X{{end}}</td><td class="mono">{{.ReportLocation}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .DirSizes}}
+
+<h2>Size savings by directory</h2>
+<table>
+<tr><th>Directory</th><th>Original</th><th>Kept</th><th>Dropped</th><th colspan="2">Kept share</th></tr>
+{{- range .DirSizes}}
+<tr><td class="mono">{{.Dir}}</td><td>{{.Original}} ({{.OriginalCount}} files)</td><td>{{.Kept}} ({{.KeptCount}} files)</td><td>{{.Dropped}} ({{.DroppedCount}} files)</td><td style="width: 200px"><span class="bar" style="width: {{.KeptPercent}}%"></span></td><td>{{.KeptPercent}}%</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .SizeBreakdown}}
+
+<h2>Kept file size breakdown</h2>
+<p>{{.KeptFileCount}} files ({{.KeptFileSize}})</p>
+<table>
+<tr><th>Directory</th><th>Files</th><th>Size</th><th colspan="2">Share</th></tr>
+{{- range .SizeBreakdown}}
+<tr><td class="mono">{{.Path}}</td><td>{{.FileCount}}</td><td>{{.Size}}</td><td style="width: 200px"><span class="bar" style="width: {{.Percent}}%"></span></td><td>{{.Percent}}%</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .HTTPProbe}}
+
+<h2>HTTP probe</h2>
+<p>calls: {{.HTTPProbe.CallCount}}, ok: {{.HTTPProbe.OkCount}}, errors: {{.HTTPProbe.ErrorCount}}</p>
+{{- if .HTTPProbe.Results}}
+<table>
+<tr><th>Method</th><th>Resource</th><th>Protocol</th><th>Port</th><th>Result</th></tr>
+{{- range .HTTPProbe.Results}}
+<tr><td>{{.Method}}</td><td class="mono">{{.Resource}}</td><td>{{.Protocol}}</td><td>{{.Port}}</td><td>{{if .Error}}<span class="state-error">{{.Error}}</span>{{else}}{{.StatusCode}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- if .ExecProbe}}
+
+<h2>Test script</h2>
+<p class="mono">{{.ExecProbe.File}}</p>
+<p>result: <span class="{{if .ExecProbe.Passed}}state-ok{{else}}state-error{{end}}">{{if .ExecProbe.Passed}}passed{{else}}failed{{end}}</span>, exit code: {{.ExecProbe.ExitCode}}{{if .ExecProbe.Duration}}, duration: {{.ExecProbe.Duration}}{{end}}{{if .ExecProbe.Error}} - {{.ExecProbe.Error}}{{end}}</p>
+{{- end}}
+{{- if .ImageVerification}}
+
+<h2>Minified image verification</h2>
+<p>result: <span class="{{if .ImageVerification.Passed}}state-ok{{else}}state-error{{end}}">{{if .ImageVerification.Passed}}passed{{else}}failed{{end}}</span>{{if .ImageVerification.HTTPProbe}}, HTTP probe calls: {{.ImageVerification.HTTPProbe.CallCount}} (ok: {{.ImageVerification.HTTPProbe.OkCount}}){{end}}{{if .ImageVerification.ExecProbe}}, test script exit code: {{.ImageVerification.ExecProbe.ExitCode}}{{end}}</p>
+{{- range .ImageVerification.Errors}}
+<p class="state-error">{{.}}</p>
+{{- end}}
+{{- end}}
+{{- if or .Seccomp .AppArmorProfileName .Capabilities}}
+
+<h2>Security profiles</h2>
+{{- if .Capabilities}}
+<p>Capabilities: {{range $idx, $value := .Capabilities}}{{if $idx}}, {{end}}<code>{{$value}}</code>{{end}}</p>
+{{- end}}
+{{- if .AppArmorProfileName}}
+<p>AppArmor profile: <code>{{.AppArmorProfileName}}</code></p>
+{{- if .AppArmorProfile}}
+<details><summary>AppArmor profile rules</summary><pre>{{.AppArmorProfile}}</pre></details>
+{{- end}}
+{{- end}}
+{{- if .Seccomp}}
+<p>Seccomp profile: <code>{{.Seccomp.Name}}</code> ({{.Seccomp.SyscallCount}} allowed system calls)</p>
+<table>
+<tr><th>Group</th><th>System calls</th></tr>
+{{- range .Seccomp.Groups}}
+<tr><td>{{.Comment}}</td><td class="mono">{{range $idx, $value := .Names}}{{if $idx}}, {{end}}{{$value}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- if .Artifacts}}
+
+<h2>Artifacts</h2>
+<p>Location: <code>{{.ArtifactLocation}}</code></p>
+<table>
+{{- range .Artifacts}}
+<tr><th>{{.Label}}</th><td class="mono">{{if $.ArtifactURL}}<a href="{{$.ArtifactURL}}/{{.Name}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .KeptFiles}}
+
+<h2>Kept files</h2>
+<ul class="tree">{{template "node" .KeptFiles}}</ul>
+{{- end}}
+{{- if .RemovedFiles}}
+
+<h2>Removed files</h2>
+<p>{{.RemovedFileCount}} files ({{.RemovedFileSize}})</p>
+<ul class="tree">{{template "node" .RemovedFiles}}</ul>
+{{- end}}
+</body>
+</html>
+{{define "node"}}
+{{- range .Children}}
+{{- if .Children}}
+<li><details><summary class="mono">{{.Name}}/ <span class="size">({{.Size}})</span></summary><ul class="tree">{{template "node" .}}</ul></details></li>
+{{- else}}
+<li class="mono">{{.Name}} <span class="size">({{.Size}})</span>{{if .Note}} <span class="note">{{.Note}}</span>{{end}}</li>
+{{- end}}
+{{- end}}
+{{- end}}
+`
+
+type htmlReportData struct {
+	Type                string
+	State               string
+	Error               string
+	SchemaVersion       string
+	Generated           string
+	ImageName           string
+	OriginalImage       string
+	OriginalSize        string
+	MinifiedImage       string
+	MinifiedSize        string
+	MinifiedBy          float64
+	ReductionPercent    float64
+	DirSizes            []htmlDirSize
+	ArtifactLocation    string
+	Artifacts           []htmlArtifact
+	Capabilities        []string
+	AppArmorProfileName string
+	Seccomp             *htmlSeccompSummary
+	HTTPProbe           *HTTPProbeReport
+	ExecProbe           *ExecProbeReport
+	ImageVerification   *ImageVerifyReport
+	KeptFileCount       int
+	KeptFileSize        string
+	SizeBreakdown       []htmlSizeEntry
+	KeptFiles           *htmlFileNode
+	RemovedFileCount    int
+	RemovedFileSize     string
+	RemovedFiles        *htmlFileNode
+	AppArmorProfile     string
+	ArtifactURL         string
+	IndexURL            string
+	Batch               *BatchCommand
+}
+
+type htmlArtifact struct {
+	Label string
+	Name  string
+}
+
+type htmlSeccompSummary struct {
+	Name         string
+	SyscallCount int
+	Groups       []htmlSyscallGroup
+}
+
+type htmlSyscallGroup struct {
+	Comment string
+	Names   []string
+}
+
+type htmlSizeEntry struct {
+	Path      string
+	FileCount int
+	Size      string
+	Percent   int
+	bytes     int64
+}
+
+type htmlDirSize struct {
+	Dir           string
+	Original      string
+	OriginalCount int
+	Kept          string
+	KeptCount     int
+	Dropped       string
+	DroppedCount  int
+	KeptPercent   int
+}
+
+type htmlFileNode struct {
+	Name     string
+	Size     string
+	Note     string
+	Children []*htmlFileNode
+	bytes    int64
+	children map[string]*htmlFileNode
+}
+
+// artifactInfo contains the command report fields with the generated artifact info
+type artifactInfo struct {
+	ArtifactLocation       string
+	ContainerReportName    string
+	SeccompProfileName     string
+	SeccompAnnotatedName   string
+	AppArmorProfileName    string
+	OCISpecName            string
+	K8sSecurityContextName string
+	DockerRunScriptName    string
+	ComposeSnippetName     string
+	FindingsReportName     string
+	RemovedFilesName       string
+}
+
+// HTMLOptions contains the optional HTML report settings (used by the 'serve' mode web UI)
+type HTMLOptions struct {
+	//load the artifacts from this location instead of the report artifact location
+	ArtifactLocation string
+	//link the artifacts (base URL)
+	ArtifactURL string
+	//link to the run list
+	IndexURL string
+}
+
+// HTMLReport renders the command report as a self-contained HTML page
+func HTMLReport(info interface{}, options *HTMLOptions) ([]byte, error) {
+	var data htmlReportData
+	var artifacts artifactInfo
+
+	switch report := info.(type) {
+	case *BuildCommand:
+		data.setCommand(&report.Command)
+		data.setImages(report.OriginalImage, report.OriginalImageSizeHuman,
+			report.MinifiedImage, report.MinifiedImageSizeHuman, report.MinifiedBy)
+		data.ReductionPercent = report.ReductionPercent
+		data.setDirSizes(report.DirSizes)
+		data.Capabilities = report.Capabilities
+		data.HTTPProbe = report.HTTPProbe
+		data.ExecProbe = report.ExecProbe
+		data.ImageVerification = report.ImageVerification
+		artifacts = artifactInfo{
+			ArtifactLocation:       report.ArtifactLocation,
+			ContainerReportName:    report.ContainerReportName,
+			SeccompProfileName:     report.SeccompProfileName,
+			SeccompAnnotatedName:   report.SeccompAnnotatedName,
+			AppArmorProfileName:    report.AppArmorProfileName,
+			OCISpecName:            report.OCISpecName,
+			K8sSecurityContextName: report.K8sSecurityContextName,
+			DockerRunScriptName:    report.DockerRunScriptName,
+			ComposeSnippetName:     report.ComposeSnippetName,
+			FindingsReportName:     report.FindingsReportName,
+			RemovedFilesName:       report.RemovedFilesName,
+		}
+	case *ProfileCommand:
+		data.setCommand(&report.Command)
+		data.setImages(report.OriginalImage, report.OriginalImageSizeHuman,
+			report.MinifiedImage, report.MinifiedImageSizeHuman, report.MinifiedBy)
+		data.setDirSizes(report.DirSizes)
+		data.Capabilities = report.Capabilities
+		data.HTTPProbe = report.HTTPProbe
+		data.ExecProbe = report.ExecProbe
+		artifacts = artifactInfo{
+			ArtifactLocation:       report.ArtifactLocation,
+			ContainerReportName:    report.ContainerReportName,
+			SeccompProfileName:     report.SeccompProfileName,
+			SeccompAnnotatedName:   report.SeccompAnnotatedName,
+			AppArmorProfileName:    report.AppArmorProfileName,
+			OCISpecName:            report.OCISpecName,
+			K8sSecurityContextName: report.K8sSecurityContextName,
+			DockerRunScriptName:    report.DockerRunScriptName,
+			ComposeSnippetName:     report.ComposeSnippetName,
+			FindingsReportName:     report.FindingsReportName,
+			RemovedFilesName:       report.RemovedFilesName,
+		}
+	case *InfoCommand:
+		data.setCommand(&report.Command)
+		data.setImages(report.OriginalImage, report.OriginalImageSizeHuman, "", "", 0)
+	case *BatchCommand:
+		data.setCommand(&report.Command)
+		data.Batch = report
+	case *Command:
+		data.setCommand(report)
+	default:
+		return nil, fmt.Errorf("unsupported report type - %T", info)
+	}
+
+	if options != nil {
+		if options.ArtifactLocation != "" && artifacts.ArtifactLocation != "" {
+			artifacts.ArtifactLocation = options.ArtifactLocation
+		}
+
+		data.ArtifactURL = options.ArtifactURL
+		data.IndexURL = options.IndexURL
+	}
+
+	data.setArtifacts(&artifacts)
+
+	t, err := template.New("report").Parse(htmlReportTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, &data); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+func (d *htmlReportData) setCommand(cmd *Command) {
+	d.Type = string(cmd.Type)
+	d.State = cmd.State
+	d.Error = cmd.Error
+	d.SchemaVersion = cmd.SchemaVersion
+	d.Generated = time.Now().UTC().Format(time.RFC1123)
+}
+
+func (d *htmlReportData) setImages(originalImage, originalSize, minifiedImage, minifiedSize string, minifiedBy float64) {
+	d.ImageName = originalImage
+	d.OriginalImage = originalImage
+	d.OriginalSize = originalSize
+	d.MinifiedImage = minifiedImage
+	d.MinifiedSize = minifiedSize
+	d.MinifiedBy = minifiedBy
+}
+
+func (d *htmlReportData) setDirSizes(dirSizes []DirSizeInfo) {
+	for _, info := range dirSizes {
+		entry := htmlDirSize{
+			Dir:           info.Dir,
+			Original:      humanize.Bytes(uint64(info.OriginalSize)),
+			OriginalCount: info.OriginalFileCount,
+			Kept:          humanize.Bytes(uint64(info.KeptSize)),
+			KeptCount:     info.KeptFileCount,
+			Dropped:       humanize.Bytes(uint64(info.DroppedSize)),
+			DroppedCount:  info.DroppedFileCount,
+		}
+
+		if info.OriginalSize > 0 {
+			entry.KeptPercent = int((info.OriginalSize - info.DroppedSize) * 100 / info.OriginalSize)
+		}
+
+		d.DirSizes = append(d.DirSizes, entry)
+	}
+}
+
+func (d *htmlReportData) setArtifacts(info *artifactInfo) {
+	if info.ArtifactLocation == "" {
+		return
+	}
+
+	d.ArtifactLocation = info.ArtifactLocation
+	d.AppArmorProfileName = info.AppArmorProfileName
+
+	for _, artifact := range []htmlArtifact{
+		{"Container report", info.ContainerReportName},
+		{"Seccomp profile", info.SeccompProfileName},
+		{"Annotated seccomp profile", info.SeccompAnnotatedName},
+		{"AppArmor profile", info.AppArmorProfileName},
+		{"OCI runtime spec", info.OCISpecName},
+		{"Kubernetes securityContext", info.K8sSecurityContextName},
+		{"docker run script", info.DockerRunScriptName},
+		{"Compose file fragment", info.ComposeSnippetName},
+		{"Security findings (SARIF)", info.FindingsReportName},
+		{"Removed files listing", info.RemovedFilesName},
+	} {
+		if artifact.Name != "" {
+			d.Artifacts = append(d.Artifacts, artifact)
+		}
+	}
+
+	if info.SeccompProfileName != "" {
+		d.Seccomp = loadSeccompSummary(filepath.Join(info.ArtifactLocation, info.SeccompProfileName))
+		if d.Seccomp != nil {
+			d.Seccomp.Name = info.SeccompProfileName
+		}
+	}
+
+	if info.AppArmorProfileName != "" {
+		if profileData, err := ioutil.ReadFile(filepath.Join(info.ArtifactLocation, info.AppArmorProfileName)); err == nil {
+			d.AppArmorProfile = string(profileData)
+		}
+	}
+
+	if info.ContainerReportName != "" {
+		d.setKeptFiles(filepath.Join(info.ArtifactLocation, info.ContainerReportName))
+	}
+
+	if info.RemovedFilesName != "" {
+		d.setRemovedFiles(filepath.Join(info.ArtifactLocation, info.RemovedFilesName))
+	}
+}
+
+func loadSeccompSummary(profilePath string) *htmlSeccompSummary {
+	profileData, err := ioutil.ReadFile(profilePath)
+	if err != nil {
+		return nil
+	}
+
+	var profile specs.Seccomp
+	if err := json.Unmarshal(profileData, &profile); err != nil {
+		return nil
+	}
+
+	summary := &htmlSeccompSummary{}
+	for _, rule := range profile.Syscalls {
+		if rule == nil {
+			continue
+		}
+
+		group := htmlSyscallGroup{
+			Comment: rule.Comment,
+			Names:   rule.Names,
+		}
+
+		if rule.Name != "" {
+			group.Names = append([]string{rule.Name}, group.Names...)
+		}
+
+		summary.SyscallCount += len(group.Names)
+		summary.Groups = append(summary.Groups, group)
+	}
+
+	return summary
+}
+
+func (d *htmlReportData) setKeptFiles(reportPath string) {
+	reportData, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		return
+	}
+
+	var creport ContainerReport
+	if err := json.Unmarshal(reportData, &creport); err != nil {
+		return
+	}
+
+	root := &htmlFileNode{children: map[string]*htmlFileNode{}}
+	dirSizes := map[string]*htmlSizeEntry{}
+	var totalSize int64
+
+	for _, aprops := range creport.Image.Files {
+		if aprops == nil || aprops.FileType == DirArtifactType {
+			continue
+		}
+
+		d.KeptFileCount++
+		totalSize += aprops.FileSize
+		var reasons []string
+		for _, reason := range aprops.Reasons {
+			reasons = append(reasons, reason.String())
+		}
+
+		root.add(strings.Split(strings.Trim(aprops.FilePath, "/"), "/"), aprops.FileSize, strings.Join(reasons, "; "))
+
+		topDir := TopLevelDir(aprops.FilePath)
+		entry, ok := dirSizes[topDir]
+		if !ok {
+			entry = &htmlSizeEntry{Path: topDir}
+			dirSizes[topDir] = entry
+		}
+
+		entry.FileCount++
+		entry.bytes += aprops.FileSize
+	}
+
+	if d.KeptFileCount == 0 {
+		return
+	}
+
+	d.KeptFileSize = humanize.Bytes(uint64(totalSize))
+	for _, entry := range dirSizes {
+		entry.Size = humanize.Bytes(uint64(entry.bytes))
+		if totalSize > 0 {
+			entry.Percent = int(entry.bytes * 100 / totalSize)
+		}
+
+		d.SizeBreakdown = append(d.SizeBreakdown, *entry)
+	}
+
+	sort.Slice(d.SizeBreakdown, func(i, j int) bool {
+		return d.SizeBreakdown[i].bytes > d.SizeBreakdown[j].bytes
+	})
+
+	root.finish()
+	d.KeptFiles = root
+}
+
+// setRemovedFiles loads the removed files listing (tab-separated path, size and layer info with a header line)
+func (d *htmlReportData) setRemovedFiles(listingPath string) {
+	file, err := os.Open(listingPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(listingPath, ".gz") {
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			return
+		}
+		defer gzr.Close()
+
+		reader = gzr
+	}
+
+	root := &htmlFileNode{children: map[string]*htmlFileNode{}}
+	var totalSize int64
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Scan() //header
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 {
+			continue
+		}
+
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		var layer string
+		if len(fields) > 3 {
+			layer = fmt.Sprintf("layer %s (%s)", fields[2], fields[3])
+		}
+
+		d.RemovedFileCount++
+		totalSize += size
+		root.add(strings.Split(strings.Trim(fields[0], "/"), "/"), size, layer)
+	}
+
+	if d.RemovedFileCount == 0 {
+		return
+	}
+
+	d.RemovedFileSize = humanize.Bytes(uint64(totalSize))
+	root.finish()
+	d.RemovedFiles = root
+}
+
+// add adds a file to the tree (the note is shown next to the file)
+func (n *htmlFileNode) add(pathParts []string, size int64, note string) {
+	n.bytes += size
+	if len(pathParts) == 0 {
+		n.Note = note
+		return
+	}
+
+	child, ok := n.children[pathParts[0]]
+	if !ok {
+		child = &htmlFileNode{
+			Name:     pathParts[0],
+			children: map[string]*htmlFileNode{},
+		}
+		n.children[pathParts[0]] = child
+	}
+
+	child.add(pathParts[1:], size, note)
+}
+
+func (n *htmlFileNode) finish() {
+	n.Size = humanize.Bytes(uint64(n.bytes))
+	for _, child := range n.children {
+		child.finish()
+		n.Children = append(n.Children, child)
+	}
+
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+}
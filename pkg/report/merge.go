@@ -0,0 +1,268 @@
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// MergeFanMonitorReports combines the file activity from two file monitoring reports
+func MergeFanMonitorReports(dst, src *FanMonitorReport) *FanMonitorReport {
+	if dst == nil {
+		return src
+	}
+
+	if src == nil {
+		return dst
+	}
+
+	dst.EventCount += src.EventCount
+	dst.OverflowCount += src.OverflowCount
+
+	if dst.MainProcess == nil {
+		dst.MainProcess = src.MainProcess
+	}
+
+	if dst.Processes == nil {
+		dst.Processes = map[string]*ProcessInfo{}
+	}
+
+	for pid, pinfo := range src.Processes {
+		if _, ok := dst.Processes[pid]; !ok {
+			dst.Processes[pid] = pinfo
+		}
+	}
+
+	if dst.ProcessFiles == nil {
+		dst.ProcessFiles = map[string]map[string]*FileInfo{}
+	}
+
+	for pid, srcFiles := range src.ProcessFiles {
+		dstFiles, ok := dst.ProcessFiles[pid]
+		if !ok {
+			dst.ProcessFiles[pid] = srcFiles
+			continue
+		}
+
+		for fname, srcInfo := range srcFiles {
+			dstInfo, ok := dstFiles[fname]
+			if !ok {
+				dstFiles[fname] = srcInfo
+				continue
+			}
+
+			dstInfo.EventCount += srcInfo.EventCount
+			dstInfo.ReadCount += srcInfo.ReadCount
+			dstInfo.WriteCount += srcInfo.WriteCount
+			dstInfo.ExeCount += srcInfo.ExeCount
+		}
+	}
+
+	dst.Execs = append(dst.Execs, src.Execs...)
+
+	return dst
+}
+
+// MergePtMonitorReports combines the system call activity from two process monitoring reports
+func MergePtMonitorReports(dst, src *PtMonitorReport) *PtMonitorReport {
+	if dst == nil {
+		return src
+	}
+
+	if src == nil {
+		return dst
+	}
+
+	if dst.ArchName == "" {
+		dst.ArchName = src.ArchName
+	}
+
+	dst.SyscallCount += src.SyscallCount
+	dst.SampledOutCount += src.SampledOutCount
+
+	if dst.SyscallStats == nil {
+		dst.SyscallStats = map[string]SyscallStatInfo{}
+	}
+
+	for key, srcInfo := range src.SyscallStats {
+		if dstInfo, ok := dst.SyscallStats[key]; ok {
+			dstInfo.Count += srcInfo.Count
+			dst.SyscallStats[key] = dstInfo
+		} else {
+			dst.SyscallStats[key] = srcInfo
+		}
+	}
+
+	dst.SyscallNum = uint32(len(dst.SyscallStats))
+
+	if src.SocketStats != nil {
+		if dst.SocketStats == nil {
+			dst.SocketStats = map[string]SocketStatInfo{}
+		}
+
+		for key, srcInfo := range src.SocketStats {
+			if dstInfo, ok := dst.SocketStats[key]; ok {
+				dstInfo.Count += srcInfo.Count
+				dst.SocketStats[key] = dstInfo
+			} else {
+				dst.SocketStats[key] = srcInfo
+			}
+		}
+	}
+
+	if src.CapabilityStats != nil {
+		if dst.CapabilityStats == nil {
+			dst.CapabilityStats = map[string]CapabilityStatInfo{}
+		}
+
+		for key, srcInfo := range src.CapabilityStats {
+			if dstInfo, ok := dst.CapabilityStats[key]; ok {
+				dstInfo.Count += srcInfo.Count
+				dst.CapabilityStats[key] = dstInfo
+			} else {
+				dst.CapabilityStats[key] = srcInfo
+			}
+		}
+	}
+
+	if src.FSActivity != nil {
+		if dst.FSActivity == nil {
+			dst.FSActivity = map[string]*FSActivityInfo{}
+		}
+
+		for fname, srcInfo := range src.FSActivity {
+			if dstInfo, ok := dst.FSActivity[fname]; ok {
+				dstInfo.OpsAll += srcInfo.OpsAll
+				dstInfo.OpsCheckFile += srcInfo.OpsCheckFile
+				dstInfo.OpsExec += srcInfo.OpsExec
+			} else {
+				dst.FSActivity[fname] = srcInfo
+			}
+		}
+	}
+
+	return dst
+}
+
+// MergeNetMonitorReports combines the listening ports from two network monitoring reports
+func MergeNetMonitorReports(dst, src *NetMonitorReport) *NetMonitorReport {
+	if dst == nil {
+		return src
+	}
+
+	if src == nil {
+		return dst
+	}
+
+	known := map[ListeningPort]bool{}
+	for _, port := range dst.ListeningPorts {
+		known[port] = true
+	}
+
+	for _, port := range src.ListeningPorts {
+		if !known[port] {
+			known[port] = true
+			dst.ListeningPorts = append(dst.ListeningPorts, port)
+		}
+	}
+
+	return dst
+}
+
+// MergeContainerReports combines the container reports from multiple monitoring runs
+// (the merged report includes the files, processes, system calls and sockets from all runs)
+func MergeContainerReports(dst, src *ContainerReport) *ContainerReport {
+	if dst == nil {
+		return src
+	}
+
+	if src == nil {
+		return dst
+	}
+
+	dst.SchemaVersion = SchemaVersion
+	if dst.Image.Distro == nil {
+		dst.Image.Distro = src.Image.Distro
+	}
+
+	warnings := map[string]bool{}
+	for _, warning := range dst.Image.LibcWarnings {
+		warnings[warning] = true
+	}
+
+	for _, warning := range src.Image.LibcWarnings {
+		if !warnings[warning] {
+			warnings[warning] = true
+			dst.Image.LibcWarnings = append(dst.Image.LibcWarnings, warning)
+		}
+	}
+
+	files := map[string]*ArtifactProps{}
+	for _, file := range dst.Image.Files {
+		if file != nil {
+			files[file.FilePath] = file
+		}
+	}
+
+	for _, srcFile := range src.Image.Files {
+		if srcFile == nil {
+			continue
+		}
+
+		dstFile, ok := files[srcFile.FilePath]
+		if !ok {
+			files[srcFile.FilePath] = srcFile
+			dst.Image.Files = append(dst.Image.Files, srcFile)
+			continue
+		}
+
+		for flag, value := range srcFile.Flags {
+			if value {
+				if dstFile.Flags == nil {
+					dstFile.Flags = map[string]bool{}
+				}
+				dstFile.Flags[flag] = true
+			}
+		}
+
+		for _, reason := range srcFile.Reasons {
+			dstFile.AddReason(reason.Type, reason.Detail)
+		}
+
+		if dstFile.Package == "" {
+			dstFile.Package = srcFile.Package
+		}
+	}
+
+	dst.Monitors.Fan = MergeFanMonitorReports(dst.Monitors.Fan, src.Monitors.Fan)
+	dst.Monitors.Pt = MergePtMonitorReports(dst.Monitors.Pt, src.Monitors.Pt)
+	dst.Monitors.Net = MergeNetMonitorReports(dst.Monitors.Net, src.Monitors.Net)
+
+	return dst
+}
+
+// LoadContainerReport loads a saved container report
+func LoadContainerReport(location string) (*ContainerReport, error) {
+	reportFile, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer reportFile.Close()
+
+	var creport ContainerReport
+	if err = json.NewDecoder(reportFile).Decode(&creport); err != nil {
+		return nil, err
+	}
+
+	return &creport, nil
+}
+
+// SaveContainerReport saves the container report
+func SaveContainerReport(location string, creport *ContainerReport) error {
+	reportData, err := json.MarshalIndent(creport, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(location, reportData, 0644)
+}
@@ -0,0 +1,287 @@
+package report
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergePtMonitorReports(t *testing.T) {
+	tests := []struct {
+		name     string
+		dst      *PtMonitorReport
+		src      *PtMonitorReport
+		expected *PtMonitorReport
+	}{
+		{
+			name:     "no reports",
+			expected: nil,
+		},
+		{
+			name:     "no dst",
+			src:      &PtMonitorReport{ArchName: "amd64", SyscallCount: 1},
+			expected: &PtMonitorReport{ArchName: "amd64", SyscallCount: 1},
+		},
+		{
+			name:     "no src",
+			dst:      &PtMonitorReport{ArchName: "amd64", SyscallCount: 1},
+			expected: &PtMonitorReport{ArchName: "amd64", SyscallCount: 1},
+		},
+		{
+			name: "system calls",
+			dst: &PtMonitorReport{
+				SyscallCount: 5,
+				SyscallStats: map[string]SyscallStatInfo{
+					"0": {Number: 0, Name: "read", Count: 3},
+					"1": {Number: 1, Name: "write", Count: 2},
+				},
+			},
+			src: &PtMonitorReport{
+				ArchName:        "amd64",
+				SyscallCount:    6,
+				SampledOutCount: 2,
+				SyscallStats: map[string]SyscallStatInfo{
+					"1":     {Number: 1, Name: "write", Count: 4},
+					"2":     {Number: 2, Name: "open", Count: 2},
+					"386:5": {Number: 5, Name: "open", Arch: "386", Count: 1},
+				},
+			},
+			expected: &PtMonitorReport{
+				ArchName:        "amd64",
+				SyscallCount:    11,
+				SampledOutCount: 2,
+				SyscallNum:      4,
+				SyscallStats: map[string]SyscallStatInfo{
+					"0":     {Number: 0, Name: "read", Count: 3},
+					"1":     {Number: 1, Name: "write", Count: 6},
+					"2":     {Number: 2, Name: "open", Count: 2},
+					"386:5": {Number: 5, Name: "open", Arch: "386", Count: 1},
+				},
+			},
+		},
+		{
+			name: "sockets, capabilities and file system activity",
+			dst: &PtMonitorReport{
+				ArchName:     "arm64",
+				SyscallStats: map[string]SyscallStatInfo{},
+				CapabilityStats: map[string]CapabilityStatInfo{
+					"KILL:kill": {Capability: "KILL", Syscall: "kill", Count: 1},
+				},
+				FSActivity: map[string]*FSActivityInfo{
+					"/etc/hosts": {OpsAll: 1, OpsCheckFile: 1},
+				},
+			},
+			src: &PtMonitorReport{
+				ArchName: "amd64",
+				SocketStats: map[string]SocketStatInfo{
+					"2:1": {Family: 2, FamilyName: "AF_INET", Type: 1, TypeName: "SOCK_STREAM", Count: 2},
+				},
+				CapabilityStats: map[string]CapabilityStatInfo{
+					"KILL:kill":           {Capability: "KILL", Syscall: "kill", Count: 2},
+					"DAC_OVERRIDE:openat": {Capability: "DAC_OVERRIDE", Syscall: "openat", Count: 1},
+				},
+				FSActivity: map[string]*FSActivityInfo{
+					"/etc/hosts":   {OpsAll: 2},
+					"/usr/bin/app": {OpsAll: 1, OpsExec: 1},
+				},
+			},
+			expected: &PtMonitorReport{
+				ArchName:     "arm64",
+				SyscallStats: map[string]SyscallStatInfo{},
+				SocketStats: map[string]SocketStatInfo{
+					"2:1": {Family: 2, FamilyName: "AF_INET", Type: 1, TypeName: "SOCK_STREAM", Count: 2},
+				},
+				CapabilityStats: map[string]CapabilityStatInfo{
+					"KILL:kill":           {Capability: "KILL", Syscall: "kill", Count: 3},
+					"DAC_OVERRIDE:openat": {Capability: "DAC_OVERRIDE", Syscall: "openat", Count: 1},
+				},
+				FSActivity: map[string]*FSActivityInfo{
+					"/etc/hosts":   {OpsAll: 3, OpsCheckFile: 1},
+					"/usr/bin/app": {OpsAll: 1, OpsExec: 1},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := MergePtMonitorReports(test.dst, test.src)
+			if !reflect.DeepEqual(merged, test.expected) {
+				t.Fatalf("unexpected merged report:\n%+v\nexpected:\n%+v", merged, test.expected)
+			}
+		})
+	}
+}
+
+func TestMergeFanMonitorReports(t *testing.T) {
+	main := &ProcessInfo{Pid: 1, Name: "app"}
+	worker := &ProcessInfo{Pid: 2, Name: "worker"}
+
+	dst := &FanMonitorReport{
+		EventCount:  3,
+		MainProcess: main,
+		Processes:   map[string]*ProcessInfo{"1": main},
+		ProcessFiles: map[string]map[string]*FileInfo{
+			"1": {"/etc/app.conf": {EventCount: 2, ReadCount: 2}},
+		},
+	}
+
+	src := &FanMonitorReport{
+		EventCount:    4,
+		OverflowCount: 1,
+		MainProcess:   worker,
+		Processes:     map[string]*ProcessInfo{"1": main, "2": worker},
+		ProcessFiles: map[string]map[string]*FileInfo{
+			"1": {
+				"/etc/app.conf": {EventCount: 1, WriteCount: 1},
+				"/usr/bin/app":  {EventCount: 1, ExeCount: 1},
+			},
+			"2": {"/tmp/data": {EventCount: 1, WriteCount: 1}},
+		},
+		Execs: []*ExecInfo{{Pid: 2}},
+	}
+
+	expected := &FanMonitorReport{
+		EventCount:    7,
+		OverflowCount: 1,
+		MainProcess:   main,
+		Processes:     map[string]*ProcessInfo{"1": main, "2": worker},
+		ProcessFiles: map[string]map[string]*FileInfo{
+			"1": {
+				"/etc/app.conf": {EventCount: 3, ReadCount: 2, WriteCount: 1},
+				"/usr/bin/app":  {EventCount: 1, ExeCount: 1},
+			},
+			"2": {"/tmp/data": {EventCount: 1, WriteCount: 1}},
+		},
+		Execs: []*ExecInfo{{Pid: 2}},
+	}
+
+	merged := MergeFanMonitorReports(dst, src)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("unexpected merged report:\n%+v\nexpected:\n%+v", merged, expected)
+	}
+}
+
+func TestMergeNetMonitorReports(t *testing.T) {
+	http := ListeningPort{Port: 80, Protocol: "tcp", Address: "0.0.0.0"}
+	dns := ListeningPort{Port: 53, Protocol: "udp", Address: "0.0.0.0"}
+	https := ListeningPort{Port: 443, Protocol: "tcp", Address: "0.0.0.0"}
+
+	merged := MergeNetMonitorReports(
+		&NetMonitorReport{ListeningPorts: []ListeningPort{http, dns}},
+		&NetMonitorReport{ListeningPorts: []ListeningPort{dns, https}})
+
+	expected := []ListeningPort{http, dns, https}
+	if !reflect.DeepEqual(merged.ListeningPorts, expected) {
+		t.Fatalf("unexpected ports: %v (expected %v)", merged.ListeningPorts, expected)
+	}
+}
+
+func TestMergeContainerReports(t *testing.T) {
+	dst := &ContainerReport{
+		SchemaVersion: "1",
+		Image: ImageReport{
+			LibcWarnings: []string{"musl binary"},
+			Files: []*ArtifactProps{
+				{
+					FilePath: "/usr/bin/app",
+					Flags:    map[string]bool{"R": true},
+					Reasons:  []KeepReason{{Type: KeepReasonObserved}},
+				},
+				{FilePath: "/etc/app.conf"},
+			},
+		},
+		Monitors: MonitorReports{
+			Pt: &PtMonitorReport{SyscallStats: map[string]SyscallStatInfo{"0": {Name: "read", Count: 1}}},
+		},
+	}
+
+	src := &ContainerReport{
+		Image: ImageReport{
+			LibcWarnings: []string{"musl binary", "missing library"},
+			Files: []*ArtifactProps{
+				{
+					FilePath: "/usr/bin/app",
+					Flags:    map[string]bool{"X": true, "W": false},
+					Reasons:  []KeepReason{{Type: KeepReasonObserved}, {Type: KeepReasonInclude, Detail: "/usr/bin"}},
+					Package:  "app",
+				},
+				{FilePath: "/lib/libc.so.6"},
+				nil,
+			},
+		},
+		Monitors: MonitorReports{
+			Fan: &FanMonitorReport{EventCount: 2},
+			Pt:  &PtMonitorReport{SyscallStats: map[string]SyscallStatInfo{"0": {Name: "read", Count: 2}}},
+			Net: &NetMonitorReport{ListeningPorts: []ListeningPort{{Port: 80, Protocol: "tcp"}}},
+		},
+	}
+
+	expected := &ContainerReport{
+		SchemaVersion: SchemaVersion,
+		Image: ImageReport{
+			LibcWarnings: []string{"musl binary", "missing library"},
+			Files: []*ArtifactProps{
+				{
+					FilePath: "/usr/bin/app",
+					Flags:    map[string]bool{"R": true, "X": true},
+					Reasons:  []KeepReason{{Type: KeepReasonObserved}, {Type: KeepReasonInclude, Detail: "/usr/bin"}},
+					Package:  "app",
+				},
+				{FilePath: "/etc/app.conf"},
+				{FilePath: "/lib/libc.so.6"},
+			},
+		},
+		Monitors: MonitorReports{
+			Fan: &FanMonitorReport{EventCount: 2},
+			Pt: &PtMonitorReport{
+				SyscallNum:   1,
+				SyscallStats: map[string]SyscallStatInfo{"0": {Name: "read", Count: 3}},
+			},
+			Net: &NetMonitorReport{ListeningPorts: []ListeningPort{{Port: 80, Protocol: "tcp"}}},
+		},
+	}
+
+	merged := MergeContainerReports(dst, src)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("unexpected merged report:\n%+v\nexpected:\n%+v", merged, expected)
+	}
+}
+
+func TestContainerReportSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dslim-report-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	creport := &ContainerReport{
+		SchemaVersion: SchemaVersion,
+		Image:         ImageReport{Files: []*ArtifactProps{{FilePath: "/usr/bin/app", ModeText: "-rwxr-xr-x"}}},
+		Monitors: MonitorReports{
+			Pt: &PtMonitorReport{ArchName: "amd64", SyscallNum: 1, SyscallStats: map[string]SyscallStatInfo{"0": {Name: "read", Count: 1}}},
+		},
+	}
+
+	location := filepath.Join(dir, DefaultContainerReportFileName)
+	if err := SaveContainerReport(location, creport); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadContainerReport(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.SchemaVersion != SchemaVersion ||
+		len(loaded.Image.Files) != 1 || loaded.Image.Files[0].FilePath != "/usr/bin/app" ||
+		loaded.Monitors.Pt == nil || loaded.Monitors.Pt.SyscallStats["0"].Count != 1 {
+		t.Fatalf("unexpected loaded report: %+v", loaded)
+	}
+
+	if _, err := LoadContainerReport(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("expected an error for a missing report")
+	}
+}
@@ -0,0 +1,181 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaVersion is the version of the report data format
+// (increment the major version for incompatible changes)
+const SchemaVersion = "1.0"
+
+const (
+	schemaDraft  = "http://json-schema.org/draft-07/schema#"
+	schemaIDBase = "https://docker-slim.com/schemas/%s/%s.json"
+)
+
+// Report schema names
+const (
+	SchemaBuildCommand    = "build"
+	SchemaProfileCommand  = "profile"
+	SchemaInfoCommand     = "info"
+	SchemaBatchCommand    = "batch"
+	SchemaContainerReport = "container"
+)
+
+const schemaArtifactFileType = "file_type"
+
+var schemaTypes = map[string]reflect.Type{
+	SchemaBuildCommand:    reflect.TypeOf(BuildCommand{}),
+	SchemaProfileCommand:  reflect.TypeOf(ProfileCommand{}),
+	SchemaInfoCommand:     reflect.TypeOf(InfoCommand{}),
+	SchemaBatchCommand:    reflect.TypeOf(BatchCommand{}),
+	SchemaContainerReport: reflect.TypeOf(ContainerReport{}),
+}
+
+var schemaDescriptions = map[string]string{
+	SchemaBuildCommand:    "docker-slim 'build' command report",
+	SchemaProfileCommand:  "docker-slim 'profile' command report",
+	SchemaInfoCommand:     "docker-slim 'info' command report",
+	SchemaBatchCommand:    "docker-slim 'batch' command summary report",
+	SchemaContainerReport: "docker-slim container report (creport.json)",
+}
+
+// SchemaNames returns the names of the available report schemas
+func SchemaNames() []string {
+	var names []string
+	for name := range schemaTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Schema returns the JSON Schema for the named report
+func Schema(name string) ([]byte, error) {
+	reportType, ok := schemaTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown report schema - %v (available: %v)", name, strings.Join(SchemaNames(), ", "))
+	}
+
+	schema := typeSchema(reportType)
+	schema["$schema"] = schemaDraft
+	schema["$id"] = fmt.Sprintf(schemaIDBase, SchemaVersion, name)
+	schema["title"] = schemaDescriptions[name]
+
+	if props, ok := schema["properties"].(map[string]interface{}); ok {
+		if versionSchema, ok := props["schema_version"].(map[string]interface{}); ok {
+			versionSchema["const"] = SchemaVersion
+		}
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+var artifactPropsType = reflect.TypeOf(ArtifactProps{})
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(typeSchema(t.Elem()))
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return nullable(map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		})
+	case reflect.Map:
+		//JSON object keys are always strings (including the maps with integer keys)
+		return nullable(map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		})
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		var required []string
+		addStructFields(t, properties, &required)
+
+		//artifact properties have a custom JSON encoder
+		if t == artifactPropsType {
+			properties[schemaArtifactFileType] = map[string]interface{}{
+				"type": "string",
+				"enum": []string{"Dir", "File", "Symlink", "Unknown"},
+			}
+			required = append(required, schemaArtifactFileType)
+		}
+
+		sort.Strings(required)
+		schema := map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		}
+
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// nullable allows the null value (nil pointers, slices and maps are encoded as null)
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if typeName, ok := schema["type"].(string); ok {
+		schema["type"] = []string{typeName, "null"}
+	}
+
+	return schema
+}
+
+func addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, properties, required)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			//not exported
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := field.Name
+		tagParts := strings.Split(tag, ",")
+		if tagParts[0] != "" {
+			name = tagParts[0]
+		}
+
+		omitEmpty := false
+		for _, option := range tagParts[1:] {
+			if option == "omitempty" {
+				omitEmpty = true
+			}
+		}
+
+		properties[name] = typeSchema(field.Type)
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package report
+
+import (
+	"sort"
+	"strings"
+)
+
+// DirSizeInfo contains the original, kept and dropped file sizes for a top-level directory
+type DirSizeInfo struct {
+	Dir               string `json:"dir"`
+	OriginalSize      int64  `json:"original_size"`
+	OriginalFileCount int    `json:"original_file_count"`
+	KeptSize          int64  `json:"kept_size"`
+	KeptFileCount     int    `json:"kept_file_count"`
+	DroppedSize       int64  `json:"dropped_size"`
+	DroppedFileCount  int    `json:"dropped_file_count"`
+}
+
+// TopLevelDir returns the top-level directory for the file path ('/' for the files in the root directory)
+func TopLevelDir(filePath string) string {
+	if parts := strings.SplitN(strings.TrimPrefix(filePath, "/"), "/", 2); len(parts) > 1 {
+		return "/" + parts[0]
+	}
+
+	return "/"
+}
+
+// DirSizes creates the per-top-level-directory size breakdown for the original image files
+// (file sizes keyed by the file path) and the files kept in the minified image
+// (the directories are sorted by the dropped size)
+func DirSizes(originalFiles map[string]int64, keptFiles []*ArtifactProps) []DirSizeInfo {
+	dirs := map[string]*DirSizeInfo{}
+	getDir := func(filePath string) *DirSizeInfo {
+		dirName := TopLevelDir(filePath)
+		info, ok := dirs[dirName]
+		if !ok {
+			info = &DirSizeInfo{Dir: dirName}
+			dirs[dirName] = info
+		}
+
+		return info
+	}
+
+	kept := map[string]bool{}
+	for _, aprops := range keptFiles {
+		if aprops == nil || aprops.FileType == DirArtifactType {
+			continue
+		}
+
+		kept[aprops.FilePath] = true
+
+		info := getDir(aprops.FilePath)
+		info.KeptFileCount++
+		info.KeptSize += aprops.FileSize
+	}
+
+	for filePath, size := range originalFiles {
+		info := getDir(filePath)
+		info.OriginalFileCount++
+		info.OriginalSize += size
+
+		if !kept[filePath] {
+			info.DroppedFileCount++
+			info.DroppedSize += size
+		}
+	}
+
+	var result []DirSizeInfo
+	for _, info := range dirs {
+		result = append(result, *info)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DroppedSize != result[j].DroppedSize {
+			return result[i].DroppedSize > result[j].DroppedSize
+		}
+
+		return result[i].Dir < result[j].Dir
+	})
+
+	return result
+}
+
+// ReductionPercent returns the image size reduction percentage
+func ReductionPercent(originalSize, minifiedSize int64) float64 {
+	if originalSize <= 0 || minifiedSize <= 0 {
+		return 0
+	}
+
+	return float64(originalSize-minifiedSize) * 100 / float64(originalSize)
+}
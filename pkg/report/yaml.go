@@ -0,0 +1,219 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultContainerReportYAMLFileName is the container report file name in the YAML format
+const DefaultContainerReportYAMLFileName = "creport.yaml"
+
+type yamlNodeKind int
+
+const (
+	yamlScalar yamlNodeKind = iota
+	yamlMapping
+	yamlSequence
+)
+
+type yamlNode struct {
+	kind     yamlNodeKind
+	value    string
+	keys     []string
+	children []*yamlNode
+}
+
+var yamlPlainString = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./@+-]*$`)
+
+// strings that YAML parsers interpret as other types
+var yamlReservedWords = map[string]struct{}{
+	"true": {}, "false": {}, "yes": {}, "no": {}, "on": {}, "off": {},
+	"y": {}, "n": {}, "null": {}, "~": {},
+}
+
+// jsonToYAML converts JSON encoded data to YAML
+// (the keys stay in the same order they have in the JSON data,
+// so the YAML reports have the same stable key order the JSON reports have)
+func jsonToYAML(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	root, err := decodeYAMLNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	switch {
+	case root.kind == yamlScalar || len(root.children) == 0:
+		out.WriteString(yamlInline(root))
+		out.WriteString("\n")
+	case root.kind == yamlMapping:
+		writeYAMLMapping(&out, root, 0)
+	default:
+		writeYAMLSequence(&out, root, 0)
+	}
+
+	return out.Bytes(), nil
+}
+
+func decodeYAMLNode(decoder *json.Decoder) (*yamlNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			node := &yamlNode{kind: yamlMapping}
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				key, ok := keyToken.(string)
+				if !ok {
+					return nil, fmt.Errorf("unexpected object key - %v", keyToken)
+				}
+
+				child, err := decodeYAMLNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+
+				node.keys = append(node.keys, key)
+				node.children = append(node.children, child)
+			}
+
+			//the closing delimiter
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+
+			return node, nil
+		case '[':
+			node := &yamlNode{kind: yamlSequence}
+			for decoder.More() {
+				child, err := decodeYAMLNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+
+				node.children = append(node.children, child)
+			}
+
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+
+			return node, nil
+		default:
+			return nil, fmt.Errorf("unexpected delimiter - %v", value)
+		}
+	case nil:
+		return &yamlNode{kind: yamlScalar, value: "null"}, nil
+	case bool:
+		return &yamlNode{kind: yamlScalar, value: strconv.FormatBool(value)}, nil
+	case json.Number:
+		return &yamlNode{kind: yamlScalar, value: value.String()}, nil
+	case string:
+		return &yamlNode{kind: yamlScalar, value: yamlString(value)}, nil
+	default:
+		return nil, fmt.Errorf("unexpected token - %v", token)
+	}
+}
+
+func yamlString(value string) string {
+	if yamlPlainString.MatchString(value) {
+		if _, reserved := yamlReservedWords[strings.ToLower(value)]; !reserved {
+			return value
+		}
+	}
+
+	//the Go escape sequences are valid in the double-quoted YAML strings
+	return strconv.Quote(value)
+}
+
+// yamlInline returns the inline representation for the scalars and the empty collections
+func yamlInline(node *yamlNode) string {
+	switch node.kind {
+	case yamlMapping:
+		return "{}"
+	case yamlSequence:
+		return "[]"
+	default:
+		return node.value
+	}
+}
+
+func isYAMLBlock(node *yamlNode) bool {
+	return node.kind != yamlScalar && len(node.children) > 0
+}
+
+func writeYAMLMapping(out io.Writer, node *yamlNode, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	for idx, key := range node.keys {
+		child := node.children[idx]
+		if !isYAMLBlock(child) {
+			fmt.Fprintf(out, "%s%s: %s\n", prefix, yamlString(key), yamlInline(child))
+			continue
+		}
+
+		fmt.Fprintf(out, "%s%s:\n", prefix, yamlString(key))
+		if child.kind == yamlMapping {
+			writeYAMLMapping(out, child, indent+2)
+		} else {
+			writeYAMLSequence(out, child, indent+2)
+		}
+	}
+}
+
+func writeYAMLSequence(out io.Writer, node *yamlNode, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	for _, child := range node.children {
+		if !isYAMLBlock(child) {
+			fmt.Fprintf(out, "%s- %s\n", prefix, yamlInline(child))
+			continue
+		}
+
+		//the first line of the nested block goes on the same line with the item marker
+		var block bytes.Buffer
+		if child.kind == yamlMapping {
+			writeYAMLMapping(&block, child, indent+2)
+		} else {
+			writeYAMLSequence(&block, child, indent+2)
+		}
+
+		fmt.Fprintf(out, "%s- %s", prefix, strings.TrimPrefix(block.String(), prefix+"  "))
+	}
+}
+
+// SaveContainerReportYAML saves a YAML copy of the container report in the artifact location
+func SaveContainerReportYAML(artifactLocation string) error {
+	creport, err := LoadContainerReport(filepath.Join(artifactLocation, DefaultContainerReportFileName))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(creport)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := jsonToYAML(data)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(artifactLocation, DefaultContainerReportYAMLFileName), yamlData, 0644)
+}
@@ -0,0 +1,61 @@
+package specs
+
+// Spec is the base configuration for the container (a subset of the OCI runtime spec)
+type Spec struct {
+	Version string   `json:"ociVersion"`
+	Process *Process `json:"process,omitempty"`
+	Root    *Root    `json:"root,omitempty"`
+	Mounts  []Mount  `json:"mounts,omitempty"`
+	Linux   *Linux   `json:"linux,omitempty"`
+}
+
+// Process contains information to start a specific application inside the container
+type Process struct {
+	NoNewPrivileges bool               `json:"noNewPrivileges,omitempty"`
+	Capabilities    *LinuxCapabilities `json:"capabilities,omitempty"`
+	ApparmorProfile string             `json:"apparmorProfile,omitempty"`
+}
+
+// LinuxCapabilities specifies the whitelist of capabilities that are kept for a process
+type LinuxCapabilities struct {
+	Bounding    []string `json:"bounding,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Inheritable []string `json:"inheritable,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+// Root contains information about the container's root filesystem on the host
+type Root struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+}
+
+// Mount specifies a mount for a container
+type Mount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// Linux contains platform specific configuration for Linux based containers
+type Linux struct {
+	Seccomp       *LinuxSeccomp `json:"seccomp,omitempty"`
+	MaskedPaths   []string      `json:"maskedPaths,omitempty"`
+	ReadonlyPaths []string      `json:"readonlyPaths,omitempty"`
+}
+
+// LinuxSeccomp represents syscall restrictions (OCI runtime spec format)
+type LinuxSeccomp struct {
+	DefaultAction Action         `json:"defaultAction"`
+	Architectures []Arch         `json:"architectures,omitempty"`
+	Syscalls      []LinuxSyscall `json:"syscalls,omitempty"`
+}
+
+// LinuxSyscall is used to match a group of syscalls in Seccomp (OCI runtime spec format)
+type LinuxSyscall struct {
+	Names  []string `json:"names"`
+	Action Action   `json:"action"`
+	Args   []*Arg   `json:"args,omitempty"`
+}
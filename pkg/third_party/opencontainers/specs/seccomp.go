@@ -63,7 +63,9 @@ type Arg struct {
 
 // Syscall is used to match a syscall in Seccomp
 type Syscall struct {
-	Name   string `json:"name"`
-	Action Action `json:"action"`
-	Args   []*Arg `json:"args,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Names   []string `json:"names,omitempty"`
+	Action  Action   `json:"action"`
+	Args    []*Arg   `json:"args,omitempty"`
+	Comment string   `json:"comment,omitempty"`
 }
@@ -1,13 +1,67 @@
 package errutils
 
 import (
+	"os"
+	"os/signal"
 	"runtime/debug"
+	"sync"
+	"syscall"
 
 	"github.com/docker-slim/docker-slim/pkg/version"
 
 	log "github.com/Sirupsen/logrus"
 )
 
+// Exit codes (the exit codes are stable, so the CI jobs can branch on the failure type)
+const (
+	ExitCodeOk             = 0
+	ExitCodeError          = 1
+	ExitCodeImageNotFound  = 3
+	ExitCodeDockerConnect  = 4
+	ExitCodeMonitorTimeout = 5
+	ExitCodeProbeFailure   = 6
+	ExitCodeSensorError    = 7
+	ExitCodeVerifyFailure  = 8
+	ExitCodeNoData         = 9
+	ExitCodeTestFailure    = 10
+	ExitCodeSizeBudget     = 11
+	ExitCodePolicyFailure  = 12
+	ExitCodeHookFailure    = 13
+)
+
+// the exit code for the exit handlers (the failure functions exit with the generic error exit code)
+var exitCode = ExitCodeError
+
+// OnExit registers a handler that runs when the application is terminated by Exit or by one of the failure functions
+// (e.g., to encrypt the artifacts left by a failed run). The handler gets the exit code.
+func OnExit(handler func(code int)) {
+	log.RegisterExitHandler(func() {
+		handler(exitCode)
+	})
+}
+
+var trapSignalsOnce sync.Once
+
+// ExitOnSignals makes the termination signals (SIGINT and SIGTERM) go through Exit,
+// so the exit handlers run when the application is interrupted (e.g., with Ctrl-C) too
+func ExitOnSignals() {
+	trapSignalsOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			log.Debugf("docker-slim: exiting on signal (%v)", sig)
+			Exit(ExitCodeError)
+		}()
+	})
+}
+
+// Exit runs the exit handlers and terminates the application with the given exit code
+func Exit(code int) {
+	exitCode = code
+	log.Exit(code)
+}
+
 // FailOn logs the error information and terminates the application if there's an error
 func FailOn(err error) {
 	if err != nil {
@@ -45,3 +99,28 @@ func Fail(msg string) {
 		"stack":   string(stackData),
 	}).Fatal("docker-slim: failure")
 }
+
+// FailOnCode logs the error information and terminates the application with the given exit code if there's an error
+func FailOnCode(err error, code int) {
+	if err != nil {
+		stackData := debug.Stack()
+		log.WithError(err).WithFields(log.Fields{
+			"version":   version.Current(),
+			"exit.code": code,
+			"stack":     string(stackData),
+		}).Error("docker-slim: failure")
+		Exit(code)
+	}
+}
+
+// FailCode logs the given message and terminates the application with the given exit code
+func FailCode(msg string, code int) {
+	stackData := debug.Stack()
+	log.WithFields(log.Fields{
+		"version":   version.Current(),
+		"error":     msg,
+		"exit.code": code,
+		"stack":     string(stackData),
+	}).Error("docker-slim: failure")
+	Exit(code)
+}
@@ -0,0 +1,451 @@
+package fsutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/klauspost/compress/zstd"
+)
+
+// UnsafeArchiveError is returned when an archive entry would change something outside of the extracted directory
+type UnsafeArchiveError struct {
+	Name   string
+	Reason string
+}
+
+func (e *UnsafeArchiveError) Error() string {
+	return fmt.Sprintf("unsafe archive entry %v - %v", e.Name, e.Reason)
+}
+
+// ExtractArchive extracts a tar archive to a local directory.
+// The archive can't change anything outside of the directory: the archive is rejected
+// if it has a path or a link (hard or symbolic) that resolves outside of the directory
+// or an entry under a symlink, and the extracted files are never opened through symlinks.
+// Use it for the archives from untrusted sources.
+func ExtractArchive(archive io.Reader, dst string) error {
+	return extractArchive(archive, dst, "", false, nil)
+}
+
+// ExtractArtifactsArchive extracts a sensor artifacts archive to a local directory.
+// It works like ExtractArchive, but it keeps the symlinks to the paths outside of the directory
+// (the artifact files are the image files and their symlinks point to the image paths).
+// The kept symlinks are never followed when the archive is extracted.
+func ExtractArtifactsArchive(archive io.Reader, dst string) error {
+	return extractArchive(archive, dst, "", true, nil)
+}
+
+// ExtractImageArchive extracts an archive with the image files (e.g., from a container)
+// to the prefix directory in a local directory with the image files. It works like ExtractArtifactsArchive
+// (the symlinks already in the directory are never followed) and it calls the entry function (optional)
+// with the local path (relative to the directory) for each extracted entry.
+func ExtractImageArchive(archive io.Reader, dst, prefix string, onEntry func(name string, hdr *tar.Header)) error {
+	return extractArchive(archive, dst, prefix, true, onEntry)
+}
+
+func extractArchive(archive io.Reader,
+	dst string,
+	prefix string,
+	keepOutsideLinks bool,
+	onEntry func(name string, hdr *tar.Header)) error {
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name, err := archivePath(path.Join(prefix, hdr.Name))
+		if err != nil {
+			return err
+		}
+
+		if !isUnderPrefix(name, prefix) {
+			return unsafeEntry(hdr.Name, "path outside of the target directory")
+		}
+
+		if name == "." {
+			continue
+		}
+
+		//the existing symlinks are replaced only by the link entries
+		isLink := hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink
+		if err := checkArchivePath(dst, name, !isLink); err != nil {
+			return err
+		}
+
+		fullPath := filepath.Join(dst, name)
+		mode := hdr.FileInfo().Mode()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(fullPath, mode.Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0777); err != nil {
+				return err
+			}
+
+			//O_NOFOLLOW: an existing symlink is never used to write the file
+			file, err := os.OpenFile(fullPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, mode.Perm())
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if !keepOutsideLinks && !isInsideLink(name, hdr.Linkname) {
+				return unsafeEntry(hdr.Name, "symlink target outside of the directory - "+hdr.Linkname)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0777); err != nil {
+				return err
+			}
+
+			os.Remove(fullPath)
+			if err := os.Symlink(hdr.Linkname, fullPath); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			//the hard link targets are the archive paths (they are never absolute and they don't have '..')
+			linkName, err := archivePath(path.Join(prefix, hdr.Linkname))
+			if err != nil || linkName == "." || hasParentRef(hdr.Linkname) || !isUnderPrefix(linkName, prefix) {
+				return unsafeEntry(hdr.Name, "hard link target outside of the directory - "+hdr.Linkname)
+			}
+
+			if err := checkArchivePath(dst, linkName, true); err != nil {
+				return err
+			}
+
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0777); err != nil {
+				return err
+			}
+
+			os.Remove(fullPath)
+			if err := os.Link(filepath.Join(dst, linkName), fullPath); err != nil {
+				return err
+			}
+		default:
+			log.Debugf("fsutils.ExtractArchive: skipping %v (type %v)", hdr.Name, hdr.Typeflag)
+			continue
+		}
+
+		//the file owners are kept only if docker-slim runs as root
+		if os.Geteuid() == 0 {
+			os.Lchown(fullPath, hdr.Uid, hdr.Gid)
+		}
+
+		//keep the special mode bits (setuid, setgid, sticky) and the file times
+		//(after the owner is changed because chown clears the setuid and setgid bits)
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			if err := os.Chmod(fullPath, mode); err != nil {
+				return err
+			}
+
+			os.Chtimes(fullPath, hdr.ModTime, hdr.ModTime)
+		}
+
+		if onEntry != nil {
+			onEntry(name, hdr)
+		}
+	}
+}
+
+// archivePath returns the local path for the archive path
+// (the paths outside of the extracted directory are rejected)
+func archivePath(name string) (string, error) {
+	local := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(local) || local == ".." || strings.HasPrefix(local, ".."+string(filepath.Separator)) {
+		return "", unsafeEntry(name, "path outside of the directory")
+	}
+
+	return local, nil
+}
+
+// checkArchivePath rejects the archive paths under symlinks
+// (and the archive paths that are symlinks themselves if withLast is true)
+func checkArchivePath(dst, name string, withLast bool) error {
+	parts := strings.Split(name, string(filepath.Separator))
+	if !withLast {
+		parts = parts[:len(parts)-1]
+	}
+
+	current := dst
+	for _, part := range parts {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return unsafeEntry(name, "path under a symlink")
+		}
+	}
+
+	return nil
+}
+
+// isInsideLink returns true if the symlink target (relative to the symlink directory)
+// resolves inside of the extracted directory
+func isInsideLink(name, target string) bool {
+	if target == "" || filepath.IsAbs(filepath.FromSlash(target)) {
+		return false
+	}
+
+	resolved := filepath.Join(filepath.Dir(name), filepath.FromSlash(target))
+	return resolved != ".." && !strings.HasPrefix(resolved, ".."+string(filepath.Separator))
+}
+
+// isUnderPrefix returns true if the local archive path is in the prefix directory
+func isUnderPrefix(name, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+
+	prefix = filepath.Clean(filepath.FromSlash(prefix))
+	return name == prefix || strings.HasPrefix(name, prefix+string(filepath.Separator))
+}
+
+func hasParentRef(name string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if part == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+func unsafeEntry(name, reason string) error {
+	return &UnsafeArchiveError{Name: name, Reason: reason}
+}
+
+// WriteArchive writes a tar archive with the files in a local directory
+// (the archive paths are relative to the directory)
+func WriteArchive(src string, output io.Writer) error {
+	return WriteFilteredArchive(src, output, nil)
+}
+
+// WriteFilteredArchive writes a tar archive with the files in a local directory
+// skipping the files and the directories the skip function selects (it gets the archive paths)
+func WriteFilteredArchive(src string, output io.Writer, skip func(name string) bool) error {
+	tw := tar.NewWriter(output)
+	err := filepath.Walk(src, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(src, fullPath)
+		if err != nil || name == "." {
+			return err
+		}
+
+		if skip != nil && skip(filepath.ToSlash(name)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		var linkTarget string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if linkTarget, err = os.Readlink(fullPath); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, linkTarget)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// Compressed artifacts archive files (in the artifacts directory, the archive is compressed with zstd)
+const (
+	ArtifactsArchiveName  = "artifacts.tar.zst"
+	ArtifactsChecksumName = "artifacts.tar.zst.sha256"
+)
+
+// ErrArtifactsChecksum is returned when the compressed artifacts archive doesn't match its checksum
+var ErrArtifactsChecksum = errors.New("artifacts archive checksum mismatch")
+
+// PackArtifacts replaces the files in the artifacts directory with a compressed archive and its SHA-256 checksum
+// (the kept top level files are not packed, e.g., the log files that are still written)
+func PackArtifacts(artifactsPath string, keep ...string) error {
+	skipped := map[string]bool{
+		ArtifactsArchiveName:  true,
+		ArtifactsChecksumName: true,
+	}
+
+	for _, name := range keep {
+		skipped[name] = true
+	}
+
+	archivePath := filepath.Join(artifactsPath, ArtifactsArchiveName)
+	checksumPath := filepath.Join(artifactsPath, ArtifactsChecksumName)
+	checksum, err := writeCompressedArchive(artifactsPath, archivePath, func(name string) bool {
+		return skipped[name]
+	})
+	if err == nil {
+		err = ioutil.WriteFile(checksumPath, []byte(fmt.Sprintf("%s  %s\n", checksum, ArtifactsArchiveName)), 0644)
+	}
+
+	if err != nil {
+		//the uncompressed artifacts are still there
+		os.Remove(archivePath)
+		os.Remove(checksumPath)
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(artifactsPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !skipped[entry.Name()] {
+			if err := os.RemoveAll(filepath.Join(artifactsPath, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeCompressedArchive(src, archivePath string, skip func(name string) bool) (string, error) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	zw, err := zstd.NewWriter(io.MultiWriter(file, hash))
+	if err != nil {
+		return "", err
+	}
+
+	if err := WriteFilteredArchive(src, zw, skip); err != nil {
+		zw.Close()
+		return "", err
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// UnpackArtifacts extracts the compressed artifacts archive in the artifacts directory after verifying its checksum
+// (it returns false if there's no compressed archive, e.g., with the older sensors)
+func UnpackArtifacts(artifactsPath string) (bool, error) {
+	archivePath := filepath.Join(artifactsPath, ArtifactsArchiveName)
+	checksumPath := filepath.Join(artifactsPath, ArtifactsChecksumName)
+	if !Exists(archivePath) {
+		return false, nil
+	}
+
+	checksumData, err := ioutil.ReadFile(checksumPath)
+	if err != nil {
+		return true, err
+	}
+
+	expected := bytes.Fields(checksumData)
+	if len(expected) == 0 {
+		return true, ErrArtifactsChecksum
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return true, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return true, err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != string(expected[0]) {
+		return true, ErrArtifactsChecksum
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return true, err
+	}
+
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		return true, err
+	}
+	defer zr.Close()
+
+	if err := ExtractArtifactsArchive(zr, artifactsPath); err != nil {
+		return true, err
+	}
+
+	file.Close()
+	os.Remove(archivePath)
+	os.Remove(checksumPath)
+	return true, nil
+}
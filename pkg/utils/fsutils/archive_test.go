@@ -0,0 +1,490 @@
+package fsutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	data     string
+}
+
+func testArchive(t *testing.T, entries []testEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		hdr := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Mode:     0644,
+			Size:     int64(len(entry.data)),
+		}
+
+		if entry.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &buf
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    []testEntry
+		artifacts  bool
+		unsafe     bool
+		files      map[string]string
+		links      map[string]string
+		outsideTxt string
+	}{
+		{
+			name: "regular files and dirs",
+			entries: []testEntry{
+				{name: "dir/", typeflag: tar.TypeDir},
+				{name: "dir/file.txt", typeflag: tar.TypeReg, data: "data"},
+				{name: "other/nested/file.txt", typeflag: tar.TypeReg, data: "nested"},
+			},
+			files: map[string]string{
+				"dir/file.txt":          "data",
+				"other/nested/file.txt": "nested",
+			},
+		},
+		{
+			name: "links inside",
+			entries: []testEntry{
+				{name: "lib/libc.so.6", typeflag: tar.TypeReg, data: "libc"},
+				{name: "lib/libc.so", typeflag: tar.TypeSymlink, linkname: "libc.so.6"},
+				{name: "usr/lib/libc.so", typeflag: tar.TypeSymlink, linkname: "../../lib/libc.so.6"},
+				{name: "lib/libc.hard", typeflag: tar.TypeLink, linkname: "lib/libc.so.6"},
+			},
+			files: map[string]string{
+				"lib/libc.so":     "libc",
+				"usr/lib/libc.so": "libc",
+				"lib/libc.hard":   "libc",
+			},
+			links: map[string]string{
+				"lib/libc.so":     "libc.so.6",
+				"usr/lib/libc.so": "../../lib/libc.so.6",
+			},
+		},
+		{
+			name: "absolute path",
+			entries: []testEntry{
+				{name: "/outside.txt", typeflag: tar.TypeReg, data: "bad"},
+			},
+			unsafe: true,
+		},
+		{
+			name: "parent path",
+			entries: []testEntry{
+				{name: "dir/../../outside.txt", typeflag: tar.TypeReg, data: "bad"},
+			},
+			unsafe:     true,
+			outsideTxt: "outside.txt",
+		},
+		{
+			name: "absolute symlink",
+			entries: []testEntry{
+				{name: "passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+			},
+			unsafe: true,
+		},
+		{
+			name: "symlink escape",
+			entries: []testEntry{
+				{name: "dir/up", typeflag: tar.TypeSymlink, linkname: "../../.."},
+			},
+			unsafe: true,
+		},
+		{
+			name: "hard link escape",
+			entries: []testEntry{
+				{name: "hosts", typeflag: tar.TypeLink, linkname: "../outside.txt"},
+			},
+			unsafe: true,
+		},
+		{
+			name: "absolute hard link",
+			entries: []testEntry{
+				{name: "hosts", typeflag: tar.TypeLink, linkname: "/etc/hosts"},
+			},
+			unsafe: true,
+		},
+		{
+			name: "hard link with parent refs",
+			entries: []testEntry{
+				{name: "file.txt", typeflag: tar.TypeReg, data: "data"},
+				{name: "link.txt", typeflag: tar.TypeLink, linkname: "dir/../file.txt"},
+			},
+			unsafe: true,
+		},
+		{
+			name: "symlink then file",
+			entries: []testEntry{
+				{name: "escape", typeflag: tar.TypeSymlink, linkname: "../outside.txt"},
+				{name: "escape", typeflag: tar.TypeReg, data: "bad"},
+			},
+			artifacts:  true,
+			unsafe:     true,
+			outsideTxt: "outside.txt",
+		},
+		{
+			name: "symlink dir then file",
+			entries: []testEntry{
+				{name: "dir", typeflag: tar.TypeSymlink, linkname: ".."},
+				{name: "dir/outside.txt", typeflag: tar.TypeReg, data: "bad"},
+			},
+			artifacts:  true,
+			unsafe:     true,
+			outsideTxt: "outside.txt",
+		},
+		{
+			name: "inside symlink dir then file",
+			entries: []testEntry{
+				{name: "real/", typeflag: tar.TypeDir},
+				{name: "dir", typeflag: tar.TypeSymlink, linkname: "real"},
+				{name: "dir/file.txt", typeflag: tar.TypeReg, data: "data"},
+			},
+			unsafe: true,
+		},
+		{
+			name: "hard link through symlink",
+			entries: []testEntry{
+				{name: "dir", typeflag: tar.TypeSymlink, linkname: ".."},
+				{name: "hosts", typeflag: tar.TypeLink, linkname: "dir/outside.txt"},
+			},
+			artifacts: true,
+			unsafe:    true,
+		},
+		{
+			name: "artifacts with absolute symlink",
+			entries: []testEntry{
+				{name: "files/lib64/ld-linux-x86-64.so.2", typeflag: tar.TypeSymlink, linkname: "/lib/x86_64-linux-gnu/ld-2.31.so"},
+			},
+			artifacts: true,
+			links: map[string]string{
+				"files/lib64/ld-linux-x86-64.so.2": "/lib/x86_64-linux-gnu/ld-2.31.so",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "dslim-archive-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			dst := filepath.Join(root, "dst")
+			if err := os.Mkdir(dst, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			//the file outside of the extracted directory must stay the same
+			outsidePath := filepath.Join(root, "outside.txt")
+			if err := ioutil.WriteFile(outsidePath, []byte("original"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			archive := testArchive(t, test.entries)
+			if test.artifacts {
+				err = ExtractArtifactsArchive(archive, dst)
+			} else {
+				err = ExtractArchive(archive, dst)
+			}
+
+			if test.unsafe {
+				if _, ok := err.(*UnsafeArchiveError); !ok {
+					t.Fatalf("expected UnsafeArchiveError, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data, err := ioutil.ReadFile(outsidePath)
+			if err != nil || string(data) != "original" {
+				t.Fatalf("the file outside of the directory changed: %q (%v)", data, err)
+			}
+
+			if test.outsideTxt != "" && Exists(filepath.Join(dst, test.outsideTxt)) {
+				t.Fatalf("unexpected file: %v", test.outsideTxt)
+			}
+
+			for name, expected := range test.files {
+				data, err := ioutil.ReadFile(filepath.Join(dst, name))
+				if err != nil {
+					t.Fatalf("error reading %v: %v", name, err)
+				}
+
+				if string(data) != expected {
+					t.Fatalf("%v: expected %q, got %q", name, expected, data)
+				}
+			}
+
+			for name, expected := range test.links {
+				target, err := os.Readlink(filepath.Join(dst, name))
+				if err != nil {
+					t.Fatalf("error reading link %v: %v", name, err)
+				}
+
+				if target != expected {
+					t.Fatalf("%v: expected link %q, got %q", name, expected, target)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src, err := ioutil.TempDir("", "dslim-archive-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := os.MkdirAll(filepath.Join(src, "files", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "files", "bin", "app"), []byte("app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("app", filepath.Join(src, "files", "bin", "app.link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempDir("", "dslim-archive-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := ExtractArchive(&buf, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "files", "bin", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("unexpected mode: %v", info.Mode())
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "files", "bin", "app.link"))
+	if err != nil || string(data) != "app" {
+		t.Fatalf("unexpected link data: %q (%v)", data, err)
+	}
+}
+
+func TestExtractImageArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		entries []testEntry
+		unsafe  bool
+		files   map[string]string
+	}{
+		{
+			name:   "files in the prefix directory",
+			prefix: "usr/lib",
+			entries: []testEntry{
+				{name: "app/", typeflag: tar.TypeDir},
+				{name: "app/lib.so", typeflag: tar.TypeReg, data: "lib"},
+				{name: "app/lib..so.1", typeflag: tar.TypeReg, data: "dots"},
+			},
+			files: map[string]string{
+				"usr/lib/app/lib.so":    "lib",
+				"usr/lib/app/lib..so.1": "dots",
+			},
+		},
+		{
+			name:   "prefix under an image symlink",
+			prefix: "lib64",
+			entries: []testEntry{
+				{name: "outside.txt", typeflag: tar.TypeReg, data: "bad"},
+			},
+			unsafe: true,
+		},
+		{
+			name:   "entry under an image symlink",
+			prefix: "usr",
+			entries: []testEntry{
+				{name: "escape/outside.txt", typeflag: tar.TypeReg, data: "bad"},
+			},
+			unsafe: true,
+		},
+		{
+			name:   "entry outside of the prefix directory",
+			prefix: "usr/lib",
+			entries: []testEntry{
+				{name: "../../etc/passwd", typeflag: tar.TypeReg, data: "bad"},
+			},
+			unsafe: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "dslim-archive-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			dst := filepath.Join(root, "files")
+			if err := os.MkdirAll(filepath.Join(dst, "usr"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			//the image symlinks in the kept files (absolute and relative)
+			if err := os.Symlink(root, filepath.Join(dst, "lib64")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Symlink("../..", filepath.Join(dst, "usr", "escape")); err != nil {
+				t.Fatal(err)
+			}
+
+			var extracted []string
+			err = ExtractImageArchive(testArchive(t, test.entries), dst, test.prefix, func(name string, hdr *tar.Header) {
+				extracted = append(extracted, name)
+			})
+
+			if test.unsafe {
+				if _, ok := err.(*UnsafeArchiveError); !ok {
+					t.Fatalf("expected UnsafeArchiveError, got %v", err)
+				}
+
+				if Exists(filepath.Join(root, "outside.txt")) {
+					t.Fatal("the file is written outside of the directory")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(extracted) != len(test.entries) {
+				t.Fatalf("unexpected extracted entries: %v", extracted)
+			}
+
+			for name, expected := range test.files {
+				data, err := ioutil.ReadFile(filepath.Join(dst, name))
+				if err != nil || string(data) != expected {
+					t.Fatalf("%v: expected %q, got %q (%v)", name, expected, data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPackArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dslim-artifacts-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"creport.json":       `{"monitors": {}}`,
+		"files/bin/app":      "app",
+		"files/etc/app.conf": "port=8080\n",
+		"sensor.log":         "sensor log\n",
+	}
+
+	for name, data := range files {
+		fpath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := PackArtifacts(dir, "sensor.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected the archive, its checksum and the kept file, got %v entries", len(entries))
+	}
+
+	archiveData, err := ioutil.ReadFile(filepath.Join(dir, ArtifactsArchiveName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the zstd frame magic number
+	if !bytes.HasPrefix(archiveData, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		t.Fatal("the artifacts archive is not compressed with zstd")
+	}
+
+	unpacked, err := UnpackArtifacts(dir)
+	if !unpacked || err != nil {
+		t.Fatalf("unexpected unpack result: %v (%v)", unpacked, err)
+	}
+
+	for name, expected := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != expected {
+			t.Fatalf("%v: unexpected data %q (%v)", name, data, err)
+		}
+	}
+
+	if Exists(filepath.Join(dir, ArtifactsArchiveName)) || Exists(filepath.Join(dir, ArtifactsChecksumName)) {
+		t.Fatal("the artifacts archive is not removed")
+	}
+
+	//the corrupted archive is not extracted
+	if err := PackArtifacts(dir, "sensor.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(dir, ArtifactsArchiveName)
+	if err := ioutil.WriteFile(archivePath, append(archiveData, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := UnpackArtifacts(dir); err != ErrArtifactsChecksum {
+		t.Fatalf("expected the checksum error, got %v", err)
+	}
+}
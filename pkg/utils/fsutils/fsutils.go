@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 
@@ -29,6 +30,14 @@ var (
 const (
 	stateBaseKey        = ".images"
 	stateArtifactsKey   = "artifacts"
+	stateJobsKey        = ".jobs"
+	stateWatchKey       = ".watch"
+	stateProfilesKey    = ".profiles"
+	stateMinifiedKey    = ".minified"
+	stateTelemetryKey   = ".telemetry"
+	stateSensorsKey     = ".sensors"
+	stateLockFileName   = ".lock"
+	stateAppKey         = "docker-slim"
 	stateArtifactsPerms = 0777
 )
 
@@ -132,34 +141,9 @@ func CopyRegularFile(src, dst string, makeDir bool) error {
 	}
 
 	if makeDir {
-		srcDirName, err := filepath.Abs(filepath.Dir(src))
-		if err != nil {
-			return err
-		}
-
-		dstDirName, err := filepath.Abs(filepath.Dir(dst))
-		if err != nil {
+		if err := makeDstDir(src, dst); err != nil {
 			return err
 		}
-
-		if _, err := os.Stat(dstDirName); err != nil {
-
-			if os.IsNotExist(err) {
-
-				srcDirInfo, err := os.Stat(srcDirName)
-				if err != nil {
-					return err
-				}
-
-				err = os.MkdirAll(dstDirName, srcDirInfo.Mode())
-				if err != nil {
-					return err
-				}
-
-			} else {
-				return err
-			}
-		}
 	}
 
 	d, err := os.Create(dst)
@@ -187,6 +171,61 @@ func CopyRegularFile(src, dst string, makeDir bool) error {
 	return d.Close()
 }
 
+// LinkOrCopyFile hard links the regular file to the destination or copies it if it can't be linked
+// (e.g., when the destination is on a different file system; the symlinks are always copied).
+// The linked files share their data and metadata, so they must not be modified in place.
+func LinkOrCopyFile(src, dst string, makeDir bool) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return CopyFile(src, dst, makeDir)
+	}
+
+	if makeDir {
+		if err := makeDstDir(src, dst); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Link(src, dst); err != nil {
+		log.Debugf("LinkOrCopyFile(%v,%v) - copying the file (%v)", src, dst, err)
+		return CopyRegularFile(src, dst, makeDir)
+	}
+
+	return nil
+}
+
+// makeDstDir creates the missing destination directory (with the source directory permissions)
+func makeDstDir(src, dst string) error {
+	srcDirName, err := filepath.Abs(filepath.Dir(src))
+	if err != nil {
+		return err
+	}
+
+	dstDirName, err := filepath.Abs(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dstDirName); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		srcDirInfo, err := os.Stat(srcDirName)
+		if err != nil {
+			return err
+		}
+
+		return os.MkdirAll(dstDirName, srcDirInfo.Mode())
+	}
+
+	return nil
+}
+
 func copyFileObjectHandler(
 	srcBase, dstBase string,
 	copyRelPath, skipErrors bool,
@@ -364,22 +403,66 @@ func FileDir(fileName string) string {
 	return dirName
 }
 
-// PrepareStateDirs ensures that the required application directories exist
-func PrepareStateDirs(statePrefix, imageID string) (string, string) {
-	log.Debugf("PrepareStateDirs(%v,%v)", statePrefix, imageID)
-
+// StateDirs returns the local volume path and the artifact location for the image
+// (without creating or removing anything)
+func StateDirs(statePrefix, imageID string) (string, string) {
 	//images IDs in Docker 1.9+ are prefixed with a hash type...
 	if strings.Contains(imageID, ":") {
 		parts := strings.Split(imageID, ":")
 		imageID = parts[1]
 	}
 
+	localVolumePath := filepath.Join(StateImagesDir(statePrefix), imageID)
+	return localVolumePath, filepath.Join(localVolumePath, stateArtifactsKey)
+}
+
+// StateImagesDir returns the state directory with the per-image state (without creating it)
+func StateImagesDir(statePrefix string) string {
+	return filepath.Join(StatePath(statePrefix), stateBaseKey)
+}
+
+// StatePath returns the absolute state base path
+// (the default state path is used if the state prefix is empty)
+func StatePath(statePrefix string) string {
 	if statePrefix == "" {
-		statePrefix = ExeDir()
+		return DefaultStatePath()
+	}
+
+	//the state directories are mounted in the target containers, so the path must be absolute
+	fullPath, err := filepath.Abs(statePrefix)
+	if err != nil {
+		return statePrefix
 	}
 
-	localVolumePath := filepath.Join(statePrefix, stateBaseKey, imageID)
-	artifactLocation := filepath.Join(localVolumePath, stateArtifactsKey)
+	return fullPath
+}
+
+// DefaultStatePath returns the user data directory for the state:
+// $XDG_DATA_HOME/docker-slim (~/.local/share/docker-slim by default) on Linux
+// and ~/Library/Application Support/docker-slim on macOS
+// (the state is not saved next to the binary, so the binary can be installed in a read-only location)
+func DefaultStatePath() string {
+	home, err := os.UserHomeDir()
+	if runtime.GOOS == "darwin" && err == nil {
+		return filepath.Join(home, "Library", "Application Support", stateAppKey)
+	}
+
+	if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+		return filepath.Join(dataHome, stateAppKey)
+	}
+
+	if err != nil || home == "" {
+		return filepath.Join(os.TempDir(), stateAppKey)
+	}
+
+	return filepath.Join(home, ".local", "share", stateAppKey)
+}
+
+// PrepareStateDirs ensures that the required application directories exist
+func PrepareStateDirs(statePrefix, imageID string) (string, string) {
+	log.Debugf("PrepareStateDirs(%v,%v)", statePrefix, imageID)
+
+	localVolumePath, artifactLocation := StateDirs(statePrefix, imageID)
 	artifactDir, err := os.Stat(artifactLocation)
 	if err == nil {
 		log.Debugf("PrepareStateDirs - removing existing state location: %v", artifactLocation)
@@ -405,6 +488,108 @@ func PrepareStateDirs(statePrefix, imageID string) (string, string) {
 	return localVolumePath, artifactLocation
 }
 
+// LockStateDir locks the image state directory, so the concurrent runs for the same image
+// don't remove or overwrite each other's artifacts (the concurrent runs for different images don't wait).
+// It calls onWait and waits if another run holds the lock.
+// The returned function releases the lock (the lock is also released when the process exits).
+func LockStateDir(localVolumePath string, onWait func()) (func(), error) {
+	if err := os.MkdirAll(localVolumePath, stateArtifactsPerms); err != nil {
+		return nil, err
+	}
+
+	lockFile, err := os.OpenFile(filepath.Join(localVolumePath, stateLockFileName), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := int(lockFile.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err != syscall.EWOULDBLOCK {
+			lockFile.Close()
+			return nil, err
+		}
+
+		if onWait != nil {
+			onWait()
+		}
+
+		if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+			lockFile.Close()
+			return nil, err
+		}
+	}
+
+	return func() {
+		syscall.Flock(fd, syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
+
+// PrepareJobsDir creates the state directory for the 'serve' mode jobs (if it doesn't exist)
+func PrepareJobsDir(statePrefix string) (string, error) {
+	jobsLocation := filepath.Join(StatePath(statePrefix), stateJobsKey)
+	if err := os.MkdirAll(jobsLocation, stateArtifactsPerms); err != nil {
+		return "", err
+	}
+
+	return jobsLocation, nil
+}
+
+// PrepareWatchDir creates the state directory for the 'watch' mode configurations (if it doesn't exist)
+func PrepareWatchDir(statePrefix string) (string, error) {
+	watchLocation := filepath.Join(StatePath(statePrefix), stateWatchKey)
+	if err := os.MkdirAll(watchLocation, stateArtifactsPerms); err != nil {
+		return "", err
+	}
+
+	return watchLocation, nil
+}
+
+// PrepareProfilesDir creates the state directory for the node agent profiles the 'serve' mode receives (if it doesn't exist)
+func PrepareProfilesDir(statePrefix string) (string, error) {
+	profilesLocation := filepath.Join(StatePath(statePrefix), stateProfilesKey)
+	if err := os.MkdirAll(profilesLocation, stateArtifactsPerms); err != nil {
+		return "", err
+	}
+
+	return profilesLocation, nil
+}
+
+// PrepareMinifiedDir creates the state directory for the minified image links (if it doesn't exist)
+func PrepareMinifiedDir(statePrefix string) (string, error) {
+	minifiedLocation := filepath.Join(StatePath(statePrefix), stateMinifiedKey)
+	if err := os.MkdirAll(minifiedLocation, stateArtifactsPerms); err != nil {
+		return "", err
+	}
+
+	return minifiedLocation, nil
+}
+
+// StateTelemetryDir returns the state directory with the local telemetry records (without creating it)
+func StateTelemetryDir(statePrefix string) string {
+	return filepath.Join(StatePath(statePrefix), stateTelemetryKey)
+}
+
+// PrepareTelemetryDir creates the state directory for the local telemetry records (if it doesn't exist)
+func PrepareTelemetryDir(statePrefix string) (string, error) {
+	telemetryLocation := StateTelemetryDir(statePrefix)
+	if err := os.MkdirAll(telemetryLocation, stateArtifactsPerms); err != nil {
+		return "", err
+	}
+
+	return telemetryLocation, nil
+}
+
+// PrepareSensorsDir creates the state directory for the sensors extracted from the docker-slim binary (if it doesn't exist)
+func PrepareSensorsDir(statePrefix string) (string, error) {
+	sensorsLocation := filepath.Join(StatePath(statePrefix), stateSensorsKey)
+	if err := os.MkdirAll(sensorsLocation, stateArtifactsPerms); err != nil {
+		return "", err
+	}
+
+	return sensorsLocation, nil
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 // UpdateFileTimes updates the atime and mtime timestamps on the target file
@@ -0,0 +1,444 @@
+package fsutils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SealedArtifactsName is the encrypted artifacts archive file name (in the artifacts directory)
+const SealedArtifactsName = "artifacts.tar.gz.enc"
+
+// The encrypted archive is the compressed artifacts archive encrypted with AES-256-GCM in chunks
+// (the archives can be large, so they are not encrypted in memory). The archive header has the format magic,
+// the key derivation salt and the nonce prefix. Each chunk has its size, the last chunk flag
+// (authenticated, so a truncated archive is detected) and the encrypted data.
+const (
+	sealMagic         = "DSLIMENC1"
+	sealSaltSize      = 16
+	sealPrefixSize    = 4
+	sealChunkSize     = 64 * 1024
+	sealKeyIterations = 100000
+	sealKeySize       = 32
+)
+
+// Artifact encryption errors
+var (
+	ErrNoStateKey  = errors.New("the artifacts are encrypted (set the state key to decrypt them)")
+	ErrSealedData  = errors.New("can't decrypt the artifacts (wrong state key or corrupted archive)")
+	ErrSealedMagic = errors.New("not an encrypted artifacts archive")
+)
+
+var (
+	stateKeyLock sync.Mutex
+	stateKey     []byte
+)
+
+// SetStateKey sets the passphrase for the artifact encryption (an empty passphrase disables the encryption)
+func SetStateKey(passphrase string) {
+	stateKeyLock.Lock()
+	defer stateKeyLock.Unlock()
+
+	if passphrase == "" {
+		stateKey = nil
+		return
+	}
+
+	stateKey = []byte(passphrase)
+}
+
+// HasStateKey returns true if the artifacts are encrypted at rest
+func HasStateKey() bool {
+	stateKeyLock.Lock()
+	defer stateKeyLock.Unlock()
+
+	return len(stateKey) > 0
+}
+
+func currentStateKey() []byte {
+	stateKeyLock.Lock()
+	defer stateKeyLock.Unlock()
+
+	return stateKey
+}
+
+// IsSealed returns true if the artifacts directory has the encrypted artifacts archive
+func IsSealed(artifactsPath string) bool {
+	return Exists(filepath.Join(artifactsPath, SealedArtifactsName))
+}
+
+// SealArtifacts replaces the files in the artifacts directory with the encrypted artifacts archive
+// (it does nothing if there's no state key or if the directory doesn't exist)
+func SealArtifacts(artifactsPath string) error {
+	passphrase := currentStateKey()
+	if len(passphrase) == 0 || !IsDir(artifactsPath) {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(artifactsPath)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 || (len(entries) == 1 && entries[0].Name() == SealedArtifactsName) {
+		return nil
+	}
+
+	archivePath := filepath.Join(artifactsPath, SealedArtifactsName)
+	tmpPath := archivePath + ".tmp"
+	skip := func(name string) bool {
+		return name == SealedArtifactsName || name == SealedArtifactsName+".tmp"
+	}
+
+	if err := writeSealedArchive(artifactsPath, tmpPath, passphrase, skip); err != nil {
+		//the unencrypted artifacts are still there
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	for _, entry := range entries {
+		if !skip(entry.Name()) {
+			if err := os.RemoveAll(filepath.Join(artifactsPath, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnsealArtifacts decrypts the encrypted artifacts archive in the artifacts directory and extracts it there
+// (it returns false if there's no encrypted archive). If the archive can't be decrypted,
+// the partially extracted files are removed and the archive is kept.
+func UnsealArtifacts(artifactsPath string) (bool, error) {
+	archivePath := filepath.Join(artifactsPath, SealedArtifactsName)
+	if !Exists(archivePath) {
+		return false, nil
+	}
+
+	if err := extractSealedArchive(archivePath, artifactsPath); err != nil {
+		if entries, readErr := ioutil.ReadDir(artifactsPath); readErr == nil {
+			for _, entry := range entries {
+				if entry.Name() != SealedArtifactsName {
+					os.RemoveAll(filepath.Join(artifactsPath, entry.Name()))
+				}
+			}
+		}
+
+		return true, err
+	}
+
+	return true, os.Remove(archivePath)
+}
+
+// OpenArtifacts returns the directory with the decrypted artifacts for the artifacts directory
+// (the encrypted artifacts are extracted to a temporary directory, the close function removes it;
+// the artifacts directory itself is returned if it's not encrypted)
+func OpenArtifacts(artifactsPath string) (string, func(), error) {
+	archivePath := filepath.Join(artifactsPath, SealedArtifactsName)
+	if !Exists(archivePath) {
+		return artifactsPath, func() {}, nil
+	}
+
+	tmpDir, err := ioutil.TempDir("", "docker-slim-artifacts-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	closeFunc := func() {
+		os.RemoveAll(tmpDir)
+	}
+
+	if err := extractSealedArchive(archivePath, tmpDir); err != nil {
+		closeFunc()
+		return "", nil, err
+	}
+
+	return tmpDir, closeFunc, nil
+}
+
+func writeSealedArchive(src, archivePath string, passphrase []byte, skip func(name string) bool) error {
+	file, err := os.OpenFile(archivePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sw, err := newSealWriter(file, passphrase)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(sw)
+	if err := WriteFilteredArchive(src, zw, skip); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := sw.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func extractSealedArchive(archivePath, dst string) error {
+	passphrase := currentStateKey()
+	if len(passphrase) == 0 {
+		return ErrNoStateKey
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sr, err := newSealReader(file, passphrase)
+	if err != nil {
+		return err
+	}
+
+	zr, err := gzip.NewReader(sr)
+	if err != nil {
+		if err == ErrSealedData {
+			return err
+		}
+
+		return ErrSealedData
+	}
+	defer zr.Close()
+
+	if err := ExtractArtifactsArchive(zr, dst); err != nil {
+		if sr.err != nil {
+			return sr.err
+		}
+
+		return err
+	}
+
+	//the trailing data after the compressed archive (if any) must be authentic too
+	if _, err := io.Copy(ioutil.Discard, sr); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sealKey derives the encryption key from the passphrase (PBKDF2 with HMAC-SHA256)
+func sealKey(passphrase, salt []byte) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	var key []byte
+	for block := uint32(1); len(key) < sealKeySize; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var blockIdx [4]byte
+		binary.BigEndian.PutUint32(blockIdx[:], block)
+		prf.Write(blockIdx[:])
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < sealKeyIterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:sealKeySize]
+}
+
+func newSealAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(sealKey(passphrase, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func sealNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, sealPrefixSize+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[sealPrefixSize:], counter)
+	return nonce
+}
+
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	buf     []byte
+}
+
+func newSealWriter(w io.Writer, passphrase []byte) (*sealWriter, error) {
+	header := make([]byte, len(sealMagic)+sealSaltSize+sealPrefixSize)
+	copy(header, sealMagic)
+	if _, err := io.ReadFull(rand.Reader, header[len(sealMagic):]); err != nil {
+		return nil, err
+	}
+
+	salt := header[len(sealMagic) : len(sealMagic)+sealSaltSize]
+	aead, err := newSealAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &sealWriter{
+		w:      w,
+		aead:   aead,
+		prefix: header[len(sealMagic)+sealSaltSize:],
+		buf:    make([]byte, 0, sealChunkSize),
+	}, nil
+}
+
+func (s *sealWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		n := sealChunkSize - len(s.buf)
+		if n > len(data) {
+			n = len(data)
+		}
+
+		s.buf = append(s.buf, data[:n]...)
+		data = data[n:]
+		written += n
+		if len(s.buf) == sealChunkSize {
+			if err := s.writeChunk(false); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// Close writes the last chunk (it doesn't close the underlying writer)
+func (s *sealWriter) Close() error {
+	return s.writeChunk(true)
+}
+
+func (s *sealWriter) writeChunk(last bool) error {
+	flag := []byte{0}
+	if last {
+		flag[0] = 1
+	}
+
+	sealed := s.aead.Seal(nil, sealNonce(s.prefix, s.counter), s.buf, flag)
+	s.counter++
+	s.buf = s.buf[:0]
+
+	var chunkHeader [5]byte
+	binary.BigEndian.PutUint32(chunkHeader[:4], uint32(len(sealed)))
+	chunkHeader[4] = flag[0]
+	if _, err := s.w.Write(chunkHeader[:]); err != nil {
+		return err
+	}
+
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+type sealReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	buf     bytes.Buffer
+	done    bool
+	err     error
+}
+
+func newSealReader(r io.Reader, passphrase []byte) (*sealReader, error) {
+	header := make([]byte, len(sealMagic)+sealSaltSize+sealPrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrSealedMagic
+	}
+
+	if string(header[:len(sealMagic)]) != sealMagic {
+		return nil, ErrSealedMagic
+	}
+
+	aead, err := newSealAEAD(passphrase, header[len(sealMagic):len(sealMagic)+sealSaltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealReader{
+		r:      r,
+		aead:   aead,
+		prefix: header[len(sealMagic)+sealSaltSize:],
+	}, nil
+}
+
+func (s *sealReader) Read(data []byte) (int, error) {
+	for s.buf.Len() == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		if s.done {
+			return 0, io.EOF
+		}
+
+		s.err = s.readChunk()
+	}
+
+	return s.buf.Read(data)
+}
+
+func (s *sealReader) readChunk() error {
+	var chunkHeader [5]byte
+	if _, err := io.ReadFull(s.r, chunkHeader[:]); err != nil {
+		//the archive without the last chunk is truncated
+		return ErrSealedData
+	}
+
+	size := binary.BigEndian.Uint32(chunkHeader[:4])
+	if size > sealChunkSize+uint32(s.aead.Overhead()) || chunkHeader[4] > 1 {
+		return ErrSealedData
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(s.r, sealed); err != nil {
+		return ErrSealedData
+	}
+
+	plain, err := s.aead.Open(nil, sealNonce(s.prefix, s.counter), sealed, chunkHeader[4:])
+	if err != nil {
+		return ErrSealedData
+	}
+
+	s.counter++
+	s.done = chunkHeader[4] == 1
+	s.buf.Write(plain)
+	return nil
+}
@@ -0,0 +1,281 @@
+package fsutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testStateKey = "secret"
+
+// writeTestArtifacts creates the artifacts with enough (incompressible) data for several encrypted chunks
+func writeTestArtifacts(t *testing.T, dir string) map[string][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	large := make([]byte, 3*sealChunkSize+100)
+	rnd.Read(large)
+
+	files := map[string][]byte{
+		"creport.json":        []byte(`{"monitors": {}}`),
+		"files/bin/app":       large,
+		"files/etc/app.conf":  []byte("port=8080\n"),
+		"files/etc/empty.txt": {},
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return files
+}
+
+func checkTestArtifacts(t *testing.T, dir string, files map[string][]byte) {
+	for name, expected := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("error reading %v: %v", name, err)
+		}
+
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("%v: unexpected data (%v bytes, expected %v bytes)", name, len(data), len(expected))
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dslim-seal-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return dir
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	SetStateKey(testStateKey)
+	defer SetStateKey("")
+
+	dir := tempDir(t)
+	files := writeTestArtifacts(t, dir)
+
+	if err := SealArtifacts(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != SealedArtifactsName {
+		t.Fatalf("expected only the encrypted archive, got %v entries", len(entries))
+	}
+
+	openDir, closeFunc, err := OpenArtifacts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTestArtifacts(t, openDir, files)
+	closeFunc()
+	if Exists(openDir) {
+		t.Fatal("the decrypted artifacts are not removed")
+	}
+
+	sealed, err := UnsealArtifacts(dir)
+	if err != nil || !sealed {
+		t.Fatalf("unexpected unseal result: %v (%v)", sealed, err)
+	}
+
+	checkTestArtifacts(t, dir, files)
+	if IsSealed(dir) {
+		t.Fatal("the encrypted archive is not removed")
+	}
+}
+
+func TestSealWithoutStateKey(t *testing.T) {
+	SetStateKey("")
+
+	dir := tempDir(t)
+	files := writeTestArtifacts(t, dir)
+
+	if err := SealArtifacts(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if IsSealed(dir) {
+		t.Fatal("unexpected encrypted archive")
+	}
+
+	checkTestArtifacts(t, dir, files)
+}
+
+// sealedChunks returns the offsets of the encrypted chunks in the archive
+func sealedChunks(t *testing.T, data []byte) []int {
+	var offsets []int
+	offset := len(sealMagic) + sealSaltSize + sealPrefixSize
+	for offset < len(data) {
+		offsets = append(offsets, offset)
+		offset += 5 + int(binary.BigEndian.Uint32(data[offset:offset+4]))
+	}
+
+	if len(offsets) < 3 {
+		t.Fatalf("expected at least 3 chunks, got %v", len(offsets))
+	}
+
+	return offsets
+}
+
+func TestUnsealTampered(t *testing.T) {
+	SetStateKey(testStateKey)
+	defer SetStateKey("")
+
+	src := tempDir(t)
+	writeTestArtifacts(t, src)
+	if err := SealArtifacts(src); err != nil {
+		t.Fatal(err)
+	}
+
+	sealedData, err := ioutil.ReadFile(filepath.Join(src, SealedArtifactsName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := sealedChunks(t, sealedData)
+	last := chunks[len(chunks)-1]
+
+	tests := []struct {
+		name     string
+		key      string
+		modify   func(data []byte) []byte
+		expected error
+	}{
+		{
+			name:     "no state key",
+			expected: ErrNoStateKey,
+		},
+		{
+			name:     "wrong state key",
+			key:      "wrong",
+			expected: ErrSealedData,
+		},
+		{
+			name: "bad magic",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				data[0] ^= 0xff
+				return data
+			},
+			expected: ErrSealedMagic,
+		},
+		{
+			name: "modified salt",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				data[len(sealMagic)] ^= 1
+				return data
+			},
+			expected: ErrSealedData,
+		},
+		{
+			name: "modified first chunk",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				data[chunks[0]+5+10] ^= 1
+				return data
+			},
+			expected: ErrSealedData,
+		},
+		{
+			name: "modified middle chunk",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				data[chunks[1]+5+10] ^= 1
+				return data
+			},
+			expected: ErrSealedData,
+		},
+		{
+			name: "truncated",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				return data[:len(data)-1]
+			},
+			expected: ErrSealedData,
+		},
+		{
+			name: "last chunk removed",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				return data[:last]
+			},
+			expected: ErrSealedData,
+		},
+		{
+			name: "last chunk flag cleared",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				data[last+4] = 0
+				return data
+			},
+			expected: ErrSealedData,
+		},
+		{
+			name: "swapped chunks",
+			key:  testStateKey,
+			modify: func(data []byte) []byte {
+				first := append([]byte{}, data[chunks[0]:chunks[1]]...)
+				second := append([]byte{}, data[chunks[1]:chunks[2]]...)
+				swapped := append([]byte{}, data[:chunks[0]]...)
+				swapped = append(swapped, second...)
+				swapped = append(swapped, first...)
+				return append(swapped, data[chunks[2]:]...)
+			},
+			expected: ErrSealedData,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := append([]byte{}, sealedData...)
+			if test.modify != nil {
+				data = test.modify(data)
+			}
+
+			dir := tempDir(t)
+			if err := ioutil.WriteFile(filepath.Join(dir, SealedArtifactsName), data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			SetStateKey(test.key)
+			sealed, err := UnsealArtifacts(dir)
+			if !sealed || err != test.expected {
+				t.Fatalf("expected %v, got %v (%v)", test.expected, err, sealed)
+			}
+
+			//the partially extracted files are removed and the archive is kept
+			entries, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != 1 || entries[0].Name() != SealedArtifactsName {
+				t.Fatalf("expected only the encrypted archive, got %v entries", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package logutils
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// SensorLogFileName is the sensor log file name in the artifacts directory
+const SensorLogFileName = "sensor.log"
+
+var currentFormat = FormatText
+
+// SetFormat configures the log format ('text' or 'json')
+func SetFormat(format string) error {
+	switch format {
+	case FormatText:
+		log.SetFormatter(&log.TextFormatter{DisableColors: true})
+	case FormatJSON:
+		log.SetFormatter(new(log.JSONFormatter))
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	currentFormat = format
+	return nil
+}
+
+// Format returns the configured log format
+func Format() string {
+	return currentFormat
+}
+
+// SetOutputFile sends the logs to the log file
+// (the logs also go to stderr if keepStderr is true)
+func SetOutputFile(filePath string, keepStderr bool) error {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if keepStderr {
+		log.SetOutput(io.MultiWriter(os.Stderr, f))
+	} else {
+		log.SetOutput(f)
+	}
+
+	return nil
+}
+
+// Setup configures the log format and the log file (if it's not empty)
+func Setup(format, filePath string, keepStderr bool) error {
+	if err := SetFormat(format); err != nil {
+		return err
+	}
+
+	if filePath != "" {
+		return SetOutputFile(filePath, keepStderr)
+	}
+
+	return nil
+}
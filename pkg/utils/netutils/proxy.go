@@ -0,0 +1,81 @@
+package netutils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// the proxy environment variables (both variants are set, the tools don't agree on which one to use)
+var (
+	httpProxyVars  = []string{"HTTP_PROXY", "http_proxy"}
+	httpsProxyVars = []string{"HTTPS_PROXY", "https_proxy"}
+	noProxyVars    = []string{"NO_PROXY", "no_proxy"}
+)
+
+// SetProxy sets the proxy environment variables (the empty values don't change them).
+// The HTTP clients and the external tools (ctr and kubectl) use the proxy environment variables
+// and the HTTP clients load them only once, so the proxies have to be set before the first request.
+func SetProxy(httpProxy, httpsProxy, noProxy string) error {
+	for _, proxyURL := range []string{httpProxy, httpsProxy} {
+		if proxyURL == "" {
+			continue
+		}
+
+		if info, err := url.Parse(proxyURL); err != nil || info.Host == "" {
+			return fmt.Errorf("invalid proxy URL - %v", proxyURL)
+		}
+	}
+
+	for _, setting := range []struct {
+		value string
+		names []string
+	}{
+		{httpProxy, httpProxyVars},
+		{httpsProxy, httpsProxyVars},
+		{noProxy, noProxyVars},
+	} {
+		if setting.value == "" {
+			continue
+		}
+
+		for _, name := range setting.names {
+			if err := os.Setenv(name, setting.value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ProxyFor returns the proxy URL for the request URL (nil if the request doesn't use a proxy)
+func ProxyFor(target string) *url.URL {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil
+	}
+
+	proxyURL, err := http.ProxyFromEnvironment(req)
+	if err != nil {
+		return nil
+	}
+
+	return proxyURL
+}
+
+// ProxyError adds the proxy information to the request error if the request uses a proxy
+// (the proxy errors are often indistinguishable from the target errors)
+func ProxyError(err error, target string) error {
+	if err == nil {
+		return nil
+	}
+
+	proxyURL := ProxyFor(target)
+	if proxyURL == nil {
+		return err
+	}
+
+	return fmt.Errorf("%v (via proxy %v, use NO_PROXY or --no-proxy to connect directly)", err, proxyURL.Redacted())
+}
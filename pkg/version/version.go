@@ -22,3 +22,8 @@ func init() {
 func Current() string {
 	return currentVersion
 }
+
+// Tag returns the current version tag
+func Tag() string {
+	return appVersionTag
+}
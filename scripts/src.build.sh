@@ -11,7 +11,6 @@ export CGO_ENABLED=0
 source ${SDIR}/env.sh
 BDIR_GOPATH=${BDIR}/_gopath/src/github.com/docker-slim/docker-slim
 
-pushd ${BDIR_GOPATH}/cmd/docker-slim
 BUILD_TIME="$(date -u '+%Y-%m-%d_%I:%M:%S%p')"
 TAG="current"
 REVISION="current"
@@ -22,18 +21,38 @@ fi
 
 LD_FLAGS="-X github.com/docker-slim/docker-slim/pkg/version.appVersionTag=${TAG} -X github.com/docker-slim/docker-slim/pkg/version.appVersionRev=${REVISION} -X github.com/docker-slim/docker-slim/pkg/version.appVersionTime=${BUILD_TIME}"
 
+# the sensor runs in the target containers, so it's built for all supported image architectures
+# (docker-slim picks docker-slim-sensor-<arch> matching the target image architecture)
+SENSOR_ARCHS="amd64 arm64"
+pushd ${BDIR_GOPATH}/cmd/docker-slim-sensor
+gox -osarch="linux/amd64" -ldflags "${LD_FLAGS}" -output="${BDIR_GOPATH}/bin/linux/docker-slim-sensor"
+gox -osarch="linux/arm64" -ldflags "${LD_FLAGS}" -output="${BDIR_GOPATH}/bin/linux_arm64/docker-slim-sensor"
+popd
+cp ${BDIR_GOPATH}/bin/linux/docker-slim-sensor ${BDIR_GOPATH}/bin/docker-slim-sensor-amd64
+cp ${BDIR_GOPATH}/bin/linux_arm64/docker-slim-sensor ${BDIR_GOPATH}/bin/docker-slim-sensor-arm64
+# the sensors are embedded in docker-slim (with their checksums), so docker-slim works without the sensor files next to it
+SENSORBIN_DIR=${BDIR_GOPATH}/internal/app/master/sensorbin/bin
+for ARCH in ${SENSOR_ARCHS}; do
+  cp ${BDIR_GOPATH}/bin/docker-slim-sensor-${ARCH} ${SENSORBIN_DIR}/
+  pushd ${SENSORBIN_DIR}
+  if hash sha256sum 2>/dev/null; then
+    sha256sum docker-slim-sensor-${ARCH} > docker-slim-sensor-${ARCH}.sha256
+  else
+    shasum -a 256 docker-slim-sensor-${ARCH} > docker-slim-sensor-${ARCH}.sha256
+  fi
+  popd
+done
+pushd ${BDIR_GOPATH}/cmd/docker-slim
 gox -osarch="linux/amd64" -ldflags "${LD_FLAGS}" -output "${BDIR_GOPATH}/bin/linux/docker-slim" 
+gox -osarch="linux/arm64" -ldflags "${LD_FLAGS}" -output "${BDIR_GOPATH}/bin/linux_arm64/docker-slim"
 gox -osarch="darwin/amd64" -ldflags "${LD_FLAGS}" -output "${BDIR_GOPATH}/bin/mac/docker-slim"
-#gox -osarch="linux/arm" -output "$BDIR_GOPATH/bin/linux_arm/docker-slim"
-popd
-pushd ${BDIR_GOPATH}/cmd/docker-slim-sensor
-gox -osarch="linux/amd64" -output="${BDIR_GOPATH}/bin/linux/docker-slim-sensor"
-#gox -osarch="linux/arm" -output "$BDIR_GOPATH/bin/linux_arm/docker-slim-sensor"
 popd
+rm -fv ${SENSORBIN_DIR}/docker-slim-sensor-*
 rm -rfv ${BDIR_GOPATH}/dist_mac
 mkdir ${BDIR_GOPATH}/dist_mac
 cp ${BDIR_GOPATH}/bin/mac/docker-slim ${BDIR_GOPATH}/dist_mac/docker-slim
 cp ${BDIR_GOPATH}/bin/linux/docker-slim-sensor ${BDIR_GOPATH}/dist_mac/docker-slim-sensor
+for ARCH in ${SENSOR_ARCHS}; do cp ${BDIR_GOPATH}/bin/docker-slim-sensor-${ARCH} ${BDIR_GOPATH}/dist_mac/; done
 pushd ${BDIR_GOPATH}
 zip -r dist_mac.zip dist_mac -x "*.DS_Store"
 popd
@@ -41,11 +60,23 @@ rm -rfv ${BDIR_GOPATH}/dist_linux
 mkdir ${BDIR_GOPATH}/dist_linux
 cp ${BDIR_GOPATH}/bin/linux/docker-slim ${BDIR_GOPATH}/dist_linux/docker-slim
 cp ${BDIR_GOPATH}/bin/linux/docker-slim-sensor ${BDIR_GOPATH}/dist_linux/docker-slim-sensor
-#rm -rfv $BDIR_GOPATH/dist_linux_arm
-#mkdir $BDIR_GOPATH/dist_linux_arm
-#cp $BDIR_GOPATH/bin/linux_arm/docker-slim $BDIR_GOPATH/dist_linux_arm/docker-slim
-#cp $BDIR_GOPATH/bin/linux_arm/docker-slim-sensor $BDIR_GOPATH/dist_linux_arm/docker-slim-sensor
+for ARCH in ${SENSOR_ARCHS}; do cp ${BDIR_GOPATH}/bin/docker-slim-sensor-${ARCH} ${BDIR_GOPATH}/dist_linux/; done
+rm -rfv ${BDIR_GOPATH}/dist_linux_arm64
+mkdir ${BDIR_GOPATH}/dist_linux_arm64
+cp ${BDIR_GOPATH}/bin/linux_arm64/docker-slim ${BDIR_GOPATH}/dist_linux_arm64/docker-slim
+cp ${BDIR_GOPATH}/bin/linux_arm64/docker-slim-sensor ${BDIR_GOPATH}/dist_linux_arm64/docker-slim-sensor
+for ARCH in ${SENSOR_ARCHS}; do cp ${BDIR_GOPATH}/bin/docker-slim-sensor-${ARCH} ${BDIR_GOPATH}/dist_linux_arm64/; done
 pushd ${BDIR_GOPATH}
 tar -czvf dist_linux.tar.gz dist_linux
+tar -czvf dist_linux_arm64.tar.gz dist_linux_arm64
+if hash sha256sum 2>/dev/null; then
+  sha256sum dist_mac.zip dist_linux.tar.gz dist_linux_arm64.tar.gz > SHA256SUMS
+else
+  shasum -a 256 dist_mac.zip dist_linux.tar.gz dist_linux_arm64.tar.gz > SHA256SUMS
+fi
+# 'docker-slim update' trusts the checksums only if they are signed with the release key (Ed25519, PEM file)
+if [ -n "${DSLIM_RELEASE_KEY}" ]; then
+  openssl pkeyutl -sign -rawin -inkey "${DSLIM_RELEASE_KEY}" -in SHA256SUMS -out SHA256SUMS.sig
+fi
 popd
 rm -rfv ${BDIR_GOPATH}/bin
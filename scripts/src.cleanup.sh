@@ -11,4 +11,6 @@ rm -rfv $BDIR/_gopath
 rm -rfv $BDIR/dist_linux
 rm -fv $BDIR/dist_linux.tar.gz
 rm -rfv $BDIR/dist_mac
-rm -fv $BDIR/dist_mac.zip
\ No newline at end of file
+rm -fv $BDIR/dist_mac.zip
+rm -fv $BDIR/SHA256SUMS
+rm -fv $BDIR/SHA256SUMS.sig